@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Message variants in A/B mode: A from LLM_MODEL, B from LLM_MODEL_B
+const (
+	VariantA = "a"
+	VariantB = "b"
+)
+
+// Number of model comparisons kept in memory
+const maxModelComparisons = 200
+
+var (
+	errComparisonNotFound = errors.New("comparison not found")
+	errAlreadyVoted       = errors.New("already voted on this comparison")
+)
+
+// The messages two models wrote from the same weather, and the votes for each
+type ModelComparison struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	City        string    `json:"city"`
+	Persona     string    `json:"persona,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	ModelA      string    `json:"model_a"`
+	ModelB      string    `json:"model_b"`
+	MessageA    string    `json:"message_a"`
+	MessageB    string    `json:"message_b"`
+	VotesA      int       `json:"votes_a"`
+	VotesB      int       `json:"votes_b"`
+}
+
+// The message and model for a variant
+func (c ModelComparison) variant(variant string) (string, string) {
+	if variant == VariantB {
+		return c.MessageB, c.ModelB
+	}
+	return c.MessageA, c.ModelA
+}
+
+// Votes for a pair of models across all their comparisons
+type ModelTally struct {
+	ModelA string `json:"model_a"`
+	ModelB string `json:"model_b"`
+	VotesA int    `json:"votes_a"`
+	VotesB int    `json:"votes_b"`
+}
+
+// Bounded, concurrency-safe store of model comparisons. Tallies outlive the
+// comparisons they came from.
+type comparisonStore struct {
+	mu         sync.Mutex
+	records    []ModelComparison
+	voters     map[string]map[string]bool // Clients who voted, by comparison ID
+	tallies    map[string]*ModelTally     // Keyed by model pair
+	generating map[string]bool            // B messages in progress, by fingerprint and persona
+	pending    sync.WaitGroup             // B messages in progress (tests wait on it)
+}
+
+func newComparisonStore() *comparisonStore {
+	return &comparisonStore{voters: make(map[string]map[string]bool), tallies: make(map[string]*ModelTally),
+		generating: make(map[string]bool)}
+}
+
+// Claim generating the B message for key, false if it's already in progress
+func (s *comparisonStore) begin(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generating[key] {
+		return false
+	}
+	s.generating[key] = true
+	s.pending.Add(1)
+	return true
+}
+
+func (s *comparisonStore) finish(key string) {
+	s.mu.Lock()
+	delete(s.generating, key)
+	s.mu.Unlock()
+	s.pending.Done()
+}
+
+// Store a comparison. The same messages for the same weather and persona
+// (e.g. from the LLM cache) are stored once, so votes gather on one record.
+func (s *comparisonStore) add(c ModelComparison) ModelComparison {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.records {
+		if existing.Fingerprint == c.Fingerprint && existing.Persona == c.Persona &&
+			existing.MessageA == c.MessageA && existing.MessageB == c.MessageB {
+			return existing
+		}
+	}
+
+	if c.ID == "" {
+		c.ID = newMessageID()
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	if len(s.records) >= maxModelComparisons {
+		delete(s.voters, s.records[0].ID)
+		s.records = s.records[1:]
+	}
+	s.records = append(s.records, c)
+	return c
+}
+
+// The latest comparison for the weather fingerprint and persona
+func (s *comparisonStore) find(fingerprint, persona string) (ModelComparison, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if c := s.records[i]; c.Fingerprint == fingerprint && c.Persona == persona {
+			return c, true
+		}
+	}
+	return ModelComparison{}, false
+}
+
+func (s *comparisonStore) get(id string) (ModelComparison, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.records {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return ModelComparison{}, false
+}
+
+// Count a client's preference, once per client and comparison
+func (s *comparisonStore) vote(id, variant, client string) (ModelComparison, error) {
+	if variant != VariantA && variant != VariantB {
+		return ModelComparison{}, fmt.Errorf("preferred must be %q or %q", VariantA, VariantB)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.records {
+		c := &s.records[i]
+		if c.ID != id {
+			continue
+		}
+		if s.voters[id][client] {
+			return *c, errAlreadyVoted
+		}
+		if s.voters[id] == nil {
+			s.voters[id] = make(map[string]bool)
+		}
+		s.voters[id][client] = true
+
+		key := c.ModelA + "|" + c.ModelB
+		tally, ok := s.tallies[key]
+		if !ok {
+			tally = &ModelTally{ModelA: c.ModelA, ModelB: c.ModelB}
+			s.tallies[key] = tally
+		}
+		if variant == VariantA {
+			c.VotesA++
+			tally.VotesA++
+		} else {
+			c.VotesB++
+			tally.VotesB++
+		}
+		return *c, nil
+	}
+	return ModelComparison{}, errComparisonNotFound
+}
+
+// Comparisons newest first, at most limit, and the tallies per model pair
+func (s *comparisonStore) list(limit int) ([]ModelComparison, []ModelTally) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comparisons := make([]ModelComparison, 0)
+	for i := len(s.records) - 1; i >= 0 && len(comparisons) < limit; i-- {
+		comparisons = append(comparisons, s.records[i])
+	}
+	tallies := make([]ModelTally, 0, len(s.tallies))
+	for _, tally := range s.tallies {
+		tallies = append(tallies, *tally)
+	}
+	sort.Slice(tallies, func(i, j int) bool {
+		return tallies[i].ModelA+"|"+tallies[i].ModelB < tallies[j].ModelA+"|"+tallies[j].ModelB
+	})
+	return comparisons, tallies
+}
+
+// Whether messages are generated by both LLM_MODEL and LLM_MODEL_B
+func (agent *WeatherAgent) abTesting() bool {
+	return agent.config.LLMModelB != "" && agent.llmConfigured()
+}
+
+// In A/B mode, have LLM_MODEL_B write a message from the same weather and
+// context as messageA and store the pair. The B message generates in the
+// background, so the request serving messageA doesn't wait for it, and later
+// requests for the weather serve the comparison. Requests overriding the
+// sampling settings aren't compared.
+func (agent *WeatherAgent) compareModels(weather WeatherResponse, historyContext, persona string, params llmParams, messageA string) {
+	if !agent.abTesting() || !params.equal(agent.llmParams()) {
+		return
+	}
+	fingerprint := agent.messageFingerprint(weather)
+	key := fingerprint + "|" + persona
+	if !agent.comparisons.begin(key) {
+		return
+	}
+	paramsB := params
+	paramsB.Model = agent.config.LLMModelB
+
+	go func() {
+		defer agent.comparisons.finish(key)
+		// No fallback to the last or a template message, which would make a poor comparison
+		messageB, err := agent.cachedOrNewLLMMessage(weather, historyContext, persona, paramsB)
+		if err != nil {
+			agent.logger.Printf("Error generating A/B message with %s: %v", paramsB.Model, err)
+			return
+		}
+		agent.comparisons.add(ModelComparison{
+			City:        weather.Name,
+			Persona:     persona,
+			Fingerprint: fingerprint,
+			ModelA:      params.Model,
+			ModelB:      paramsB.Model,
+			MessageA:    messageA,
+			MessageB:    messageB,
+		})
+	}()
+}
+
+// The variant to serve: the requested one if given, otherwise one picked
+// from the client and comparison so a client sees the same variant each time
+func abVariant(requested, client, comparisonID string) (string, error) {
+	switch requested {
+	case VariantA, VariantB:
+		return requested, nil
+	case "":
+	default:
+		return "", fmt.Errorf("variant must be %q or %q", VariantA, VariantB)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(client + "|" + comparisonID))
+	if h.Sum32()%2 == 0 {
+		return VariantA, nil
+	}
+	return VariantB, nil
+}
+
+// GET /api/comparisons[?limit=20] lists recent comparisons and the votes per
+// model pair
+func (agent *WeatherAgent) handleComparisons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxModelComparisons {
+			apiError(w, fmt.Sprintf("limit must be 1-%d", maxModelComparisons), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	comparisons, tallies := agent.comparisons.list(limit)
+	writeJSON(w, http.StatusOK, ComparisonsResponse{
+		Enabled:     agent.abTesting(),
+		Comparisons: comparisons,
+		Tallies:     tallies,
+	})
+}
+
+// GET /api/comparisons/{id} returns both messages of a comparison
+func (agent *WeatherAgent) handleComparison(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	comparison, ok := agent.comparisons.get(r.PathValue("id"))
+	if !ok {
+		apiError(w, "Comparison not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+// POST /api/comparisons/{id}/preference with {"preferred": "a"} records which
+// message a user preferred
+func (agent *WeatherAgent) handleComparisonPreference(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req PreferenceRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+		apiError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	comparison, err := agent.comparisons.vote(r.PathValue("id"), req.Preferred, clientIP(r, agent.config.proxyHops()))
+	switch {
+	case errors.Is(err, errComparisonNotFound):
+		apiError(w, "Comparison not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errAlreadyVoted):
+		apiError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, comparison)
+}
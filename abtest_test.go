@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompareModels(t *testing.T) {
+	llm := &fakeLLM{reply: "Sunny and 21°C in Austin."}
+	agent := newFixtureAgent(t, Config{LLMModel: "model-a", LLMModelB: "model-b", LLMCacheMinutes: 30})
+	agent.llm = llm
+	agent.comparisons = newComparisonStore()
+	weather := statusWeather("Clear", 1, 21)
+
+	agent.compareModels(weather, "", "", agent.llmParams(), "Warm and bright.")
+	agent.comparisons.pending.Wait()
+	if llm.params.Model != "model-b" {
+		t.Errorf("B message generated with %q, want model-b", llm.params.Model)
+	}
+	agent.compareModels(weather, "", "", agent.llmParams(), "Warm and bright.")
+	agent.comparisons.pending.Wait()
+	if len(llm.prompts) != 1 {
+		t.Errorf("%d LLM calls, want the B message reused from the cache", len(llm.prompts))
+	}
+
+	fingerprint := agent.messageFingerprint(weather)
+	comparison, ok := agent.comparisons.find(fingerprint, "")
+	if !ok {
+		t.Fatal("no comparison stored")
+	}
+	if comparisons, _ := agent.comparisons.list(10); len(comparisons) != 1 {
+		t.Errorf("%d comparisons stored, want repeats stored once", len(comparisons))
+	}
+	if message, model := comparison.variant(VariantB); message != llm.reply || model != "model-b" {
+		t.Errorf("variant b = %q from %q", message, model)
+	}
+
+	overridden := agent.llmParams()
+	overridden.MaxTokens = 100
+	agent.compareModels(weather, "", "pirate", overridden, "Arr, sunny.")
+	agent.comparisons.pending.Wait()
+	if _, ok := agent.comparisons.find(fingerprint, "pirate"); ok {
+		t.Error("compared a request with overridden sampling settings")
+	}
+}
+
+func TestComparisonPreference(t *testing.T) {
+	agent := newFixtureAgent(t, Config{LLMAPIKey: "key", LLMModelB: "model-b"})
+	agent.comparisons = newComparisonStore()
+	comparison := agent.comparisons.add(ModelComparison{Fingerprint: "f", ModelA: "model-a", ModelB: "model-b", MessageA: "A", MessageB: "B"})
+
+	prefer := func(id, body, client string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/comparisons/"+id+"/preference", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		req.RemoteAddr = client + ":1234"
+		rec := httptest.NewRecorder()
+		agent.handleComparisonPreference(rec, req)
+		return rec.Code
+	}
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		client string
+		want   int
+	}{
+		{"vote for b", comparison.ID, `{"preferred":"b"}`, "192.0.2.1", http.StatusOK},
+		{"second vote from the same client", comparison.ID, `{"preferred":"a"}`, "192.0.2.1", http.StatusConflict},
+		{"vote for a", comparison.ID, `{"preferred":"a"}`, "192.0.2.2", http.StatusOK},
+		{"another vote for b", comparison.ID, `{"preferred":"b"}`, "192.0.2.3", http.StatusOK},
+		{"unknown variant", comparison.ID, `{"preferred":"c"}`, "192.0.2.4", http.StatusBadRequest},
+		{"unknown comparison", "missing", `{"preferred":"a"}`, "192.0.2.4", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := prefer(tt.id, tt.body, tt.client); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	_, tallies := agent.comparisons.list(10)
+	if len(tallies) != 1 || tallies[0].VotesA != 1 || tallies[0].VotesB != 2 {
+		t.Errorf("tallies = %+v, want 1 vote for a and 2 for b", tallies)
+	}
+}
+
+func TestABVariant(t *testing.T) {
+	if v, err := abVariant("b", "192.0.2.1", "c1"); v != VariantB || err != nil {
+		t.Errorf("abVariant(b) = %q, %v", v, err)
+	}
+	if _, err := abVariant("x", "192.0.2.1", "c1"); err == nil {
+		t.Error("abVariant(x) accepted an unknown variant")
+	}
+	first, _ := abVariant("", "192.0.2.1", "c1")
+	if again, _ := abVariant("", "192.0.2.1", "c1"); again != first {
+		t.Errorf("client got %q then %q for the same comparison", first, again)
+	}
+	seen := map[string]bool{}
+	for _, client := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6"} {
+		v, _ := abVariant("", client, "c1")
+		seen[v] = true
+	}
+	if !seen[VariantA] || !seen[VariantB] {
+		t.Errorf("variants served across clients = %v, want both", seen)
+	}
+}
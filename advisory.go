@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Measures a temperature advisory can be judged on
+const (
+	measureTemperature = "temperature"
+	measureFeelsLike   = "feels_like"
+	measureHeatIndex   = "heat_index"
+	measureHumidex     = "humidex"
+	measureWindChill   = "wind_chill"
+)
+
+// A weather service's heat and cold thresholds, in °C (humidex is on the
+// Celsius scale)
+type advisoryStandard struct {
+	Name         string
+	HeatMeasure  string
+	HeatAdvisory float64
+	HeatWarning  float64
+	ColdMeasure  string
+	ColdAdvisory float64 // At or below
+	ColdWarning  float64
+}
+
+// Thresholds by country code. They are simplified from services that vary
+// them by region and season, and can be overridden with ADVISORY_THRESHOLDS.
+var advisoryStandards = map[string]advisoryStandard{
+	// Heat advisory at a heat index of 105°F, excessive heat warning at 110°F;
+	// wind chill advisory at -20°F, warning at -35°F
+	"US": {"US National Weather Service", measureHeatIndex, 40.6, 43.3, measureWindChill, -28.9, -37.2},
+	"CA": {"Environment and Climate Change Canada", measureHumidex, 38, 40, measureWindChill, -30, -40},
+	"GB": {"UK Health Security Agency", measureTemperature, 27, 30, measureTemperature, -5, -10},
+	"AU": {"Bureau of Meteorology", measureTemperature, 35, 40, measureWindChill, -10, -20},
+	"DE": {"Deutscher Wetterdienst", measureFeelsLike, 32, 38, measureTemperature, -10, -20},
+	"FR": {"Météo-France", measureTemperature, 33, 36, measureWindChill, -10, -18},
+	"IN": {"India Meteorological Department", measureTemperature, 40, 45, measureTemperature, 4, 2},
+}
+
+// For other countries: the NWS heat index "extreme caution" and "danger"
+// bands, and wind chills giving frostbite in 30 and 10 minutes
+var defaultAdvisoryStandard = advisoryStandard{"", measureHeatIndex, 32, 39, measureWindChill, -27, -40}
+
+// Settings in ADVISORY_THRESHOLDS, which override the country's
+var advisoryThresholdKeys = []string{"heat_advisory", "heat_warning", "cold_advisory", "cold_warning"}
+
+// A heat or cold advisory worked out from local thresholds, so the LLM
+// reports the severity rather than guessing it
+type TemperatureAdvisory struct {
+	Type      string  `json:"type"`     // "heat" or "cold"
+	Severity  string  `json:"severity"` // "advisory" or "warning"
+	Measure   string  `json:"measure"`  // temperature, feels_like, heat_index, humidex or wind_chill
+	Value     float64 `json:"value"`    // In the configured units; humidex is unitless
+	Threshold float64 `json:"threshold"`
+	Standard  string  `json:"standard,omitempty"` // Whose thresholds, empty for the defaults
+}
+
+// Rendered for the LLM prompt
+func (a TemperatureAdvisory) String() string {
+	s := fmt.Sprintf("%s %s: %s %.1f reaches the %s threshold of %.1f", a.Type, a.Severity, a.Measure, a.Value, a.Severity, a.Threshold)
+	if a.Standard != "" {
+		s += " (" + a.Standard + ")"
+	}
+	return s
+}
+
+// Parse ADVISORY_THRESHOLDS, e.g. "heat_advisory=35,cold_warning=-30", with
+// temperatures in the system's units. The result is in °C.
+func parseAdvisoryThresholds(items []string, system units.System) (map[string]float64, error) {
+	thresholds := make(map[string]float64)
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		known := false
+		for _, k := range advisoryThresholdKeys {
+			known = known || k == key
+		}
+		if !ok || !known {
+			return nil, fmt.Errorf("%q is not one of %s=<temperature>", item, strings.Join(advisoryThresholdKeys, ", "))
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid temperature", item)
+		}
+		thresholds[key] = units.TemperatureIn(t, system).Celsius()
+	}
+	advisory, hasAdvisory := thresholds["heat_advisory"]
+	if warning, ok := thresholds["heat_warning"]; ok && hasAdvisory && warning < advisory {
+		return nil, fmt.Errorf("heat_warning is below heat_advisory")
+	}
+	advisory, hasAdvisory = thresholds["cold_advisory"]
+	if warning, ok := thresholds["cold_warning"]; ok && hasAdvisory && warning > advisory {
+		return nil, fmt.Errorf("cold_warning is above cold_advisory")
+	}
+	return thresholds, nil
+}
+
+// Thresholds for a country, with any configured overrides applied
+func (agent *WeatherAgent) advisoryStandard(country string) advisoryStandard {
+	standard, ok := advisoryStandards[strings.ToUpper(country)]
+	if !ok {
+		standard = defaultAdvisoryStandard
+	}
+	for key, value := range agent.advisoryThresholds {
+		switch key {
+		case "heat_advisory":
+			standard.HeatAdvisory = value
+		case "heat_warning":
+			standard.HeatWarning = value
+		case "cold_advisory":
+			standard.ColdAdvisory = value
+		case "cold_warning":
+			standard.ColdWarning = value
+		}
+	}
+	return standard
+}
+
+// A measure's value, and the measure actually used: heat index, humidex and
+// wind chill fall back to the air temperature outside the conditions their
+// formulas cover
+func advisoryMeasure(measure string, weather WeatherResponse, system units.System) (units.Temperature, string) {
+	temp := units.TemperatureIn(weather.Main.Temp, system)
+	humidity := float64(weather.Main.Humidity)
+	var value units.Temperature
+	ok := false
+	switch measure {
+	case measureFeelsLike:
+		value, ok = units.TemperatureIn(weather.Main.FeelsLike, system), true
+	case measureHeatIndex:
+		value, ok = units.HeatIndex(temp, humidity)
+	case measureHumidex:
+		value, ok = units.Humidex(temp, units.DewPoint(temp, humidity))
+	case measureWindChill:
+		value, ok = units.WindChill(temp, units.SpeedIn(weather.Wind.Speed, system))
+	}
+	if !ok {
+		return temp, measureTemperature
+	}
+	return value, measure
+}
+
+// Heat or cold advisory for the conditions, if any applies
+func (agent *WeatherAgent) temperatureAdvisory(weather WeatherResponse) (TemperatureAdvisory, bool) {
+	standard := agent.advisoryStandard(weather.Sys.Country)
+	system := agent.weatherUnits(weather)
+	display := func(t units.Temperature, measure string) float64 {
+		if measure == measureHumidex {
+			return round1(t.Celsius())
+		}
+		return round1(t.In(system))
+	}
+
+	heat, measure := advisoryMeasure(standard.HeatMeasure, weather, system)
+	if heat.Celsius() >= standard.HeatAdvisory {
+		advisory := TemperatureAdvisory{Type: "heat", Severity: SeverityAdvisory, Measure: measure,
+			Value: display(heat, measure), Threshold: display(units.Celsius(standard.HeatAdvisory), measure), Standard: standard.Name}
+		if heat.Celsius() >= standard.HeatWarning {
+			advisory.Severity = SeverityWarning
+			advisory.Threshold = display(units.Celsius(standard.HeatWarning), measure)
+		}
+		return advisory, true
+	}
+
+	cold, measure := advisoryMeasure(standard.ColdMeasure, weather, system)
+	if cold.Celsius() <= standard.ColdAdvisory {
+		advisory := TemperatureAdvisory{Type: "cold", Severity: SeverityAdvisory, Measure: measure,
+			Value: display(cold, measure), Threshold: display(units.Celsius(standard.ColdAdvisory), measure), Standard: standard.Name}
+		if cold.Celsius() <= standard.ColdWarning {
+			advisory.Severity = SeverityWarning
+			advisory.Threshold = display(units.Celsius(standard.ColdWarning), measure)
+		}
+		return advisory, true
+	}
+	return TemperatureAdvisory{}, false
+}
+
+// Add any heat or cold advisory to the weather data
+func (agent *WeatherAgent) addTemperatureAdvisory(weather WeatherResponse, data map[string]interface{}) {
+	if advisory, ok := agent.temperatureAdvisory(weather); ok {
+		data["temperature_advisory"] = advisory
+	}
+}
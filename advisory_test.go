@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+func TestParseAdvisoryThresholds(t *testing.T) {
+	got, err := parseAdvisoryThresholds([]string{"heat_warning=104", " cold_advisory = -4"}, units.Imperial)
+	if err != nil || math.Abs(got["heat_warning"]-40) > 0.01 || math.Abs(got["cold_advisory"]+20) > 0.01 || len(got) != 2 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	for _, items := range [][]string{
+		{"heat=30"},
+		{"heat_warning"},
+		{"heat_warning=hot"},
+		{"heat_advisory=35", "heat_warning=30"},
+		{"cold_advisory=-30", "cold_warning=-20"},
+	} {
+		if _, err := parseAdvisoryThresholds(items, units.Metric); err == nil {
+			t.Errorf("%v: expected an error", items)
+		}
+	}
+}
+
+func TestTemperatureAdvisory(t *testing.T) {
+	tests := []struct {
+		name       string
+		units      string
+		country    string
+		thresholds map[string]float64
+		temp       float64
+		feelsLike  float64
+		humidity   int
+		wind       float64
+		want       string // Type and severity, empty for none
+		measure    string
+		standard   string
+	}{
+		{"mild", "metric", "NO", nil, 18, 18, 60, 10, "", "", ""},
+		{"US heat index advisory", "imperial", "US", nil, 94, 94, 55, 5, "heat advisory", measureHeatIndex, "US National Weather Service"},
+		{"US heat index warning", "imperial", "US", nil, 102, 102, 55, 5, "heat warning", measureHeatIndex, "US National Weather Service"},
+		{"Canadian humidex", "metric", "CA", nil, 32, 32, 60, 5, "heat warning", measureHumidex, "Environment and Climate Change Canada"},
+		{"UK hot day", "metric", "GB", nil, 28, 28, 30, 5, "heat advisory", measureTemperature, "UK Health Security Agency"},
+		{"same heat elsewhere", "metric", "NO", nil, 28, 28, 30, 5, "", "", ""},
+		{"German feels-like", "metric", "DE", nil, 30, 33, 40, 5, "heat advisory", measureFeelsLike, "Deutscher Wetterdienst"},
+		{"US wind chill advisory", "imperial", "US", nil, -5, -5, 70, 20, "cold advisory", measureWindChill, "US National Weather Service"},
+		{"US still cold air", "imperial", "US", nil, -5, -5, 70, 2, "", "", ""},
+		{"default wind chill warning", "metric", "NO", nil, -25, -25, 70, 40, "cold warning", measureWindChill, ""},
+		{"override", "metric", "NO", map[string]float64{"heat_advisory": 25}, 26, 26, 30, 5, "heat advisory", measureTemperature, ""},
+	}
+	for _, tt := range tests {
+		agent := newFixtureAgent(t, Config{Units: tt.units})
+		agent.advisoryThresholds = tt.thresholds
+		weather := WeatherResponse{}
+		weather.Sys.Country = tt.country
+		weather.Main.Temp, weather.Main.FeelsLike, weather.Main.Humidity = tt.temp, tt.feelsLike, tt.humidity
+		weather.Wind.Speed = tt.wind
+
+		data := map[string]interface{}{}
+		agent.addTemperatureAdvisory(weather, data)
+		advisory, ok := data["temperature_advisory"].(TemperatureAdvisory)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s: unexpected %+v", tt.name, advisory)
+			}
+			continue
+		}
+		if !ok || advisory.Type+" "+advisory.Severity != tt.want || advisory.Measure != tt.measure || advisory.Standard != tt.standard {
+			t.Errorf("%s: got %+v", tt.name, advisory)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Groups more sensitive to air pollution than the general public
+const (
+	SensitivityAsthma   = "asthma"   // Asthma and other lung disease
+	SensitivityChildren = "children" // Children, who breathe more air for their size
+	SensitivityAthletes = "athletes" // People exercising hard outdoors
+)
+
+var sensitivities = []string{SensitivityAsthma, SensitivityChildren, SensitivityAthletes}
+
+// Health levels of the US EPA scale, which OpenWeatherMap's 1-5 index is
+// mapped onto
+var airQualityLevels = []string{"good", "moderate", "unhealthy_for_sensitive_groups", "unhealthy", "very_unhealthy", "hazardous"}
+
+// Outdoor exercise advice, from least to most restrictive
+var exerciseAdvice = []string{"normal", "reduce", "avoid"}
+
+// Mask advice, from least to most protective
+var maskAdvice = []string{"none", "consider", "recommended"}
+
+// Recommendations for the air quality and who is asking, worked out from
+// the AQI rather than left to the LLM so the advice is the same every time
+type AirQualityGuidance struct {
+	AQI             int      `json:"aqi"`
+	Scale           string   `json:"scale"` // "us" (0-500, IQAir) or "owm" (1-5, OpenWeatherMap)
+	Level           string   `json:"level"`
+	Sensitivities   []string `json:"sensitivities"`
+	OutdoorExercise string   `json:"outdoor_exercise"` // "normal", "reduce" or "avoid"
+	Mask            string   `json:"mask"`             // "none", "consider" or "recommended" (N95 or FFP2)
+	CloseWindows    bool     `json:"close_windows"`
+	Recommendations []string `json:"recommendations"`
+}
+
+// Rendered for the LLM prompt
+func (g AirQualityGuidance) String() string {
+	who := "the general public"
+	if len(g.Sensitivities) > 0 {
+		who = strings.Join(g.Sensitivities, ", ")
+	}
+	return fmt.Sprintf("level %s for %s; outdoor exercise: %s; mask: %s; close windows: %t. %s",
+		g.Level, who, g.OutdoorExercise, g.Mask, g.CloseWindows, strings.Join(g.Recommendations, " "))
+}
+
+// Check and normalize a list of sensitivities, dropping duplicates
+func parseSensitivities(values []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		known := false
+		for _, s := range sensitivities {
+			known = known || s == value
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown sensitivity %q (available: %s)", value, strings.Join(sensitivities, ", "))
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Index into airQualityLevels for an AQI on the given scale
+func airQualityLevel(aqi int, scale string) int {
+	if scale == "owm" {
+		if aqi < 1 {
+			return 0
+		}
+		return min(aqi-1, 4)
+	}
+	switch {
+	case aqi <= 50:
+		return 0
+	case aqi <= 100:
+		return 1
+	case aqi <= 150:
+		return 2
+	case aqi <= 200:
+		return 3
+	case aqi <= 300:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// Guidance for an AQI. Sensitive groups get the advice the general public
+// would get one level worse, following the EPA's activity guidance.
+func newAirQualityGuidance(aqi int, scale string, groups []string) AirQualityGuidance {
+	level := airQualityLevel(aqi, scale)
+	g := AirQualityGuidance{AQI: aqi, Scale: scale, Level: airQualityLevels[level], Sensitivities: append([]string{}, groups...)}
+
+	has := func(group string) bool {
+		for _, other := range groups {
+			if other == group {
+				return true
+			}
+		}
+		return false
+	}
+	effective := level
+	if len(groups) > 0 {
+		effective++
+	}
+
+	exercise, mask := 0, 0
+	switch {
+	case effective >= 4:
+		exercise, mask = 2, 2
+	case effective == 3:
+		exercise, mask = 1, 1
+	case level == 1 && has(SensitivityAsthma):
+		// Unusually sensitive people are the only ones moderate air affects
+		exercise = 1
+	}
+	g.OutdoorExercise, g.Mask = exerciseAdvice[exercise], maskAdvice[mask]
+	g.CloseWindows = effective >= 3
+
+	add := func(s string) { g.Recommendations = append(g.Recommendations, s) }
+	switch {
+	case level == 0:
+		add("Air quality is good; no precautions are needed.")
+	case exercise == 0:
+		add("Air quality is acceptable for normal outdoor activity.")
+	case exercise == 1:
+		add("Reduce prolonged or heavy exertion outdoors and take more breaks.")
+	case level >= 5:
+		add("Avoid all physical activity outdoors and stay indoors as much as possible.")
+	default:
+		add("Avoid prolonged or heavy exertion outdoors; move exercise indoors.")
+	}
+	if mask == 1 {
+		add("Consider a well-fitted N95 or FFP2 mask for time outdoors.")
+	} else if mask == 2 {
+		add("Wear a well-fitted N95 or FFP2 mask if you must go outdoors.")
+	}
+	if g.CloseWindows {
+		add("Keep windows closed and run an air purifier if you have one.")
+	}
+	if level > 0 {
+		if has(SensitivityAsthma) {
+			add("Keep your reliever inhaler with you and follow your asthma action plan.")
+		}
+		if has(SensitivityChildren) && exercise > 0 {
+			add("Keep children's outdoor play shorter and less intense.")
+		}
+		if has(SensitivityAthletes) && exercise > 0 {
+			add("Swap hard training sessions for easy ones, or train indoors.")
+		}
+	}
+	return g
+}
+
+// Add air quality guidance for the configured sensitivities
+func (agent *WeatherAgent) addAirQualityGuidance(weather WeatherResponse, data map[string]interface{}) {
+	if weather.IQAirData.AQI > 0 {
+		data["air_quality_guidance"] = newAirQualityGuidance(weather.IQAirData.AQI, "us", agent.config.HealthSensitivities)
+	} else if len(weather.AQI.List) > 0 {
+		data["air_quality_guidance"] = newAirQualityGuidance(weather.AQI.List[0].Main.AQI, "owm", agent.config.HealthSensitivities)
+	}
+}
+
+// Sensitivities for a request: ?sensitivity= if given (comma-separated, or
+// "none"), then the profile's, then the deployment's
+func (agent *WeatherAgent) requestSensitivities(r *http.Request) ([]string, error) {
+	if value, ok := r.URL.Query()["sensitivity"]; ok {
+		if strings.EqualFold(strings.Join(value, ""), "none") {
+			return nil, nil
+		}
+		return parseSensitivities(strings.Split(strings.Join(value, ","), ","))
+	}
+	if profile, ok := agent.requestProfile(r); ok && len(profile.Sensitivities) > 0 {
+		return profile.Sensitivities, nil
+	}
+	return agent.config.HealthSensitivities, nil
+}
+
+// Redo the weather data's air quality guidance for other sensitivities
+func personalizeAirQualityGuidance(data map[string]interface{}, groups []string) {
+	if guidance, ok := data["air_quality_guidance"].(AirQualityGuidance); ok {
+		data["air_quality_guidance"] = newAirQualityGuidance(guidance.AQI, guidance.Scale, groups)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewAirQualityGuidance(t *testing.T) {
+	tests := []struct {
+		aqi          int
+		scale        string
+		groups       []string
+		level        string
+		exercise     string
+		mask         string
+		closeWindows bool
+		mentions     string
+	}{
+		{42, "us", nil, "good", "normal", "none", false, "no precautions"},
+		{42, "us", []string{"asthma"}, "good", "normal", "none", false, "no precautions"},
+		{75, "us", nil, "moderate", "normal", "none", false, "acceptable"},
+		{75, "us", []string{"asthma"}, "moderate", "reduce", "none", false, "inhaler"},
+		{75, "us", []string{"athletes"}, "moderate", "normal", "none", false, "acceptable"},
+		{101, "us", nil, "unhealthy_for_sensitive_groups", "normal", "none", false, "acceptable"},
+		{150, "us", []string{"children"}, "unhealthy_for_sensitive_groups", "reduce", "consider", true, "children's outdoor play"},
+		{151, "us", nil, "unhealthy", "reduce", "consider", true, "Reduce prolonged"},
+		{151, "us", []string{"athletes"}, "unhealthy", "avoid", "recommended", true, "Swap hard training"},
+		{250, "us", nil, "very_unhealthy", "avoid", "recommended", true, "move exercise indoors"},
+		{301, "us", nil, "hazardous", "avoid", "recommended", true, "stay indoors"},
+		{1, "owm", nil, "good", "normal", "none", false, "no precautions"},
+		{3, "owm", []string{"asthma"}, "unhealthy_for_sensitive_groups", "reduce", "consider", true, "inhaler"},
+		{5, "owm", nil, "very_unhealthy", "avoid", "recommended", true, "N95"},
+	}
+	for _, tt := range tests {
+		g := newAirQualityGuidance(tt.aqi, tt.scale, tt.groups)
+		if g.Level != tt.level || g.OutdoorExercise != tt.exercise || g.Mask != tt.mask || g.CloseWindows != tt.closeWindows {
+			t.Errorf("%s AQI %d for %v: got %+v", tt.scale, tt.aqi, tt.groups, g)
+		}
+		if !strings.Contains(strings.Join(g.Recommendations, " "), tt.mentions) {
+			t.Errorf("%s AQI %d for %v: recommendations %q don't mention %q", tt.scale, tt.aqi, tt.groups, g.Recommendations, tt.mentions)
+		}
+	}
+}
+
+func TestParseSensitivities(t *testing.T) {
+	got, err := parseSensitivities([]string{" Children", "asthma", "", "children"})
+	if err != nil || !reflect.DeepEqual(got, []string{"asthma", "children"}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := parseSensitivities([]string{"pets"}); err == nil {
+		t.Error("expected an error for an unknown sensitivity")
+	}
+}
+
+func TestRequestSensitivities(t *testing.T) {
+	agent := newFixtureAgent(t, Config{HealthSensitivities: []string{"athletes"}})
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"athletes"}, false},
+		{"?sensitivity=asthma,children", []string{"asthma", "children"}, false},
+		{"?sensitivity=none", nil, false},
+		{"?sensitivity=pets", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := agent.requestSensitivities(httptest.NewRequest(http.MethodGet, "/api/weather"+tt.query, nil))
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, %v", tt.query, got, err)
+		}
+	}
+}
+
+func TestAirQualityGuidanceInWeatherData(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key", HealthSensitivities: []string{"asthma"}})
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := agent.prepareWeatherData(weather)
+	guidance, ok := data["air_quality_guidance"].(AirQualityGuidance)
+	if !ok || guidance.AQI != 42 || guidance.Scale != "us" || !reflect.DeepEqual(guidance.Sensitivities, []string{"asthma"}) {
+		t.Fatalf("air_quality_guidance = %#v", data["air_quality_guidance"])
+	}
+
+	personalizeAirQualityGuidance(data, nil)
+	if guidance := data["air_quality_guidance"].(AirQualityGuidance); len(guidance.Sensitivities) != 0 || guidance.AQI != 42 {
+		t.Errorf("personalized guidance = %+v", guidance)
+	}
+}
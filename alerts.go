@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comparison operators supported in alert rules, longest first for parsing
+var ruleOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// A threshold condition such as "temp < -10"
+type AlertRule struct {
+	Expr      string // Original expression
+	Field     string
+	Operator  string
+	Threshold float64
+}
+
+// Parse a single rule expression
+func parseAlertRule(expr string) (AlertRule, error) {
+	expr = strings.TrimSpace(expr)
+	for _, op := range ruleOperators {
+		idx := strings.Index(expr, op)
+		if idx < 0 {
+			continue
+		}
+
+		field := strings.ToLower(strings.TrimSpace(expr[:idx]))
+		valueStr := strings.TrimSpace(expr[idx+len(op):])
+		if field == "" || valueStr == "" {
+			return AlertRule{}, fmt.Errorf("invalid alert rule %q", expr)
+		}
+		if !isRuleField(field) {
+			return AlertRule{}, fmt.Errorf("unknown field %q in alert rule %q", field, expr)
+		}
+
+		threshold, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			return AlertRule{}, fmt.Errorf("invalid threshold %q in alert rule %q", valueStr, expr)
+		}
+
+		return AlertRule{Expr: expr, Field: field, Operator: op, Threshold: threshold}, nil
+	}
+	return AlertRule{}, fmt.Errorf("alert rule %q has no comparison operator", expr)
+}
+
+// Parse a list of rule expressions, returning all parse errors together
+func parseAlertRules(exprs []string) ([]AlertRule, error) {
+	var rules []AlertRule
+	var errs []string
+	for _, expr := range exprs {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		rule, err := parseAlertRule(expr)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return rules, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return rules, nil
+}
+
+// Configured rule expressions plus the high-wind rule WIND_GUST_ALERT stands for
+func alertRuleExprs(config Config) []string {
+	exprs := append([]string(nil), config.AlertRules...)
+	if config.WindGustAlert > 0 {
+		exprs = append(exprs, fmt.Sprintf("wind_gust >= %g", config.WindGustAlert))
+	}
+	return exprs
+}
+
+// Whether the rule matches the given value
+func (r AlertRule) matches(value float64) bool {
+	switch r.Operator {
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
+
+// Fields that can be used in alert rules, in the configured units
+var ruleFields = map[string]func(WeatherResponse) (float64, bool){
+	"temp":       func(w WeatherResponse) (float64, bool) { return w.Main.Temp, true },
+	"feels_like": func(w WeatherResponse) (float64, bool) { return w.Main.FeelsLike, true },
+	"humidity":   func(w WeatherResponse) (float64, bool) { return float64(w.Main.Humidity), true },
+	"wind_speed": func(w WeatherResponse) (float64, bool) { return w.Wind.Speed, true },
+	"wind_gust":  func(w WeatherResponse) (float64, bool) { return w.Wind.Gust, true },
+	"cloud_cover": func(w WeatherResponse) (float64, bool) {
+		return float64(w.Clouds.All), true
+	},
+	"uv_index": func(w WeatherResponse) (float64, bool) { return w.UVIndex, true },
+	"rain_1h":  func(w WeatherResponse) (float64, bool) { return w.Rain.OneHour, true },
+	"snow_1h":  func(w WeatherResponse) (float64, bool) { return w.Snow.OneHour, true },
+	"aqi": func(w WeatherResponse) (float64, bool) {
+		// US AQI from IQAir; the OpenWeatherMap 1-5 scale isn't comparable
+		if w.IQAirData.AQI > 0 {
+			return float64(w.IQAirData.AQI), true
+		}
+		return 0, false
+	},
+}
+
+func isRuleField(field string) bool {
+	_, ok := ruleFields[field]
+	return ok
+}
+
+// Names of all supported rule fields, for error messages and docs
+func ruleFieldNames() []string {
+	names := make([]string, 0, len(ruleFields))
+	for name := range ruleFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A rule that matched the current conditions
+type firedRule struct {
+	Rule  AlertRule
+	Value float64
+}
+
+// Evaluate rules against the weather, returning those that match
+func evaluateAlertRules(rules []AlertRule, weather WeatherResponse) []firedRule {
+	var fired []firedRule
+	for _, rule := range rules {
+		value, ok := ruleFields[rule.Field](weather)
+		if ok && rule.matches(value) {
+			fired = append(fired, firedRule{Rule: rule, Value: value})
+		}
+	}
+	return fired
+}
+
+// Per-rule cooldown tracking so a persistent condition doesn't spam notifiers
+type alertCooldowns struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// Whether an alert for key may be sent at now; records the send if so
+func (c *alertCooldowns) allow(key string, cooldown time.Duration, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastSent == nil {
+		c.lastSent = make(map[string]time.Time)
+	}
+	if last, ok := c.lastSent[key]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	c.lastSent[key] = now
+	return true
+}
+
+// Evaluate the configured rules against the weather at a location (nil for the
+// configured one) and dispatch an LLM-written alert for each that fires
+func (agent *WeatherAgent) checkAlertRules(weather WeatherResponse, loc *ProfileLocation) {
+	fired := evaluateAlertRules(agent.alertRules, weather)
+	if len(fired) == 0 {
+		return
+	}
+
+	cooldown := time.Duration(agent.config.AlertCooldownMinutes) * time.Minute
+	weatherData := agent.prepareWeatherData(weather)
+
+	for _, f := range fired {
+		key := weather.Name + "|" + f.Rule.Expr
+		if loc != nil {
+			key = loc.key() + "|" + f.Rule.Expr
+		}
+		if !agent.alertCooldown.allow(key, cooldown, time.Now()) {
+			agent.logger.Printf("Alert rule %q fired but is cooling down", f.Rule.Expr)
+			continue
+		}
+
+		agent.logger.Printf("Alert rule %q fired (current value %.1f)", f.Rule.Expr, f.Value)
+
+		message, err := agent.generateAlertMessage(weatherData, f)
+		if err != nil {
+			agent.logger.Printf("Error generating alert message: %v", err)
+			message = fmt.Sprintf("Weather alert for %s: %s (current value %.1f).", weather.Name, f.Rule.Expr, f.Value)
+		}
+
+		agent.notify(Notification{
+			Type:      NotificationAlert,
+			AlertType: "rule",
+			Title:     fmt.Sprintf("Weather alert for %s: %s", weather.Name, f.Rule.Expr),
+			Message:   message,
+			City:      weather.Name,
+			Country:   weather.Sys.Country,
+			Location:  subscriberLocationKey(loc),
+			Units:     agent.config.Units,
+			Data:      weatherData,
+		})
+	}
+}
+
+// Ask the LLM for a short, targeted alert explaining the triggered condition
+func (agent *WeatherAgent) generateAlertMessage(weatherData map[string]interface{}, f firedRule) (string, error) {
+	keys := make([]string, 0, len(weatherData))
+	for key := range weatherData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var prompt strings.Builder
+	prompt.WriteString("Current Weather Data:\n")
+	for _, key := range keys {
+		prompt.WriteString(fmt.Sprintf("%s: %v\n", key, weatherData[key]))
+	}
+	prompt.WriteString(fmt.Sprintf(`
+ALERT TRIGGERED: the user's rule "%s" matched (current %s is %.1f).
+
+Write a short weather alert (1-2 sentences) that explains the condition and gives concrete safety advice. Be direct and serious.`,
+		f.Rule.Expr, f.Rule.Field, f.Value))
+
+	return agent.callLLM(prompt.String())
+}
+
+// Whether the alert monitor has anything to watch: alert rules, DWD warnings
+// to pass on, or tropical cyclones or earthquakes with someone to be alerted.
+// Checked on every run, as the feature flags and subscriptions can change
+// while the agent runs.
+func (agent *WeatherAgent) alertMonitorNeeded(rules []AlertRule) bool {
+	if len(rules) > 0 || agent.config.DWDEnabled {
+		return true
+	}
+	return (agent.featureEnabled(FeatureCyclones) || agent.featureEnabled(FeatureEarthquakes)) &&
+		agent.hasRecipients(NotificationAlert)
+}
+
+// Poll the configured location and evaluate alert rules every check interval
+func (agent *WeatherAgent) runAlertMonitor() {
+	interval := time.Duration(agent.config.CheckInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		agent.checkAlerts()
+		time.Sleep(interval)
+	}
+}
+
+// One run of the alert monitor. Subscriber locations get rule alerts only;
+// the feeds behind the other alerts cover the configured location. Nothing
+// is fetched while there's nothing to watch.
+func (agent *WeatherAgent) checkAlerts() {
+	if !agent.featureEnabled(FeatureAlerts) || !agent.alertMonitorNeeded(agent.alertRules) {
+		return
+	}
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		agent.logger.Printf("Alert monitor: error fetching weather: %v", err)
+	} else {
+		agent.checkAlertRules(weather, nil)
+		agent.checkCycloneAlerts(weather)
+		agent.checkEarthquakeAlerts(weather)
+		agent.checkWarningAlerts(weather)
+	}
+	for _, loc := range agent.subscriptions.locations(NotificationAlert) {
+		loc := loc
+		weather, err := agent.weatherAt(&loc)
+		if err != nil {
+			agent.logger.Printf("Alert monitor: error fetching weather for %s: %v", loc.label(), err)
+			continue
+		}
+		agent.checkAlertRules(weather, &loc)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	tests := []struct {
+		expr      string
+		field     string
+		op        string
+		threshold float64
+		wantErr   bool
+	}{
+		{"temp < -10", "temp", "<", -10, false},
+		{"aqi>150", "aqi", ">", 150, false},
+		{" wind_gust >= 60 ", "wind_gust", ">=", 60, false},
+		{"humidity != 50", "humidity", "!=", 50, false},
+		{"pressure < 980", "", "", 0, true}, // unknown field
+		{"temp < cold", "", "", 0, true},    // bad threshold
+		{"temp", "", "", 0, true},           // no operator
+	}
+
+	for _, tt := range tests {
+		rule, err := parseAlertRule(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if rule.Field != tt.field || rule.Operator != tt.op || rule.Threshold != tt.threshold {
+			t.Errorf("%q: got %+v", tt.expr, rule)
+		}
+	}
+}
+
+func TestEvaluateAlertRules(t *testing.T) {
+	rules, err := parseAlertRules([]string{"temp < -10", "aqi > 150", "wind_gust > 60"})
+	if err != nil {
+		t.Fatalf("parseAlertRules failed: %v", err)
+	}
+
+	var weather WeatherResponse
+	weather.Main.Temp = -12
+	weather.Wind.Gust = 40
+	weather.IQAirData.AQI = 0 // No AQI data available
+
+	fired := evaluateAlertRules(rules, weather)
+	if len(fired) != 1 || fired[0].Rule.Field != "temp" || fired[0].Value != -12 {
+		t.Fatalf("expected only the temperature rule to fire, got %+v", fired)
+	}
+
+	weather.IQAirData.AQI = 180
+	if fired := evaluateAlertRules(rules, weather); len(fired) != 2 {
+		t.Fatalf("expected temperature and AQI rules to fire, got %+v", fired)
+	}
+}
+
+func TestAlertCooldowns(t *testing.T) {
+	var cooldowns alertCooldowns
+	now := time.Now()
+
+	if !cooldowns.allow("London|temp < -10", time.Hour, now) {
+		t.Fatal("first alert should be allowed")
+	}
+	if cooldowns.allow("London|temp < -10", time.Hour, now.Add(30*time.Minute)) {
+		t.Fatal("alert within cooldown should be suppressed")
+	}
+	if !cooldowns.allow("London|aqi > 150", time.Hour, now.Add(30*time.Minute)) {
+		t.Fatal("different rule should not share a cooldown")
+	}
+	if !cooldowns.allow("London|temp < -10", time.Hour, now.Add(61*time.Minute)) {
+		t.Fatal("alert after cooldown should be allowed")
+	}
+}
+
+func TestSplitRuleList(t *testing.T) {
+	rules := splitRuleList("temp < -10; aqi > 150\nwind_gust > 60;;")
+	if len(rules) != 3 || rules[2] != "wind_gust > 60" {
+		t.Fatalf("unexpected rules: %q", rules)
+	}
+}
+
+func TestAlertRuleExprs(t *testing.T) {
+	config := Config{AlertRules: []string{"temp < -10"}}
+	if exprs := alertRuleExprs(config); len(exprs) != 1 {
+		t.Errorf("without WIND_GUST_ALERT: %q", exprs)
+	}
+
+	config.WindGustAlert = 62.5
+	exprs := alertRuleExprs(config)
+	if len(exprs) != 2 || exprs[1] != "wind_gust >= 62.5" {
+		t.Fatalf("with WIND_GUST_ALERT: %q", exprs)
+	}
+	if len(config.AlertRules) != 1 {
+		t.Error("alertRuleExprs modified the configured rules")
+	}
+	if _, err := parseAlertRules(exprs); err != nil {
+		t.Errorf("generated rule does not parse: %v", err)
+	}
+}
+
+func TestAlertMonitorNeeded(t *testing.T) {
+	sent := 0
+	agent := &WeatherAgent{}
+	if !agent.alertMonitorNeeded([]AlertRule{{Expr: "temp < -10"}}) {
+		t.Error("not needed with a rule")
+	}
+	// Cyclone and earthquake alerts need someone to go to
+	if agent.alertMonitorNeeded(nil) {
+		t.Error("needed without rules or recipients")
+	}
+	agent.notifiers = []Notifier{countingNotifier{&sent}}
+	if !agent.alertMonitorNeeded(nil) {
+		t.Error("not needed for cyclone alerts")
+	}
+	agent.features, _ = newFeatureFlags([]string{"cyclones=off"})
+	if !agent.alertMonitorNeeded(nil) {
+		t.Error("not needed for earthquake alerts")
+	}
+	agent.features, _ = newFeatureFlags([]string{"cyclones=off", "earthquakes=off"})
+	if agent.alertMonitorNeeded(nil) {
+		t.Error("needed with cyclones and earthquakes off")
+	}
+}
+
+// The monitor always runs, and fetches the weather once a flag turned on at
+// runtime gives it something to watch
+func TestCheckAlertsFollowsFlags(t *testing.T) {
+	for _, flag := range []string{FeatureCyclones, FeatureEarthquakes} {
+		fixtures := useFixtures(t, defaultFixtures())
+		sent := 0
+		agent := newFixtureAgent(t, Config{})
+		agent.notifiers = []Notifier{countingNotifier{&sent}}
+
+		agent.checkAlerts()
+		if n := fixtures.count("api.open-meteo.com"); n != 0 {
+			t.Fatalf("%s: fetched the weather %d times with nothing to watch", flag, n)
+		}
+		agent.features.set(flag, true)
+		agent.checkAlerts()
+		if fixtures.count("api.open-meteo.com") == 0 {
+			t.Errorf("%s turned on at runtime wasn't watched", flag)
+		}
+	}
+}
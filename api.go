@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Prefix of the current version of the JSON API
+const apiPrefix = "/api/v1"
+
+// Machine-readable error codes, by HTTP status
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusRequestEntityTooLarge: "too_large",
+}
+
+// Write v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// Like http.Error, but answers with a JSON ErrorResponse
+func apiError(w http.ResponseWriter, message string, status int) {
+	code, ok := apiErrorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, ErrorResponse{Error: ErrorDetail{Code: code, Message: message}})
+}
+
+// Registers JSON API routes under /api/v1, and under /api for clients written
+// before the API was versioned
+type apiRouter struct {
+	mux  *http.ServeMux
+	cors CORSConfig
+}
+
+// Register handler for a pattern relative to the API prefix, e.g. "/weather"
+// or "/subscriptions/{id}"
+func (a apiRouter) HandleFunc(pattern string, handler http.HandlerFunc) {
+	a.mux.HandleFunc(apiPrefix+pattern, a.cors.middleware(handler))
+	a.mux.HandleFunc("/api"+pattern, a.cors.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiPrefix+strings.TrimPrefix(r.URL.Path, "/api")+`>; rel="successor-version"`)
+		handler(w, r)
+	}))
+}
+
+// Answer requests for unknown API paths with a JSON 404 rather than the UI
+func (a apiRouter) handleNotFound() {
+	a.mux.HandleFunc("/api/", a.cors.middleware(func(w http.ResponseWriter, r *http.Request) {
+		apiError(w, "No such API endpoint", http.StatusNotFound)
+	}))
+}
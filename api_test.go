@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusNotFound, "not_found"},
+		{http.StatusTooManyRequests, "rate_limited"},
+		{http.StatusBadGateway, "upstream_error"},
+		{http.StatusTeapot, "i'm_a_teapot"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		apiError(rec, "Something went wrong", tt.status)
+
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%d: %v", tt.status, err)
+		}
+		if rec.Code != tt.status || body.Error.Code != tt.code || body.Error.Message != "Something went wrong" {
+			t.Errorf("%d: got status %d and %+v, want code %q", tt.status, rec.Code, body.Error, tt.code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%d: Content-Type = %q", tt.status, ct)
+		}
+	}
+}
+
+func TestAPIRouter(t *testing.T) {
+	mux := http.NewServeMux()
+	api := apiRouter{mux: mux}
+	api.handleNotFound()
+	api.HandleFunc("/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"id": r.PathValue("id")})
+	})
+
+	tests := []struct {
+		path       string
+		status     int
+		deprecated bool
+	}{
+		{"/api/v1/subscriptions/abc", http.StatusOK, false},
+		{"/api/subscriptions/abc", http.StatusOK, true},
+		{"/api/v1/nothing", http.StatusNotFound, false},
+		{"/api/nothing", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status || !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%s: status %d, body %q", tt.path, rec.Code, rec.Body.String())
+		}
+		if deprecated := rec.Header().Get("Deprecation") != ""; deprecated != tt.deprecated {
+			t.Errorf("%s: deprecated = %v, want %v", tt.path, deprecated, tt.deprecated)
+		}
+		if tt.deprecated && !strings.Contains(rec.Header().Get("Link"), "</api/v1/subscriptions/abc>") {
+			t.Errorf("%s: Link = %q, want the versioned path", tt.path, rec.Header().Get("Link"))
+		}
+	}
+}
+
+// The versioned and legacy patterns of every route in main.go can share a mux
+func TestAPIRoutesDontConflict(t *testing.T) {
+	mux := http.NewServeMux()
+	api := apiRouter{mux: mux}
+	api.handleNotFound()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	for _, pattern := range registeredRoutes(t) {
+		if strings.HasPrefix(pattern, apiPrefix+"/") {
+			api.HandleFunc(strings.TrimPrefix(pattern, apiPrefix), noop)
+		} else {
+			mux.HandleFunc(pattern, noop)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import "time"
+
+// Request and response bodies of the JSON API, as described in openapi.json
+
+// Body of every API error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"` // e.g. "not_found", from the status
+	Message string `json:"message"`
+}
+
+// GET /api/weather: a generated message and the weather it was written from
+type WeatherUpdateResponse struct {
+	MessageID string                 `json:"message_id"`
+	City      string                 `json:"city"`
+	Country   string                 `json:"country"`
+	Message   string                 `json:"message"`
+	Persona   string                 `json:"persona"`
+	Timestamp string                 `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+	Severity  string                 `json:"severity"` // none, advisory, watch, warning or emergency
+
+	SeverityColor string `json:"severity_color"` // Hex color for the severity
+
+	// Set with a 202 while a new message generates; Message is then the
+	// location's last one. Poll /api/jobs/{id} for the update.
+	JobID string `json:"job_id,omitempty"`
+
+	// Set in A/B mode, for voting on the comparison
+	ComparisonID string `json:"comparison_id,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+// GET /api/conditions: the weather data without generating a message
+type ConditionsResponse struct {
+	City          string                 `json:"city"`
+	Country       string                 `json:"country"`
+	Timestamp     string                 `json:"timestamp"` // When the conditions were observed
+	Data          map[string]interface{} `json:"data"`
+	Severity      string                 `json:"severity"`
+	SeverityColor string                 `json:"severity_color"`
+
+	// The latest message generated for the location, if any
+	Message     string     `json:"message,omitempty"`
+	MessageTime *time.Time `json:"message_time,omitempty"`
+}
+
+// GET /api/personas
+type PersonasResponse struct {
+	Default  string    `json:"default"`
+	Personas []Persona `json:"personas"`
+}
+
+// POST /api/chat: a question, optionally with sampling overrides
+type ChatRequest struct {
+	Message string `json:"message"`
+	llmParamOverrides
+}
+
+// POST /api/chat
+type ChatResponse struct {
+	Reply string `json:"reply"`
+}
+
+// GET /api/deliveries
+type DeliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// GET /api/history
+type HistoryResponse struct {
+	Hours        int           `json:"hours"`
+	Units        string        `json:"units"`
+	Observations []Observation `json:"observations"`
+}
+
+// GET /api/reports: file names of the stored reports
+type ReportsResponse struct {
+	Reports []string `json:"reports"`
+}
+
+// GET /api/usage
+type UsageResponse struct {
+	Today  UsageTotals   `json:"today"`
+	Days   []UsageTotals `json:"days"` // Newest first
+	Budget UsageBudget   `json:"budget"`
+}
+
+// The configured daily LLM budget; zero limits are unlimited
+type UsageBudget struct {
+	DailyTokens  int     `json:"daily_tokens"`
+	DailyCostUSD float64 `json:"daily_cost_usd"`
+	Exceeded     bool    `json:"exceeded"`
+}
+
+// GET /api/radar/frames
+type RadarFramesResponse struct {
+	Provider string       `json:"provider"`
+	Frames   []RadarFrame `json:"frames"`
+}
+
+// PUT /api/profile: the token to send back and the saved profile
+type ProfileResponse struct {
+	Token   string  `json:"token"`
+	Profile Profile `json:"profile"`
+}
+
+// GET /api/subscriptions
+type SubscriptionsResponse struct {
+	Channels      []string       `json:"channels"` // Channels new subscriptions can use
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// POST /api/subscriptions
+type SubscriptionRequest struct {
+	Channel     string                   `json:"channel"`
+	Target      string                   `json:"target"`
+	Preferences *SubscriptionPreferences `json:"preferences"` // Digest and alerts if not given
+	Location    *ProfileLocation         `json:"location"`    // City or coordinates; the configured location if not given
+}
+
+// PATCH /api/subscriptions/{id}; fields not given are left as they are
+type SubscriptionUpdateRequest struct {
+	Preferences     *SubscriptionPreferences `json:"preferences"`
+	Location        *ProfileLocation         `json:"location"`
+	DefaultLocation bool                     `json:"default_location"` // Move back to the configured location
+}
+
+// POST /api/feedback
+type FeedbackRequest struct {
+	MessageID string `json:"message_id"`
+	Rating    string `json:"rating"`
+	Comment   string `json:"comment"`
+}
+
+// POST /api/ingest: a reading from an indoor sensor. AirGradient's local
+// API field names are accepted in place of the documented ones.
+type IngestRequest struct {
+	Sensor      string     `json:"sensor"`
+	Time        *time.Time `json:"time"`        // Now if not given
+	Temperature *float64   `json:"temperature"` // °C
+	Humidity    *float64   `json:"humidity"`    // %
+	CO2         *float64   `json:"co2"`         // ppm
+	PM25        *float64   `json:"pm2_5"`       // μg/m³
+
+	SerialNo string   `json:"serialno"` // Used as the sensor name if none is given
+	ATmp     *float64 `json:"atmp"`
+	RHum     *float64 `json:"rhum"`
+	RCO2     *float64 `json:"rco2"`
+	PM02     *float64 `json:"pm02"`
+}
+
+// GET /api/ingest
+type SensorsResponse struct {
+	Readings []SensorReading `json:"readings"`
+}
+
+// GET /api/ha/state: flat current conditions for Home Assistant, also
+// published over MQTT
+type HAStateResponse struct {
+	City            string    `json:"city"`
+	Condition       string    `json:"condition"` // Home Assistant weather condition, e.g. "partlycloudy"
+	Description     string    `json:"description"`
+	Temperature     float64   `json:"temperature"`
+	FeelsLike       float64   `json:"feels_like"`
+	Humidity        int       `json:"humidity"`
+	Pressure        int       `json:"pressure"` // hPa
+	WindSpeed       float64   `json:"wind_speed"`
+	WindGust        float64   `json:"wind_gust"`
+	WindBearing     int       `json:"wind_bearing"`
+	CloudCover      int       `json:"cloud_cover"`
+	UVIndex         float64   `json:"uv_index"`
+	Precipitation   float64   `json:"precipitation"` // mm in the last hour
+	AQI             *int      `json:"aqi"`           // Null without air quality data
+	PM25            *float64  `json:"pm2_5"`
+	Message         string    `json:"message"` // Latest generated message, if any
+	TemperatureUnit string    `json:"temperature_unit"`
+	WindSpeedUnit   string    `json:"wind_speed_unit"`
+	Severity        string    `json:"severity"` // none, advisory, watch, warning or emergency
+	SeverityColor   string    `json:"severity_color"`
+	Updated         time.Time `json:"updated"`
+}
+
+// GET /api/comparisons
+type ComparisonsResponse struct {
+	Enabled     bool              `json:"enabled"`
+	Comparisons []ModelComparison `json:"comparisons"`
+	Tallies     []ModelTally      `json:"tallies"`
+}
+
+// POST /api/comparisons/{id}/preference
+type PreferenceRequest struct {
+	Preferred string `json:"preferred"`
+}
+
+// GET and PATCH /api/admin/features
+type FeaturesResponse struct {
+	Features map[string]bool `json:"features"`
+}
+
+// GET /api/admin/archive
+type ArchiveResponse struct {
+	Enabled   bool               `json:"enabled"`
+	Responses []ArchivedResponse `json:"responses"`
+}
+
+// GET /api/prompts
+type PromptsResponse struct {
+	Enabled bool           `json:"enabled"`
+	Prompts []PromptRecord `json:"prompts"`
+}
+
+// POST /api/prompts/{id}/replay
+type ReplayRequest struct {
+	Model string `json:"model"` // The configured model if empty
+}
+
+// POST /api/prompts/{id}/replay
+type ReplayResponse struct {
+	Original PromptRecord `json:"original"`
+	Replay   PromptRecord `json:"replay"`
+}
+
+// POST /api/grafana/search
+type GrafanaSearchRequest struct {
+	Target string `json:"target"` // Filter; every target if empty
+}
+
+// Time range of a Grafana query
+type GrafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// One query in a Grafana panel
+type GrafanaTarget struct {
+	Target string `json:"target"` // e.g. "temp" or "Oslo:temp"
+	RefID  string `json:"refId"`
+	Type   string `json:"type,omitempty"` // "timeserie" (default) or "table"
+	Hide   bool   `json:"hide,omitempty"`
+}
+
+// POST /api/grafana/query
+type GrafanaQueryRequest struct {
+	Range         GrafanaRange    `json:"range"`
+	Targets       []GrafanaTarget `json:"targets"`
+	MaxDataPoints int             `json:"maxDataPoints,omitempty"`
+}
+
+// Time series answering a Grafana target: [value, Unix milliseconds] pairs
+type GrafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type GrafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Table answering a Grafana target of type "table"
+type GrafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []GrafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// POST /api/grafana/annotations
+type GrafanaAnnotationRequest struct {
+	Range      GrafanaRange           `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+// A generated message shown on Grafana charts
+type GrafanaAnnotation struct {
+	Annotation map[string]interface{} `json:"annotation"`
+	Time       int64                  `json:"time"` // Unix milliseconds
+	Title      string                 `json:"title"`
+	Text       string                 `json:"text"`
+}
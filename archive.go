@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query parameters whose values are credentials
+var secretQueryParams = []string{"key", "appid", "api_key", "apikey", "token", "access_token"}
+
+// A raw upstream response kept for reproducing parsing bugs
+type ArchivedResponse struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	Time      time.Time `json:"time"`
+	Size      int       `json:"size"`      // Size of the original body in bytes
+	Truncated bool      `json:"truncated"` // Body was cut to the archive's size cap
+	Body      string    `json:"body,omitempty"`
+}
+
+// Ring buffer of the most recent raw responses per provider. A nil archive
+// records nothing.
+type responseArchive struct {
+	mu       sync.Mutex
+	limit    int // Responses kept per provider
+	maxBytes int // Largest body kept per response
+	entries  map[string][]ArchivedResponse
+}
+
+// Create an archive keeping limit responses per provider, or nil to disable archiving
+func newResponseArchive(limit, maxBytes int) *responseArchive {
+	if limit <= 0 {
+		return nil
+	}
+	return &responseArchive{limit: limit, maxBytes: maxBytes, entries: make(map[string][]ArchivedResponse)}
+}
+
+// Replace known secret values in text
+func redactSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// Redact credential query parameters from a URL
+func redactURL(rawURL string, secrets []string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redactSecrets(rawURL, secrets)
+	}
+	query := u.Query()
+	for _, param := range secretQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+	u.RawQuery = query.Encode()
+	return redactSecrets(u.String(), secrets)
+}
+
+// Add a response, dropping the provider's oldest one when full
+func (a *responseArchive) record(provider, rawURL string, status int, body []byte, secrets []string) {
+	if a == nil {
+		return
+	}
+
+	entry := ArchivedResponse{
+		ID:       newMessageID(),
+		Provider: provider,
+		URL:      redactURL(rawURL, secrets),
+		Status:   status,
+		Time:     time.Now(),
+		Size:     len(body),
+	}
+	// Redact before truncating so a secret cut at the cap can't leak partly
+	entry.Body = redactSecrets(string(body), secrets)
+	if a.maxBytes > 0 && len(entry.Body) > a.maxBytes {
+		entry.Body = entry.Body[:a.maxBytes]
+		entry.Truncated = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := append(a.entries[provider], entry)
+	if len(entries) > a.limit {
+		entries = entries[len(entries)-a.limit:]
+	}
+	a.entries[provider] = entries
+}
+
+// Archived responses, newest first, optionally for a single provider. Bodies
+// are left out unless withBody is set.
+func (a *responseArchive) list(provider string, withBody bool) []ArchivedResponse {
+	result := []ArchivedResponse{}
+	if a == nil {
+		return result
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name, entries := range a.entries {
+		if provider != "" && name != provider {
+			continue
+		}
+		for _, entry := range entries {
+			if !withBody {
+				entry.Body = ""
+			}
+			result = append(result, entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	return result
+}
+
+// Look up an archived response by ID
+func (a *responseArchive) get(id string) (ArchivedResponse, bool) {
+	if a == nil {
+		return ArchivedResponse{}, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entries := range a.entries {
+		for _, entry := range entries {
+			if entry.ID == id {
+				return entry, true
+			}
+		}
+	}
+	return ArchivedResponse{}, false
+}
+
+// Archive a raw provider response, redacting the agent's API keys
+func (agent *WeatherAgent) archiveResponse(provider, rawURL string, status int, body []byte) {
+	agent.archive.record(provider, rawURL, status, body, agent.secrets)
+}
+
+// Provider name for an upstream URL, e.g. "api.open-meteo.com" -> "open-meteo"
+func providerForURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	// Skip second-level domains under country codes, e.g. metoffice.gov.uk
+	if n := len(labels); n >= 3 && len(labels[n-1]) == 2 {
+		switch labels[n-2] {
+		case "co", "com", "gov", "org", "ac", "net":
+			return labels[n-3]
+		}
+	}
+	if len(labels) >= 2 {
+		return labels[len(labels)-2]
+	}
+	return labels[0]
+}
+
+// GET /api/admin/archive[?provider=open-meteo] lists archived responses;
+// ?id=<id> returns one with its body
+func (agent *WeatherAgent) handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		entry, ok := agent.archive.get(id)
+		if !ok {
+			apiError(w, "Archived response not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ArchiveResponse{
+		Enabled:   agent.archive != nil,
+		Responses: agent.archive.list(r.URL.Query().Get("provider"), false),
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseArchiveRingBuffer(t *testing.T) {
+	archive := newResponseArchive(2, 16)
+	secrets := []string{"sk-secret"}
+
+	for i := 1; i <= 3; i++ {
+		archive.record("open-meteo", fmt.Sprintf("https://api.open-meteo.com/v1/forecast?n=%d", i), 200, []byte(fmt.Sprintf(`{"n":%d}`, i)), secrets)
+	}
+	archive.record("iqair", "https://api.airvisual.com/v2/nearest_city?lat=1&key=sk-secret", 200,
+		[]byte(`{"echo":"sk-secret","padding":"xxxxxxxx"}`), secrets)
+
+	openMeteo := archive.list("open-meteo", true)
+	if len(openMeteo) != 2 || openMeteo[0].Body != `{"n":3}` || openMeteo[1].Body != `{"n":2}` {
+		t.Fatalf("expected the two newest open-meteo responses, got %+v", openMeteo)
+	}
+
+	iqair := archive.list("iqair", true)[0]
+	if strings.Contains(iqair.URL, "sk-secret") || strings.Contains(iqair.Body, "sk-secret") {
+		t.Errorf("secret not redacted: %+v", iqair)
+	}
+	if !iqair.Truncated || len(iqair.Body) != 16 || iqair.Size != 41 {
+		t.Errorf("expected a truncated body, got %+v", iqair)
+	}
+
+	if all := archive.list("", false); len(all) != 3 || all[0].Body != "" {
+		t.Errorf("listing without bodies = %+v", all)
+	}
+	if got, ok := archive.get(iqair.ID); !ok || got.Provider != "iqair" {
+		t.Errorf("get(%q) = %+v, %t", iqair.ID, got, ok)
+	}
+}
+
+func TestDisabledResponseArchive(t *testing.T) {
+	archive := newResponseArchive(0, 0)
+	archive.record("open-meteo", "https://api.open-meteo.com/v1/forecast", 200, []byte("{}"), nil)
+	if entries := archive.list("", true); len(entries) != 0 {
+		t.Errorf("disabled archive kept %v", entries)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	got := redactURL("https://api.openweathermap.org/data/2.5/air_pollution?lat=1&appid=abc123", nil)
+	if strings.Contains(got, "abc123") || !strings.Contains(got, "appid=REDACTED") || !strings.Contains(got, "lat=1") {
+		t.Errorf("redactURL = %q", got)
+	}
+}
+
+func TestProviderForURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.open-meteo.com/v1/forecast":                             "open-meteo",
+		"https://archive-api.open-meteo.com/v1/era5":                         "open-meteo",
+		"https://api.airvisual.com/v2/nearest_city":                          "airvisual",
+		"https://data.hub.api.metoffice.gov.uk/sitespecific/v0/point/hourly": "metoffice",
+		"https://opendata.dwd.de/weather/":                                   "dwd",
+		"http://localhost:8080/forecast":                                     "localhost",
+	}
+	for rawURL, want := range tests {
+		if got := providerForURL(rawURL); got != want {
+			t.Errorf("providerForURL(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestHandleArchive(t *testing.T) {
+	agent := &WeatherAgent{archive: newResponseArchive(5, 0)}
+	agent.archiveResponse("anthropic", "https://api.anthropic.com/v1/messages", 500, []byte(`{"error":"overloaded"}`))
+	id := agent.archive.list("", false)[0].ID
+
+	rec := httptest.NewRecorder()
+	agent.handleArchive(rec, httptest.NewRequest("GET", "/api/admin/archive?id="+id, nil))
+	var entry ArchivedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &entry); err != nil || entry.Body != `{"error":"overloaded"}` || entry.Status != 500 {
+		t.Errorf("archive entry = %+v, %v", entry, err)
+	}
+
+	rec = httptest.NewRecorder()
+	agent.handleArchive(rec, httptest.NewRequest("GET", "/api/admin/archive?id=missing", nil))
+	if rec.Code != 404 {
+		t.Errorf("missing entry: got status %d, want 404", rec.Code)
+	}
+}
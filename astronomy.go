@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Kinds of astronomical event in the bundled calendar
+const (
+	AstroMeteorShower = "meteor_shower"
+	AstroLunarEclipse = "lunar_eclipse"
+	AstroSolarEclipse = "solar_eclipse"
+)
+
+// Cloud cover (%) below which the night sky counts as clear
+const clearSkyCloudCover = 30
+
+// Hour of the day (local time) from which the evening message applies
+const eveningStartHour = 17
+
+// Annual meteor shower with its peak date and activity window
+type meteorShower struct {
+	Name       string
+	PeakMonth  time.Month
+	PeakDay    int
+	ActiveDays int // Days either side of the peak worth mentioning
+	ZHR        int // Zenithal hourly rate at peak
+	Tip        string
+}
+
+// Bundled meteor shower calendar (peaks vary by a day or so each year)
+var meteorShowers = []meteorShower{
+	{"Quadrantids", time.January, 3, 1, 110, "best after midnight, looking north-east"},
+	{"Lyrids", time.April, 22, 2, 18, "best in the pre-dawn hours"},
+	{"Eta Aquariids", time.May, 6, 3, 50, "best in the pre-dawn hours, especially in the southern hemisphere"},
+	{"Southern Delta Aquariids", time.July, 30, 3, 25, "best after midnight, looking south"},
+	{"Perseids", time.August, 12, 3, 100, "best after midnight, looking north-east"},
+	{"Orionids", time.October, 21, 2, 20, "best after midnight, looking towards Orion"},
+	{"Leonids", time.November, 17, 1, 15, "best after midnight, looking east"},
+	{"Geminids", time.December, 14, 2, 150, "visible from late evening, looking towards Gemini"},
+}
+
+// A dated eclipse with a rough description of where it can be seen
+type eclipse struct {
+	Date        string // YYYY-MM-DD (UTC)
+	Kind        string
+	Description string
+	VisibleFrom string
+}
+
+// Bundled eclipse calendar
+var eclipses = []eclipse{
+	{"2025-03-14", AstroLunarEclipse, "total lunar eclipse", "the Americas, western Europe and Africa"},
+	{"2025-03-29", AstroSolarEclipse, "partial solar eclipse", "north-west Africa, Europe and northern Russia"},
+	{"2025-09-07", AstroLunarEclipse, "total lunar eclipse", "Europe, Africa, Asia and Australia"},
+	{"2025-09-21", AstroSolarEclipse, "partial solar eclipse", "New Zealand and Antarctica"},
+	{"2026-02-17", AstroSolarEclipse, "annular solar eclipse", "Antarctica and the southern tip of Africa"},
+	{"2026-03-03", AstroLunarEclipse, "total lunar eclipse", "East Asia, Australia and the Americas"},
+	{"2026-08-12", AstroSolarEclipse, "total solar eclipse", "Greenland, Iceland and Spain (partial across Europe)"},
+	{"2026-08-28", AstroLunarEclipse, "partial lunar eclipse", "the Americas, Europe and Africa"},
+	{"2027-02-06", AstroSolarEclipse, "annular solar eclipse", "South America and West Africa"},
+	{"2027-08-02", AstroSolarEclipse, "total solar eclipse", "Spain, North Africa and the Middle East"},
+	{"2028-01-12", AstroLunarEclipse, "partial lunar eclipse", "the Americas, Europe and Africa"},
+	{"2028-01-26", AstroSolarEclipse, "annular solar eclipse", "South America, western Europe and North Africa"},
+	{"2028-07-06", AstroLunarEclipse, "partial lunar eclipse", "Europe, Africa, Asia and Australia"},
+	{"2028-07-22", AstroSolarEclipse, "total solar eclipse", "Australia and New Zealand"},
+	{"2028-12-31", AstroLunarEclipse, "total lunar eclipse", "Europe, Africa, Asia and Australia"},
+}
+
+// An astronomical event happening on a given date
+type AstroEvent struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Date       string `json:"date"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Astronomical events active on the given local date
+func astroEventsOn(date time.Time) []AstroEvent {
+	var events []AstroEvent
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	for _, shower := range meteorShowers {
+		peak := time.Date(date.Year(), shower.PeakMonth, shower.PeakDay, 0, 0, 0, 0, time.UTC)
+		// Handle showers peaking early January when checking late December
+		if peak.Sub(day) > 180*24*time.Hour {
+			peak = peak.AddDate(-1, 0, 0)
+		} else if day.Sub(peak) > 180*24*time.Hour {
+			peak = peak.AddDate(1, 0, 0)
+		}
+
+		daysFromPeak := int(day.Sub(peak).Hours() / 24)
+		if daysFromPeak < -shower.ActiveDays || daysFromPeak > shower.ActiveDays {
+			continue
+		}
+
+		when := "peaks tonight"
+		if daysFromPeak < 0 {
+			when = fmt.Sprintf("peaks in %d day(s)", -daysFromPeak)
+		} else if daysFromPeak > 0 {
+			when = "is just past its peak"
+		}
+		events = append(events, AstroEvent{
+			Kind: AstroMeteorShower,
+			Name: shower.Name,
+			Date: peak.Format("2006-01-02"),
+			Suggestion: fmt.Sprintf("The %s meteor shower %s (up to ~%d meteors/hour at peak), %s. Find a dark spot away from city lights.",
+				shower.Name, when, shower.ZHR, shower.Tip),
+		})
+	}
+
+	dateStr := day.Format("2006-01-02")
+	for _, e := range eclipses {
+		if e.Date != dateStr {
+			continue
+		}
+		suggestion := fmt.Sprintf("A %s happens today, visible from %s.", e.Description, e.VisibleFrom)
+		if e.Kind == AstroSolarEclipse {
+			suggestion += " Never look at the sun without certified eclipse glasses."
+		}
+		events = append(events, AstroEvent{
+			Kind:       e.Kind,
+			Name:       e.Description,
+			Date:       e.Date,
+			Suggestion: suggestion,
+		})
+	}
+
+	return events
+}
+
+// Whether sky conditions suit night-time viewing
+func isClearNight(cloudCover int, isDaytime bool, hour int) bool {
+	return cloudCover < clearSkyCloudCover && (!isDaytime || hour >= eveningStartHour)
+}
+
+// Events worth suggesting given the local time and sky conditions.
+// Solar eclipses are daytime events and are suggested whenever skies are clear.
+func viewableAstroEvents(localTime time.Time, cloudCover int, isDaytime bool) []AstroEvent {
+	var viewable []AstroEvent
+	for _, event := range astroEventsOn(localTime) {
+		if cloudCover >= clearSkyCloudCover {
+			continue
+		}
+		if event.Kind == AstroSolarEclipse && isDaytime {
+			viewable = append(viewable, event)
+		} else if event.Kind != AstroSolarEclipse && isClearNight(cloudCover, isDaytime, localTime.Hour()) {
+			viewable = append(viewable, event)
+		}
+	}
+	return viewable
+}
+
+// Tracks which astronomy alerts were already sent so each fires once
+type astroAlertTracker struct {
+	mu   sync.Mutex
+	sent map[string]bool
+}
+
+// Record an alert key, returning false if it was already sent
+func (t *astroAlertTracker) markSent(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sent == nil {
+		t.sent = make(map[string]bool)
+	}
+	if t.sent[key] {
+		return false
+	}
+	t.sent[key] = true
+	return true
+}
+
+// Send an astronomy alert for viewable events at the configured location
+func (agent *WeatherAgent) checkAstronomyAlerts(weather WeatherResponse, weatherData map[string]interface{}) {
+	if !agent.hasRecipients(NotificationAlert) {
+		return
+	}
+
+	localTime := time.Unix(weather.Dt, 0).In(time.FixedZone("Local", weather.Timezone))
+	isDaytime, _ := weatherData["is_daytime"].(bool)
+
+	for _, event := range viewableAstroEvents(localTime, weather.Clouds.All, isDaytime) {
+		key := fmt.Sprintf("%s|%s|%s", weather.Name, event.Name, localTime.Format("2006-01-02"))
+		if !agent.astroAlerts.markSent(key) {
+			continue
+		}
+
+		agent.notify(Notification{
+			Type:      NotificationAlert,
+			AlertType: "astronomy",
+			Severity:  "minor",
+			Title:     fmt.Sprintf("Clear skies for the %s in %s", event.Name, weather.Name),
+			Message:   event.Suggestion,
+			City:      weather.Name,
+			Country:   weather.Sys.Country,
+			Units:     agent.config.Units,
+			Data:      weatherData,
+		})
+	}
+}
+
+// Mean length of the synodic month in days
+const synodicMonth = 29.530588853
+
+// Current phase of the moon
+type MoonPhase struct {
+	Elongation   float64 // Moon's ecliptic longitude minus the Sun's, 0-360 degrees
+	Age          float64 // Approximate days since new moon
+	Illumination float64 // Illuminated fraction of the disc, 0-1
+	Name         string
+}
+
+// Julian Day for a time instant
+func julianDay(t time.Time) float64 {
+	return float64(t.UTC().UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+// Normalize an angle to the range [0, 360)
+func normalizeDegrees(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+func sinDeg(deg float64) float64 {
+	return math.Sin(deg * math.Pi / 180)
+}
+
+// Apparent geocentric ecliptic longitude of the Sun (Meeus, Astronomical Algorithms ch. 25, low precision)
+func sunLongitude(jd float64) float64 {
+	t := (jd - 2451545.0) / 36525
+	l0 := 280.46646 + 36000.76983*t + 0.0003032*t*t
+	m := 357.52911 + 35999.05029*t - 0.0001537*t*t
+	c := (1.914602-0.004817*t-0.000014*t*t)*sinDeg(m) +
+		(0.019993-0.000101*t)*sinDeg(2*m) +
+		0.000289*sinDeg(3*m)
+	return normalizeDegrees(l0 + c)
+}
+
+// Geocentric ecliptic longitude of the Moon using the largest periodic
+// terms from Meeus ch. 47 (accurate to a few tenths of a degree)
+func moonLongitude(jd float64) float64 {
+	lp, d, m, mp, f := lunarArguments(jd)
+
+	lon := lp +
+		6.288774*sinDeg(mp) +
+		1.274027*sinDeg(2*d-mp) +
+		0.658314*sinDeg(2*d) +
+		0.213618*sinDeg(2*mp) -
+		0.185116*sinDeg(m) -
+		0.114332*sinDeg(2*f) +
+		0.058793*sinDeg(2*d-2*mp) +
+		0.057066*sinDeg(2*d-m-mp) +
+		0.053322*sinDeg(2*d+mp) +
+		0.045758*sinDeg(2*d-m) -
+		0.040923*sinDeg(m-mp) -
+		0.034720*sinDeg(d) -
+		0.030383*sinDeg(m+mp)
+	return normalizeDegrees(lon)
+}
+
+// Calculate the moon phase at a given instant
+func calculateMoonPhase(t time.Time) MoonPhase {
+	jd := julianDay(t)
+	elongation := normalizeDegrees(moonLongitude(jd) - sunLongitude(jd))
+
+	return MoonPhase{
+		Elongation:   elongation,
+		Age:          elongation / 360 * synodicMonth,
+		Illumination: (1 - math.Cos(elongation*math.Pi/180)) / 2,
+		Name:         moonPhaseName(elongation),
+	}
+}
+
+// Name the phase for an elongation. The principal phases cover 2.5% of the
+// cycle either side of the exact instant (about 18 hours).
+func moonPhaseName(elongation float64) string {
+	const window = 0.025 * 360
+	switch {
+	case elongation < window || elongation >= 360-window:
+		return "New Moon"
+	case elongation < 90-window:
+		return "Waxing Crescent"
+	case elongation < 90+window:
+		return "First Quarter"
+	case elongation < 180-window:
+		return "Waxing Gibbous"
+	case elongation < 180+window:
+		return "Full Moon"
+	case elongation < 270-window:
+		return "Waning Gibbous"
+	case elongation < 270+window:
+		return "Last Quarter"
+	default:
+		return "Waning Crescent"
+	}
+}
+
+// Altitude of the Moon's centre at rise and set, allowing for its mean
+// parallax, semi-diameter and refraction (Meeus ch. 15)
+const moonRiseAltitude = 0.125
+
+// Fundamental lunar arguments in degrees (Meeus ch. 47): the Moon's mean
+// longitude, mean elongation, Sun's mean anomaly, Moon's mean anomaly and
+// argument of latitude
+func lunarArguments(jd float64) (lp, d, m, mp, f float64) {
+	t := (jd - 2451545.0) / 36525
+	lp = 218.3164477 + 481267.88123421*t
+	d = 297.8501921 + 445267.1114034*t
+	m = 357.5291092 + 35999.0502909*t
+	mp = 134.9633964 + 477198.8675055*t
+	f = 93.2720950 + 483202.0175233*t
+	return
+}
+
+// Geocentric ecliptic latitude of the Moon from the largest terms of Meeus ch. 47
+func moonLatitude(jd float64) float64 {
+	_, d, _, mp, f := lunarArguments(jd)
+	return 5.128122*sinDeg(f) +
+		0.280602*sinDeg(mp+f) +
+		0.277693*sinDeg(mp-f) +
+		0.173237*sinDeg(2*d-f) +
+		0.055413*sinDeg(2*d-mp+f) +
+		0.046271*sinDeg(2*d-mp-f) +
+		0.032573*sinDeg(2*d+f) +
+		0.017198*sinDeg(2*mp+f) +
+		0.009266*sinDeg(2*d+mp-f) +
+		0.008822*sinDeg(2*mp-f)
+}
+
+func cosDeg(deg float64) float64 {
+	return math.Cos(deg * math.Pi / 180)
+}
+
+// Altitude of the Moon above the horizon in degrees for an observer
+func moonAltitude(t time.Time, lat, lon float64) float64 {
+	jd := julianDay(t)
+	lambda, beta := moonLongitude(jd), moonLatitude(jd)
+
+	// Ecliptic to equatorial coordinates
+	obliquity := 23.439291 - 0.0130042*(jd-2451545.0)/36525
+	ra := math.Atan2(sinDeg(lambda)*cosDeg(obliquity)-math.Tan(beta*math.Pi/180)*sinDeg(obliquity), cosDeg(lambda)) * 180 / math.Pi
+	dec := math.Asin(sinDeg(beta)*cosDeg(obliquity)+cosDeg(beta)*sinDeg(obliquity)*sinDeg(lambda)) * 180 / math.Pi
+
+	// Local hour angle from Greenwich mean sidereal time (Meeus ch. 12)
+	siderealTime := 280.46061837 + 360.98564736629*(jd-2451545.0)
+	hourAngle := normalizeDegrees(siderealTime + lon - ra)
+
+	return math.Asin(sinDeg(lat)*sinDeg(dec)+cosDeg(lat)*cosDeg(dec)*cosDeg(hourAngle)) * 180 / math.Pi
+}
+
+// Narrow a sign change of f between a and b down to a minute
+func bisectTime(a, b time.Time, f func(time.Time) float64) time.Time {
+	fa := f(a)
+	for b.Sub(a) > time.Minute {
+		mid := a.Add(b.Sub(a) / 2)
+		if fm := f(mid); (fm >= 0) == (fa >= 0) {
+			a, fa = mid, fm
+		} else {
+			b = mid
+		}
+	}
+	return a.Add(b.Sub(a) / 2).Round(time.Minute)
+}
+
+// Moonrise and moonset during the local day containing t. Either is zero
+// when it doesn't happen that day, which occurs roughly once a month.
+func moonRiseSet(t time.Time, lat, lon float64) (rise, set time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := start.AddDate(0, 0, 1)
+	above := func(at time.Time) float64 { return moonAltitude(at, lat, lon) - moonRiseAltitude }
+
+	const step = 10 * time.Minute
+	prev := above(start)
+	for at := start.Add(step); !at.After(end); at = at.Add(step) {
+		cur := above(at)
+		if prev < 0 && cur >= 0 && rise.IsZero() {
+			rise = bisectTime(at.Add(-step), at, above).In(t.Location())
+		} else if prev >= 0 && cur < 0 && set.IsZero() {
+			set = bisectTime(at.Add(-step), at, above).In(t.Location())
+		}
+		prev = cur
+	}
+	return rise, set
+}
+
+// Next instant after t at which the Sun-Moon elongation reaches target
+// degrees (0 for new moon, 180 for full moon)
+func nextMoonPhase(t time.Time, target float64) time.Time {
+	// Signed distance from the target, in [-180, 180)
+	offset := func(at time.Time) float64 {
+		return normalizeDegrees(calculateMoonPhase(at).Elongation-target+180) - 180
+	}
+
+	const step = 6 * time.Hour
+	prev := offset(t)
+	for at := t.Add(step); at.Sub(t) <= 31*24*time.Hour; at = at.Add(step) {
+		cur := offset(at)
+		// The elongation only grows, so a crossing is a small negative-to-positive step
+		if prev < 0 && cur >= 0 && cur-prev < 90 {
+			return bisectTime(at.Add(-step), at, offset).In(t.Location())
+		}
+		prev = cur
+	}
+	return time.Time{}
+}
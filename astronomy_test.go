@@ -0,0 +1,222 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAstroEventsOn(t *testing.T) {
+	tests := []struct {
+		date     time.Time
+		wantName string
+		wantKind string
+	}{
+		{time.Date(2025, 8, 12, 22, 0, 0, 0, time.UTC), "Perseids", AstroMeteorShower},
+		{time.Date(2025, 12, 31, 22, 0, 0, 0, time.UTC), "", ""},
+		{time.Date(2026, 1, 2, 22, 0, 0, 0, time.UTC), "Quadrantids", AstroMeteorShower},
+		{time.Date(2025, 12, 13, 22, 0, 0, 0, time.UTC), "Geminids", AstroMeteorShower},
+		{time.Date(2026, 3, 3, 22, 0, 0, 0, time.UTC), "total lunar eclipse", AstroLunarEclipse},
+		{time.Date(2026, 6, 1, 22, 0, 0, 0, time.UTC), "", ""},
+	}
+
+	for _, tt := range tests {
+		events := astroEventsOn(tt.date)
+		if tt.wantName == "" {
+			if len(events) != 0 {
+				t.Errorf("%s: expected no events, got %+v", tt.date.Format("2006-01-02"), events)
+			}
+			continue
+		}
+		if len(events) != 1 || events[0].Name != tt.wantName || events[0].Kind != tt.wantKind {
+			t.Errorf("%s: expected %s, got %+v", tt.date.Format("2006-01-02"), tt.wantName, events)
+		}
+	}
+}
+
+func TestViewableAstroEvents(t *testing.T) {
+	evening := time.Date(2025, 8, 12, 21, 0, 0, 0, time.UTC)
+
+	if events := viewableAstroEvents(evening, 10, false); len(events) != 1 {
+		t.Fatalf("expected Perseids to be viewable on a clear night, got %+v", events)
+	} else if !strings.Contains(events[0].Suggestion, "peaks tonight") {
+		t.Errorf("unexpected suggestion: %s", events[0].Suggestion)
+	}
+
+	if events := viewableAstroEvents(evening, 80, false); len(events) != 0 {
+		t.Errorf("cloudy skies should suppress suggestions, got %+v", events)
+	}
+
+	morning := time.Date(2025, 8, 12, 9, 0, 0, 0, time.UTC)
+	if events := viewableAstroEvents(morning, 10, true); len(events) != 0 {
+		t.Errorf("meteor showers should not be suggested in the morning, got %+v", events)
+	}
+
+	eclipseDay := time.Date(2026, 8, 12, 18, 0, 0, 0, time.UTC)
+	found := false
+	for _, event := range viewableAstroEvents(eclipseDay, 5, true) {
+		if event.Kind == AstroSolarEclipse {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("solar eclipse should be suggested during clear daytime")
+	}
+}
+
+func TestAstroAlertTrackerSendsOnce(t *testing.T) {
+	var tracker astroAlertTracker
+	if !tracker.markSent("London|Perseids|2025-08-12") {
+		t.Fatal("first alert should be sent")
+	}
+	if tracker.markSent("London|Perseids|2025-08-12") {
+		t.Fatal("duplicate alert should be suppressed")
+	}
+}
+
+func TestCalculateMoonPhaseAgainstEphemeris(t *testing.T) {
+	// Principal phase instants from published ephemerides (UTC)
+	tests := []struct {
+		when       string
+		elongation float64
+		name       string
+	}{
+		{"2000-01-06T18:14:00Z", 0, "New Moon"},
+		{"2000-01-21T04:40:00Z", 180, "Full Moon"},
+		{"2024-01-18T03:53:00Z", 90, "First Quarter"},
+		{"2024-01-25T17:54:00Z", 180, "Full Moon"},
+		{"2024-02-02T23:18:00Z", 270, "Last Quarter"},
+		{"2024-04-08T18:21:00Z", 0, "New Moon"},
+		{"2025-01-29T12:36:00Z", 0, "New Moon"},
+		{"2025-09-07T18:09:00Z", 180, "Full Moon"},
+		{"2026-08-28T04:18:00Z", 180, "Full Moon"},
+	}
+
+	for _, tt := range tests {
+		at, err := time.Parse(time.RFC3339, tt.when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		phase := calculateMoonPhase(at)
+
+		diff := math.Abs(phase.Elongation - tt.elongation)
+		if diff > 180 {
+			diff = 360 - diff
+		}
+		if diff > 1.0 {
+			t.Errorf("%s: elongation %.2f°, want %.0f° (±1°)", tt.when, phase.Elongation, tt.elongation)
+		}
+		if phase.Name != tt.name {
+			t.Errorf("%s: phase %q, want %q", tt.when, phase.Name, tt.name)
+		}
+	}
+}
+
+func TestMoonPhaseBetweenPrincipalPhases(t *testing.T) {
+	tests := []struct {
+		when string
+		name string
+	}{
+		{"2024-01-14T12:00:00Z", "Waxing Crescent"},
+		{"2024-01-21T12:00:00Z", "Waxing Gibbous"},
+		{"2024-01-29T12:00:00Z", "Waning Gibbous"},
+		{"2024-02-06T12:00:00Z", "Waning Crescent"},
+	}
+
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.when)
+		if got := calculateMoonPhase(at).Name; got != tt.name {
+			t.Errorf("%s: phase %q, want %q", tt.when, got, tt.name)
+		}
+	}
+}
+
+func TestMoonPhaseNameBoundaries(t *testing.T) {
+	tests := []struct {
+		elongation float64
+		name       string
+	}{
+		{0, "New Moon"},
+		{8.99, "New Moon"},
+		{9, "Waxing Crescent"},
+		{80.99, "Waxing Crescent"},
+		{81, "First Quarter"},
+		{98.99, "First Quarter"},
+		{99, "Waxing Gibbous"},
+		{171, "Full Moon"},
+		{188.99, "Full Moon"},
+		{189, "Waning Gibbous"},
+		{261, "Last Quarter"},
+		{279, "Waning Crescent"},
+		{350.99, "Waning Crescent"},
+		{351, "New Moon"},
+	}
+
+	for _, tt := range tests {
+		if got := moonPhaseName(tt.elongation); got != tt.name {
+			t.Errorf("moonPhaseName(%.2f) = %q, want %q", tt.elongation, got, tt.name)
+		}
+	}
+}
+
+func TestMoonIllumination(t *testing.T) {
+	full, _ := time.Parse(time.RFC3339, "2024-01-25T17:54:00Z")
+	if illum := calculateMoonPhase(full).Illumination; illum < 0.99 {
+		t.Errorf("full moon illumination %.3f, want ~1", illum)
+	}
+	newMoon, _ := time.Parse(time.RFC3339, "2024-04-08T18:21:00Z")
+	if illum := calculateMoonPhase(newMoon).Illumination; illum > 0.01 {
+		t.Errorf("new moon illumination %.3f, want ~0", illum)
+	}
+}
+
+func TestMoonRiseSet(t *testing.T) {
+	// Published times (UTC), allowing for the truncated lunar series
+	tests := []struct {
+		name     string
+		date     time.Time
+		lat, lon float64
+		rise     string
+		set      string
+	}{
+		{"London new moon", time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC), 51.5074, -0.1278, "2024-04-08T05:13:00Z", "2024-04-08T18:41:00Z"},
+		{"London full moon", time.Date(2024, 1, 25, 12, 0, 0, 0, time.UTC), 51.5074, -0.1278, "2024-01-25T16:04:00Z", "2024-01-25T08:16:00Z"},
+		{"New York", time.Date(2024, 4, 8, 12, 0, 0, 0, time.FixedZone("EDT", -4*3600)), 40.7128, -74.0060, "2024-04-08T10:22:00Z", "2024-04-08T23:42:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rise, set := moonRiseSet(tt.date, tt.lat, tt.lon)
+			for _, got := range []struct {
+				label string
+				at    time.Time
+				want  string
+			}{{"moonrise", rise, tt.rise}, {"moonset", set, tt.set}} {
+				want, _ := time.Parse(time.RFC3339, got.want)
+				if diff := got.at.Sub(want); diff < -10*time.Minute || diff > 10*time.Minute {
+					t.Errorf("%s = %v, want %v (±10m)", got.label, got.at.UTC(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestNextMoonPhase(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2024-01-20T00:00:00Z")
+	tests := []struct {
+		target float64
+		want   string
+	}{
+		{180, "2024-01-25T17:54:00Z"},
+		{0, "2024-02-09T22:59:00Z"},
+	}
+
+	for _, tt := range tests {
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		got := nextMoonPhase(from, tt.target)
+		if diff := got.Sub(want); diff < -30*time.Minute || diff > 30*time.Minute {
+			t.Errorf("nextMoonPhase(%.0f) = %v, want %v (±30m)", tt.target, got, want)
+		}
+	}
+}
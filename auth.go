@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Cookie used by the web UI to carry the API key after logging in via ?api_key=
+const apiKeyCookieName = "weather_agent_key"
+
+// Optional API key authentication for the web endpoints
+type apiKeyAuth struct {
+	keys     []string
+	sessions *uiAuth // Also let in users logged into the web UI, if set
+}
+
+// Create an authenticator from the configured keys. Empty keys are ignored
+// and authentication is disabled if none remain.
+func newAPIKeyAuth(keys []string) *apiKeyAuth {
+	auth := &apiKeyAuth{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			auth.keys = append(auth.keys, key)
+		}
+	}
+	return auth
+}
+
+// Whether any API keys are configured
+func (a *apiKeyAuth) enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Check a candidate key against the configured keys in constant time
+func (a *apiKeyAuth) valid(candidate string) bool {
+	if candidate == "" {
+		return false
+	}
+	match := 0
+	for _, key := range a.keys {
+		match |= subtle.ConstantTimeCompare([]byte(candidate), []byte(key))
+	}
+	return match == 1
+}
+
+// Whether the request carries a valid key or comes from a logged-in UI user
+func (a *apiKeyAuth) authorized(r *http.Request) bool {
+	return a.valid(requestAPIKey(r)) || a.sessions.authenticated(r)
+}
+
+// Extract the API key from the request.
+// Supports "Authorization: Bearer <key>", "X-API-Key: <key>" and the UI cookie.
+func requestAPIKey(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		const prefix = "Bearer "
+		if len(authHeader) > len(prefix) && strings.EqualFold(authHeader[:len(prefix)], prefix) {
+			return strings.TrimSpace(authHeader[len(prefix):])
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if cookie, err := r.Cookie(apiKeyCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Whether requests must be authenticated: when keys are configured or users
+// log into the UI. Otherwise the API is open.
+func (a *apiKeyAuth) required() bool {
+	return a.enabled() || a.sessions != nil
+}
+
+// Wrap a handler so that requests without a valid API key or UI session
+// receive 401 Unauthorized
+func (a *apiKeyAuth) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.required() && !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="weather-agent"`)
+			apiError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Like middleware, but also accepts the key as ?api_key=, for feeds fetched
+// by apps that can't send headers or cookies (e.g. calendar subscriptions)
+func (a *apiKeyAuth) feedMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.required() && !a.valid(r.URL.Query().Get("api_key")) && !a.authorized(r) {
+			apiError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Store a valid key passed as ?api_key= in a cookie so the browser UI can
+// call the protected API endpoints. Returns false if the key was invalid.
+func (a *apiKeyAuth) loginFromQuery(w http.ResponseWriter, r *http.Request) bool {
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		return true
+	}
+	if !a.valid(key) {
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     apiKeyCookieName,
+		Value:    key,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	return true
+}
+
+// Wrap an admin handler. Unlike middleware, only UI users listed in
+// UI_ADMIN_USERS are let in, not everyone who can log in, and requests are
+// refused when there are neither keys nor admins, so admin endpoints are
+// never open by default.
+func (a *apiKeyAuth) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled() && !a.sessions.hasAdmins() {
+			apiError(w, "Admin API is disabled (set ADMIN_API_KEYS, or UI_AUTH with UI_ADMIN_USERS)", http.StatusForbidden)
+			return
+		}
+		if !a.valid(requestAPIKey(r)) && !a.sessions.admin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="weather-agent-admin"`)
+			apiError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Request context key holding the caller's owner ID (see userMiddleware)
+type ownerContextKey struct{}
+
+// The owner ID userMiddleware found for the request, or "" outside it (tests)
+func requestOwner(r *http.Request) string {
+	owner, _ := r.Context().Value(ownerContextKey{}).(string)
+	return owner
+}
+
+// Identify the caller for per-user data: by a hash of their API key, or as
+// a user logged into the UI. False when the request carries neither.
+func (a *apiKeyAuth) owner(r *http.Request) (string, bool) {
+	if key := requestAPIKey(r); a.valid(key) {
+		return subscriptionOwner(key), true
+	}
+	if user, ok := a.sessions.user(r); ok {
+		return sessionOwner(user), true
+	}
+	return "", false
+}
+
+// Wrap a handler for per-user data such as subscriptions. Like
+// adminMiddleware, requests are refused when no keys are configured and no
+// one can log into the UI, as every caller would then be the same user and
+// could change everyone's data. The owner is passed on in the request context.
+func (a *apiKeyAuth) userMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled() && a.sessions == nil {
+			apiError(w, "Subscriptions are disabled (set API_KEYS or UI_AUTH)", http.StatusForbidden)
+			return
+		}
+		owner, ok := a.owner(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="weather-agent"`)
+			apiError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), ownerContextKey{}, owner)))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	auth := newAPIKeyAuth([]string{"secret-key", " "})
+	handler := auth.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"missing key", "", "", http.StatusUnauthorized},
+		{"bearer token", "Authorization", "Bearer secret-key", http.StatusOK},
+		{"api key header", "X-API-Key", "secret-key", http.StatusOK},
+		{"wrong key", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"wrong scheme", "Authorization", "Basic secret-key", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/weather", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAuthDisabled(t *testing.T) {
+	auth := newAPIKeyAuth(nil)
+	if auth.enabled() {
+		t.Fatal("auth should be disabled without keys")
+	}
+
+	rec := httptest.NewRecorder()
+	auth.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(rec, httptest.NewRequest("GET", "/api/weather", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+}
+
+func TestAPIKeyLoginCookie(t *testing.T) {
+	auth := newAPIKeyAuth([]string{"secret-key"})
+
+	rec := httptest.NewRecorder()
+	if !auth.loginFromQuery(rec, httptest.NewRequest("GET", "/?api_key=secret-key", nil)) {
+		t.Fatal("valid key should log in")
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != apiKeyCookieName {
+		t.Fatalf("expected login cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/api/weather", nil)
+	req.AddCookie(cookies[0])
+	if !auth.valid(requestAPIKey(req)) {
+		t.Fatal("cookie should authenticate subsequent requests")
+	}
+
+	if auth.loginFromQuery(httptest.NewRecorder(), httptest.NewRequest("GET", "/?api_key=bad", nil)) {
+		t.Fatal("invalid key should not log in")
+	}
+}
+
+func TestAPIKeyFeedMiddleware(t *testing.T) {
+	handler := newAPIKeyAuth([]string{"secret-key"}).feedMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]int{
+		"/calendar.ics":                    http.StatusUnauthorized,
+		"/calendar.ics?api_key=nope":       http.StatusUnauthorized,
+		"/calendar.ics?api_key=secret-key": http.StatusOK,
+	}
+	for target, want := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != want {
+			t.Errorf("%s: got status %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestAPIKeyUserMiddleware(t *testing.T) {
+	var owner string
+	record := func(w http.ResponseWriter, r *http.Request) { owner = requestOwner(r) }
+
+	rec := httptest.NewRecorder()
+	newAPIKeyAuth(nil).userMiddleware(record)(rec, httptest.NewRequest("GET", "/api/v1/subscriptions", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("without keys or UI auth: got status %d, want 403", rec.Code)
+	}
+
+	handler := newAPIKeyAuth([]string{"alice-key", "bob-key"}).userMiddleware(record)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/api/v1/subscriptions", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: got status %d, want 401", rec.Code)
+	}
+	owners := make(map[string]bool)
+	for _, key := range []string{"alice-key", "bob-key"} {
+		req := httptest.NewRequest("GET", "/api/v1/subscriptions", nil)
+		req.Header.Set("X-API-Key", key)
+		handler(httptest.NewRecorder(), req)
+		owners[owner] = true
+	}
+	if len(owners) != 2 || owners[""] {
+		t.Errorf("owners = %v, want one per key", owners)
+	}
+}
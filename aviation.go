@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// aviationweather.gov settings
+const (
+	aviationWeatherURL   = "https://aviationweather.gov/api/data"
+	aviationCacheTTL     = 10 * time.Minute // METARs are issued hourly, SPECIs in between
+	aviationSearchDegree = 1.0              // Half-width of the box searched for the nearest station
+)
+
+// Flight categories, from best to worst
+const (
+	FlightVFR  = "VFR"
+	FlightMVFR = "MVFR"
+	FlightIFR  = "IFR"
+	FlightLIFR = "LIFR"
+)
+
+// ICAO station identifiers, e.g. "KJFK" or "EGLL"
+var icaoPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+
+// A cloud layer in a METAR
+type CloudLayer struct {
+	Cover  string `json:"cover"`             // FEW, SCT, BKN, OVC or OVX (obscured)
+	BaseFt int    `json:"base_ft,omitempty"` // Above ground level
+}
+
+// Decoded METAR observation. Aviation units throughout: knots, statute
+// miles, feet and Celsius.
+type METAR struct {
+	Station        string       `json:"station"`
+	Name           string       `json:"name,omitempty"`
+	Observed       time.Time    `json:"observed"`
+	Raw            string       `json:"raw"`
+	TemperatureC   float64      `json:"temperature_c"`
+	DewpointC      float64      `json:"dewpoint_c"`
+	WindDirection  int          `json:"wind_direction"` // Degrees true, -1 when variable
+	WindKt         int          `json:"wind_kt"`
+	GustKt         int          `json:"gust_kt,omitempty"`
+	VisibilitySM   float64      `json:"visibility_sm"`
+	AltimeterHPa   float64      `json:"altimeter_hpa"`
+	Weather        string       `json:"weather,omitempty"` // Present weather, e.g. "-RA BR"
+	Clouds         []CloudLayer `json:"clouds,omitempty"`
+	CeilingFt      int          `json:"ceiling_ft,omitempty"` // Lowest broken or overcast layer, 0 when unlimited
+	FlightCategory string       `json:"flight_category"`
+	lat, lon       float64
+}
+
+// METAR and TAF for the airport serving a location
+type Aviation struct {
+	METAR      *METAR  `json:"metar"`
+	TAF        string  `json:"taf,omitempty"` // Raw TAF; not every station issues one
+	DistanceKm float64 `json:"distance_km"`   // From the location to the station
+}
+
+// Whether aviation mode is on: the location is tagged "aviation" or a station is pinned
+func (agent *WeatherAgent) aviationEnabled() bool {
+	if agent.config.AviationStation != "" {
+		return true
+	}
+	for _, tag := range agent.config.LocationTags {
+		if strings.EqualFold(strings.TrimSpace(tag), "aviation") {
+			return true
+		}
+	}
+	return false
+}
+
+// Great-circle distance between two points in kilometres
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// Flight category for a ceiling (0 for none) and visibility, per the FAA definitions
+func flightCategory(ceilingFt int, visibilitySM float64) string {
+	ceiling := ceilingFt
+	if ceiling == 0 {
+		ceiling = math.MaxInt32
+	}
+	switch {
+	case ceiling < 500 || visibilitySM < 1:
+		return FlightLIFR
+	case ceiling < 1000 || visibilitySM < 3:
+		return FlightIFR
+	case ceiling <= 3000 || visibilitySM <= 5:
+		return FlightMVFR
+	}
+	return FlightVFR
+}
+
+// Parse aviationweather.gov METAR JSON. Wind direction may be "VRB" and
+// visibility "10+", so both are decoded loosely.
+func parseMETARs(body []byte) ([]METAR, error) {
+	var raw []struct {
+		IcaoID   string          `json:"icaoId"`
+		Name     string          `json:"name"`
+		ObsTime  int64           `json:"obsTime"`
+		RawOb    string          `json:"rawOb"`
+		Temp     float64         `json:"temp"`
+		Dewp     float64         `json:"dewp"`
+		Wdir     json.RawMessage `json:"wdir"`
+		Wspd     int             `json:"wspd"`
+		Wgst     int             `json:"wgst"`
+		Visib    json.RawMessage `json:"visib"`
+		Altim    float64         `json:"altim"`
+		WxString string          `json:"wxString"`
+		Lat      float64         `json:"lat"`
+		Lon      float64         `json:"lon"`
+		Clouds   []struct {
+			Cover string `json:"cover"`
+			Base  *int   `json:"base"`
+		} `json:"clouds"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse METAR response: %v", err)
+	}
+
+	metars := make([]METAR, 0, len(raw))
+	for _, r := range raw {
+		m := METAR{
+			Station:       r.IcaoID,
+			Name:          r.Name,
+			Observed:      time.Unix(r.ObsTime, 0).UTC(),
+			Raw:           r.RawOb,
+			TemperatureC:  r.Temp,
+			DewpointC:     r.Dewp,
+			WindDirection: -1,
+			WindKt:        r.Wspd,
+			GustKt:        r.Wgst,
+			AltimeterHPa:  r.Altim,
+			Weather:       r.WxString,
+			lat:           r.Lat,
+			lon:           r.Lon,
+		}
+		if dir, err := strconv.Atoi(strings.Trim(string(r.Wdir), `"`)); err == nil {
+			m.WindDirection = dir
+		}
+		if vis, err := strconv.ParseFloat(strings.TrimSuffix(strings.Trim(string(r.Visib), `"`), "+"), 64); err == nil {
+			m.VisibilitySM = vis
+		}
+		for _, c := range r.Clouds {
+			layer := CloudLayer{Cover: c.Cover}
+			if c.Base != nil {
+				layer.BaseFt = *c.Base
+			}
+			m.Clouds = append(m.Clouds, layer)
+			if (c.Cover == "BKN" || c.Cover == "OVC" || c.Cover == "OVX") && (m.CeilingFt == 0 || layer.BaseFt < m.CeilingFt) {
+				m.CeilingFt = max(layer.BaseFt, 1) // A layer on the ground is still a ceiling
+			}
+		}
+		m.FlightCategory = flightCategory(m.CeilingFt, m.VisibilitySM)
+		metars = append(metars, m)
+	}
+	return metars, nil
+}
+
+// Latest METAR for a station, or the one nearest the coordinates
+func (agent *WeatherAgent) fetchMETAR(station string, lat, lon float64) (*METAR, error) {
+	query := url.Values{"format": {"json"}}
+	if station != "" {
+		query.Set("ids", station)
+	} else {
+		query.Set("bbox", fmt.Sprintf("%.2f,%.2f,%.2f,%.2f",
+			lat-aviationSearchDegree, lon-aviationSearchDegree, lat+aviationSearchDegree, lon+aviationSearchDegree))
+	}
+
+	body, _, err := agent.cachedGet(aviationWeatherURL+"/metar?"+query.Encode(), aviationCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("METAR request failed: %v", err)
+	}
+	metars, err := parseMETARs(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(metars) == 0 {
+		return nil, fmt.Errorf("no METAR reporting stations found")
+	}
+
+	sort.SliceStable(metars, func(i, j int) bool {
+		return distanceKm(lat, lon, metars[i].lat, metars[i].lon) < distanceKm(lat, lon, metars[j].lat, metars[j].lon)
+	})
+	return &metars[0], nil
+}
+
+// Latest raw TAF for a station, empty when it doesn't issue one
+func (agent *WeatherAgent) fetchTAF(station string) (string, error) {
+	query := url.Values{"format": {"json"}, "ids": {station}}
+	body, _, err := agent.cachedGet(aviationWeatherURL+"/taf?"+query.Encode(), aviationCacheTTL, false)
+	if err != nil {
+		return "", fmt.Errorf("TAF request failed: %v", err)
+	}
+	var tafs []struct {
+		RawTAF string `json:"rawTAF"`
+	}
+	if err := json.Unmarshal(body, &tafs); err != nil {
+		return "", fmt.Errorf("failed to parse TAF response: %v", err)
+	}
+	if len(tafs) == 0 {
+		return "", nil
+	}
+	return tafs[0].RawTAF, nil
+}
+
+// METAR and TAF for the pinned station, or the station nearest the coordinates
+func (agent *WeatherAgent) fetchAviation(station string, lat, lon float64) (*Aviation, error) {
+	metar, err := agent.fetchMETAR(station, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	aviation := &Aviation{METAR: metar}
+	if lat != 0 || lon != 0 {
+		aviation.DistanceKm = math.Round(distanceKm(lat, lon, metar.lat, metar.lon)*10) / 10
+	}
+
+	// A missing TAF still leaves a useful briefing
+	if aviation.TAF, err = agent.fetchTAF(metar.Station); err != nil {
+		agent.logger.Printf("Warning: Failed to fetch TAF for %s: %v", metar.Station, err)
+	}
+	return aviation, nil
+}
+
+// Attach METAR/TAF data to the weather response in aviation mode
+func (agent *WeatherAgent) addAviation(weather *WeatherResponse, lat, lon float64) {
+	if !agent.aviationEnabled() {
+		return
+	}
+
+	aviation, err := agent.fetchAviation(agent.config.AviationStation, lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch aviation weather: %v", err)
+		return
+	}
+	weather.Aviation = aviation
+}
+
+// Wind in METAR style, e.g. "270° at 12 kt gusting 22 kt"
+func (m *METAR) windSummary() string {
+	if m.WindKt == 0 {
+		return "calm"
+	}
+	wind := fmt.Sprintf("%03d° at %d kt", m.WindDirection, m.WindKt)
+	if m.WindDirection < 0 {
+		wind = fmt.Sprintf("variable at %d kt", m.WindKt)
+	}
+	if m.GustKt > 0 {
+		wind += fmt.Sprintf(" gusting %d kt", m.GustKt)
+	}
+	return wind
+}
+
+// Add the decoded aviation fields to the LLM data map
+func addAviationData(aviation *Aviation, data map[string]interface{}) {
+	m := aviation.METAR
+	data["aviation_station"] = m.Station
+	data["metar"] = m.Raw
+	data["flight_category"] = m.FlightCategory
+	data["aviation_wind"] = m.windSummary()
+	data["aviation_visibility"] = fmt.Sprintf("%g SM", m.VisibilitySM)
+	if m.CeilingFt > 0 {
+		data["ceiling"] = fmt.Sprintf("%d ft AGL", m.CeilingFt)
+	} else {
+		data["ceiling"] = "none"
+	}
+	if aviation.TAF != "" {
+		data["taf"] = aviation.TAF
+	}
+}
+
+// GET /api/aviation[?station=KJFK] returns the decoded METAR and TAF for a
+// station, or for the airport nearest the configured location
+func (agent *WeatherAgent) handleAviation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !agent.aviationEnabled() {
+		apiError(w, "Aviation mode is disabled", http.StatusNotFound)
+		return
+	}
+
+	station := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("station")))
+	if station != "" && !icaoPattern.MatchString(station) {
+		apiError(w, "Invalid station (use a 4-character ICAO code)", http.StatusBadRequest)
+		return
+	}
+
+	var lat, lon float64
+	if station == "" {
+		station = agent.config.AviationStation
+		var err error
+		if lat, lon, err = agent.getCoordinates(agent.location()); err != nil {
+			apiError(w, "Unable to resolve location", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	aviation, err := agent.fetchAviation(station, lat, lon)
+	if err != nil {
+		agent.logger.Printf("Error fetching aviation weather: %v", err)
+		apiError(w, "Unable to fetch aviation weather", http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, aviation)
+}
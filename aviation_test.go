@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFlightCategory(t *testing.T) {
+	tests := []struct {
+		ceilingFt    int
+		visibilitySM float64
+		want         string
+	}{
+		{0, 10, FlightVFR},
+		{3500, 6, FlightVFR},
+		{3000, 10, FlightMVFR},
+		{0, 4, FlightMVFR},
+		{800, 10, FlightIFR},
+		{5000, 2, FlightIFR},
+		{400, 10, FlightLIFR},
+		{0, 0.5, FlightLIFR},
+	}
+
+	for _, tt := range tests {
+		if got := flightCategory(tt.ceilingFt, tt.visibilitySM); got != tt.want {
+			t.Errorf("flightCategory(%d, %g) = %s, want %s", tt.ceilingFt, tt.visibilitySM, got, tt.want)
+		}
+	}
+}
+
+func TestParseMETARs(t *testing.T) {
+	body := []byte(`[
+		{"icaoId":"KJFK","name":"New York/JF Kennedy Intl, NY, US","obsTime":1760702760,
+		 "rawOb":"KJFK 171151Z VRB04KT 2SM -RA BR FEW008 BKN015 OVC030 14/13 A2992",
+		 "temp":14.4,"dewp":13.3,"wdir":"VRB","wspd":4,"visib":2,"altim":1013.2,"wxString":"-RA BR",
+		 "lat":40.639,"lon":-73.762,
+		 "clouds":[{"cover":"FEW","base":800},{"cover":"BKN","base":1500},{"cover":"OVC","base":3000}]},
+		{"icaoId":"KLGA","obsTime":1760702760,"rawOb":"KLGA 171151Z 27012G22KT 10SM CLR 18/05 A3001",
+		 "temp":18,"dewp":5,"wdir":270,"wspd":12,"wgst":22,"visib":"10+","altim":1016.3,
+		 "lat":40.779,"lon":-73.880,"clouds":[{"cover":"CLR"}]}
+	]`)
+
+	metars, err := parseMETARs(body)
+	if err != nil {
+		t.Fatalf("parseMETARs() error = %v", err)
+	}
+	if len(metars) != 2 {
+		t.Fatalf("got %d METARs, want 2", len(metars))
+	}
+
+	jfk := metars[0]
+	if jfk.WindDirection != -1 || jfk.WindKt != 4 {
+		t.Errorf("KJFK wind = %d° %d kt, want variable 4 kt", jfk.WindDirection, jfk.WindKt)
+	}
+	if jfk.CeilingFt != 1500 || jfk.FlightCategory != FlightIFR {
+		t.Errorf("KJFK ceiling %d ft, category %s; want 1500 ft, IFR", jfk.CeilingFt, jfk.FlightCategory)
+	}
+	if got := jfk.windSummary(); got != "variable at 4 kt" {
+		t.Errorf("KJFK windSummary() = %q", got)
+	}
+
+	lga := metars[1]
+	if lga.VisibilitySM != 10 || lga.CeilingFt != 0 || lga.FlightCategory != FlightVFR {
+		t.Errorf("KLGA visibility %g SM, ceiling %d ft, category %s; want 10 SM, none, VFR",
+			lga.VisibilitySM, lga.CeilingFt, lga.FlightCategory)
+	}
+	if got := lga.windSummary(); got != "270° at 12 kt gusting 22 kt" {
+		t.Errorf("KLGA windSummary() = %q", got)
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// London Heathrow to New York JFK is about 5540 km
+	if got := distanceKm(51.4700, -0.4543, 40.6413, -73.7781); got < 5500 || got > 5580 {
+		t.Errorf("distanceKm(LHR, JFK) = %.0f, want ~5540", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned instead of calling a provider whose breaker is open
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Calls go through
+	BreakerOpen     = "open"      // Calls are refused until the cooldown passes
+	BreakerHalfOpen = "half-open" // One trial call decides whether to close again
+)
+
+// Stops calling an upstream provider after repeated failures, letting a
+// single trial call through once the cooldown has passed. A nil breaker
+// allows every call.
+type circuitBreaker struct {
+	name      string
+	threshold int           // Consecutive failures that open the breaker
+	cooldown  time.Duration // How long the breaker stays open before a trial call
+	logf      func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial call is in flight
+}
+
+// Whether a call may go ahead now
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		// Only the first caller after the cooldown gets to try
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// Record a successful call, closing the breaker
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed && b.logf != nil {
+		b.logf("Circuit breaker for %s closed, provider recovered", b.name)
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// Record a failed call, opening the breaker at the threshold or when a trial fails
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen && b.logf != nil {
+			b.logf("Circuit breaker for %s opened after %d consecutive failures", b.name, b.failures)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Whether calls are currently being refused
+func (b *circuitBreaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+// Breakers for each upstream provider, created on first use. A nil set
+// hands out nil breakers, so nothing is ever refused.
+type breakerSet struct {
+	threshold int
+	cooldown  time.Duration
+	logf      func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// Create the breakers, or nil when threshold is 0 (disabled)
+func newBreakerSet(threshold int, cooldown time.Duration, logf func(format string, args ...interface{})) *breakerSet {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breakerSet{threshold: threshold, cooldown: cooldown, logf: logf, breakers: make(map[string]*circuitBreaker)}
+}
+
+// The breaker for a provider
+func (s *breakerSet) get(name string) *circuitBreaker {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[name]
+	if !ok {
+		b = &circuitBreaker{name: name, threshold: s.threshold, cooldown: s.cooldown, logf: s.logf, state: BreakerClosed}
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// Flag a response's weather data with the sources that are stale or missing
+// because a provider is down: "weather", "air_quality" or "message"
+func (agent *WeatherAgent) markDegraded(weather WeatherResponse, data map[string]interface{}) {
+	sources := append([]string(nil), weather.Degraded...)
+	if agent.breakers.get("llm").isOpen() {
+		sources = append(sources, "message")
+	}
+	if len(sources) > 0 {
+		data["degraded"] = sources
+	}
+}
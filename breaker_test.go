@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newBreakerSet(2, time.Hour, nil).get("open-meteo")
+
+	b.failure()
+	if !b.allow() || b.isOpen() {
+		t.Fatal("breaker opened before reaching the threshold")
+	}
+	b.failure()
+	if b.allow() || !b.isOpen() {
+		t.Fatal("breaker should be open after two consecutive failures")
+	}
+
+	// After the cooldown a single trial call is let through
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if !b.allow() {
+		t.Fatal("trial call refused after the cooldown")
+	}
+	if b.allow() {
+		t.Error("second call allowed while the trial is in flight")
+	}
+
+	// A failed trial reopens the breaker, a successful one closes it
+	b.failure()
+	if !b.isOpen() {
+		t.Error("failed trial should reopen the breaker")
+	}
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.allow()
+	b.success()
+	if b.state != BreakerClosed || !b.allow() {
+		t.Errorf("successful trial left the breaker %s", b.state)
+	}
+
+	// Disabled breakers allow everything
+	var disabled *circuitBreaker
+	disabled.failure()
+	if !disabled.allow() || disabled.isOpen() {
+		t.Error("nil breaker refused a call")
+	}
+}
+
+func TestCachedGetServesStaleWhenProviderDown(t *testing.T) {
+	healthy := true
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !healthy {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "response %d", hits)
+	}))
+	defer server.Close()
+
+	logger := log.New(io.Discard, "", 0)
+	agent := &WeatherAgent{logger: logger, cache: newMemoryCache(), breakers: newBreakerSet(2, time.Hour, logger.Printf)}
+
+	if body, stale, err := agent.cachedGet(server.URL, 0, false); err != nil || stale || string(body) != "response 1" {
+		t.Fatalf("healthy fetch = %q, stale %t, %v", body, stale, err)
+	}
+
+	healthy = false
+	for i := 0; i < 3; i++ {
+		body, stale, err := agent.cachedGet(server.URL, 0, false)
+		if err != nil || !stale || string(body) != "response 1" {
+			t.Fatalf("fetch %d while down = %q, stale %t, %v", i, body, stale, err)
+		}
+	}
+	// The third call is answered by the open breaker without reaching the provider
+	if hits != 3 {
+		t.Errorf("provider hit %d times, want 3", hits)
+	}
+
+	// Without a good response to fall back on the error is returned
+	if _, _, err := agent.cachedGet(server.URL+"/other", 0, false); err == nil {
+		t.Error("expected an error with no stale response")
+	}
+}
+
+func TestMarkDegraded(t *testing.T) {
+	agent := &WeatherAgent{breakers: newBreakerSet(1, time.Hour, nil)}
+
+	data := map[string]interface{}{}
+	agent.markDegraded(WeatherResponse{}, data)
+	if _, ok := data["degraded"]; ok {
+		t.Errorf("healthy reading flagged degraded: %v", data)
+	}
+
+	agent.breakers.get("llm").failure()
+	agent.markDegraded(WeatherResponse{Degraded: []string{"weather"}}, data)
+	if want := []string{"weather", "message"}; !reflect.DeepEqual(data["degraded"], want) {
+		t.Errorf("degraded = %v, want %v", data["degraded"], want)
+	}
+}
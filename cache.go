@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key prefix for everything the agent stores in the cache backend
+const cacheKeyPrefix = "weather-agent:"
+
+// User-Agent identifying the agent to upstream providers
+const upstreamUserAgent = "WeatherAgent/1.0 (+https://github.com/joshkenney/weather-agent)"
+
+// Storage for cached upstream responses and shared agent state. The
+// in-memory store serves a single instance; Redis lets several replicas
+// behind a load balancer share the same data.
+type cacheStore interface {
+	// Get returns the value for key and whether it was found
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key. A zero ttl keeps the value until overwritten.
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// Create the cache backend: Redis when a URL is configured, memory otherwise
+func newCacheStore(redisURL string) (cacheStore, error) {
+	if redisURL == "" {
+		return newMemoryCache(), nil
+	}
+	return newRedisCache(redisURL)
+}
+
+type memoryCacheEntry struct {
+	value   []byte
+	expires time.Time // Zero means no expiry
+}
+
+// Most entries the in-memory store holds. Expiring entries are dropped,
+// soonest to expire first, to make room; ones without a ttl are agent state
+// and always kept.
+const memoryCacheMaxEntries = 10000
+
+// Process-local cache store
+type memoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]memoryCacheEntry
+	maxEntries int
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]memoryCacheEntry), maxEntries: memoryCacheMaxEntries}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	entry := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.prune(now)
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+// Remove expired entries, then the ones closest to expiring until there's
+// room for another. Callers must hold c.mu.
+func (c *memoryCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) >= c.maxEntries {
+		soonest := ""
+		for key, entry := range c.entries {
+			if !entry.expires.IsZero() && (soonest == "" || entry.expires.Before(c.entries[soonest].expires)) {
+				soonest = key
+			}
+		}
+		if soonest == "" {
+			return
+		}
+		delete(c.entries, soonest)
+	}
+}
+
+// Redis connections kept open for reuse, and the most open at once
+const (
+	redisIdleConns = 4
+	redisMaxConns  = 16
+	redisTimeout   = 3 * time.Second // Per command, including the dial
+)
+
+// Minimal Redis client speaking RESP, enough for GET/SET, over a small pool
+// of connections so one slow command doesn't hold up every other request
+type redisCache struct {
+	addr     string
+	username string // ACL user (Redis 6+); empty authenticates as the default user
+	password string
+	db       int
+	tls      *tls.Config // Set for rediss:// URLs
+
+	slots chan struct{}   // Held by each connection in use
+	idle  chan *redisConn // Connections ready for reuse
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Parse a redis[s]://[[username]:password@]host[:port][/db] URL
+func newRedisCache(rawURL string) (*redisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme %q", u.Scheme)
+	}
+
+	c := &redisCache{
+		addr:  u.Host,
+		slots: make(chan struct{}, redisMaxConns),
+		idle:  make(chan *redisConn, redisIdleConns),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		c.db, err = strconv.Atoi(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	return c, nil
+}
+
+// Open and authenticate a connection
+func (c *redisCache) connect() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis connect failed: %v", err)
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if c.password != "" {
+		auth := []string{"AUTH", c.password}
+		if c.username != "" {
+			auth = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := rc.roundTrip(auth...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.roundTrip("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// Return a healthy connection to the pool, closing it if the pool is full
+func (c *redisCache) put(rc *redisConn) {
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// Send a command and read its reply on a pooled connection. A network
+// error closes the connection and the command is retried once on a new one,
+// as an idle connection may have been dropped by the server.
+func (c *redisCache) do(args ...string) (interface{}, error) {
+	c.slots <- struct{}{} // Blocks while redisMaxConns commands are running
+	defer func() { <-c.slots }()
+
+	// Reuse an idle connection, or open one
+	var rc *redisConn
+	select {
+	case rc = <-c.idle:
+	default:
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if rc == nil {
+			var err error
+			if rc, err = c.connect(); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := rc.roundTrip(args...)
+		if err == nil {
+			c.put(rc)
+			return reply, nil
+		}
+		if _, isReplyErr := err.(redisError); isReplyErr {
+			c.put(rc)
+			return nil, err
+		}
+		// Network error: drop the connection and retry once
+		rc.conn.Close()
+		rc = nil
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// An error reply from the Redis server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) roundTrip(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(c.reader)
+}
+
+// Read a single RESP reply. Bulk strings are returned as []byte, with nil for a null reply.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+// How long the last good upstream response is kept to serve while a provider is down
+const staleTTL = 24 * time.Hour
+
+// Fetch an upstream URL, serving a cached body when one is fresh unless
+// refresh is set. Only successful responses are cached. When the provider
+// fails or its circuit breaker is open, the last good response is served
+// instead and stale is set.
+func (agent *WeatherAgent) cachedGet(requestURL string, ttl time.Duration, refresh bool) ([]byte, bool, error) {
+	return agent.cachedGetWithHeader(requestURL, nil, ttl, refresh)
+}
+
+// cachedGet for providers that authenticate with request headers. The
+// headers are not part of the cache key.
+func (agent *WeatherAgent) cachedGetWithHeader(requestURL string, header http.Header, ttl time.Duration, refresh bool) ([]byte, bool, error) {
+	// API keys in the URL stay out of the key names, which Redis users can list
+	key := cacheKeyPrefix + "upstream:" + redactURL(requestURL, agent.secrets)
+	if ttl > 0 && !refresh {
+		if body, ok, err := agent.cache.Get(key); err != nil {
+			agent.logger.Printf("Cache read failed, fetching upstream: %v", err)
+		} else if ok {
+			return body, false, nil
+		}
+	}
+
+	breaker := agent.breakers.get(providerForURL(requestURL))
+	if !breaker.allow() {
+		return agent.staleGet(key, errCircuitOpen)
+	}
+
+	body, status, err := agent.inflight.do(requestURL, func() ([]byte, int, error) {
+		return agent.upstreamGet(requestURL, header)
+	})
+	if err != nil {
+		// Client errors say nothing about the provider's health
+		if status == 0 || status >= 500 || status == http.StatusTooManyRequests {
+			breaker.failure()
+		}
+		return agent.staleGet(key, err)
+	}
+	breaker.success()
+
+	if ttl > 0 {
+		if err := agent.cache.Set(key, body, ttl); err != nil {
+			agent.logger.Printf("Cache write failed: %v", err)
+		}
+	}
+	if err := agent.cache.Set(key+":stale", body, staleTTL); err != nil {
+		agent.logger.Printf("Cache write failed: %v", err)
+	}
+	return body, false, nil
+}
+
+// GET an upstream URL with optional extra headers, returning the body of a
+// 200 response. The status is 0 when no response was received.
+func (agent *WeatherAgent) upstreamGet(requestURL string, header http.Header) ([]byte, int, error) {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	// Some providers (e.g. api.weather.gov) refuse requests without an identifying User-Agent
+	req.Header.Set("User-Agent", upstreamUserAgent)
+
+	resp, err := agent.httpClient(0).Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	agent.archiveResponse(providerForURL(requestURL), requestURL, resp.StatusCode, body)
+	if resp.StatusCode != 200 {
+		return nil, resp.StatusCode, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return body, resp.StatusCode, nil
+}
+
+// The last good response for a cache key, or fetchErr if there is none
+func (agent *WeatherAgent) staleGet(key string, fetchErr error) ([]byte, bool, error) {
+	body, ok, err := agent.cache.Get(key + ":stale")
+	if err != nil || !ok {
+		return nil, false, fetchErr
+	}
+	agent.logger.Printf("Upstream unavailable (%v), serving stale response", fetchErr)
+	return body, true, nil
+}
+
+// Most recent LLM message for a location, shared between replicas through the cache backend
+type lastMessageState struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Recent  []string  `json:"recent,omitempty"` // Rolling window of messages, newest last
+}
+
+// The location's recent messages, oldest first
+func (s lastMessageState) recentMessages() []string {
+	if len(s.Recent) == 0 && s.Message != "" {
+		// Saved before the window was kept
+		return []string{s.Message}
+	}
+	return s.Recent
+}
+
+// Cache key of the last message for a location
+func lastMessageKey(location string) string {
+	return cacheKeyPrefix + "last_message:" + location
+}
+
+// Get the most recently generated message for a location
+func (agent *WeatherAgent) lastMessage(location string) lastMessageState {
+	var state lastMessageState
+	data, ok, err := agent.cache.Get(lastMessageKey(location))
+	if err != nil {
+		agent.logger.Printf("Error reading last message: %v", err)
+		return state
+	}
+	if ok {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// Record the most recently generated message for a location, keeping the
+// last few for duplicate checks
+func (agent *WeatherAgent) setLastMessage(location, message string) {
+	recent := append(agent.lastMessage(location).recentMessages(), message)
+	if window := max(agent.config.RecentMessages, 1); len(recent) > window {
+		recent = recent[len(recent)-window:]
+	}
+	data, _ := json.Marshal(lastMessageState{Message: message, Time: time.Now(), Recent: recent})
+	if err := agent.cache.Set(lastMessageKey(location), data, 0); err != nil {
+		agent.logger.Printf("Error saving last message: %v", err)
+	}
+}
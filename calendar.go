@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Days in the calendar feed unless ?days= asks for another number
+const defaultCalendarDays = 7
+
+// How often calendar apps are asked to re-fetch the feed
+const calendarRefreshInterval = "PT6H"
+
+// A place in the calendar feed
+type calendarLocation struct {
+	City    string
+	Country string
+	Days    []ForecastDay
+}
+
+// Escape text for an iCalendar property value (RFC 5545 3.3.11)
+func icsEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// Write a content line, folded at 75 octets without splitting UTF-8 characters
+func writeICSLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// Render the locations' forecasts as an iCalendar feed of all-day events
+func renderCalendar(locations []calendarLocation, tempUnit string, now time.Time) string {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) { writeICSLine(&b, fmt.Sprintf(format, args...)) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//weather-agent//Daily forecast//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Weather forecast")
+	line("REFRESH-INTERVAL;VALUE=DURATION:%s", calendarRefreshInterval)
+	line("X-PUBLISHED-TTL:%s", calendarRefreshInterval)
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, location := range locations {
+		key := locationKey(location.City, location.Country)
+		for _, day := range location.Days {
+			date, err := time.Parse("2006-01-02", day.Date)
+			if err != nil {
+				continue
+			}
+			summary := fmt.Sprintf("%s: %s %.0f%s/%.0f%s", location.City, day.Condition, day.TempMax, tempUnit, day.TempMin, tempUnit)
+			description := fmt.Sprintf("%s\nHigh %.0f%s, low %.0f%s\n%d%% chance of precipitation\nSunrise %s, sunset %s",
+				day.Description, day.TempMax, tempUnit, day.TempMin, tempUnit, day.PrecipitationProbability, day.Sunrise, day.Sunset)
+
+			line("BEGIN:VEVENT")
+			line("UID:%s-%s@weather-agent", date.Format("20060102"), strings.NewReplacer(" ", "-", "|", "-").Replace(key))
+			line("DTSTAMP:%s", stamp)
+			line("DTSTART;VALUE=DATE:%s", date.Format("20060102"))
+			line("DTEND;VALUE=DATE:%s", date.AddDate(0, 0, 1).Format("20060102"))
+			line("SUMMARY:%s", icsEscape(summary))
+			line("DESCRIPTION:%s", icsEscape(description))
+			line("TRANSP:TRANSPARENT") // Don't show as busy
+			line("END:VEVENT")
+		}
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// Places in the feed: CALENDAR_LOCATIONS, or the configured city
+func (agent *WeatherAgent) calendarPlaces() []string {
+	if len(agent.config.CalendarLocations) > 0 {
+		return agent.config.CalendarLocations
+	}
+	city, country := agent.location()
+	place := city
+	if country != "" {
+		place += "," + country
+	}
+	return []string{place}
+}
+
+// GET /calendar.ics[?days=7] serves the daily forecasts as a calendar feed
+func (agent *WeatherAgent) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultCalendarDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 1 || days > maxForecastDays {
+			apiError(w, fmt.Sprintf("Invalid days parameter (1-%d)", maxForecastDays), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch the places concurrently, keeping them in the configured order
+	places := agent.calendarPlaces()
+	fetched := make([]*calendarLocation, len(places))
+	forEachLimit(len(places), agent.config.FetchConcurrency, func(i int) {
+		city, country := parsePlace(places[i])
+		lat, lon, err := agent.getCoordinates(city, country)
+		if err != nil {
+			agent.logger.Printf("Skipping %s in the calendar feed: %v", city, err)
+			return
+		}
+		forecast, err := agent.fetchForecast(lat, lon, days)
+		if err != nil {
+			agent.logger.Printf("Skipping %s in the calendar feed: %v", city, err)
+			return
+		}
+		fetched[i] = &calendarLocation{City: city, Country: country, Days: forecast.Days}
+	})
+	var locations []calendarLocation
+	for _, location := range fetched {
+		if location != nil {
+			locations = append(locations, *location)
+		}
+	}
+	if len(locations) == 0 {
+		apiError(w, "Unable to fetch forecast", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="weather.ics"`)
+	fmt.Fprint(w, renderCalendar(locations, agent.getTempUnit(), time.Now()))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderCalendar(t *testing.T) {
+	now := time.Date(2024, 6, 10, 6, 30, 0, 0, time.UTC)
+	ics := renderCalendar([]calendarLocation{{
+		City:    "Oslo",
+		Country: "NO",
+		Days: []ForecastDay{{
+			Date: "2024-06-10", TempMax: 18.4, TempMin: 9.6, Condition: "Rain", Description: "light rain",
+			PrecipitationProbability: 80, Sunrise: "3:55 AM", Sunset: "10:39 PM",
+		}},
+	}}, "°C", now)
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:20240610-oslo-no@weather-agent\r\n",
+		"DTSTAMP:20240610T063000Z\r\n",
+		"DTSTART;VALUE=DATE:20240610\r\n",
+		"DTEND;VALUE=DATE:20240611\r\n",
+		"SUMMARY:Oslo: Rain 18°C/10°C\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar missing %q:\n%s", want, ics)
+		}
+	}
+
+	// Unfold the description and check it was escaped
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:light rain\nHigh 18°C\, low 10°C\n80% chance of precipitation\nSunrise 3:55 AM\, sunset 10:39 PM`) {
+		t.Errorf("unexpected description in:\n%s", unfolded)
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+}
+
+func TestWriteICSLineFoldsOnCharacterBoundaries(t *testing.T) {
+	var b strings.Builder
+	writeICSLine(&b, "SUMMARY:"+strings.Repeat("°", 100))
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 || !strings.HasPrefix(strings.TrimPrefix(line, " "), "SUMMARY:") && !strings.HasPrefix(line, " °") {
+			t.Errorf("bad folded line %q", line)
+		}
+	}
+}
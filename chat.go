@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Maximum length of a chat question accepted from users
+const maxChatMessageLength = 1000
+
+// Answer a free-form question about the current weather using the LLM,
+// in language if given (e.g. "de" from the user's profile)
+func (agent *WeatherAgent) chat(weather WeatherResponse, question, language string, params llmParams) (string, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", fmt.Errorf("message is required")
+	}
+	if len(question) > maxChatMessageLength {
+		return "", fmt.Errorf("message is too long (max %d characters)", maxChatMessageLength)
+	}
+
+	weatherData := agent.prepareWeatherData(weather)
+
+	// Sort keys so the prompt is stable between calls
+	keys := make([]string, 0, len(weatherData))
+	for key := range weatherData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var prompt strings.Builder
+	prompt.WriteString("Current Weather Data:\n")
+	for _, key := range keys {
+		prompt.WriteString(fmt.Sprintf("%s: %v\n", key, weatherData[key]))
+	}
+	prompt.WriteString("\nA user has asked the following question about the weather. ")
+	prompt.WriteString("Answer it concisely using only the data above; say so if the data doesn't cover it.\n\n")
+	if language != "" {
+		prompt.WriteString(fmt.Sprintf("Answer in %s.\n\n", languageName(language)))
+	}
+	prompt.WriteString("Question: ")
+	prompt.WriteString(question)
+
+	return agent.callLLMWith(agent.config.Persona, prompt.String(), params)
+}
+
+// Completes a prompt with an LLM. Implemented by the Anthropic and OpenAI
+// API clients; tests substitute a fake.
+type llmProvider interface {
+	complete(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error)
+}
+
+// Adapts a function to llmProvider
+type llmProviderFunc func(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error)
+
+func (f llmProviderFunc) complete(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	return f(systemPrompt, userMessage, params)
+}
+
+// The LLM to call: the injected provider if set, otherwise the configured API
+func (agent *WeatherAgent) llmClient() (llmProvider, error) {
+	if agent.llm != nil {
+		return agent.llm, nil
+	}
+	switch strings.ToLower(agent.config.LLMProvider) {
+	case "anthropic":
+		return llmProviderFunc(agent.callAnthropicAPI), nil
+	case "openai":
+		return llmProviderFunc(agent.callOpenAIAPI), nil
+	case "mistral":
+		return llmProviderFunc(agent.callMistralAPI), nil
+	case "cohere":
+		return llmProviderFunc(agent.callCohereAPI), nil
+	}
+	return nil, fmt.Errorf("unsupported LLM provider: %s", agent.config.LLMProvider)
+}
+
+// Call the configured LLM provider with a user message in the deployment's persona
+func (agent *WeatherAgent) callLLM(userMessage string) (string, error) {
+	return agent.callLLMAs(agent.config.Persona, userMessage)
+}
+
+// Call the configured LLM provider with a user message in the given persona
+func (agent *WeatherAgent) callLLMAs(persona, userMessage string) (string, error) {
+	return agent.callLLMWith(persona, userMessage, agent.llmParams())
+}
+
+// Call the configured LLM provider with a user message in the given persona
+// and sampling settings, recording token usage and passing the reply through
+// the medical guardrail. Returns errNoLLMKey without an API key,
+// errLLMBudgetExceeded once the daily budget is spent, and errCircuitOpen
+// while the provider's breaker is open, without calling out.
+func (agent *WeatherAgent) callLLMWith(persona, userMessage string, params llmParams) (string, error) {
+	if !agent.llmConfigured() {
+		return "", errNoLLMKey
+	}
+	if agent.overBudget() {
+		return "", errLLMBudgetExceeded
+	}
+	breaker := agent.breakers.get("llm")
+	if !breaker.allow() {
+		return "", errCircuitOpen
+	}
+	systemPrompt := agent.systemPrompt(persona)
+
+	provider, err := agent.llmClient()
+	if err != nil {
+		return "", err
+	}
+	started := time.Now()
+	message, usage, err := provider.complete(systemPrompt, userMessage, params)
+	agent.logPrompt(PromptRecord{
+		Model:        params.Model,
+		SystemPrompt: systemPrompt,
+		UserMessage:  userMessage,
+		Response:     message,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+	}, started, err)
+	if usage.InputTokens > 0 || usage.OutputTokens > 0 {
+		agent.recordLLMUsage(usage)
+	}
+	if err != nil {
+		breaker.failure()
+		return "", err
+	}
+	breaker.success()
+	return agent.guardLLMOutput(message), nil
+}
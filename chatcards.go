@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// A label and value shown on a chat card
+type cardFact struct {
+	Label string
+	Value string
+}
+
+// Current conditions from the prepared weather data, skipping missing values
+func currentConditionFacts(data map[string]interface{}) []cardFact {
+	if len(data) == 0 {
+		return nil
+	}
+	var facts []cardFact
+	add := func(label, format string, keys ...string) {
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			value, ok := data[key]
+			if !ok || value == nil || value == "" {
+				return
+			}
+			values[i] = value
+		}
+		facts = append(facts, cardFact{label, fmt.Sprintf(format, values...)})
+	}
+	add("Temperature", "%v (feels like %v)", "temperature", "feels_like")
+	add("Conditions", "%v", "description")
+	add("Humidity", "%v%%", "humidity")
+	add("Wind", "%v %v", "wind_speed", "wind_direction_text")
+	add("Air quality", "%v (%v)", "aqi", "aqi_description")
+	return facts
+}
+
+// One line per forecast day
+func forecastFacts(days []ForecastDay, units string) []cardFact {
+	unit := unitSymbol(units)
+	facts := make([]cardFact, 0, len(days))
+	for _, day := range days {
+		facts = append(facts, cardFact{day.Date, fmt.Sprintf("%s, high %.0f%s, low %.0f%s, %d%% chance of precipitation",
+			day.Description, day.TempMax, unit, day.TempMin, unit, day.PrecipitationProbability)})
+	}
+	return facts
+}
+
+// Where the notification is about, e.g. "Oslo, NO"
+func cardSubtitle(n Notification) string {
+	if n.Country == "" {
+		return n.City
+	}
+	return n.City + ", " + n.Country
+}
+
+// Check that an incoming webhook URL is absolute https
+func validCardWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("incoming webhook URL must be an absolute https URL")
+	}
+	return nil
+}
+
+// POST a card payload to an incoming webhook. The URL carries the webhook's
+// secret, so it is kept out of errors.
+func postCard(client *http.Client, webhookURL, service string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s request failed", service)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s webhook error (status %d): %s", service, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// Notifier that posts the morning briefing to a Google Chat space as a card
+type googleChatNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newGoogleChatNotifier(webhookURL string) (*googleChatNotifier, error) {
+	if err := validCardWebhookURL(webhookURL); err != nil {
+		return nil, fmt.Errorf("Google Chat %v", err)
+	}
+	return &googleChatNotifier{url: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (g *googleChatNotifier) Channel() string {
+	return ChannelGoogleChat
+}
+
+func (g *googleChatNotifier) Target() string {
+	return "Google Chat space"
+}
+
+// Only the daily digest is posted
+func (g *googleChatNotifier) wants(notificationType string) bool {
+	return notificationType == NotificationDigest
+}
+
+// A cardsV2 message for Google Chat
+func googleChatCard(n Notification) map[string]interface{} {
+	type widget = map[string]interface{}
+	factWidgets := func(facts []cardFact) []widget {
+		widgets := make([]widget, 0, len(facts))
+		for _, fact := range facts {
+			widgets = append(widgets, widget{"decoratedText": widget{
+				"topLabel": html.EscapeString(fact.Label),
+				"text":     html.EscapeString(fact.Value),
+				"wrapText": true,
+			}})
+		}
+		return widgets
+	}
+
+	sections := []widget{{"widgets": []widget{{"textParagraph": widget{"text": html.EscapeString(n.Message)}}}}}
+	if facts := currentConditionFacts(n.Data); len(facts) > 0 {
+		sections = append(sections, widget{"header": "Current conditions", "widgets": factWidgets(facts)})
+	}
+	if len(n.Forecast) > 0 {
+		sections = append(sections, widget{"header": "Forecast", "widgets": factWidgets(forecastFacts(n.Forecast, n.Units))})
+	}
+
+	return map[string]interface{}{
+		"text": n.Title, // Shown in notifications and clients without card support
+		"cardsV2": []widget{{
+			"cardId": "weather-" + n.MessageID,
+			"card": widget{
+				"header":   widget{"title": n.Title, "subtitle": cardSubtitle(n)},
+				"sections": sections,
+			},
+		}},
+	}
+}
+
+func (g *googleChatNotifier) Notify(n Notification) error {
+	return postCard(g.client, g.url, "Google Chat", googleChatCard(n))
+}
+
+// Notifier that posts the morning briefing to a Microsoft Teams channel as an
+// Adaptive Card
+type teamsNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newTeamsNotifier(webhookURL string) (*teamsNotifier, error) {
+	if err := validCardWebhookURL(webhookURL); err != nil {
+		return nil, fmt.Errorf("Teams %v", err)
+	}
+	return &teamsNotifier{url: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (t *teamsNotifier) Channel() string {
+	return ChannelTeams
+}
+
+func (t *teamsNotifier) Target() string {
+	return "Teams channel"
+}
+
+// Only the daily digest is posted
+func (t *teamsNotifier) wants(notificationType string) bool {
+	return notificationType == NotificationDigest
+}
+
+// An Adaptive Card message for a Teams incoming webhook
+func teamsCard(n Notification) map[string]interface{} {
+	type element = map[string]interface{}
+	factSet := func(facts []cardFact) element {
+		items := make([]element, 0, len(facts))
+		for _, fact := range facts {
+			items = append(items, element{"title": fact.Label, "value": fact.Value})
+		}
+		return element{"type": "FactSet", "facts": items, "separator": true}
+	}
+
+	body := []element{
+		{"type": "TextBlock", "text": n.Title, "weight": "Bolder", "size": "Medium", "wrap": true},
+		{"type": "TextBlock", "text": cardSubtitle(n), "isSubtle": true, "spacing": "None"},
+		{"type": "TextBlock", "text": n.Message, "wrap": true},
+	}
+	if facts := currentConditionFacts(n.Data); len(facts) > 0 {
+		body = append(body, factSet(facts))
+	}
+	if len(n.Forecast) > 0 {
+		body = append(body,
+			element{"type": "TextBlock", "text": "Forecast", "weight": "Bolder", "separator": true},
+			factSet(forecastFacts(n.Forecast, n.Units)))
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []element{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": element{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+func (t *teamsNotifier) Notify(n Notification) error {
+	return postCard(t.client, t.url, "Teams", teamsCard(n))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testCardNotification() Notification {
+	return Notification{
+		MessageID: "msg-1",
+		Type:      NotificationDigest,
+		Title:     "Good morning, Oslo",
+		Message:   "Sunny & warm <today>.",
+		City:      "Oslo",
+		Country:   "NO",
+		Units:     "metric",
+		Data: map[string]interface{}{
+			"temperature": "18.2°C", "feels_like": "17.9°C", "description": "clear sky", "humidity": 52,
+			"wind_speed": "3.1 km/h", "wind_direction_text": "NW",
+		},
+		Forecast: []ForecastDay{{Date: "2024-06-15", Description: "clear sky", TempMax: 21.4, TempMin: 11.6, PrecipitationProbability: 10}},
+	}
+}
+
+func TestCurrentConditionFacts(t *testing.T) {
+	facts := currentConditionFacts(testCardNotification().Data)
+	want := []cardFact{
+		{"Temperature", "18.2°C (feels like 17.9°C)"},
+		{"Conditions", "clear sky"},
+		{"Humidity", "52%"},
+		{"Wind", "3.1 km/h NW"},
+	}
+	if len(facts) != len(want) {
+		t.Fatalf("facts = %v, want %v", facts, want)
+	}
+	for i := range want {
+		if facts[i] != want[i] {
+			t.Errorf("fact %d = %v, want %v", i, facts[i], want[i])
+		}
+	}
+	if facts := currentConditionFacts(nil); facts != nil {
+		t.Errorf("facts without data = %v", facts)
+	}
+}
+
+func TestChatCardNotifiers(t *testing.T) {
+	var bodies []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if strings.Contains(r.URL.RawQuery, "key=revoked") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "{}")
+	}))
+	defer server.Close()
+
+	googleChat, err := newGoogleChatNotifier(server.URL + "/v1/spaces/AAA/messages?key=k&token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	googleChat.client = server.Client()
+	teams, err := newTeamsNotifier(server.URL + "/webhookb2/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teams.client = server.Client()
+
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		notifiers:  []Notifier{googleChat, teams},
+	}
+	agent.notify(testCardNotification())
+	agent.notify(Notification{Type: NotificationUpdate, Message: "Clouds rolling in."})
+
+	if len(bodies) != 2 {
+		t.Fatalf("got %d requests, want 2 (updates are skipped)", len(bodies))
+	}
+
+	var chat struct {
+		Text    string `json:"text"`
+		CardsV2 []struct {
+			Card struct {
+				Header   struct{ Title, Subtitle string }
+				Sections []struct {
+					Header  string
+					Widgets []map[string]map[string]interface{}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &chat); err != nil || len(chat.CardsV2) != 1 {
+		t.Fatalf("Google Chat body %s: %v", bodies[0], err)
+	}
+	card := chat.CardsV2[0].Card
+	if card.Header.Title != "Good morning, Oslo" || card.Header.Subtitle != "Oslo, NO" || len(card.Sections) != 3 {
+		t.Errorf("Google Chat card = %+v", card)
+	} else if text := card.Sections[0].Widgets[0]["textParagraph"]["text"]; text != "Sunny &amp; warm &lt;today&gt;." {
+		t.Errorf("Google Chat message = %q, want HTML-escaped", text)
+	}
+
+	var message struct {
+		Type        string
+		Attachments []struct {
+			ContentType string
+			Content     struct {
+				Type string
+				Body []map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(bodies[1]), &message); err != nil || len(message.Attachments) != 1 {
+		t.Fatalf("Teams body %s: %v", bodies[1], err)
+	}
+	content := message.Attachments[0].Content
+	if message.Type != "message" || message.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" || content.Type != "AdaptiveCard" {
+		t.Errorf("Teams message = %+v", message)
+	}
+	if len(content.Body) != 6 || content.Body[2]["text"] != "Sunny & warm <today>." {
+		t.Errorf("Teams card body = %v", content.Body)
+	}
+
+	revoked, _ := newGoogleChatNotifier(server.URL + "/v1/spaces/AAA/messages?key=revoked&token=secret")
+	revoked.client = server.Client()
+	err = revoked.Notify(testCardNotification())
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Notify() error = %v, want an error without the webhook token", err)
+	}
+
+	if _, err := newTeamsNotifier("http://example.com/webhook"); err == nil {
+		t.Error("newTeamsNotifier() accepted a plain http URL")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Climate normal settings
+const (
+	climateNormalStart = 1991 // WMO standard 30-year reference period
+	climateNormalEnd   = 2020
+	climateWindowDays  = 7 // Days either side of the date pooled into the normal
+	climateNormalTTL   = 30 * 24 * time.Hour
+	climateTodayTTL    = time.Hour
+)
+
+// How today's high compares to the same time of year
+type ClimateNormals struct {
+	Period         string  `json:"period"` // E.g. "1991-2020"
+	Date           string  `json:"date"`   // Local date compared
+	NormalHigh     float64 `json:"normal_high"`
+	NormalLow      float64 `json:"normal_low"`
+	TodayHigh      float64 `json:"today_high"`
+	TodayLow       float64 `json:"today_low"`
+	HighAnomaly    float64 `json:"high_anomaly"`    // TodayHigh minus NormalHigh
+	LowAnomaly     float64 `json:"low_anomaly"`     // TodayLow minus NormalLow
+	HighPercentile int     `json:"high_percentile"` // Share of past days around this date with a lower high
+	WetDayChance   int     `json:"wet_day_chance"`  // Share of past days around this date with at least 1 mm
+	Description    string  `json:"description"`     // E.g. "unusually warm"
+}
+
+// Daily series from the archive the normals are computed from
+type climateSeries struct {
+	Dates         []string
+	TempMax       []*float64
+	TempMin       []*float64
+	Precipitation []*float64
+}
+
+// Days between two calendar dates ignoring the year, wrapping at year end
+func calendarDistance(a, b time.Time) int {
+	// Compare within a common non-leap year so Feb 29 sits next to Mar 1
+	dayA := time.Date(2001, a.Month(), a.Day(), 0, 0, 0, 0, time.UTC).YearDay()
+	dayB := time.Date(2001, b.Month(), b.Day(), 0, 0, 0, 0, time.UTC).YearDay()
+	diff := dayA - dayB
+	if diff < 0 {
+		diff = -diff
+	}
+	return min(diff, 365-diff)
+}
+
+// Describe where a high sits among past highs for the time of year
+func describePercentile(percentile int) string {
+	switch {
+	case percentile >= 95:
+		return "exceptionally warm"
+	case percentile >= 80:
+		return "unusually warm"
+	case percentile <= 5:
+		return "exceptionally cold"
+	case percentile <= 20:
+		return "unusually cool"
+	}
+	return "near normal"
+}
+
+// Compute the normals for date from the archive series and compare today's
+// forecast high and low against them
+func computeClimateNormals(s climateSeries, date time.Time, todayHigh, todayLow float64) (ClimateNormals, error) {
+	var highs []float64
+	var lowSum float64
+	var lows, wetDays, days int
+	for i, d := range s.Dates {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil || calendarDistance(t, date) > climateWindowDays {
+			continue
+		}
+		if i < len(s.TempMax) && s.TempMax[i] != nil {
+			highs = append(highs, *s.TempMax[i])
+		}
+		if i < len(s.TempMin) && s.TempMin[i] != nil {
+			lowSum += *s.TempMin[i]
+			lows++
+		}
+		if i < len(s.Precipitation) && s.Precipitation[i] != nil {
+			days++
+			if *s.Precipitation[i] >= 1 {
+				wetDays++
+			}
+		}
+	}
+	if len(highs) == 0 || lows == 0 {
+		return ClimateNormals{}, fmt.Errorf("no historical data around %s", date.Format("January 2"))
+	}
+
+	sort.Float64s(highs)
+	var highSum float64
+	for _, h := range highs {
+		highSum += h
+	}
+	normals := ClimateNormals{
+		Period:         fmt.Sprintf("%d-%d", climateNormalStart, climateNormalEnd),
+		Date:           date.Format("2006-01-02"),
+		NormalHigh:     round1(highSum / float64(len(highs))),
+		NormalLow:      round1(lowSum / float64(lows)),
+		TodayHigh:      todayHigh,
+		TodayLow:       todayLow,
+		HighPercentile: sort.SearchFloat64s(highs, todayHigh) * 100 / len(highs),
+	}
+	normals.HighAnomaly = round1(todayHigh - normals.NormalHigh)
+	normals.LowAnomaly = round1(todayLow - normals.NormalLow)
+	if days > 0 {
+		normals.WetDayChance = int(math.Round(float64(wetDays) * 100 / float64(days)))
+	}
+	normals.Description = describePercentile(normals.HighPercentile)
+	return normals, nil
+}
+
+// Today's local date with its forecast high and low in the configured units
+func (agent *WeatherAgent) fetchTodayHighLow(lat, lon float64) (time.Time, float64, float64, error) {
+	todayURL := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&daily=temperature_2m_max,temperature_2m_min&forecast_days=1&temperature_unit=%s&timezone=auto",
+		lat, lon, agent.units().OpenMeteoTemperatureUnit())
+	body, _, err := agent.cachedGet(todayURL, climateTodayTTL, false)
+	if err != nil {
+		return time.Time{}, 0, 0, fmt.Errorf("forecast request failed: %v", err)
+	}
+	var todayResp struct {
+		Daily struct {
+			Time    []string  `json:"time"`
+			TempMax []float64 `json:"temperature_2m_max"`
+			TempMin []float64 `json:"temperature_2m_min"`
+		} `json:"daily"`
+	}
+	if err := json.Unmarshal(body, &todayResp); err != nil {
+		return time.Time{}, 0, 0, fmt.Errorf("failed to parse forecast: %v", err)
+	}
+	if len(todayResp.Daily.Time) == 0 || len(todayResp.Daily.TempMax) == 0 || len(todayResp.Daily.TempMin) == 0 {
+		return time.Time{}, 0, 0, fmt.Errorf("no forecast for today")
+	}
+	today, err := time.Parse("2006-01-02", todayResp.Daily.Time[0])
+	if err != nil {
+		return time.Time{}, 0, 0, fmt.Errorf("unexpected forecast date %q", todayResp.Daily.Time[0])
+	}
+	return today, todayResp.Daily.TempMax[0], todayResp.Daily.TempMin[0], nil
+}
+
+// Fetch the archive for the reference period and compare today's forecast
+// high and low against it, in the configured units
+func (agent *WeatherAgent) fetchClimateNormals(lat, lon float64) (ClimateNormals, error) {
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+	today, todayHigh, todayLow, err := agent.fetchTodayHighLow(lat, lon)
+	if err != nil {
+		return ClimateNormals{}, err
+	}
+
+	// The reference period never changes, so the archive is cached for a long time
+	archiveURL := fmt.Sprintf("https://archive-api.open-meteo.com/v1/archive?latitude=%.4f&longitude=%.4f&start_date=%d-01-01&end_date=%d-12-31&daily=temperature_2m_max,temperature_2m_min,precipitation_sum&temperature_unit=%s&timezone=auto",
+		lat, lon, climateNormalStart, climateNormalEnd, tempUnit)
+	body, _, err := agent.cachedGet(archiveURL, climateNormalTTL, false)
+	if err != nil {
+		return ClimateNormals{}, fmt.Errorf("archive request failed: %v", err)
+	}
+	var archiveResp struct {
+		Daily struct {
+			Time          []string   `json:"time"`
+			TempMax       []*float64 `json:"temperature_2m_max"`
+			TempMin       []*float64 `json:"temperature_2m_min"`
+			Precipitation []*float64 `json:"precipitation_sum"`
+		} `json:"daily"`
+	}
+	if err := json.Unmarshal(body, &archiveResp); err != nil {
+		return ClimateNormals{}, fmt.Errorf("failed to parse archive response: %v", err)
+	}
+
+	return computeClimateNormals(climateSeries{
+		Dates:         archiveResp.Daily.Time,
+		TempMax:       archiveResp.Daily.TempMax,
+		TempMin:       archiveResp.Daily.TempMin,
+		Precipitation: archiveResp.Daily.Precipitation,
+	}, today, todayHigh, todayLow)
+}
+
+// Attach today's comparison with the climate normals when enabled
+func (agent *WeatherAgent) addClimateNormals(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureClimateNormals) {
+		return
+	}
+
+	normals, err := agent.fetchClimateNormals(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch climate normals: %v", err)
+		return
+	}
+	weather.Normals = &normals
+}
+
+// Add the normals and today's anomaly to the LLM data map
+func (agent *WeatherAgent) addClimateNormalsData(weather WeatherResponse, data map[string]interface{}) {
+	n := weather.Normals
+	if n == nil {
+		return
+	}
+	unit := agent.weatherUnits(weather).TemperatureSymbol()
+	data["climate_normal"] = fmt.Sprintf("high %.1f%s, low %.1f%s (%s average within a week of this date; rain on %d%% of days)",
+		n.NormalHigh, unit, n.NormalLow, unit, n.Period, n.WetDayChance)
+	data["vs_normal"] = fmt.Sprintf("forecast high %.1f%s (%+.1f%s), low %.1f%s (%+.1f%s); higher than %d%% of past highs for the time of year: %s",
+		n.TodayHigh, unit, n.HighAnomaly, unit, n.TodayLow, unit, n.LowAnomaly, unit, n.HighPercentile, n.Description)
+}
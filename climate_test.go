@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarDistance(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2026-03-15", "1995-03-15", 0},
+		{"2026-03-15", "2003-03-20", 5},
+		{"2026-01-02", "1999-12-29", 4}, // Wraps at the year end
+		{"2026-03-01", "2000-02-29", 0}, // Leap day sits next to March 1
+		{"2026-07-01", "2010-01-01", 181},
+	}
+	for _, tt := range tests {
+		if got := calendarDistance(date(tt.a), date(tt.b)); got != tt.want {
+			t.Errorf("calendarDistance(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestComputeClimateNormals(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	series := climateSeries{
+		// Three years around March 15, plus a day outside the window and a gap
+		Dates:         []string{"1991-03-10", "1991-03-15", "1992-03-20", "1993-03-15", "1993-04-15", "1994-03-16"},
+		TempMax:       []*float64{value(10), value(12), value(14), value(16), value(30), nil},
+		TempMin:       []*float64{value(2), value(4), value(6), value(8), value(20), nil},
+		Precipitation: []*float64{value(0), value(5), value(0.5), value(1), value(10), nil},
+	}
+	today, _ := time.Parse("2006-01-02", "2026-03-15")
+
+	normals, err := computeClimateNormals(series, today, 19, 5)
+	if err != nil {
+		t.Fatalf("computeClimateNormals() error = %v", err)
+	}
+	if normals.NormalHigh != 13 || normals.NormalLow != 5 {
+		t.Errorf("normal high %.1f, low %.1f; want 13, 5", normals.NormalHigh, normals.NormalLow)
+	}
+	if normals.HighAnomaly != 6 || normals.LowAnomaly != 0 {
+		t.Errorf("anomalies %+.1f, %+.1f; want +6, 0", normals.HighAnomaly, normals.LowAnomaly)
+	}
+	if normals.HighPercentile != 100 || normals.Description != "exceptionally warm" {
+		t.Errorf("percentile %d (%s), want 100 (exceptionally warm)", normals.HighPercentile, normals.Description)
+	}
+	if normals.WetDayChance != 50 || normals.Period != "1991-2020" || normals.Date != "2026-03-15" {
+		t.Errorf("wet days %d%%, period %s, date %s", normals.WetDayChance, normals.Period, normals.Date)
+	}
+
+	if cool, _ := computeClimateNormals(series, today, 11, 1); cool.Description != "near normal" || cool.HighPercentile != 25 {
+		t.Errorf("high of 11: percentile %d (%s), want 25 (near normal)", cool.HighPercentile, cool.Description)
+	}
+
+	summer, _ := time.Parse("2006-01-02", "2026-08-01")
+	if _, err := computeClimateNormals(series, summer, 25, 15); err == nil {
+		t.Error("computeClimateNormals() without data around the date: expected error")
+	}
+}
+
+func TestDescribePercentile(t *testing.T) {
+	tests := map[int]string{100: "exceptionally warm", 85: "unusually warm", 50: "near normal", 15: "unusually cool", 0: "exceptionally cold"}
+	for percentile, want := range tests {
+		if got := describePercentile(percentile); got != want {
+			t.Errorf("describePercentile(%d) = %s, want %s", percentile, got, want)
+		}
+	}
+}
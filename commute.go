@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commute settings
+const (
+	commuteCacheTTL       = 30 * time.Minute
+	defaultCommuteMinutes = 45
+	maxCommuteMinutes     = 240
+)
+
+// Commute severity levels, from best to worst
+const (
+	CommuteGood = iota
+	CommuteFair
+	CommutePoor
+	CommuteHazardous
+)
+
+// Names for the severity levels
+var commuteSeverityNames = []string{"good", "fair", "poor", "hazardous"}
+
+// One hour of conditions at a commute endpoint. Always metric.
+type commuteHour struct {
+	Precipitation float64 // mm
+	Probability   int     // %
+	VisibilityM   float64
+	GustKmh       float64
+	TempC         float64
+	WeatherCode   int
+}
+
+// Worst conditions over a travel window
+type CommuteWindow struct {
+	Depart          string  `json:"depart"` // Local time, e.g. "08:00"
+	Precipitation   float64 `json:"precipitation_mm"`
+	Probability     int     `json:"precipitation_probability"`
+	MinVisibilityKm float64 `json:"min_visibility_km"`
+	MaxGustKmh      float64 `json:"max_gust_kmh"`
+	Snow            bool    `json:"snow"`
+	Ice             bool    `json:"ice"` // Wet at or below freezing
+	Thunder         bool    `json:"thunder"`
+	Severity        string  `json:"severity"`
+	severity        int
+}
+
+// One direction of the commute, with the same trip an hour earlier for comparison
+type CommuteLeg struct {
+	Name    string        `json:"name"` // "outbound" or "return"
+	Date    string        `json:"date"`
+	Window  CommuteWindow `json:"window"`
+	Earlier CommuteWindow `json:"earlier"`
+	Hint    string        `json:"hint"` // Deterministic suggestion the advice builds on
+}
+
+// Commute conditions and the LLM's recommendation
+type CommutePlan struct {
+	Minutes int          `json:"minutes"`
+	Legs    []CommuteLeg `json:"legs"`
+	Advice  string       `json:"advice,omitempty"` // Empty when the LLM is unavailable
+}
+
+// Summarize the hours of a travel window at both endpoints
+func summarizeCommuteWindow(hours []commuteHour) CommuteWindow {
+	w := CommuteWindow{MinVisibilityKm: math.Inf(1)}
+	for _, h := range hours {
+		w.Precipitation = math.Max(w.Precipitation, h.Precipitation)
+		w.Probability = max(w.Probability, h.Probability)
+		w.MinVisibilityKm = math.Min(w.MinVisibilityKm, h.VisibilityM/1000)
+		w.MaxGustKmh = math.Max(w.MaxGustKmh, h.GustKmh)
+		switch {
+		case (h.WeatherCode >= 71 && h.WeatherCode <= 79) || h.WeatherCode == 85 || h.WeatherCode == 86:
+			w.Snow = true
+		case h.WeatherCode >= 95:
+			w.Thunder = true
+		}
+		if h.TempC <= 0 && (h.Precipitation > 0 || h.WeatherCode == 56 || h.WeatherCode == 57 || h.WeatherCode == 66 || h.WeatherCode == 67) {
+			w.Ice = true
+		}
+	}
+	if math.IsInf(w.MinVisibilityKm, 1) {
+		w.MinVisibilityKm = 0
+	}
+
+	switch {
+	case w.Snow || w.Ice || w.Thunder || w.MaxGustKmh >= 70 || (len(hours) > 0 && w.MinVisibilityKm < 0.2):
+		w.severity = CommuteHazardous
+	case w.Precipitation >= 2 || w.MaxGustKmh >= 50 || w.MinVisibilityKm < 1:
+		w.severity = CommutePoor
+	case w.Precipitation >= 0.2 || w.Probability >= 50 || w.MaxGustKmh >= 35 || w.MinVisibilityKm < 5:
+		w.severity = CommuteFair
+	default:
+		w.severity = CommuteGood
+	}
+	w.Severity = commuteSeverityNames[w.severity]
+	w.MinVisibilityKm = round1(w.MinVisibilityKm)
+	return w
+}
+
+// Suggestion for a leg from its window and the one an hour earlier
+func commuteHint(window, earlier CommuteWindow) string {
+	switch {
+	case earlier.severity < window.severity && window.severity >= CommuteFair:
+		return "leave earlier"
+	case window.severity >= CommutePoor:
+		return "consider transit or working from home"
+	}
+	return "no change needed"
+}
+
+// Parse "lat,lon" or resolve a place like "City,CC"
+func (agent *WeatherAgent) commuteCoordinates(place string) (float64, float64, error) {
+	if latStr, lonStr, ok := strings.Cut(place, ","); ok {
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+		if err1 == nil && err2 == nil {
+			return lat, lon, nil
+		}
+	}
+	city, country := parsePlace(place)
+	if city == "" {
+		return 0, 0, fmt.Errorf("no location given")
+	}
+	return agent.getCoordinates(city, country)
+}
+
+// Hourly conditions at coordinates keyed by local hour ("2006-01-02T15:00"),
+// with the location's UTC offset
+func (agent *WeatherAgent) fetchCommuteHours(lat, lon float64) (map[string]commuteHour, int, error) {
+	// Always request metric values so the thresholds are unit-independent
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&hourly=precipitation,precipitation_probability,visibility,wind_gusts_10m,temperature_2m,weather_code&forecast_days=2&timezone=auto",
+		lat, lon)
+
+	body, _, err := agent.cachedGet(url, commuteCacheTTL, false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("commute forecast request failed: %v", err)
+	}
+
+	var commuteResp struct {
+		UTCOffsetSeconds int `json:"utc_offset_seconds"`
+		Hourly           struct {
+			Time          []string  `json:"time"`
+			Precipitation []float64 `json:"precipitation"`
+			Probability   []int     `json:"precipitation_probability"`
+			Visibility    []float64 `json:"visibility"`
+			Gusts         []float64 `json:"wind_gusts_10m"`
+			Temperature   []float64 `json:"temperature_2m"`
+			WeatherCode   []int     `json:"weather_code"`
+		} `json:"hourly"`
+	}
+	if err := json.Unmarshal(body, &commuteResp); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse commute forecast: %v", err)
+	}
+
+	h := commuteResp.Hourly
+	hours := make(map[string]commuteHour, len(h.Time))
+	for i, t := range h.Time {
+		if i >= len(h.Precipitation) || i >= len(h.Probability) || i >= len(h.Visibility) ||
+			i >= len(h.Gusts) || i >= len(h.Temperature) || i >= len(h.WeatherCode) {
+			break
+		}
+		hours[t] = commuteHour{
+			Precipitation: h.Precipitation[i],
+			Probability:   h.Probability[i],
+			VisibilityM:   h.Visibility[i],
+			GustKmh:       h.Gusts[i],
+			TempC:         h.Temperature[i],
+			WeatherCode:   h.WeatherCode[i],
+		}
+	}
+	return hours, commuteResp.UTCOffsetSeconds, nil
+}
+
+// Hours overlapping a trip starting at depart, from each endpoint's forecast
+func commuteWindowHours(depart time.Time, minutes int, endpoints ...map[string]commuteHour) []commuteHour {
+	var hours []commuteHour
+	end := depart.Add(time.Duration(minutes) * time.Minute)
+	// Truncate works in UTC, which is off by the half hour in some time zones
+	start := time.Date(depart.Year(), depart.Month(), depart.Day(), depart.Hour(), 0, 0, 0, depart.Location())
+	for t := start; t.Before(end); t = t.Add(time.Hour) {
+		key := t.Format("2006-01-02T15") + ":00"
+		for _, endpoint := range endpoints {
+			if h, ok := endpoint[key]; ok {
+				hours = append(hours, h)
+			}
+		}
+	}
+	return hours
+}
+
+// Plan a leg departing at the next occurrence of timeOfDay after now
+func planCommuteLeg(name, timeOfDay string, minutes int, now time.Time, endpoints ...map[string]commuteHour) (CommuteLeg, error) {
+	hour, minute, err := parseTimeOfDay(timeOfDay)
+	if err != nil {
+		return CommuteLeg{}, err
+	}
+	depart := nextDailyRun(now, hour, minute)
+	earlier := depart.Add(-time.Hour)
+
+	leg := CommuteLeg{
+		Name:    name,
+		Date:    depart.Format("2006-01-02"),
+		Window:  summarizeCommuteWindow(commuteWindowHours(depart, minutes, endpoints...)),
+		Earlier: summarizeCommuteWindow(commuteWindowHours(earlier, minutes, endpoints...)),
+	}
+	leg.Window.Depart = depart.Format("15:04")
+	leg.Earlier.Depart = earlier.Format("15:04")
+	leg.Hint = commuteHint(leg.Window, leg.Earlier)
+	return leg, nil
+}
+
+// Build the LLM prompt for the commute recommendation
+func commutePrompt(plan CommutePlan) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Commute forecast (%d minute trip, worst conditions at either end):\n", plan.Minutes)
+	for _, leg := range plan.Legs {
+		for _, w := range []struct {
+			label  string
+			window CommuteWindow
+		}{{"planned", leg.Window}, {"an hour earlier", leg.Earlier}} {
+			fmt.Fprintf(&prompt, "- %s %s, leaving %s (%s): %s; precipitation up to %.1f mm/h (%d%% chance), visibility down to %.1f km, gusts to %.0f km/h",
+				leg.Name, leg.Date, w.window.Depart, w.label, w.window.Severity,
+				w.window.Precipitation, w.window.Probability, w.window.MinVisibilityKm, w.window.MaxGustKmh)
+			if w.window.Snow || w.window.Ice || w.window.Thunder {
+				fmt.Fprintf(&prompt, ", snow %v, ice %v, thunder %v", w.window.Snow, w.window.Ice, w.window.Thunder)
+			}
+			prompt.WriteString("\n")
+		}
+		fmt.Fprintf(&prompt, "  Suggested: %s\n", leg.Hint)
+	}
+	prompt.WriteString(`
+In under 80 words, tell the commuter how each trip looks and whether to leave earlier, take transit, or go as planned. Follow the suggestions unless the numbers clearly say otherwise, and don't invent conditions.`)
+	return prompt.String()
+}
+
+// GET /api/commute?home=lat,lon&work=City,CC&depart=08:00&return=17:30&minutes=40
+// Any parameter left out falls back to the COMMUTE_* settings.
+func (agent *WeatherAgent) handleCommute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	param := func(name, fallback string) string {
+		if value := strings.TrimSpace(query.Get(name)); value != "" {
+			return value
+		}
+		return fallback
+	}
+	var departTime, returnTime string
+	if len(agent.config.CommuteTimes) > 0 {
+		departTime = agent.config.CommuteTimes[0]
+	}
+	if len(agent.config.CommuteTimes) > 1 {
+		returnTime = agent.config.CommuteTimes[1]
+	}
+	departTime, returnTime = param("depart", departTime), param("return", returnTime)
+	if departTime == "" {
+		apiError(w, "A departure time is required (depart=HH:MM)", http.StatusBadRequest)
+		return
+	}
+
+	minutes := agent.config.CommuteMinutes
+	if value := query.Get("minutes"); value != "" {
+		var err error
+		if minutes, err = strconv.Atoi(value); err != nil || minutes < 1 || minutes > maxCommuteMinutes {
+			apiError(w, fmt.Sprintf("Invalid minutes parameter (1-%d)", maxCommuteMinutes), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var endpoints []map[string]commuteHour
+	offset := 0
+	for _, end := range []struct{ name, place string }{
+		{"home", param("home", agent.config.CommuteHome)},
+		{"work", param("work", agent.config.CommuteWork)},
+	} {
+		lat, lon, err := agent.commuteCoordinates(end.place)
+		if err != nil {
+			apiError(w, fmt.Sprintf("Unable to resolve %s location", end.name), http.StatusBadRequest)
+			return
+		}
+		hours, utcOffset, err := agent.fetchCommuteHours(lat, lon)
+		if err != nil {
+			agent.logger.Printf("Error fetching commute forecast: %v", err)
+			apiError(w, "Unable to fetch commute forecast", http.StatusBadGateway)
+			return
+		}
+		if end.name == "home" {
+			offset = utcOffset
+		}
+		endpoints = append(endpoints, hours)
+	}
+
+	now := time.Now().In(time.FixedZone("Local", offset))
+	plan := CommutePlan{Minutes: minutes}
+	for _, leg := range []struct{ name, at string }{{"outbound", departTime}, {"return", returnTime}} {
+		if leg.at == "" {
+			continue
+		}
+		planned, err := planCommuteLeg(leg.name, leg.at, minutes, now, endpoints...)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		plan.Legs = append(plan.Legs, planned)
+	}
+
+	advice, err := agent.callLLM(commutePrompt(plan))
+	if err != nil {
+		agent.logger.Printf("Error generating commute advice: %v", err)
+	} else {
+		plan.Advice = advice
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeCommuteWindow(t *testing.T) {
+	clear := commuteHour{VisibilityM: 20000, GustKmh: 15, TempC: 12, WeatherCode: 1}
+	tests := []struct {
+		name     string
+		hours    []commuteHour
+		severity string
+	}{
+		{"clear", []commuteHour{clear, clear}, "good"},
+		{"light rain likely", []commuteHour{clear, {Precipitation: 0.4, Probability: 70, VisibilityM: 12000, GustKmh: 20, TempC: 10, WeatherCode: 61}}, "fair"},
+		{"heavy rain", []commuteHour{{Precipitation: 3.5, Probability: 90, VisibilityM: 6000, GustKmh: 30, TempC: 9, WeatherCode: 63}}, "poor"},
+		{"fog", []commuteHour{clear, {VisibilityM: 150, GustKmh: 5, TempC: 4, WeatherCode: 45}}, "hazardous"},
+		{"snow", []commuteHour{{Precipitation: 0.5, Probability: 80, VisibilityM: 3000, GustKmh: 20, TempC: -1, WeatherCode: 73}}, "hazardous"},
+		{"freezing drizzle", []commuteHour{{Probability: 40, VisibilityM: 8000, GustKmh: 10, TempC: -2, WeatherCode: 56}}, "hazardous"},
+		{"gale", []commuteHour{{VisibilityM: 20000, GustKmh: 75, TempC: 8, WeatherCode: 3}}, "hazardous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeCommuteWindow(tt.hours); got.Severity != tt.severity {
+				t.Errorf("severity = %s, want %s (%+v)", got.Severity, tt.severity, got)
+			}
+		})
+	}
+
+	w := summarizeCommuteWindow([]commuteHour{clear, {Precipitation: 1.2, Probability: 60, VisibilityM: 4500, GustKmh: 40, TempC: 7, WeatherCode: 95}})
+	if w.Precipitation != 1.2 || w.Probability != 60 || w.MinVisibilityKm != 4.5 || w.MaxGustKmh != 40 || !w.Thunder || w.Snow || w.Ice {
+		t.Errorf("summarizeCommuteWindow() = %+v", w)
+	}
+}
+
+func TestPlanCommuteLeg(t *testing.T) {
+	home := map[string]commuteHour{
+		"2026-01-12T07:00": {VisibilityM: 20000, GustKmh: 10, TempC: 3, WeatherCode: 1},
+		"2026-01-12T08:00": {Precipitation: 2.5, Probability: 90, VisibilityM: 5000, GustKmh: 30, TempC: 4, WeatherCode: 63},
+	}
+	work := map[string]commuteHour{
+		"2026-01-12T07:00": {VisibilityM: 20000, GustKmh: 12, TempC: 3, WeatherCode: 2},
+		"2026-01-12T08:00": {Precipitation: 1, Probability: 80, VisibilityM: 8000, GustKmh: 25, TempC: 4, WeatherCode: 61},
+	}
+	now := time.Date(2026, 1, 11, 21, 0, 0, 0, time.UTC)
+
+	leg, err := planCommuteLeg("outbound", "08:15", 30, now, home, work)
+	if err != nil {
+		t.Fatalf("planCommuteLeg() error = %v", err)
+	}
+	if leg.Date != "2026-01-12" || leg.Window.Depart != "08:15" || leg.Earlier.Depart != "07:15" {
+		t.Errorf("leg on %s leaving %s (earlier %s), want 2026-01-12 at 08:15 (07:15)", leg.Date, leg.Window.Depart, leg.Earlier.Depart)
+	}
+	if leg.Window.Severity != "poor" || leg.Earlier.Severity != "good" || leg.Hint != "leave earlier" {
+		t.Errorf("window %s, earlier %s, hint %q; want poor, good, leave earlier", leg.Window.Severity, leg.Earlier.Severity, leg.Hint)
+	}
+
+	if _, err := planCommuteLeg("outbound", "8am", 30, now, home, work); err == nil {
+		t.Error("planCommuteLeg() with an invalid time: expected error")
+	}
+}
+
+func TestCommuteHint(t *testing.T) {
+	tests := []struct {
+		window, earlier int
+		want            string
+	}{
+		{CommuteGood, CommuteGood, "no change needed"},
+		{CommutePoor, CommuteGood, "leave earlier"},
+		{CommuteHazardous, CommuteHazardous, "consider transit or working from home"},
+		{CommuteFair, CommuteFair, "no change needed"},
+	}
+	for _, tt := range tests {
+		got := commuteHint(CommuteWindow{severity: tt.window}, CommuteWindow{severity: tt.earlier})
+		if got != tt.want {
+			t.Errorf("commuteHint(%d, %d) = %q, want %q", tt.window, tt.earlier, got, tt.want)
+		}
+	}
+}
+
+func TestCommutePrompt(t *testing.T) {
+	plan := CommutePlan{Minutes: 40, Legs: []CommuteLeg{{
+		Name:    "outbound",
+		Date:    "2026-01-12",
+		Window:  CommuteWindow{Depart: "08:00", Severity: "hazardous", Snow: true},
+		Earlier: CommuteWindow{Depart: "07:00", Severity: "fair"},
+		Hint:    "leave earlier",
+	}}}
+	prompt := commutePrompt(plan)
+	for _, want := range []string{"40 minute trip", "leaving 08:00 (planned): hazardous", "snow true", "leaving 07:00 (an hour earlier): fair", "Suggested: leave earlier"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("commutePrompt() missing %q:\n%s", want, prompt)
+		}
+	}
+}
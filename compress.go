@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Responses smaller than this aren't worth compressing
+const gzipMinBytes = 512
+
+// Content types worth compressing
+var compressibleTypes = []string{"application/json", "text/csv"}
+
+// Response writer that buffers the body so it can be hashed, answered with a
+// 304, or compressed once the handler has finished
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Whether an If-None-Match header matches the ETag (weak comparison)
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the client accepts gzip-encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// Whether the response's content type is worth compressing
+func compressible(header http.Header) bool {
+	contentType := header.Get("Content-Type")
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware adding ETags and gzip compression to API responses. Handlers
+// can set their own ETag (e.g. from the weather fingerprint); successful GET
+// responses without one get a weak ETag hashed from the body. A matching
+// If-None-Match is answered with 304 Not Modified.
+func gzipETagMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedResponse{ResponseWriter: w}
+		next(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		header := w.Header()
+		body := buf.body.Bytes()
+
+		if buf.status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			etag := header.Get("ETag")
+			if etag == "" && compressible(header) {
+				sum := sha256.Sum256(body)
+				etag = `W/"` + hex.EncodeToString(sum[:12]) + `"`
+				header.Set("ETag", etag)
+			}
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		if compressible(header) {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		if len(body) < gzipMinBytes || !compressible(header) || !acceptsGzip(r) || header.Get("Content-Encoding") != "" {
+			w.WriteHeader(buf.status)
+			w.Write(body)
+			return
+		}
+
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.WriteHeader(buf.status)
+		gz := gzip.NewWriter(w)
+		gz.Write(body)
+		gz.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}
+}
+
+func TestGzipETagMiddlewareCompresses(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("sunny ", 200) + `"}`
+	handler := gzipETagMiddleware(jsonHandler(body))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/forecast", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip encoding, headers %v", rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := io.ReadAll(gz)
+	if string(decoded) != body {
+		t.Errorf("decoded body mismatch")
+	}
+
+	// Small responses and clients without gzip get the plain body
+	req = httptest.NewRequest(http.MethodGet, "/api/forecast", nil)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Errorf("expected an uncompressed body without Accept-Encoding")
+	}
+
+	rec = httptest.NewRecorder()
+	req.Header.Set("Accept-Encoding", "gzip")
+	gzipETagMiddleware(jsonHandler(`{"ok":true}`))(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("small response should not be compressed")
+	}
+}
+
+func TestGzipETagMiddlewareNotModified(t *testing.T) {
+	handler := gzipETagMiddleware(jsonHandler(`{"temp":21}`))
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/precondition", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, etag %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/precondition", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("status %d, body %q, want empty 304", rec.Code, rec.Body.String())
+	}
+
+	// A handler-supplied ETag (the weather fingerprint) is kept
+	fingerprinted := gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `W/"abc123"`)
+		jsonHandler(`{"temp":21}`)(w, r)
+	})
+	rec = httptest.NewRecorder()
+	fingerprinted(rec, httptest.NewRequest(http.MethodGet, "/api/weather", nil))
+	if got := rec.Header().Get("ETag"); got != `W/"abc123"` {
+		t.Errorf("ETag = %q", got)
+	}
+}
+
+func TestGzipETagMiddlewarePassesErrors(t *testing.T) {
+	handler := gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unable to fetch forecast", http.StatusInternalServerError)
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/forecast", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("ETag") != "" {
+		t.Errorf("status %d, etag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch, etag string
+		want              bool
+	}{
+		{`W/"abc"`, `W/"abc"`, true},
+		{`"abc"`, `W/"abc"`, true},
+		{`"x", W/"abc"`, `W/"abc"`, true},
+		{`*`, `W/"abc"`, true},
+		{`"abd"`, `W/"abc"`, false},
+		{``, `W/"abc"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, tt.etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, tt.etag, got, tt.want)
+		}
+	}
+}
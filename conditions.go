@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GET /api/conditions: the weather data /api/weather returns, without
+// generating a message. Upstream responses are cached, so the UI can poll
+// this every minute and ask /api/weather for a new message only now and then.
+func (agent *WeatherAgent) handleConditions(w http.ResponseWriter, r *http.Request) {
+	sensitivities, err := agent.requestSensitivities(r)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	latParam, lonParam := r.URL.Query().Get("lat"), r.URL.Query().Get("lon")
+	profile, _ := agent.requestProfile(r)
+	if profile.Location != nil && (latParam == "" || lonParam == "") {
+		latParam = strconv.FormatFloat(profile.Location.Lat, 'f', -1, 64)
+		lonParam = strconv.FormatFloat(profile.Location.Lon, 'f', -1, 64)
+	}
+	var weather WeatherResponse
+	if latParam != "" && lonParam != "" {
+		lat, err1 := strconv.ParseFloat(latParam, 64)
+		lon, err2 := strconv.ParseFloat(lonParam, 64)
+		if err1 != nil || err2 != nil {
+			apiError(w, "Invalid coordinates", http.StatusBadRequest)
+			return
+		}
+		weather, err = agent.fetchWeatherByCoordinates(lat, lon)
+	} else {
+		weather, err = agent.fetchWeather()
+	}
+	if err != nil {
+		agent.logger.Printf("Error fetching conditions: %v", err)
+		apiError(w, "Unable to fetch weather data", http.StatusInternalServerError)
+		return
+	}
+	weather = agent.applyProfile(weather, profile)
+
+	data := agent.prepareWeatherData(weather)
+	agent.markDegraded(weather, data)
+	agent.addPlaylist(weather, data)
+	personalizeAirQualityGuidance(data, sensitivities)
+
+	// Stamped with the observation time rather than now, so the body (and its
+	// ETag) only changes with the weather
+	resp := ConditionsResponse{
+		City:          weather.Name,
+		Country:       weather.Sys.Country,
+		Timestamp:     time.Unix(weather.Dt, 0).Format(time.RFC1123),
+		Data:          data,
+		Severity:      dataSeverity(data),
+		SeverityColor: severityColor(dataSeverity(data)),
+	}
+	// The last message is in the configured units and language
+	if last := agent.lastMessage(weatherLocationKey(weather)); last.Message != "" && !weather.personalized() {
+		resp.Message = last.Message
+		resp.MessageTime = &last.Time
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
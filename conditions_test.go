@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleConditions(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key"})
+
+	get := func(url string) (*httptest.ResponseRecorder, ConditionsResponse) {
+		rec := httptest.NewRecorder()
+		agent.handleConditions(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp ConditionsResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	rec, resp := get("/api/conditions")
+	if rec.Code != http.StatusOK || resp.City != "Oslo" || resp.Data["aqi"] == nil || resp.Severity != SeverityNone ||
+		resp.SeverityColor != severityColor(SeverityNone) || resp.Message != "" || resp.MessageTime != nil {
+		t.Errorf("conditions: %d %+v", rec.Code, resp)
+	}
+
+	// The latest message comes along, but none is generated
+	agent.setLastMessage(locationKey("Oslo", "NO"), "Mild and breezy.")
+	if _, resp = get("/api/conditions"); resp.Message != "Mild and breezy." || resp.MessageTime == nil {
+		t.Errorf("with a message: %+v", resp)
+	}
+
+	if rec, _ = get("/api/conditions?sensitivity=pets"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown sensitivity: got %d", rec.Code)
+	}
+	if rec, _ = get("/api/conditions?lat=north&lon=10"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid coordinates: got %d", rec.Code)
+	}
+}
+
+func TestHandleConditionsAppliesProfile(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{Locale: "en"})
+	agent.profiles, _ = newProfileStore("")
+	agent.profiles.put("token-1", Profile{Units: "imperial", Language: "de"})
+	agent.setLastMessage(locationKey("Oslo", "NO"), "Mild and breezy.")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/conditions", nil)
+	req.Header.Set(profileHeader, "token-1")
+	rec := httptest.NewRecorder()
+	agent.handleConditions(rec, req)
+	var resp ConditionsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	// The shared message is in English and metric, so it's left out
+	if rec.Code != http.StatusOK || resp.Data["units"] != "imperial" || resp.Data["temperature"] != "65.1°F" ||
+		resp.Data["wind_speed"] != "7.0 mph" || resp.Data["day_of_week"] != "Samstag" || resp.Message != "" {
+		t.Errorf("conditions with a profile: %d %+v", rec.Code, resp)
+	}
+
+	// Messages for the profile are cached apart from the configured ones
+	weather, _ := agent.fetchWeather()
+	personal := agent.applyProfile(weather, Profile{Units: "imperial", Language: "de"})
+	if agent.llmCacheKey(personal, "", agent.llmParams()) == agent.llmCacheKey(weather, "", agent.llmParams()) {
+		t.Error("llmCacheKey() ignores the profile's units and language")
+	}
+	if agent.applyProfile(weather, Profile{Units: "metric", Language: "EN"}).personalized() {
+		t.Error("a profile matching the configuration shouldn't personalize the weather")
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Severity of a configuration problem
+const (
+	IssueError   = "error"   // The agent refuses to start
+	IssueWarning = "warning" // The agent starts with a fallback
+)
+
+// A problem found in the configuration
+type configIssue struct {
+	Severity string
+	Setting  string // Environment variable the problem comes from
+	Message  string
+}
+
+// Check the whole configuration up front, so mistakes are reported together
+// at startup instead of surfacing mid-request
+func validateConfig(config Config) []configIssue {
+	var issues []configIssue
+	add := func(severity, setting, format string, args ...interface{}) {
+		issues = append(issues, configIssue{severity, setting, fmt.Sprintf(format, args...)})
+	}
+
+	// LLM
+	if !containsString(llmProviders, config.LLMProvider) {
+		add(IssueError, "LLM_PROVIDER", "unknown provider %q (use %s)", config.LLMProvider, strings.Join(llmProviders, ", "))
+	} else if config.LLMTools && !llmToolsSupported(config.LLMProvider) {
+		add(IssueWarning, "LLM_TOOLS", "not supported with %s, so all the data is sent up front", config.LLMProvider)
+	}
+	if config.LLMBaseURL != "" {
+		if err := validLLMBaseURL(config.LLMBaseURL); err != nil {
+			add(IssueError, "LLM_BASE_URL", "%v", err)
+		} else if !strings.EqualFold(config.LLMProvider, "openai") {
+			add(IssueWarning, "LLM_BASE_URL", "only used with LLM_PROVIDER=openai, which OpenAI-compatible gateways need")
+		}
+	}
+	if _, err := parseHeaderList(config.LLMExtraHeaders); err != nil {
+		add(IssueError, "LLM_EXTRA_HEADERS", "%v", err)
+	}
+	if config.LLMAPIKey == "" && config.LLMBaseURL == "" {
+		add(IssueWarning, "LLM_API_KEY", "not set, so messages come from built-in templates; add LLM_API_KEY=your_api_key_here to the environment or a .env file")
+	}
+	if config.LLMModelB != "" && config.LLMModelB == config.LLMModel {
+		add(IssueWarning, "LLM_MODEL_B", "is the same as LLM_MODEL, so A/B comparisons compare a model with itself")
+	}
+	if config.LLMTemperature < 0 || config.LLMTemperature > 2 {
+		add(IssueError, "LLM_TEMPERATURE", "%g is outside 0-2", config.LLMTemperature)
+	}
+	params := llmParams{
+		MaxTokens:        config.LLMMaxTokens,
+		Stop:             config.LLMStop,
+		TopP:             config.LLMTopP,
+		FrequencyPenalty: config.LLMFrequencyPenalty,
+		PresencePenalty:  config.LLMPresencePenalty,
+	}
+	if field, err := params.validate(); err != nil {
+		// Fields are named like the env vars, e.g. top_p for LLM_TOP_P
+		add(IssueError, "LLM_"+strings.ToUpper(field), "%v", err)
+	}
+	if config.MessageSimilarity <= 0 || config.MessageSimilarity > 1 {
+		add(IssueError, "MESSAGE_SIMILARITY", "must be above 0 and at most 1, got %g", config.MessageSimilarity)
+	}
+	if config.RecentMessages < 1 {
+		add(IssueError, "RECENT_MESSAGES", "must be at least 1, got %d", config.RecentMessages)
+	}
+	if config.Persona != "" {
+		if _, ok := findPersona(config.Persona); !ok {
+			add(IssueError, "PERSONA", "unknown persona %q (available: %s)", config.Persona, personaNames())
+		}
+	}
+	if _, err := parseSensitivities(config.HealthSensitivities); err != nil {
+		add(IssueError, "HEALTH_SENSITIVITIES", "%v", err)
+	}
+	if _, err := parseAdvisoryThresholds(config.AdvisoryThresholds, units.ParseSystem(config.Units)); err != nil {
+		add(IssueError, "ADVISORY_THRESHOLDS", "%v", err)
+	}
+
+	// Units and language
+	if system := strings.TrimSpace(config.Units); !strings.EqualFold(system, string(units.Metric)) && !strings.EqualFold(system, string(units.Imperial)) {
+		add(IssueError, "WEATHER_UNITS", "%q is not a unit system (use metric or imperial)", config.Units)
+	}
+	if !supportedLocale(config.Locale) {
+		add(IssueWarning, "LOCALE", "no translations for %q, using %s", config.Locale, defaultLocale)
+	}
+	if config.CheckInterval < 1 {
+		add(IssueWarning, "WEATHER_CHECK_INTERVAL", "%d minute(s) is too short, streams update every minute", config.CheckInterval)
+	}
+
+	// Logging
+	if config.LogToFile {
+		if file, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			add(IssueError, "WEATHER_LOG_FILE", "can't write to %s: %v", config.LogFile, err)
+		} else {
+			file.Close()
+		}
+	}
+	rotation := []struct {
+		setting string
+		value   int
+	}{
+		{"WEATHER_LOG_MAX_SIZE_MB", config.LogRotation.MaxSizeMB},
+		{"WEATHER_LOG_ROTATE_HOURS", config.LogRotation.RotateHours},
+		{"WEATHER_LOG_MAX_BACKUPS", config.LogRotation.MaxBackups},
+		{"WEATHER_LOG_MAX_AGE_DAYS", config.LogRotation.MaxAgeDays},
+	}
+	for _, r := range rotation {
+		if r.value < 0 {
+			add(IssueError, r.setting, "must not be negative (0 disables), got %d", r.value)
+		}
+	}
+	if config.PromptLogSize < 0 {
+		add(IssueError, "PROMPT_LOG_SIZE", "must not be negative, got %d", config.PromptLogSize)
+	}
+	if config.PromptLogFile != "" && config.PromptLogSize == 0 {
+		add(IssueWarning, "PROMPT_LOG_FILE", "set, but PROMPT_LOG_SIZE is 0 so no prompts are logged")
+	}
+
+	// Schedules and rules
+	if _, _, err := parseTimeOfDay(config.DigestTime); err != nil {
+		add(IssueError, "DIGEST_TIME", "%v", err)
+	}
+	if _, err := parseAlertRules(config.AlertRules); err != nil {
+		add(IssueError, "ALERT_RULES", "%v (supported fields: %s)", err, strings.Join(ruleFieldNames(), ", "))
+	}
+	if config.WindGustAlert < 0 {
+		add(IssueError, "WIND_GUST_ALERT", "must not be negative, got %g", config.WindGustAlert)
+	}
+	for _, period := range config.ReportPeriods {
+		if period != ReportWeekly && period != ReportMonthly {
+			add(IssueError, "REPORT_PERIODS", "unknown period %q (use weekly or monthly)", period)
+		}
+	}
+	if len(config.ReportPeriods) > 0 && config.HistoryFile == "" && config.DatabaseURL == "" {
+		add(IssueWarning, "HISTORY_FILE", "not set, so observations for reports are lost on restart")
+	}
+	switch {
+	case config.HistoryAggregateDays < 0:
+		add(IssueError, "HISTORY_AGGREGATE_DAYS", "must not be negative, got %d", config.HistoryAggregateDays)
+	case config.HistoryAggregateDays > 0 && config.HistoryRetentionHours <= 0:
+		add(IssueWarning, "HISTORY_AGGREGATE_DAYS", "has no effect because HISTORY_RETENTION_HOURS keeps every reading")
+	case config.HistoryAggregateDays > 0 && config.HistoryAggregateDays*24 <= config.HistoryRetentionHours:
+		add(IssueWarning, "HISTORY_AGGREGATE_DAYS", "%d days is within HISTORY_RETENTION_HOURS, so hourly averages are dropped as soon as they are made", config.HistoryAggregateDays)
+	}
+	if _, err := parsePlaylistRules(config.PlaylistRules); err != nil {
+		add(IssueError, "PLAYLIST_RULES", "%v", err)
+	}
+	if _, err := newFeatureFlags(config.FeatureFlags); err != nil {
+		add(IssueError, "FEATURE_FLAGS", "%v", err)
+	}
+
+	// Radar
+	switch config.RadarProvider {
+	case RadarRainViewer, RadarOff:
+	case RadarOpenWeatherMap:
+		if config.WeatherAPIKey == "" || config.WeatherAPIKey == "not-needed" {
+			add(IssueError, "WEATHER_API_KEY", "an OpenWeatherMap key is needed for RADAR_PROVIDER=openweathermap")
+		}
+	default:
+		add(IssueError, "RADAR_PROVIDER", "unknown provider %q (use rainviewer, openweathermap or off)", config.RadarProvider)
+	}
+
+	// Aviation
+	if config.AviationStation != "" && !icaoPattern.MatchString(config.AviationStation) {
+		add(IssueError, "AVIATION_STATION", "%q is not a 4-character ICAO code", config.AviationStation)
+	}
+
+	// Deutscher Wetterdienst
+	if config.DWDStation != "" && !dwdStationPattern.MatchString(config.DWDStation) {
+		add(IssueError, "DWD_STATION", "%q is not a MOSMIX station ID such as 10382", config.DWDStation)
+	}
+
+	// Wildfire smoke
+	if config.FIRMSMapKey != "" && (config.WildfireRadiusKm < 1 || config.WildfireRadiusKm > 500) {
+		add(IssueError, "WILDFIRE_RADIUS_KM", "must be between 1 and 500, got %d", config.WildfireRadiusKm)
+	}
+
+	// Tropical cyclones
+	if config.CycloneRadiusKm < 1 {
+		add(IssueError, "CYCLONE_RADIUS_KM", "must be positive, got %d", config.CycloneRadiusKm)
+	}
+
+	// Earthquakes
+	if config.EarthquakeRadiusKm < 1 {
+		add(IssueError, "EARTHQUAKE_RADIUS_KM", "must be positive, got %d", config.EarthquakeRadiusKm)
+	}
+	if config.EarthquakeMinMagnitude < 0 || config.EarthquakeMinMagnitude > 10 {
+		add(IssueError, "EARTHQUAKE_MIN_MAGNITUDE", "must be between 0 and 10, got %g", config.EarthquakeMinMagnitude)
+	}
+
+	// Commute
+	if config.CommuteMinutes < 1 || config.CommuteMinutes > maxCommuteMinutes {
+		add(IssueError, "COMMUTE_MINUTES", "must be between 1 and %d, got %d", maxCommuteMinutes, config.CommuteMinutes)
+	}
+	if len(config.CommuteTimes) > 2 {
+		add(IssueError, "COMMUTE_TIMES", "expected at most two times (outbound and return), got %d", len(config.CommuteTimes))
+	}
+	for _, t := range config.CommuteTimes {
+		if _, _, err := parseTimeOfDay(t); err != nil {
+			add(IssueError, "COMMUTE_TIMES", "%v", err)
+		}
+	}
+	if (config.CommuteHome == "") != (config.CommuteWork == "") {
+		add(IssueWarning, "COMMUTE_HOME", "COMMUTE_HOME and COMMUTE_WORK should be set together")
+	}
+
+	// Concurrency and HTTP client
+	if config.FetchConcurrency < 1 || config.FetchConcurrency > maxFetchConcurrency {
+		add(IssueError, "FETCH_CONCURRENCY", "must be between 1 and %d, got %d", maxFetchConcurrency, config.FetchConcurrency)
+	}
+	if config.HTTPTimeoutSeconds < 1 {
+		add(IssueError, "HTTP_TIMEOUT_SECONDS", "must be positive, got %d", config.HTTPTimeoutSeconds)
+	}
+	if config.HTTPMaxIdleConns < 0 {
+		add(IssueError, "HTTP_MAX_IDLE_CONNS", "must not be negative, got %d", config.HTTPMaxIdleConns)
+	}
+	if config.HTTPMaxIdleConnsPerHost < 0 {
+		add(IssueError, "HTTP_MAX_IDLE_CONNS_PER_HOST", "must not be negative, got %d", config.HTTPMaxIdleConnsPerHost)
+	} else if config.HTTPMaxIdleConns > 0 && config.HTTPMaxIdleConnsPerHost > config.HTTPMaxIdleConns {
+		add(IssueWarning, "HTTP_MAX_IDLE_CONNS_PER_HOST", "%d is above HTTP_MAX_IDLE_CONNS (%d), which caps it",
+			config.HTTPMaxIdleConnsPerHost, config.HTTPMaxIdleConns)
+	}
+
+	// CORS
+	for _, origin := range config.CORS.AllowedOrigins {
+		if err := validateCORSOrigin(origin); err != nil {
+			add(IssueError, "CORS_ALLOWED_ORIGINS", "%v", err)
+		}
+	}
+	if config.CORS.AllowCredentials && containsString(config.CORS.AllowedOrigins, "*") {
+		add(IssueError, "CORS_ALLOW_CREDENTIALS", "can't be used with CORS_ALLOWED_ORIGINS=*, which would let any site act as a logged-in user")
+	}
+	if config.CORS.MaxAge < 0 {
+		add(IssueError, "CORS_MAX_AGE", "must not be negative, got %d", config.CORS.MaxAge)
+	}
+
+	// UI login
+	switch ui := config.UIAuth; ui.Mode {
+	case "", UIAuthOff:
+		if len(ui.AdminUsers) > 0 {
+			add(IssueWarning, "UI_ADMIN_USERS", "has no effect without UI_AUTH")
+		}
+	case UIAuthBasic, UIAuthOIDC:
+		if ui.Mode == UIAuthBasic && len(ui.BasicUsers) == 0 {
+			add(IssueError, "UI_BASIC_USERS", "must list at least one user:password when UI_AUTH=basic")
+		} else if _, err := parseBasicUsers(ui.BasicUsers); err != nil {
+			add(IssueError, "UI_BASIC_USERS", "%v", err)
+		}
+		if ui.Mode == UIAuthOIDC {
+			if ui.OIDCIssuer == "" {
+				add(IssueError, "OIDC_ISSUER", "must be set when UI_AUTH=oidc")
+			}
+			if ui.OIDCClientID == "" {
+				add(IssueError, "OIDC_CLIENT_ID", "must be set when UI_AUTH=oidc")
+			}
+			if u, err := url.Parse(ui.OIDCRedirectURL); err != nil || !u.IsAbs() {
+				add(IssueError, "OIDC_REDIRECT_URL", "must be an absolute URL ending in /auth/callback when UI_AUTH=oidc")
+			}
+			if len(ui.OIDCAllowedEmails) == 0 {
+				add(IssueError, "OIDC_ALLOWED_EMAILS", "must list the accounts allowed in when UI_AUTH=oidc, or anyone with an account at %s could log in", ui.OIDCIssuer)
+			}
+		}
+		if ui.SessionHours < 1 {
+			add(IssueWarning, "UI_SESSION_HOURS", "must be at least 1, got %d; using 24", ui.SessionHours)
+		}
+		if ui.SessionSecret == "" {
+			add(IssueWarning, "UI_SESSION_SECRET", "not set, so logins won't survive a restart")
+		}
+	default:
+		add(IssueError, "UI_AUTH", "unknown mode %q (use off, basic or oidc)", ui.Mode)
+	}
+
+	// Backends
+	if config.RedisURL != "" {
+		if _, err := newRedisCache(config.RedisURL); err != nil {
+			add(IssueError, "REDIS_URL", "%v", err)
+		}
+	}
+	if config.DatabaseURL != "" {
+		if sslMode, err := parsePostgresURL(config.DatabaseURL); err != nil {
+			add(IssueError, "DATABASE_URL", "%v", err)
+		} else {
+			if sslMode != "disable" && !postgresVerifiesServer(sslMode) {
+				add(IssueWarning, "DATABASE_URL", "sslmode=%s doesn't verify the server's certificate (use verify-full, or disable on a trusted network)", sslMode)
+			}
+			if config.HistoryFile != "" {
+				add(IssueWarning, "HISTORY_FILE", "ignored because DATABASE_URL is set")
+			}
+		}
+	}
+	if config.MQTTURL != "" {
+		if _, err := newMQTTClient(config.MQTTURL); err != nil {
+			add(IssueError, "MQTT_URL", "%v", err)
+		}
+	}
+	if config.WebhooksFile != "" {
+		if _, err := loadWebhooks(config.WebhooksFile); err != nil {
+			add(IssueError, "WEBHOOKS_FILE", "%v", err)
+		}
+	}
+	if config.PushoverAppToken != "" || config.PushoverUserKey != "" {
+		if _, err := newPushoverNotifier(config.PushoverAppToken, config.PushoverUserKey); err != nil {
+			add(IssueWarning, "PUSHOVER_APP_TOKEN", "%v", err)
+		}
+	}
+	if config.MatrixRoomID != "" {
+		if _, err := newMatrixNotifier(config.MatrixHomeserver, config.MatrixAccessToken, config.MatrixRoomID); err != nil {
+			add(IssueWarning, "MATRIX_ROOM_ID", "%v", err)
+		}
+	}
+	if config.GoogleChatWebhook != "" {
+		if _, err := newGoogleChatNotifier(config.GoogleChatWebhook); err != nil {
+			add(IssueWarning, "GOOGLE_CHAT_WEBHOOK_URL", "%v", err)
+		}
+	}
+	if config.TeamsWebhook != "" {
+		if _, err := newTeamsNotifier(config.TeamsWebhook); err != nil {
+			add(IssueWarning, "TEAMS_WEBHOOK_URL", "%v", err)
+		}
+	}
+	if _, err := parseNotifierRoutes(config.NotifierRoutes); err != nil {
+		add(IssueError, "NOTIFIER_ROUTES", "%v", err)
+	}
+	if _, err := parseDeliverySchedules(config.QuietHours, nil); err != nil {
+		add(IssueError, "NOTIFIER_QUIET_HOURS", "%v", err)
+	}
+	if _, err := parseDeliverySchedules(nil, config.BatchTimes); err != nil {
+		add(IssueError, "NOTIFIER_BATCH_TIMES", "%v", err)
+	}
+	if config.SubscriptionMaxLocations < 0 {
+		add(IssueError, "SUBSCRIPTION_MAX_LOCATIONS", "must not be negative (0 for no limit), got %d", config.SubscriptionMaxLocations)
+	}
+	if config.EngagementBaseURL != "" {
+		if u, err := url.Parse(config.EngagementBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(IssueError, "ENGAGEMENT_BASE_URL", "%q is not an absolute http(s) URL", config.EngagementBaseURL)
+		}
+	}
+	if config.UpdateIntervalMinutes > 0 {
+		if config.EngagementBaseURL == "" {
+			add(IssueWarning, "ENGAGEMENT_BASE_URL", "not set, so email and webhook updates can't report engagement and will back off")
+		}
+		if config.UpdateMaxIntervalMinutes < config.UpdateIntervalMinutes {
+			add(IssueWarning, "UPDATE_MAX_INTERVAL_MINUTES", "%d is below UPDATE_INTERVAL_MINUTES (%d), so updates never back off",
+				config.UpdateMaxIntervalMinutes, config.UpdateIntervalMinutes)
+		}
+	}
+
+	return issues
+}
+
+// Whether the message catalog has translations for a locale
+func supportedLocale(locale string) bool {
+	if strings.TrimSpace(locale) == "" {
+		return true
+	}
+	lang := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(lang, "-_."); i >= 0 {
+		lang = lang[:i]
+	}
+	_, ok := catalog[lang]
+	return ok
+}
+
+// Whether any issue should stop the agent from starting
+func hasConfigErrors(issues []configIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == IssueError {
+			return true
+		}
+	}
+	return false
+}
+
+// Print the issues as a table, errors first
+func printConfigDiagnostics(w io.Writer, issues []configIssue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "Configuration OK")
+		return
+	}
+
+	errors := 0
+	for _, issue := range issues {
+		if issue.Severity == IssueError {
+			errors++
+		}
+	}
+	fmt.Fprintf(w, "Configuration check: %d error(s), %d warning(s)\n\n", errors, len(issues)-errors)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tSETTING\tPROBLEM")
+	for _, severity := range []string{IssueError, IssueWarning} {
+		for _, issue := range issues {
+			if issue.Severity == severity {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", issue.Severity, issue.Setting, issue.Message)
+			}
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A configuration that passes every check
+func validTestConfig() Config {
+	return Config{
+		LLMProvider:             "anthropic",
+		LLMAPIKey:               "test-key",
+		LLMTemperature:          0.7,
+		Units:                   "metric",
+		Locale:                  "en",
+		CheckInterval:           10,
+		DigestTime:              "07:00",
+		RadarProvider:           RadarRainViewer,
+		CycloneRadiusKm:         1000,
+		EarthquakeRadiusKm:      300,
+		EarthquakeMinMagnitude:  4,
+		CommuteMinutes:          45,
+		FetchConcurrency:        4,
+		HTTPTimeoutSeconds:      30,
+		HTTPMaxIdleConns:        100,
+		HTTPMaxIdleConnsPerHost: 10,
+		MessageSimilarity:       0.7,
+		LLMMaxTokens:            500,
+		RecentMessages:          5,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(c *Config)
+		setting  string
+		severity string
+	}{
+		{"unknown provider", func(c *Config) { c.LLMProvider = "gemini" }, "LLM_PROVIDER", IssueError},
+		{"missing API key", func(c *Config) { c.LLMAPIKey = "" }, "LLM_API_KEY", IssueWarning},
+		{"temperature out of range", func(c *Config) { c.LLMTemperature = 3 }, "LLM_TEMPERATURE", IssueError},
+		{"unknown persona", func(c *Config) { c.Persona = "wizard" }, "PERSONA", IssueError},
+		{"invalid units", func(c *Config) { c.Units = "kelvin" }, "WEATHER_UNITS", IssueError},
+		{"unsupported locale", func(c *Config) { c.Locale = "xx-XX" }, "LOCALE", IssueWarning},
+		{"bad digest time", func(c *Config) { c.DigestTime = "25:99" }, "DIGEST_TIME", IssueError},
+		{"bad alert rule", func(c *Config) { c.AlertRules = []string{"nonsense"} }, "ALERT_RULES", IssueError},
+		{"negative gust alert", func(c *Config) { c.WindGustAlert = -5 }, "WIND_GUST_ALERT", IssueError},
+		{"negative aggregate retention", func(c *Config) { c.HistoryAggregateDays = -1 }, "HISTORY_AGGREGATE_DAYS", IssueError},
+		{"aggregates expire before readings", func(c *Config) { c.HistoryRetentionHours = 24 * 30; c.HistoryAggregateDays = 7 }, "HISTORY_AGGREGATE_DAYS", IssueWarning},
+		{"unknown report period", func(c *Config) { c.ReportPeriods = []string{"daily"}; c.HistoryFile = "history.json" }, "REPORT_PERIODS", IssueError},
+		{"reports without history", func(c *Config) { c.ReportPeriods = []string{"weekly"} }, "HISTORY_FILE", IssueWarning},
+		{"bad playlist rule", func(c *Config) { c.PlaylistRules = []string{"rain"} }, "PLAYLIST_RULES", IssueError},
+		{"relative engagement URL", func(c *Config) { c.EngagementBaseURL = "weather.example.com" }, "ENGAGEMENT_BASE_URL", IssueError},
+		{"updates without engagement URL", func(c *Config) { c.UpdateIntervalMinutes = 60; c.UpdateMaxIntervalMinutes = 1440 }, "ENGAGEMENT_BASE_URL", IssueWarning},
+		{"unknown radar provider", func(c *Config) { c.RadarProvider = "nexrad" }, "RADAR_PROVIDER", IssueError},
+		{"radar without OpenWeatherMap key", func(c *Config) { c.RadarProvider = RadarOpenWeatherMap }, "WEATHER_API_KEY", IssueError},
+		{"invalid aviation station", func(c *Config) { c.AviationStation = "JFK" }, "AVIATION_STATION", IssueError},
+		{"invalid DWD station", func(c *Config) { c.DWDStation = "Berlin" }, "DWD_STATION", IssueError},
+		{"wildfire radius out of range", func(c *Config) { c.FIRMSMapKey = "key"; c.WildfireRadiusKm = 0 }, "WILDFIRE_RADIUS_KM", IssueError},
+		{"non-positive cyclone radius", func(c *Config) { c.CycloneRadiusKm = 0 }, "CYCLONE_RADIUS_KM", IssueError},
+		{"negative earthquake magnitude", func(c *Config) { c.EarthquakeMinMagnitude = -1 }, "EARTHQUAKE_MIN_MAGNITUDE", IssueError},
+		{"bad commute time", func(c *Config) { c.CommuteTimes = []string{"8am"} }, "COMMUTE_TIMES", IssueError},
+		{"commute home without work", func(c *Config) { c.CommuteHome = "Leeds,GB" }, "COMMUTE_HOME", IssueWarning},
+		{"zero fetch concurrency", func(c *Config) { c.FetchConcurrency = 0 }, "FETCH_CONCURRENCY", IssueError},
+		{"zero HTTP timeout", func(c *Config) { c.HTTPTimeoutSeconds = 0 }, "HTTP_TIMEOUT_SECONDS", IssueError},
+		{"per-host idle conns above total", func(c *Config) { c.HTTPMaxIdleConnsPerHost = 200 }, "HTTP_MAX_IDLE_CONNS_PER_HOST", IssueWarning},
+		{"pushover user key missing", func(c *Config) { c.PushoverAppToken = testPushoverToken }, "PUSHOVER_APP_TOKEN", IssueWarning},
+		{"unknown route severity", func(c *Config) { c.NotifierRoutes = []string{"pushover=alert>=critical"} }, "NOTIFIER_ROUTES", IssueError},
+		{"negative subscription locations", func(c *Config) { c.SubscriptionMaxLocations = -1 }, "SUBSCRIPTION_MAX_LOCATIONS", IssueError},
+		{"database URL not postgres", func(c *Config) { c.DatabaseURL = "mysql://localhost/weather" }, "DATABASE_URL", IssueError},
+		{"advisory thresholds out of order", func(c *Config) { c.AdvisoryThresholds = []string{"cold_advisory=-30", "cold_warning=-20"} }, "ADVISORY_THRESHOLDS", IssueError},
+		{"unknown sensitivity", func(c *Config) { c.HealthSensitivities = []string{"asthma", "pets"} }, "HEALTH_SENSITIVITIES", IssueError},
+		{"MQTT URL not mqtt", func(c *Config) { c.MQTTURL = "http://broker.local" }, "MQTT_URL", IssueError},
+		{"unverified database TLS", func(c *Config) { c.DatabaseURL = "postgres://db.example.com/weather?sslmode=require" }, "DATABASE_URL", IssueWarning},
+		{"history file with database", func(c *Config) {
+			c.DatabaseURL = "postgres://localhost/weather?sslmode=verify-full"
+			c.HistoryFile = "history.jsonl"
+		}, "HISTORY_FILE", IssueWarning},
+		{"similarity above one", func(c *Config) { c.MessageSimilarity = 1.5 }, "MESSAGE_SIMILARITY", IssueError},
+		{"relative LLM base URL", func(c *Config) { c.LLMProvider = "openai"; c.LLMBaseURL = "localhost:1234/v1" }, "LLM_BASE_URL", IssueError},
+		{"too many max tokens", func(c *Config) { c.LLMMaxTokens = 100000 }, "LLM_MAX_TOKENS", IssueError},
+		{"top_p above one", func(c *Config) { c.LLMTopP = 1.5 }, "LLM_TOP_P", IssueError},
+		{"negative log backups", func(c *Config) { c.LogRotation.MaxBackups = -1 }, "WEATHER_LOG_MAX_BACKUPS", IssueError},
+		{"negative prompt log size", func(c *Config) { c.PromptLogSize = -1 }, "PROMPT_LOG_SIZE", IssueError},
+		{"A/B with one model", func(c *Config) { c.LLMModel, c.LLMModelB = "gpt-4o", "gpt-4o" }, "LLM_MODEL_B", IssueWarning},
+		{"CORS origin with a path", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }, "CORS_ALLOWED_ORIGINS", IssueError},
+		{"CORS credentials for any origin", func(c *Config) { c.CORS.AllowedOrigins, c.CORS.AllowCredentials = []string{"*"}, true }, "CORS_ALLOW_CREDENTIALS", IssueError},
+		{"unknown UI auth mode", func(c *Config) { c.UIAuth.Mode = "ldap" }, "UI_AUTH", IssueError},
+		{"basic auth without users", func(c *Config) {
+			c.UIAuth = UIAuthConfig{Mode: UIAuthBasic, SessionSecret: "secret", SessionHours: 24}
+		}, "UI_BASIC_USERS", IssueError},
+		{"OIDC with a relative redirect", func(c *Config) {
+			c.UIAuth = UIAuthConfig{Mode: UIAuthOIDC, OIDCIssuer: "https://id.example.com", OIDCClientID: "weather",
+				OIDCRedirectURL: "/auth/callback", OIDCAllowedEmails: []string{"me@example.com"}, SessionSecret: "secret", SessionHours: 24}
+		}, "OIDC_REDIRECT_URL", IssueError},
+		{"OIDC for any account", func(c *Config) {
+			c.UIAuth = UIAuthConfig{Mode: UIAuthOIDC, OIDCIssuer: "https://id.example.com", OIDCClientID: "weather",
+				OIDCRedirectURL: "https://weather.example.com/auth/callback", SessionSecret: "secret", SessionHours: 24}
+		}, "OIDC_ALLOWED_EMAILS", IssueError},
+		{"UI admins without UI auth", func(c *Config) { c.UIAuth.AdminUsers = []string{"me"} }, "UI_ADMIN_USERS", IssueWarning},
+		{"UI sessions without a secret", func(c *Config) {
+			c.UIAuth = UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:hunter2"}, SessionHours: 24}
+		}, "UI_SESSION_SECRET", IssueWarning},
+		{"tools with cohere", func(c *Config) { c.LLMProvider = "cohere"; c.LLMTools = true }, "LLM_TOOLS", IssueWarning},
+		{"unwritable log file", func(c *Config) {
+			c.LogToFile = true
+			c.LogFile = filepath.Join(t.TempDir(), "missing", "weather.log")
+		}, "WEATHER_LOG_FILE", IssueError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			tt.modify(&config)
+
+			issues := validateConfig(config)
+			if len(issues) != 1 {
+				t.Fatalf("got %d issues, want 1: %+v", len(issues), issues)
+			}
+			if issues[0].Setting != tt.setting || issues[0].Severity != tt.severity {
+				t.Errorf("got %s %s, want %s %s", issues[0].Severity, issues[0].Setting, tt.severity, tt.setting)
+			}
+			if got := hasConfigErrors(issues); got != (tt.severity == IssueError) {
+				t.Errorf("hasConfigErrors = %t", got)
+			}
+		})
+	}
+
+	if issues := validateConfig(validTestConfig()); len(issues) != 0 {
+		t.Errorf("valid config reported issues: %+v", issues)
+	}
+}
+
+func TestPrintConfigDiagnostics(t *testing.T) {
+	var buf bytes.Buffer
+	printConfigDiagnostics(&buf, nil)
+	if !strings.Contains(buf.String(), "Configuration OK") {
+		t.Errorf("expected OK message, got %q", buf.String())
+	}
+
+	buf.Reset()
+	printConfigDiagnostics(&buf, []configIssue{
+		{IssueWarning, "LOCALE", "no translations"},
+		{IssueError, "LLM_API_KEY", "not set"},
+	})
+	out := buf.String()
+	if !strings.Contains(out, "1 error(s), 1 warning(s)") {
+		t.Errorf("missing summary in %q", out)
+	}
+	// Errors are listed before warnings
+	if strings.Index(out, "LLM_API_KEY") > strings.Index(out, "LOCALE") {
+		t.Errorf("errors should come first:\n%s", out)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Request headers cross-origin callers may send when CORS_ALLOWED_HEADERS isn't set
+var defaultCORSHeaders = []string{"Authorization", "Content-Type", "X-API-Key", "X-Profile-Token"}
+
+// Response headers cross-origin scripts may read
+const corsExposedHeaders = "ETag, Retry-After, Deprecation, Link"
+
+// Cross-origin access to the JSON API, for frontends and widgets served from
+// other sites
+type CORSConfig struct {
+	AllowedOrigins   []string // e.g. "https://example.com", or "*" for any (empty disables CORS)
+	AllowedHeaders   []string // Request headers callers may send (empty for defaultCORSHeaders)
+	AllowCredentials bool     // Let browsers send cookies with cross-origin requests
+	MaxAge           int      // Seconds browsers may cache a preflight response
+}
+
+// Check an allowed origin is "*" or a bare scheme://host[:port]
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q is not an origin like https://example.com", origin)
+	}
+	return nil
+}
+
+// Whether requests from an origin are allowed
+func (c CORSConfig) allows(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware adding CORS headers for allowed origins and answering their
+// preflight requests before authentication, which preflights never carry.
+// Requests from other origins pass through without CORS headers, so
+// browsers keep their responses from scripts.
+func (c CORSConfig) middleware(next http.HandlerFunc) http.HandlerFunc {
+	if len(c.AllowedOrigins) == 0 {
+		return next
+	}
+	headers := c.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allows(origin) {
+			next(w, r)
+			return
+		}
+
+		header := w.Header()
+		// Browsers refuse "*" on credentialed requests, so the origin is echoed
+		if containsString(c.AllowedOrigins, "*") && !c.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE")
+			header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			if c.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next(w, r)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if requestAPIKey(r) == "" {
+			apiError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, http.StatusOK, ChatResponse{Reply: "ok"})
+	}
+	site := CORSConfig{AllowedOrigins: []string{"https://widget.example.com"}, AllowCredentials: true, MaxAge: 600}
+	anyOrigin := CORSConfig{AllowedOrigins: []string{"*"}}
+
+	tests := []struct {
+		name        string
+		config      CORSConfig
+		method      string
+		origin      string
+		preflight   bool
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{"allowed origin", site, http.MethodGet, "https://widget.example.com", false, http.StatusOK, "https://widget.example.com", true},
+		{"preflight skips auth", site, http.MethodOptions, "https://widget.example.com", true, http.StatusNoContent, "https://widget.example.com", true},
+		{"other origin", site, http.MethodGet, "https://evil.example.com", false, http.StatusOK, "", false},
+		{"other origin preflight", site, http.MethodOptions, "https://evil.example.com", true, http.StatusUnauthorized, "", false},
+		{"same origin", site, http.MethodGet, "", false, http.StatusOK, "", false},
+		{"any origin", anyOrigin, http.MethodGet, "https://anywhere.example", false, http.StatusOK, "*", false},
+		{"disabled", CORSConfig{}, http.MethodGet, "https://widget.example.com", false, http.StatusOK, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/chat", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			} else {
+				req.Header.Set("X-API-Key", "key")
+			}
+			rec := httptest.NewRecorder()
+			tt.config.middleware(handler)(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.credentials)
+			}
+			if tt.preflight && tt.allowOrigin != "" {
+				if rec.Header().Get("Access-Control-Allow-Headers") == "" || rec.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("preflight headers = %v", rec.Header())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// National Hurricane Center settings
+const (
+	nhcCurrentStormsURL = "https://www.nhc.noaa.gov/CurrentStorms.json"
+	nhcCacheTTL         = 15 * time.Minute // Advisories are issued every 3-6 hours
+	approachHalfAngle   = 45               // Degrees either side of a storm's heading counted as approaching
+)
+
+// NHC classification codes and what to call them
+var stormClassifications = map[string]string{
+	"TD":  "Tropical Depression",
+	"STD": "Subtropical Depression",
+	"TS":  "Tropical Storm",
+	"STS": "Subtropical Storm",
+	"HU":  "Hurricane",
+	"TY":  "Typhoon",
+	"PTC": "Potential Tropical Cyclone",
+	"PC":  "Post-tropical Cyclone",
+}
+
+// An active tropical cyclone and where it is relative to the location
+type TropicalStorm struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Classification   string    `json:"classification"` // E.g. "Hurricane"
+	Category         int       `json:"category,omitempty"`
+	WindKt           int       `json:"wind_kt"` // Maximum sustained wind
+	PressureMb       int       `json:"pressure_mb,omitempty"`
+	Lat              float64   `json:"lat"`
+	Lon              float64   `json:"lon"`
+	MovementDir      int       `json:"movement_dir"` // Heading in degrees
+	MovementSpeedMph int       `json:"movement_speed_mph"`
+	DistanceKm       float64   `json:"distance_km"`
+	Bearing          float64   `json:"bearing"` // From the location to the storm
+	Approaching      bool      `json:"approaching"`
+	AdvisoryURL      string    `json:"advisory_url,omitempty"`
+	Updated          time.Time `json:"updated"`
+}
+
+// Saffir-Simpson category for a sustained wind in knots (0 below hurricane strength)
+func saffirSimpsonCategory(windKt int) int {
+	switch {
+	case windKt >= 137:
+		return 5
+	case windKt >= 113:
+		return 4
+	case windKt >= 96:
+		return 3
+	case windKt >= 83:
+		return 2
+	case windKt >= 64:
+		return 1
+	}
+	return 0
+}
+
+// Parse the NHC active storms feed
+func parseNHCStorms(body []byte) ([]TropicalStorm, error) {
+	var feed struct {
+		ActiveStorms []struct {
+			ID               string  `json:"id"`
+			Name             string  `json:"name"`
+			Classification   string  `json:"classification"`
+			Intensity        string  `json:"intensity"`
+			Pressure         string  `json:"pressure"`
+			LatitudeNumeric  float64 `json:"latitudeNumeric"`
+			LongitudeNumeric float64 `json:"longitudeNumeric"`
+			MovementDir      int     `json:"movementDir"`
+			MovementSpeed    int     `json:"movementSpeed"`
+			LastUpdate       string  `json:"lastUpdate"`
+			PublicAdvisory   struct {
+				URL string `json:"url"`
+			} `json:"publicAdvisory"`
+		} `json:"activeStorms"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse NHC storms: %v", err)
+	}
+
+	storms := make([]TropicalStorm, 0, len(feed.ActiveStorms))
+	for _, s := range feed.ActiveStorms {
+		storm := TropicalStorm{
+			ID:               s.ID,
+			Name:             s.Name,
+			Classification:   s.Classification,
+			Lat:              s.LatitudeNumeric,
+			Lon:              s.LongitudeNumeric,
+			MovementDir:      s.MovementDir,
+			MovementSpeedMph: s.MovementSpeed,
+			AdvisoryURL:      s.PublicAdvisory.URL,
+		}
+		if name, ok := stormClassifications[s.Classification]; ok {
+			storm.Classification = name
+		}
+		storm.WindKt, _ = strconv.Atoi(s.Intensity)
+		storm.PressureMb, _ = strconv.Atoi(s.Pressure)
+		if s.Classification == "HU" || s.Classification == "TY" {
+			storm.Category = saffirSimpsonCategory(storm.WindKt)
+		}
+		storm.Updated, _ = time.Parse(time.RFC3339, s.LastUpdate)
+		storms = append(storms, storm)
+	}
+	return storms, nil
+}
+
+// Storms within radiusKm of the location, nearest first, with their
+// distance, bearing and whether they're heading this way
+func stormsNear(storms []TropicalStorm, lat, lon float64, radiusKm int) []TropicalStorm {
+	var near []TropicalStorm
+	for _, storm := range storms {
+		storm.DistanceKm = distanceKm(lat, lon, storm.Lat, storm.Lon)
+		if storm.DistanceKm > float64(radiusKm) {
+			continue
+		}
+		storm.DistanceKm = math.Round(storm.DistanceKm)
+		storm.Bearing = bearingDegrees(lat, lon, storm.Lat, storm.Lon)
+		// Approaching when it's heading roughly back along the line to us
+		toLocation := bearingDegrees(storm.Lat, storm.Lon, lat, lon)
+		storm.Approaching = storm.MovementSpeedMph > 0 && angleDifference(float64(storm.MovementDir), toLocation) <= approachHalfAngle
+		near = append(near, storm)
+	}
+	sort.Slice(near, func(i, j int) bool { return near[i].DistanceKm < near[j].DistanceKm })
+	return near
+}
+
+// Name with classification and category, e.g. "Hurricane Ernesto (Category 2)"
+func (s TropicalStorm) title() string {
+	title := s.Classification + " " + s.Name
+	if s.Category > 0 {
+		title += fmt.Sprintf(" (Category %d)", s.Category)
+	}
+	return title
+}
+
+// One-line description of the storm's position and track
+func (s TropicalStorm) summary(locale string) string {
+	track := "stationary"
+	if s.MovementSpeedMph > 0 {
+		track = fmt.Sprintf("moving %s at %d mph", compassDirection(locale, float64(s.MovementDir)), s.MovementSpeedMph)
+	}
+	approach := ""
+	if s.Approaching {
+		approach = ", heading towards this location"
+	}
+	return fmt.Sprintf("%s, max winds %d kt, %.0f km to the %s, %s%s",
+		s.title(), s.WindKt, s.DistanceKm, compassDirection(locale, s.Bearing), track, approach)
+}
+
+// Fetch the active storms within the configured radius of coordinates
+func (agent *WeatherAgent) fetchStormsNear(lat, lon float64) ([]TropicalStorm, error) {
+	body, _, err := agent.cachedGet(nhcCurrentStormsURL, nhcCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("NHC storms request failed: %v", err)
+	}
+	storms, err := parseNHCStorms(body)
+	if err != nil {
+		return nil, err
+	}
+	return stormsNear(storms, lat, lon, agent.config.CycloneRadiusKm), nil
+}
+
+// Attach nearby tropical cyclones to the weather response when tracking is on
+func (agent *WeatherAgent) addCyclones(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureCyclones) {
+		return
+	}
+
+	storms, err := agent.fetchStormsNear(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch tropical cyclones: %v", err)
+		return
+	}
+	weather.Storms = storms
+}
+
+// Nearby storms as one line each for the LLM data map
+func (agent *WeatherAgent) addCycloneData(weather WeatherResponse, data map[string]interface{}) {
+	if len(weather.Storms) == 0 {
+		return
+	}
+	summaries := make([]string, 0, len(weather.Storms))
+	for _, storm := range weather.Storms {
+		summaries = append(summaries, storm.summary(agent.weatherLocale(weather)))
+	}
+	data["tropical_storms"] = strings.Join(summaries, "; ")
+}
+
+// Send an alert when a storm comes within range or strengthens. Keys include
+// the classification and category so an upgrade alerts again.
+func (agent *WeatherAgent) checkCycloneAlerts(weather WeatherResponse) {
+	if len(weather.Storms) == 0 || !agent.hasRecipients(NotificationAlert) {
+		return
+	}
+
+	var weatherData map[string]interface{}
+	for _, storm := range weather.Storms {
+		key := fmt.Sprintf("%s|%s|%s|%d", weather.Name, storm.ID, storm.Classification, storm.Category)
+		if !agent.cycloneAlerts.markSent(key) {
+			continue
+		}
+		if weatherData == nil {
+			weatherData = agent.prepareWeatherData(weather)
+		}
+
+		message := storm.summary(agent.config.Locale) + ". Follow official advisories and local emergency guidance."
+		if storm.AdvisoryURL != "" {
+			message += " Latest advisory: " + storm.AdvisoryURL
+		}
+		agent.notify(Notification{
+			Type:      NotificationAlert,
+			AlertType: "tropical_cyclone",
+			Severity:  "severe",
+			Title:     fmt.Sprintf("%s near %s", storm.title(), weather.Name),
+			Message:   message,
+			City:      weather.Name,
+			Country:   weather.Sys.Country,
+			Units:     agent.config.Units,
+			Data:      weatherData,
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+const sampleNHCStorms = `{"activeStorms":[
+	{"id":"al052026","binNumber":"AT5","name":"Ernesto","classification":"HU","intensity":"85","pressure":"968",
+	 "latitudeNumeric":24.0,"longitudeNumeric":-78.0,"movementDir":315,"movementSpeed":12,
+	 "lastUpdate":"2026-09-02T15:00:00.000Z","publicAdvisory":{"url":"https://www.nhc.noaa.gov/text/MIATCPAT5.shtml"}},
+	{"id":"ep092026","name":"Kiko","classification":"TS","intensity":"45","pressure":"1000",
+	 "latitudeNumeric":15.0,"longitudeNumeric":-120.0,"movementDir":270,"movementSpeed":8,
+	 "lastUpdate":"2026-09-02T15:00:00.000Z"}
+]}`
+
+func TestParseNHCStorms(t *testing.T) {
+	storms, err := parseNHCStorms([]byte(sampleNHCStorms))
+	if err != nil {
+		t.Fatalf("parseNHCStorms() error = %v", err)
+	}
+	if len(storms) != 2 {
+		t.Fatalf("got %d storms, want 2", len(storms))
+	}
+	if got := storms[0].title(); got != "Hurricane Ernesto (Category 2)" {
+		t.Errorf("title() = %q, want Hurricane Ernesto (Category 2)", got)
+	}
+	if storms[0].WindKt != 85 || storms[0].PressureMb != 968 {
+		t.Errorf("Ernesto winds %d kt, pressure %d mb; want 85 kt, 968 mb", storms[0].WindKt, storms[0].PressureMb)
+	}
+	if got := storms[1].title(); got != "Tropical Storm Kiko" {
+		t.Errorf("title() = %q, want Tropical Storm Kiko", got)
+	}
+
+	if _, err := parseNHCStorms([]byte("<html>")); err == nil {
+		t.Error("parseNHCStorms() with HTML: expected error")
+	}
+}
+
+func TestStormsNear(t *testing.T) {
+	storms, _ := parseNHCStorms([]byte(sampleNHCStorms))
+
+	// Miami, with Ernesto ~295 km to the south-east heading north-west
+	near := stormsNear(storms, 25.76, -80.19, 1000)
+	if len(near) != 1 || near[0].Name != "Ernesto" {
+		t.Fatalf("stormsNear(Miami) = %+v, want only Ernesto", near)
+	}
+	if near[0].DistanceKm < 270 || near[0].DistanceKm > 320 || !near[0].Approaching {
+		t.Errorf("Ernesto at %.0f km, approaching %v; want ~295 km and approaching", near[0].DistanceKm, near[0].Approaching)
+	}
+
+	// Havana is south-west of its track, so it isn't heading there
+	if near := stormsNear(storms, 23.11, -82.37, 1000); len(near) != 1 || near[0].Approaching {
+		t.Errorf("stormsNear(Havana) = %+v, want Ernesto not approaching", near)
+	}
+
+	if near := stormsNear(storms, 51.5, -0.13, 1000); len(near) != 0 {
+		t.Errorf("stormsNear(London) = %+v, want none", near)
+	}
+}
+
+func TestSaffirSimpsonCategory(t *testing.T) {
+	for windKt, want := range map[int]int{50: 0, 64: 1, 85: 2, 100: 3, 120: 4, 140: 5} {
+		if got := saffirSimpsonCategory(windKt); got != want {
+			t.Errorf("saffirSimpsonCategory(%d) = %d, want %d", windKt, got, want)
+		}
+	}
+}
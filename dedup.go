@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Lowercased letters and digits with single spaces between words, so
+// punctuation and spacing don't make a repeat look new
+func normalizeMessage(message string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(message) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Counts of each three-character sequence in a normalized message
+func trigrams(message string) map[string]int {
+	runes := []rune(" " + normalizeMessage(message) + " ")
+	grams := make(map[string]int, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])]++
+	}
+	return grams
+}
+
+// Dice coefficient of two messages' character trigrams: 1 for the same text,
+// near 1 for the same phrasing with a few words or numbers changed, and 0 for
+// nothing in common
+func messageSimilarity(a, b string) float64 {
+	ga, gb := trigrams(a), trigrams(b)
+	total := 0
+	for _, n := range ga {
+		total += n
+	}
+	for _, n := range gb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	shared := 0
+	for gram, n := range ga {
+		if m := gb[gram]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// The recent message most like message, and how alike they are
+func mostSimilarMessage(message string, recent []string) (string, float64) {
+	var closest string
+	best := 0.0
+	for _, previous := range recent {
+		if score := messageSimilarity(message, previous); score > best {
+			closest, best = previous, score
+		}
+	}
+	return closest, best
+}
+
+// Regenerate a message that reads too much like one of the location's recent
+// messages, asking the LLM to avoid their phrasing. If the retry is still too
+// close, the message is kept with the local time in front.
+func (agent *WeatherAgent) varyMessage(weather WeatherResponse, historyContext, message string) string {
+	if !agent.llmConfigured() {
+		// Template messages come out the same however often they're asked for
+		return message
+	}
+	recent := agent.lastMessage(weatherLocationKey(weather)).recentMessages()
+	_, score := mostSimilarMessage(message, recent)
+	if score < agent.config.MessageSimilarity {
+		return message
+	}
+	agent.logger.Printf("LLM message is %.0f%% similar to a recent one, adding variation request and retrying", 100*score)
+
+	var avoid strings.Builder
+	avoid.WriteString("\nIMPORTANT: Please generate a completely different message than before. Recent messages, don't reuse their wording:\n")
+	for _, previous := range recent {
+		avoid.WriteString("- " + previous + "\n")
+	}
+	varied, err := agent.generateLLMMessage(weather, historyContext+avoid.String(), agent.config.Persona, agent.llmParams())
+	if err == nil {
+		if _, score := mostSimilarMessage(varied, recent); score < agent.config.MessageSimilarity {
+			return varied
+		}
+	}
+
+	currentTime := time.Unix(weather.Dt, 0).UTC().Add(time.Second * time.Duration(weather.Timezone))
+	return fmt.Sprintf("[%s] %s", currentTime.Format("15:04"), message)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMessageSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"Sunny and 20°C, perfect for a walk.", "Sunny and 20°C, perfect for a walk.", 1, 1},
+		{"Sunny and 20°C, perfect for a walk.", "sunny and 20°C -- perfect for a walk!", 1, 1},
+		{"Sunny and 20°C, perfect for a walk in the park.", "Sunny and 21°C, perfect for a stroll in the park.", 0.7, 0.99},
+		{"Sunny and 20°C, perfect for a walk.", "Heavy rain until noon, so bring a sturdy umbrella.", 0, 0.3},
+		{"", "", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := messageSimilarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("messageSimilarity(%q, %q) = %.2f, want %.2f-%.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRecentMessagesWindow(t *testing.T) {
+	agent := newFixtureAgent(t, Config{RecentMessages: 3, MessageSimilarity: 0.7})
+	location := locationKey("Oslo", "NO")
+	for _, message := range []string{"one", "two", "three", "four"} {
+		agent.setLastMessage(location, message)
+	}
+	last := agent.lastMessage(location)
+	if last.Message != "four" || strings.Join(last.recentMessages(), ",") != "two,three,four" {
+		t.Errorf("last = %q, recent = %v", last.Message, last.recentMessages())
+	}
+	if got := (lastMessageState{Message: "saved before"}).recentMessages(); len(got) != 1 || got[0] != "saved before" {
+		t.Errorf("recent messages of an old state = %v", got)
+	}
+}
+
+func TestVaryMessage(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{})
+	llm := &fakeLLM{reply: "Clouds clearing by lunchtime, a light jacket will do."}
+	agent.llm = llm
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := weatherLocationKey(weather)
+	agent.setLastMessage(location, "Grey skies and drizzle, take an umbrella.")
+	agent.setLastMessage(location, "Mild with some cloud, a light jacket will do.")
+
+	// Different enough: no retry
+	if got := agent.varyMessage(weather, "", "Bright and breezy all afternoon."); got != "Bright and breezy all afternoon." || len(llm.prompts) != 0 {
+		t.Errorf("varyMessage() = %q after %d retries", got, len(llm.prompts))
+	}
+
+	// A near repeat is regenerated, with the recent messages in the prompt
+	if got := agent.varyMessage(weather, "", "Mild with some clouds; a light jacket will do!"); got != llm.reply {
+		t.Errorf("varyMessage() = %q, want the regenerated message", got)
+	}
+	if len(llm.prompts) != 1 || !strings.Contains(llm.prompts[0], "- Grey skies and drizzle, take an umbrella.") {
+		t.Errorf("retry prompts = %q", llm.prompts)
+	}
+
+	// A retry that repeats itself gets the time in front instead
+	llm.reply = "Mild with some cloud, a light jacket will do."
+	if got := agent.varyMessage(weather, "", llm.reply); !strings.HasPrefix(got, "[") || !strings.HasSuffix(got, "] "+llm.reply) {
+		t.Errorf("varyMessage() = %q, want a timestamped message", got)
+	}
+}
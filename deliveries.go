@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Channels a generated message can be delivered through
+const (
+	ChannelUI         = "ui"
+	ChannelStream     = "stream"
+	ChannelEmail      = "email"
+	ChannelTelegram   = "telegram"
+	ChannelWebhook    = "webhook"
+	ChannelPushover   = "pushover"
+	ChannelMatrix     = "matrix"
+	ChannelGoogleChat = "googlechat"
+	ChannelTeams      = "teams"
+)
+
+// Delivery statuses
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryHeld      = "held" // Waiting for quiet hours to end or the next batch
+)
+
+// Number of delivery receipts kept in memory
+const maxDeliveryRecords = 500
+
+// Receipt recording when and where a message was delivered
+type Delivery struct {
+	MessageID string    `json:"message_id"`
+	Type      string    `json:"type,omitempty"` // Notification kind, e.g. NotificationAlert
+	Channel   string    `json:"channel"`
+	Target    string    `json:"target,omitempty"` // Recipient, chat ID, URL, or client IP (masked outside the admin API)
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	City      string    `json:"city,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Bounded, concurrency-safe log of delivery receipts
+type deliveryLog struct {
+	mu      sync.Mutex
+	records []Delivery
+}
+
+func newDeliveryLog() *deliveryLog {
+	return &deliveryLog{records: make([]Delivery, 0, maxDeliveryRecords)}
+}
+
+// Record a delivery, dropping the oldest receipt when full
+func (d *deliveryLog) record(delivery Delivery) {
+	if delivery.Time.IsZero() {
+		delivery.Time = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.records) >= maxDeliveryRecords {
+		copy(d.records, d.records[1:])
+		d.records = d.records[:len(d.records)-1]
+	}
+	d.records = append(d.records, delivery)
+}
+
+// Return up to limit receipts, newest first, optionally filtered by channel and message
+func (d *deliveryLog) list(channel, messageID string, limit int) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]Delivery, 0)
+	for i := len(d.records) - 1; i >= 0; i-- {
+		rec := d.records[i]
+		if channel != "" && rec.Channel != channel {
+			continue
+		}
+		if messageID != "" && rec.MessageID != messageID {
+			continue
+		}
+		result = append(result, rec)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// Shorten a delivery target to what tells receipts apart without giving it
+// away: an email's domain, a webhook's host (its path is often the secret),
+// the network of a client IP, or the end of a chat ID
+func maskTarget(channel, target string) string {
+	if target == "" {
+		return ""
+	}
+	switch channel {
+	case ChannelUI, ChannelStream:
+		ip := net.ParseIP(target)
+		if ip == nil {
+			return "…"
+		}
+		if ip.To4() != nil {
+			return ip.Mask(net.CIDRMask(24, 32)).String() + "/24"
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+	case ChannelEmail:
+		recipients := strings.Split(target, ", ")
+		for i, recipient := range recipients {
+			if at := strings.LastIndex(recipient, "@"); at > 0 {
+				recipients[i] = recipient[:1] + "…" + recipient[at:]
+			} else {
+				recipients[i] = "…"
+			}
+		}
+		return strings.Join(recipients, ", ")
+	case ChannelWebhook:
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			return "…"
+		}
+		return u.Scheme + "://" + u.Host + "/…"
+	case ChannelTelegram, ChannelMatrix:
+		if len(target) > 4 {
+			return "…" + target[len(target)-4:]
+		}
+		return "…"
+	}
+	// The other channels record a label rather than an address
+	return target
+}
+
+// GET /api/deliveries: recent delivery receipts, newest first, with their
+// targets masked (?channel=email&message_id=...&limit=50)
+func (agent *WeatherAgent) handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	agent.listDeliveries(w, r, false)
+}
+
+// GET /api/admin/deliveries: delivery receipts with their full targets
+func (agent *WeatherAgent) handleAdminDeliveries(w http.ResponseWriter, r *http.Request) {
+	agent.listDeliveries(w, r, true)
+}
+
+func (agent *WeatherAgent) listDeliveries(w http.ResponseWriter, r *http.Request, fullTargets bool) {
+	limit := 50
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			apiError(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries := agent.deliveries.list(r.URL.Query().Get("channel"), r.URL.Query().Get("message_id"), limit)
+	if !fullTargets {
+		for i := range deliveries {
+			deliveries[i].Target = maskTarget(deliveries[i].Channel, deliveries[i].Target)
+		}
+	}
+	writeJSON(w, http.StatusOK, DeliveriesResponse{Deliveries: deliveries})
+}
+
+// Generate a random identifier for a generated message
+func newMessageID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeliveryLogListFilters(t *testing.T) {
+	log := newDeliveryLog()
+	log.record(Delivery{MessageID: "a", Channel: ChannelUI, Status: DeliveryDelivered})
+	log.record(Delivery{MessageID: "a", Channel: ChannelEmail, Status: DeliveryFailed, Error: "smtp down"})
+	log.record(Delivery{MessageID: "b", Channel: ChannelUI, Status: DeliveryDelivered})
+
+	all := log.list("", "", 0)
+	if len(all) != 3 || all[0].MessageID != "b" {
+		t.Fatalf("expected 3 receipts newest first, got %+v", all)
+	}
+
+	if ui := log.list(ChannelUI, "", 0); len(ui) != 2 {
+		t.Errorf("expected 2 UI receipts, got %d", len(ui))
+	}
+	if forA := log.list("", "a", 0); len(forA) != 2 {
+		t.Errorf("expected 2 receipts for message a, got %d", len(forA))
+	}
+	if limited := log.list("", "", 1); len(limited) != 1 {
+		t.Errorf("expected limit to cap results, got %d", len(limited))
+	}
+	if all[2].Time.IsZero() {
+		t.Error("record should default the delivery time")
+	}
+}
+
+func TestDeliveryLogBounded(t *testing.T) {
+	log := newDeliveryLog()
+	for i := 0; i < maxDeliveryRecords+10; i++ {
+		log.record(Delivery{MessageID: fmt.Sprintf("m%d", i), Channel: ChannelUI})
+	}
+
+	all := log.list("", "", 0)
+	if len(all) != maxDeliveryRecords {
+		t.Fatalf("expected %d receipts, got %d", maxDeliveryRecords, len(all))
+	}
+	if all[len(all)-1].MessageID != "m10" {
+		t.Errorf("oldest receipts should be dropped first, oldest is %s", all[len(all)-1].MessageID)
+	}
+}
+
+func TestMaskTarget(t *testing.T) {
+	tests := []struct {
+		channel, target, want string
+	}{
+		{ChannelUI, "203.0.113.42", "203.0.113.0/24"},
+		{ChannelStream, "2001:db8:1:2::7", "2001:db8:1::/48"},
+		{ChannelEmail, "jane@example.com, ops@example.org", "j…@example.com, o…@example.org"},
+		{ChannelWebhook, "https://hooks.example.com/services/T000/B000/secret?token=x", "https://hooks.example.com/…"},
+		{ChannelTelegram, "-1001234567", "…4567"},
+		{ChannelTeams, "Teams channel", "Teams channel"},
+		{ChannelEmail, "", ""},
+	}
+	for _, tt := range tests {
+		if got := maskTarget(tt.channel, tt.target); got != tt.want {
+			t.Errorf("maskTarget(%s, %q) = %q, want %q", tt.channel, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHandleDeliveriesMasksTargets(t *testing.T) {
+	agent := &WeatherAgent{deliveries: newDeliveryLog()}
+	agent.deliveries.record(Delivery{MessageID: "m1", Channel: ChannelWebhook, Target: "https://hooks.example.com/secret-path", Status: DeliveryDelivered})
+
+	get := func(handler http.HandlerFunc) DeliveriesResponse {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/deliveries", nil))
+		var resp DeliveriesResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+	if resp := get(agent.handleDeliveries); len(resp.Deliveries) != 1 || resp.Deliveries[0].Target != "https://hooks.example.com/…" {
+		t.Errorf("deliveries = %+v", resp.Deliveries)
+	}
+	if resp := get(agent.handleAdminDeliveries); len(resp.Deliveries) != 1 || resp.Deliveries[0].Target != "https://hooks.example.com/secret-path" {
+		t.Errorf("admin deliveries = %+v", resp.Deliveries)
+	}
+	// The log itself keeps the full target
+	if list := agent.deliveries.list("", "", 0); list[0].Target != "https://hooks.example.com/secret-path" {
+		t.Errorf("log target = %q", list[0].Target)
+	}
+}
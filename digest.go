@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Number of forecast days included in the daily digest
+const digestForecastDays = 3
+
+// Build the morning digest for the configured location and each subscriber
+// location, and send each to its recipients
+func (agent *WeatherAgent) sendDailyDigest() error {
+	return agent.forEachLocation(NotificationDigest, agent.sendDigestAt)
+}
+
+// Build and send the digest for one location (nil for the configured one)
+func (agent *WeatherAgent) sendDigestAt(loc *ProfileLocation) error {
+	if loc == nil && !agent.hasRecipients(NotificationDigest) {
+		agent.logger.Printf("Skipping daily digest: no recipients")
+		return nil
+	}
+
+	weather, err := agent.weatherAt(loc)
+	if err != nil {
+		return fmt.Errorf("error fetching weather: %v", err)
+	}
+
+	lat, lon, err := agent.coordinatesAt(loc)
+	if err != nil {
+		return fmt.Errorf("error resolving location: %v", err)
+	}
+
+	forecast, err := agent.fetchForecast(lat, lon, digestForecastDays)
+	if err != nil {
+		return fmt.Errorf("error fetching forecast: %v", err)
+	}
+
+	message, err := agent.generateDigestMessage(weather, forecast)
+	if err != nil {
+		return fmt.Errorf("error generating digest message: %v", err)
+	}
+
+	localTime := time.Unix(weather.Dt, 0).In(time.FixedZone("Local", weather.Timezone))
+	agent.notify(Notification{
+		Type:     NotificationDigest,
+		Title:    fmt.Sprintf("Weather for %s - %s", weather.Name, localTime.Format("Monday, January 2")),
+		Message:  message,
+		City:     weather.Name,
+		Country:  weather.Sys.Country,
+		Location: subscriberLocationKey(loc),
+		Units:    agent.config.Units,
+		Data:     agent.prepareWeatherData(weather),
+		Forecast: forecast.Days,
+	})
+
+	return nil
+}
+
+// Ask the LLM for a morning briefing covering current conditions and the forecast
+func (agent *WeatherAgent) generateDigestMessage(weather WeatherResponse, forecast Forecast) (string, error) {
+	weatherData := agent.prepareWeatherData(weather)
+
+	keys := make([]string, 0, len(weatherData))
+	for key := range weatherData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var prompt strings.Builder
+	prompt.WriteString("Current Weather Data:\n")
+	for _, key := range keys {
+		prompt.WriteString(fmt.Sprintf("%s: %v\n", key, weatherData[key]))
+	}
+
+	prompt.WriteString("\nForecast:\n")
+	for _, day := range forecast.Days {
+		prompt.WriteString(fmt.Sprintf("- %s: %s, high %.1f%s, low %.1f%s, %d%% chance of precipitation, sunrise %s, sunset %s\n",
+			day.Date, day.Description, day.TempMax, agent.getTempUnit(), day.TempMin, agent.getTempUnit(),
+			day.PrecipitationProbability, day.Sunrise, day.Sunset))
+	}
+
+	prompt.WriteString(`
+Write a short morning weather digest for an email. Summarize today's outlook first (what to wear, whether to bring an umbrella),
+then briefly mention anything notable in the next couple of days. Keep it to one short paragraph.`)
+
+	message, err := agent.callLLM(prompt.String())
+	if errors.Is(err, errNoLLMKey) || errors.Is(err, errLLMBudgetExceeded) || errors.Is(err, errCircuitOpen) {
+		agent.logger.Printf("LLM unavailable (%v), using a template digest", err)
+		return agent.renderTemplateDigest(weather, forecast), nil
+	}
+	return message, err
+}
+
+// Parse a "HH:MM" time of day
+func parseTimeOfDay(value string) (int, int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// Next occurrence of hour:minute after now, in now's location
+func nextDailyRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Send the daily digest every day at the configured time (server local time)
+func (agent *WeatherAgent) runDigestScheduler(digestTime string) {
+	hour, minute, err := parseTimeOfDay(digestTime)
+	if err != nil {
+		agent.logger.Printf("Daily digest disabled: %v", err)
+		return
+	}
+
+	for {
+		next := nextDailyRun(time.Now(), hour, minute)
+		agent.logger.Printf("Next daily digest scheduled for %s", next.Format(time.RFC1123))
+		time.Sleep(time.Until(next))
+
+		if err := agent.sendDailyDigest(); err != nil {
+			agent.logger.Printf("Error sending daily digest: %v", err)
+		}
+	}
+}
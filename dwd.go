@@ -0,0 +1,503 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Deutscher Wetterdienst settings
+const (
+	dwdMOSMIXURL        = "https://opendata.dwd.de/weather/local_forecasts/mos/MOSMIX_L/single_stations/%s/kml/MOSMIX_L_LATEST_%s.kmz"
+	dwdStationCatalog   = "https://www.dwd.de/DE/leistungen/met_verfahren_mosmix/mosmix_stationskatalog.cfg?view=nasPublication"
+	dwdWarningsURL      = "https://maps.dwd.de/geoserver/dwd/ows"
+	dwdMOSMIXCacheTTL   = time.Hour      // MOSMIX_L is issued four times a day
+	dwdCatalogCacheTTL  = 24 * time.Hour // Stations are rarely added
+	dwdWarningsCacheTTL = 5 * time.Minute
+	dwdMaxStationKm     = 40 // Beyond this a station's forecast doesn't describe the location
+	dwdSource           = "DWD"
+)
+
+// MOSMIX station IDs are WMO numbers or DWD-assigned codes such as P0489
+var dwdStationPattern = regexp.MustCompile(`^[A-Z0-9]{4,5}$`)
+
+// Descriptions of the present weather (ww) codes MOSMIX forecasts
+var dwdWeatherDescriptions = map[int]string{
+	0: "clear sky", 1: "mainly clear", 2: "partly cloudy", 3: "overcast",
+	45: "fog", 49: "freezing fog",
+	51: "light drizzle", 53: "drizzle", 55: "heavy drizzle",
+	56: "light freezing drizzle", 57: "heavy freezing drizzle",
+	61: "light rain", 63: "rain", 65: "heavy rain",
+	66: "light freezing rain", 67: "heavy freezing rain",
+	68: "light sleet", 69: "heavy sleet",
+	71: "light snow", 73: "snow", 75: "heavy snow", 77: "snow grains",
+	80: "light rain showers", 81: "rain showers", 82: "heavy rain showers",
+	83: "light sleet showers", 84: "heavy sleet showers",
+	85: "light snow showers", 86: "heavy snow showers",
+	95: "thunderstorm", 96: "thunderstorm with hail",
+}
+
+// Whether a country code is covered by DWD's MOSMIX forecasts and warnings
+func dwdCovers(country string) bool {
+	return strings.EqualFold(strings.TrimSpace(country), "DE")
+}
+
+// An official warning in effect for the location, e.g. from the DWD
+type WeatherWarning struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`   // Issuing service, e.g. "DWD"
+	Event       string    `json:"event"`    // Event type in the issuer's language, e.g. "STURMBÖEN"
+	Severity    string    `json:"severity"` // CAP severity: Minor, Moderate, Severe or Extreme
+	Headline    string    `json:"headline"`
+	Description string    `json:"description,omitempty"`
+	Instruction string    `json:"instruction,omitempty"`
+	Onset       time.Time `json:"onset"`
+	Expires     time.Time `json:"expires"`
+}
+
+// A MOSMIX forecast station
+type dwdStation struct {
+	ID   string
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// Parse the fixed-width MOSMIX station catalog. Coordinates are given in
+// degrees and minutes, e.g. 52.34 for 52°34'.
+func parseDWDStationCatalog(body []byte) []dwdStation {
+	var stations []dwdStation
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 32 || strings.HasPrefix(line, "ID") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		fields := strings.Fields(line[31:])
+		if len(fields) < 2 {
+			continue
+		}
+		lat, latErr := strconv.ParseFloat(fields[0], 64)
+		lon, lonErr := strconv.ParseFloat(fields[1], 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		stations = append(stations, dwdStation{
+			ID:   strings.TrimSpace(line[:5]),
+			Name: strings.TrimSpace(line[11:31]),
+			Lat:  degreesMinutes(lat),
+			Lon:  degreesMinutes(lon),
+		})
+	}
+	return stations
+}
+
+// Convert a degrees.minutes value such as 52.34 to decimal degrees
+func degreesMinutes(value float64) float64 {
+	degrees := math.Trunc(value)
+	minutes := math.Round((value - degrees) * 100)
+	return degrees + minutes/60
+}
+
+// The station nearest to the coordinates and its distance
+func nearestDWDStation(stations []dwdStation, lat, lon float64) (dwdStation, float64, bool) {
+	var nearest dwdStation
+	best := math.Inf(1)
+	for _, s := range stations {
+		if d := distanceKm(lat, lon, s.Lat, s.Lon); d < best {
+			nearest, best = s, d
+		}
+	}
+	return nearest, best, !math.IsInf(best, 1)
+}
+
+// A MOSMIX station forecast: hourly time steps and, per element, a value
+// for each step (nil when missing)
+type mosmixForecast struct {
+	Station  string
+	Times    []time.Time
+	Elements map[string][]*float64
+}
+
+// Value of an element at step i, false when missing
+func (f mosmixForecast) value(element string, i int) (float64, bool) {
+	values := f.Elements[element]
+	if i < 0 || i >= len(values) || values[i] == nil {
+		return 0, false
+	}
+	return *values[i], true
+}
+
+// Step nearest to now, false when no step is within half an hour
+func (f mosmixForecast) stepAt(now time.Time) (int, bool) {
+	for i, t := range f.Times {
+		if d := now.Sub(t); d > -30*time.Minute && d <= 30*time.Minute {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Parse a MOSMIX_L single-station KMZ (a zip holding one KML document)
+func parseMOSMIX(kmz []byte) (mosmixForecast, error) {
+	archive, err := zip.NewReader(bytes.NewReader(kmz), int64(len(kmz)))
+	if err != nil || len(archive.File) == 0 {
+		return mosmixForecast{}, fmt.Errorf("failed to open MOSMIX archive: %v", err)
+	}
+	file, err := archive.File[0].Open()
+	if err != nil {
+		return mosmixForecast{}, fmt.Errorf("failed to open MOSMIX document: %v", err)
+	}
+	defer file.Close()
+	return parseMOSMIXKML(file)
+}
+
+// Parse the KML document inside a MOSMIX KMZ
+func parseMOSMIXKML(r io.Reader) (mosmixForecast, error) {
+	var doc struct {
+		Document struct {
+			TimeSteps []string `xml:"ExtendedData>ProductDefinition>ForecastTimeSteps>TimeStep"`
+			Placemark struct {
+				Name      string `xml:"name"`
+				Forecasts []struct {
+					Element string `xml:"elementName,attr"`
+					Value   string `xml:"value"`
+				} `xml:"ExtendedData>Forecast"`
+			} `xml:"Placemark"`
+		} `xml:"Document"`
+	}
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = latin1Reader
+	if err := decoder.Decode(&doc); err != nil {
+		return mosmixForecast{}, fmt.Errorf("failed to parse MOSMIX document: %v", err)
+	}
+	if len(doc.Document.TimeSteps) == 0 {
+		return mosmixForecast{}, fmt.Errorf("no time steps in MOSMIX document")
+	}
+
+	forecast := mosmixForecast{
+		Station:  strings.TrimSpace(doc.Document.Placemark.Name),
+		Elements: make(map[string][]*float64),
+	}
+	for _, step := range doc.Document.TimeSteps {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(step))
+		if err != nil {
+			return mosmixForecast{}, fmt.Errorf("invalid MOSMIX time step %q", step)
+		}
+		forecast.Times = append(forecast.Times, t)
+	}
+	for _, f := range doc.Document.Placemark.Forecasts {
+		var values []*float64
+		for _, field := range strings.Fields(f.Value) {
+			// Missing values are written as "-"
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, &v)
+		}
+		forecast.Elements[f.Element] = values
+	}
+	return forecast, nil
+}
+
+// Decode ISO-8859-1, which MOSMIX documents are declared as, to UTF-8
+func latin1Reader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "ISO-8859-1") && !strings.EqualFold(charset, "latin1") {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	raw, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+// Relative humidity (%) from temperature and dew point in °C (Magnus formula)
+func relativeHumidity(tempC, dewPointC float64) float64 {
+	const a, b = 17.625, 243.04
+	rh := 100 * math.Exp(a*dewPointC/(b+dewPointC)) / math.Exp(a*tempC/(b+tempC))
+	return math.Max(0, math.Min(100, rh))
+}
+
+// Station to use for coordinates: DWD_STATION if set, otherwise the nearest
+// one in the MOSMIX catalog
+func (agent *WeatherAgent) dwdStationFor(lat, lon float64) (string, error) {
+	if agent.config.DWDStation != "" {
+		return agent.config.DWDStation, nil
+	}
+	body, _, err := agent.cachedGet(dwdStationCatalog, dwdCatalogCacheTTL, false)
+	if err != nil {
+		return "", fmt.Errorf("MOSMIX station catalog request failed: %v", err)
+	}
+	station, distance, ok := nearestDWDStation(parseDWDStationCatalog(body), lat, lon)
+	if !ok {
+		return "", fmt.Errorf("no stations in the MOSMIX catalog")
+	}
+	if distance > dwdMaxStationKm {
+		return "", fmt.Errorf("nearest MOSMIX station %s (%s) is %.0f km away", station.ID, station.Name, distance)
+	}
+	return station.ID, nil
+}
+
+// Fetch the latest MOSMIX_L forecast for the station nearest the coordinates
+func (agent *WeatherAgent) fetchMOSMIX(lat, lon float64) (mosmixForecast, error) {
+	station, err := agent.dwdStationFor(lat, lon)
+	if err != nil {
+		return mosmixForecast{}, err
+	}
+	body, _, err := agent.cachedGet(fmt.Sprintf(dwdMOSMIXURL, station, station), dwdMOSMIXCacheTTL, false)
+	if err != nil {
+		return mosmixForecast{}, fmt.Errorf("MOSMIX request failed: %v", err)
+	}
+	return parseMOSMIX(body)
+}
+
+// Parse a DWD warnings WFS response into warnings, most severe first
+func parseDWDWarnings(body []byte) ([]WeatherWarning, error) {
+	var resp struct {
+		Features []struct {
+			Properties struct {
+				Identifier  string `json:"IDENTIFIER"`
+				Event       string `json:"EVENT"`
+				Severity    string `json:"SEVERITY"`
+				Headline    string `json:"HEADLINE"`
+				Description string `json:"DESCRIPTION"`
+				Instruction string `json:"INSTRUCTION"`
+				Onset       string `json:"ONSET"`
+				Expires     string `json:"EXPIRES"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse DWD warnings: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var warnings []WeatherWarning
+	for _, f := range resp.Features {
+		p := f.Properties
+		if p.Identifier == "" || seen[p.Identifier] {
+			continue
+		}
+		seen[p.Identifier] = true
+		warning := WeatherWarning{
+			ID:          p.Identifier,
+			Source:      dwdSource,
+			Event:       p.Event,
+			Severity:    p.Severity,
+			Headline:    p.Headline,
+			Description: p.Description,
+			Instruction: p.Instruction,
+		}
+		warning.Onset, _ = time.Parse(time.RFC3339, p.Onset)
+		warning.Expires, _ = time.Parse(time.RFC3339, p.Expires)
+		warnings = append(warnings, warning)
+	}
+	sortWarnings(warnings)
+	return warnings, nil
+}
+
+// CAP severities, most severe first
+var warningSeverities = []string{"Extreme", "Severe", "Moderate", "Minor"}
+
+// Rank of a CAP severity, 0 for the most severe; unknown values sort last
+func severityRank(severity string) int {
+	for i, s := range warningSeverities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return len(warningSeverities)
+}
+
+// Order warnings most severe first, then by onset
+func sortWarnings(warnings []WeatherWarning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		ri, rj := severityRank(warnings[i].Severity), severityRank(warnings[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		return warnings[i].Onset.Before(warnings[j].Onset)
+	})
+}
+
+// Fetch the DWD warnings for the municipality containing the coordinates
+func (agent *WeatherAgent) fetchDWDWarnings(lat, lon float64) ([]WeatherWarning, error) {
+	query := url.Values{}
+	query.Set("service", "WFS")
+	query.Set("version", "2.0.0")
+	query.Set("request", "GetFeature")
+	query.Set("typeName", "dwd:Warnungen_Gemeinden")
+	query.Set("outputFormat", "application/json")
+	// WFS 2.0 takes EPSG:4326 points as latitude, longitude
+	query.Set("CQL_FILTER", fmt.Sprintf("CONTAINS(THE_GEOM,POINT(%.4f %.4f))", lat, lon))
+
+	body, _, err := agent.cachedGet(dwdWarningsURL+"?"+query.Encode(), dwdWarningsCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("DWD warnings request failed: %v", err)
+	}
+	return parseDWDWarnings(body)
+}
+
+// Replace Open-Meteo's current conditions with the nearest MOSMIX station's
+// and attach DWD warnings for German locations when enabled. Open-Meteo's
+// data stands if the DWD is unavailable.
+func (agent *WeatherAgent) applyDWD(weather *WeatherResponse, lat, lon float64, now time.Time) {
+	if !agent.config.DWDEnabled || !dwdCovers(weather.Sys.Country) {
+		return
+	}
+
+	if warnings, err := agent.fetchDWDWarnings(lat, lon); err != nil {
+		agent.logger.Printf("Warning: Failed to fetch DWD warnings: %v", err)
+	} else {
+		weather.Warnings = warnings
+	}
+
+	forecast, err := agent.fetchMOSMIX(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch MOSMIX forecast, keeping Open-Meteo data: %v", err)
+		return
+	}
+	step, ok := forecast.stepAt(now)
+	if !ok {
+		agent.logger.Printf("Warning: MOSMIX forecast for %s doesn't cover %s, keeping Open-Meteo data", forecast.Station, now.UTC().Format(time.RFC3339))
+		return
+	}
+	kelvin, ok := forecast.value("TTT", step)
+	if !ok {
+		agent.logger.Printf("Warning: MOSMIX forecast for %s has no temperature, keeping Open-Meteo data", forecast.Station)
+		return
+	}
+
+	system := agent.units()
+	temp := units.Celsius(kelvin - 273.15)
+	weather.Main.Temp = temp.In(system)
+	feelsLike := temp
+	var wind units.Speed
+	if speed, ok := forecast.value("FF", step); ok {
+		wind = units.MetersPerSecond(speed)
+		weather.Wind.Speed = wind.In(system)
+	}
+	if dewPoint, ok := forecast.value("Td", step); ok {
+		humidity := relativeHumidity(temp.Celsius(), dewPoint-273.15)
+		weather.Main.Humidity = int(humidity + 0.5)
+		if heatIndex, ok := units.HeatIndex(temp, humidity); ok {
+			feelsLike = heatIndex
+		}
+	}
+	if windChill, ok := units.WindChill(temp, wind); ok {
+		feelsLike = windChill
+	}
+	weather.Main.FeelsLike = feelsLike.In(system)
+	if direction, ok := forecast.value("DD", step); ok {
+		weather.Wind.Deg = int(direction + 0.5)
+	}
+	if gust, ok := forecast.value("FX1", step); ok {
+		weather.Wind.Gust = units.MetersPerSecond(gust).In(system)
+	}
+	if pressure, ok := forecast.value("PPPP", step); ok {
+		weather.Main.Pressure = int(pressure/100 + 0.5)
+	}
+	if clouds, ok := forecast.value("N", step); ok {
+		weather.Clouds.All = int(clouds + 0.5)
+	}
+	if visibility, ok := forecast.value("VV", step); ok {
+		weather.Visibility = int(visibility + 0.5)
+	}
+	if rain, ok := forecast.value("RR1c", step); ok {
+		weather.Rain.OneHour = rain
+	}
+	if ww, ok := forecast.value("ww", step); ok && len(weather.Weather) > 0 {
+		code := int(ww)
+		description, known := dwdWeatherDescriptions[code]
+		if !known {
+			description = agent.weatherCodeToDescription(code)
+		}
+		weather.Weather[0].ID = code
+		weather.Weather[0].Main = agent.weatherCodeToCondition(code)
+		weather.Weather[0].Description = description
+	}
+
+	// The rest of today's chance of precipitation
+	loc := time.FixedZone("Local", weather.Timezone)
+	today := now.In(loc).Format("2006-01-02")
+	var precip []HourlyValue
+	for i, t := range forecast.Times {
+		if chance, ok := forecast.value("wwP", i); ok && t.In(loc).Format("2006-01-02") == today {
+			precip = append(precip, HourlyValue{Time: t.Unix(), Value: chance})
+		}
+	}
+	if len(precip) > 0 {
+		weather.HourlyPrecipProb = precip
+	}
+	weather.Source = dwdSource
+}
+
+// Add official warnings to the LLM data map
+func addWarningData(weather WeatherResponse, data map[string]interface{}) {
+	if len(weather.Warnings) == 0 {
+		return
+	}
+	loc := time.FixedZone("Local", weather.Timezone)
+	var warnings []string
+	for _, w := range weather.Warnings {
+		line := fmt.Sprintf("%s (%s, %s)", w.Headline, strings.ToLower(w.Severity), w.Source)
+		if !w.Expires.IsZero() {
+			line += " until " + w.Expires.In(loc).Format("Mon 3:04 PM")
+		}
+		warnings = append(warnings, line)
+	}
+	data["official_warnings"] = warnings
+}
+
+// Notify about official warnings that haven't been sent yet
+func (agent *WeatherAgent) checkWarningAlerts(weather WeatherResponse) {
+	if len(weather.Warnings) == 0 || !agent.hasRecipients(NotificationAlert) {
+		return
+	}
+
+	var weatherData map[string]interface{}
+	for _, w := range weather.Warnings {
+		if !agent.warningAlerts.markSent(weather.Name + "|" + w.ID) {
+			continue
+		}
+		if weatherData == nil {
+			weatherData = agent.prepareWeatherData(weather)
+		}
+
+		message := w.Description
+		if w.Instruction != "" {
+			message += "\n\n" + w.Instruction
+		}
+		agent.notify(Notification{
+			Type:      NotificationAlert,
+			AlertType: "official_warning",
+			Severity:  strings.ToLower(w.Severity),
+			Title:     fmt.Sprintf("%s: %s", weather.Name, w.Headline),
+			Message:   message,
+			City:      weather.Name,
+			Country:   weather.Sys.Country,
+			Units:     agent.config.Units,
+			Data:      weatherData,
+		})
+	}
+}
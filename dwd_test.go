@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fixtureDWDCatalog = `ID    ICAO NAME                 LAT    LON     ELEV
+----- ---- -------------------- -----  ------- -----
+10381 EDDB BERLIN-DAHLEM         52.28   13.18    51
+10382 EDDT BERLIN-TEGEL          52.34   13.19    36
+10865 EDDM MUENCHEN-STADT        48.10   11.33   515
+`
+
+const fixtureMOSMIXKML = `<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>
+<kml:kml xmlns:dwd="https://opendata.dwd.de/weather/lib/pointforecast_dwd_extension_V1_0.xsd" xmlns:kml="http://www.opengis.net/kml/2.2">
+  <kml:Document>
+    <kml:ExtendedData>
+      <dwd:ProductDefinition>
+        <dwd:Issuer>Deutscher Wetterdienst</dwd:Issuer>
+        <dwd:ProductID>MOSMIX</dwd:ProductID>
+        <dwd:ForecastTimeSteps>
+          <dwd:TimeStep>2024-06-15T12:00:00.000Z</dwd:TimeStep>
+          <dwd:TimeStep>2024-06-15T13:00:00.000Z</dwd:TimeStep>
+          <dwd:TimeStep>2024-06-15T22:00:00.000Z</dwd:TimeStep>
+        </dwd:ForecastTimeSteps>
+      </dwd:ProductDefinition>
+    </kml:ExtendedData>
+    <kml:Placemark>
+      <kml:name>10382</kml:name>
+      <kml:description>BERLIN-TEGEL</kml:description>
+      <kml:ExtendedData>
+        <dwd:Forecast dwd:elementName="TTT"><dwd:value>     294.15     295.15     288.15</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="Td"><dwd:value>     283.15     284.15     285.15</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="FF"><dwd:value>       4.00       5.00       2.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="DD"><dwd:value>     250.00     262.00     240.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="FX1"><dwd:value>       9.00      11.00          -</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="PPPP"><dwd:value>  101200.00  101150.00  101100.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="N"><dwd:value>      60.00      88.00      20.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="VV"><dwd:value>   30000.00   25000.00          -</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="RR1c"><dwd:value>       0.00       0.40       0.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="ww"><dwd:value>       2.00      61.00       1.00</dwd:value></dwd:Forecast>
+        <dwd:Forecast dwd:elementName="wwP"><dwd:value>      10.00      55.00       5.00</dwd:value></dwd:Forecast>
+      </kml:ExtendedData>
+      <kml:Point><kml:coordinates>13.32,52.57,36.0</kml:coordinates></kml:Point>
+    </kml:Placemark>
+  </kml:Document>
+</kml:kml>`
+
+const fixtureDWDWarnings = `{"type":"FeatureCollection","features":[
+	{"type":"Feature","properties":{"IDENTIFIER":"2.49.0.0.276.0.DWD.PVW.1","EVENT":"STARKREGEN","SEVERITY":"Moderate",
+		"HEADLINE":"Amtliche WARNUNG vor STARKREGEN","DESCRIPTION":"Es tritt Starkregen auf.","INSTRUCTION":"",
+		"ONSET":"2024-06-15T14:00:00Z","EXPIRES":"2024-06-15T18:00:00Z"}},
+	{"type":"Feature","properties":{"IDENTIFIER":"2.49.0.0.276.0.DWD.PVW.2","EVENT":"SCHWERES GEWITTER","SEVERITY":"Severe",
+		"HEADLINE":"Amtliche UNWETTERWARNUNG vor SCHWEREM GEWITTER","DESCRIPTION":"Es treten schwere Gewitter auf.","INSTRUCTION":"Schließen Sie alle Fenster.",
+		"ONSET":"2024-06-15T15:00:00Z","EXPIRES":"2024-06-15T20:00:00Z"}},
+	{"type":"Feature","properties":{"IDENTIFIER":"2.49.0.0.276.0.DWD.PVW.1","EVENT":"STARKREGEN","SEVERITY":"Moderate",
+		"HEADLINE":"Amtliche WARNUNG vor STARKREGEN","ONSET":"2024-06-15T14:00:00Z","EXPIRES":"2024-06-15T18:00:00Z"}}
+]}`
+
+// Wrap a KML document in a KMZ archive
+func kmz(t *testing.T, kml string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("MOSMIX_L_2024061509_10382.kml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(kml))
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseDWDStationCatalog(t *testing.T) {
+	stations := parseDWDStationCatalog([]byte(fixtureDWDCatalog))
+	if len(stations) != 3 {
+		t.Fatalf("parsed %d stations, want 3: %+v", len(stations), stations)
+	}
+	tegel := stations[1]
+	if tegel.ID != "10382" || tegel.Name != "BERLIN-TEGEL" || math.Abs(tegel.Lat-52.5667) > 1e-3 || math.Abs(tegel.Lon-13.3167) > 1e-3 {
+		t.Errorf("Tegel = %+v, want 52°34' 13°19'", tegel)
+	}
+
+	station, distance, ok := nearestDWDStation(stations, 52.55, 13.29)
+	if !ok || station.ID != "10382" || distance > 5 {
+		t.Errorf("nearest to Tegel = %+v, %.1f km", station, distance)
+	}
+	if _, _, ok := nearestDWDStation(nil, 52.55, 13.29); ok {
+		t.Error("nearest of no stations: expected false")
+	}
+}
+
+func TestParseMOSMIX(t *testing.T) {
+	forecast, err := parseMOSMIX(kmz(t, fixtureMOSMIXKML))
+	if err != nil {
+		t.Fatalf("parseMOSMIX() error: %v", err)
+	}
+	if forecast.Station != "10382" || len(forecast.Times) != 3 {
+		t.Fatalf("forecast = %+v", forecast)
+	}
+	if v, ok := forecast.value("PPPP", 1); !ok || v != 101150 {
+		t.Errorf("PPPP[1] = %v, %v", v, ok)
+	}
+	if _, ok := forecast.value("FX1", 2); ok {
+		t.Error("missing value \"-\" should not parse")
+	}
+	if _, ok := forecast.value("SunD1", 0); ok {
+		t.Error("absent element should not have values")
+	}
+
+	if step, ok := forecast.stepAt(time.Date(2024, 6, 15, 13, 20, 0, 0, time.UTC)); !ok || step != 1 {
+		t.Errorf("stepAt(13:20) = %d, %v, want 1", step, ok)
+	}
+	if _, ok := forecast.stepAt(time.Date(2024, 6, 15, 17, 0, 0, 0, time.UTC)); ok {
+		t.Error("stepAt(17:00) is outside every step: expected false")
+	}
+
+	if _, err := parseMOSMIX([]byte("not a zip")); err == nil {
+		t.Error("parseMOSMIX() with a bad archive: expected error")
+	}
+}
+
+func TestRelativeHumidity(t *testing.T) {
+	if rh := relativeHumidity(20, 20); math.Abs(rh-100) > 1e-9 {
+		t.Errorf("saturated air = %.1f%%, want 100%%", rh)
+	}
+	if rh := relativeHumidity(22, 12); math.Abs(rh-53) > 1 {
+		t.Errorf("22°C with a 12°C dew point = %.1f%%, want about 53%%", rh)
+	}
+}
+
+func TestParseDWDWarnings(t *testing.T) {
+	warnings, err := parseDWDWarnings([]byte(fixtureDWDWarnings))
+	if err != nil {
+		t.Fatalf("parseDWDWarnings() error: %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("got %d warnings, want 2 after removing the duplicate", len(warnings))
+	}
+	if warnings[0].Severity != "Severe" || warnings[0].Source != "DWD" || warnings[0].Instruction == "" {
+		t.Errorf("first warning = %+v, want the severe thunderstorm", warnings[0])
+	}
+	if !warnings[1].Expires.Equal(time.Date(2024, 6, 15, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("expiry = %v", warnings[1].Expires)
+	}
+}
+
+func TestApplyDWD(t *testing.T) {
+	handlers := defaultFixtures()
+	handlers["www.dwd.de"] = serveJSON(fixtureDWDCatalog)
+	handlers["maps.dwd.de"] = serveJSON(fixtureDWDWarnings)
+	archive := kmz(t, fixtureMOSMIXKML)
+	handlers["opendata.dwd.de"] = func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/10382/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}
+	useFixtures(t, handlers)
+	now := time.Date(2024, 6, 15, 13, 20, 0, 0, time.UTC)
+
+	agent := newFixtureAgent(t, Config{City: "Berlin", CountryCode: "DE", DWDEnabled: true})
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(`{"weather":[{"id":3,"main":"Clouds"}],"main":{"temp":99},"sys":{"country":"DE"},"timezone":7200}`), &weather); err != nil {
+		t.Fatal(err)
+	}
+	agent.applyDWD(&weather, 52.55, 13.29, now)
+
+	if weather.Source != "DWD" || math.Abs(weather.Main.Temp-22) > 1e-9 || weather.Main.Pressure != 1012 || weather.Main.Humidity != 50 {
+		t.Errorf("conditions = %+v, source %q", weather.Main, weather.Source)
+	}
+	if math.Abs(weather.Wind.Speed-18) > 1e-9 || math.Abs(weather.Wind.Gust-39.6) > 1e-9 || weather.Wind.Deg != 262 {
+		t.Errorf("wind = %+v, want km/h", weather.Wind)
+	}
+	if weather.Clouds.All != 88 || weather.Visibility != 25000 || weather.Rain.OneHour != 0.4 {
+		t.Errorf("clouds %d, visibility %d, rain %v", weather.Clouds.All, weather.Visibility, weather.Rain.OneHour)
+	}
+	if w := weather.Weather[0]; w.ID != 61 || w.Main != "Rain" || w.Description != "light rain" {
+		t.Errorf("weather = %+v", w)
+	}
+	// 22:00Z is already tomorrow in UTC+2
+	if len(weather.HourlyPrecipProb) != 2 || weather.HourlyPrecipProb[1].Value != 55 {
+		t.Errorf("precipitation chance = %v", weather.HourlyPrecipProb)
+	}
+	if len(weather.Warnings) != 2 {
+		t.Errorf("warnings = %+v", weather.Warnings)
+	}
+
+	data := map[string]interface{}{}
+	addWarningData(weather, data)
+	lines, _ := data["official_warnings"].([]string)
+	if len(lines) != 2 || !strings.Contains(lines[0], "UNWETTERWARNUNG") || !strings.Contains(lines[0], "until Sat 10:00 PM") {
+		t.Errorf("official_warnings = %q", lines)
+	}
+
+	// Disabled or outside Germany, Open-Meteo's data stands
+	agent.config.DWDEnabled = false
+	other := WeatherResponse{}
+	other.Sys.Country = "DE"
+	other.Main.Temp = 14
+	agent.applyDWD(&other, 52.55, 13.29, now)
+	if other.Source != "" || other.Main.Temp != 14 || other.Warnings != nil {
+		t.Errorf("disabled DWD changed conditions: %+v, source %q", other.Main, other.Source)
+	}
+}
+
+func TestApplyDWDFarFromStations(t *testing.T) {
+	handlers := defaultFixtures()
+	handlers["www.dwd.de"] = serveJSON(fixtureDWDCatalog)
+	handlers["maps.dwd.de"] = serveJSON(`{"type":"FeatureCollection","features":[]}`)
+	fixtures := useFixtures(t, handlers)
+
+	agent := newFixtureAgent(t, Config{City: "Hamburg", CountryCode: "DE", DWDEnabled: true})
+	weather := WeatherResponse{}
+	weather.Sys.Country = "DE"
+	weather.Main.Temp = 16
+	agent.applyDWD(&weather, 53.55, 9.99, time.Date(2024, 6, 15, 13, 0, 0, 0, time.UTC))
+
+	if weather.Source != "" || weather.Main.Temp != 16 {
+		t.Errorf("used a station over %d km away: %+v", dwdMaxStationKm, weather.Main)
+	}
+	if fixtures.count("opendata.dwd.de") != 0 {
+		t.Error("fetched a MOSMIX forecast without a station in range")
+	}
+}
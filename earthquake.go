@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// USGS earthquake feed settings
+const (
+	usgsFeedURL          = "https://earthquake.usgs.gov/earthquakes/feed/v1.0/summary/%s_day.geojson"
+	earthquakeCacheTTL   = 5 * time.Minute // The feeds update every minute
+	earthquakeMaxAge     = 24 * time.Hour
+	earthquakeDataMaxAge = 6 * time.Hour // Quakes older than this drop out of the weather message
+)
+
+// A recent earthquake near the location
+type Earthquake struct {
+	ID         string    `json:"id"`
+	Magnitude  float64   `json:"magnitude"`
+	Place      string    `json:"place"` // USGS description, e.g. "10 km NE of Ridgecrest, CA"
+	Time       time.Time `json:"time"`
+	DepthKm    float64   `json:"depth_km"`
+	DistanceKm float64   `json:"distance_km"`
+	Tsunami    bool      `json:"tsunami"`               // Tsunami Warning Center message issued
+	PAGERAlert string    `json:"pager_alert,omitempty"` // Impact estimate: green, yellow, orange or red
+	URL        string    `json:"url"`
+}
+
+// Smallest USGS summary feed that includes every quake of at least minMagnitude
+func usgsFeedFor(minMagnitude float64) string {
+	switch {
+	case minMagnitude >= 4.5:
+		return fmt.Sprintf(usgsFeedURL, "4.5")
+	case minMagnitude >= 2.5:
+		return fmt.Sprintf(usgsFeedURL, "2.5")
+	case minMagnitude >= 1:
+		return fmt.Sprintf(usgsFeedURL, "1.0")
+	}
+	return fmt.Sprintf(usgsFeedURL, "all")
+}
+
+// Parse a USGS GeoJSON feed into quakes of at least minMagnitude within
+// radiusKm of the location, most recent first
+func parseEarthquakes(body []byte, lat, lon float64, radiusKm int, minMagnitude float64) ([]Earthquake, error) {
+	var feed struct {
+		Features []struct {
+			ID         string `json:"id"`
+			Properties struct {
+				Mag     *float64 `json:"mag"`
+				Place   string   `json:"place"`
+				Time    int64    `json:"time"` // Unix milliseconds
+				URL     string   `json:"url"`
+				Tsunami int      `json:"tsunami"`
+				Alert   *string  `json:"alert"`
+			} `json:"properties"`
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"` // Longitude, latitude, depth
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse earthquake feed: %v", err)
+	}
+
+	var quakes []Earthquake
+	for _, f := range feed.Features {
+		p := f.Properties
+		if p.Mag == nil || *p.Mag < minMagnitude || len(f.Geometry.Coordinates) < 3 {
+			continue
+		}
+		distance := distanceKm(lat, lon, f.Geometry.Coordinates[1], f.Geometry.Coordinates[0])
+		if distance > float64(radiusKm) {
+			continue
+		}
+		quake := Earthquake{
+			ID:         f.ID,
+			Magnitude:  *p.Mag,
+			Place:      p.Place,
+			Time:       time.UnixMilli(p.Time).UTC(),
+			DepthKm:    f.Geometry.Coordinates[2],
+			DistanceKm: math.Round(distance),
+			Tsunami:    p.Tsunami == 1,
+			URL:        p.URL,
+		}
+		if p.Alert != nil {
+			quake.PAGERAlert = *p.Alert
+		}
+		quakes = append(quakes, quake)
+	}
+	sort.Slice(quakes, func(i, j int) bool { return quakes[i].Time.After(quakes[j].Time) })
+	return quakes, nil
+}
+
+// One-line description, e.g. "M5.1 10 km NE of Ridgecrest, CA (85 km away, 2 hours ago)"
+func (q Earthquake) summary(now time.Time) string {
+	ago := now.Sub(q.Time)
+	when := fmt.Sprintf("%d minutes ago", int(ago.Minutes()))
+	if ago >= 2*time.Hour {
+		when = fmt.Sprintf("%d hours ago", int(ago.Hours()))
+	}
+	summary := fmt.Sprintf("M%.1f %s (%.0f km away, %s)", q.Magnitude, q.Place, q.DistanceKm, when)
+	if q.Tsunami {
+		summary += ", tsunami message issued"
+	}
+	return summary
+}
+
+// Alert severity from the PAGER impact level, or the magnitude when USGS
+// hasn't estimated the impact yet
+func (q Earthquake) severity() string {
+	switch {
+	case q.Tsunami || q.PAGERAlert == "red":
+		return "extreme"
+	case q.PAGERAlert == "orange":
+		return "severe"
+	case q.PAGERAlert == "yellow":
+		return "moderate"
+	case q.PAGERAlert == "green":
+		return "minor"
+	case q.Magnitude >= 7:
+		return "extreme"
+	case q.Magnitude >= 6:
+		return "severe"
+	case q.Magnitude >= 5:
+		return "moderate"
+	}
+	return "minor"
+}
+
+// Recent quakes near coordinates from the USGS feed
+func (agent *WeatherAgent) fetchEarthquakes(lat, lon float64) ([]Earthquake, error) {
+	body, _, err := agent.cachedGet(usgsFeedFor(agent.config.EarthquakeMinMagnitude), earthquakeCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("earthquake feed request failed: %v", err)
+	}
+	return parseEarthquakes(body, lat, lon, agent.config.EarthquakeRadiusKm, agent.config.EarthquakeMinMagnitude)
+}
+
+// Attach recent nearby earthquakes to the weather response when enabled
+func (agent *WeatherAgent) addEarthquakes(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureEarthquakes) {
+		return
+	}
+
+	quakes, err := agent.fetchEarthquakes(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch earthquakes: %v", err)
+		return
+	}
+	weather.Earthquakes = quakes
+}
+
+// Add quakes from the last few hours to the LLM data map
+func addEarthquakeData(weather WeatherResponse, data map[string]interface{}, now time.Time) {
+	var summaries []string
+	for _, quake := range weather.Earthquakes {
+		if now.Sub(quake.Time) <= earthquakeDataMaxAge {
+			summaries = append(summaries, quake.summary(now))
+		}
+	}
+	if len(summaries) > 0 {
+		data["recent_earthquakes"] = strings.Join(summaries, "; ")
+	}
+}
+
+// Send an alert for each nearby quake not yet reported. The feed covers a
+// day, so quakes are remembered by ID rather than re-sent on every poll.
+func (agent *WeatherAgent) checkEarthquakeAlerts(weather WeatherResponse) {
+	if len(weather.Earthquakes) == 0 || !agent.hasRecipients(NotificationAlert) {
+		return
+	}
+
+	now := time.Now()
+	var weatherData map[string]interface{}
+	for _, quake := range weather.Earthquakes {
+		if now.Sub(quake.Time) > earthquakeMaxAge || !agent.quakeAlerts.markSent(weather.Name+"|"+quake.ID) {
+			continue
+		}
+		if weatherData == nil {
+			weatherData = agent.prepareWeatherData(weather)
+		}
+
+		agent.notify(Notification{
+			Type:      NotificationAlert,
+			AlertType: "earthquake",
+			Severity:  quake.severity(),
+			Title:     fmt.Sprintf("M%.1f earthquake %.0f km from %s", quake.Magnitude, quake.DistanceKm, weather.Name),
+			Message:   quake.summary(now) + ". Details: " + quake.URL,
+			City:      weather.Name,
+			Country:   weather.Sys.Country,
+			Units:     agent.config.Units,
+			Data:      weatherData,
+		})
+	}
+}
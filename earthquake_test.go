@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleUSGSFeed = `{"type":"FeatureCollection","features":[
+	{"type":"Feature","id":"ci40000001","properties":{"mag":4.6,"place":"12 km NE of Ridgecrest, CA","time":1760700000000,
+	 "url":"https://earthquake.usgs.gov/earthquakes/eventpage/ci40000001","tsunami":0,"alert":"green"},
+	 "geometry":{"type":"Point","coordinates":[-117.58,35.70,8.2]}},
+	{"type":"Feature","id":"ci40000002","properties":{"mag":3.1,"place":"5 km S of Ridgecrest, CA","time":1760703600000,
+	 "url":"https://earthquake.usgs.gov/earthquakes/eventpage/ci40000002","tsunami":0,"alert":null},
+	 "geometry":{"type":"Point","coordinates":[-117.67,35.58,5.0]}},
+	{"type":"Feature","id":"us70000003","properties":{"mag":6.2,"place":"Near the coast of Honshu, Japan","time":1760703000000,
+	 "url":"https://earthquake.usgs.gov/earthquakes/eventpage/us70000003","tsunami":1,"alert":"yellow"},
+	 "geometry":{"type":"Point","coordinates":[141.5,38.2,30.0]}},
+	{"type":"Feature","id":"ci40000004","properties":{"mag":null,"place":"Unknown","time":1760703600000},
+	 "geometry":{"type":"Point","coordinates":[-117.6,35.6,1.0]}}
+]}`
+
+func TestParseEarthquakes(t *testing.T) {
+	// Los Angeles: Ridgecrest is ~180 km away, Japan is far out of range
+	quakes, err := parseEarthquakes([]byte(sampleUSGSFeed), 34.05, -118.24, 300, 2.5)
+	if err != nil {
+		t.Fatalf("parseEarthquakes() error = %v", err)
+	}
+	if len(quakes) != 2 {
+		t.Fatalf("got %d quakes, want 2: %+v", len(quakes), quakes)
+	}
+	if quakes[0].ID != "ci40000002" || quakes[1].ID != "ci40000001" {
+		t.Errorf("quakes = %s, %s; want most recent first", quakes[0].ID, quakes[1].ID)
+	}
+	if quakes[1].PAGERAlert != "green" || quakes[1].DepthKm != 8.2 {
+		t.Errorf("quake = %+v, want green alert at 8.2 km depth", quakes[1])
+	}
+
+	// The minimum magnitude filters out the M3.1
+	if quakes, _ := parseEarthquakes([]byte(sampleUSGSFeed), 34.05, -118.24, 300, 4); len(quakes) != 1 {
+		t.Errorf("got %d quakes of M4+, want 1", len(quakes))
+	}
+}
+
+func TestUSGSFeedFor(t *testing.T) {
+	tests := map[float64]string{5: "4.5_day", 4.5: "4.5_day", 4: "2.5_day", 1.5: "1.0_day", 0: "all_day"}
+	for minMagnitude, want := range tests {
+		if got := usgsFeedFor(minMagnitude); !strings.HasSuffix(got, want+".geojson") {
+			t.Errorf("usgsFeedFor(%g) = %s, want the %s feed", minMagnitude, got, want)
+		}
+	}
+}
+
+func TestAddEarthquakeData(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	weather := WeatherResponse{Earthquakes: []Earthquake{
+		{Magnitude: 4.6, Place: "12 km NE of Ridgecrest, CA", Time: now.Add(-90 * time.Minute), DistanceKm: 180},
+		{Magnitude: 5.0, Place: "Old quake", Time: now.Add(-10 * time.Hour), DistanceKm: 100},
+	}}
+
+	data := map[string]interface{}{}
+	addEarthquakeData(weather, data, now)
+	got, _ := data["recent_earthquakes"].(string)
+	if got != "M4.6 12 km NE of Ridgecrest, CA (180 km away, 90 minutes ago)" {
+		t.Errorf("recent_earthquakes = %q", got)
+	}
+}
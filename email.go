@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Directory holding the email templates
+const emailTemplateDir = "templates/email"
+
+// SMTP server settings for the email notifier
+type SMTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	From       string
+	Recipients []string
+}
+
+// Notifier that sends emails with HTML and plain-text parts
+type emailNotifier struct {
+	config   SMTPConfig
+	htmlTmpl *htmltemplate.Template
+	textTmpl *texttemplate.Template
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Create an email notifier, loading the digest templates from disk
+func newEmailNotifier(config SMTPConfig) (*emailNotifier, error) {
+	if config.Host == "" || config.From == "" || len(config.Recipients) == 0 {
+		return nil, fmt.Errorf("SMTP host, sender, and at least one recipient are required")
+	}
+
+	funcs := map[string]interface{}{
+		"tempUnit": unitSymbol,
+	}
+
+	htmlTmpl, err := htmltemplate.New("digest.html").Funcs(funcs).ParseFiles(emailTemplateDir + "/digest.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HTML email template: %v", err)
+	}
+	textTmpl, err := texttemplate.New("digest.txt").Funcs(funcs).ParseFiles(emailTemplateDir + "/digest.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load text email template: %v", err)
+	}
+
+	return &emailNotifier{
+		config:   config,
+		htmlTmpl: htmlTmpl,
+		textTmpl: textTmpl,
+		sendMail: smtp.SendMail,
+	}, nil
+}
+
+func (e *emailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (e *emailNotifier) Target() string {
+	return strings.Join(e.config.Recipients, ", ")
+}
+
+// Render and send the notification to each recipient in a message of its
+// own, so recipients don't see each other's addresses. A failed recipient
+// doesn't stop the rest.
+func (e *emailNotifier) Notify(n Notification) error {
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+	}
+	addr := net.JoinHostPort(e.config.Host, fmt.Sprintf("%d", e.config.Port))
+
+	var errs []error
+	for _, recipient := range e.config.Recipients {
+		msg, err := e.buildMessage(n, recipient)
+		if err != nil {
+			return err
+		}
+		if err := e.sendMail(addr, auth, e.config.From, []string{recipient}, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", recipient, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Build a multipart/alternative MIME message to one recipient from the templates
+func (e *emailNotifier) buildMessage(n Notification, to string) ([]byte, error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := e.textTmpl.Execute(&textBody, n); err != nil {
+		return nil, fmt.Errorf("failed to render text email: %v", err)
+	}
+	if err := e.htmlTmpl.Execute(&htmlBody, n); err != nil {
+		return nil, fmt.Errorf("failed to render HTML email: %v", err)
+	}
+
+	// Text and HTML alternatives
+	var alternative bytes.Buffer
+	altWriter := multipart.NewWriter(&alternative)
+
+	// Plain text first, HTML last so capable clients prefer it
+	parts := []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=UTF-8", textBody.Bytes()},
+		{"text/html; charset=UTF-8", htmlBody.Bytes()},
+	}
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := altWriter.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write(part.body); err != nil {
+			return nil, err
+		}
+		qp.Close()
+	}
+	altWriter.Close()
+
+	// Top-level headers
+	headers := []string{
+		"From: " + e.config.From,
+		"To: " + to,
+		"Subject: " + mime.BEncoding.Encode("UTF-8", n.Title), // Titles may contain "°"
+		"Date: " + n.Time.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+	}
+
+	var out bytes.Buffer
+	if len(n.Attachments) == 0 {
+		headers = append(headers, "Content-Type: multipart/alternative; boundary="+altWriter.Boundary())
+		out.WriteString(strings.Join(headers, "\r\n"))
+		out.WriteString("\r\n\r\n")
+		out.Write(alternative.Bytes())
+		return out.Bytes(), nil
+	}
+
+	// With attachments, wrap the alternatives in multipart/mixed
+	var mixed bytes.Buffer
+	mixedWriter := multipart.NewWriter(&mixed)
+
+	altHeader := textproto.MIMEHeader{}
+	altHeader.Set("Content-Type", "multipart/alternative; boundary="+altWriter.Boundary())
+	pw, err := mixedWriter.CreatePart(altHeader)
+	if err != nil {
+		return nil, err
+	}
+	pw.Write(alternative.Bytes())
+
+	for _, attachment := range n.Attachments {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", attachment.ContentType)
+		header.Set("Content-Transfer-Encoding", "base64")
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+		pw, err := mixedWriter.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(pw, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+	mixedWriter.Close()
+
+	headers = append(headers, "Content-Type: multipart/mixed; boundary="+mixedWriter.Boundary())
+	out.WriteString(strings.Join(headers, "\r\n"))
+	out.WriteString("\r\n\r\n")
+	out.Write(mixed.Bytes())
+	return out.Bytes(), nil
+}
+
+// Write base64 data wrapped at 76 characters per line as required by RFC 2045
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// Temperature unit symbol for templates
+func unitSymbol(system string) string {
+	return units.ParseSystem(system).TemperatureSymbol()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifierBuildsMultipartDigest(t *testing.T) {
+	notifier, err := newEmailNotifier(SMTPConfig{
+		Host:       "smtp.example.com",
+		Port:       587,
+		From:       "agent@example.com",
+		Recipients: []string{"a@example.com", "b@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("newEmailNotifier failed: %v", err)
+	}
+
+	var sentTo []string
+	var sentMsg []byte
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" {
+			t.Errorf("unexpected SMTP address %s", addr)
+		}
+		// Each recipient gets a message addressed to them alone
+		if parsed, err := mail.ReadMessage(bytes.NewReader(msg)); err != nil || len(to) != 1 || parsed.Header.Get("To") != to[0] {
+			t.Errorf("message to %v isn't addressed to them alone", to)
+		}
+		sentTo = append(sentTo, to...)
+		sentMsg = msg
+		return nil
+	}
+
+	err = notifier.Notify(Notification{
+		Title:   "Weather for London - Monday, June 3",
+		Message: "Grab a light jacket <today>.",
+		City:    "London",
+		Country: "GB",
+		Units:   "metric",
+		Data: map[string]interface{}{
+			"temperature": "14.0°C",
+			"description": "light drizzle",
+		},
+		Forecast: []ForecastDay{{Date: "2024-06-03", Description: "light drizzle", TempMax: 16, TempMin: 9, PrecipitationProbability: 70}},
+		Time:     time.Date(2024, 6, 3, 7, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(sentTo) != 2 {
+		t.Fatalf("expected 2 recipients, got %v", sentTo)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(sentMsg))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+
+	bodies := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part) // quoted-printable is decoded automatically
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[partType] = string(body)
+	}
+
+	if !strings.Contains(bodies["text/plain"], "Grab a light jacket <today>.") {
+		t.Errorf("plain text part missing message: %s", bodies["text/plain"])
+	}
+	if !strings.Contains(bodies["text/plain"], "high 16°C, low 9°C, 70% chance") {
+		t.Errorf("plain text part missing forecast: %s", bodies["text/plain"])
+	}
+	if !strings.Contains(bodies["text/html"], "Grab a light jacket &lt;today&gt;.") {
+		t.Errorf("HTML part should escape the message: %s", bodies["text/html"])
+	}
+}
+
+func TestNextDailyRun(t *testing.T) {
+	loc := time.FixedZone("Test", 0)
+	before := time.Date(2024, 6, 3, 6, 30, 0, 0, loc)
+	after := time.Date(2024, 6, 3, 7, 30, 0, 0, loc)
+
+	if got := nextDailyRun(before, 7, 0); !got.Equal(time.Date(2024, 6, 3, 7, 0, 0, 0, loc)) {
+		t.Errorf("expected run later today, got %v", got)
+	}
+	if got := nextDailyRun(after, 7, 0); !got.Equal(time.Date(2024, 6, 4, 7, 0, 0, 0, loc)) {
+		t.Errorf("expected run tomorrow, got %v", got)
+	}
+
+	if _, _, err := parseTimeOfDay("7am"); err == nil {
+		t.Error("expected error for invalid time of day")
+	}
+}
+
+// A recipient the server refuses doesn't keep the message from the others
+func TestEmailNotifierSendsToEachRecipient(t *testing.T) {
+	notifier, err := newEmailNotifier(SMTPConfig{Host: "smtp.example.com", Port: 25, From: "agent@example.com", Recipients: []string{"a@example.com", "b@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delivered []string
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if to[0] == "a@example.com" {
+			return errors.New("550 mailbox unavailable")
+		}
+		delivered = append(delivered, to...)
+		return nil
+	}
+
+	err = notifier.Notify(Notification{Title: "Rain later", Message: "Take an umbrella.", Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "a@example.com") {
+		t.Errorf("error = %v, want the refused recipient", err)
+	}
+	if len(delivered) != 1 || delivered[0] != "b@example.com" {
+		t.Errorf("delivered to %v", delivered)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 1x1 transparent GIF served as the email open-tracking pixel
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Whether a channel can report engagement (email opens, webhook acks).
+// Other channels are never throttled, since silence says nothing there.
+func tracksEngagement(channel string) bool {
+	return channel == ChannelEmail || channel == ChannelWebhook
+}
+
+// Engagement with one channel target
+type engagementState struct {
+	LastSent    time.Time
+	LastEngaged time.Time
+	Ignored     int // Consecutive messages sent without any engagement
+}
+
+// Tracks whether recipients open or fetch their messages, so messages to
+// ignored targets can be sent less often. A nil tracker records nothing and
+// never throttles.
+type engagementTracker struct {
+	baseURL string // Public URL of this server for pixel/ack links (empty disables links)
+	secret  []byte // Signs links so they can't be forged for other targets
+
+	mu      sync.Mutex
+	targets map[string]*engagementState
+}
+
+// Create a tracker. Without a secret a random one is used, so links stop
+// verifying after a restart.
+func newEngagementTracker(baseURL, secret string) *engagementTracker {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &engagementTracker{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  key,
+		targets: make(map[string]*engagementState),
+	}
+}
+
+func engagementKey(channel, target string) string {
+	return channel + "|" + target
+}
+
+// Get or create the state for a target. Callers must hold t.mu.
+func (t *engagementTracker) state(channel, target string) *engagementState {
+	key := engagementKey(channel, target)
+	state, ok := t.targets[key]
+	if !ok {
+		state = &engagementState{}
+		t.targets[key] = state
+	}
+	return state
+}
+
+// Record a message delivered to a target
+func (t *engagementTracker) sent(channel, target string, now time.Time) {
+	if t == nil || !tracksEngagement(channel) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.state(channel, target)
+	if !state.LastSent.IsZero() && state.LastEngaged.Before(state.LastSent) {
+		state.Ignored++
+	}
+	state.LastSent = now
+}
+
+// Record that a target opened, fetched, or acknowledged a message
+func (t *engagementTracker) engaged(channel, target string, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.state(channel, target)
+	state.LastEngaged = now
+	state.Ignored = 0
+}
+
+// Interval between scheduled messages for a target: the base interval,
+// doubled for each ignored message up to longest
+func (t *engagementTracker) interval(channel, target string, base, longest time.Duration) time.Duration {
+	if t == nil || !tracksEngagement(channel) {
+		return base
+	}
+	t.mu.Lock()
+	ignored := t.state(channel, target).Ignored
+	t.mu.Unlock()
+
+	interval := base
+	for i := 0; i < ignored && interval < longest; i++ {
+		interval *= 2
+	}
+	return min(interval, longest)
+}
+
+// Whether a scheduled message is due for a target
+func (t *engagementTracker) due(channel, target string, now time.Time, base, longest time.Duration) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	lastSent := t.state(channel, target).LastSent
+	t.mu.Unlock()
+	// Allow half a tick of slack, since sends land just after the tick that triggered them
+	return lastSent.IsZero() || now.Sub(lastSent)+base/2 >= t.interval(channel, target, base, longest)
+}
+
+// Signature binding a message to the target it was sent to
+func (t *engagementTracker) sign(messageID, channel, target string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", messageID, channel, target)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signed engagement link for a delivered message, or "" when links are disabled
+func (t *engagementTracker) url(messageID, channel, target string) string {
+	if t == nil || t.baseURL == "" || !tracksEngagement(channel) {
+		return ""
+	}
+	query := url.Values{
+		"m": {messageID},
+		"c": {channel},
+		"r": {target},
+		"s": {t.sign(messageID, channel, target)},
+	}
+	return t.baseURL + apiPrefix + "/engagement?" + query.Encode()
+}
+
+// Record engagement from UI requests, keyed by client IP
+func (agent *WeatherAgent) recordUIEngagement(r *http.Request) {
+	agent.engagement.engaged(ChannelUI, clientIP(r, agent.config.proxyHops()), time.Now())
+}
+
+// GET /api/engagement serves the email open pixel and POST acknowledges a
+// webhook delivery. Links are signed, so no API key is needed.
+func (agent *WeatherAgent) handleEngagement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if agent.engagement == nil {
+		apiError(w, "Engagement tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	messageID, channel, target := query.Get("m"), query.Get("c"), query.Get("r")
+	expected := agent.engagement.sign(messageID, channel, target)
+	if messageID == "" || !hmac.Equal([]byte(query.Get("s")), []byte(expected)) {
+		apiError(w, "Invalid engagement link", http.StatusForbidden)
+		return
+	}
+
+	agent.engagement.engaged(channel, target, time.Now())
+	agent.logger.Printf("Recorded engagement with message %s via %s", messageID, channel)
+
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(trackingPixel)
+}
+
+// Send the scheduled weather update to every recipient it's due for, at the
+// configured location and each subscriber location. Targets that ignore their
+// messages are sent updates less often, and when nobody is due no message is
+// generated at all.
+func (agent *WeatherAgent) sendScheduledUpdate(now time.Time) error {
+	return agent.forEachLocation(NotificationUpdate, func(loc *ProfileLocation) error {
+		return agent.sendScheduledUpdateAt(now, loc)
+	})
+}
+
+// Send the scheduled update for one location (nil for the configured one)
+func (agent *WeatherAgent) sendScheduledUpdateAt(now time.Time, loc *ProfileLocation) error {
+	base := time.Duration(agent.config.UpdateIntervalMinutes) * time.Minute
+	longest := time.Duration(agent.config.UpdateMaxIntervalMinutes) * time.Minute
+
+	var due []Notifier
+	for _, notifier := range agent.recipientNotifiers(Notification{Type: NotificationUpdate, Location: subscriberLocationKey(loc)}) {
+		if agent.engagement.due(notifier.Channel(), notifier.Target(), now, base, longest) {
+			due = append(due, notifier)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	weather, err := agent.weatherAt(loc)
+	if err != nil {
+		return fmt.Errorf("error fetching weather: %v", err)
+	}
+	agent.recordWeather(weather)
+
+	message, err := agent.cachedLLMMessage(weather, agent.generateHistoryContext(weather), agent.config.Persona, agent.llmParams())
+	if err != nil {
+		return fmt.Errorf("error generating LLM message: %v", err)
+	}
+	agent.setLastMessage(weatherLocationKey(weather), message)
+
+	n := Notification{
+		MessageID: newMessageID(),
+		Type:      NotificationUpdate,
+		Title:     fmt.Sprintf("Weather update for %s", weather.Name),
+		Message:   message,
+		City:      weather.Name,
+		Country:   weather.Sys.Country,
+		Location:  subscriberLocationKey(loc),
+		Units:     agent.config.Units,
+		Data:      agent.prepareWeatherData(weather),
+		Time:      now,
+	}
+	for _, notifier := range due {
+		agent.deliverOrHold(notifier, n)
+	}
+	return nil
+}
+
+// Check for due weather updates every base interval
+func (agent *WeatherAgent) runUpdateScheduler() {
+	ticker := time.NewTicker(time.Duration(agent.config.UpdateIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !agent.featureEnabled(FeatureNotifiers) {
+			continue
+		}
+		if err := agent.sendScheduledUpdate(now); err != nil {
+			agent.logger.Printf("Error sending scheduled update: %v", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngagementBackoff(t *testing.T) {
+	tracker := newEngagementTracker("", "secret")
+	base, longest := time.Hour, 6*time.Hour
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	// Each ignored email doubles the interval, up to the maximum
+	want := []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 6 * time.Hour, 6 * time.Hour}
+	for i, w := range want {
+		tracker.sent(ChannelEmail, "a@example.com", start.Add(time.Duration(i)*time.Hour))
+		if got := tracker.interval(ChannelEmail, "a@example.com", base, longest); got != w {
+			t.Errorf("after %d sends: interval %v, want %v", i+1, got, w)
+		}
+	}
+
+	// Opening a message restores the base interval
+	tracker.engaged(ChannelEmail, "a@example.com", start.Add(6*time.Hour))
+	if got := tracker.interval(ChannelEmail, "a@example.com", base, longest); got != base {
+		t.Errorf("after engagement: interval %v, want %v", got, base)
+	}
+
+	// Channels that can't report engagement are never throttled
+	for i := 0; i < 5; i++ {
+		tracker.sent(ChannelTelegram, "123", start.Add(time.Duration(i)*time.Hour))
+	}
+	if got := tracker.interval(ChannelTelegram, "123", base, longest); got != base {
+		t.Errorf("telegram interval %v, want %v", got, base)
+	}
+}
+
+func TestEngagementDue(t *testing.T) {
+	tracker := newEngagementTracker("", "secret")
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	if !tracker.due(ChannelWebhook, "https://example.com/hook", start, time.Hour, 8*time.Hour) {
+		t.Error("a target that was never sent to should be due")
+	}
+	tracker.sent(ChannelWebhook, "https://example.com/hook", start)
+	tracker.sent(ChannelWebhook, "https://example.com/hook", start.Add(time.Hour+time.Second))
+
+	// One ignored message: due again two hours later, tolerating tick drift
+	sentAt := start.Add(time.Hour + time.Second)
+	if tracker.due(ChannelWebhook, "https://example.com/hook", sentAt.Add(time.Hour), time.Hour, 8*time.Hour) {
+		t.Error("due after one hour despite the ignored message")
+	}
+	if !tracker.due(ChannelWebhook, "https://example.com/hook", start.Add(3*time.Hour), time.Hour, 8*time.Hour) {
+		t.Error("not due at the next two-hour tick")
+	}
+}
+
+func TestHandleEngagement(t *testing.T) {
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		engagement: newEngagementTracker("https://weather.example.com/", "secret"),
+	}
+
+	link := agent.engagement.url("msg1", ChannelEmail, "a@example.com")
+	if !strings.HasPrefix(link, "https://weather.example.com/api/v1/engagement?") {
+		t.Fatalf("unexpected engagement link %q", link)
+	}
+	if agent.engagement.url("msg1", ChannelTelegram, "123") != "" {
+		t.Error("telegram messages shouldn't get engagement links")
+	}
+
+	agent.engagement.sent(ChannelEmail, "a@example.com", time.Now().Add(-2*time.Hour))
+	agent.engagement.sent(ChannelEmail, "a@example.com", time.Now().Add(-time.Hour))
+
+	u, _ := url.Parse(link)
+	rec := httptest.NewRecorder()
+	agent.handleEngagement(rec, httptest.NewRequest(http.MethodGet, "/api/v1/engagement?"+u.RawQuery, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/gif" {
+		t.Errorf("pixel: got status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := agent.engagement.interval(ChannelEmail, "a@example.com", time.Hour, 8*time.Hour); got != time.Hour {
+		t.Errorf("open wasn't recorded, interval %v", got)
+	}
+
+	// A link can't be reused for a different target
+	forged := u.Query()
+	forged.Set("r", "b@example.com")
+	rec = httptest.NewRecorder()
+	agent.handleEngagement(rec, httptest.NewRequest(http.MethodPost, "/api/v1/engagement?"+forged.Encode(), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("forged link: got status %d, want 403", rec.Code)
+	}
+}
+
+func TestScheduledUpdateSkipsWhenNothingDue(t *testing.T) {
+	sent := 0
+	notifier := countingNotifier{&sent}
+	agent := &WeatherAgent{
+		config:     Config{UpdateIntervalMinutes: 60, UpdateMaxIntervalMinutes: 240},
+		logger:     log.New(io.Discard, "", 0),
+		engagement: newEngagementTracker("", "secret"),
+		notifiers:  []Notifier{notifier},
+	}
+
+	// The test channel is never throttled, so only a recent send keeps it from being due
+	now := time.Now()
+	agent.engagement.targets[engagementKey(notifier.Channel(), notifier.Target())] = &engagementState{LastSent: now.Add(-10 * time.Minute)}
+	if err := agent.sendScheduledUpdate(now); err != nil || sent != 0 {
+		t.Errorf("sendScheduledUpdate sent %d notifications, %v; want none", sent, err)
+	}
+}
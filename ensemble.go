@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Ensemble settings
+const (
+	ensembleCacheTTL = time.Hour      // Ensemble runs come out every 6-12 hours
+	ensembleModel    = "ecmwf_ifs025" // ECMWF's 51-member global ensemble
+	ensembleWetMM    = 1.0            // Precipitation (mm) making a wet day for a member
+)
+
+// Forecast confidence levels
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+var confidenceLevels = []string{ConfidenceHigh, ConfidenceMedium, ConfidenceLow}
+
+// How much the ensemble's members agree on today, so the LLM hedges when
+// they don't
+type ForecastConfidence struct {
+	Level         string  `json:"level"` // "high", "medium" or "low"
+	Members       int     `json:"members"`
+	Model         string  `json:"model"`
+	HighMedian    float64 `json:"high_median"`
+	HighP10       float64 `json:"high_p10"` // 10th and 90th percentiles of the members' highs
+	HighP90       float64 `json:"high_p90"`
+	HighSpread    float64 `json:"high_spread"`     // HighP90 - HighP10
+	WetMembersPct int     `json:"wet_members_pct"` // Members with at least ensembleWetMM of precipitation
+	Unit          string  `json:"unit"`
+}
+
+// Rendered for the LLM prompt
+func (c ForecastConfidence) String() string {
+	return fmt.Sprintf("%s: %d ensemble members put today's high between %.1f%s and %.1f%s (median %.1f%s); %d%% of them bring %.0f mm or more of precipitation",
+		c.Level, c.Members, c.HighP10, c.Unit, c.HighP90, c.Unit, c.HighMedian, c.Unit, c.WetMembersPct, ensembleWetMM)
+}
+
+// Value at percentile p (0-100) of sorted values, interpolating between
+// neighbours
+func percentileOf(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// Parse a one-day hourly ensemble response into each member's high and
+// precipitation total. The control run is "temperature_2m", the others
+// "temperature_2m_member01" and so on.
+func parseEnsemble(body []byte) (highs, precipitation []float64, err error) {
+	var ensembleResp struct {
+		Hourly map[string]json.RawMessage `json:"hourly"`
+	}
+	if err := json.Unmarshal(body, &ensembleResp); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ensemble response: %v", err)
+	}
+
+	var names []string
+	for name := range ensembleResp.Hourly {
+		if name == "temperature_2m" || strings.HasPrefix(name, "temperature_2m_member") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var temps, precip []*float64
+		json.Unmarshal(ensembleResp.Hourly[name], &temps)
+		json.Unmarshal(ensembleResp.Hourly[strings.Replace(name, "temperature_2m", "precipitation", 1)], &precip)
+
+		high, ok := math.Inf(-1), false
+		for _, t := range temps {
+			if t != nil {
+				high, ok = math.Max(high, *t), true
+			}
+		}
+		if !ok {
+			continue // Member without data for today
+		}
+		total := 0.0
+		for _, p := range precip {
+			if p != nil {
+				total += *p
+			}
+		}
+		highs = append(highs, high)
+		precipitation = append(precipitation, total)
+	}
+	if len(highs) < 2 {
+		return nil, nil, fmt.Errorf("ensemble response has %d members with data", len(highs))
+	}
+	return highs, precipitation, nil
+}
+
+// Confidence from the members' highs (in the system's units) and
+// precipitation totals. A spread of highs up to 2°C is high confidence and
+// up to 4°C medium; members split on whether it rains cost a level.
+func newForecastConfidence(highs, precipitation []float64, system units.System) ForecastConfidence {
+	sorted := append([]float64{}, highs...)
+	sort.Float64s(sorted)
+	c := ForecastConfidence{
+		Members:    len(highs),
+		Model:      ensembleModel,
+		HighMedian: round1(percentileOf(sorted, 50)),
+		HighP10:    round1(percentileOf(sorted, 10)),
+		HighP90:    round1(percentileOf(sorted, 90)),
+	}
+	c.HighSpread = round1(c.HighP90 - c.HighP10)
+
+	wet := 0
+	for _, p := range precipitation {
+		if p >= ensembleWetMM {
+			wet++
+		}
+	}
+	c.WetMembersPct = int(math.Round(float64(wet) * 100 / float64(len(precipitation))))
+
+	spreadC := c.HighSpread
+	if system != units.Metric {
+		spreadC = spreadC * 5 / 9
+	}
+	level := 0
+	switch {
+	case spreadC > 4:
+		level = 2
+	case spreadC > 2:
+		level = 1
+	}
+	if c.WetMembersPct >= 30 && c.WetMembersPct <= 70 {
+		level = min(level+1, 2)
+	}
+	c.Level = confidenceLevels[level]
+	return c
+}
+
+// Fetch today's forecast confidence from the Open-Meteo Ensemble API
+func (agent *WeatherAgent) fetchForecastConfidence(lat, lon float64) (ForecastConfidence, error) {
+	url := fmt.Sprintf("https://ensemble-api.open-meteo.com/v1/ensemble?latitude=%.4f&longitude=%.4f&hourly=temperature_2m,precipitation&models=%s&forecast_days=1&temperature_unit=%s&timezone=auto",
+		lat, lon, ensembleModel, agent.units().OpenMeteoTemperatureUnit())
+	body, _, err := agent.cachedGet(url, ensembleCacheTTL, false)
+	if err != nil {
+		return ForecastConfidence{}, fmt.Errorf("ensemble request failed: %v", err)
+	}
+
+	highs, precipitation, err := parseEnsemble(body)
+	if err != nil {
+		return ForecastConfidence{}, err
+	}
+	confidence := newForecastConfidence(highs, precipitation, agent.units())
+	confidence.Unit = agent.getTempUnit()
+	return confidence, nil
+}
+
+// Attach the forecast confidence when enabled
+func (agent *WeatherAgent) addForecastConfidence(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureEnsemble) {
+		return
+	}
+
+	confidence, err := agent.fetchForecastConfidence(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch forecast confidence: %v", err)
+		return
+	}
+	weather.Confidence = &confidence
+}
+
+// Add the forecast confidence to the LLM data map
+func (agent *WeatherAgent) addForecastConfidenceData(weather WeatherResponse, data map[string]interface{}) {
+	if weather.Confidence != nil {
+		data["forecast_confidence"] = *weather.Confidence
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+const fixtureEnsemble = `{"latitude":59.91,"longitude":10.75,"hourly_units":{"temperature_2m":"°C"},"hourly":{
+	"time":["2024-06-15T00:00","2024-06-15T12:00","2024-06-15T18:00"],
+	"temperature_2m":[12.1,18.0,16.2],"precipitation":[0,0.4,0.2],
+	"temperature_2m_member01":[11.8,19.5,17.0],"precipitation_member01":[0,1.2,0.3],
+	"temperature_2m_member02":[12.4,17.2,null],"precipitation_member02":[0,0,null],
+	"temperature_2m_member03":[null,null,null],"precipitation_member03":[null,null,null]}}`
+
+func TestParseEnsemble(t *testing.T) {
+	highs, precipitation, err := parseEnsemble([]byte(fixtureEnsemble))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The member without data is skipped
+	if len(highs) != 3 || highs[0] != 18.0 || highs[1] != 19.5 || highs[2] != 17.2 || precipitation[1] != 1.5 {
+		t.Errorf("got highs %v, precipitation %v", highs, precipitation)
+	}
+	if _, _, err := parseEnsemble([]byte(`{"hourly":{"temperature_2m":[15]}}`)); err == nil {
+		t.Error("expected an error for a single member")
+	}
+}
+
+func TestNewForecastConfidence(t *testing.T) {
+	tests := []struct {
+		name          string
+		highs         []float64
+		precipitation []float64
+		system        units.System
+		want          string
+	}{
+		{"members agree", []float64{20, 20.5, 21, 21.5, 22}, []float64{0, 0, 0, 0, 0}, units.Metric, ConfidenceHigh},
+		{"3°C spread", []float64{18, 19, 20, 21, 21.5}, []float64{0, 0, 0, 0, 0}, units.Metric, ConfidenceMedium},
+		{"wide spread", []float64{14, 16, 19, 22, 24}, []float64{0, 0, 0, 0, 0}, units.Metric, ConfidenceLow},
+		{"split on rain", []float64{20, 20.5, 21, 21.5, 22}, []float64{0, 0, 2, 5, 0}, units.Metric, ConfidenceMedium},
+		{"agreed rain", []float64{20, 20.5, 21, 21.5, 22}, []float64{3, 4, 2, 5, 6}, units.Metric, ConfidenceHigh},
+		{"3°F spread", []float64{68, 69, 70, 71, 72}, []float64{0, 0, 0, 0, 0}, units.Imperial, ConfidenceHigh},
+	}
+	for _, tt := range tests {
+		c := newForecastConfidence(tt.highs, tt.precipitation, tt.system)
+		if c.Level != tt.want || c.Members != len(tt.highs) || c.HighMedian != tt.highs[2] {
+			t.Errorf("%s: got %+v, want %s", tt.name, c, tt.want)
+		}
+	}
+}
+
+func TestFetchForecastConfidence(t *testing.T) {
+	useFixtures(t, map[string]http.HandlerFunc{"ensemble-api.open-meteo.com": serveJSON(fixtureEnsemble)})
+	agent := newFixtureAgent(t, Config{})
+	agent.features.set(FeatureEnsemble, true)
+
+	var weather WeatherResponse
+	agent.addForecastConfidence(&weather, 59.91, 10.75)
+	c := weather.Confidence
+	if c == nil || c.Members != 3 || c.WetMembersPct != 33 || c.Level != ConfidenceMedium || c.Unit != "°C" {
+		t.Fatalf("confidence = %+v", c)
+	}
+	data := map[string]interface{}{}
+	agent.addForecastConfidenceData(weather, data)
+	if s, ok := data["forecast_confidence"].(ForecastConfidence); !ok || s.String() == "" {
+		t.Errorf("data = %v", data)
+	}
+
+	agent.features.set(FeatureEnsemble, false)
+	weather.Confidence = nil
+	agent.addForecastConfidence(&weather, 59.91, 10.75)
+	if weather.Confidence != nil {
+		t.Error("fetched with the feature off")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Datasets /api/export can dump
+const (
+	exportObservations = "observations"
+	exportMessages     = "messages"
+)
+
+// Most rows one export returns; larger ranges have to be split up
+const maxExportRows = 200000
+
+// Rows of an export, written as CSV or Parquet
+type exportTable struct {
+	fields []parquetField
+	rows   [][]interface{}
+}
+
+// Parse ?range= as a lookback such as "36h" or "7d", or as inclusive UTC
+// dates "2006-01-01..2006-01-31". Without a value everything stored is
+// exported.
+func parseExportRange(value string, now time.Time) (time.Time, time.Time, error) {
+	switch {
+	case value == "":
+		return time.Time{}, now, nil
+	case strings.Contains(value, ".."):
+		startValue, endValue, _ := strings.Cut(value, "..")
+		start, err1 := time.Parse("2006-01-02", strings.TrimSpace(startValue))
+		end, err2 := time.Parse("2006-01-02", strings.TrimSpace(endValue))
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid range %q (use YYYY-MM-DD..YYYY-MM-DD)", value)
+		}
+		return start, end.AddDate(0, 0, 1), nil
+	}
+
+	var lookback time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, _ := strconv.Atoi(days)
+		lookback = time.Duration(n) * 24 * time.Hour
+	} else {
+		lookback, _ = time.ParseDuration(value)
+	}
+	if lookback <= 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid range %q (use e.g. 24h, 7d or YYYY-MM-DD..YYYY-MM-DD)", value)
+	}
+	return now.Add(-lookback), now, nil
+}
+
+// Stored observations in [start, end), optionally for one city
+func (agent *WeatherAgent) observationExport(start, end time.Time, city string) (exportTable, error) {
+	table := exportTable{fields: []parquetField{
+		{"time", parquetTimestamp}, {"city", parquetString}, {"country", parquetString},
+		{"temp", parquetDouble}, {"feels_like", parquetDouble}, {"humidity", parquetInt32},
+		{"pressure", parquetInt32}, {"wind_speed", parquetDouble}, {"cloud_cover", parquetInt32},
+		{"uv_index", parquetDouble}, {"precipitation", parquetDouble}, {"description", parquetString},
+		{"samples", parquetInt32},
+	}}
+	observations, err := agent.observations.since(start, city)
+	if err != nil {
+		return table, err
+	}
+	for _, obs := range observations {
+		if !obs.Time.Before(end) {
+			continue
+		}
+		table.rows = append(table.rows, []interface{}{obs.Time, obs.City, obs.Country, obs.Temp, obs.FeelsLike,
+			obs.Humidity, obs.Pressure, obs.WindSpeed, obs.CloudCover, obs.UVIndex, obs.Precip, obs.Description, obs.Samples})
+	}
+	return table, nil
+}
+
+// Delivered messages in [start, end), oldest first, one row per delivery.
+// Recipients are left out, since they are addresses and webhook URLs.
+func (agent *WeatherAgent) messageExport(start, end time.Time) exportTable {
+	table := exportTable{fields: []parquetField{
+		{"time", parquetTimestamp}, {"message_id", parquetString}, {"type", parquetString},
+		{"channel", parquetString}, {"status", parquetString}, {"city", parquetString},
+		{"message", parquetString}, {"error", parquetString},
+	}}
+	if agent.deliveries == nil {
+		return table
+	}
+	deliveries := agent.deliveries.list("", "", 0)
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		d := deliveries[i]
+		if d.Time.Before(start) || !d.Time.Before(end) {
+			continue
+		}
+		table.rows = append(table.rows, []interface{}{d.Time, d.MessageID, d.Type, d.Channel, d.Status, d.City, d.Message, d.Error})
+	}
+	return table
+}
+
+// Write the table as CSV with a header row
+func (t exportTable) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(t.fields))
+	for i, field := range t.fields {
+		header[i] = field.Name
+	}
+	cw.Write(header)
+	for _, row := range t.rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			switch v := value.(type) {
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339)
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write the table as Parquet, streaming it out a row group at a time
+func (t exportTable) writeParquet(w io.Writer) error {
+	pw := newParquetWriter(w, t.fields)
+	for _, row := range t.rows {
+		if err := pw.appendRow(row...); err != nil {
+			return err
+		}
+	}
+	return pw.close()
+}
+
+// GET /api/export?data=observations|messages&format=csv|parquet&range=7d&city=
+// downloads stored observations or delivered messages for spreadsheets and notebooks
+func (agent *WeatherAgent) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start, end, err := parseExportRange(query.Get("range"), time.Now())
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "parquet" {
+		apiError(w, "Invalid format parameter (csv or parquet)", http.StatusBadRequest)
+		return
+	}
+
+	var table exportTable
+	dataset := query.Get("data")
+	switch dataset {
+	case "", exportObservations:
+		dataset = exportObservations
+		table, err = agent.observationExport(start, end, query.Get("city"))
+		if err != nil {
+			agent.logger.Printf("Error reading observations: %v", err)
+			apiError(w, "Unable to read observations", http.StatusInternalServerError)
+			return
+		}
+	case exportMessages:
+		table = agent.messageExport(start, end)
+	default:
+		apiError(w, "Invalid data parameter (observations or messages)", http.StatusBadRequest)
+		return
+	}
+
+	if len(table.rows) > maxExportRows {
+		apiError(w, fmt.Sprintf("The range has over %d rows; request a shorter one", maxExportRows), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=weather-%s.%s", dataset, format))
+	if format == "parquet" {
+		w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+		err = table.writeParquet(w)
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		err = table.writeCSV(w)
+	}
+	if err != nil {
+		agent.logger.Printf("Error writing %s export: %v", dataset, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExportRange(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		start   time.Time
+		end     time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, now, false},
+		{"36h", now.Add(-36 * time.Hour), now, false},
+		{"7d", now.AddDate(0, 0, -7), now, false},
+		{"2024-06-01..2024-06-03", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC), false},
+		{"2024-06-03..2024-06-01", time.Time{}, time.Time{}, true},
+		{"0d", time.Time{}, time.Time{}, true},
+		{"-2h", time.Time{}, time.Time{}, true},
+		{"week", time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		start, end, err := parseExportRange(tt.value, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%q: got %v..%v, %v", tt.value, start, end, err)
+		}
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	agent := &WeatherAgent{
+		logger:       log.New(io.Discard, "", 0),
+		observations: &observationStore{},
+		deliveries:   newDeliveryLog(),
+	}
+	agent.observations.record(Observation{Time: now.Add(-50 * time.Hour), City: "Oslo", Temp: 1.25, Description: "snow"})
+	agent.observations.record(Observation{Time: now.Add(-2 * time.Hour), City: "Oslo", Temp: 2.5, Humidity: 80, Description: "light rain, cold"})
+	agent.observations.record(Observation{Time: now.Add(-time.Hour), City: "Bergen", Temp: 3})
+	agent.deliveries.record(Delivery{MessageID: "m1", Type: NotificationUpdate, Channel: ChannelEmail, Target: "me@example.com",
+		Status: DeliveryDelivered, City: "Oslo", Message: "Drizzle later.", Time: now.Add(-3 * time.Hour)})
+	agent.deliveries.record(Delivery{MessageID: "m2", Channel: ChannelUI, Status: DeliveryDelivered, Message: "Clearing up.", Time: now.Add(-time.Hour)})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		agent.handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("range=24h&city=Oslo")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := "time,city,country,temp,feels_like,humidity,pressure,wind_speed,cloud_cover,uv_index,precipitation,description,samples\n" +
+		now.Add(-2*time.Hour).Format(time.RFC3339) + ",Oslo,,2.5,0,80,0,0,0,0,0,\"light rain, cold\",0\n"
+	if rec.Body.String() != want {
+		t.Errorf("CSV = %q, want %q", rec.Body.String(), want)
+	}
+
+	rec = export("data=messages&format=parquet")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), "weather-messages.parquet") {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Content-Disposition"))
+	}
+	names, rows := readTestParquet(t, rec.Body.Bytes())
+	if len(rows) != 2 || rows[0][1] != "m1" || rows[0][6] != "Drizzle later." || rows[1][3] != ChannelUI {
+		t.Errorf("rows = %v", rows)
+	}
+	for _, name := range names {
+		if name == "target" {
+			t.Error("export includes recipients")
+		}
+	}
+
+	if _, rows := readTestParquet(t, export("format=parquet").Body.Bytes()); len(rows) != 3 || rows[0][3] != 1.25 {
+		t.Errorf("all observations: %v", rows)
+	}
+
+	for _, query := range []string{"format=xlsx", "data=prompts", "range=soon"} {
+		if rec := export(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d", query, rec.Code)
+		}
+	}
+}
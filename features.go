@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Features that can be switched on and off at runtime
+const (
+	FeatureAlerts         = "alerts"          // Threshold alert monitor
+	FeatureChat           = "chat"            // /api/chat questions
+	FeatureClimateNormals = "climate_normals" // Comparison with 1991-2020 normals from the ERA5 archive
+	FeatureCyclones       = "cyclones"        // Tropical cyclone tracking from the NHC feed
+	FeatureEarthquakes    = "earthquakes"     // Nearby earthquake alerts from the USGS feed
+	FeatureEnsemble       = "ensemble"        // Forecast confidence from the Open-Meteo ensemble's spread
+	FeatureLastYear       = "last_year"       // Same date last year from the Open-Meteo archive
+	FeatureNotifiers      = "notifiers"       // Email, Telegram and webhook deliveries
+	FeatureNowcasting     = "nowcasting"      // Minutely precipitation nowcasts (experimental)
+)
+
+// Default state of each feature. Experimental features ship dark.
+var defaultFeatures = map[string]bool{
+	FeatureAlerts:         true,
+	FeatureChat:           true,
+	FeatureClimateNormals: true,
+	FeatureCyclones:       true,
+	FeatureEarthquakes:    true,
+	FeatureEnsemble:       true,
+	FeatureLastYear:       true,
+	FeatureNotifiers:      true,
+	FeatureNowcasting:     false,
+}
+
+// Concurrency-safe set of feature flags, seeded from FEATURE_FLAGS and
+// changed at runtime through the admin API
+type featureFlags struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+// Create the flags from "name=on/off" settings over the defaults
+func newFeatureFlags(settings []string) (*featureFlags, error) {
+	f := &featureFlags{flags: make(map[string]bool, len(defaultFeatures))}
+	for name, enabled := range defaultFeatures {
+		f.flags[name] = enabled
+	}
+	for _, setting := range settings {
+		name, value, found := strings.Cut(setting, "=")
+		if !found {
+			return f, fmt.Errorf("invalid feature flag %q (expected name=on or name=off)", setting)
+		}
+		enabled, err := parseFlagValue(value)
+		if err != nil {
+			return f, fmt.Errorf("invalid feature flag %q: %v", setting, err)
+		}
+		if err := f.set(strings.TrimSpace(name), enabled); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// Parse on/off as well as the usual boolean spellings
+func parseFlagValue(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "enabled", "yes":
+		return true, nil
+	case "off", "disabled", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(strings.TrimSpace(value))
+}
+
+// Whether a feature is enabled. Unknown features are disabled.
+func (f *featureFlags) enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.flags[name]
+}
+
+// Enable or disable a known feature
+func (f *featureFlags) set(name string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.flags[name]; !ok {
+		return fmt.Errorf("unknown feature %q", name)
+	}
+	f.flags[name] = enabled
+	return nil
+}
+
+// Snapshot of every flag
+func (f *featureFlags) all() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	snapshot := make(map[string]bool, len(f.flags))
+	for name, enabled := range f.flags {
+		snapshot[name] = enabled
+	}
+	return snapshot
+}
+
+// Whether a feature is enabled for this agent. Agents built without flags
+// (e.g. in tests) use the defaults.
+func (agent *WeatherAgent) featureEnabled(name string) bool {
+	if agent.features == nil {
+		return defaultFeatures[name]
+	}
+	return agent.features.enabled(name)
+}
+
+// GET lists the feature flags; PATCH applies {"name": true/false} changes
+func (agent *WeatherAgent) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch, http.MethodPut:
+		var changes map[string]bool
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&changes); err != nil {
+			apiError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		// Validate everything first so a bad name doesn't apply half the changes
+		names := make([]string, 0, len(changes))
+		current := agent.features.all()
+		for name := range changes {
+			if _, ok := current[name]; !ok {
+				apiError(w, fmt.Sprintf("Unknown feature %q", name), http.StatusBadRequest)
+				return
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			agent.features.set(name, changes[name])
+			state := "disabled"
+			if changes[name] {
+				state = "enabled"
+			}
+			agent.logger.Printf("Feature %q %s via admin API", name, state)
+		}
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, FeaturesResponse{Features: agent.features.all()})
+}
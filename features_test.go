@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewFeatureFlags(t *testing.T) {
+	flags, err := newFeatureFlags([]string{"chat=off", "nowcasting = on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags.enabled(FeatureChat) || !flags.enabled(FeatureNowcasting) || !flags.enabled(FeatureAlerts) {
+		t.Errorf("unexpected flags %v", flags.all())
+	}
+	if flags.enabled("teleport") {
+		t.Error("unknown features should be disabled")
+	}
+
+	for _, bad := range []string{"chat", "chat=maybe", "teleport=on"} {
+		if _, err := newFeatureFlags([]string{bad}); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHandleFeatures(t *testing.T) {
+	flags, _ := newFeatureFlags(nil)
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), features: flags}
+	handler := newAPIKeyAuth([]string{"admin-key"}).adminMiddleware(agent.handleFeatures)
+
+	patch := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/admin/features", strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := patch("user-key", `{"chat": false}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("non-admin key: got status %d", rec.Code)
+	}
+
+	rec := patch("admin-key", `{"chat": false, "nowcasting": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Features map[string]bool `json:"features"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Features[FeatureChat] || !resp.Features[FeatureNowcasting] {
+		t.Errorf("unexpected response %v", resp.Features)
+	}
+	if agent.featureEnabled(FeatureChat) {
+		t.Error("chat should be disabled")
+	}
+
+	// An unknown feature rejects the whole change
+	if rec := patch("admin-key", `{"chat": true, "teleport": true}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown feature: got status %d", rec.Code)
+	}
+	if agent.featureEnabled(FeatureChat) {
+		t.Error("chat should still be disabled after a rejected change")
+	}
+}
+
+func TestAdminMiddlewareWithoutKeys(t *testing.T) {
+	handler := newAPIKeyAuth(nil).adminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/admin/features", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want 403", rec.Code)
+	}
+}
+
+func TestDisabledNotifiersDropNotifications(t *testing.T) {
+	flags, _ := newFeatureFlags([]string{"notifiers=off"})
+	sent := 0
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		features:   flags,
+		notifiers:  []Notifier{countingNotifier{&sent}},
+	}
+	agent.notify(Notification{Type: NotificationAlert, Message: "storm"})
+	if sent != 0 {
+		t.Errorf("disabled notifiers sent %d notifications", sent)
+	}
+
+	flags.set(FeatureNotifiers, true)
+	agent.notify(Notification{Type: NotificationAlert, Message: "storm"})
+	if sent != 1 {
+		t.Errorf("enabled notifiers sent %d notifications, want 1", sent)
+	}
+}
+
+type countingNotifier struct{ sent *int }
+
+func (c countingNotifier) Channel() string { return "test" }
+func (c countingNotifier) Target() string  { return "" }
+func (c countingNotifier) Notify(n Notification) error {
+	*c.sent++
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Ratings accepted by /api/feedback
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+const (
+	maxFeedbackRecords     = 1000
+	maxFeedbackComment     = 500
+	minFeedbackForGuidance = 10 // Ratings needed before they shape the prompt
+)
+
+// A user's rating of a generated message
+type Feedback struct {
+	MessageID string    `json:"message_id"`
+	Rating    string    `json:"rating"`
+	Comment   string    `json:"comment,omitempty"`
+	Length    int       `json:"length"` // Characters in the rated message
+	Time      time.Time `json:"time"`
+
+	client string // Who rated it, so a change of mind replaces the earlier rating
+}
+
+// Prompt guidance suggested by disliked messages' comments
+var feedbackCommentGuidance = []struct {
+	Words    []string
+	Guidance string
+}{
+	{[]string{"long", "verbose", "wordy", "too much"}, "Users disliked overly long messages, so keep it short."},
+	{[]string{"emoji"}, "Users disliked emoji, so don't use any."},
+	{[]string{"jargon", "technical", "confusing"}, "Users found some messages too technical, so use plain words."},
+	{[]string{"repetitive", "same", "boring"}, "Users found messages repetitive, so vary the wording."},
+}
+
+// Summary of the ratings, and the prompt guidance they suggest
+type FeedbackSummary struct {
+	Up       int        `json:"up"`
+	Down     int        `json:"down"`
+	Guidance []string   `json:"guidance"`
+	Recent   []Feedback `json:"recent"` // Newest first
+}
+
+// Bounded, concurrency-safe log of message ratings
+type feedbackLog struct {
+	mu      sync.Mutex
+	records []Feedback
+}
+
+func newFeedbackLog() *feedbackLog {
+	return &feedbackLog{}
+}
+
+// Record a rating, replacing the client's earlier rating of the same message
+func (f *feedbackLog) record(feedback Feedback) {
+	if feedback.Time.IsZero() {
+		feedback.Time = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.records {
+		if existing.MessageID == feedback.MessageID && existing.client == feedback.client {
+			f.records = append(f.records[:i], f.records[i+1:]...)
+			break
+		}
+	}
+	if len(f.records) >= maxFeedbackRecords {
+		f.records = f.records[1:]
+	}
+	f.records = append(f.records, feedback)
+}
+
+// Totals, guidance and up to limit recent ratings
+func (f *feedbackLog) summary(limit int) FeedbackSummary {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	summary := FeedbackSummary{Guidance: []string{}, Recent: []Feedback{}}
+	var upLength, downLength int
+	comments := make([]string, 0)
+	for i := len(f.records) - 1; i >= 0; i-- {
+		feedback := f.records[i]
+		if feedback.Rating == RatingUp {
+			summary.Up++
+			upLength += feedback.Length
+		} else {
+			summary.Down++
+			downLength += feedback.Length
+			comments = append(comments, strings.ToLower(feedback.Comment))
+		}
+		if len(summary.Recent) < limit {
+			summary.Recent = append(summary.Recent, feedback)
+		}
+	}
+	if summary.Up+summary.Down < minFeedbackForGuidance || summary.Down == 0 {
+		return summary
+	}
+
+	// Disliked messages running well over the liked ones' length say enough on their own
+	long := summary.Up > 0 && float64(downLength)/float64(summary.Down) > 1.25*float64(upLength)/float64(summary.Up)
+	for i, rule := range feedbackCommentGuidance {
+		mentions := 0
+		for _, comment := range comments {
+			for _, word := range rule.Words {
+				if strings.Contains(comment, word) {
+					mentions++
+					break
+				}
+			}
+		}
+		// A theme in a fifth of the complaints is worth acting on
+		if 5*mentions >= summary.Down || (i == 0 && long) {
+			summary.Guidance = append(summary.Guidance, rule.Guidance)
+		}
+	}
+	return summary
+}
+
+// Guidance from user feedback to add to the weather message prompt, if
+// FEEDBACK_GUIDANCE is on and there's enough feedback
+func (agent *WeatherAgent) feedbackPrompt() string {
+	if !agent.config.FeedbackGuidance {
+		return ""
+	}
+	guidance := agent.feedback.summary(0).Guidance
+	if len(guidance) == 0 {
+		return ""
+	}
+	return "\n\nFeedback from users on earlier messages: " + strings.Join(guidance, " ")
+}
+
+// POST /api/feedback with {"message_id": "...", "rating": "up", "comment": "..."}
+// rates a message served by /api/weather; GET summarizes the ratings
+func (agent *WeatherAgent) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, agent.feedback.summary(20))
+		return
+	case http.MethodPost:
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FeedbackRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+		apiError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	switch {
+	case req.Rating != RatingUp && req.Rating != RatingDown:
+		apiError(w, fmt.Sprintf("rating must be %q or %q", RatingUp, RatingDown), http.StatusBadRequest)
+		return
+	case utf8.RuneCountInString(req.Comment) > maxFeedbackComment:
+		apiError(w, fmt.Sprintf("comment is too long (max %d characters)", maxFeedbackComment), http.StatusBadRequest)
+		return
+	}
+	deliveries := agent.deliveries.list("", req.MessageID, 1)
+	if req.MessageID == "" || len(deliveries) == 0 {
+		apiError(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	feedback := Feedback{
+		MessageID: req.MessageID,
+		Rating:    req.Rating,
+		Comment:   req.Comment,
+		Length:    utf8.RuneCountInString(deliveries[0].Message),
+		client:    clientIP(r, agent.config.proxyHops()),
+	}
+	agent.feedback.record(feedback)
+	writeJSON(w, http.StatusCreated, feedback)
+}
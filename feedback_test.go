@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleFeedback(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+	agent.deliveries = newDeliveryLog()
+	agent.feedback = newFeedbackLog()
+	agent.deliveries.record(Delivery{MessageID: "msg-1", Channel: ChannelUI, Message: "Sunny and mild."})
+
+	post := func(body, client string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/feedback", strings.NewReader(body))
+		req.RemoteAddr = client + ":1234"
+		rec := httptest.NewRecorder()
+		agent.handleFeedback(rec, req)
+		return rec.Code
+	}
+	tests := []struct {
+		name   string
+		body   string
+		client string
+		want   int
+	}{
+		{"thumbs up", `{"message_id":"msg-1","rating":"up"}`, "192.0.2.1", http.StatusCreated},
+		{"change of mind", `{"message_id":"msg-1","rating":"down","comment":"Too long"}`, "192.0.2.1", http.StatusCreated},
+		{"another client", `{"message_id":"msg-1","rating":"up"}`, "192.0.2.2", http.StatusCreated},
+		{"unknown rating", `{"message_id":"msg-1","rating":"meh"}`, "192.0.2.3", http.StatusBadRequest},
+		{"unknown message", `{"message_id":"msg-2","rating":"up"}`, "192.0.2.3", http.StatusNotFound},
+		{"comment too long", `{"message_id":"msg-1","rating":"down","comment":"` + strings.Repeat("x", maxFeedbackComment+1) + `"}`, "192.0.2.3", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := post(tt.body, tt.client); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	summary := agent.feedback.summary(10)
+	if summary.Up != 1 || summary.Down != 1 || len(summary.Recent) != 2 {
+		t.Errorf("summary = %+v, want one rating each way", summary)
+	}
+	if summary.Recent[1].Length != len("Sunny and mild.") {
+		t.Errorf("rated message length = %d", summary.Recent[1].Length)
+	}
+}
+
+func TestFeedbackGuidance(t *testing.T) {
+	agent := newFixtureAgent(t, Config{FeedbackGuidance: true})
+	agent.feedback = newFeedbackLog()
+	rate := func(n int, rating, comment string, length int) {
+		for i := 0; i < n; i++ {
+			agent.feedback.record(Feedback{MessageID: rating + comment + string(rune('a'+i)), Rating: rating, Comment: comment, Length: length})
+		}
+	}
+
+	rate(5, RatingDown, "Way too long", 400)
+	if prompt := agent.feedbackPrompt(); prompt != "" {
+		t.Errorf("guidance from 5 ratings: %q", prompt)
+	}
+
+	rate(6, RatingUp, "", 350)
+	rate(1, RatingDown, "Too many emoji", 300)
+	guidance := agent.feedback.summary(0).Guidance
+	if len(guidance) != 1 || !strings.Contains(guidance[0], "overly long") {
+		t.Errorf("guidance = %q, want only the length complaint (1 of 6 mentions emoji)", guidance)
+	}
+	if prompt := agent.feedbackPrompt(); !strings.Contains(prompt, "keep it short") {
+		t.Errorf("feedbackPrompt() = %q", prompt)
+	}
+
+	agent.config.FeedbackGuidance = false
+	if prompt := agent.feedbackPrompt(); prompt != "" {
+		t.Errorf("feedbackPrompt() with FEEDBACK_GUIDANCE off = %q", prompt)
+	}
+}
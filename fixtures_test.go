@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Canned upstream responses for offline tests. Coordinates and readings are
+// for Oslo, NO.
+const (
+	fixtureOpenMeteoGeocoding = `{"results":[
+		{"name":"Oslo","country":"Norway","country_code":"NO","admin1":"Oslo","latitude":59.9127,"longitude":10.7461,"population":580000,"feature_code":"PPLC"},
+		{"name":"Oslo","country":"United States","country_code":"US","admin1":"Minnesota","latitude":48.1947,"longitude":-97.1317,"population":330,"feature_code":"PPL"}
+	]}`
+	fixtureNominatim = `[{"name":"Oslo","display_name":"Oslo, Norway","lat":"59.9133","lon":"10.7389","importance":0.8,"addresstype":"city","address":{"city":"Oslo","country":"Norway","country_code":"no"}}]`
+	fixtureForecast  = `{
+		"timezone":"Europe/Oslo","timezone_abbreviation":"CEST","utc_offset_seconds":7200,
+		"current_units":{"temperature_2m":"°C","wind_speed_10m":"km/h"},
+		"current":{"time":"2024-06-15T14:00","temperature_2m":18.4,"relative_humidity_2m":62,"apparent_temperature":17.9,
+			"precipitation":0.0,"weather_code":2,"cloud_cover":40,"wind_speed_10m":11.2,"wind_direction_10m":225,"wind_gusts_10m":24.5,"is_day":1,"uv_index":4.5},
+		"hourly":{"time":["2024-06-15T13:00","2024-06-15T14:00","2024-06-15T15:00"],"uv_index":[4.1,4.5,4.2],"visibility":[24140,18320,null],"precipitation_probability":[5,20,60]},
+		"daily":{"time":["2024-06-15"],"temperature_2m_max":[21.3],"temperature_2m_min":[11.8]}
+	}`
+	fixtureIQAir = `{"status":"success","data":{"city":"Oslo","state":"Oslo","country":"Norway",
+		"location":{"type":"Point","coordinates":[10.7461,59.9127]},
+		"current":{"weather":{"ts":"2024-06-15T12:00:00.000Z","tp":18,"pr":1013,"hu":62,"ws":3.1,"wd":225,"ic":"02d"},
+			"pollution":{"ts":"2024-06-15T12:00:00.000Z","aqius":42,"mainus":"p2","aqicn":15,"maincn":"p2","p2":10.1,"p1":14.3}}}}`
+	fixtureAirPollution = `{"list":[{"main":{"aqi":2},"components":{"co":201.9,"no":0.1,"no2":8.2,"o3":68.7,"so2":0.6,"pm2_5":6.1,"pm10":9.4,"nh3":0.4}}]}`
+	fixtureAnthropic    = `{"content":[{"type":"text","text":"Partly cloudy and mild in Oslo."}],"usage":{"input_tokens":120,"output_tokens":12}}`
+	fixtureOpenAI       = `{"choices":[{"message":{"role":"assistant","content":"Partly cloudy and mild in Oslo."}}],"usage":{"prompt_tokens":120,"completion_tokens":12}}`
+)
+
+// Routes outgoing requests to handlers by host so the pipeline runs without
+// the network. Requests to hosts without a handler fail; loopback requests
+// (httptest servers) go out as normal.
+type fixtureTransport struct {
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []*http.Request
+	next     http.RoundTripper
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return f.next.RoundTrip(req)
+	}
+
+	f.mu.Lock()
+	handler, ok := f.handlers[host]
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no fixture for %s", host)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Requests made to host so far
+func (f *fixtureTransport) count(host string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, req := range f.requests {
+		if req.URL.Hostname() == host {
+			n++
+		}
+	}
+	return n
+}
+
+// Replace the default transport with fixtures for the rest of the test
+func useFixtures(t *testing.T, handlers map[string]http.HandlerFunc) *fixtureTransport {
+	t.Helper()
+	original := http.DefaultTransport
+	f := &fixtureTransport{handlers: handlers, next: original}
+	http.DefaultTransport = f
+	t.Cleanup(func() { http.DefaultTransport = original })
+	return f
+}
+
+// Handler replying with a fixed JSON body
+func serveJSON(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}
+}
+
+// Handler replying with an error status
+func serveStatus(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// Fixtures for every provider the default pipeline calls
+func defaultFixtures() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"geocoding-api.open-meteo.com": serveJSON(fixtureOpenMeteoGeocoding),
+		"nominatim.openstreetmap.org":  serveJSON(fixtureNominatim),
+		"api.open-meteo.com":           serveJSON(fixtureForecast),
+		"api.airvisual.com":            serveJSON(fixtureIQAir),
+		"api.openweathermap.org":       serveJSON(fixtureAirPollution),
+		"api.anthropic.com":            serveJSON(fixtureAnthropic),
+		"api.openai.com":               serveJSON(fixtureOpenAI),
+	}
+}
+
+// Records prompts and answers with a fixed reply. Safe for concurrent use.
+type fakeLLM struct {
+	mu      sync.Mutex
+	reply   string
+	prompts []string
+	params  llmParams // Settings of the last call
+}
+
+func (f *fakeLLM) complete(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prompts = append(f.prompts, userMessage)
+	f.params = params
+	return f.reply, llmUsage{InputTokens: len(userMessage) / 4, OutputTokens: len(f.reply) / 4}, nil
+}
+
+// Agent for pipeline tests: Oslo in metric units, with the archive and
+// global feed enrichments switched off
+func newFixtureAgent(t *testing.T, config Config) *WeatherAgent {
+	t.Helper()
+	if config.City == "" {
+		config.City, config.CountryCode = "Oslo", "NO"
+	}
+	if config.Units == "" {
+		config.Units = "metric"
+	}
+	if config.CacheTTLSeconds == 0 {
+		config.CacheTTLSeconds = 600
+	}
+	if config.LLMMaxTokens == 0 {
+		config.LLMMaxTokens = 500
+	}
+	if config.MessageSimilarity == 0 {
+		config.MessageSimilarity, config.RecentMessages = 0.7, 5
+	}
+	flags, err := newFeatureFlags([]string{"cyclones=off", "earthquakes=off", "climate_normals=off", "last_year=off", "ensemble=off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WeatherAgent{
+		config:         config,
+		secrets:        config.secrets(),
+		logger:         log.New(io.Discard, "", 0),
+		cache:          newMemoryCache(),
+		weatherHistory: newLocationHistory(),
+		observations:   &observationStore{},
+		features:       flags,
+	}
+}
+
+// The fixtures themselves should not drift from what the parsers expect
+func TestFixtureTransport(t *testing.T) {
+	fixtures := useFixtures(t, defaultFixtures())
+
+	resp, err := http.Get("https://api.open-meteo.com/v1/forecast?latitude=1&longitude=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "temperature_2m") {
+		t.Errorf("fixture response = %d %s", resp.StatusCode, body)
+	}
+	if fixtures.count("api.open-meteo.com") != 1 {
+		t.Errorf("recorded %d requests, want 1", fixtures.count("api.open-meteo.com"))
+	}
+
+	if _, err := http.Get("https://example.invalid/"); err == nil {
+		t.Error("request to a host without a fixture: expected error")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Maximum number of days Open-Meteo will forecast
+const maxForecastDays = 16
+
+// A single day of the daily forecast
+type ForecastDay struct {
+	Date                     string  `json:"date"`
+	TempMax                  float64 `json:"temp_max"`
+	TempMin                  float64 `json:"temp_min"`
+	WeatherCode              int     `json:"weather_code"`
+	Condition                string  `json:"condition"`
+	Description              string  `json:"description"`
+	PrecipitationProbability int     `json:"precipitation_probability"`
+	Sunrise                  string  `json:"sunrise"`
+	Sunset                   string  `json:"sunset"`
+}
+
+// Daily forecast for a location
+type Forecast struct {
+	City     string        `json:"city"`
+	Country  string        `json:"country"`
+	Units    string        `json:"units"`
+	Timezone int           `json:"timezone"` // Timezone offset in seconds
+	Days     []ForecastDay `json:"days"`
+}
+
+// Fetch the daily forecast from Open-Meteo for the given coordinates
+func (agent *WeatherAgent) fetchForecast(lat, lon float64, days int) (Forecast, error) {
+	if days < 1 {
+		days = 1
+	}
+	if days > maxForecastDays {
+		days = maxForecastDays
+	}
+
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&daily=temperature_2m_max,temperature_2m_min,weather_code,precipitation_probability_max,sunrise,sunset&forecast_days=%d&temperature_unit=%s&timezone=auto",
+		lat, lon, days, tempUnit)
+
+	client := agent.httpClient(10 * time.Second)
+	resp, err := client.Get(url)
+	if err != nil {
+		return Forecast{}, fmt.Errorf("forecast request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return Forecast{}, fmt.Errorf("forecast API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var forecastResp struct {
+		Daily struct {
+			Time                     []string  `json:"time"`
+			TempMax                  []float64 `json:"temperature_2m_max"`
+			TempMin                  []float64 `json:"temperature_2m_min"`
+			WeatherCode              []int     `json:"weather_code"`
+			PrecipitationProbability []int     `json:"precipitation_probability_max"`
+			Sunrise                  []string  `json:"sunrise"`
+			Sunset                   []string  `json:"sunset"`
+		} `json:"daily"`
+		TimezoneOffset int `json:"utc_offset_seconds"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&forecastResp); err != nil {
+		return Forecast{}, fmt.Errorf("failed to parse forecast response: %v", err)
+	}
+
+	daily := forecastResp.Daily
+	forecast := Forecast{
+		Units:    agent.config.Units,
+		Timezone: forecastResp.TimezoneOffset,
+		Days:     make([]ForecastDay, 0, len(daily.Time)),
+	}
+
+	for i, date := range daily.Time {
+		day := ForecastDay{Date: date}
+		if i < len(daily.TempMax) {
+			day.TempMax = daily.TempMax[i]
+		}
+		if i < len(daily.TempMin) {
+			day.TempMin = daily.TempMin[i]
+		}
+		if i < len(daily.WeatherCode) {
+			day.WeatherCode = daily.WeatherCode[i]
+			day.Condition = agent.weatherCodeToCondition(day.WeatherCode)
+			day.Description = agent.weatherCodeToDescription(day.WeatherCode)
+		}
+		if i < len(daily.PrecipitationProbability) {
+			day.PrecipitationProbability = daily.PrecipitationProbability[i]
+		}
+		if i < len(daily.Sunrise) {
+			day.Sunrise = formatOpenMeteoClock(daily.Sunrise[i])
+		}
+		if i < len(daily.Sunset) {
+			day.Sunset = formatOpenMeteoClock(daily.Sunset[i])
+		}
+		forecast.Days = append(forecast.Days, day)
+	}
+
+	return forecast, nil
+}
+
+// Convert an Open-Meteo local timestamp ("2006-01-02T15:04") to "3:04 PM"
+func formatOpenMeteoClock(ts string) string {
+	t, err := time.Parse("2006-01-02T15:04", ts)
+	if err != nil {
+		return ts
+	}
+	return t.Format("3:04 PM")
+}
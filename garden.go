@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Garden settings
+const (
+	gardenPastDays     = 30 // Days of growing degree days accumulated
+	gardenForecastDays = 8  // Today plus the week ahead
+	gardenFrostNights  = 3  // Nights checked for frost
+	gardenCacheTTL     = time.Hour
+)
+
+// Frost risk levels
+const (
+	FrostNone     = "none"
+	FrostLow      = "low"      // Ground frost possible in sheltered spots
+	FrostModerate = "moderate" // Ground frost likely
+	FrostHigh     = "high"     // Air frost forecast
+)
+
+// Gardening view of a location. Always metric: °C, mm and m³/m³.
+type GardenReport struct {
+	City              string   `json:"city,omitempty"`
+	Country           string   `json:"country,omitempty"`
+	GDDBaseC          float64  `json:"gdd_base_c"`
+	GDDPast30Days     float64  `json:"gdd_past_30_days"`
+	GDDToday          float64  `json:"gdd_today"`
+	GDDNext7Days      float64  `json:"gdd_next_7_days"`
+	FrostRisk         string   `json:"frost_risk"`
+	FrostNights       []string `json:"frost_nights,omitempty"` // Dates whose minimum is at or below 0°C
+	LowestMinC        float64  `json:"lowest_min_c"`           // Over the next few nights
+	SoilTempC         float64  `json:"soil_temp_c"`            // At 6 cm
+	SoilMoisture      float64  `json:"soil_moisture"`          // 3-9 cm, volumetric m³/m³
+	SoilMoistureLevel string   `json:"soil_moisture_level"`
+	ET0TodayMM        float64  `json:"et0_today_mm"` // Reference evapotranspiration
+	ET0Next7DaysMM    float64  `json:"et0_next_7_days_mm"`
+	RainNext7DaysMM   float64  `json:"rain_next_7_days_mm"`
+	WaterBalanceMM    float64  `json:"water_balance_mm"` // Rain minus evapotranspiration over the week
+	Advice            string   `json:"advice,omitempty"` // Empty when the LLM is unavailable
+}
+
+// Daily and hourly series a garden report is computed from
+type gardenSeries struct {
+	Dates         []string
+	TempMax       []float64
+	TempMin       []float64
+	ET0           []float64
+	Precipitation []float64
+	Hours         []string
+	SoilTemp      []float64
+	SoilMoisture  []float64
+}
+
+// Growing degree days for one day (simple averaging method)
+func growingDegreeDays(tempMax, tempMin, base float64) float64 {
+	return math.Max(0, (tempMax+tempMin)/2-base)
+}
+
+// Frost risk from the lowest air temperature forecast. Ground frost forms
+// at air temperatures a few degrees above freezing on clear, still nights.
+func frostRisk(lowestMinC float64) string {
+	switch {
+	case lowestMinC <= 0:
+		return FrostHigh
+	case lowestMinC <= 2:
+		return FrostModerate
+	case lowestMinC <= 4:
+		return FrostLow
+	}
+	return FrostNone
+}
+
+// Describe volumetric soil moisture near the surface for a typical loam
+func soilMoistureLevel(moisture float64) string {
+	switch {
+	case moisture < 0.15:
+		return "dry"
+	case moisture > 0.35:
+		return "wet"
+	}
+	return "adequate"
+}
+
+// Round to one decimal place
+func round1(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// Compute the report from the series. today is the local date and hour is
+// the local hour, e.g. "2006-01-02T15:00".
+func computeGarden(s gardenSeries, today, hour string, baseC float64) (GardenReport, error) {
+	todayIndex := -1
+	for i, date := range s.Dates {
+		if date == today {
+			todayIndex = i
+		}
+	}
+	if todayIndex < 0 || len(s.TempMax) != len(s.Dates) || len(s.TempMin) != len(s.Dates) {
+		return GardenReport{}, fmt.Errorf("no garden data for %s", today)
+	}
+
+	report := GardenReport{GDDBaseC: baseC, LowestMinC: math.Inf(1)}
+	for i := range s.Dates {
+		gdd := growingDegreeDays(s.TempMax[i], s.TempMin[i], baseC)
+		switch {
+		case i < todayIndex:
+			report.GDDPast30Days += gdd
+		case i == todayIndex:
+			report.GDDToday = gdd
+		default:
+			report.GDDNext7Days += gdd
+		}
+
+		if i >= todayIndex && i < todayIndex+gardenFrostNights {
+			report.LowestMinC = math.Min(report.LowestMinC, s.TempMin[i])
+			if s.TempMin[i] <= 0 {
+				report.FrostNights = append(report.FrostNights, s.Dates[i])
+			}
+		}
+		if i >= todayIndex && i < len(s.ET0) && i < len(s.Precipitation) {
+			if i == todayIndex {
+				report.ET0TodayMM = s.ET0[i]
+			} else {
+				report.ET0Next7DaysMM += s.ET0[i]
+				report.RainNext7DaysMM += s.Precipitation[i]
+			}
+		}
+	}
+	report.FrostRisk = frostRisk(report.LowestMinC)
+
+	for i, h := range s.Hours {
+		if h == hour && i < len(s.SoilTemp) && i < len(s.SoilMoisture) {
+			report.SoilTempC = s.SoilTemp[i]
+			report.SoilMoisture = s.SoilMoisture[i]
+		}
+	}
+	report.SoilMoistureLevel = soilMoistureLevel(report.SoilMoisture)
+
+	report.GDDPast30Days = round1(report.GDDPast30Days)
+	report.GDDToday = round1(report.GDDToday)
+	report.GDDNext7Days = round1(report.GDDNext7Days)
+	report.ET0TodayMM = round1(report.ET0TodayMM)
+	report.ET0Next7DaysMM = round1(report.ET0Next7DaysMM)
+	report.RainNext7DaysMM = round1(report.RainNext7DaysMM)
+	report.WaterBalanceMM = round1(report.RainNext7DaysMM - report.ET0Next7DaysMM)
+	return report, nil
+}
+
+// Fetch temperatures, evapotranspiration and soil conditions from Open-Meteo
+func (agent *WeatherAgent) fetchGarden(lat, lon float64, now time.Time) (GardenReport, error) {
+	// Always request metric values so the thresholds are unit-independent
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&daily=temperature_2m_max,temperature_2m_min,et0_fao_evapotranspiration,precipitation_sum&hourly=soil_temperature_6cm,soil_moisture_3_to_9cm&past_days=%d&forecast_days=%d&timezone=auto",
+		lat, lon, gardenPastDays, gardenForecastDays)
+
+	body, _, err := agent.cachedGet(url, gardenCacheTTL, false)
+	if err != nil {
+		return GardenReport{}, fmt.Errorf("garden request failed: %v", err)
+	}
+
+	var gardenResp struct {
+		UTCOffsetSeconds int `json:"utc_offset_seconds"`
+		Daily            struct {
+			Time          []string  `json:"time"`
+			TempMax       []float64 `json:"temperature_2m_max"`
+			TempMin       []float64 `json:"temperature_2m_min"`
+			ET0           []float64 `json:"et0_fao_evapotranspiration"`
+			Precipitation []float64 `json:"precipitation_sum"`
+		} `json:"daily"`
+		Hourly struct {
+			Time         []string  `json:"time"`
+			SoilTemp     []float64 `json:"soil_temperature_6cm"`
+			SoilMoisture []float64 `json:"soil_moisture_3_to_9cm"`
+		} `json:"hourly"`
+	}
+	if err := json.Unmarshal(body, &gardenResp); err != nil {
+		return GardenReport{}, fmt.Errorf("failed to parse garden response: %v", err)
+	}
+
+	local := now.In(time.FixedZone("Local", gardenResp.UTCOffsetSeconds))
+	return computeGarden(gardenSeries{
+		Dates:         gardenResp.Daily.Time,
+		TempMax:       gardenResp.Daily.TempMax,
+		TempMin:       gardenResp.Daily.TempMin,
+		ET0:           gardenResp.Daily.ET0,
+		Precipitation: gardenResp.Daily.Precipitation,
+		Hours:         gardenResp.Hourly.Time,
+		SoilTemp:      gardenResp.Hourly.SoilTemp,
+		SoilMoisture:  gardenResp.Hourly.SoilMoisture,
+	}, local.Format("2006-01-02"), local.Format("2006-01-02T15")+":00", agent.config.GardenGDDBase)
+}
+
+// Build the LLM prompt for gardening advice
+func gardenPrompt(report GardenReport) string {
+	var prompt strings.Builder
+	prompt.WriteString("Garden conditions (metric):\n")
+	fmt.Fprintf(&prompt, "- Growing degree days (base %.0f°C): %.0f over the last 30 days, %.1f today, %.0f forecast for the next 7 days\n",
+		report.GDDBaseC, report.GDDPast30Days, report.GDDToday, report.GDDNext7Days)
+	fmt.Fprintf(&prompt, "- Frost risk over the next %d nights: %s (lowest minimum %.1f°C)\n", gardenFrostNights, report.FrostRisk, report.LowestMinC)
+	if len(report.FrostNights) > 0 {
+		fmt.Fprintf(&prompt, "- Air frost forecast on: %s\n", strings.Join(report.FrostNights, ", "))
+	}
+	fmt.Fprintf(&prompt, "- Soil at 6 cm: %.1f°C; moisture %.2f m³/m³ (%s)\n", report.SoilTempC, report.SoilMoisture, report.SoilMoistureLevel)
+	fmt.Fprintf(&prompt, "- Evapotranspiration: %.1f mm today, %.1f mm over the next 7 days against %.1f mm of rain (balance %+.1f mm)\n",
+		report.ET0TodayMM, report.ET0Next7DaysMM, report.RainNext7DaysMM, report.WaterBalanceMM)
+	prompt.WriteString(`
+Write short, practical gardening advice for the coming week (under 120 words): whether to water and how much, whether to protect tender plants from frost, and whether the soil is warm enough for sowing (most vegetables need at least 10°C). Only use the numbers above.`)
+	return prompt.String()
+}
+
+// Compute the garden report for coordinates and ask the LLM for advice
+func (agent *WeatherAgent) gardenReport(lat, lon float64, now time.Time) (GardenReport, error) {
+	report, err := agent.fetchGarden(lat, lon, now)
+	if err != nil {
+		return report, err
+	}
+
+	advice, err := agent.callLLM(gardenPrompt(report))
+	if err != nil {
+		agent.logger.Printf("Error generating garden advice: %v", err)
+		return report, nil
+	}
+	report.Advice = advice
+	return report, nil
+}
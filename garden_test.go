@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComputeGarden(t *testing.T) {
+	series := gardenSeries{
+		Dates:         []string{"2026-04-14", "2026-04-15", "2026-04-16", "2026-04-17", "2026-04-18", "2026-04-19"},
+		TempMax:       []float64{18, 20, 16, 12, 14, 22},
+		TempMin:       []float64{6, 8, 4, -1, 1.5, 10},
+		ET0:           []float64{2, 2.5, 2.2, 1.5, 1.8, 3},
+		Precipitation: []float64{0, 0, 0, 4, 1, 0},
+		Hours:         []string{"2026-04-16T08:00", "2026-04-16T09:00"},
+		SoilTemp:      []float64{8.5, 9.2},
+		SoilMoisture:  []float64{0.12, 0.11},
+	}
+
+	report, err := computeGarden(series, "2026-04-16", "2026-04-16T09:00", 10)
+	if err != nil {
+		t.Fatalf("computeGarden() error = %v", err)
+	}
+
+	// Past: (18+6)/2-10=2 and (20+8)/2-10=4; today (16+4)/2-10=0; next: 0, 0 and 6
+	if report.GDDPast30Days != 6 || report.GDDToday != 0 || report.GDDNext7Days != 6 {
+		t.Errorf("GDD past %.1f, today %.1f, next %.1f; want 6, 0, 6", report.GDDPast30Days, report.GDDToday, report.GDDNext7Days)
+	}
+	if report.FrostRisk != FrostHigh || len(report.FrostNights) != 1 || report.FrostNights[0] != "2026-04-17" {
+		t.Errorf("frost risk %s on %v, want high on 2026-04-17", report.FrostRisk, report.FrostNights)
+	}
+	if report.SoilTempC != 9.2 || report.SoilMoistureLevel != "dry" {
+		t.Errorf("soil %.1f°C %s, want 9.2°C dry", report.SoilTempC, report.SoilMoistureLevel)
+	}
+	if report.ET0TodayMM != 2.2 || report.ET0Next7DaysMM != 6.3 || report.RainNext7DaysMM != 5 || report.WaterBalanceMM != -1.3 {
+		t.Errorf("ET0 today %.1f, next %.1f, rain %.1f, balance %.1f; want 2.2, 6.3, 5, -1.3",
+			report.ET0TodayMM, report.ET0Next7DaysMM, report.RainNext7DaysMM, report.WaterBalanceMM)
+	}
+
+	if _, err := computeGarden(series, "2026-05-01", "2026-05-01T09:00", 10); err == nil {
+		t.Error("computeGarden() for a date outside the series: expected error")
+	}
+}
+
+func TestFrostRisk(t *testing.T) {
+	tests := map[float64]string{-3: FrostHigh, 0: FrostHigh, 1.5: FrostModerate, 3: FrostLow, 8: FrostNone}
+	for lowest, want := range tests {
+		if got := frostRisk(lowest); got != want {
+			t.Errorf("frostRisk(%.1f) = %s, want %s", lowest, got, want)
+		}
+	}
+}
+
+func TestGardenPrompt(t *testing.T) {
+	prompt := gardenPrompt(GardenReport{GDDBaseC: 10, FrostRisk: FrostHigh, FrostNights: []string{"2026-04-17"}, SoilMoistureLevel: "dry"})
+	for _, want := range []string{"base 10°C", "Frost risk over the next 3 nights: high", "Air frost forecast on: 2026-04-17", "(dry)"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("gardenPrompt() missing %q:\n%s", want, prompt)
+		}
+	}
+}
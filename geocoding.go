@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Score above which a provider's best match is accepted without asking the next provider
+const geocodeConfidentScore = 6.0
+
+// A possible match for a forward geocoding query
+type geocodeCandidate struct {
+	Name        string
+	Region      string // State/province, when known
+	Country     string
+	CountryCode string // ISO 3166-1 alpha-2, upper case
+	Lat         float64
+	Lon         float64
+	Population  int
+	Importance  float64 // Provider relevance score (0-1), when available
+	PlaceType   string  // e.g. "city", "town", "village"
+	Provider    string
+	Score       float64
+}
+
+// A forward geocoding provider
+type geocodeProvider struct {
+	Name   string
+	Search func(agent *WeatherAgent, city, country string) ([]geocodeCandidate, error)
+}
+
+// Providers tried in order until one returns a confident match
+var geocodeProviders = []geocodeProvider{
+	{"open-meteo", (*WeatherAgent).searchOpenMeteo},
+	{"nominatim", (*WeatherAgent).searchNominatim},
+	{"photon", (*WeatherAgent).searchPhoton},
+}
+
+// Common non-ISO country codes people use
+var countryCodeAliases = map[string]string{
+	"uk":  "gb",
+	"usa": "us",
+	"uae": "ae",
+}
+
+// Normalize a country code to lower-case ISO 3166-1 alpha-2
+func normalizeCountryCode(country string) string {
+	country = strings.ToLower(strings.TrimSpace(country))
+	if alias, ok := countryCodeAliases[country]; ok {
+		return alias
+	}
+	return country
+}
+
+// Score how well a candidate matches the query. Candidates in the wrong
+// country score zero when a country filter is given.
+func scoreGeocodeCandidate(c geocodeCandidate, city, country string) float64 {
+	if country != "" && c.CountryCode != "" && !strings.EqualFold(c.CountryCode, country) {
+		return 0
+	}
+
+	score := 0.0
+
+	// Name match confidence
+	name := strings.ToLower(c.Name)
+	query := strings.ToLower(strings.TrimSpace(city))
+	switch {
+	case name == query:
+		score += 3
+	case strings.HasPrefix(name, query) || strings.HasPrefix(query, name):
+		score += 1.5
+	case strings.Contains(name, query):
+		score += 0.75
+	}
+
+	// Country filter matched
+	if country != "" && strings.EqualFold(c.CountryCode, country) {
+		score += 2
+	}
+
+	// Bigger places are more likely what people mean (Paris, FR over Paris, TX)
+	if c.Population > 0 {
+		score += math.Min(1.5, math.Log10(float64(c.Population))/5)
+	}
+
+	score += c.Importance
+
+	switch c.PlaceType {
+	case "city":
+		score += 0.5
+	case "town":
+		score += 0.25
+	}
+
+	return score
+}
+
+// Score all candidates and return them best first
+func rankGeocodeCandidates(candidates []geocodeCandidate, city, country string) []geocodeCandidate {
+	ranked := make([]geocodeCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		c.Score = scoreGeocodeCandidate(c, city, country)
+		if c.Score > 0 {
+			ranked = append(ranked, c)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// Resolve a city name to coordinates, failing over between providers and
+// picking the best-scoring candidate across them
+func (agent *WeatherAgent) geocode(city, country string) (geocodeCandidate, error) {
+	country = normalizeCountryCode(country)
+
+	var pool []geocodeCandidate
+	var errs []string
+	for _, provider := range geocodeProviders {
+		breaker := agent.breakers.get("geocoding/" + provider.Name)
+		if !breaker.allow() {
+			errs = append(errs, fmt.Sprintf("%s: %v", provider.Name, errCircuitOpen))
+			continue
+		}
+
+		candidates, err := provider.Search(agent, city, country)
+		if err != nil {
+			breaker.failure()
+			agent.logger.Printf("Geocoding via %s failed: %v", provider.Name, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", provider.Name, err))
+			continue
+		}
+		breaker.success()
+
+		pool = append(pool, candidates...)
+		ranked := rankGeocodeCandidates(pool, city, country)
+		if len(ranked) > 0 && ranked[0].Score >= geocodeConfidentScore {
+			return ranked[0], nil
+		}
+	}
+
+	ranked := rankGeocodeCandidates(pool, city, country)
+	if len(ranked) > 0 {
+		return ranked[0], nil
+	}
+	if len(errs) > 0 {
+		return geocodeCandidate{}, fmt.Errorf("no locations found for %s, %s (%s)", city, country, strings.Join(errs, "; "))
+	}
+	return geocodeCandidate{}, fmt.Errorf("no locations found for %s, %s", city, country)
+}
+
+// Fetch a geocoding URL and decode the JSON response
+func (agent *WeatherAgent) geocodeGet(requestURL string, out interface{}) error {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return err
+	}
+	// Nominatim's usage policy requires an identifying User-Agent
+	req.Header.Set("User-Agent", upstreamUserAgent)
+
+	client := agent.httpClient(geocodingHTTPTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// Search the Open-Meteo Geocoding API
+func (agent *WeatherAgent) searchOpenMeteo(city, country string) ([]geocodeCandidate, error) {
+	geocodeURL := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=10", url.QueryEscape(city))
+	if country != "" {
+		geocodeURL += "&countryCode=" + url.QueryEscape(strings.ToUpper(country))
+	}
+
+	var geocodeResp struct {
+		Results []struct {
+			Name        string  `json:"name"`
+			Country     string  `json:"country"`
+			CountryCode string  `json:"country_code"`
+			Admin1      string  `json:"admin1"`
+			Latitude    float64 `json:"latitude"`
+			Longitude   float64 `json:"longitude"`
+			Population  int     `json:"population"`
+			FeatureCode string  `json:"feature_code"`
+		} `json:"results"`
+	}
+	if err := agent.geocodeGet(geocodeURL, &geocodeResp); err != nil {
+		return nil, err
+	}
+
+	candidates := make([]geocodeCandidate, 0, len(geocodeResp.Results))
+	for _, r := range geocodeResp.Results {
+		placeType := ""
+		// GeoNames feature codes: PPLC capital, PPLA* admin seats, PPL populated place
+		if strings.HasPrefix(r.FeatureCode, "PPLC") || strings.HasPrefix(r.FeatureCode, "PPLA") {
+			placeType = "city"
+		} else if strings.HasPrefix(r.FeatureCode, "PPL") {
+			placeType = "town"
+		}
+		candidates = append(candidates, geocodeCandidate{
+			Name:        r.Name,
+			Region:      r.Admin1,
+			Country:     r.Country,
+			CountryCode: strings.ToUpper(r.CountryCode),
+			Lat:         r.Latitude,
+			Lon:         r.Longitude,
+			Population:  r.Population,
+			PlaceType:   placeType,
+			Provider:    "open-meteo",
+		})
+	}
+	return candidates, nil
+}
+
+// Search OpenStreetMap Nominatim
+func (agent *WeatherAgent) searchNominatim(city, country string) ([]geocodeCandidate, error) {
+	geocodeURL := fmt.Sprintf("https://nominatim.openstreetmap.org/search?format=jsonv2&addressdetails=1&extratags=1&limit=10&city=%s", url.QueryEscape(city))
+	if country != "" {
+		geocodeURL += "&countrycodes=" + url.QueryEscape(country)
+	}
+
+	var results []struct {
+		Name        string  `json:"name"`
+		Lat         string  `json:"lat"`
+		Lon         string  `json:"lon"`
+		Importance  float64 `json:"importance"`
+		AddressType string  `json:"addresstype"`
+		Address     struct {
+			State       string `json:"state"`
+			Country     string `json:"country"`
+			CountryCode string `json:"country_code"`
+		} `json:"address"`
+		ExtraTags struct {
+			Population string `json:"population"`
+		} `json:"extratags"`
+	}
+	if err := agent.geocodeGet(geocodeURL, &results); err != nil {
+		return nil, err
+	}
+
+	candidates := make([]geocodeCandidate, 0, len(results))
+	for _, r := range results {
+		var lat, lon float64
+		if _, err := fmt.Sscanf(r.Lat, "%f", &lat); err != nil {
+			continue
+		}
+		if _, err := fmt.Sscanf(r.Lon, "%f", &lon); err != nil {
+			continue
+		}
+		var population int
+		fmt.Sscanf(r.ExtraTags.Population, "%d", &population)
+
+		candidates = append(candidates, geocodeCandidate{
+			Name:        r.Name,
+			Region:      r.Address.State,
+			Country:     r.Address.Country,
+			CountryCode: strings.ToUpper(r.Address.CountryCode),
+			Lat:         lat,
+			Lon:         lon,
+			Population:  population,
+			Importance:  r.Importance,
+			PlaceType:   r.AddressType,
+			Provider:    "nominatim",
+		})
+	}
+	return candidates, nil
+}
+
+// Search the Photon geocoder (komoot)
+func (agent *WeatherAgent) searchPhoton(city, country string) ([]geocodeCandidate, error) {
+	geocodeURL := fmt.Sprintf("https://photon.komoot.io/api/?q=%s&limit=10&layer=city", url.QueryEscape(city))
+
+	var photonResp struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"` // [lon, lat]
+			} `json:"geometry"`
+			Properties struct {
+				Name        string `json:"name"`
+				State       string `json:"state"`
+				Country     string `json:"country"`
+				CountryCode string `json:"countrycode"`
+				OSMValue    string `json:"osm_value"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := agent.geocodeGet(geocodeURL, &photonResp); err != nil {
+		return nil, err
+	}
+
+	candidates := make([]geocodeCandidate, 0, len(photonResp.Features))
+	for _, f := range photonResp.Features {
+		if len(f.Geometry.Coordinates) < 2 {
+			continue
+		}
+		candidates = append(candidates, geocodeCandidate{
+			Name:        f.Properties.Name,
+			Region:      f.Properties.State,
+			Country:     f.Properties.Country,
+			CountryCode: strings.ToUpper(f.Properties.CountryCode),
+			Lat:         f.Geometry.Coordinates[1],
+			Lon:         f.Geometry.Coordinates[0],
+			PlaceType:   f.Properties.OSMValue,
+			Provider:    "photon",
+		})
+	}
+	return candidates, nil
+}
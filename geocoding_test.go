@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestRankGeocodeCandidatesPrefersPopulousExactMatch(t *testing.T) {
+	candidates := []geocodeCandidate{
+		{Name: "Paris", CountryCode: "US", Region: "Texas", Population: 25000, PlaceType: "town"},
+		{Name: "Paris", CountryCode: "FR", Population: 2138551, PlaceType: "city"},
+		{Name: "Parisot", CountryCode: "FR", Population: 500},
+	}
+
+	ranked := rankGeocodeCandidates(candidates, "Paris", "")
+	if len(ranked) != 3 {
+		t.Fatalf("expected 3 ranked candidates, got %d", len(ranked))
+	}
+	if ranked[0].CountryCode != "FR" || ranked[0].Name != "Paris" {
+		t.Errorf("expected Paris, FR first, got %+v", ranked[0])
+	}
+	if ranked[2].Name != "Parisot" {
+		t.Errorf("expected partial match last, got %+v", ranked[2])
+	}
+}
+
+func TestRankGeocodeCandidatesCountryFilter(t *testing.T) {
+	candidates := []geocodeCandidate{
+		{Name: "London", CountryCode: "GB", Population: 8900000, PlaceType: "city"},
+		{Name: "London", CountryCode: "CA", Population: 383000, PlaceType: "city"},
+	}
+
+	ranked := rankGeocodeCandidates(candidates, "london", normalizeCountryCode("CA"))
+	if len(ranked) != 1 || ranked[0].CountryCode != "CA" {
+		t.Fatalf("country filter should keep only London, CA, got %+v", ranked)
+	}
+	if ranked[0].Score < geocodeConfidentScore {
+		t.Errorf("exact match in the requested country should be confident, score %.2f", ranked[0].Score)
+	}
+}
+
+func TestNormalizeCountryCode(t *testing.T) {
+	tests := map[string]string{
+		"uk":  "gb",
+		"UK":  "gb",
+		"USA": "us",
+		"FR":  "fr",
+		" de": "de",
+		"":    "",
+	}
+	for in, want := range tests {
+		if got := normalizeCountryCode(in); got != want {
+			t.Errorf("normalizeCountryCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "github.com/joshkenney/weather-agent/pkg/units"
+
+// An unusual weather term and a plain-language definition
+type GlossaryTerm struct {
+	Term       string `json:"term"`
+	Definition string `json:"definition"`
+}
+
+// Conditions a glossary term is matched against, in metric units
+type glossaryConditions struct {
+	Code    int     // WMO weather code
+	TempC   float64 // Air temperature
+	GustKmh float64 // Wind gust speed
+}
+
+// A glossary term and when it applies to the current conditions
+type glossaryEntry struct {
+	GlossaryTerm
+	applies func(c glossaryConditions) bool
+}
+
+// Severe thunderstorm wind gust threshold (58 mph)
+const severeGustKmh = 93
+
+// Curated terms keyed by WMO weather code, some narrowed by temperature or wind
+var glossary = []glossaryEntry{
+	{
+		GlossaryTerm{"rime fog", "Freezing fog whose supercooled droplets freeze on contact, coating trees, fences and power lines in feathery white ice (rime)."},
+		func(c glossaryConditions) bool { return c.Code == 48 },
+	},
+	{
+		GlossaryTerm{"freezing drizzle", "Fine drizzle that falls as liquid but freezes on contact with cold surfaces, glazing roads and walkways."},
+		func(c glossaryConditions) bool { return c.Code == 56 || c.Code == 57 },
+	},
+	{
+		GlossaryTerm{"freezing rain", "Rain that falls through a shallow layer of sub-zero air near the ground and freezes on impact into a clear glaze of ice."},
+		func(c glossaryConditions) bool { return c.Code == 66 || c.Code == 67 },
+	},
+	{
+		GlossaryTerm{"snow grains", "Very small, flat white ice grains under 1 mm, the solid equivalent of drizzle, falling from stratus cloud or fog."},
+		func(c glossaryConditions) bool { return c.Code == 77 },
+	},
+	{
+		GlossaryTerm{"graupel", "Soft, opaque pellets of snow coated in rime that bounce and crumble when they land, common in cold showers near freezing."},
+		func(c glossaryConditions) bool {
+			return (c.Code == 85 || c.Code == 86 || c.Code == 96) && c.TempC >= -2 && c.TempC <= 5
+		},
+	},
+	{
+		GlossaryTerm{"hail", "Hard balls or lumps of ice grown in strong thunderstorm updrafts; large hail can damage cars, roofs and crops."},
+		func(c glossaryConditions) bool { return (c.Code == 96 && c.TempC > 5) || c.Code == 99 },
+	},
+	{
+		GlossaryTerm{"derecho", "A long-lived, widespread windstorm driven by a line of fast-moving thunderstorms, producing damaging straight-line winds."},
+		func(c glossaryConditions) bool { return c.Code >= 95 && c.Code <= 99 && c.GustKmh >= severeGustKmh },
+	},
+}
+
+// Glossary terms that apply to a weather reading
+func matchGlossary(weather WeatherResponse, system units.System) []GlossaryTerm {
+	if len(weather.Weather) == 0 {
+		return nil
+	}
+	conditions := glossaryConditions{
+		Code:    weather.Weather[0].ID,
+		TempC:   units.TemperatureIn(weather.Main.Temp, system).Celsius(),
+		GustKmh: units.SpeedIn(weather.Wind.Gust, system).KilometersPerHour(),
+	}
+
+	var terms []GlossaryTerm
+	for _, entry := range glossary {
+		if entry.applies(conditions) {
+			terms = append(terms, entry.GlossaryTerm)
+		}
+	}
+	return terms
+}
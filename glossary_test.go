@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+func TestMatchGlossary(t *testing.T) {
+	reading := func(code int, temp, gust float64) WeatherResponse {
+		w := statusWeather("", 1, temp)
+		w.Weather[0].ID = code
+		w.Wind.Gust = gust
+		return w
+	}
+
+	tests := []struct {
+		name    string
+		weather WeatherResponse
+		system  units.System
+		want    []string
+	}{
+		{"plain fog", reading(45, 3, 0), units.Metric, nil},
+		{"rime fog", reading(48, -4, 0), units.Metric, []string{"rime fog"}},
+		{"cold snow showers", reading(85, 1, 10), units.Metric, []string{"graupel"}},
+		{"deep-cold snow showers", reading(85, -12, 10), units.Metric, nil},
+		{"summer hailstorm", reading(96, 24, 40), units.Metric, []string{"hail"}},
+		{"severe storm", reading(95, 28, 110), units.Metric, []string{"derecho"}},
+		{"severe storm in mph", reading(95, 82, 65), units.Imperial, []string{"derecho"}},
+		{"ordinary storm", reading(95, 28, 50), units.Metric, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, term := range matchGlossary(tt.weather, tt.system) {
+			got = append(got, term.Term)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if terms := matchGlossary(WeatherResponse{}, units.Metric); terms != nil {
+		t.Errorf("reading without conditions matched %v", terms)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Observation fields Grafana can chart, in the configured units
+var observationFields = map[string]func(Observation) float64{
+	"temp":          func(o Observation) float64 { return o.Temp },
+	"feels_like":    func(o Observation) float64 { return o.FeelsLike },
+	"humidity":      func(o Observation) float64 { return float64(o.Humidity) },
+	"pressure":      func(o Observation) float64 { return float64(o.Pressure) },
+	"wind_speed":    func(o Observation) float64 { return o.WindSpeed },
+	"cloud_cover":   func(o Observation) float64 { return float64(o.CloudCover) },
+	"uv_index":      func(o Observation) float64 { return o.UVIndex },
+	"precipitation": func(o Observation) float64 { return o.Precip },
+}
+
+// How far back /api/grafana/search looks for cities to offer
+const grafanaCityLookback = 7 * 24 * time.Hour
+
+// Split a target into its city (empty for every city) and field: "temp" or
+// "Oslo:temp"
+func parseGrafanaTarget(target string) (city, field string, ok bool) {
+	field = strings.TrimSpace(target)
+	if i := strings.LastIndex(field, ":"); i >= 0 {
+		city, field = strings.TrimSpace(field[:i]), strings.TrimSpace(field[i+1:])
+	}
+	_, ok = observationFields[field]
+	return city, field, ok
+}
+
+// Targets to offer: each field, then each field for every recently seen city
+func (agent *WeatherAgent) grafanaTargets(filter string) ([]string, error) {
+	fields := make([]string, 0, len(observationFields))
+	for field := range observationFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	observations, err := agent.observations.since(time.Now().Add(-grafanaCityLookback), "")
+	if err != nil {
+		return nil, err
+	}
+	var cities []string
+	seen := make(map[string]bool)
+	for _, obs := range observations {
+		if !seen[obs.City] {
+			seen[obs.City] = true
+			cities = append(cities, obs.City)
+		}
+	}
+	sort.Strings(cities)
+
+	targets := append([]string{}, fields...)
+	for _, city := range cities {
+		for _, field := range fields {
+			targets = append(targets, city+":"+field)
+		}
+	}
+	filtered := targets[:0]
+	for _, target := range targets {
+		if strings.Contains(strings.ToLower(target), strings.ToLower(filter)) {
+			filtered = append(filtered, target)
+		}
+	}
+	return filtered, nil
+}
+
+// Answer one query target with a table of every matching observation, or a
+// series per city resampled down to about maxPoints when there are more
+func (agent *WeatherAgent) grafanaResult(target GrafanaTarget, from, to time.Time, maxPoints int) (interface{}, error) {
+	city, field, _ := parseGrafanaTarget(target.Target)
+	all, err := agent.observations.since(from, city)
+	if err != nil {
+		return nil, err
+	}
+	var observations []Observation
+	for _, obs := range all {
+		if obs.Time.Before(to) {
+			observations = append(observations, obs)
+		}
+	}
+	value := observationFields[field]
+
+	if target.Type == "table" {
+		table := GrafanaTable{Type: "table", Columns: []GrafanaColumn{
+			{Text: "Time", Type: "time"}, {Text: "City", Type: "string"}, {Text: field, Type: "number"},
+		}, Rows: [][]interface{}{}}
+		for _, obs := range observations {
+			table.Rows = append(table.Rows, []interface{}{obs.Time.UnixMilli(), obs.City, value(obs)})
+		}
+		return table, nil
+	}
+
+	if maxPoints > 0 && len(observations) > maxPoints {
+		step := (to.Sub(observations[0].Time) / time.Duration(maxPoints)).Round(time.Minute) + time.Minute
+		observations = applySeriesOptions(observations, seriesOptions{Step: step, MaxGap: defaultSeriesMaxGap})
+	}
+
+	var series []GrafanaSeries
+	index := make(map[string]int)
+	for _, obs := range observations {
+		i, ok := index[obs.City]
+		if !ok {
+			i = len(series)
+			index[obs.City] = i
+			series = append(series, GrafanaSeries{Target: obs.City + ":" + field, Datapoints: [][2]float64{}})
+		}
+		series[i].Datapoints = append(series[i].Datapoints, [2]float64{value(obs), float64(obs.Time.UnixMilli())})
+	}
+	return series, nil
+}
+
+// GET /api/grafana: connection test for the Grafana SimpleJSON (and JSON or
+// Infinity) datasource over the observation history. Targets are field
+// names such as "temp" (a series per city) or "Oslo:temp".
+func (agent *WeatherAgent) handleGrafana(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Decode a Grafana request body, answering with an error when it can't
+func decodeGrafanaRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(v)
+	if err != nil && err != io.EOF { // Grafana may send an empty search body
+		apiError(w, "Invalid JSON body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// POST /api/grafana/search: targets matching the request's filter
+func (agent *WeatherAgent) handleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	var req GrafanaSearchRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	targets, err := agent.grafanaTargets(req.Target)
+	if err != nil {
+		agent.logger.Printf("Error reading observations: %v", err)
+		apiError(w, "Unable to read observations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// POST /api/grafana/query: a time series or table for each target
+func (agent *WeatherAgent) handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var req GrafanaQueryRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	to := req.Range.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	results := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Hide {
+			continue
+		}
+		if _, _, ok := parseGrafanaTarget(target.Target); !ok {
+			apiError(w, "Unknown target "+target.Target, http.StatusBadRequest)
+			return
+		}
+		result, err := agent.grafanaResult(target, req.Range.From, to, req.MaxDataPoints)
+		if err != nil {
+			agent.logger.Printf("Error reading observations: %v", err)
+			apiError(w, "Unable to read observations", http.StatusInternalServerError)
+			return
+		}
+		if series, ok := result.([]GrafanaSeries); ok {
+			for _, s := range series {
+				results = append(results, s)
+			}
+		} else {
+			results = append(results, result)
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// POST /api/grafana/annotations: generated messages in the range, so charts
+// show what users were told
+func (agent *WeatherAgent) handleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	var req GrafanaAnnotationRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	annotations := []GrafanaAnnotation{}
+	if agent.deliveries != nil {
+		seen := make(map[string]bool)
+		for _, d := range agent.deliveries.list("", "", 0) {
+			if seen[d.MessageID] || d.Time.Before(req.Range.From) || (!req.Range.To.IsZero() && !d.Time.Before(req.Range.To)) {
+				continue
+			}
+			seen[d.MessageID] = true
+			annotations = append(annotations, GrafanaAnnotation{
+				Annotation: req.Annotation, Time: d.Time.UnixMilli(), Title: d.City, Text: d.Message,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGrafanaTarget(t *testing.T) {
+	tests := []struct {
+		target, city, field string
+		ok                  bool
+	}{
+		{"temp", "", "temp", true},
+		{"Oslo:humidity", "Oslo", "humidity", true},
+		{" New York : wind_speed ", "New York", "wind_speed", true},
+		{"Oslo:aqi", "Oslo", "aqi", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		city, field, ok := parseGrafanaTarget(tt.target)
+		if city != tt.city || field != tt.field || ok != tt.ok {
+			t.Errorf("%q: got %q, %q, %v", tt.target, city, field, ok)
+		}
+	}
+}
+
+func TestHandleGrafana(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	agent := &WeatherAgent{
+		logger:       log.New(io.Discard, "", 0),
+		observations: &observationStore{},
+		deliveries:   newDeliveryLog(),
+	}
+	agent.observations.record(Observation{Time: now.Add(-3 * time.Hour), City: "Oslo", Temp: 1.5, Humidity: 80})
+	agent.observations.record(Observation{Time: now.Add(-2 * time.Hour), City: "Bergen", Temp: 4})
+	agent.observations.record(Observation{Time: now.Add(-time.Hour), City: "Oslo", Temp: 2.5, Humidity: 70})
+	agent.deliveries.record(Delivery{MessageID: "m1", Channel: ChannelEmail, City: "Oslo", Message: "Drizzle later.", Time: now.Add(-90 * time.Minute)})
+	agent.deliveries.record(Delivery{MessageID: "m1", Channel: ChannelUI, City: "Oslo", Message: "Drizzle later.", Time: now.Add(-90 * time.Minute)})
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/grafana", strings.NewReader(body)))
+		return rec
+	}
+	from := now.Add(-4 * time.Hour).Format(time.RFC3339)
+	to := now.Add(-30 * time.Minute).Format(time.RFC3339)
+
+	rec := post(agent.handleGrafanaSearch, `{"target":"oslo:hum"}`)
+	if strings.TrimSpace(rec.Body.String()) != `["Oslo:humidity"]` {
+		t.Errorf("search: %d %s", rec.Code, rec.Body)
+	}
+	rec = post(agent.handleGrafanaSearch, "")
+	var targets []string
+	json.NewDecoder(rec.Body).Decode(&targets)
+	if len(targets) != 3*len(observationFields) || targets[0] != "cloud_cover" {
+		t.Errorf("search without a body: %v", targets)
+	}
+
+	rec = post(agent.handleGrafanaQuery, `{"range":{"from":"`+from+`","to":"`+to+`"},"targets":[{"target":"temp","refId":"A"},{"target":"Oslo:humidity","refId":"B","type":"table"}]}`)
+	var results []json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil || len(results) != 3 {
+		t.Fatalf("query: %d %v %s", rec.Code, err, results)
+	}
+	var oslo, bergen GrafanaSeries
+	json.Unmarshal(results[0], &oslo)
+	json.Unmarshal(results[1], &bergen)
+	if oslo.Target != "Oslo:temp" || len(oslo.Datapoints) != 2 || oslo.Datapoints[1] != [2]float64{2.5, float64(now.Add(-time.Hour).UnixMilli())} {
+		t.Errorf("Oslo series = %+v", oslo)
+	}
+	if bergen.Target != "Bergen:temp" || len(bergen.Datapoints) != 1 {
+		t.Errorf("Bergen series = %+v", bergen)
+	}
+	var table GrafanaTable
+	json.Unmarshal(results[2], &table)
+	if table.Type != "table" || len(table.Columns) != 3 || len(table.Rows) != 2 || table.Rows[0][2] != 80.0 {
+		t.Errorf("table = %+v", table)
+	}
+
+	rec = post(agent.handleGrafanaQuery, `{"range":{"from":"`+from+`"},"targets":[{"target":"Oslo:temp"}],"maxDataPoints":1}`)
+	var resampled []GrafanaSeries
+	json.NewDecoder(rec.Body).Decode(&resampled)
+	if len(resampled) != 1 || len(resampled[0].Datapoints) > 2 {
+		t.Errorf("maxDataPoints: %+v", resampled)
+	}
+
+	if rec := post(agent.handleGrafanaQuery, `{"targets":[{"target":"aqi"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown target: got %d", rec.Code)
+	}
+
+	rec = post(agent.handleGrafanaAnnotations, `{"range":{"from":"`+from+`","to":"`+to+`"},"annotation":{"name":"Messages"}}`)
+	var annotations []GrafanaAnnotation
+	json.NewDecoder(rec.Body).Decode(&annotations)
+	if len(annotations) != 1 || annotations[0].Text != "Drizzle later." || annotations[0].Annotation["name"] != "Messages" {
+		t.Errorf("annotations = %+v", annotations)
+	}
+}
+
+// Each city is resampled on its own, so a short series next to a long one
+// keeps its points even when the grid misses them
+func TestGrafanaResamplesEachCity(t *testing.T) {
+	start := time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), observations: &observationStore{}}
+	for i := 0; i <= 18; i++ {
+		agent.observations.record(Observation{Time: start.Add(time.Duration(i) * 10 * time.Minute), City: "Oslo", Temp: float64(i)})
+	}
+	agent.observations.record(Observation{Time: start.Add(67 * time.Minute), City: "Bergen", Temp: 4})
+	agent.observations.record(Observation{Time: start.Add(69 * time.Minute), City: "Bergen", Temp: 5})
+
+	body := `{"range":{"from":"2024-06-15T08:00:00Z","to":"2024-06-15T13:00:00Z"},"targets":[{"target":"temp"}],"maxDataPoints":10}`
+	rec := httptest.NewRecorder()
+	agent.handleGrafanaQuery(rec, httptest.NewRequest(http.MethodPost, "/api/v1/grafana/query", strings.NewReader(body)))
+	var series []GrafanaSeries
+	json.NewDecoder(rec.Body).Decode(&series)
+	if len(series) != 2 {
+		t.Fatalf("got %d series: %+v", len(series), series)
+	}
+	for _, s := range series {
+		switch s.Target {
+		case "Oslo:temp":
+			if len(s.Datapoints) >= 19 || len(s.Datapoints) == 0 {
+				t.Errorf("Oslo wasn't resampled: %d points", len(s.Datapoints))
+			}
+		case "Bergen:temp":
+			if len(s.Datapoints) != 2 || s.Datapoints[0][0] != 4 {
+				t.Errorf("Bergen = %+v", s.Datapoints)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Medical guardrail strictness levels (MEDICAL_GUARDRAIL)
+const (
+	GuardrailOff    = "off"    // Pass LLM output through unchanged
+	GuardrailSoften = "soften" // Hedge overconfident health claims, strip medical advice
+	GuardrailStrict = "strict" // Strip every sentence making a health claim
+)
+
+// Appended when the guardrail changed a message
+const guardrailDisclaimer = "This is general weather guidance, not medical advice; anyone with health concerns should consult a medical professional."
+
+// A kind of medical claim beyond standard AQI guidance. Claims with a soften
+// rewrite are hedged at the "soften" level; the rest are always stripped.
+type medicalRule struct {
+	name    string
+	pattern *regexp.Regexp
+	soften  func(sentence string) string
+}
+
+var (
+	certaintyPattern = regexp.MustCompile(`(?i)\b(will definitely|will certainly|will|definitely|certainly|is guaranteed to|are guaranteed to)\s+(cause|trigger|give you|lead to|make you)\b`)
+	safetyPattern    = regexp.MustCompile(`(?i)\b(completely|perfectly|totally|100%|entirely)\s+safe\b`)
+)
+
+var medicalRules = []medicalRule{
+	{
+		name:    "medication",
+		pattern: regexp.MustCompile(`(?i)\b(take|taking|use|using|dose|dosage|\d+\s?mg)\b[^.!?]*\b(ibuprofen|paracetamol|acetaminophen|aspirin|antihistamines?|inhalers?|medications?|medicines?|steroids?|supplements?)\b`),
+	},
+	{
+		name:    "diagnosis",
+		pattern: regexp.MustCompile(`(?i)\b(you|your \w+)\s+(probably |likely |may |might |could )?(have|has|are suffering from|is suffering from|suffer from|are developing|is developing)\s+(asthma|copd|bronchitis|pneumonia|heat ?stroke|heat exhaustion|hypothermia|frostbite|an? infection|an? allerg(y|ic reaction)|allergies)\b`),
+	},
+	{
+		name:    "cure",
+		pattern: regexp.MustCompile(`(?i)\b(cures?|heals?|treats?|prevents?|boosts? your immune system)\b[^.!?]*\b(asthma|allergies|cancer|covid|colds?|flu|depression|disease|illness|infections?|arthritis|immunity)\b`),
+	},
+	{
+		name:    "certainty",
+		pattern: certaintyPattern,
+		soften: func(sentence string) string {
+			return certaintyPattern.ReplaceAllString(sentence, "may $2")
+		},
+	},
+	{
+		name:    "safety assurance",
+		pattern: safetyPattern,
+		soften: func(sentence string) string {
+			return safetyPattern.ReplaceAllString(sentence, "generally safe")
+		},
+	},
+}
+
+// A medical claim the guardrail acted on
+type guardrailViolation struct {
+	Rule     string
+	Action   string // "softened" or "stripped"
+	Sentence string
+}
+
+// Parse a MEDICAL_GUARDRAIL value, treating unknown values as off
+func parseGuardrailLevel(value string) string {
+	switch level := strings.ToLower(strings.TrimSpace(value)); level {
+	case GuardrailSoften, GuardrailStrict:
+		return level
+	default:
+		return GuardrailOff
+	}
+}
+
+// Split text into sentences, keeping each sentence's trailing whitespace so
+// the text can be reassembled. Decimal points ("21.5") don't end a sentence.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if !strings.ContainsRune(".!?", rune(text[i])) {
+			continue
+		}
+		end := i + 1
+		if end < len(text) && !strings.ContainsRune(" \t\n", rune(text[end])) {
+			continue
+		}
+		for end < len(text) && strings.ContainsRune(" \t\n", rune(text[end])) {
+			end++
+		}
+		sentences = append(sentences, text[start:end])
+		start = end
+		i = end - 1
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// Soften or strip medical claims in an LLM message according to the level,
+// returning the cleaned message and the claims that were acted on
+func applyMedicalGuardrail(level, message string) (string, []guardrailViolation) {
+	if level != GuardrailSoften && level != GuardrailStrict {
+		return message, nil
+	}
+
+	var violations []guardrailViolation
+	var out strings.Builder
+	for _, sentence := range splitSentences(message) {
+		kept := sentence
+		for _, rule := range medicalRules {
+			if !rule.pattern.MatchString(kept) {
+				continue
+			}
+			if level == GuardrailSoften && rule.soften != nil {
+				violations = append(violations, guardrailViolation{Rule: rule.name, Action: "softened", Sentence: strings.TrimSpace(kept)})
+				kept = rule.soften(kept)
+				continue
+			}
+			violations = append(violations, guardrailViolation{Rule: rule.name, Action: "stripped", Sentence: strings.TrimSpace(kept)})
+			kept = ""
+			break
+		}
+		out.WriteString(kept)
+	}
+
+	if len(violations) == 0 {
+		return message, nil
+	}
+	result := strings.TrimSpace(out.String())
+	if result != "" {
+		result += "\n\n"
+	}
+	return result + guardrailDisclaimer, violations
+}
+
+// Run the configured medical guardrail over LLM output, logging every violation
+func (agent *WeatherAgent) guardLLMOutput(message string) string {
+	cleaned, violations := applyMedicalGuardrail(agent.config.MedicalGuardrail, message)
+	for _, v := range violations {
+		agent.logger.Printf("Medical guardrail (%s): %s %s claim: %q", agent.config.MedicalGuardrail, v.Action, v.Rule, v.Sentence)
+	}
+	return cleaned
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	text := "It's 21.5°C and sunny. Enjoy!\nAQI is 42?"
+	got := splitSentences(text)
+	want := []string{"It's 21.5°C and sunny. ", "Enjoy!\n", "AQI is 42?"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitSentences = %q, want %q", got, want)
+	}
+}
+
+func TestApplyMedicalGuardrail(t *testing.T) {
+	const aqiAdvice = "Sensitive groups should limit prolonged outdoor exertion."
+
+	tests := []struct {
+		name       string
+		level      string
+		message    string
+		want       string
+		violations int
+	}{
+		{
+			name:    "off passes everything",
+			level:   GuardrailOff,
+			message: "Take an antihistamine before heading out.",
+			want:    "Take an antihistamine before heading out.",
+		},
+		{
+			name:    "standard AQI guidance is untouched",
+			level:   GuardrailStrict,
+			message: "AQI is 120. " + aqiAdvice,
+			want:    "AQI is 120. " + aqiAdvice,
+		},
+		{
+			name:       "medication is stripped when softening",
+			level:      GuardrailSoften,
+			message:    "Pollen is high. Take an antihistamine before heading out. " + aqiAdvice,
+			want:       "Pollen is high. " + aqiAdvice + "\n\n" + guardrailDisclaimer,
+			violations: 1,
+		},
+		{
+			name:       "certainty is softened",
+			level:      GuardrailSoften,
+			message:    "The smoke will trigger coughing.",
+			want:       "The smoke may trigger coughing.\n\n" + guardrailDisclaimer,
+			violations: 1,
+		},
+		{
+			name:       "certainty is stripped when strict",
+			level:      GuardrailStrict,
+			message:    "Hazy skies. The smoke will trigger coughing.",
+			want:       "Hazy skies.\n\n" + guardrailDisclaimer,
+			violations: 1,
+		},
+		{
+			name:       "diagnosis",
+			level:      GuardrailSoften,
+			message:    "If you're wheezing, you probably have asthma.",
+			want:       guardrailDisclaimer,
+			violations: 1,
+		},
+		{
+			name:       "cure claim",
+			level:      GuardrailSoften,
+			message:    "Sunshine today! Fresh air cures colds.",
+			want:       "Sunshine today!\n\n" + guardrailDisclaimer,
+			violations: 1,
+		},
+		{
+			name:       "safety assurance",
+			level:      GuardrailSoften,
+			message:    "It's completely safe to exercise outside.",
+			want:       "It's generally safe to exercise outside.\n\n" + guardrailDisclaimer,
+			violations: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, violations := applyMedicalGuardrail(tt.level, tt.message)
+			if got != tt.want {
+				t.Errorf("message = %q, want %q", got, tt.want)
+			}
+			if len(violations) != tt.violations {
+				t.Errorf("violations = %v, want %d", violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestParseGuardrailLevel(t *testing.T) {
+	tests := map[string]string{
+		"":        GuardrailOff,
+		"Strict":  GuardrailStrict,
+		" soften": GuardrailSoften,
+		"max":     GuardrailOff,
+	}
+	for value, want := range tests {
+		if got := parseGuardrailLevel(value); got != want {
+			t.Errorf("parseGuardrailLevel(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
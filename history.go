@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Maximum lookback accepted by /api/history, long enough to chart a year of
+// hourly averages
+const maxHistoryHours = 24 * 366
+
+// A stored weather observation for charting
+type Observation struct {
+	Time        time.Time `json:"time"`
+	City        string    `json:"city"`
+	Country     string    `json:"country"`
+	Temp        float64   `json:"temp"`
+	FeelsLike   float64   `json:"feels_like"`
+	Humidity    int       `json:"humidity"`
+	Pressure    int       `json:"pressure"`
+	WindSpeed   float64   `json:"wind_speed"`
+	CloudCover  int       `json:"cloud_cover"`
+	UVIndex     float64   `json:"uv_index"`
+	Precip      float64   `json:"precipitation"`
+	Description string    `json:"description"`
+
+	Interpolated bool `json:"interpolated,omitempty"` // Resampled point rather than a reading
+	Samples      int  `json:"samples,omitempty"`      // Readings averaged into this hourly point (0 for a single reading)
+}
+
+// Build an observation from a weather response
+func newObservation(weather WeatherResponse) Observation {
+	obs := Observation{
+		Time:       time.Unix(weather.Dt, 0).UTC(),
+		City:       weather.Name,
+		Country:    weather.Sys.Country,
+		Temp:       weather.Main.Temp,
+		FeelsLike:  weather.Main.FeelsLike,
+		Humidity:   weather.Main.Humidity,
+		Pressure:   weather.Main.Pressure,
+		WindSpeed:  weather.Wind.Speed,
+		CloudCover: weather.Clouds.All,
+		UVIndex:    weather.UVIndex,
+		Precip:     weather.Rain.OneHour + weather.Snow.OneHour,
+	}
+	if weather.Dt == 0 {
+		obs.Time = time.Now().UTC()
+	}
+	if len(weather.Weather) > 0 {
+		obs.Description = weather.Weather[0].Description
+	}
+	return obs
+}
+
+// Observation store covering the retention window, optionally persisted to
+// a JSON-lines file so history survives restarts, or kept in a database
+// shared with other replicas. With an aggregate retention, readings older
+// than the retention window are averaged into hourly points by compact
+// instead of being dropped.
+type observationStore struct {
+	mu                 sync.Mutex
+	retention          time.Duration
+	aggregateRetention time.Duration // How long hourly points are kept (0 drops readings at the end of retention)
+	records            []Observation
+	path               string
+	file               *os.File
+	db                 storage   // Used instead of records and file when set
+	lastPrune          time.Time // When expired rows were last deleted from db
+}
+
+// Create a store keeping observations in a database
+func newDatabaseObservationStore(db storage, retention, aggregateRetention time.Duration) *observationStore {
+	return &observationStore{retention: retention, aggregateRetention: aggregateRetention, db: db}
+}
+
+// Create a store, loading previously saved observations from path if given
+func newObservationStore(path string, retention, aggregateRetention time.Duration) (*observationStore, error) {
+	s := &observationStore{retention: retention, aggregateRetention: aggregateRetention, path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			var obs Observation
+			if err := json.Unmarshal(scanner.Bytes(), &obs); err == nil {
+				s.records = append(s.records, obs)
+			}
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading history file: %v", err)
+		}
+		s.prune(time.Now())
+	}
+
+	// Rewrite the file with only the retained records so it doesn't grow forever
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replace the history file with the current records and reopen it for
+// appending. Callers must hold s.mu (or own s).
+func (s *observationStore) rewrite() error {
+	tmp := s.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	for _, obs := range s.records {
+		if err := writeObservation(file, obs); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error saving history file: %v", err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	return nil
+}
+
+func writeObservation(w io.Writer, obs Observation) error {
+	data, err := json.Marshal(obs)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Drop observations older than the retention window, unless compact
+// downsamples them instead. Callers must hold s.mu.
+func (s *observationStore) prune(now time.Time) {
+	if s.retention <= 0 || s.aggregateRetention > 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention)
+	i := 0
+	for i < len(s.records) && s.records[i].Time.Before(cutoff) {
+		i++
+	}
+	s.records = s.records[i:]
+}
+
+// Add an observation. Repeated readings with the same timestamp and city
+// (e.g. several page loads between upstream updates) are stored once.
+func (s *observationStore) record(obs Observation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db != nil {
+		if err := s.db.appendObservation(obs); err != nil {
+			return err
+		}
+		// Deleting expired rows on every write would be wasted work
+		now := time.Now()
+		if s.retention > 0 && s.aggregateRetention <= 0 && now.Sub(s.lastPrune) >= time.Hour {
+			s.lastPrune = now
+			return s.db.pruneObservations(now.Add(-s.retention))
+		}
+		return nil
+	}
+
+	if n := len(s.records); n > 0 {
+		last := s.records[n-1]
+		if last.City == obs.City && last.Time.Equal(obs.Time) {
+			return nil
+		}
+	}
+
+	s.records = append(s.records, obs)
+	s.prune(time.Now())
+
+	if s.file != nil {
+		return writeObservation(s.file, obs)
+	}
+	return nil
+}
+
+// Observations since the given time, oldest first, optionally filtered by city
+func (s *observationStore) since(t time.Time, city string) ([]Observation, error) {
+	if s.db != nil {
+		return s.db.observationsSince(t, city)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Observation, 0)
+	for _, obs := range s.records {
+		if obs.Time.Before(t) {
+			continue
+		}
+		if city != "" && obs.City != city {
+			continue
+		}
+		result = append(result, obs)
+	}
+	return result, nil
+}
+
+// Average readings older than the retention window into hourly points and
+// drop points older than the aggregate retention. Only whole hours are
+// averaged, so each hour is compacted once.
+func (s *observationStore) compact(now time.Time) error {
+	if s.retention <= 0 || s.aggregateRetention <= 0 {
+		return nil
+	}
+	rawCutoff := now.Add(-s.retention).Truncate(time.Hour)
+	aggregateCutoff := now.Add(-s.aggregateRetention)
+	if s.db != nil {
+		return s.db.compactObservations(rawCutoff, aggregateCutoff)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var readings, kept []Observation
+	for _, obs := range s.records {
+		switch {
+		case obs.Time.Before(aggregateCutoff):
+		case obs.Samples == 0 && obs.Time.Before(rawCutoff):
+			readings = append(readings, obs)
+		default:
+			kept = append(kept, obs)
+		}
+	}
+	if len(kept) == len(s.records) {
+		return nil
+	}
+
+	s.records = append(downsampleHourly(readings), kept...)
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.records[i].Time.Before(s.records[j].Time)
+	})
+	if s.file != nil {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// Average observations into one point per city and hour, stamped with the
+// start of the hour. The description is the most common one in the hour.
+func downsampleHourly(observations []Observation) []Observation {
+	var keys []string
+	groups := make(map[string][]Observation)
+	for _, obs := range observations {
+		key := obs.City + "\x00" + obs.Time.Truncate(time.Hour).Format(time.RFC3339)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], obs)
+	}
+
+	result := make([]Observation, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		n := float64(len(group))
+		agg := Observation{
+			Time:    group[0].Time.Truncate(time.Hour).UTC(),
+			City:    group[0].City,
+			Country: group[0].Country,
+			Samples: len(group),
+		}
+		var humidity, pressure, cloudCover float64
+		counts := make(map[string]int)
+		for _, obs := range group {
+			agg.Temp += obs.Temp / n
+			agg.FeelsLike += obs.FeelsLike / n
+			agg.WindSpeed += obs.WindSpeed / n
+			agg.UVIndex += obs.UVIndex / n
+			agg.Precip += obs.Precip / n
+			humidity += float64(obs.Humidity) / n
+			pressure += float64(obs.Pressure) / n
+			cloudCover += float64(obs.CloudCover) / n
+			counts[obs.Description]++
+			// Later readings win ties
+			if counts[obs.Description] >= counts[agg.Description] {
+				agg.Description = obs.Description
+			}
+		}
+		agg.Humidity = int(math.Round(humidity))
+		agg.Pressure = int(math.Round(pressure))
+		agg.CloudCover = int(math.Round(cloudCover))
+		result = append(result, agg)
+	}
+	return result
+}
+
+// How long hourly points are kept
+func (c Config) historyAggregateRetention() time.Duration {
+	return time.Duration(c.HistoryAggregateDays) * 24 * time.Hour
+}
+
+// Compact history hourly, starting now
+func (agent *WeatherAgent) runHistoryCompaction() {
+	for {
+		if err := agent.observations.compact(time.Now()); err != nil {
+			agent.logger.Printf("Error compacting history: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// Write observations as CSV with a header row
+func writeObservationsCSV(w io.Writer, observations []Observation) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "city", "country", "temp", "feels_like", "humidity", "pressure", "wind_speed", "cloud_cover", "uv_index", "precipitation", "description"})
+	for _, obs := range observations {
+		cw.Write([]string{
+			obs.Time.Format(time.RFC3339),
+			obs.City,
+			obs.Country,
+			strconv.FormatFloat(obs.Temp, 'f', 1, 64),
+			strconv.FormatFloat(obs.FeelsLike, 'f', 1, 64),
+			strconv.Itoa(obs.Humidity),
+			strconv.Itoa(obs.Pressure),
+			strconv.FormatFloat(obs.WindSpeed, 'f', 1, 64),
+			strconv.Itoa(obs.CloudCover),
+			strconv.FormatFloat(obs.UVIndex, 'f', 1, 64),
+			strconv.FormatFloat(obs.Precip, 'f', 1, 64),
+			obs.Description,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Add a fetched reading to the LLM context window and the observation store
+func (agent *WeatherAgent) recordWeather(weather WeatherResponse) {
+	agent.weatherHistory.add(weather)
+
+	if err := agent.observations.record(newObservation(weather)); err != nil {
+		agent.logger.Printf("Error saving observation: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObservationStorePersistsAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	store, err := newObservationStore(path, 48*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.record(Observation{Time: now.Add(-72 * time.Hour), City: "Oslo", Temp: 1})
+	store.record(Observation{Time: now.Add(-2 * time.Hour), City: "Oslo", Temp: 2})
+	store.record(Observation{Time: now.Add(-2 * time.Hour), City: "Oslo", Temp: 2}) // duplicate reading
+	store.record(Observation{Time: now.Add(-time.Hour), City: "Bergen", Temp: 3})
+	store.file.Close()
+
+	reloaded, err := newObservationStore(path, 48*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.file.Close()
+
+	all, _ := reloaded.since(now.Add(-100*time.Hour), "")
+	if len(all) != 2 {
+		t.Fatalf("expected 2 retained observations after reload, got %d: %+v", len(all), all)
+	}
+	if oslo, _ := reloaded.since(now.Add(-24*time.Hour), "Oslo"); len(oslo) != 1 || oslo[0].Temp != 2 {
+		t.Errorf("city filter: got %+v", oslo)
+	}
+	if recent, _ := reloaded.since(now.Add(-90*time.Minute), ""); len(recent) != 1 || recent[0].City != "Bergen" {
+		t.Errorf("time filter: got %+v", recent)
+	}
+}
+
+func TestObservationStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+	hour := time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)
+
+	store, err := newObservationStore(path, 48*time.Hour, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obs := range []Observation{
+		{Time: now.AddDate(0, 0, -40), City: "Oslo", Samples: 3}, // Expired hourly point
+		{Time: hour.Add(10 * time.Minute), City: "Oslo", Temp: 10, Humidity: 70, Description: "rain"},
+		{Time: hour.Add(20 * time.Minute), City: "Bergen", Temp: 5, Description: "fog"},
+		{Time: hour.Add(40 * time.Minute), City: "Oslo", Temp: 12, Humidity: 75, Description: "cloudy"},
+		{Time: hour.Add(50 * time.Minute), City: "Oslo", Temp: 14, Humidity: 81, Description: "rain"},
+		{Time: now.Add(-time.Hour), City: "Oslo", Temp: 20},
+	} {
+		store.record(obs)
+	}
+	if err := store.compact(now); err != nil {
+		t.Fatal(err)
+	}
+	store.file.Close()
+
+	reloaded, err := newObservationStore(path, 48*time.Hour, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.file.Close()
+	all, _ := reloaded.since(time.Time{}, "")
+	want := []Observation{
+		{Time: hour, City: "Oslo", Temp: 12, Humidity: 75, Description: "rain", Samples: 3},
+		{Time: hour, City: "Bergen", Temp: 5, Description: "fog", Samples: 1},
+		{Time: now.Add(-time.Hour), City: "Oslo", Temp: 20},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("got %+v", all)
+	}
+	for i := range want {
+		if !all[i].Time.Equal(want[i].Time) || all[i].City != want[i].City || all[i].Temp != want[i].Temp ||
+			all[i].Humidity != want[i].Humidity || all[i].Description != want[i].Description || all[i].Samples != want[i].Samples {
+			t.Errorf("observation %d = %+v, want %+v", i, all[i], want[i])
+		}
+	}
+
+	// Hourly points aren't averaged again
+	if err := reloaded.compact(now.Add(24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := reloaded.since(time.Time{}, ""); len(again) != 3 || again[0].Samples != 3 {
+		t.Errorf("second compaction: got %+v", again)
+	}
+}
+
+func TestWriteObservationsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	obs := []Observation{{
+		Time:        time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		City:        "Paris",
+		Country:     "FR",
+		Temp:        21.46,
+		Humidity:    55,
+		Description: "few clouds, light breeze",
+	}}
+	if err := writeObservationsCSV(&buf, obs); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got %q", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "time,city,country,temp") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	want := `2024-06-01T12:00:00Z,Paris,FR,21.5,0.0,55,0,0.0,0,0.0,0.0,"few clouds, light breeze"`
+	if lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[1], want)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Topic the Home Assistant state is published to over MQTT
+const haStateTopic = "weather-agent/state"
+
+// Sensors announced through MQTT discovery, each reading one field of the
+// published state
+var haSensors = []struct {
+	Key         string
+	Name        string
+	DeviceClass string
+	Unit        func(agent *WeatherAgent) string
+}{
+	{"temperature", "Temperature", "temperature", (*WeatherAgent).getTempUnit},
+	{"feels_like", "Feels like", "temperature", (*WeatherAgent).getTempUnit},
+	{"humidity", "Humidity", "humidity", fixedUnit("%")},
+	{"pressure", "Pressure", "atmospheric_pressure", fixedUnit("hPa")},
+	{"wind_speed", "Wind speed", "wind_speed", (*WeatherAgent).getWindUnit},
+	{"wind_gust", "Wind gust", "wind_speed", (*WeatherAgent).getWindUnit},
+	{"wind_bearing", "Wind bearing", "", fixedUnit("°")},
+	{"cloud_cover", "Cloud cover", "", fixedUnit("%")},
+	{"uv_index", "UV index", "", nil},
+	{"precipitation", "Precipitation", "precipitation", fixedUnit("mm")},
+	{"aqi", "Air quality index", "aqi", nil},
+	{"pm2_5", "PM2.5", "pm25", fixedUnit("µg/m³")},
+	{"condition", "Condition", "", nil},
+}
+
+func fixedUnit(unit string) func(*WeatherAgent) string {
+	return func(*WeatherAgent) string { return unit }
+}
+
+// Home Assistant's MQTT discovery payload for a sensor
+type haDiscoveryConfig struct {
+	Name               string   `json:"name"`
+	UniqueID           string   `json:"unique_id"`
+	StateTopic         string   `json:"state_topic"`
+	ValueTemplate      string   `json:"value_template"`
+	Unit               string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass        string   `json:"device_class,omitempty"`
+	StateClass         string   `json:"state_class,omitempty"`
+	AttributesTopic    string   `json:"json_attributes_topic,omitempty"`
+	AttributesTemplate string   `json:"json_attributes_template,omitempty"`
+	Device             haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// Home Assistant's weather condition for a WMO weather code, e.g. "partlycloudy"
+func haCondition(weather WeatherResponse, system units.System) string {
+	code := -1
+	if len(weather.Weather) > 0 {
+		code = weather.Weather[0].ID
+	}
+	windy := units.SpeedIn(weather.Wind.Speed, system).KilometersPerHour() >= 40
+	switch {
+	case code >= 0 && code <= 2 && windy:
+		return "windy"
+	case code == 3 && windy:
+		return "windy-variant"
+	case code == 0 && weather.IsDay == 0:
+		return "clear-night"
+	case code == 0:
+		return "sunny"
+	case code == 1 || code == 2:
+		return "partlycloudy"
+	case code == 3:
+		return "cloudy"
+	case code == 45 || code == 48:
+		return "fog"
+	case code == 65 || code == 82:
+		return "pouring"
+	case code == 66 || code == 67:
+		return "snowy-rainy"
+	case code >= 71 && code <= 77, code == 85, code == 86:
+		return "snowy"
+	case code >= 51 && code <= 82:
+		return "rainy"
+	case code == 95:
+		return "lightning-rainy"
+	case code == 96 || code == 99:
+		return "hail"
+	}
+	return "exceptional"
+}
+
+// Flat current conditions for Home Assistant
+func (agent *WeatherAgent) haState(weather WeatherResponse) HAStateResponse {
+	state := HAStateResponse{
+		City:            weather.Name,
+		Condition:       haCondition(weather, agent.units()),
+		Temperature:     round1(weather.Main.Temp),
+		FeelsLike:       round1(weather.Main.FeelsLike),
+		Humidity:        weather.Main.Humidity,
+		Pressure:        weather.Main.Pressure,
+		WindSpeed:       round1(weather.Wind.Speed),
+		WindGust:        round1(weather.Wind.Gust),
+		WindBearing:     weather.Wind.Deg,
+		CloudCover:      weather.Clouds.All,
+		UVIndex:         round1(weather.UVIndex),
+		Precipitation:   round1(weather.Rain.OneHour + weather.Snow.OneHour),
+		Message:         agent.lastMessage(weatherLocationKey(weather)).Message,
+		TemperatureUnit: agent.getTempUnit(),
+		WindSpeedUnit:   agent.getWindUnit(),
+		Updated:         time.Unix(weather.Dt, 0).UTC(),
+	}
+	if len(weather.Weather) > 0 {
+		state.Description = weather.Weather[0].Description
+	}
+	if weather.IQAirData.AQI > 0 {
+		state.AQI = &weather.IQAirData.AQI
+	} else if len(weather.AQI.List) > 0 {
+		state.AQI = &weather.AQI.List[0].Main.AQI
+	}
+	if pm, ok := outdoorPM25(weather); ok {
+		pm = round1(pm)
+		state.PM25 = &pm
+	}
+	state.Severity, _ = agent.weatherSeverity(weather)
+	state.SeverityColor = severityColor(state.Severity)
+	return state
+}
+
+// Retained discovery messages announcing the sensors under prefix
+func (agent *WeatherAgent) haDiscovery(prefix string) []mqttMessage {
+	device := haDevice{Identifiers: []string{"weather_agent"}, Name: "Weather Agent", Manufacturer: "weather-agent"}
+	messages := make([]mqttMessage, 0, len(haSensors))
+	for _, sensor := range haSensors {
+		config := haDiscoveryConfig{
+			Name:          sensor.Name,
+			UniqueID:      "weather_agent_" + sensor.Key,
+			StateTopic:    haStateTopic,
+			ValueTemplate: "{{ value_json." + sensor.Key + " }}",
+			DeviceClass:   sensor.DeviceClass,
+			Device:        device,
+		}
+		if sensor.Unit != nil {
+			config.Unit = sensor.Unit(agent)
+			config.StateClass = "measurement"
+		}
+		if sensor.Key == "condition" {
+			// States are capped at 255 characters, so the message goes in an attribute
+			config.AttributesTopic = haStateTopic
+			config.AttributesTemplate = `{{ {"description": value_json.description, "message": value_json.message, "city": value_json.city} | tojson }}`
+		}
+		payload, _ := json.Marshal(config)
+		messages = append(messages, mqttMessage{topic: prefix + "/sensor/weather_agent/" + sensor.Key + "/config", payload: payload, retain: true})
+	}
+	return messages
+}
+
+// Publish the state for Home Assistant every check interval, announcing the
+// sensors first
+func (agent *WeatherAgent) runHomeAssistantPublisher(client *mqttClient) {
+	interval := time.Duration(agent.config.CheckInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	announced := false
+	for {
+		weather, err := agent.fetchWeather()
+		if err != nil {
+			agent.logger.Printf("MQTT publisher: error fetching weather: %v", err)
+		} else {
+			payload, _ := json.Marshal(agent.haState(weather))
+			var messages []mqttMessage
+			if !announced {
+				messages = agent.haDiscovery(agent.config.MQTTDiscoveryPrefix)
+			}
+			messages = append(messages, mqttMessage{topic: haStateTopic, payload: payload, retain: true})
+			if err := client.publish(messages...); err != nil {
+				agent.logger.Printf("MQTT publisher: %v", err)
+			} else {
+				announced = true
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// GET /api/ha/state: current conditions as a flat object, for a Home
+// Assistant REST sensor with json_attributes
+func (agent *WeatherAgent) handleHAState(w http.ResponseWriter, r *http.Request) {
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		agent.logger.Printf("Error fetching weather for Home Assistant: %v", err)
+		apiError(w, "Unable to fetch weather data", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, agent.haState(weather))
+}
+
+// GET /api/ha/temperature: the bare temperature, which a Home Assistant
+// REST sensor reads without a value_template
+func (agent *WeatherAgent) handleHATemperature(w http.ResponseWriter, r *http.Request) {
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		agent.logger.Printf("Error fetching weather for Home Assistant: %v", err)
+		apiError(w, "Unable to fetch weather data", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, round1(weather.Main.Temp))
+}
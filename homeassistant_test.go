@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+func TestHACondition(t *testing.T) {
+	tests := []struct {
+		code  int
+		isDay int
+		wind  float64 // km/h
+		want  string
+	}{
+		{0, 1, 5, "sunny"},
+		{0, 0, 5, "clear-night"},
+		{2, 1, 5, "partlycloudy"},
+		{2, 1, 45, "windy"},
+		{3, 1, 45, "windy-variant"},
+		{48, 1, 5, "fog"},
+		{53, 1, 5, "rainy"},
+		{65, 1, 5, "pouring"},
+		{67, 1, 5, "snowy-rainy"},
+		{73, 1, 5, "snowy"},
+		{86, 1, 5, "snowy"},
+		{81, 1, 5, "rainy"},
+		{95, 1, 5, "lightning-rainy"},
+		{99, 1, 5, "hail"},
+		{-1, 1, 5, "exceptional"},
+	}
+	for _, tt := range tests {
+		weather := WeatherResponse{IsDay: tt.isDay}
+		if tt.code >= 0 {
+			weather.Weather = append(weather.Weather, struct {
+				ID          int    `json:"id"`
+				Main        string `json:"main"`
+				Description string `json:"description"`
+				Icon        string `json:"icon"`
+			}{ID: tt.code})
+		}
+		weather.Wind.Speed = tt.wind
+		if got := haCondition(weather, units.Metric); got != tt.want {
+			t.Errorf("code %d, day %d, wind %g: got %q, want %q", tt.code, tt.isDay, tt.wind, got, tt.want)
+		}
+	}
+}
+
+func TestHandleHAState(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key"})
+
+	rec := httptest.NewRecorder()
+	agent.handleHATemperature(rec, httptest.NewRequest(http.MethodGet, "/api/ha/temperature", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "18.4" {
+		t.Errorf("temperature: %d %q", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	agent.handleHAState(rec, httptest.NewRequest(http.MethodGet, "/api/ha/state", nil))
+	var state HAStateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.City != "Oslo" || state.Condition != "partlycloudy" || state.Humidity != 62 || state.WindBearing != 225 ||
+		state.AQI == nil || *state.AQI != 42 || state.PM25 == nil || *state.PM25 != 10.1 || state.TemperatureUnit != "°C" {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestHADiscovery(t *testing.T) {
+	agent := newFixtureAgent(t, Config{Units: "imperial"})
+	messages := agent.haDiscovery("homeassistant")
+	if len(messages) != len(haSensors) {
+		t.Fatalf("got %d discovery messages", len(messages))
+	}
+	for _, msg := range messages {
+		var config haDiscoveryConfig
+		if err := json.Unmarshal(msg.payload, &config); err != nil {
+			t.Fatal(err)
+		}
+		if !msg.retain || config.StateTopic != haStateTopic || config.Device.Identifiers[0] != "weather_agent" {
+			t.Errorf("%s: %+v", msg.topic, config)
+		}
+		switch msg.topic {
+		case "homeassistant/sensor/weather_agent/temperature/config":
+			if config.Unit != "°F" || config.DeviceClass != "temperature" || config.ValueTemplate != "{{ value_json.temperature }}" {
+				t.Errorf("temperature sensor: %+v", config)
+			}
+		case "homeassistant/sensor/weather_agent/condition/config":
+			if config.Unit != "" || config.StateClass != "" || !strings.Contains(config.AttributesTemplate, "value_json.message") {
+				t.Errorf("condition sensor: %+v", config)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// HTTP client settings
+const (
+	httpDialTimeout      = 10 * time.Second
+	httpKeepAlive        = 30 * time.Second
+	httpIdleConnTimeout  = 90 * time.Second
+	httpTLSTimeout       = 10 * time.Second
+	notifierHTTPTimeout  = 10 * time.Second // Telegram, webhook and Slack deliveries
+	geocodingHTTPTimeout = 5 * time.Second
+	llmHTTPTimeout       = 60 * time.Second // Generation can be slow
+)
+
+// Build the client every upstream call goes through, so connections are
+// pooled and kept alive across providers. Proxies are taken from
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+func newHTTPClient(config Config) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   httpDialTimeout,
+			KeepAlive: httpKeepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          config.HTTPMaxIdleConns,
+		MaxIdleConnsPerHost:   config.HTTPMaxIdleConnsPerHost,
+		IdleConnTimeout:       httpIdleConnTimeout,
+		TLSHandshakeTimeout:   httpTLSTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(config.HTTPTimeoutSeconds) * time.Second,
+	}
+}
+
+// Shared address space for carrier-grade NAT, not reachable from the internet
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Whether an address is on the public internet, rather than loopback, a
+// private or link-local network (including cloud metadata services) or
+// otherwise internal
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0))
+}
+
+// Dialer hook refusing connections to non-public addresses. It sees the
+// address after DNS resolution, so a name that resolves (or later
+// rebinds) to an internal host is refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("connecting to non-public address %s is not allowed", host)
+	}
+	return nil
+}
+
+// Build the client for URLs users supply, such as subscription webhooks,
+// which only connects to public addresses. Proxies aren't used, as the
+// check must apply to the target rather than the proxy.
+func newPublicHTTPClient(config Config) *http.Client {
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   httpDialTimeout,
+			KeepAlive: httpKeepAlive,
+			Control:   dialPublicOnly,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          config.HTTPMaxIdleConns,
+		MaxIdleConnsPerHost:   config.HTTPMaxIdleConnsPerHost,
+		IdleConnTimeout:       httpIdleConnTimeout,
+		TLSHandshakeTimeout:   httpTLSTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(config.HTTPTimeoutSeconds) * time.Second,
+	}
+}
+
+// The shared client, with a different overall timeout when timeout is
+// non-zero. Copies share the transport and so its connection pool. Agents
+// built without NewWeatherAgent (tests) use http.DefaultClient.
+func (agent *WeatherAgent) httpClient(timeout time.Duration) *http.Client {
+	base := agent.http
+	if base == nil {
+		base = http.DefaultClient
+	}
+	if timeout == 0 {
+		return base
+	}
+	client := *base
+	client.Timeout = timeout
+	return &client
+}
+
+// The client for user-supplied URLs (see newPublicHTTPClient), with the
+// given overall timeout. Agents built without NewWeatherAgent (tests) fall
+// back to httpClient, so they can deliver to local test servers.
+func (agent *WeatherAgent) publicHTTPClient(timeout time.Duration) *http.Client {
+	if agent.publicHTTP == nil {
+		return agent.httpClient(timeout)
+	}
+	client := *agent.publicHTTP
+	client.Timeout = timeout
+	return &client
+}
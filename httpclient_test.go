@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	client := newHTTPClient(Config{HTTPTimeoutSeconds: 20, HTTPMaxIdleConns: 50, HTTPMaxIdleConnsPerHost: 5})
+	if client.Timeout != 20*time.Second {
+		t.Errorf("timeout = %v, want 20s", client.Timeout)
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport is %T, want *http.Transport", client.Transport)
+	}
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 5 || transport.DisableKeepAlives {
+		t.Errorf("pooling = %d idle, %d per host, keep-alives disabled %v", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.DisableKeepAlives)
+	}
+	if transport.Proxy == nil {
+		t.Error("proxy settings from the environment are ignored")
+	}
+}
+
+func TestAgentHTTPClient(t *testing.T) {
+	shared := newHTTPClient(Config{HTTPTimeoutSeconds: 30})
+	agent := &WeatherAgent{http: shared}
+
+	if agent.httpClient(0) != shared {
+		t.Error("httpClient(0) should return the shared client")
+	}
+	short := agent.httpClient(5 * time.Second)
+	if short.Timeout != 5*time.Second || short.Transport != shared.Transport {
+		t.Errorf("httpClient(5s) = timeout %v, shares transport %v", short.Timeout, short.Transport == shared.Transport)
+	}
+	if shared.Timeout != 30*time.Second {
+		t.Errorf("shared client timeout changed to %v", shared.Timeout)
+	}
+
+	// Subscription deliveries go through the shared transport too
+	agent.config.TelegramBotToken = "123:abc"
+	notifier, err := agent.subscriptionNotifier(Subscription{Channel: ChannelTelegram, Target: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client := notifier.(*telegramNotifier).client; client.Transport != shared.Transport || client.Timeout != notifierHTTPTimeout {
+		t.Errorf("telegram client = timeout %v, shares transport %v", client.Timeout, client.Transport == shared.Transport)
+	}
+
+	if (&WeatherAgent{}).httpClient(0) != http.DefaultClient {
+		t.Error("agents without a shared client should fall back to http.DefaultClient")
+	}
+}
+
+func TestDialPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.5:80", false},
+		{"192.168.1.1:80", false},
+		{"172.16.0.1:80", false},
+		{"169.254.169.254:80", false}, // Cloud metadata
+		{"[fe80::1]:80", false},
+		{"[fd00:ec2::254]:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		if err := dialPublicOnly("tcp", tt.address, nil); (err == nil) != tt.allowed {
+			t.Errorf("%s: got %v, want allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+
+	// The check runs on the resolved address, whatever the URL's host name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	agent := &WeatherAgent{publicHTTP: newPublicHTTPClient(Config{})}
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if _, err := agent.publicHTTPClient(time.Second).Get(url); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("request to %s: got %v, want it refused", url, err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale used when none is configured or a string is missing from a catalog
+const defaultLocale = "en"
+
+// Keys of the strings in the catalog
+const (
+	msgDaytime   = "daytime"
+	msgNighttime = "nighttime"
+
+	msgAQIUnknown = "aqi.unknown"
+
+	msgLanguageName = "language.name"
+	msgHours        = "unit.hours"
+	msgExcellent    = "visibility.excellent"
+	msgUnknown      = "unknown"
+	msgDateLayout   = "layout.date"     // Placeholders {day}, {month}, {year}
+	msgDateTime     = "layout.datetime" // Placeholders {weekday}, {date}, {time}
+	msgTimeLayout   = "layout.time"     // Go time layout
+)
+
+// The 16 compass points, clockwise from north
+var compassKeys = []string{"compass.n", "compass.nne", "compass.ne", "compass.ene", "compass.e", "compass.ese", "compass.se", "compass.sse",
+	"compass.s", "compass.ssw", "compass.sw", "compass.wsw", "compass.w", "compass.wnw", "compass.nw", "compass.nnw"}
+
+// Wind too light to have a direction
+const msgCalm = "compass.calm"
+
+// OpenWeatherMap AQI descriptions, indexed by AQI value 1-5
+var owmAQIKeys = []string{"", "aqi.owm.1", "aqi.owm.2", "aqi.owm.3", "aqi.owm.4", "aqi.owm.5"}
+
+// Localized strings for the structured weather data, by locale then key
+var catalog = map[string]map[string]string{
+	"en": {
+		msgLanguageName: "English",
+		msgHours:        "hours",
+		msgExcellent:    "excellent",
+		msgUnknown:      "Unknown",
+		msgDateLayout:   "{month} {day}, {year}",
+		msgDateTime:     "{weekday}, {date} at {time}",
+		msgTimeLayout:   "3:04 PM",
+
+		"weekday.0": "Sunday", "weekday.1": "Monday", "weekday.2": "Tuesday", "weekday.3": "Wednesday",
+		"weekday.4": "Thursday", "weekday.5": "Friday", "weekday.6": "Saturday",
+		"month.1": "January", "month.2": "February", "month.3": "March", "month.4": "April",
+		"month.5": "May", "month.6": "June", "month.7": "July", "month.8": "August",
+		"month.9": "September", "month.10": "October", "month.11": "November", "month.12": "December",
+
+		msgDaytime:   "DAYTIME",
+		msgNighttime: "NIGHTTIME",
+
+		"compass.n": "N", "compass.ne": "NE", "compass.e": "E", "compass.se": "SE",
+		"compass.s": "S", "compass.sw": "SW", "compass.w": "W", "compass.nw": "NW",
+		"compass.nne": "NNE", "compass.ene": "ENE", "compass.ese": "ESE", "compass.sse": "SSE",
+		"compass.ssw": "SSW", "compass.wsw": "WSW", "compass.wnw": "WNW", "compass.nnw": "NNW",
+		msgCalm: "calm",
+
+		"beaufort.0": "Calm", "beaufort.1": "Light air", "beaufort.2": "Light breeze", "beaufort.3": "Gentle breeze",
+		"beaufort.4": "Moderate breeze", "beaufort.5": "Fresh breeze", "beaufort.6": "Strong breeze", "beaufort.7": "Near gale",
+		"beaufort.8": "Gale", "beaufort.9": "Strong gale", "beaufort.10": "Storm", "beaufort.11": "Violent storm",
+		"beaufort.12": "Hurricane force",
+
+		"aqi.owm.1":   "Good (1): Air quality is considered satisfactory, and air pollution poses little or no risk.",
+		"aqi.owm.2":   "Fair (2): Air quality is acceptable; however, for some pollutants there may be a moderate health concern for a very small number of people.",
+		"aqi.owm.3":   "Moderate (3): Members of sensitive groups may experience health effects. The general public is not likely to be affected.",
+		"aqi.owm.4":   "Poor (4): Everyone may begin to experience health effects; members of sensitive groups may experience more serious health effects.",
+		"aqi.owm.5":   "Very Poor (5): Health warnings of emergency conditions. The entire population is more likely to be affected.",
+		msgAQIUnknown: "Unknown AQI value: %d",
+
+		"aqi.us.good":           "Good",
+		"aqi.us.moderate":       "Moderate",
+		"aqi.us.sensitive":      "Unhealthy for Sensitive Groups",
+		"aqi.us.unhealthy":      "Unhealthy",
+		"aqi.us.very_unhealthy": "Very Unhealthy",
+		"aqi.us.hazardous":      "Hazardous",
+	},
+	"es": {
+		msgLanguageName: "Spanish (español)",
+		msgHours:        "horas",
+		msgExcellent:    "excelente",
+		msgUnknown:      "Desconocida",
+		msgDateLayout:   "{day} de {month} de {year}",
+		msgDateTime:     "{weekday}, {date} a las {time}",
+		msgTimeLayout:   "15:04",
+
+		"weekday.0": "domingo", "weekday.1": "lunes", "weekday.2": "martes", "weekday.3": "miércoles",
+		"weekday.4": "jueves", "weekday.5": "viernes", "weekday.6": "sábado",
+		"month.1": "enero", "month.2": "febrero", "month.3": "marzo", "month.4": "abril",
+		"month.5": "mayo", "month.6": "junio", "month.7": "julio", "month.8": "agosto",
+		"month.9": "septiembre", "month.10": "octubre", "month.11": "noviembre", "month.12": "diciembre",
+
+		msgDaytime:   "DE DÍA",
+		msgNighttime: "DE NOCHE",
+
+		"compass.n": "N", "compass.ne": "NE", "compass.e": "E", "compass.se": "SE",
+		"compass.s": "S", "compass.sw": "SO", "compass.w": "O", "compass.nw": "NO",
+		"compass.nne": "NNE", "compass.ene": "ENE", "compass.ese": "ESE", "compass.sse": "SSE",
+		"compass.ssw": "SSO", "compass.wsw": "OSO", "compass.wnw": "ONO", "compass.nnw": "NNO",
+		msgCalm: "calma",
+
+		"beaufort.0": "Calma", "beaufort.1": "Ventolina", "beaufort.2": "Flojito", "beaufort.3": "Flojo",
+		"beaufort.4": "Bonancible", "beaufort.5": "Fresquito", "beaufort.6": "Fresco", "beaufort.7": "Frescachón",
+		"beaufort.8": "Temporal", "beaufort.9": "Temporal fuerte", "beaufort.10": "Temporal duro", "beaufort.11": "Temporal muy duro",
+		"beaufort.12": "Huracán",
+
+		"aqi.owm.1":   "Buena (1): La calidad del aire se considera satisfactoria y la contaminación supone poco o ningún riesgo.",
+		"aqi.owm.2":   "Aceptable (2): La calidad del aire es aceptable; algunos contaminantes pueden afectar moderadamente a un número muy reducido de personas.",
+		"aqi.owm.3":   "Moderada (3): Los grupos sensibles pueden sufrir efectos en la salud. No es probable que afecte al público en general.",
+		"aqi.owm.4":   "Mala (4): Todos pueden empezar a sufrir efectos en la salud; los grupos sensibles pueden sufrir efectos más graves.",
+		"aqi.owm.5":   "Muy mala (5): Advertencias sanitarias de emergencia. Es más probable que toda la población se vea afectada.",
+		msgAQIUnknown: "Valor de ICA desconocido: %d",
+
+		"aqi.us.good":           "Buena",
+		"aqi.us.moderate":       "Moderada",
+		"aqi.us.sensitive":      "Dañina para grupos sensibles",
+		"aqi.us.unhealthy":      "Dañina",
+		"aqi.us.very_unhealthy": "Muy dañina",
+		"aqi.us.hazardous":      "Peligrosa",
+	},
+	"fr": {
+		msgLanguageName: "French (français)",
+		msgHours:        "heures",
+		msgExcellent:    "excellente",
+		msgUnknown:      "Inconnue",
+		msgDateLayout:   "{day} {month} {year}",
+		msgDateTime:     "{weekday} {date} à {time}",
+		msgTimeLayout:   "15:04",
+
+		"weekday.0": "dimanche", "weekday.1": "lundi", "weekday.2": "mardi", "weekday.3": "mercredi",
+		"weekday.4": "jeudi", "weekday.5": "vendredi", "weekday.6": "samedi",
+		"month.1": "janvier", "month.2": "février", "month.3": "mars", "month.4": "avril",
+		"month.5": "mai", "month.6": "juin", "month.7": "juillet", "month.8": "août",
+		"month.9": "septembre", "month.10": "octobre", "month.11": "novembre", "month.12": "décembre",
+
+		msgDaytime:   "JOUR",
+		msgNighttime: "NUIT",
+
+		"compass.n": "N", "compass.ne": "NE", "compass.e": "E", "compass.se": "SE",
+		"compass.s": "S", "compass.sw": "SO", "compass.w": "O", "compass.nw": "NO",
+		"compass.nne": "NNE", "compass.ene": "ENE", "compass.ese": "ESE", "compass.sse": "SSE",
+		"compass.ssw": "SSO", "compass.wsw": "OSO", "compass.wnw": "ONO", "compass.nnw": "NNO",
+		msgCalm: "calme",
+
+		"beaufort.0": "Calme", "beaufort.1": "Très légère brise", "beaufort.2": "Légère brise", "beaufort.3": "Petite brise",
+		"beaufort.4": "Jolie brise", "beaufort.5": "Bonne brise", "beaufort.6": "Vent frais", "beaufort.7": "Grand frais",
+		"beaufort.8": "Coup de vent", "beaufort.9": "Fort coup de vent", "beaufort.10": "Tempête", "beaufort.11": "Violente tempête",
+		"beaufort.12": "Ouragan",
+
+		"aqi.owm.1":   "Bon (1) : La qualité de l'air est satisfaisante et la pollution présente peu ou pas de risque.",
+		"aqi.owm.2":   "Correct (2) : La qualité de l'air est acceptable ; certains polluants peuvent toutefois gêner un très petit nombre de personnes.",
+		"aqi.owm.3":   "Modéré (3) : Les personnes sensibles peuvent ressentir des effets sur la santé. Le grand public ne devrait pas être affecté.",
+		"aqi.owm.4":   "Mauvais (4) : Tout le monde peut commencer à ressentir des effets ; les personnes sensibles peuvent en ressentir de plus graves.",
+		"aqi.owm.5":   "Très mauvais (5) : Alerte sanitaire d'urgence. L'ensemble de la population risque d'être affecté.",
+		msgAQIUnknown: "Valeur d'IQA inconnue : %d",
+
+		"aqi.us.good":           "Bon",
+		"aqi.us.moderate":       "Modéré",
+		"aqi.us.sensitive":      "Mauvais pour les personnes sensibles",
+		"aqi.us.unhealthy":      "Mauvais",
+		"aqi.us.very_unhealthy": "Très mauvais",
+		"aqi.us.hazardous":      "Dangereux",
+	},
+	"de": {
+		msgLanguageName: "German (Deutsch)",
+		msgHours:        "Stunden",
+		msgExcellent:    "ausgezeichnet",
+		msgUnknown:      "Unbekannt",
+		msgDateLayout:   "{day}. {month} {year}",
+		msgDateTime:     "{weekday}, {date} um {time}",
+		msgTimeLayout:   "15:04",
+
+		"weekday.0": "Sonntag", "weekday.1": "Montag", "weekday.2": "Dienstag", "weekday.3": "Mittwoch",
+		"weekday.4": "Donnerstag", "weekday.5": "Freitag", "weekday.6": "Samstag",
+		"month.1": "Januar", "month.2": "Februar", "month.3": "März", "month.4": "April",
+		"month.5": "Mai", "month.6": "Juni", "month.7": "Juli", "month.8": "August",
+		"month.9": "September", "month.10": "Oktober", "month.11": "November", "month.12": "Dezember",
+
+		msgDaytime:   "TAGSÜBER",
+		msgNighttime: "NACHTS",
+
+		"compass.n": "N", "compass.ne": "NO", "compass.e": "O", "compass.se": "SO",
+		"compass.s": "S", "compass.sw": "SW", "compass.w": "W", "compass.nw": "NW",
+		"compass.nne": "NNO", "compass.ene": "ONO", "compass.ese": "OSO", "compass.sse": "SSO",
+		"compass.ssw": "SSW", "compass.wsw": "WSW", "compass.wnw": "WNW", "compass.nnw": "NNW",
+		msgCalm: "windstill",
+
+		"beaufort.0": "Windstille", "beaufort.1": "Leiser Zug", "beaufort.2": "Leichte Brise", "beaufort.3": "Schwache Brise",
+		"beaufort.4": "Mäßige Brise", "beaufort.5": "Frische Brise", "beaufort.6": "Starker Wind", "beaufort.7": "Steifer Wind",
+		"beaufort.8": "Stürmischer Wind", "beaufort.9": "Sturm", "beaufort.10": "Schwerer Sturm", "beaufort.11": "Orkanartiger Sturm",
+		"beaufort.12": "Orkan",
+
+		"aqi.owm.1":   "Gut (1): Die Luftqualität ist zufriedenstellend, die Luftverschmutzung stellt kaum oder kein Risiko dar.",
+		"aqi.owm.2":   "Mäßig (2): Die Luftqualität ist akzeptabel; einige Schadstoffe können jedoch sehr wenige Menschen leicht belasten.",
+		"aqi.owm.3":   "Mittel (3): Empfindliche Gruppen können gesundheitliche Auswirkungen spüren. Die Allgemeinheit ist voraussichtlich nicht betroffen.",
+		"aqi.owm.4":   "Schlecht (4): Alle können gesundheitliche Auswirkungen spüren; bei empfindlichen Gruppen können sie stärker ausfallen.",
+		"aqi.owm.5":   "Sehr schlecht (5): Gesundheitswarnung für Notfallbedingungen. Die gesamte Bevölkerung ist eher betroffen.",
+		msgAQIUnknown: "Unbekannter LQI-Wert: %d",
+
+		"aqi.us.good":           "Gut",
+		"aqi.us.moderate":       "Mäßig",
+		"aqi.us.sensitive":      "Ungesund für empfindliche Gruppen",
+		"aqi.us.unhealthy":      "Ungesund",
+		"aqi.us.very_unhealthy": "Sehr ungesund",
+		"aqi.us.hazardous":      "Gefährlich",
+	},
+}
+
+// Reduce a locale such as "de-DE" or "fr_CA.UTF-8" to a catalog language,
+// falling back to the default locale for languages without a catalog
+func normalizeLocale(locale string) string {
+	lang := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(lang, "-_."); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalog[lang]; !ok {
+		return defaultLocale
+	}
+	return lang
+}
+
+// Look up a string for the locale, falling back to English and then the key itself
+func translate(locale, key string) string {
+	if s, ok := catalog[normalizeLocale(locale)][key]; ok {
+		return s
+	}
+	if s, ok := catalog[defaultLocale][key]; ok {
+		return s
+	}
+	return key
+}
+
+// Compass point (N, NNE, NE, ...) for a direction in degrees
+func compassDirection(locale string, degrees float64) string {
+	degrees = math.Mod(math.Mod(degrees, 360)+360, 360)
+	index := int(math.Floor((degrees+11.25)/22.5)) % len(compassKeys)
+	return translate(locale, compassKeys[index])
+}
+
+// Localized Beaufort description, e.g. "Gentle breeze" for force 3
+func beaufortDescription(locale string, force int) string {
+	return translate(locale, fmt.Sprintf("beaufort.%d", force))
+}
+
+// Day/night label for the structured weather data
+func dayNightLabel(locale string, isDaytime bool) string {
+	if isDaytime {
+		return translate(locale, msgDaytime)
+	}
+	return translate(locale, msgNighttime)
+}
+
+// Catalog key of the US EPA category for an AQI value
+func usAQICategoryKey(aqi int) string {
+	switch {
+	case aqi <= 50:
+		return "aqi.us.good"
+	case aqi <= 100:
+		return "aqi.us.moderate"
+	case aqi <= 150:
+		return "aqi.us.sensitive"
+	case aqi <= 200:
+		return "aqi.us.unhealthy"
+	case aqi <= 300:
+		return "aqi.us.very_unhealthy"
+	default:
+		return "aqi.us.hazardous"
+	}
+}
+
+// US EPA category name for an AQI value, as reported by IQAir
+func usAQICategory(locale string, aqi int) string {
+	return translate(locale, usAQICategoryKey(aqi))
+}
+
+// Helper function to get AQI description based on value for OpenWeatherMap API
+func getAQIDescription(locale string, aqi int) string {
+	if aqi < 1 || aqi >= len(owmAQIKeys) {
+		return fmt.Sprintf(translate(locale, msgAQIUnknown), aqi)
+	}
+	return translate(locale, owmAQIKeys[aqi])
+}
+
+// Localized weekday name
+func weekdayName(locale string, day time.Weekday) string {
+	return translate(locale, fmt.Sprintf("weekday.%d", day))
+}
+
+// Localized long date, e.g. "January 2, 2006" or "2. Januar 2006"
+func formatLocalDate(locale string, t time.Time) string {
+	return strings.NewReplacer(
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", translate(locale, fmt.Sprintf("month.%d", t.Month())),
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(translate(locale, msgDateLayout))
+}
+
+// Localized weekday, date and time, e.g. "Monday, January 2, 2006 at 3:04 PM"
+func formatLocalDateTime(locale string, t time.Time) string {
+	return strings.NewReplacer(
+		"{weekday}", weekdayName(locale, t.Weekday()),
+		"{date}", formatLocalDate(locale, t),
+		"{time}", t.Format(translate(locale, msgTimeLayout)),
+	).Replace(translate(locale, msgDateTime))
+}
+
+// Name of the language the LLM should respond in. Languages without a
+// catalog are passed through as configured (e.g. "Japanese").
+func languageName(language string) string {
+	lang := strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(lang, "-_."); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalog[lang]; ok {
+		return translate(lang, msgLanguageName)
+	}
+	return strings.TrimSpace(language)
+}
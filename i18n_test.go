@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-DE", "de"},
+		{"fr_CA.UTF-8", "fr"},
+		{" ES ", "es"},
+		{"ja", "en"},
+	}
+	for _, tt := range tests {
+		if got := normalizeLocale(tt.locale); got != tt.want {
+			t.Errorf("normalizeLocale(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestCompassDirection(t *testing.T) {
+	tests := []struct {
+		locale  string
+		degrees float64
+		want    string
+	}{
+		{"en", 0, "N"},
+		{"en", 11.24, "N"},
+		{"en", 11.25, "NNE"},
+		{"en", 33.74, "NNE"},
+		{"en", 33.75, "NE"},
+		{"en", 56.25, "ENE"},
+		{"en", 180, "S"},
+		{"en", 191.25, "SSW"},
+		{"en", 326.24, "NW"},
+		{"en", 326.25, "NNW"},
+		{"en", 348.74, "NNW"},
+		{"en", 348.75, "N"},
+		{"en", 360, "N"},
+		{"en", -90, "W"},
+		{"en", -22.5, "NNW"},
+		{"de", 90, "O"},
+		{"de", 45, "NO"},
+		{"de", 67.5, "ONO"},
+		{"fr", 270, "O"},
+		{"fr", 292.5, "ONO"},
+		{"es", 225, "SO"},
+		{"es", 202.5, "SSO"},
+	}
+	for _, tt := range tests {
+		if got := compassDirection(tt.locale, tt.degrees); got != tt.want {
+			t.Errorf("compassDirection(%q, %v) = %q, want %q", tt.locale, tt.degrees, got, tt.want)
+		}
+	}
+}
+
+func TestAQICategories(t *testing.T) {
+	tests := []struct {
+		locale string
+		aqi    int
+		want   string
+	}{
+		{"en", 42, "Good"},
+		{"en", 120, "Unhealthy for Sensitive Groups"},
+		{"en", 400, "Hazardous"},
+		{"de", 180, "Ungesund"},
+		{"fr", 75, "Modéré"},
+	}
+	for _, tt := range tests {
+		if got := usAQICategory(tt.locale, tt.aqi); got != tt.want {
+			t.Errorf("usAQICategory(%q, %d) = %q, want %q", tt.locale, tt.aqi, got, tt.want)
+		}
+	}
+
+	if got := getAQIDescription("en", 9); got != "Unknown AQI value: 9" {
+		t.Errorf("unknown AQI description = %q", got)
+	}
+	if got := getAQIDescription("es", 1); got[:9] != "Buena (1)" {
+		t.Errorf("Spanish AQI description = %q", got)
+	}
+}
+
+// Every locale should translate every key the English catalog has
+func TestCatalogComplete(t *testing.T) {
+	for locale, messages := range catalog {
+		for key := range catalog[defaultLocale] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("locale %q is missing %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestDayNightLabel(t *testing.T) {
+	if got := dayNightLabel("en", true); got != "DAYTIME" {
+		t.Errorf("dayNightLabel(en, day) = %q", got)
+	}
+	if got := dayNightLabel("de-AT", false); got != "NACHTS" {
+		t.Errorf("dayNightLabel(de-AT, night) = %q", got)
+	}
+}
+
+func TestLocalDateFormats(t *testing.T) {
+	when := time.Date(2024, 3, 4, 15, 7, 0, 0, time.UTC)
+	tests := []struct {
+		locale   string
+		date     string
+		dateTime string
+	}{
+		{"en", "March 4, 2024", "Monday, March 4, 2024 at 3:07 PM"},
+		{"de", "4. März 2024", "Montag, 4. März 2024 um 15:07"},
+		{"fr", "4 mars 2024", "lundi 4 mars 2024 à 15:07"},
+		{"es", "4 de marzo de 2024", "lunes, 4 de marzo de 2024 a las 15:07"},
+	}
+	for _, tt := range tests {
+		if got := formatLocalDate(tt.locale, when); got != tt.date {
+			t.Errorf("formatLocalDate(%q) = %q, want %q", tt.locale, got, tt.date)
+		}
+		if got := formatLocalDateTime(tt.locale, when); got != tt.dateTime {
+			t.Errorf("formatLocalDateTime(%q) = %q, want %q", tt.locale, got, tt.dateTime)
+		}
+	}
+}
+
+func TestLanguageName(t *testing.T) {
+	tests := map[string]string{
+		"de":       "German (Deutsch)",
+		"fr-CA":    "French (français)",
+		"Japanese": "Japanese",
+	}
+	for language, want := range tests {
+		if got := languageName(language); got != want {
+			t.Errorf("languageName(%q) = %q, want %q", language, got, want)
+		}
+	}
+}
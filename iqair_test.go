@@ -16,10 +16,10 @@ func TestIQAirAPI(t *testing.T) {
 	// Get API key from environment or .env file
 	apiKey := getIQAirAPIKey()
 	if apiKey == "" {
-		t.Fatal("IQAir API key not found. Please set IQAIR_API_KEY environment variable or add it to .env file.")
+		t.Skip("IQAir API key not found. Set IQAIR_API_KEY or add it to .env to test the live API.")
 	}
 
-	fmt.Printf("Testing IQAir API with key: %s... (length: %d)\n", apiKey[:4], len(apiKey))
+	fmt.Printf("Testing IQAir API with a key of length %d\n", len(apiKey))
 
 	// Test multiple locations to ensure the API is working
 	testLocations := []struct {
@@ -160,14 +160,7 @@ func testNearestCity(t *testing.T, apiKey string, lat, lon float64) {
 		return
 	}
 	
-	// Log the successful API call to a file
-	logFile, err := os.OpenFile("iqair_api_calls.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err == nil {
-		defer logFile.Close()
-		timestamp := time.Now().Format(time.RFC3339)
-		logFile.WriteString(fmt.Sprintf("[%s] IQAir API call successful: lat=%.6f, lon=%.6f\n", 
-			timestamp, lat, lon))
-	}
+	t.Logf("IQAir API call successful: lat=%.6f, lon=%.6f", lat, lon)
 	
 	fmt.Println("Successfully received data from IQAir API")
 }
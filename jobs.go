@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Message job statuses
+const (
+	JobPending   = "pending"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Message job limits
+const (
+	jobRetention   = 10 * time.Minute // How long a finished job can still be polled
+	maxPendingJobs = 100              // Jobs generating at once; further requests wait for their message
+)
+
+// A weather message generating in the background for /api/weather, polled
+// through /api/jobs/{id}
+type MessageJob struct {
+	ID         string                 `json:"id"`
+	Status     string                 `json:"status"`
+	CreatedAt  time.Time              `json:"created_at"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	Result     *WeatherUpdateResponse `json:"result,omitempty"` // Once completed
+	Error      string                 `json:"error,omitempty"`  // Once failed
+
+	key string // What the job generates, so identical requests share it
+}
+
+type jobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*MessageJob
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*MessageJob)}
+}
+
+// Start generating in the background, or return the pending job with the
+// same key. False when maxPendingJobs are already generating. Jobs finished
+// longer than jobRetention ago are dropped.
+func (s *jobStore) start(key string, generate func() (WeatherUpdateResponse, error)) (MessageJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := 0
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(s.jobs, id)
+		} else if job.Status == JobPending {
+			if job.key == key {
+				return *job, true
+			}
+			pending++
+		}
+	}
+	if pending >= maxPendingJobs {
+		return MessageJob{}, false
+	}
+
+	job := &MessageJob{ID: newMessageID(), Status: JobPending, CreatedAt: time.Now(), key: key}
+	s.jobs[job.ID] = job
+	go func() {
+		result, err := generate()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status, job.Error = JobFailed, err.Error()
+			return
+		}
+		job.Status, job.Result = JobCompleted, &result
+	}()
+	return *job, true
+}
+
+func (s *jobStore) get(id string) (MessageJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return MessageJob{}, false
+	}
+	return *job, true
+}
+
+// Unless a message for the weather is cached, answer r with 202, the
+// weather's conditions, the location's last message and a job generating the
+// new one. False when the caller should generate the message itself: it's
+// cached, or too many jobs are pending.
+func (agent *WeatherAgent) acceptWeatherJob(w http.ResponseWriter, r *http.Request, weather WeatherResponse, persona string, params llmParams,
+	sensitivities []string, key string, generate func() (WeatherUpdateResponse, error)) bool {
+	if agent.llmMessageCached(weather, persona, params) {
+		return false
+	}
+	job, ok := agent.jobs.start(key, generate)
+	if !ok {
+		agent.logger.Printf("%d message jobs pending, generating in the request", maxPendingJobs)
+		return false
+	}
+
+	weatherData := agent.prepareWeatherData(weather)
+	agent.markDegraded(weather, weatherData)
+	agent.addPlaylist(weather, weatherData)
+	personalizeAirQualityGuidance(weatherData, sensitivities)
+	agent.recordUIEngagement(r)
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, WeatherUpdateResponse{
+		City:          weather.Name,
+		Country:       weather.Sys.Country,
+		Message:       agent.lastMessage(weatherLocationKey(weather)).Message,
+		Persona:       persona,
+		Timestamp:     time.Now().Format(time.RFC1123),
+		Data:          weatherData,
+		Severity:      dataSeverity(weatherData),
+		SeverityColor: severityColor(dataSeverity(weatherData)),
+		JobID:         job.ID,
+	})
+	return true
+}
+
+// GET /api/jobs/{id}: a message job's status, with the full weather update
+// once it completes
+func (agent *WeatherAgent) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := agent.jobs.get(r.PathValue("id"))
+	if !ok {
+		apiError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
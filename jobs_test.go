@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Wait up to a second for a job to finish
+func waitForJob(s *jobStore, id string) MessageJob {
+	deadline := time.Now().Add(time.Second)
+	for {
+		if job, _ := s.get(id); job.Status != JobPending || time.Now().After(deadline) {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobStore(t *testing.T) {
+	agent := &WeatherAgent{jobs: newJobStore()}
+	release := make(chan struct{})
+	calls := 0
+	generate := func() (WeatherUpdateResponse, error) {
+		calls++
+		<-release
+		return WeatherUpdateResponse{City: "Oslo", Message: "Mild and breezy."}, nil
+	}
+
+	job, _ := agent.jobs.start("oslo", generate)
+	if again, _ := agent.jobs.start("oslo", generate); again.ID != job.ID || job.Status != JobPending {
+		t.Fatalf("identical requests should share the pending job: %+v, %+v", job, again)
+	}
+
+	poll := func(id string) (int, MessageJob) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id, nil)
+		req.SetPathValue("id", id)
+		agent.handleJob(rec, req)
+		var got MessageJob
+		json.NewDecoder(rec.Body).Decode(&got)
+		return rec.Code, got
+	}
+	if code, got := poll(job.ID); code != http.StatusOK || got.Status != JobPending || got.Result != nil {
+		t.Errorf("pending: %d %+v", code, got)
+	}
+
+	close(release)
+	waitForJob(agent.jobs, job.ID)
+	if code, got := poll(job.ID); code != http.StatusOK || got.Status != JobCompleted || got.FinishedAt == nil ||
+		got.Result == nil || got.Result.Message != "Mild and breezy." || calls != 1 {
+		t.Errorf("completed: %d %+v after %d calls", code, got, calls)
+	}
+
+	// A finished job doesn't absorb new requests, and old ones are dropped
+	failed, _ := agent.jobs.start("oslo", func() (WeatherUpdateResponse, error) { return WeatherUpdateResponse{}, errors.New("LLM down") })
+	if failed.ID == job.ID {
+		t.Error("a finished job was reused")
+	}
+	agent.jobs.mu.Lock()
+	expired := time.Now().Add(-jobRetention - time.Minute)
+	agent.jobs.jobs[job.ID].FinishedAt = &expired
+	agent.jobs.mu.Unlock()
+	agent.jobs.start("bergen", func() (WeatherUpdateResponse, error) { return WeatherUpdateResponse{}, nil })
+	if code, _ := poll(job.ID); code != http.StatusNotFound {
+		t.Errorf("expired job: got %d", code)
+	}
+}
+
+func TestJobStoreLimit(t *testing.T) {
+	s := newJobStore()
+	release := make(chan struct{})
+	defer close(release)
+	generate := func() (WeatherUpdateResponse, error) {
+		<-release
+		return WeatherUpdateResponse{}, nil
+	}
+
+	for i := 0; i < maxPendingJobs; i++ {
+		if _, ok := s.start(fmt.Sprint(i), generate); !ok {
+			t.Fatalf("job %d refused", i)
+		}
+	}
+	if _, ok := s.start("one more", generate); ok {
+		t.Error("started a job past maxPendingJobs")
+	}
+	if _, ok := s.start("0", generate); !ok {
+		t.Error("a pending job wasn't shared at the limit")
+	}
+}
+
+func TestAcceptWeatherJob(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key", LLMCacheMinutes: 30})
+	agent.jobs = newJobStore()
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.setLastMessage(locationKey("Oslo", "NO"), "Cool and grey.")
+	params := agent.llmParams()
+	release := make(chan struct{})
+	generate := func() (WeatherUpdateResponse, error) {
+		<-release
+		return WeatherUpdateResponse{City: "Oslo", Message: "Mild and breezy."}, nil
+	}
+
+	// The conditions and last message come back now, the new message later
+	rec := httptest.NewRecorder()
+	if !agent.acceptWeatherJob(rec, httptest.NewRequest(http.MethodGet, "/api/v1/weather", nil), weather, "", params, nil, "oslo", generate) {
+		t.Fatal("no job for an uncached message")
+	}
+	var resp WeatherUpdateResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusAccepted || resp.JobID == "" || rec.Header().Get("Location") != "/api/v1/jobs/"+resp.JobID ||
+		resp.City != "Oslo" || resp.Message != "Cool and grey." || resp.Data["aqi"] == nil || resp.SeverityColor == "" {
+		t.Fatalf("accepted: %d %v %+v", rec.Code, rec.Header(), resp)
+	}
+	close(release)
+	if job := waitForJob(agent.jobs, resp.JobID); job.Status != JobCompleted || job.Result.Message != "Mild and breezy." {
+		t.Errorf("job = %+v", job)
+	}
+
+	// A cached message is generated in the request
+	agent.cache.Set(agent.llmCacheKey(weather, "", params), []byte("Mild and breezy."), time.Minute)
+	rec = httptest.NewRecorder()
+	if agent.acceptWeatherJob(rec, httptest.NewRequest(http.MethodGet, "/api/v1/weather", nil), weather, "", params, nil, "oslo", generate) ||
+		rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("cached message: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Last year settings
+const (
+	lastYearCacheTTL = 24 * time.Hour // The archive only changes while ERA5 catches up, long before a year back
+	lastYearNotableC = 5              // Change in the high (°C) worth mentioning in the message
+)
+
+// Conditions on the same date a year ago
+type LastYear struct {
+	Date          string  `json:"date"`
+	High          float64 `json:"high"`
+	Low           float64 `json:"low"`
+	Precipitation float64 `json:"precipitation_mm"`
+	WeatherCode   int     `json:"weather_code"`
+	Description   string  `json:"description"`
+	HighChange    float64 `json:"high_change"` // Today's forecast high minus last year's
+}
+
+// Same calendar date a year earlier. Feb 29 falls back to Feb 28.
+func sameDateLastYear(today time.Time) time.Time {
+	lastYear := time.Date(today.Year()-1, today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	if lastYear.Month() != today.Month() {
+		lastYear = lastYear.AddDate(0, 0, -1)
+	}
+	return lastYear
+}
+
+// Whether today's high differs enough from last year's to mention
+func (ly LastYear) notable(system units.System) bool {
+	change := math.Abs(ly.HighChange)
+	if system != units.Metric {
+		change = change * 5 / 9
+	}
+	return change >= lastYearNotableC
+}
+
+// Parse a one-day archive response for date
+func parseLastYear(body []byte, date string) (LastYear, error) {
+	var archiveResp struct {
+		Daily struct {
+			Time          []string   `json:"time"`
+			TempMax       []*float64 `json:"temperature_2m_max"`
+			TempMin       []*float64 `json:"temperature_2m_min"`
+			Precipitation []*float64 `json:"precipitation_sum"`
+			WeatherCode   []*int     `json:"weather_code"`
+		} `json:"daily"`
+	}
+	if err := json.Unmarshal(body, &archiveResp); err != nil {
+		return LastYear{}, fmt.Errorf("failed to parse archive response: %v", err)
+	}
+
+	d := archiveResp.Daily
+	for i, t := range d.Time {
+		if t != date {
+			continue
+		}
+		if i >= len(d.TempMax) || i >= len(d.TempMin) || d.TempMax[i] == nil || d.TempMin[i] == nil {
+			break
+		}
+		lastYear := LastYear{Date: date, High: *d.TempMax[i], Low: *d.TempMin[i]}
+		if i < len(d.Precipitation) && d.Precipitation[i] != nil {
+			lastYear.Precipitation = *d.Precipitation[i]
+		}
+		if i < len(d.WeatherCode) && d.WeatherCode[i] != nil {
+			lastYear.WeatherCode = *d.WeatherCode[i]
+		}
+		return lastYear, nil
+	}
+	return LastYear{}, fmt.Errorf("no archive data for %s", date)
+}
+
+// Fetch last year's conditions for today's date from the Open-Meteo archive
+func (agent *WeatherAgent) fetchLastYear(lat, lon float64) (LastYear, error) {
+	today, todayHigh, _, err := agent.fetchTodayHighLow(lat, lon)
+	if err != nil {
+		return LastYear{}, err
+	}
+	date := sameDateLastYear(today).Format("2006-01-02")
+
+	url := fmt.Sprintf("https://archive-api.open-meteo.com/v1/archive?latitude=%.4f&longitude=%.4f&start_date=%s&end_date=%s&daily=temperature_2m_max,temperature_2m_min,precipitation_sum,weather_code&temperature_unit=%s&timezone=auto",
+		lat, lon, date, date, agent.units().OpenMeteoTemperatureUnit())
+	body, _, err := agent.cachedGet(url, lastYearCacheTTL, false)
+	if err != nil {
+		return LastYear{}, fmt.Errorf("archive request failed: %v", err)
+	}
+
+	lastYear, err := parseLastYear(body, date)
+	if err != nil {
+		return LastYear{}, err
+	}
+	lastYear.Description = agent.weatherCodeToDescription(lastYear.WeatherCode)
+	lastYear.HighChange = round1(todayHigh - lastYear.High)
+	return lastYear, nil
+}
+
+// Attach last year's conditions for the same date when enabled
+func (agent *WeatherAgent) addLastYear(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureLastYear) {
+		return
+	}
+
+	lastYear, err := agent.fetchLastYear(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch last year's weather: %v", err)
+		return
+	}
+	weather.LastYear = &lastYear
+}
+
+// Add last year's conditions to the LLM data map
+func (agent *WeatherAgent) addLastYearData(weather WeatherResponse, data map[string]interface{}) {
+	ly := weather.LastYear
+	if ly == nil {
+		return
+	}
+	unit := agent.weatherUnits(weather).TemperatureSymbol()
+	data["on_this_day_last_year"] = fmt.Sprintf("%s: %s, high %.1f%s, low %.1f%s, %.1f mm of precipitation; today's forecast high is %+.1f%s compared with then",
+		ly.Date, ly.Description, ly.High, unit, ly.Low, unit, ly.Precipitation, ly.HighChange, unit)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+func TestSameDateLastYear(t *testing.T) {
+	tests := map[string]string{
+		"2026-10-17": "2025-10-17",
+		"2026-01-01": "2025-01-01",
+		"2028-02-29": "2027-02-28",
+	}
+	for today, want := range tests {
+		d, _ := time.Parse("2006-01-02", today)
+		if got := sameDateLastYear(d).Format("2006-01-02"); got != want {
+			t.Errorf("sameDateLastYear(%s) = %s, want %s", today, got, want)
+		}
+	}
+}
+
+func TestParseLastYear(t *testing.T) {
+	body := []byte(`{"daily":{"time":["2025-10-17"],"temperature_2m_max":[14.2],"temperature_2m_min":[6.8],"precipitation_sum":[3.4],"weather_code":[61]}}`)
+	ly, err := parseLastYear(body, "2025-10-17")
+	if err != nil {
+		t.Fatalf("parseLastYear() error = %v", err)
+	}
+	if ly.High != 14.2 || ly.Low != 6.8 || ly.Precipitation != 3.4 || ly.WeatherCode != 61 {
+		t.Errorf("parseLastYear() = %+v", ly)
+	}
+
+	missing := []byte(`{"daily":{"time":["2025-10-17"],"temperature_2m_max":[null],"temperature_2m_min":[null],"precipitation_sum":[null],"weather_code":[null]}}`)
+	for name, b := range map[string][]byte{"null values": missing, "other date": body, "invalid": []byte("nope")} {
+		date := "2025-10-17"
+		if name == "other date" {
+			date = "2025-10-18"
+		}
+		if _, err := parseLastYear(b, date); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLastYearNotable(t *testing.T) {
+	tests := []struct {
+		change float64
+		system units.System
+		want   bool
+	}{
+		{6, units.Metric, true},
+		{-5, units.Metric, true},
+		{3, units.Metric, false},
+		{8, units.Imperial, false}, // About 4.4°C
+		{-10, units.Imperial, true},
+	}
+	for _, tt := range tests {
+		if got := (LastYear{HighChange: tt.change}).notable(tt.system); got != tt.want {
+			t.Errorf("notable(%+.0f, %s) = %v, want %v", tt.change, tt.system, got, tt.want)
+		}
+	}
+}
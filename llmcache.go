@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Part of the local day, so a cached morning message isn't reused in the afternoon
+func partOfDay(hour int) string {
+	switch {
+	case hour >= 5 && hour < 12:
+		return "morning"
+	case hour >= 12 && hour < 17:
+		return "afternoon"
+	case hour >= 17 && hour < 22:
+		return "evening"
+	default:
+		return "night"
+	}
+}
+
+// Round to the nearest multiple of step
+func roundTo(value, step float64) float64 {
+	return math.Round(value/step) * step
+}
+
+// Hash of the weather fields the LLM message depends on, bucketed so that
+// small fluctuations (a tenth of a degree, a couple of % humidity) produce
+// the same fingerprint. Extra values the prompt depends on are hashed too.
+func weatherFingerprint(weather WeatherResponse, units string, extra ...string) string {
+	condition := ""
+	if len(weather.Weather) > 0 {
+		condition = weather.Weather[0].Main
+	}
+	localTime := time.Unix(weather.Dt, 0).In(time.FixedZone("Local", weather.Timezone))
+
+	salient := []string{
+		strings.ToLower(weather.Name),
+		strings.ToLower(weather.Sys.Country),
+		units,
+		condition,
+		fmt.Sprintf("%.0f", roundTo(weather.Main.Temp, 1)),
+		fmt.Sprintf("%.0f", roundTo(weather.Main.FeelsLike, 1)),
+		fmt.Sprintf("%.0f", roundTo(float64(weather.Main.Humidity), 10)),
+		fmt.Sprintf("%.0f", roundTo(weather.Wind.Speed, 5)),
+		fmt.Sprintf("%.0f", roundTo(float64(weather.Clouds.All), 20)),
+		fmt.Sprintf("%t", weather.Rain.OneHour+weather.Snow.OneHour > 0),
+		fmt.Sprintf("%d", weather.IsDay),
+		fmt.Sprintf("%.0f", roundTo(weather.UVIndex, 2)),
+		weather.IQAirData.Category,
+		partOfDay(localTime.Hour()),
+	}
+	// A message announcing rain in ~20 minutes shouldn't be reused an hour later
+	if nc := weather.Nowcast; nc != nil {
+		salient = append(salient, nc.Trend, nc.Kind, fmt.Sprintf("%.0f", roundTo(float64(nc.Minutes), 15)))
+	}
+	salient = append(salient,
+		fmt.Sprintf("gust=%.0f", roundTo(weather.Wind.Gust, 5)),
+		fmt.Sprintf("precip=%.0f", roundTo(peakPrecipChance(weather.HourlyPrecipProb, localTime), 20)))
+
+	// Hazards by ID, so a new warning, storm or quake is never answered with
+	// a message written before it
+	for _, w := range weather.Warnings {
+		salient = append(salient, "warning="+w.ID+"/"+w.Severity)
+	}
+	for _, s := range weather.Storms {
+		salient = append(salient, fmt.Sprintf("storm=%s/%s/%d", s.ID, s.Classification, s.Category))
+	}
+	for _, q := range weather.Earthquakes {
+		salient = append(salient, "quake="+q.ID)
+	}
+	if w := weather.Wildfire; w != nil {
+		salient = append(salient, fmt.Sprintf("smoke=%s/%t", w.SmokeRisk, w.UpwindFires > 0))
+	}
+	salient = append(salient, extra...)
+
+	sum := sha256.Sum256([]byte(strings.Join(salient, "|")))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Highest chance of precipitation (%) over the precipitation outlook's hours
+func peakPrecipChance(series []HourlyValue, now time.Time) float64 {
+	start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()).Unix()
+	end := start + precipOutlookHours*3600
+	peak := 0.0
+	for _, h := range series {
+		if h.Time >= start && h.Time < end {
+			peak = math.Max(peak, h.Value)
+		}
+	}
+	return peak
+}
+
+// Fingerprint of everything the LLM message depends on: the weather, plus
+// the overall severity, any heat or cold advisory and the indoor sensors,
+// which come from the agent's configuration and state
+func (agent *WeatherAgent) messageFingerprint(weather WeatherResponse) string {
+	severity, _ := agent.weatherSeverity(weather)
+	extra := []string{"severity=" + severity}
+	if advisory, ok := agent.temperatureAdvisory(weather); ok {
+		extra = append(extra, "advisory="+advisory.Type+"/"+advisory.Severity)
+	}
+	for _, reading := range agent.indoorReadings(weather, time.Now()) {
+		extra = append(extra, "indoor="+reading.Sensor+"/"+sensorFingerprint(reading))
+	}
+	return weatherFingerprint(weather, string(agent.weatherUnits(weather)), extra...)
+}
+
+// Cache key of the LLM message for the weather's fingerprint, persona,
+// caller's language and any sampling settings other than the configured ones
+func (agent *WeatherAgent) llmCacheKey(weather WeatherResponse, persona string, params llmParams) string {
+	key := cacheKeyPrefix + "llm:" + agent.messageFingerprint(weather)
+	if persona != "" {
+		key += ":" + persona
+	}
+	if weather.Locale != "" {
+		key += ":lang=" + weather.Locale
+	}
+	if !params.equal(agent.llmParams()) {
+		key += ":" + params.cacheKey()
+	}
+	return key
+}
+
+// Whether a message for this weather is in the LLM cache, so generating it
+// would be instant
+func (agent *WeatherAgent) llmMessageCached(weather WeatherResponse, persona string, params llmParams) bool {
+	if agent.config.LLMCacheMinutes <= 0 {
+		return false
+	}
+	_, ok, err := agent.cache.Get(agent.llmCacheKey(weather, persona, params))
+	return ok && err == nil
+}
+
+// Generate the weather message, reusing the message for an identical
+// fingerprint if one was generated within the cache window. Once the daily
+// LLM budget is spent or the LLM's breaker is open, the location's last
+// message is served instead, or a template message if there is none.
+func (agent *WeatherAgent) cachedLLMMessage(weather WeatherResponse, historyContext, persona string, params llmParams) (string, error) {
+	message, err := agent.cachedOrNewLLMMessage(weather, historyContext, persona, params)
+	if errors.Is(err, errLLMBudgetExceeded) || errors.Is(err, errCircuitOpen) {
+		if last := agent.lastMessage(weatherLocationKey(weather)); last.Message != "" {
+			agent.logger.Printf("LLM unavailable (%v), serving last message for %s from %s", err, weather.Name, last.Time.Format(time.RFC3339))
+			return last.Message, nil
+		}
+		agent.logger.Printf("LLM unavailable (%v), using a template message for %s", err, weather.Name)
+		return agent.renderTemplateMessage(weather), nil
+	}
+	return message, err
+}
+
+func (agent *WeatherAgent) cachedOrNewLLMMessage(weather WeatherResponse, historyContext, persona string, params llmParams) (string, error) {
+	window := time.Duration(agent.config.LLMCacheMinutes) * time.Minute
+	if window <= 0 {
+		return agent.generateLLMMessage(weather, historyContext, persona, params)
+	}
+
+	if cached, ok, err := agent.cache.Get(agent.llmCacheKey(weather, persona, params)); err != nil {
+		agent.logger.Printf("LLM cache read failed: %v", err)
+	} else if ok {
+		agent.logger.Printf("Reusing cached LLM message for %s (conditions unchanged)", weather.Name)
+		return string(cached), nil
+	}
+
+	return agent.refreshLLMMessage(weather, historyContext, persona, params)
+}
+
+// Generate a new weather message regardless of the cache, replacing any
+// cached message for the same fingerprint
+func (agent *WeatherAgent) refreshLLMMessage(weather WeatherResponse, historyContext, persona string, params llmParams) (string, error) {
+	message, err := agent.generateLLMMessage(weather, historyContext, persona, params)
+	if err != nil {
+		return "", err
+	}
+
+	window := time.Duration(agent.config.LLMCacheMinutes) * time.Minute
+	if window > 0 {
+		if err := agent.cache.Set(agent.llmCacheKey(weather, persona, params), []byte(message), window); err != nil {
+			agent.logger.Printf("LLM cache write failed: %v", err)
+		}
+	}
+	return message, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func fingerprintWeather(temp float64, humidity int, condition string) WeatherResponse {
+	var w WeatherResponse
+	w.Name = "Lisbon"
+	w.Sys.Country = "PT"
+	w.Main.Temp = temp
+	w.Main.FeelsLike = temp
+	w.Main.Humidity = humidity
+	w.Weather = append(w.Weather, struct {
+		ID          int    `json:"id"`
+		Main        string `json:"main"`
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+	}{Main: condition})
+	w.Dt = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Unix()
+	return w
+}
+
+func TestWeatherFingerprint(t *testing.T) {
+	base := weatherFingerprint(fingerprintWeather(18.2, 61, "Clear"), "metric")
+
+	tests := []struct {
+		name    string
+		weather WeatherResponse
+		same    bool
+	}{
+		{"small fluctuation", fingerprintWeather(18.4, 63, "Clear"), true},
+		{"temperature change", fingerprintWeather(19.6, 61, "Clear"), false},
+		{"humidity change", fingerprintWeather(18.2, 80, "Clear"), false},
+		{"condition change", fingerprintWeather(18.2, 61, "Rain"), false},
+	}
+	for _, tt := range tests {
+		got := weatherFingerprint(tt.weather, "metric") == base
+		if got != tt.same {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+
+	later := fingerprintWeather(18.2, 61, "Clear")
+	later.Dt += int64(5 * time.Hour / time.Second)
+	if weatherFingerprint(later, "metric") == base {
+		t.Error("morning and afternoon should not share a fingerprint")
+	}
+	if weatherFingerprint(fingerprintWeather(18.2, 61, "Clear"), "imperial") == base {
+		t.Error("units should be part of the fingerprint")
+	}
+}
+
+func TestWeatherFingerprintHazards(t *testing.T) {
+	base := weatherFingerprint(fingerprintWeather(18.2, 61, "Clear"), "metric")
+
+	tests := []struct {
+		name   string
+		modify func(w *WeatherResponse)
+	}{
+		{"earthquake", func(w *WeatherResponse) { w.Earthquakes = []Earthquake{{ID: "us7000abcd", Magnitude: 5.1}} }},
+		{"cyclone", func(w *WeatherResponse) {
+			w.Storms = []TropicalStorm{{ID: "al052024", Classification: "Hurricane", Category: 1}}
+		}},
+		{"wildfire smoke", func(w *WeatherResponse) { w.Wildfire = &Wildfire{Fires: 3, UpwindFires: 2, SmokeRisk: SmokeHigh} }},
+		{"warning", func(w *WeatherResponse) { w.Warnings = []WeatherWarning{{ID: "dwd.1", Severity: "Severe"}} }},
+		{"gusts", func(w *WeatherResponse) { w.Wind.Gust = 25 }},
+		{"precipitation chance", func(w *WeatherResponse) {
+			w.HourlyPrecipProb = []HourlyValue{{Time: w.Dt + 3600, Value: 80}}
+		}},
+	}
+	for _, tt := range tests {
+		w := fingerprintWeather(18.2, 61, "Clear")
+		tt.modify(&w)
+		if weatherFingerprint(w, "metric") == base {
+			t.Errorf("%s: fingerprint unchanged", tt.name)
+		}
+	}
+
+	if weatherFingerprint(fingerprintWeather(18.2, 61, "Clear"), "metric", "severity=warning") == base {
+		t.Error("extra values should be part of the fingerprint")
+	}
+}
+
+func TestLLMCacheMissesNewHazard(t *testing.T) {
+	llm := &fakeLLM{reply: "Sunny and 21°C in Austin."}
+	agent := newFixtureAgent(t, Config{LLMCacheMinutes: 30})
+	agent.llm = llm
+	weather := statusWeather("Clear", 1, 21)
+
+	for i := 0; i < 2; i++ {
+		if _, err := agent.cachedLLMMessage(weather, "", "", agent.llmParams()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(llm.prompts) != 1 {
+		t.Fatalf("%d LLM calls, want the repeat served from the cache", len(llm.prompts))
+	}
+
+	weather.Earthquakes = []Earthquake{{ID: "us7000abcd", Magnitude: 5.4, DistanceKm: 30}}
+	if _, err := agent.cachedLLMMessage(weather, "", "", agent.llmParams()); err != nil {
+		t.Fatal(err)
+	}
+	if len(llm.prompts) != 2 {
+		t.Errorf("%d LLM calls, want a new quake to miss the cache", len(llm.prompts))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OpenAI's chat completions endpoint, used unless LLM_BASE_URL points elsewhere
+const openAIChatCompletionsURL = "https://api.openai.com/v1/chat/completions"
+
+// Chat completions endpoint of the configured OpenAI-compatible API, e.g.
+// OpenRouter, LM Studio, vLLM or Groq when LLM_BASE_URL is set
+func (agent *WeatherAgent) openAIChatURL() string {
+	if agent.config.LLMBaseURL == "" {
+		return openAIChatCompletionsURL
+	}
+	return strings.TrimRight(agent.config.LLMBaseURL, "/") + "/chat/completions"
+}
+
+// Check LLM_BASE_URL is an absolute http(s) URL. Plain http is allowed for
+// local servers like LM Studio and vLLM.
+func validLLMBaseURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", rawURL)
+	}
+	return nil
+}
+
+// Parse "Name: value" header entries. Values may reference ${ENV_VARS}, so
+// gateway keys can stay out of the entry itself.
+func parseHeaderList(entries []string) (http.Header, error) {
+	header := http.Header{}
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("header %q should look like Name: value", entry)
+		}
+		header.Set(name, os.ExpandEnv(strings.TrimSpace(value)))
+	}
+	return header, nil
+}
+
+// Add LLM_EXTRA_HEADERS to an LLM request. Invalid entries are reported by
+// the config check at startup and skipped here.
+func (agent *WeatherAgent) setLLMExtraHeaders(header http.Header) {
+	extra, err := parseHeaderList(agent.config.LLMExtraHeaders)
+	if err != nil {
+		return
+	}
+	for name, values := range extra {
+		header[name] = values
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseHeaderList(t *testing.T) {
+	t.Setenv("GATEWAY_TITLE", "Weather Agent")
+	header, err := parseHeaderList([]string{"HTTP-Referer: https://weather.example.com", "X-Title: ${GATEWAY_TITLE}"})
+	if err != nil {
+		t.Fatalf("parseHeaderList() error: %v", err)
+	}
+	if header.Get("Http-Referer") != "https://weather.example.com" || header.Get("X-Title") != "Weather Agent" {
+		t.Errorf("header = %v", header)
+	}
+
+	for _, entry := range []string{"X-Title", ": value", "X Title: value"} {
+		if _, err := parseHeaderList([]string{entry}); err == nil {
+			t.Errorf("parseHeaderList(%q): expected error", entry)
+		}
+	}
+}
+
+func TestOpenAICompatibleGateway(t *testing.T) {
+	var path, auth, title string
+	handlers := defaultFixtures()
+	handlers["openrouter.ai"] = func(w http.ResponseWriter, r *http.Request) {
+		path, auth, title = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("X-Title")
+		serveJSON(fixtureOpenAI)(w, r)
+	}
+	useFixtures(t, handlers)
+
+	agent := newFixtureAgent(t, Config{
+		LLMProvider:     "openai",
+		LLMAPIKey:       "sk-or-test",
+		LLMBaseURL:      "https://openrouter.ai/api/v1/",
+		LLMExtraHeaders: []string{"X-Title: Weather Agent"},
+	})
+	message, _, err := agent.callOpenAIAPI("system", "user", agent.llmParams())
+	if err != nil || message != "Partly cloudy and mild in Oslo." {
+		t.Fatalf("callOpenAIAPI() = %q, %v", message, err)
+	}
+	if path != "/api/v1/chat/completions" || auth != "Bearer sk-or-test" || title != "Weather Agent" {
+		t.Errorf("request path %q, auth %q, X-Title %q", path, auth, title)
+	}
+
+	// Local servers need no key
+	agent.config.LLMAPIKey = ""
+	if _, _, err := agent.callOpenAIAPI("system", "user", agent.llmParams()); err != nil || auth != "" {
+		t.Errorf("keyless request: auth %q, error %v", auth, err)
+	}
+	if !agent.llmConfigured() {
+		t.Error("llmConfigured() = false with a base URL and no key")
+	}
+
+	agent.config.LLMBaseURL = ""
+	if got := agent.openAIChatURL(); got != openAIChatCompletionsURL {
+		t.Errorf("openAIChatURL() without a base URL = %q", got)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Limits on the sampling settings, from the OpenAI API's ranges
+const (
+	maxLLMMaxTokens     = 4096
+	maxLLMStopSequences = 4
+	maxLLMPenalty       = 2.0
+)
+
+// Model and sampling settings sent with each LLM request. Anthropic has no
+// penalties, so they're left out of its requests.
+type llmParams struct {
+	Model            string
+	MaxTokens        int
+	Stop             []string
+	TopP             float64 // 0 leaves the provider's default
+	FrequencyPenalty float64
+	PresencePenalty  float64
+}
+
+// The configured settings, used unless a request overrides them
+func (agent *WeatherAgent) llmParams() llmParams {
+	return llmParams{
+		Model:            agent.config.LLMModel,
+		MaxTokens:        agent.config.LLMMaxTokens,
+		Stop:             agent.config.LLMStop,
+		TopP:             agent.config.LLMTopP,
+		FrequencyPenalty: agent.config.LLMFrequencyPenalty,
+		PresencePenalty:  agent.config.LLMPresencePenalty,
+	}
+}
+
+// Check the settings are within what the providers accept, naming the first
+// field that isn't
+func (p llmParams) validate() (string, error) {
+	switch {
+	case p.MaxTokens < 1 || p.MaxTokens > maxLLMMaxTokens:
+		return "max_tokens", fmt.Errorf("%d is outside 1-%d", p.MaxTokens, maxLLMMaxTokens)
+	case len(p.Stop) > maxLLMStopSequences:
+		return "stop", fmt.Errorf("%d stop sequences given, at most %d allowed", len(p.Stop), maxLLMStopSequences)
+	case p.TopP < 0 || p.TopP > 1:
+		return "top_p", fmt.Errorf("%g is outside 0-1", p.TopP)
+	case p.FrequencyPenalty < -maxLLMPenalty || p.FrequencyPenalty > maxLLMPenalty:
+		return "frequency_penalty", fmt.Errorf("%g is outside -2 to 2", p.FrequencyPenalty)
+	case p.PresencePenalty < -maxLLMPenalty || p.PresencePenalty > maxLLMPenalty:
+		return "presence_penalty", fmt.Errorf("%g is outside -2 to 2", p.PresencePenalty)
+	}
+	for _, stop := range p.Stop {
+		if stop == "" {
+			return "stop", fmt.Errorf("stop sequences can't be empty")
+		}
+	}
+	return "", nil
+}
+
+// Add the settings to a request body under the provider's field names
+func (p llmParams) addTo(body map[string]interface{}, provider string) {
+	body["max_tokens"] = p.MaxTokens
+	switch provider {
+	case "anthropic":
+		if len(p.Stop) > 0 {
+			body["stop_sequences"] = p.Stop
+		}
+		if p.TopP > 0 {
+			body["top_p"] = p.TopP
+		}
+		return
+	case "cohere":
+		if len(p.Stop) > 0 {
+			body["stop_sequences"] = p.Stop
+		}
+		if p.TopP > 0 {
+			body["p"] = p.TopP
+		}
+	default:
+		if len(p.Stop) > 0 {
+			body["stop"] = p.Stop
+		}
+		if p.TopP > 0 {
+			body["top_p"] = p.TopP
+		}
+	}
+	if p.FrequencyPenalty != 0 {
+		body["frequency_penalty"] = p.FrequencyPenalty
+	}
+	if p.PresencePenalty != 0 {
+		body["presence_penalty"] = p.PresencePenalty
+	}
+}
+
+// Suffix distinguishing cached messages generated with other settings
+func (p llmParams) cacheKey() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%q|%g|%g|%g", p.Model, p.MaxTokens, p.Stop, p.TopP, p.FrequencyPenalty, p.PresencePenalty)))
+	return hex.EncodeToString(sum[:6])
+}
+
+func (p llmParams) equal(other llmParams) bool {
+	if p.Model != other.Model || p.MaxTokens != other.MaxTokens || p.TopP != other.TopP ||
+		p.FrequencyPenalty != other.FrequencyPenalty || p.PresencePenalty != other.PresencePenalty ||
+		len(p.Stop) != len(other.Stop) {
+		return false
+	}
+	for i := range p.Stop {
+		if p.Stop[i] != other.Stop[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Per-request changes to the configured settings; nil fields keep the
+// configured value. Decoded from the chat endpoint's JSON body.
+type llmParamOverrides struct {
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+}
+
+// Overrides from query parameters like ?max_tokens=200&top_p=0.9&stop=END,
+// with stop repeated for several sequences
+func parseLLMParamQuery(query url.Values) (llmParamOverrides, error) {
+	var o llmParamOverrides
+	if value := query.Get("max_tokens"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return o, fmt.Errorf("invalid max_tokens %q", value)
+		}
+		o.MaxTokens = &n
+	}
+	floats := []struct {
+		name  string
+		field **float64
+	}{
+		{"top_p", &o.TopP},
+		{"frequency_penalty", &o.FrequencyPenalty},
+		{"presence_penalty", &o.PresencePenalty},
+	}
+	for _, f := range floats {
+		value := query.Get(f.name)
+		if value == "" {
+			continue
+		}
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return o, fmt.Errorf("invalid %s %q", f.name, value)
+		}
+		*f.field = &x
+	}
+	o.Stop = query["stop"]
+	return o, nil
+}
+
+// The configured settings with the overrides applied, or an error naming an
+// override out of range
+func (agent *WeatherAgent) llmParamsWith(o llmParamOverrides) (llmParams, error) {
+	p := agent.llmParams()
+	if o.MaxTokens != nil {
+		p.MaxTokens = *o.MaxTokens
+	}
+	if o.Stop != nil {
+		p.Stop = o.Stop
+	}
+	if o.TopP != nil {
+		p.TopP = *o.TopP
+	}
+	if o.FrequencyPenalty != nil {
+		p.FrequencyPenalty = *o.FrequencyPenalty
+	}
+	if o.PresencePenalty != nil {
+		p.PresencePenalty = *o.PresencePenalty
+	}
+	if field, err := p.validate(); err != nil {
+		return p, fmt.Errorf("invalid %s: %v", field, err)
+	}
+	return p, nil
+}
+
+// Sampling settings for a request: the configured ones with any query
+// parameter overrides
+func (agent *WeatherAgent) requestLLMParams(r *http.Request) (llmParams, error) {
+	overrides, err := parseLLMParamQuery(r.URL.Query())
+	if err != nil {
+		return llmParams{}, err
+	}
+	return agent.llmParamsWith(overrides)
+}
+
+// Parse LLM_STOP, where sequences are separated by semicolons and \n stands
+// for a newline
+func parseStopSequences(value string) []string {
+	var stops []string
+	for _, stop := range strings.Split(value, ";") {
+		if stop = strings.TrimSpace(stop); stop != "" {
+			stops = append(stops, strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(stop))
+		}
+	}
+	return stops
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLLMParamsAddTo(t *testing.T) {
+	params := llmParams{MaxTokens: 200, Stop: []string{"END"}, TopP: 0.9, FrequencyPenalty: 0.5, PresencePenalty: -0.5}
+	tests := []struct {
+		provider string
+		want     string
+	}{
+		{"anthropic", `{"max_tokens":200,"stop_sequences":["END"],"top_p":0.9}`},
+		{"openai", `{"frequency_penalty":0.5,"max_tokens":200,"presence_penalty":-0.5,"stop":["END"],"top_p":0.9}`},
+		{"mistral", `{"frequency_penalty":0.5,"max_tokens":200,"presence_penalty":-0.5,"stop":["END"],"top_p":0.9}`},
+		{"cohere", `{"frequency_penalty":0.5,"max_tokens":200,"p":0.9,"presence_penalty":-0.5,"stop_sequences":["END"]}`},
+	}
+	for _, tt := range tests {
+		body := map[string]interface{}{}
+		params.addTo(body, tt.provider)
+		got, _ := json.Marshal(body)
+		if string(got) != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.provider, got, tt.want)
+		}
+	}
+
+	body := map[string]interface{}{}
+	llmParams{MaxTokens: 500}.addTo(body, "openai")
+	if got, _ := json.Marshal(body); string(got) != `{"max_tokens":500}` {
+		t.Errorf("defaults body = %s, want only max_tokens", got)
+	}
+}
+
+func TestLLMParamsWith(t *testing.T) {
+	agent := newFixtureAgent(t, Config{LLMTopP: 0.8})
+	tests := []struct {
+		name    string
+		query   string
+		want    llmParams
+		wantErr string
+	}{
+		{"no overrides", "", llmParams{MaxTokens: 500, TopP: 0.8}, ""},
+		{"all overrides", "max_tokens=120&stop=END&stop=%0A%0A&top_p=0.5&frequency_penalty=1&presence_penalty=-1",
+			llmParams{MaxTokens: 120, Stop: []string{"END", "\n\n"}, TopP: 0.5, FrequencyPenalty: 1, PresencePenalty: -1}, ""},
+		{"zero penalty kept", "frequency_penalty=0", llmParams{MaxTokens: 500, TopP: 0.8}, ""},
+		{"max tokens too high", "max_tokens=50000", llmParams{}, "max_tokens"},
+		{"max tokens not a number", "max_tokens=lots", llmParams{}, "max_tokens"},
+		{"top_p above one", "top_p=1.5", llmParams{}, "top_p"},
+		{"penalty out of range", "presence_penalty=3", llmParams{}, "presence_penalty"},
+		{"too many stops", "stop=a&stop=b&stop=c&stop=d&stop=e", llmParams{}, "stop"},
+		{"empty stop", "stop=", llmParams{}, "stop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			overrides, err := parseLLMParamQuery(query)
+			var got llmParams
+			if err == nil {
+				got, err = agent.llmParamsWith(overrides)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !got.equal(tt.want) {
+				t.Errorf("params = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMParamOverridesReachProvider(t *testing.T) {
+	llm := &fakeLLM{reply: "Mild and dry."}
+	agent := newFixtureAgent(t, Config{})
+	agent.llm = llm
+
+	var req struct {
+		Message string `json:"message"`
+		llmParamOverrides
+	}
+	if err := json.Unmarshal([]byte(`{"message":"Umbrella?","max_tokens":64,"stop":["\n"]}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	params, err := agent.llmParamsWith(req.llmParamOverrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.chat(WeatherResponse{Name: "Oslo"}, req.Message, "", params); err != nil {
+		t.Fatal(err)
+	}
+	if llm.params.MaxTokens != 64 || len(llm.params.Stop) != 1 || llm.params.Stop[0] != "\n" {
+		t.Errorf("provider got %+v, want the request's overrides", llm.params)
+	}
+
+	weather := WeatherResponse{Name: "Oslo"}
+	if agent.llmCacheKey(weather, "", params) == agent.llmCacheKey(weather, "", agent.llmParams()) {
+		t.Error("messages generated with overrides share the default cache key")
+	}
+}
+
+func TestParseStopSequences(t *testing.T) {
+	got := parseStopSequences(`END; \n\n ;`)
+	if len(got) != 2 || got[0] != "END" || got[1] != "\n\n" {
+		t.Errorf("parseStopSequences() = %q", got)
+	}
+}
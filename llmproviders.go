@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Chat endpoints of the providers without an OpenAI-style base URL setting
+const (
+	mistralChatURL = "https://api.mistral.ai/v1/chat/completions"
+	cohereChatURL  = "https://api.cohere.com/v2/chat"
+)
+
+// LLM_PROVIDER values
+var llmProviders = []string{"anthropic", "openai", "mistral", "cohere"}
+
+// Default model per provider when LLM_MODEL doesn't look like one of its own
+var defaultLLMModels = map[string]struct {
+	Model  string
+	Prefix string // Substring the provider's model names contain
+}{
+	"mistral": {"mistral-small-latest", "mistral"},
+	"cohere":  {"command-r-08-2024", "command"},
+}
+
+// Whether the provider's tool calling is implemented; the others get all the
+// data up front even with LLM_TOOLS on
+func llmToolsSupported(provider string) bool {
+	switch strings.ToLower(provider) {
+	case "anthropic", "openai", "mistral":
+		return true
+	}
+	return false
+}
+
+// Whether to let the LLM fetch data through tools
+func (agent *WeatherAgent) useLLMTools() bool {
+	return agent.config.LLMTools && llmToolsSupported(agent.config.LLMProvider)
+}
+
+// Call Mistral AI, whose chat API follows OpenAI's format
+func (agent *WeatherAgent) callMistralAPI(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	return agent.callChatCompletions("mistral", mistralChatURL, systemPrompt, userMessage, params)
+}
+
+// Call Cohere's v2 chat API
+func (agent *WeatherAgent) callCohereAPI(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	reqBody := map[string]interface{}{
+		"model": params.Model,
+		"messages": []OpenAIMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userMessage},
+		},
+		"temperature": agent.config.LLMTemperature,
+	}
+	params.addTo(reqBody, "cohere")
+	body, err := agent.postLLM("cohere", cohereChatURL, map[string]string{
+		"Authorization": "Bearer " + agent.config.LLMAPIKey,
+	}, reqBody)
+	if err != nil {
+		return "", llmUsage{}, err
+	}
+	return parseCohereResponse(body)
+}
+
+// Text and token usage from a Cohere v2 chat response
+func parseCohereResponse(body []byte) (string, llmUsage, error) {
+	var result struct {
+		Message struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"message"`
+		Usage struct {
+			Tokens struct {
+				InputTokens  float64 `json:"input_tokens"`
+				OutputTokens float64 `json:"output_tokens"`
+			} `json:"tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", llmUsage{}, err
+	}
+
+	usage := llmUsage{InputTokens: int(result.Usage.Tokens.InputTokens), OutputTokens: int(result.Usage.Tokens.OutputTokens)}
+	var text strings.Builder
+	for _, block := range result.Message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", usage, fmt.Errorf("no content in response: %s", string(body))
+	}
+	return text.String(), usage, nil
+}
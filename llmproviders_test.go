@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const fixtureCohere = `{"id":"c14c80c3","finish_reason":"COMPLETE","message":{"role":"assistant",
+	"content":[{"type":"text","text":"Partly cloudy and mild in Oslo."}]},
+	"usage":{"billed_units":{"input_tokens":118,"output_tokens":9},"tokens":{"input_tokens":190,"output_tokens":9}}}`
+
+func TestMistralAndCohereProviders(t *testing.T) {
+	requests := map[string]map[string]interface{}{}
+	capture := func(name, fixture string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			body["authorization"] = r.Header.Get("Authorization")
+			body["path"] = r.URL.Path
+			requests[name] = body
+			serveJSON(fixture)(w, r)
+		}
+	}
+	handlers := defaultFixtures()
+	handlers["api.mistral.ai"] = capture("mistral", fixtureOpenAI)
+	handlers["api.cohere.com"] = capture("cohere", fixtureCohere)
+	useFixtures(t, handlers)
+
+	tests := []struct {
+		provider, model, path string
+		wantOutputTokens      int
+	}{
+		{"mistral", "mistral-small-latest", "/v1/chat/completions", 12},
+		{"cohere", "command-r-08-2024", "/v2/chat", 9},
+	}
+	for _, tt := range tests {
+		agent := newFixtureAgent(t, Config{LLMProvider: tt.provider, LLMModel: tt.model, LLMAPIKey: tt.provider + "-key"})
+		provider, err := agent.llmClient()
+		if err != nil {
+			t.Fatalf("%s: llmClient() error: %v", tt.provider, err)
+		}
+		message, usage, err := provider.complete("You are a weather assistant.", "How's the weather?", agent.llmParams())
+		if err != nil || message != "Partly cloudy and mild in Oslo." || usage.OutputTokens != tt.wantOutputTokens {
+			t.Errorf("%s: complete() = %q, %+v, %v", tt.provider, message, usage, err)
+		}
+
+		req := requests[tt.provider]
+		if req["path"] != tt.path || req["authorization"] != "Bearer "+tt.provider+"-key" || req["model"] != tt.model {
+			t.Errorf("%s request = %v", tt.provider, req)
+		}
+		if messages, _ := req["messages"].([]interface{}); len(messages) != 2 {
+			t.Errorf("%s messages = %v, want system and user", tt.provider, req["messages"])
+		}
+	}
+}
+
+func TestParseCohereResponse(t *testing.T) {
+	if _, _, err := parseCohereResponse([]byte(`{"message":{"role":"assistant","content":[]}}`)); err == nil {
+		t.Error("parseCohereResponse() without text: expected error")
+	}
+}
+
+func TestLLMToolsSupported(t *testing.T) {
+	for provider, want := range map[string]bool{"anthropic": true, "openai": true, "mistral": true, "cohere": false} {
+		if got := llmToolsSupported(provider); got != want {
+			t.Errorf("llmToolsSupported(%q) = %v, want %v", provider, got, want)
+		}
+	}
+}
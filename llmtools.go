@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Tool-use settings
+const (
+	maxToolRounds       = 5  // Model turns before giving up on a final answer
+	maxToolHistoryItems = 48 // Observations returned by get_history
+)
+
+// Data keys get_air_quality returns rather than get_conditions
+var airQualityKeys = []string{"aqi", "aqi_description", "aqi_source", "pollutant_name", "pollutant_value",
+	"pm2_5", "pm10", "o3", "no2", "so2", "co", "air_quality_guidance", "pollen", "active_fires", "smoke_risk"}
+
+// A function the LLM can call to fetch data
+type llmTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema of the input object
+	Run         func(input json.RawMessage) (string, error)
+}
+
+// A tool call requested by the model
+type toolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// A provider-specific conversation with tools. send returns the model's text
+// when it's done, or the tool calls it wants answered first.
+type toolConversation interface {
+	send() (string, []toolCall, llmUsage, error)
+	addResults(calls []toolCall, results []string)
+}
+
+// Object schema with the given properties, none required
+func objectSchema(properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// Tools over a location's current weather: conditions, air quality,
+// the daily forecast and stored observations
+func (agent *WeatherAgent) weatherTools(weather WeatherResponse) []llmTool {
+	var data map[string]interface{}
+	weatherData := func() map[string]interface{} {
+		if data == nil {
+			data = agent.prepareWeatherData(weather)
+		}
+		return data
+	}
+
+	return []llmTool{
+		{
+			Name:        "get_conditions",
+			Description: "Current conditions at the location: temperature, feels-like, humidity, wind, precipitation, UV, astronomy and any alerts or extra sources.",
+			Parameters:  objectSchema(map[string]interface{}{}),
+			Run: func(json.RawMessage) (string, error) {
+				conditions := make(map[string]interface{})
+				for key, value := range weatherData() {
+					conditions[key] = value
+				}
+				for _, key := range airQualityKeys {
+					delete(conditions, key)
+				}
+				return toolJSON(conditions)
+			},
+		},
+		{
+			Name:        "get_air_quality",
+			Description: "Air quality index, pollutant concentrations, pollen and wildfire smoke risk at the location.",
+			Parameters:  objectSchema(map[string]interface{}{}),
+			Run: func(json.RawMessage) (string, error) {
+				airQuality := make(map[string]interface{})
+				for _, key := range airQualityKeys {
+					if value, ok := weatherData()[key]; ok {
+						airQuality[key] = value
+					}
+				}
+				if len(airQuality) == 0 {
+					return "No air quality data is available for this location.", nil
+				}
+				return toolJSON(airQuality)
+			},
+		},
+		{
+			Name:        "get_forecast",
+			Description: "Daily forecast: high, low, conditions, precipitation probability, sunrise and sunset.",
+			Parameters: objectSchema(map[string]interface{}{
+				"days": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 7, "description": "Days to forecast, starting today (default 3)"},
+			}),
+			Run: func(input json.RawMessage) (string, error) {
+				var args struct {
+					Days int `json:"days"`
+				}
+				json.Unmarshal(input, &args)
+				if args.Days < 1 || args.Days > 7 {
+					args.Days = 3
+				}
+				forecast, err := agent.fetchForecast(weather.Coord.Lat, weather.Coord.Lon, args.Days)
+				if err != nil {
+					return "", err
+				}
+				return toolJSON(forecast.Days)
+			},
+		},
+		{
+			Name:        "get_history",
+			Description: "Observations recorded at the location over the past hours, oldest first, to describe how conditions have changed.",
+			Parameters: objectSchema(map[string]interface{}{
+				"hours": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 168, "description": "Hours to look back (default 24)"},
+			}),
+			Run: func(input json.RawMessage) (string, error) {
+				var args struct {
+					Hours int `json:"hours"`
+				}
+				json.Unmarshal(input, &args)
+				if args.Hours < 1 || args.Hours > 168 {
+					args.Hours = 24
+				}
+				if agent.observations == nil {
+					return "No observations have been recorded.", nil
+				}
+				observations, err := agent.observations.since(time.Now().Add(-time.Duration(args.Hours)*time.Hour), weather.Name)
+				if err != nil {
+					return "", err
+				}
+				if len(observations) == 0 {
+					return "No observations have been recorded in that period.", nil
+				}
+				return toolJSON(thinObservations(observations, maxToolHistoryItems))
+			},
+		},
+	}
+}
+
+// Encode a tool result as JSON
+func toolJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Evenly spaced observations, at most max of them, always keeping the latest
+func thinObservations(observations []Observation, max int) []Observation {
+	if len(observations) <= max {
+		return observations
+	}
+	thinned := make([]Observation, 0, max)
+	step := float64(len(observations)-1) / float64(max-1)
+	for i := 0; i < max; i++ {
+		thinned = append(thinned, observations[int(float64(i)*step+0.5)])
+	}
+	return thinned
+}
+
+// Run the conversation until the model answers, executing its tool calls in
+// between. Tool errors are passed back to the model rather than aborting.
+func (agent *WeatherAgent) runToolLoop(conv toolConversation, tools []llmTool) (string, llmUsage, error) {
+	byName := make(map[string]llmTool, len(tools))
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+
+	var total llmUsage
+	for round := 0; round < maxToolRounds; round++ {
+		if round > 0 && agent.overBudget() {
+			return "", total, errLLMBudgetExceeded
+		}
+		text, calls, usage, err := conv.send()
+		if usage.InputTokens > 0 || usage.OutputTokens > 0 {
+			agent.recordLLMUsage(usage)
+			total.InputTokens += usage.InputTokens
+			total.OutputTokens += usage.OutputTokens
+		}
+		if err != nil {
+			return "", total, err
+		}
+		if len(calls) == 0 {
+			return text, total, nil
+		}
+
+		results := make([]string, len(calls))
+		for i, call := range calls {
+			tool, ok := byName[call.Name]
+			if !ok {
+				results[i] = fmt.Sprintf("Error: unknown tool %q", call.Name)
+				continue
+			}
+			result, err := tool.Run(call.Input)
+			if err != nil {
+				agent.logger.Printf("Tool %s failed: %v", call.Name, err)
+				result = "Error: " + err.Error()
+			}
+			results[i] = result
+		}
+		conv.addResults(calls, results)
+	}
+	return "", total, fmt.Errorf("no answer after %d tool rounds", maxToolRounds)
+}
+
+// Like callLLMAs, but lets the model call tools for the data it needs
+func (agent *WeatherAgent) callLLMWithTools(persona, userMessage string, tools []llmTool, params llmParams) (string, error) {
+	if !agent.llmConfigured() {
+		return "", errNoLLMKey
+	}
+	if agent.overBudget() {
+		return "", errLLMBudgetExceeded
+	}
+	breaker := agent.breakers.get("llm")
+	if !breaker.allow() {
+		return "", errCircuitOpen
+	}
+	systemPrompt := agent.systemPrompt(persona)
+
+	var conv toolConversation
+	switch strings.ToLower(agent.config.LLMProvider) {
+	case "anthropic":
+		conv = agent.newAnthropicToolConversation(systemPrompt, userMessage, tools, params)
+	case "openai":
+		conv = agent.newOpenAIToolConversation(systemPrompt, userMessage, tools, params)
+	case "mistral":
+		// Mistral's function calling follows OpenAI's
+		openAI := agent.newOpenAIToolConversation(systemPrompt, userMessage, tools, params)
+		openAI.url, openAI.provider = mistralChatURL, "mistral"
+		conv = openAI
+	default:
+		return "", fmt.Errorf("unsupported LLM provider: %s", agent.config.LLMProvider)
+	}
+
+	started := time.Now()
+	message, usage, err := agent.runToolLoop(conv, tools)
+	agent.logPrompt(PromptRecord{
+		Model:        params.Model,
+		SystemPrompt: systemPrompt,
+		UserMessage:  userMessage,
+		Response:     message,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		Tools:        true,
+	}, started, err)
+	if err != nil {
+		if err != errLLMBudgetExceeded {
+			breaker.failure()
+		}
+		return "", err
+	}
+	breaker.success()
+	return agent.guardLLMOutput(message), nil
+}
+
+// POST a JSON request to an LLM provider and return the body, archiving it
+func (agent *WeatherAgent) postLLM(provider, url string, headers map[string]string, reqBody interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	agent.setLLMExtraHeaders(req.Header)
+
+	client := agent.httpClient(llmHTTPTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	agent.archiveResponse(provider, url, resp.StatusCode, bodyBytes)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+	return bodyBytes, nil
+}
+
+// Anthropic Messages API conversation with tool use
+type anthropicToolConversation struct {
+	agent    *WeatherAgent
+	url      string
+	system   string
+	params   llmParams
+	tools    []map[string]interface{}
+	messages []map[string]interface{}
+}
+
+func (agent *WeatherAgent) newAnthropicToolConversation(systemPrompt, userMessage string, tools []llmTool, params llmParams) *anthropicToolConversation {
+	conv := &anthropicToolConversation{
+		agent:    agent,
+		url:      "https://api.anthropic.com/v1/messages",
+		system:   systemPrompt,
+		params:   params,
+		messages: []map[string]interface{}{{"role": "user", "content": userMessage}},
+	}
+	for _, tool := range tools {
+		conv.tools = append(conv.tools, map[string]interface{}{
+			"name":         tool.Name,
+			"description":  tool.Description,
+			"input_schema": tool.Parameters,
+		})
+	}
+	return conv
+}
+
+func (c *anthropicToolConversation) send() (string, []toolCall, llmUsage, error) {
+	reqBody := map[string]interface{}{
+		"model":       c.params.Model,
+		"system":      c.system,
+		"messages":    c.messages,
+		"tools":       c.tools,
+		"temperature": c.agent.config.LLMTemperature,
+	}
+	c.params.addTo(reqBody, "anthropic")
+	body, err := c.agent.postLLM("anthropic", c.url, map[string]string{
+		"x-api-key":         c.agent.config.LLMAPIKey,
+		"anthropic-version": "2023-06-01",
+	}, reqBody)
+	if err != nil {
+		return "", nil, llmUsage{}, err
+	}
+
+	var result struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text,omitempty"`
+			ID    string          `json:"id,omitempty"`
+			Name  string          `json:"name,omitempty"`
+			Input json.RawMessage `json:"input,omitempty"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", nil, llmUsage{}, fmt.Errorf("Error parsing response: %v", err)
+	}
+	usage := llmUsage{InputTokens: result.Usage.InputTokens, OutputTokens: result.Usage.OutputTokens}
+
+	var text strings.Builder
+	var calls []toolCall
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			calls = append(calls, toolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	if len(calls) > 0 {
+		// The assistant turn must be sent back verbatim alongside the results
+		c.messages = append(c.messages, map[string]interface{}{"role": "assistant", "content": result.Content})
+	} else if text.Len() == 0 {
+		return "", nil, usage, fmt.Errorf("no content in response: %s", string(body))
+	}
+	return text.String(), calls, usage, nil
+}
+
+func (c *anthropicToolConversation) addResults(calls []toolCall, results []string) {
+	blocks := make([]map[string]interface{}, len(calls))
+	for i, call := range calls {
+		blocks[i] = map[string]interface{}{"type": "tool_result", "tool_use_id": call.ID, "content": results[i]}
+	}
+	c.messages = append(c.messages, map[string]interface{}{"role": "user", "content": blocks})
+}
+
+// OpenAI Chat Completions conversation with function calling
+type openAIToolConversation struct {
+	agent    *WeatherAgent
+	url      string
+	provider string // For the archive; "openai" unless a compatible API is used
+	params   llmParams
+	tools    []map[string]interface{}
+	messages []interface{}
+}
+
+func (agent *WeatherAgent) newOpenAIToolConversation(systemPrompt, userMessage string, tools []llmTool, params llmParams) *openAIToolConversation {
+	conv := &openAIToolConversation{
+		agent:    agent,
+		url:      agent.openAIChatURL(),
+		provider: "openai",
+		params:   params,
+		messages: []interface{}{
+			OpenAIMessage{Role: "system", Content: systemPrompt},
+			OpenAIMessage{Role: "user", Content: userMessage},
+		},
+	}
+	for _, tool := range tools {
+		conv.tools = append(conv.tools, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  tool.Parameters,
+			},
+		})
+	}
+	return conv
+}
+
+func (c *openAIToolConversation) send() (string, []toolCall, llmUsage, error) {
+	headers := map[string]string{}
+	if c.agent.config.LLMAPIKey != "" {
+		headers["Authorization"] = "Bearer " + c.agent.config.LLMAPIKey
+	}
+	reqBody := map[string]interface{}{
+		"model":       c.params.Model,
+		"messages":    c.messages,
+		"tools":       c.tools,
+		"temperature": c.agent.config.LLMTemperature,
+	}
+	c.params.addTo(reqBody, c.provider)
+	body, err := c.agent.postLLM(c.provider, c.url, headers, reqBody)
+	if err != nil {
+		return "", nil, llmUsage{}, err
+	}
+
+	var result struct {
+		Choices []struct {
+			Message json.RawMessage `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", nil, llmUsage{}, err
+	}
+	usage := llmUsage{InputTokens: result.Usage.PromptTokens, OutputTokens: result.Usage.CompletionTokens}
+	if len(result.Choices) == 0 {
+		return "", nil, usage, fmt.Errorf("no content in response")
+	}
+
+	var message struct {
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"` // JSON-encoded object
+			} `json:"function"`
+		} `json:"tool_calls"`
+	}
+	if err := json.Unmarshal(result.Choices[0].Message, &message); err != nil {
+		return "", nil, usage, err
+	}
+
+	var calls []toolCall
+	for _, tc := range message.ToolCalls {
+		calls = append(calls, toolCall{ID: tc.ID, Name: tc.Function.Name, Input: json.RawMessage(tc.Function.Arguments)})
+	}
+	if len(calls) > 0 {
+		// The assistant turn must be sent back verbatim alongside the results
+		c.messages = append(c.messages, result.Choices[0].Message)
+	}
+	return message.Content, calls, usage, nil
+}
+
+func (c *openAIToolConversation) addResults(calls []toolCall, results []string) {
+	for i, call := range calls {
+		c.messages = append(c.messages, map[string]interface{}{"role": "tool", "tool_call_id": call.ID, "content": results[i]})
+	}
+}
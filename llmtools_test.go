@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Scripted conversation: returns the queued turns in order and records results
+type fakeConversation struct {
+	turns   [][]toolCall
+	final   string
+	results [][]string
+}
+
+func (c *fakeConversation) send() (string, []toolCall, llmUsage, error) {
+	if len(c.results) < len(c.turns) {
+		return "", c.turns[len(c.results)], llmUsage{InputTokens: 10, OutputTokens: 5}, nil
+	}
+	return c.final, nil, llmUsage{InputTokens: 10, OutputTokens: 5}, nil
+}
+
+func (c *fakeConversation) addResults(calls []toolCall, results []string) {
+	c.results = append(c.results, results)
+}
+
+func newToolTestAgent() *WeatherAgent {
+	return &WeatherAgent{logger: log.New(io.Discard, "", 0), cache: newMemoryCache()}
+}
+
+func TestRunToolLoop(t *testing.T) {
+	agent := newToolTestAgent()
+	tools := []llmTool{{
+		Name: "get_forecast",
+		Run: func(input json.RawMessage) (string, error) {
+			var args struct{ Days int }
+			json.Unmarshal(input, &args)
+			return strings.Repeat("sunny ", args.Days), nil
+		},
+	}}
+
+	conv := &fakeConversation{
+		turns: [][]toolCall{{
+			{ID: "1", Name: "get_forecast", Input: json.RawMessage(`{"days":2}`)},
+			{ID: "2", Name: "get_horoscope", Input: json.RawMessage(`{}`)},
+		}},
+		final: "Sunny for two days.",
+	}
+	message, _, err := agent.runToolLoop(conv, tools)
+	if err != nil || message != "Sunny for two days." {
+		t.Fatalf("runToolLoop() = %q, %v", message, err)
+	}
+	if len(conv.results) != 1 || conv.results[0][0] != "sunny sunny " || !strings.Contains(conv.results[0][1], "unknown tool") {
+		t.Errorf("tool results = %q", conv.results)
+	}
+	if totals := agent.usageTotals(usageDate(time.Now())); totals.Requests != 2 || totals.TotalTokens != 30 {
+		t.Errorf("usage = %+v, want 2 requests and 30 tokens", totals)
+	}
+
+	// A model that never stops calling tools gives up after maxToolRounds
+	endless := &fakeConversation{}
+	for i := 0; i <= maxToolRounds; i++ {
+		endless.turns = append(endless.turns, []toolCall{{ID: "x", Name: "get_forecast"}})
+	}
+	if _, _, err := agent.runToolLoop(endless, tools); err == nil {
+		t.Error("runToolLoop() with endless tool calls: expected error")
+	}
+}
+
+func TestAnthropicToolConversation(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			io.WriteString(w, `{"content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"tu_1","name":"get_air_quality","input":{}}],"usage":{"input_tokens":100,"output_tokens":20}}`)
+			return
+		}
+		io.WriteString(w, `{"content":[{"type":"text","text":"Air is clean."}],"usage":{"input_tokens":150,"output_tokens":10}}`)
+	}))
+	defer server.Close()
+
+	agent := newToolTestAgent()
+	agent.config.LLMModel = "claude-test"
+	tools := []llmTool{{Name: "get_air_quality", Parameters: objectSchema(map[string]interface{}{}), Run: func(json.RawMessage) (string, error) {
+		return `{"aqi":12}`, nil
+	}}}
+	conv := agent.newAnthropicToolConversation("system", "How is the air?", tools, agent.llmParams())
+	conv.url = server.URL
+
+	message, _, err := agent.runToolLoop(conv, tools)
+	if err != nil || message != "Air is clean." {
+		t.Fatalf("runToolLoop() = %q, %v", message, err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	if tools, _ := requests[0]["tools"].([]interface{}); len(tools) != 1 {
+		t.Errorf("first request tools = %v", requests[0]["tools"])
+	}
+
+	// The follow-up carries the assistant's tool_use turn and the tool result
+	messages, _ := requests[1]["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("follow-up has %d messages, want 3", len(messages))
+	}
+	result, _ := json.Marshal(messages[2])
+	if !strings.Contains(string(result), `"tool_use_id":"tu_1"`) || !strings.Contains(string(result), `{\"aqi\":12}`) {
+		t.Errorf("tool result message = %s", result)
+	}
+}
+
+func TestOpenAIToolConversation(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if calls == 1 {
+			io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_history","arguments":"{\"hours\":6}"}}]}}],"usage":{"prompt_tokens":50,"completion_tokens":8}}`)
+			return
+		}
+		if !strings.Contains(string(body), `"tool_call_id":"call_1"`) || !strings.Contains(string(body), `"tool_calls"`) {
+			t.Errorf("follow-up request missing the tool turn: %s", body)
+		}
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"Cooler than this morning."}}],"usage":{"prompt_tokens":80,"completion_tokens":6}}`)
+	}))
+	defer server.Close()
+
+	agent := newToolTestAgent()
+	var hours int
+	tools := []llmTool{{Name: "get_history", Parameters: objectSchema(map[string]interface{}{}), Run: func(input json.RawMessage) (string, error) {
+		var args struct{ Hours int }
+		json.Unmarshal(input, &args)
+		hours = args.Hours
+		return "[]", nil
+	}}}
+	conv := agent.newOpenAIToolConversation("system", "How has it changed?", tools, agent.llmParams())
+	conv.url = server.URL
+
+	message, _, err := agent.runToolLoop(conv, tools)
+	if err != nil || message != "Cooler than this morning." || hours != 6 {
+		t.Errorf("runToolLoop() = %q, %v (hours %d)", message, err, hours)
+	}
+}
+
+func TestThinObservations(t *testing.T) {
+	observations := make([]Observation, 100)
+	for i := range observations {
+		observations[i].Temp = float64(i)
+	}
+	thinned := thinObservations(observations, 10)
+	if len(thinned) != 10 || thinned[0].Temp != 0 || thinned[9].Temp != 99 {
+		t.Errorf("thinObservations() kept %d, first %.0f, last %.0f", len(thinned), thinned[0].Temp, thinned[len(thinned)-1].Temp)
+	}
+	if got := thinObservations(observations[:5], 10); len(got) != 5 {
+		t.Errorf("thinObservations() of a short series kept %d, want 5", len(got))
+	}
+}
+
+func TestWeatherToolsAirQualitySplit(t *testing.T) {
+	agent := newToolTestAgent()
+	agent.config.Units = "metric"
+	var weather WeatherResponse
+	weather.Name = "Leeds"
+	weather.IQAirData.AQI = 42
+
+	results := make(map[string]string)
+	for _, tool := range agent.weatherTools(weather) {
+		if tool.Name == "get_conditions" || tool.Name == "get_air_quality" {
+			result, err := tool.Run(nil)
+			if err != nil {
+				t.Fatalf("%s error = %v", tool.Name, err)
+			}
+			results[tool.Name] = result
+		}
+	}
+	if strings.Contains(results["get_conditions"], `"aqi"`) || !strings.Contains(results["get_air_quality"], `"aqi":42`) {
+		t.Errorf("conditions %s\nair quality %s", results["get_conditions"], results["get_air_quality"])
+	}
+}
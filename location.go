@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Number of readings kept per location for the LLM history context
+const maxLocationHistory = 24
+
+// Key identifying a location's state, e.g. "london|gb"
+func locationKey(city, country string) string {
+	return strings.ToLower(strings.TrimSpace(city)) + "|" + strings.ToLower(strings.TrimSpace(country))
+}
+
+// Key for the location a weather response describes
+func weatherLocationKey(weather WeatherResponse) string {
+	return locationKey(weather.Name, weather.Sys.Country)
+}
+
+// Recent readings for each location, so switching cities (or serving
+// requests for several coordinates) never mixes one place's history into
+// another's LLM context
+type locationHistory struct {
+	mu       sync.Mutex
+	readings map[string][]WeatherResponse
+}
+
+func newLocationHistory() *locationHistory {
+	return &locationHistory{readings: make(map[string][]WeatherResponse)}
+}
+
+// Add a reading to its location's history, keeping the most recent readings
+func (h *locationHistory) add(weather WeatherResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := weatherLocationKey(weather)
+	readings := append(h.readings[key], weather)
+	if len(readings) > maxLocationHistory {
+		readings = readings[len(readings)-maxLocationHistory:]
+	}
+	h.readings[key] = readings
+}
+
+// The reading before the latest one for a location, if there is one
+func (h *locationHistory) previous(key string) (WeatherResponse, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	readings := h.readings[key]
+	if len(readings) < 2 {
+		return WeatherResponse{}, false
+	}
+	return readings[len(readings)-2], true
+}
+
+// Latest reading of every location the agent has fetched, in key order
+func (h *locationHistory) latest() []WeatherResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.readings))
+	for key := range h.readings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	latest := make([]WeatherResponse, 0, len(keys))
+	for _, key := range keys {
+		readings := h.readings[key]
+		latest = append(latest, readings[len(readings)-1])
+	}
+	return latest
+}
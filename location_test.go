@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func locationWeather(city, country string, dt time.Time, temp float64) WeatherResponse {
+	var w WeatherResponse
+	w.Name = city
+	w.Sys.Country = country
+	w.Dt = dt.Unix()
+	w.Main.Temp = temp
+	w.Main.FeelsLike = temp
+	return w
+}
+
+func newLocationTestAgent() *WeatherAgent {
+	return &WeatherAgent{
+		config:         Config{Units: "metric"},
+		logger:         log.New(io.Discard, "", 0),
+		weatherHistory: newLocationHistory(),
+		cache:          newMemoryCache(),
+		observations:   &observationStore{},
+	}
+}
+
+func TestHistoryContextIsPerLocation(t *testing.T) {
+	agent := newLocationTestAgent()
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	// Alternate update cycles between two cities
+	london1 := locationWeather("London", "GB", start, 4)
+	paris1 := locationWeather("Paris", "FR", start.Add(time.Minute), 11)
+	london2 := locationWeather("London", "GB", start.Add(time.Hour), 6)
+	paris2 := locationWeather("Paris", "FR", start.Add(time.Hour+time.Minute), 12)
+
+	agent.recordWeather(london1)
+	if ctx := agent.generateHistoryContext(london1); ctx != "" {
+		t.Errorf("first London reading should have no history, got %q", ctx)
+	}
+
+	agent.recordWeather(paris1)
+	if ctx := agent.generateHistoryContext(paris1); ctx != "" {
+		t.Errorf("first Paris reading picked up another city's history: %q", ctx)
+	}
+
+	agent.recordWeather(london2)
+	ctx := agent.generateHistoryContext(london2)
+	if !strings.Contains(ctx, "4.0°C") || strings.Contains(ctx, "11.0°C") {
+		t.Errorf("London context should use the previous London reading, got %q", ctx)
+	}
+
+	agent.recordWeather(paris2)
+	ctx = agent.generateHistoryContext(paris2)
+	if !strings.Contains(ctx, "11.0°C") || strings.Contains(ctx, "6.0°C") {
+		t.Errorf("Paris context should use the previous Paris reading, got %q", ctx)
+	}
+}
+
+func TestLastMessageIsPerLocation(t *testing.T) {
+	agent := newLocationTestAgent()
+	london := locationKey("London", "GB")
+	paris := locationKey(" paris", "fr")
+
+	agent.setLastMessage(london, "Drizzly in London")
+	agent.setLastMessage(paris, "Sunny in Paris")
+
+	if got := agent.lastMessage(london).Message; got != "Drizzly in London" {
+		t.Errorf("London last message = %q", got)
+	}
+	if got := agent.lastMessage(locationKey("Paris", "FR")).Message; got != "Sunny in Paris" {
+		t.Errorf("Paris last message = %q", got)
+	}
+	if got := agent.lastMessage(locationKey("Berlin", "DE")).Message; got != "" {
+		t.Errorf("unknown location should have no last message, got %q", got)
+	}
+}
+
+func TestLocationHistoryIsBounded(t *testing.T) {
+	h := newLocationHistory()
+	start := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxLocationHistory+10; i++ {
+		h.add(locationWeather("Oslo", "NO", start.Add(time.Duration(i)*time.Hour), float64(i)))
+	}
+	if n := len(h.readings[locationKey("Oslo", "NO")]); n != maxLocationHistory {
+		t.Errorf("kept %d readings, want %d", n, maxLocationHistory)
+	}
+	prev, ok := h.previous(locationKey("Oslo", "NO"))
+	if !ok || prev.Main.Temp != float64(maxLocationHistory+8) {
+		t.Errorf("previous reading = %.0f, %v", prev.Main.Temp, ok)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix format of rotated log files, e.g. weather.log.20240601-000000
+const logBackupTimeFormat = "20060102-150405"
+
+// When log files are rotated and how long old ones are kept
+type LogRotationConfig struct {
+	MaxSizeMB   int // Rotate once the file reaches this size (0 for no limit)
+	RotateHours int // Rotate when a write falls in a new period of this many hours, counted from midnight UTC (0 to rotate by size only)
+	MaxBackups  int // Rotated files to keep (0 keeps all)
+	MaxAgeDays  int // Delete rotated files older than this (0 keeps them forever)
+}
+
+// An append-only log file that rotates itself by size and time, renaming the
+// current file with a timestamp suffix and pruning old backups. The file is
+// opened on the first write, so unused logs never create files.
+type rotatingFile struct {
+	path   string
+	config LogRotationConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+}
+
+func newRotatingFile(path string, config LogRotationConfig) *rotatingFile {
+	return &rotatingFile{path: path, config: config, now: time.Now}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.due(now, int64(len(p))) {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.lastWrite = now
+	return n, err
+}
+
+// Close the current file; the next write reopens it
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Open the log for appending, picking up the size and age of an existing file
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.lastWrite = file, info.Size(), info.ModTime()
+	return nil
+}
+
+// Whether writing n more bytes at now should go to a fresh file
+func (f *rotatingFile) due(now time.Time, n int64) bool {
+	if f.config.MaxSizeMB > 0 && f.size+n > int64(f.config.MaxSizeMB)<<20 {
+		return true
+	}
+	if f.config.RotateHours > 0 {
+		period := time.Duration(f.config.RotateHours) * time.Hour
+		return !now.Truncate(period).Equal(f.lastWrite.Truncate(period))
+	}
+	return false
+}
+
+// Move the current file aside and start a new one
+func (f *rotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.path + "." + now.Format(logBackupTimeFormat)
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s.%s-%d", f.path, now.Format(logBackupTimeFormat), i)
+	}
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	f.prune(now)
+	return f.open()
+}
+
+// Rotated files of this log, oldest first
+func (f *rotatingFile) backups() []string {
+	matches, _ := filepath.Glob(f.path + ".*")
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, f.path+".")
+		if len(suffix) < len(logBackupTimeFormat) {
+			continue
+		}
+		stamp, rest := suffix[:len(logBackupTimeFormat)], suffix[len(logBackupTimeFormat):]
+		if _, err := time.Parse(logBackupTimeFormat, stamp); err == nil && (rest == "" || rest[0] == '-') {
+			backups = append(backups, match)
+		}
+	}
+	// The timestamp suffix sorts chronologically
+	sort.Strings(backups)
+	return backups
+}
+
+// Delete backups beyond MaxBackups or older than MaxAgeDays
+func (f *rotatingFile) prune(now time.Time) {
+	backups := f.backups()
+	for i, backup := range backups {
+		expired := false
+		if f.config.MaxBackups > 0 && len(backups)-i > f.config.MaxBackups {
+			expired = true
+		}
+		if f.config.MaxAgeDays > 0 {
+			if info, err := os.Stat(backup); err == nil && now.Sub(info.ModTime()) > time.Duration(f.config.MaxAgeDays)*24*time.Hour {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
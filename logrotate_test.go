@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Contents of a log and its backups, oldest first
+func readLogFiles(t *testing.T, f *rotatingFile) []string {
+	t.Helper()
+	var contents []string
+	for _, path := range append(f.backups(), f.path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func TestRotatingFile(t *testing.T) {
+	start := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		config LogRotationConfig
+		writes []time.Duration // Offsets from start of each 1KB write
+		want   int             // Files afterwards, including the current one
+	}{
+		{"no limits", LogRotationConfig{}, []time.Duration{0, time.Hour, 48 * time.Hour}, 1},
+		{"by size", LogRotationConfig{MaxSizeMB: 1}, make([]time.Duration, 1500), 2},
+		{"daily", LogRotationConfig{RotateHours: 24}, []time.Duration{0, time.Hour, 3 * time.Hour, 27 * time.Hour}, 3},
+		{"same day", LogRotationConfig{RotateHours: 24}, []time.Duration{0, time.Minute, time.Hour}, 1},
+		{"max backups", LogRotationConfig{RotateHours: 1, MaxBackups: 2}, []time.Duration{0, time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRotatingFile(filepath.Join(t.TempDir(), "weather.log"), tt.config)
+			line := strings.Repeat("x", 1023) + "\n"
+			var now time.Time
+			f.now = func() time.Time { return now }
+			for _, offset := range tt.writes {
+				now = start.Add(offset)
+				if _, err := f.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f.Close()
+
+			contents := readLogFiles(t, f)
+			if len(contents) != tt.want {
+				t.Fatalf("got %d files, want %d", len(contents), tt.want)
+			}
+			total := 0
+			for _, content := range contents {
+				if tt.config.MaxSizeMB > 0 && len(content) > tt.config.MaxSizeMB<<20 {
+					t.Errorf("file of %d bytes is over the size limit", len(content))
+				}
+				total += len(content)
+			}
+			if tt.config.MaxBackups == 0 && total != len(line)*len(tt.writes) {
+				t.Errorf("got %d bytes in all, want %d", total, len(line)*len(tt.writes))
+			}
+		})
+	}
+}
+
+func TestRotatingFilePrunesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	f := newRotatingFile(filepath.Join(dir, "weather.log"), LogRotationConfig{RotateHours: 24, MaxAgeDays: 7})
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	old := filepath.Join(dir, "weather.log.20240501-000000")
+	recent := filepath.Join(dir, "weather.log.20240608-000000")
+	unrelated := filepath.Join(dir, "weather.log.bak")
+	for path, age := range map[string]time.Duration{old: 40 * 24 * time.Hour, recent: 2 * 24 * time.Hour, unrelated: 40 * 24 * time.Hour} {
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	// Yesterday's log is rotated by today's first write
+	if err := os.WriteFile(f.path, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(f.path, now.Add(-24*time.Hour), now.Add(-24*time.Hour))
+
+	if _, err := f.Write([]byte("today\n")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if fileExists(old) {
+		t.Error("backup older than MaxAgeDays was kept")
+	}
+	if !fileExists(recent) || !fileExists(unrelated) {
+		t.Error("recent backup or unrelated file was deleted")
+	}
+	if got := readLogFiles(t, f); len(got) != 3 || got[1] != "yesterday\n" || got[2] != "today\n" {
+		t.Errorf("got files %q", got)
+	}
+}
@@ -3,16 +3,20 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
 )
 
 // IQAir API key environment variable name
@@ -23,16 +27,165 @@ type Config struct {
 	WeatherAPIKey  string
 	LLMAPIKey      string
 	IQAirAPIKey    string
+	TomorrowAPIKey string // Tomorrow.io key for pollen, fire index and road risk
+	FIRMSMapKey    string // NASA FIRMS map key for active fire and smoke warnings
+	MetOfficeAPIKey string // Met Office DataHub site-specific key; its data replaces Open-Meteo's for GB locations
 	City           string
 	CountryCode    string
 	CheckInterval  int
 	Units          string
+	Locale         string // Language of the structured weather data, e.g. "en" or "de"
+	LLMLanguage    string // Language the LLM responds in (empty leaves it to the prompt)
 	LogToFile      bool
 	LogFile        string
-	LLMProvider    string // "anthropic", "openai", etc.
+	LogRotation    LogRotationConfig // Applies to LogFile and IQAirLogFile
+	IQAirLogFile   string            // Record of IQAir API calls (empty disables)
+	LLMProvider    string // "anthropic", "openai", "mistral" or "cohere"
 	LLMModel       string // "claude-3-5-sonnet", "gpt-4", etc.
+	LLMModelB      string // Second model of the same provider for A/B comparison (empty disables)
 	LLMTemperature float64
 	SystemPrompt   string
+	Persona        string // Default persona preset, e.g. "pirate" (empty for the plain assistant)
+	LLMTools       bool   // Let the LLM call tools for the data it needs instead of sending it all up front
+	LLMBaseURL     string // OpenAI-compatible API base, e.g. https://openrouter.ai/api/v1 (empty for OpenAI)
+	LLMExtraHeaders []string // "Name: value" headers added to LLM requests, e.g. OpenRouter's HTTP-Referer
+	LLMMaxTokens    int      // Longest reply in tokens
+	LLMStop         []string // Sequences that end the reply early
+	LLMTopP         float64  // Nucleus sampling (0 leaves the provider's default)
+	LLMFrequencyPenalty float64 // Discourages repeated words (OpenAI-style providers and Cohere)
+	LLMPresencePenalty  float64 // Discourages returning to a topic (OpenAI-style providers and Cohere)
+
+	// Rate limiting for the HTTP API
+	RateLimitPerMinute int  // Requests per minute per client IP (0 disables)
+	RateLimitBurst     int  // Maximum burst size per client IP
+	TrustProxyHeaders  bool // Use X-Forwarded-For to identify clients
+	TrustedProxyHops   int  // Reverse proxies in front of the server, each appending to X-Forwarded-For
+
+	SkinType int // Fitzpatrick skin type (1-6) for sun exposure estimates
+
+	HealthSensitivities []string // Groups air quality guidance is written for: asthma, children, athletes
+
+	AdvisoryThresholds []string // Overrides of the country's heat and cold advisory thresholds, e.g. "heat_warning=38"
+
+	APIKeys []string // Keys accepted by the API endpoints (empty disables auth)
+
+	CORS CORSConfig // Cross-origin access to the API
+
+	UIAuth UIAuthConfig // Login for the web UI and admin endpoints
+
+	LocationTags    []string // Tags describing the location's use, e.g. "paragliding"
+	AviationStation string   // ICAO station for METAR/TAF (empty picks the nearest in aviation mode)
+
+	// Email notifications
+	SMTP       SMTPConfig
+	DigestTime string // Time of day ("HH:MM", server local time) to send the daily digest
+
+	Comfort ComfortConfig // Comfort targets for appliance pre-conditioning advice
+
+	AlertRules           []string // Threshold rules such as "temp < -10" or "aqi > 150"
+	AlertCooldownMinutes int      // Minimum time between repeat alerts for the same rule
+	WindGustAlert        float64  // Gust speed (configured units) that triggers a high-wind alert (0 disables)
+
+	RedisURL        string // Optional redis:// (or rediss:// for TLS) URL for a cache shared between replicas
+	CacheTTLSeconds int    // How long upstream weather responses are reused (0 disables)
+
+	HistoryFile           string // JSON-lines file observations are persisted to (empty keeps them in memory)
+	HistoryRetentionHours int    // How long observations are kept for /api/history
+	HistoryAggregateDays  int    // How long hourly averages of observations past retention are kept (0 drops them)
+	DatabaseURL           string // Optional postgres:// URL for history, subscriptions, LLM usage, sensor readings and prompts shared between replicas
+
+	TelegramBotToken  string // Bot used to deliver to Telegram subscriptions
+	PushoverAppToken  string // Pushover application token for the digest and alerts
+	PushoverUserKey   string // Pushover user or group key the digest and alerts go to
+	MatrixHomeserver  string // Matrix homeserver URL, e.g. https://matrix.org
+	MatrixAccessToken string // Access token of the Matrix account that posts messages
+	MatrixRoomID      string // Room updates and alerts are posted to, e.g. !abc123:matrix.org
+	GoogleChatWebhook string // Google Chat incoming webhook URL the digest is posted to
+	TeamsWebhook      string // Microsoft Teams incoming webhook URL the digest is posted to
+	NotifierRoutes    []string // Per-channel types and minimum alert severity, e.g. "pushover=alert>=severe"
+	QuietHours        []string // Per-channel quiet hours, e.g. "pushover=22:00-07:00"
+	BatchTimes        []string // Per-channel times batched updates go out, e.g. "matrix=07:00,18:00"
+	SubscriptionsFile string // JSON file user-managed notification endpoints are saved to
+	SubscriptionMaxLocations int // Distinct locations subscriptions may be for besides the configured one (0 for no limit)
+	ProfilesFile      string // JSON file user preference profiles are saved to
+	WebhooksFile      string // JSON list of operator-configured outbound webhooks
+	RuntimeConfigFile string // JSON file settings changed in the UI are saved to (empty keeps them in memory)
+
+	CalendarLocations []string // Places in /calendar.ics, e.g. "Paris,FR" (defaults to the configured city)
+
+	LLMCacheMinutes int // Reuse the LLM message for unchanged conditions within this window (0 disables)
+
+	MessageSimilarity float64 // Regenerate messages at least this similar (0-1) to a recent one
+	RecentMessages    int     // How many recent messages per location are compared against
+	FeedbackGuidance  bool    // Add guidance drawn from /api/feedback ratings to the message prompt
+
+	// Daily LLM budget; once spent, cached or last messages are served instead
+	LLMDailyTokenBudget   int     // Tokens per UTC day (0 disables)
+	LLMDailyCostBudget    float64 // USD per UTC day (0 disables)
+	LLMInputPricePerMTok  float64 // USD per million input tokens, for cost tracking
+	LLMOutputPricePerMTok float64 // USD per million output tokens
+
+	ArchiveSize     int // Raw upstream responses kept per provider for debugging (0 disables)
+	ArchiveMaxBytes int // Largest response body archived; longer bodies are truncated
+
+	PromptLogSize int    // LLM prompts and responses kept for /api/prompts and replay (0 disables)
+	PromptLogFile string // JSON-lines file the prompt log is persisted to without a database (empty keeps it in memory)
+
+	NWSEnabled bool // Add National Weather Service forecasts and discussions for US locations
+
+	DWDEnabled bool   // Use DWD MOSMIX forecasts and warnings for German locations
+	DWDStation string // MOSMIX station ID, e.g. 10382 (empty picks the nearest)
+
+	WildfireRadiusKm int // Distance searched for active fires upwind
+	CycloneRadiusKm  int // Distance within which tropical cyclones are reported
+
+	EarthquakeRadiusKm     int     // Distance within which earthquakes are reported
+	EarthquakeMinMagnitude float64 // Smallest magnitude reported
+
+	GardenGDDBase float64 // Base temperature (°C) for growing degree days
+
+	CommuteHome    string   // "lat,lon" or "City,CC"
+	CommuteWork    string   // "lat,lon" or "City,CC"
+	CommuteTimes   []string // Outbound and return departure times, e.g. 08:00,17:30
+	CommuteMinutes int      // Door-to-door travel time
+
+	RadarProvider     string // Radar tile source: rainviewer, openweathermap, or off
+	RadarCacheSeconds int    // How long proxied radar tiles are cached
+
+	BreakerThreshold       int // Consecutive provider failures that open its circuit breaker (0 disables)
+	BreakerCooldownSeconds int // How long an open breaker refuses calls before a trial call
+
+	FetchConcurrency int // Locations fetched at once when several are configured
+
+	// Shared upstream HTTP client. Proxies come from HTTPS_PROXY/HTTP_PROXY/NO_PROXY.
+	HTTPTimeoutSeconds      int // Default overall timeout for upstream requests
+	HTTPMaxIdleConns        int // Idle keep-alive connections kept across all hosts
+	HTTPMaxIdleConnsPerHost int // Idle keep-alive connections kept per host
+
+	// Scheduled update notifications, sent less often to targets that ignore them
+	UpdateIntervalMinutes    int    // Interval for engaged targets (0 disables scheduled updates)
+	UpdateMaxIntervalMinutes int    // Longest interval for targets that ignore their messages
+	EngagementBaseURL        string // Public URL of this server for email pixels and webhook acks
+	EngagementSecret         string // Key signing engagement links (random per run if empty)
+
+	// Playlist/mood suggestions for dashboard ambiance
+	PlaylistSuggestions  bool     // Add a playlist suggestion to weather payloads
+	PlaylistRules        []string // Mappings such as "rain=rainy-day-jazz" or "clear/evening=golden-hour"
+	PlaylistLinkTemplate string   // e.g. "https://open.spotify.com/search/{mood}" (empty for no link)
+	PlaylistInPrompt     bool     // Also let the LLM mention the suggested mood
+
+	ReportPeriods []string // Climate summary reports to generate ("weekly", "monthly")
+	ReportsDir    string   // Directory generated reports are stored in
+
+	MedicalGuardrail string // Handling of medical claims in LLM output: "off", "soften" or "strict"
+
+	SlackStatusTokens []string // Slack user tokens whose status tracks the weather
+
+	MQTTURL             string // Optional mqtt:// or mqtts:// broker URL the Home Assistant state is published to
+	MQTTDiscoveryPrefix string // Home Assistant's MQTT discovery prefix
+
+	FeatureFlags []string // Initial feature states, e.g. "chat=off", "nowcasting=on"
+	AdminAPIKeys []string // Keys accepted by the admin endpoints (empty disables them)
 }
 
 // Weather data from OpenWeatherMap API
@@ -70,7 +223,11 @@ type WeatherResponse struct {
 	} `json:"snow,omitempty"`
 	Visibility int    `json:"visibility"`
 	Name       string `json:"name"`
-	Sys        struct {
+	Coord      struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coord"`
+	Sys struct {
 		Country string `json:"country"`
 		Sunrise int64  `json:"sunrise"`
 		Sunset  int64  `json:"sunset"`
@@ -78,6 +235,28 @@ type WeatherResponse struct {
 	Timezone int   `json:"timezone"` // Timezone offset in seconds
 	Dt       int64 `json:"dt"`       // Time of data calculation, unix
 	IsDay    int   `json:"is_day"`   // 1 for day, 0 for night
+	UVIndex  float64       `json:"uv_index"`            // Current UV index
+	HasHighLow bool        `json:"-"`                   // Main.TempMin and TempMax hold today's forecast low and high
+	HourlyUV []HourlyValue `json:"hourly_uv,omitempty"` // Today's hourly UV index forecast
+	HourlyPrecipProb []HourlyValue `json:"hourly_precipitation_probability,omitempty"` // Today's hourly chance of precipitation (%)
+	Sounding *Sounding     `json:"sounding,omitempty"`  // Upper-air data for aviation/paragliding locations
+	Aviation *Aviation     `json:"aviation,omitempty"`  // METAR/TAF for the nearest airport (aviation mode)
+	Nowcast  *Nowcast      `json:"nowcast,omitempty"`   // Next two hours of precipitation (nowcasting feature)
+	NWS      *NWSForecast  `json:"nws,omitempty"`       // National Weather Service forecast for US locations
+	Pollen    *Pollen  `json:"pollen,omitempty"`     // Pollen indices (Tomorrow.io)
+	FireIndex *float64 `json:"fire_index,omitempty"` // Fire Weather Index (Tomorrow.io)
+	RoadRisk  string   `json:"road_risk,omitempty"`  // Road risk from low to extreme (Tomorrow.io)
+	Wildfire  *Wildfire `json:"wildfire,omitempty"`  // Active fires and smoke risk (NASA FIRMS)
+	Storms    []TropicalStorm `json:"storms,omitempty"` // Tropical cyclones within range, nearest first
+	Earthquakes []Earthquake `json:"earthquakes,omitempty"` // Nearby quakes in the last day, most recent first
+	Normals  *ClimateNormals `json:"normals,omitempty"` // Today against the 1991-2020 normals for the date
+	LastYear *LastYear `json:"last_year,omitempty"` // Conditions on the same date a year ago
+	Confidence *ForecastConfidence `json:"confidence,omitempty"` // Agreement of the ensemble's members on today
+	Degraded []string      `json:"-"`                   // Sources missing or stale because a provider is down
+	Source   string        `json:"source,omitempty"`    // National provider of the current conditions (empty for Open-Meteo)
+	Warnings []WeatherWarning `json:"warnings,omitempty"` // Official warnings in effect, most severe first
+	Units    string        `json:"-"`                   // Unit system the values were converted to for a caller (empty for the configured one)
+	Locale   string        `json:"-"`                   // Language the caller reads the data and message in (empty for the configured one)
 	AQI struct {
 		List []struct {
 			Main struct {
@@ -108,6 +287,12 @@ type WeatherResponse struct {
 	} `json:"iqair_data,omitempty"`
 }
 
+// A single timestamped value from an hourly forecast series
+type HourlyValue struct {
+	Time  int64   `json:"time"` // Unix timestamp
+	Value float64 `json:"value"`
+}
+
 // Anthropic API structures
 type AnthropicMessage struct {
 	Role    string `json:"role"`
@@ -126,6 +311,10 @@ type AnthropicResponse struct {
 		Text string `json:"text"`
 	} `json:"content"`
 	Model string `json:"model"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 }
 
 // OpenAI API structures
@@ -135,10 +324,14 @@ type OpenAIMessage struct {
 }
 
 type OpenAIRequest struct {
-	Model       string          `json:"model"`
-	Messages    []OpenAIMessage `json:"messages"`
-	Temperature float64         `json:"temperature"`
-	MaxTokens   int             `json:"max_tokens"`
+	Model            string          `json:"model"`
+	Messages         []OpenAIMessage `json:"messages"`
+	Temperature      float64         `json:"temperature"`
+	MaxTokens        int             `json:"max_tokens"`
+	Stop             []string        `json:"stop,omitempty"`
+	TopP             float64         `json:"top_p,omitempty"`
+	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
 }
 
 type OpenAIResponse struct {
@@ -148,31 +341,72 @@ type OpenAIResponse struct {
 		} `json:"message"`
 	} `json:"choices"`
 	Model string `json:"model"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
 // WeatherAgent structure
 type WeatherAgent struct {
-	config          Config
+	config          Config // Read-only once serving, except City and CountryCode (see location)
+	secrets         []string // Configured secrets scrubbed from logs and archived responses, from config at startup
 	logger          *log.Logger
-	weatherHistory  []WeatherResponse
-	lastMessageTime time.Time
-	lastMessage     string
+	iqairLog        *log.Logger // IQAir API calls, kept apart from the main log
+	weatherHistory  *locationHistory // Recent readings per location for LLM context
+	cache           cacheStore // Upstream responses and state shared between replicas
+	db              storage    // History, subscriptions, usage and sensor readings shared between replicas (nil for files, the cache and memory)
+	observations    *observationStore
+	deliveries      *deliveryLog
+	notifiers       []Notifier
+	precondition    preconditionAdvisor
+	astroAlerts     astroAlertTracker
+	cycloneAlerts   astroAlertTracker
+	quakeAlerts     astroAlertTracker
+	warningAlerts   astroAlertTracker
+	alertRules      []AlertRule
+	alertCooldown   alertCooldowns
+	subscriptions   *subscriptionStore
+	profiles        *profileStore
+	locationMu      sync.RWMutex // Guards config.City and config.CountryCode (see location)
+	llm             llmProvider // Overrides the configured LLM API (tests)
+	features        *featureFlags
+	notifierRoutes  map[string]notifierRoute // Per-channel notification types and alert severities
+	outbox          *notificationOutbox      // Notifications held for quiet hours and batching (nil when unused)
+	refreshing      sync.Mutex // Held while a manual refresh runs
+	usageMu         sync.Mutex // Serializes updates to the daily LLM usage totals
+	archive         *responseArchive // Recent raw upstream responses (nil when disabled)
+	prompts         *promptLog       // Recent LLM calls for auditing and replay (nil when disabled)
+	comparisons     *comparisonStore // A/B messages from LLM_MODEL and LLM_MODEL_B
+	jobs            *jobStore        // Messages generating in the background for /api/weather
+	feedback        *feedbackLog     // Users' ratings of generated messages
+	breakers        *breakerSet      // Circuit breakers per upstream provider (nil when disabled)
+	inflight        flightGroup      // Upstream requests in progress, shared by concurrent callers
+	http            *http.Client     // Shared client for upstream calls (see httpClient)
+	publicHTTP      *http.Client     // Client for user-supplied URLs, public addresses only (see publicHTTPClient)
+	engagement      *engagementTracker // Whether recipients open their messages
+	playlistRules   []playlistRule     // Configured playlist mappings, before the defaults
+	advisoryThresholds map[string]float64 // Configured advisory thresholds in °C, over the country's
+	sensors         *sensorStore       // Readings posted by indoor sensors
+}
+
+// Logger writing to out, and to the log file if enabled, with configured
+// secrets scrubbed from every line
+func newAgentLogger(config Config, secrets []string, out io.Writer) *log.Logger {
+	if config.LogToFile {
+		out = io.MultiWriter(out, newRotatingFile(config.LogFile, config.LogRotation))
+	}
+	return log.New(redactingWriter{w: out, secrets: secrets}, "", log.LstdFlags)
 }
 
 // Initialize a new WeatherAgent
 func NewWeatherAgent(config Config) *WeatherAgent {
 	// Set up logging
-	var logger *log.Logger
-	if config.LogToFile {
-		file, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("Error opening log file: %v, using standard logging", err)
-			logger = log.New(os.Stdout, "", log.LstdFlags)
-		} else {
-			logger = log.New(io.MultiWriter(os.Stdout, file), "", log.LstdFlags)
-		}
-	} else {
-		logger = log.New(os.Stdout, "", log.LstdFlags)
+	secrets := config.secrets()
+	logger := newAgentLogger(config, secrets, os.Stdout)
+	iqairLog := log.New(io.Discard, "", 0)
+	if config.IQAirLogFile != "" {
+		iqairLog = log.New(newRotatingFile(config.IQAirLogFile, config.LogRotation), "", 0)
 	}
 
 	// Default system prompt if none provided
@@ -192,71 +426,58 @@ Some guidelines:
 
 Your messages should be directly useful to someone wondering about current weather conditions.`
 	}
+	if config.LLMLanguage != "" {
+		config.SystemPrompt += fmt.Sprintf("\n\nAlways respond in %s, whatever language the data or question is in.", languageName(config.LLMLanguage))
+	}
 
 	agent := &WeatherAgent{
 		config:          config,
+		secrets:         secrets,
 		logger:          logger,
-		weatherHistory:  make([]WeatherResponse, 0, 24), // Store up to 24 hours of history
-		lastMessageTime: time.Time{},
-	}
+		iqairLog:        iqairLog,
+		weatherHistory:  newLocationHistory(),
+		cache:           newMemoryCache(),
+		observations:    &observationStore{retention: time.Duration(config.HistoryRetentionHours) * time.Hour, aggregateRetention: config.historyAggregateRetention()},
+		deliveries:      newDeliveryLog(),
+		comparisons:     newComparisonStore(),
+		jobs:            newJobStore(),
+		feedback:        newFeedbackLog(),
+		sensors:         newSensorStore(),
+		archive:         newResponseArchive(config.ArchiveSize, config.ArchiveMaxBytes),
+		engagement:      newEngagementTracker(config.EngagementBaseURL, config.EngagementSecret),
+		http:            newHTTPClient(config),
+		publicHTTP:      newPublicHTTPClient(config),
+	}
+	agent.prompts, _ = newPromptLog("", config.PromptLogSize) // Can't fail without a file
+	agent.breakers = newBreakerSet(config.BreakerThreshold,
+		time.Duration(config.BreakerCooldownSeconds)*time.Second, logger.Printf)
 
 	return agent
 }
 
-// Add this geocoding function to your code
-// Get coordinates for a city name using Open-Meteo Geocoding API
+// Get coordinates for a city name, failing over between geocoding providers.
+// The last resolved coordinates are reused while every provider is down.
 func (agent *WeatherAgent) getCoordinates(city, country string) (float64, float64, error) {
-	// URL encode the city and country
-	cityEncoded := url.QueryEscape(city)
-
-	// Use the Open-Meteo Geocoding API
-	geocodeURL := fmt.Sprintf("https://geocoding-api.open-meteo.com/v1/search?name=%s&count=1", cityEncoded)
-
-	// Add country code if provided
-	if country != "" {
-		geocodeURL += fmt.Sprintf("&country=%s", strings.ToLower(country))
-	}
-
-	resp, err := http.Get(geocodeURL)
-	if err != nil {
-		return 0, 0, fmt.Errorf("geocoding request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, 0, fmt.Errorf("geocoding API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the geocoding response
-	var geocodeResp struct {
-		Results []struct {
-			Name        string  `json:"name"`
-			Country     string  `json:"country"`
-			Latitude    float64 `json:"latitude"`
-			Longitude   float64 `json:"longitude"`
-			CountryCode string  `json:"country_code"`
-		} `json:"results"`
-	}
-
-	err = json.NewDecoder(resp.Body).Decode(&geocodeResp)
+	key := cacheKeyPrefix + "geocode:" + locationKey(city, country)
+	result, err := agent.geocode(city, country)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to parse geocoding response: %v", err)
-	}
-
-	// Check if we got any results
-	if len(geocodeResp.Results) == 0 {
-		return 0, 0, fmt.Errorf("no locations found for %s, %s", city, country)
+		var last geocodeCandidate
+		if data, ok, cacheErr := agent.cache.Get(key); cacheErr == nil && ok && json.Unmarshal(data, &last) == nil {
+			agent.logger.Printf("Geocoding failed (%v), using last known coordinates for %s", err, city)
+			return last.Lat, last.Lon, nil
+		}
+		return 0, 0, err
 	}
 
-	// Use the first result
-	result := geocodeResp.Results[0]
-
 	// Log the resolved location
-	agent.logger.Printf("Resolved location: %s, %s (%.4f, %.4f)",
-		result.Name, result.Country, result.Latitude, result.Longitude)
+	agent.logger.Printf("Resolved location: %s, %s (%.4f, %.4f) via %s (score %.2f)",
+		result.Name, result.Country, result.Lat, result.Lon, result.Provider, result.Score)
 
-	return result.Latitude, result.Longitude, nil
+	data, _ := json.Marshal(result)
+	if err := agent.cache.Set(key, data, 0); err != nil {
+		agent.logger.Printf("Cache write failed: %v", err)
+	}
+	return result.Lat, result.Lon, nil
 }
 
 // Fetch current weather from OpenWeatherMap API
@@ -264,36 +485,33 @@ func (agent *WeatherAgent) getCoordinates(city, country string) (float64, float6
 // Now modify the fetchWeather function to use geocoding
 // Modify the fetchWeather function to request timezone information
 func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
+	return agent.fetchWeatherFresh(false)
+}
+
+// Fetch weather for the configured city. With refresh set, cached upstream
+// responses are bypassed (and replaced).
+func (agent *WeatherAgent) fetchWeatherFresh(refresh bool) (WeatherResponse, error) {
 	// Get coordinates for the city
-	lat, lon, err := agent.getCoordinates(agent.config.City, agent.config.CountryCode)
+	city, country := agent.location()
+	lat, lon, err := agent.getCoordinates(city, country)
 	if err != nil {
 		// Fall back to default coordinates if geocoding fails
 		agent.logger.Printf("Geocoding failed: %v. Using default coordinates for London.", err)
 		lat, lon = 51.5074, -0.1278 // Default to London
 	}
 
-	// Get the temperature_unit parameter based on config
-	tempUnit := "celsius"
-	windUnit := "kmh"
-	if agent.config.Units == "imperial" {
-		tempUnit = "fahrenheit"
-		windUnit = "mph"
-	}
+	// Get the temperature_unit and windspeed_unit parameters based on config
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+	windUnit := agent.units().OpenMeteoWindSpeedUnit()
 
 	// Add temperature_unit, windspeed_unit, and timezone parameters to the URL
-	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,relative_humidity_2m,apparent_temperature,precipitation,weather_code,cloud_cover,wind_speed_10m,wind_direction_10m,is_day&temperature_unit=%s&windspeed_unit=%s&timezone=auto",
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,relative_humidity_2m,apparent_temperature,precipitation,weather_code,cloud_cover,wind_speed_10m,wind_direction_10m,wind_gusts_10m,is_day,uv_index&hourly=uv_index,visibility,precipitation_probability&daily=temperature_2m_max,temperature_2m_min&forecast_days=1&temperature_unit=%s&windspeed_unit=%s&timezone=auto",
 		lat, lon, tempUnit, windUnit)
 
-	resp, err := http.Get(url)
+	body, stale, err := agent.cachedGet(url, time.Duration(agent.config.CacheTTLSeconds)*time.Second, refresh)
 	if err != nil {
 		return WeatherResponse{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return WeatherResponse{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-	}
 
 	// Parse Open-Meteo response with timezone information
 	var openMeteoResp struct {
@@ -306,9 +524,21 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 			CloudCover       int     `json:"cloud_cover"`
 			WindSpeed        float64 `json:"wind_speed_10m"`
 			WindDirection    int     `json:"wind_direction_10m"`
+			WindGusts        float64 `json:"wind_gusts_10m"`
 			Time             string  `json:"time"`
 			IsDay            int     `json:"is_day"` // 1 for day, 0 for night
+			UVIndex          float64 `json:"uv_index"`
 		} `json:"current"`
+		Hourly struct {
+			Time       []string   `json:"time"`
+			UVIndex    []float64  `json:"uv_index"`
+			Visibility []*float64 `json:"visibility"` // Meters
+			PrecipProb []float64  `json:"precipitation_probability"`
+		} `json:"hourly"`
+		Daily struct {
+			TempMax []float64 `json:"temperature_2m_max"`
+			TempMin []float64 `json:"temperature_2m_min"`
+		} `json:"daily"`
 		CurrentUnits struct {
 			Temperature string `json:"temperature_2m"`
 			WindSpeed   string `json:"wind_speed_10m"`
@@ -318,7 +548,7 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 		TimezoneOffset int    `json:"utc_offset_seconds"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&openMeteoResp)
+	err = json.Unmarshal(body, &openMeteoResp)
 	if err != nil {
 		return WeatherResponse{}, err
 	}
@@ -397,24 +627,44 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 		}{
 			Speed: openMeteoResp.Current.WindSpeed,
 			Deg:   openMeteoResp.Current.WindDirection,
+			Gust:  openMeteoResp.Current.WindGusts,
 		},
 		Clouds: struct {
 			All int `json:"all"`
 		}{
 			All: openMeteoResp.Current.CloudCover,
 		},
-		Name: agent.config.City,
+		Name: city,
 		Sys: struct {
 			Country string `json:"country"`
 			Sunrise int64  `json:"sunrise"`
 			Sunset  int64  `json:"sunset"`
 		}{
-			Country: agent.config.CountryCode,
+			Country: country,
 		},
-		Dt:       localTime.Unix(),             // Time in correct timezone
-		Timezone: openMeteoResp.TimezoneOffset, // Store timezone offset for reference
+		Dt:               localTime.Unix(),             // Time in correct timezone
+		Timezone:         openMeteoResp.TimezoneOffset, // Store timezone offset for reference
+		UVIndex:          openMeteoResp.Current.UVIndex,
+		HourlyUV:         parseHourlySeries(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.UVIndex, locationTimezone),
+		HourlyPrecipProb: parseHourlySeries(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.PrecipProb, locationTimezone),
+	}
+
+	// Today's forecast high and low
+	if len(openMeteoResp.Daily.TempMax) > 0 && len(openMeteoResp.Daily.TempMin) > 0 {
+		weather.Main.TempMax = openMeteoResp.Daily.TempMax[0]
+		weather.Main.TempMin = openMeteoResp.Daily.TempMin[0]
+		weather.HasHighLow = true
 	}
 
+	// Visibility for the current hour, left at zero when the provider omits it
+	if visibility, ok := currentHourValue(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.Visibility, openMeteoResp.Current.Time); ok {
+		weather.Visibility = int(visibility + 0.5)
+	}
+
+	// Prefer the Met Office's current conditions for GB locations and the DWD's for German ones
+	agent.applyMetOffice(&weather, lat, lon, time.Now())
+	agent.applyDWD(&weather, lat, lon, time.Now())
+
 	// Debug timezone information
 	agent.logger.Printf("Location timezone: %s (%s), offset: %d seconds",
 		openMeteoResp.Timezone, openMeteoResp.TimezoneAbbr, openMeteoResp.TimezoneOffset)
@@ -432,12 +682,47 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 		}
 	}
 
+	// Fetch upper-level winds and temperatures for aviation/paragliding locations
+	agent.addSounding(&weather, lat, lon)
+
+	// Fetch METAR/TAF for the nearest airport in aviation mode
+	agent.addAviation(&weather, lat, lon)
+
+	weather.Coord.Lat, weather.Coord.Lon = lat, lon
+
+	// Fetch the precipitation nowcast if enabled
+	agent.addNowcast(&weather, lat, lon)
+
+	// Fetch the National Weather Service forecast and discussion for US locations
+	agent.addNWS(&weather, lat, lon)
+
+	// Fetch pollen, fire and road conditions from Tomorrow.io if configured
+	agent.addTomorrow(&weather, lat, lon)
+
+	// Check for active fires upwind if a FIRMS key is configured
+	agent.addWildfire(&weather, lat, lon)
+
+	// Look for tropical cyclones within range
+	agent.addCyclones(&weather, lat, lon)
+
+	// Check the USGS feed for nearby earthquakes
+	agent.addEarthquakes(&weather, lat, lon)
+
+	// Compare today's high and low with the 30-year normals
+	agent.addClimateNormals(&weather, lat, lon)
+
+	// Look up the same date last year for year-over-year comparisons
+	agent.addLastYear(&weather, lat, lon)
+
+	// Gauge today's forecast confidence from the ensemble's spread
+	agent.addForecastConfidence(&weather, lat, lon)
+
 	// Try to fetch AQI data from IQAir if we have an API key
 	if agent.config.IQAirAPIKey != "" {
 		fmt.Printf("\n==== INITIATING IQAIR API CALL ====\n")
-		fmt.Printf("DEBUG: Using IQAir API key: %s..., length: %d\n", agent.config.IQAirAPIKey[:4], len(agent.config.IQAirAPIKey))
+		fmt.Printf("DEBUG: Using IQAir API key of length %d\n", len(agent.config.IQAirAPIKey))
 		fmt.Printf("DEBUG: Coordinates: lat=%.6f, lon=%.6f\n", lat, lon)
-		agent.logger.Printf("DEBUG: Using IQAir API key: %s..., length: %d", agent.config.IQAirAPIKey[:4], len(agent.config.IQAirAPIKey))
+		agent.logger.Printf("DEBUG: Using IQAir API key of length %d", len(agent.config.IQAirAPIKey))
 		
 		// Force a fresh call to the IQAir API
 		agent.fetchIQAirData(&weather, lat, lon)
@@ -457,9 +742,9 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 		aqiURL := fmt.Sprintf("https://api.openweathermap.org/data/2.5/air_pollution?lat=%f&lon=%f&appid=%s",
 			lat, lon, agent.config.WeatherAPIKey)
 		
-		agent.logger.Printf("DEBUG: Fetching AQI data from URL: %s", aqiURL)
+		agent.logger.Printf("DEBUG: Fetching AQI data from URL: %s", agent.redact(aqiURL))
 		
-		aqiResp, err := http.Get(aqiURL)
+		aqiResp, err := agent.httpClient(0).Get(aqiURL)
 		if err != nil {
 			agent.logger.Printf("Warning: Failed to fetch AQI data: %v", err)
 			// Continue without AQI data, don't return an error
@@ -488,6 +773,7 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 				
 				// Read the response body for logging
 				bodyBytes, _ := io.ReadAll(aqiResp.Body)
+				agent.archiveResponse("openweathermap", aqiURL, aqiResp.StatusCode, bodyBytes)
 				agent.logger.Printf("DEBUG: AQI API response body: %s", string(bodyBytes))
 				
 				// Create a new reader with the same data for decoding
@@ -511,33 +797,99 @@ func (agent *WeatherAgent) fetchWeather() (WeatherResponse, error) {
 		}
 	}
 
+	if stale {
+		weather.Degraded = append(weather.Degraded, "weather")
+	}
 	return weather, nil
 }
 
+// Convert parallel Open-Meteo hourly time/value arrays into a series.
+// Open-Meteo returns hourly times in the location's local timezone.
+func parseHourlySeries(times []string, values []float64, loc *time.Location) []HourlyValue {
+	series := make([]HourlyValue, 0, len(times))
+	for i, ts := range times {
+		if i >= len(values) {
+			break
+		}
+		t, err := time.ParseInLocation("2006-01-02T15:04", ts, loc)
+		if err != nil {
+			continue
+		}
+		series = append(series, HourlyValue{Time: t.Unix(), Value: values[i]})
+	}
+	return series
+}
+
+// Value of an hourly Open-Meteo series for the hour containing current, a
+// local time such as "2024-06-15T14:15". False when missing or null.
+func currentHourValue(times []string, values []*float64, current string) (float64, bool) {
+	if len(current) < 13 {
+		return 0, false
+	}
+	hour := current[:13] + ":00"
+	for i, t := range times {
+		if t == hour && i < len(values) && values[i] != nil {
+			return *values[i], true
+		}
+	}
+	return 0, false
+}
+
+// How many hours ahead the precipitation outlook looks
+const precipOutlookHours = 6
+
+// Summarize the chance of precipitation over the next few hours from an
+// hourly series, e.g. "60% chance of precipitation by 5 PM". The series only
+// covers today, so late in the evening the window ends at midnight. Empty
+// when no hours remain.
+func precipitationOutlook(series []HourlyValue, now time.Time) string {
+	// Local hour boundaries; Truncate would use UTC's, off for half-hour zones
+	start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()).Unix()
+	end := start + precipOutlookHours*3600
+
+	var peak HourlyValue
+	var last int64
+	found := false
+	for _, h := range series {
+		if h.Time < start || h.Time >= end {
+			continue
+		}
+		if !found || h.Value > peak.Value {
+			peak = h
+		}
+		last = h.Time
+		found = true
+	}
+	if !found {
+		return ""
+	}
+
+	loc := now.Location()
+	if peak.Value < 10 {
+		return fmt.Sprintf("under 10%% chance of precipitation through %s", time.Unix(last, 0).In(loc).Format("3 PM"))
+	}
+	return fmt.Sprintf("%.0f%% chance of precipitation by %s", peak.Value, time.Unix(peak.Time, 0).In(loc).Format("3 PM"))
+}
+
 // Fetch weather data using coordinates directly (for geolocation)
 func (agent *WeatherAgent) fetchWeatherByCoordinates(lat, lon float64) (WeatherResponse, error) {
-	// Get the temperature_unit parameter based on config
-	tempUnit := "celsius"
-	windUnit := "kmh"
-	if agent.config.Units == "imperial" {
-		tempUnit = "fahrenheit"
-		windUnit = "mph"
-	}
+	return agent.fetchWeatherByCoordinatesFresh(lat, lon, false)
+}
+
+// Fetch weather for coordinates, bypassing cached upstream responses if refresh is set
+func (agent *WeatherAgent) fetchWeatherByCoordinatesFresh(lat, lon float64, refresh bool) (WeatherResponse, error) {
+	// Get the temperature_unit and windspeed_unit parameters based on config
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+	windUnit := agent.units().OpenMeteoWindSpeedUnit()
 
 	// Use Open-Meteo API with coordinates directly
-	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,relative_humidity_2m,apparent_temperature,precipitation,weather_code,cloud_cover,wind_speed_10m,wind_direction_10m,is_day&temperature_unit=%s&windspeed_unit=%s&timezone=auto",
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,relative_humidity_2m,apparent_temperature,precipitation,weather_code,cloud_cover,wind_speed_10m,wind_direction_10m,wind_gusts_10m,is_day,uv_index&hourly=uv_index,visibility,precipitation_probability&daily=temperature_2m_max,temperature_2m_min&forecast_days=1&temperature_unit=%s&windspeed_unit=%s&timezone=auto",
 		lat, lon, tempUnit, windUnit)
 
-	resp, err := http.Get(url)
+	body, stale, err := agent.cachedGet(url, time.Duration(agent.config.CacheTTLSeconds)*time.Second, refresh)
 	if err != nil {
 		return WeatherResponse{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return WeatherResponse{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-	}
 
 	// Parse Open-Meteo response with timezone information
 	var openMeteoResp struct {
@@ -550,9 +902,21 @@ func (agent *WeatherAgent) fetchWeatherByCoordinates(lat, lon float64) (WeatherR
 			CloudCover       int     `json:"cloud_cover"`
 			WindSpeed        float64 `json:"wind_speed_10m"`
 			WindDirection    int     `json:"wind_direction_10m"`
+			WindGusts        float64 `json:"wind_gusts_10m"`
 			Time             string  `json:"time"`
 			IsDay            int     `json:"is_day"` // 1 for day, 0 for night
+			UVIndex          float64 `json:"uv_index"`
 		} `json:"current"`
+		Hourly struct {
+			Time       []string   `json:"time"`
+			UVIndex    []float64  `json:"uv_index"`
+			Visibility []*float64 `json:"visibility"` // Meters
+			PrecipProb []float64  `json:"precipitation_probability"`
+		} `json:"hourly"`
+		Daily struct {
+			TempMax []float64 `json:"temperature_2m_max"`
+			TempMin []float64 `json:"temperature_2m_min"`
+		} `json:"daily"`
 		CurrentUnits struct {
 			Temperature string `json:"temperature_2m"`
 			WindSpeed   string `json:"wind_speed_10m"`
@@ -562,7 +926,7 @@ func (agent *WeatherAgent) fetchWeatherByCoordinates(lat, lon float64) (WeatherR
 		TimezoneOffset int    `json:"utc_offset_seconds"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&openMeteoResp)
+	err = json.Unmarshal(body, &openMeteoResp)
 	if err != nil {
 		return WeatherResponse{}, err
 	}
@@ -641,6 +1005,7 @@ func (agent *WeatherAgent) fetchWeatherByCoordinates(lat, lon float64) (WeatherR
 		}{
 			Speed: openMeteoResp.Current.WindSpeed,
 			Deg:   openMeteoResp.Current.WindDirection,
+			Gust:  openMeteoResp.Current.WindGusts,
 		},
 		Clouds: struct {
 			All int `json:"all"`
@@ -655,19 +1020,90 @@ func (agent *WeatherAgent) fetchWeatherByCoordinates(lat, lon float64) (WeatherR
 		}{
 			Country: countryCode,
 		},
-		Dt:       localTime.Unix(),             // Time in correct timezone
-		Timezone: openMeteoResp.TimezoneOffset, // Store timezone offset for reference
+		Dt:               localTime.Unix(),             // Time in correct timezone
+		Timezone:         openMeteoResp.TimezoneOffset, // Store timezone offset for reference
+		UVIndex:          openMeteoResp.Current.UVIndex,
+		HourlyUV:         parseHourlySeries(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.UVIndex, locationTimezone),
+		HourlyPrecipProb: parseHourlySeries(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.PrecipProb, locationTimezone),
+	}
+
+	// Today's forecast high and low
+	if len(openMeteoResp.Daily.TempMax) > 0 && len(openMeteoResp.Daily.TempMin) > 0 {
+		weather.Main.TempMax = openMeteoResp.Daily.TempMax[0]
+		weather.Main.TempMin = openMeteoResp.Daily.TempMin[0]
+		weather.HasHighLow = true
+	}
+
+	// Visibility for the current hour, left at zero when the provider omits it
+	if visibility, ok := currentHourValue(openMeteoResp.Hourly.Time, openMeteoResp.Hourly.Visibility, openMeteoResp.Current.Time); ok {
+		weather.Visibility = int(visibility + 0.5)
 	}
 
+	// Prefer the Met Office's current conditions for GB locations and the DWD's for German ones
+	agent.applyMetOffice(&weather, lat, lon, time.Now())
+	agent.applyDWD(&weather, lat, lon, time.Now())
+
 	// Debug timezone information
 	agent.logger.Printf("Location timezone: %s (%s), offset: %d seconds",
 		openMeteoResp.Timezone, openMeteoResp.TimezoneAbbr, openMeteoResp.TimezoneOffset)
 	agent.logger.Printf("Local time at location: %s (is_day: %d)",
 		localTime.Format(time.RFC3339), openMeteoResp.Current.IsDay)
 
+	// Fetch upper-level winds and temperatures for aviation/paragliding locations
+	agent.addSounding(&weather, lat, lon)
+
+	// Fetch METAR/TAF for the nearest airport in aviation mode
+	agent.addAviation(&weather, lat, lon)
+
+	weather.Coord.Lat, weather.Coord.Lon = lat, lon
+
+	// Fetch the precipitation nowcast if enabled
+	agent.addNowcast(&weather, lat, lon)
+
+	// Fetch the National Weather Service forecast and discussion for US locations
+	agent.addNWS(&weather, lat, lon)
+
+	// Fetch pollen, fire and road conditions from Tomorrow.io if configured
+	agent.addTomorrow(&weather, lat, lon)
+
+	// Check for active fires upwind if a FIRMS key is configured
+	agent.addWildfire(&weather, lat, lon)
+
+	// Look for tropical cyclones within range
+	agent.addCyclones(&weather, lat, lon)
+
+	// Check the USGS feed for nearby earthquakes
+	agent.addEarthquakes(&weather, lat, lon)
+
+	// Compare today's high and low with the 30-year normals
+	agent.addClimateNormals(&weather, lat, lon)
+
+	// Look up the same date last year for year-over-year comparisons
+	agent.addLastYear(&weather, lat, lon)
+
+	// Gauge today's forecast confidence from the ensemble's spread
+	agent.addForecastConfidence(&weather, lat, lon)
+
+	if stale {
+		weather.Degraded = append(weather.Degraded, "weather")
+	}
 	return weather, nil
 }
 
+// Attach sounding data to the weather response when the location is tagged for it
+func (agent *WeatherAgent) addSounding(weather *WeatherResponse, lat, lon float64) {
+	if !wantsSounding(agent.config.LocationTags) {
+		return
+	}
+
+	sounding, err := agent.fetchSounding(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch sounding data: %v", err)
+		return
+	}
+	weather.Sounding = sounding
+}
+
 // Reverse geocode coordinates to get city name with multiple fallbacks
 func (agent *WeatherAgent) reverseGeocode(lat, lon float64) (string, string) {
 	// Try multiple geocoding services for better reliability
@@ -694,7 +1130,7 @@ func (agent *WeatherAgent) reverseGeocode(lat, lon float64) (string, string) {
 func (agent *WeatherAgent) tryBigDataCloudGeocode(lat, lon float64) (string, string) {
 	geocodeURL := fmt.Sprintf("https://api.bigdatacloud.net/data/reverse-geocode-client?latitude=%.6f&longitude=%.6f&localityLanguage=en", lat, lon)
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := agent.httpClient(geocodingHTTPTimeout)
 	resp, err := client.Get(geocodeURL)
 	if err != nil {
 		agent.logger.Printf("BigDataCloud geocoding failed: %v", err)
@@ -741,7 +1177,7 @@ func (agent *WeatherAgent) tryNominatimGeocode(lat, lon float64) (string, string
 	}
 	req.Header.Set("User-Agent", "WeatherAgent/1.0 (+https://github.com/yourname/weather-agent)")
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := agent.httpClient(geocodingHTTPTimeout)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", ""
@@ -894,46 +1330,43 @@ func (agent *WeatherAgent) weatherCodeToDescription(code int) string {
 	}
 }
 
-// Add this method to your WeatherAgent struct in the main.go file
+// Configured unit system
+func (agent *WeatherAgent) units() units.System {
+	return units.ParseSystem(agent.config.Units)
+}
+
+// Unit system the weather's values are in: a caller's, if it was converted
+// for them (see applyProfile), otherwise the configured one
+func (agent *WeatherAgent) weatherUnits(weather WeatherResponse) units.System {
+	if weather.Units != "" {
+		return units.ParseSystem(weather.Units)
+	}
+	return agent.units()
+}
+
+// Locale the weather's data is written in: a caller's language, if they
+// have one (see applyProfile), otherwise the configured one
+func (agent *WeatherAgent) weatherLocale(weather WeatherResponse) string {
+	if weather.Locale != "" {
+		return weather.Locale
+	}
+	return agent.config.Locale
+}
 
 // Get temperature unit symbol based on config
 func (agent *WeatherAgent) getTempUnit() string {
-	if agent.config.Units == "imperial" {
-		return "°F"
-	}
-	return "°C"
+	return agent.units().TemperatureSymbol()
 }
 
-// Get wind speed unit
+// Get wind speed unit. Open-Meteo is asked for km/h (metric) or mph (imperial).
 func (agent *WeatherAgent) getWindUnit() string {
-	if agent.config.Units == "imperial" {
-		return "mph"
-	}
-	return "m/s"
+	return agent.units().SpeedUnit()
 }
 
 // Prepare weather data for LLM
 // Update prepareWeatherData to include day/night information
 // Modify the prepareWeatherData method to fix the time display
 // Modify the prepareWeatherData method to be extremely explicit about time
-// Helper function to get AQI description based on value for OpenWeatherMap API
-func getAQIDescription(aqi int) string {
-	switch aqi {
-	case 1:
-		return "Good (1): Air quality is considered satisfactory, and air pollution poses little or no risk."
-	case 2:
-		return "Fair (2): Air quality is acceptable; however, for some pollutants there may be a moderate health concern for a very small number of people."
-	case 3:
-		return "Moderate (3): Members of sensitive groups may experience health effects. The general public is not likely to be affected."
-	case 4:
-		return "Poor (4): Everyone may begin to experience health effects; members of sensitive groups may experience more serious health effects."
-	case 5:
-		return "Very Poor (5): Health warnings of emergency conditions. The entire population is more likely to be affected."
-	default:
-		return fmt.Sprintf("Unknown AQI value: %d", aqi)
-	}
-}
-
 // Fetch air quality data from IQAir API
 func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon float64) {
 	// IQAir API endpoint - add timestamp to prevent caching
@@ -941,18 +1374,23 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	iqairURL := fmt.Sprintf("https://api.airvisual.com/v2/nearest_city?lat=%.6f&lon=%.6f&key=%s&_t=%d",
 		lat, lon, agent.config.IQAirAPIKey, timestamp)
 	
-	agent.logger.Printf("DEBUG: Fetching AQI data from IQAir: %s", strings.Replace(iqairURL, agent.config.IQAirAPIKey, "[REDACTED]", 1))
-	agent.logger.Printf("DEBUG: IQAir API key length: %d, first 4 chars: %s", len(agent.config.IQAirAPIKey), agent.config.IQAirAPIKey[:4])
+	agent.logger.Printf("DEBUG: Fetching AQI data from IQAir: %s", agent.redact(iqairURL))
+	agent.logger.Printf("DEBUG: IQAir API key length: %d", len(agent.config.IQAirAPIKey))
 	
 	// Print directly to stdout for debugging
 	fmt.Printf("\n==== IQAIR API REQUEST ====\n")
-	fmt.Printf("DEBUG: Making IQAir API request with key: %s... (length: %d)\n", 
-		agent.config.IQAirAPIKey[:4], len(agent.config.IQAirAPIKey))
-	fmt.Printf("DEBUG: Request URL: %s\n", strings.Replace(iqairURL, agent.config.IQAirAPIKey, "[REDACTED]", 1))
+	fmt.Printf("DEBUG: Making IQAir API request (key length: %d)\n", len(agent.config.IQAirAPIKey))
+	fmt.Printf("DEBUG: Request URL: %s\n", agent.redact(iqairURL))
 	
-	client := &http.Client{
-		Timeout: time.Second * 10,
+	// Skip IQAir while its breaker is open rather than waiting on a failing API
+	breaker := agent.breakers.get("iqair")
+	if !breaker.allow() {
+		agent.logger.Printf("WARNING: IQAir circuit breaker open, skipping air quality")
+		weather.Degraded = append(weather.Degraded, "air_quality")
+		return
 	}
+
+	client := agent.httpClient(10 * time.Second)
 	req, _ := http.NewRequest("GET", iqairURL, nil)
 	req.Header.Add("User-Agent", "WeatherAgent/1.0")
 	// Disable caching
@@ -961,15 +1399,14 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	
 	iqairResp, err := client.Do(req)
 	if err != nil {
+		breaker.failure()
 		agent.logger.Printf("WARNING: Failed to fetch IQAir data: %v", err)
-		fmt.Printf("ERROR: Failed to fetch IQAir data: %v\n", err)  // Print directly to stdout
 		return
 	}
 	defer iqairResp.Body.Close()
 	
 	statusMsg := fmt.Sprintf("DEBUG: IQAir API response status: %d", iqairResp.StatusCode)
 	agent.logger.Print(statusMsg)
-	fmt.Println(statusMsg)
 	
 	// Log all response headers for debugging
 	fmt.Println("DEBUG: IQAir API response headers:")
@@ -979,10 +1416,14 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 		}
 	}
 	
+	if iqairResp.StatusCode >= 500 || iqairResp.StatusCode == http.StatusTooManyRequests {
+		breaker.failure()
+	} else {
+		breaker.success()
+	}
 	if iqairResp.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("WARNING: IQAir API returned status %d", iqairResp.StatusCode)
 		agent.logger.Print(errMsg)
-		fmt.Println(errMsg)
 		return
 	}
 	
@@ -991,14 +1432,14 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	if readErr != nil {
 		errMsg := fmt.Sprintf("WARNING: Failed to read IQAir response body: %v", readErr)
 		agent.logger.Print(errMsg)
-		fmt.Println(errMsg)
 		return
 	}
 	
-	// Log response body to both logger and stdout
+	agent.archiveResponse("iqair", iqairURL, iqairResp.StatusCode, bodyBytes)
+
+	// Log the response body, scrubbed of secrets by the logger
 	responseBody := string(bodyBytes)
 	agent.logger.Printf("DEBUG: IQAir API response body: %s", responseBody)
-	fmt.Printf("DEBUG: IQAir API response body: %s\n", responseBody)
 	
 	// Parse the IQAir response
 	var iqairResponse struct {
@@ -1044,14 +1485,12 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	if err := json.NewDecoder(bodyReader).Decode(&iqairResponse); err != nil {
 		errMsg := fmt.Sprintf("WARNING: Failed to decode IQAir data: %v", err)
 		agent.logger.Print(errMsg)
-		fmt.Println(errMsg)
 		return
 	}
 	
 	if iqairResponse.Status != "success" {
 		errMsg := fmt.Sprintf("WARNING: IQAir API returned status %s", iqairResponse.Status)
 		agent.logger.Print(errMsg)
-		fmt.Println(errMsg)
 		return
 	}
 	
@@ -1059,21 +1498,7 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	
 	// Get AQI category based on US AQI value
 	aqi := iqairResponse.Data.Current.Pollution.Aqius
-	var category string
-	switch {
-	case aqi <= 50:
-		category = "Good"
-	case aqi <= 100:
-		category = "Moderate"
-	case aqi <= 150:
-		category = "Unhealthy for Sensitive Groups"
-	case aqi <= 200:
-		category = "Unhealthy"
-	case aqi <= 300:
-		category = "Very Unhealthy"
-	default:
-		category = "Hazardous"
-	}
+	category := usAQICategory(defaultLocale, aqi)
 	
 	// Get pollutant unit based on main pollutant
 	pollutant := iqairResponse.Data.Current.Pollution.Mainus
@@ -1145,19 +1570,18 @@ func (agent *WeatherAgent) fetchIQAirData(weather *WeatherResponse, lat, lon flo
 	successMsg := fmt.Sprintf("Successfully added IQAir AQI data: %d (%s)", aqi, category)
 	agent.logger.Print(successMsg)
 	fmt.Println(successMsg)
-	fmt.Println("==== IQAIR API REQUEST COMPLETE ====\n")
+	fmt.Println("==== IQAIR API REQUEST COMPLETE ====")
 	
 	// Log to a special file just for IQAir API calls
-	logFile, err := os.OpenFile("iqair_api_calls.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err == nil {
-		defer logFile.Close()
-		timestamp := time.Now().Format(time.RFC3339)
-		logFile.WriteString(fmt.Sprintf("[%s] IQAir API call: lat=%.6f, lon=%.6f, status=%s, AQI=%d, Category=%s\n", 
-			timestamp, lat, lon, "success", aqi, category))
+	if agent.iqairLog != nil {
+		agent.iqairLog.Printf("[%s] IQAir API call: lat=%.6f, lon=%.6f, status=%s, AQI=%d, Category=%s",
+			time.Now().Format(time.RFC3339), lat, lon, "success", aqi, category)
 	}
 }
 
 func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[string]interface{} {
+	system, locale := agent.weatherUnits(weather), agent.weatherLocale(weather)
+
 	// Create the timezone for the location
 	locationTimezone := time.FixedZone("Local", weather.Timezone)
 	// Convert the stored Unix timestamp to the proper timezone
@@ -1200,113 +1624,52 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 		isDaytime = currentUnix >= weather.Sys.Sunrise && currentUnix < weather.Sys.Sunset
 	}
 	
-	dayNightString := "DAYTIME"
-	if !isDaytime {
-		dayNightString = "NIGHTTIME"
-	}
+	dayNightString := dayNightLabel(locale, isDaytime)
 
 	// Format times in multiple ways for absolute clarity
 	time12h := localTime.Format("3:04 PM")
 	time24h := localTime.Format("15:04")
 	timeWithSeconds := localTime.Format("3:04:05 PM")
-	fullTimeDate := localTime.Format("Monday, January 2, 2006 at 3:04 PM")
+	fullTimeDate := formatLocalDateTime(locale, localTime)
 	
-	// Calculate moon phase (simplified approximation)
-	// Get days since new moon on Jan 6, 2000
-	daysSinceNewMoon := (localTime.Unix() - 947182440) / 86400
-	// Moon phase cycles every 29.53 days
-	moonAge := float64(daysSinceNewMoon % 30) / 29.53
-	
-	var moonPhase string
-	switch {
-	case moonAge < 0.025 || moonAge >= 0.975: // 0-2.5% or 97.5-100%
-		moonPhase = "New Moon"
-	case moonAge < 0.225: // 2.5-22.5%
-		moonPhase = "Waxing Crescent"
-	case moonAge < 0.275: // 22.5-27.5%
-		moonPhase = "First Quarter"
-	case moonAge < 0.475: // 27.5-47.5%
-		moonPhase = "Waxing Gibbous"
-	case moonAge < 0.525: // 47.5-52.5%
-		moonPhase = "Full Moon"
-	case moonAge < 0.725: // 52.5-72.5%
-		moonPhase = "Waning Gibbous"
-	case moonAge < 0.775: // 72.5-77.5%
-		moonPhase = "Last Quarter"
-	default: // 77.5-97.5%
-		moonPhase = "Waning Crescent"
-	}
+	// Calculate moon phase from the Sun-Moon elongation
+	moon := calculateMoonPhase(localTime)
+	moonPhase := moon.Name
 	
 	// Get wind direction as cardinal/intercardinal point
-	windDegree := float64(weather.Wind.Deg)
-	windDirection := ""
-	switch {
-	case windDegree >= 337.5 || windDegree < 22.5:
-		windDirection = "N"
-	case windDegree >= 22.5 && windDegree < 67.5:
-		windDirection = "NE"
-	case windDegree >= 67.5 && windDegree < 112.5:
-		windDirection = "E"
-	case windDegree >= 112.5 && windDegree < 157.5:
-		windDirection = "SE"
-	case windDegree >= 157.5 && windDegree < 202.5:
-		windDirection = "S"
-	case windDegree >= 202.5 && windDegree < 247.5:
-		windDirection = "SW"
-	case windDegree >= 247.5 && windDegree < 292.5:
-		windDirection = "W"
-	case windDegree >= 292.5 && windDegree < 337.5:
-		windDirection = "NW"
-	}
+	windDirection := compassDirection(locale, float64(weather.Wind.Deg))
 	
 	// Calculate heat index if temperature > 80°F (26.7°C) and humidity > 40%
 	var heatIndex float64
-	tempF := weather.Main.Temp
-	if agent.config.Units == "metric" {
-		tempF = weather.Main.Temp*9/5 + 32 // Convert to Fahrenheit for calculation
-	}
-	if tempF > 80 && weather.Main.Humidity > 40 {
-		// Rothfusz formula
-		heatIndex = -42.379 + 2.04901523*tempF + 10.14333127*float64(weather.Main.Humidity) - 
-			0.22475541*tempF*float64(weather.Main.Humidity) - 0.00683783*tempF*tempF - 
-			0.05481717*float64(weather.Main.Humidity)*float64(weather.Main.Humidity) + 
-			0.00122874*tempF*tempF*float64(weather.Main.Humidity) + 
-			0.00085282*tempF*float64(weather.Main.Humidity)*float64(weather.Main.Humidity) - 
-			0.00000199*tempF*tempF*float64(weather.Main.Humidity)*float64(weather.Main.Humidity)
-		
-		// Convert back to Celsius if needed
-		if agent.config.Units == "metric" {
-			heatIndex = (heatIndex - 32) * 5 / 9
-		}
+	temp := units.TemperatureIn(weather.Main.Temp, system)
+	if hi, ok := units.HeatIndex(temp, float64(weather.Main.Humidity)); ok {
+		heatIndex = hi.In(system)
 	}
-	
+
+	// Dew point, plus wind chill in cold wind and humidex in warm humid air
+	dewPoint := units.DewPoint(temp, float64(weather.Main.Humidity))
+	windChill, hasWindChill := units.WindChill(temp, units.SpeedIn(weather.Wind.Speed, system))
+	humidex, hasHumidex := units.Humidex(temp, dewPoint)
+
 	// Format visibility
-	visibilityStr := "Unknown"
+	visibilityStr := translate(locale, msgUnknown)
 	// Debug visibility value
 	agent.logger.Printf("DEBUG: Visibility value from API: %d meters", weather.Visibility)
 	
-	// OpenWeatherMap returns visibility in meters, and 10000 is their default maximum
-	// Visibility might not be in the response or might be 0, default to a reasonable value
-	// when it's missing or invalid
-	if weather.Visibility <= 0 {
-		agent.logger.Printf("WARNING: Visibility is missing, zero or negative: %d - using default value", weather.Visibility)
-		// Set a default visibility value (assuming good visibility) if missing
+	// Visibility is in meters; zero means the provider didn't report it, in
+	// which case good visibility is assumed
+	reported := weather.Visibility > 0
+	if !reported {
+		agent.logger.Printf("WARNING: Visibility not reported - using default value")
 		weather.Visibility = 10000
 	}
 	
-	if agent.config.Units == "metric" {
-		visibilityStr = fmt.Sprintf("%.1f km", float64(weather.Visibility)/1000)
-	} else {
-		visibilityStr = fmt.Sprintf("%.1f miles", float64(weather.Visibility)/1609.34)
-	}
-	
-	// If the visibility is at the API's default maximum (10000 meters)
-	if weather.Visibility == 10000 {
-		if agent.config.Units == "metric" {
-			visibilityStr = "10+ km (excellent)"
-		} else {
-			visibilityStr = "6.2+ miles (excellent)"
-		}
+	visibility := units.Meters(float64(weather.Visibility))
+	visibilityStr = visibility.Format(system)
+
+	// Mark the assumed default so it isn't read as a measurement
+	if !reported {
+		visibilityStr = strings.Replace(visibilityStr, " ", "+ ", 1) + " (" + translate(locale, msgExcellent) + ")"
 	}
 
 	// Create a map of the current weather data
@@ -1318,35 +1681,46 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 		"time_24h":              time24h,
 		"time_with_seconds":     timeWithSeconds,
 		"full_date_and_time":    fullTimeDate,
-		"day_of_week":           localTime.Weekday().String(),
+		"day_of_week":           weekdayName(locale, localTime.Weekday()),
 		"hour_of_day":           hour,
 		"is_daytime_or_night":   dayNightString,
-		"date":                  localTime.Format("January 2, 2006"),
-		"temperature":           fmt.Sprintf("%.1f%s", weather.Main.Temp, agent.getTempUnit()),
-		"feels_like":            fmt.Sprintf("%.1f%s", weather.Main.FeelsLike, agent.getTempUnit()),
-		"temp_min":              fmt.Sprintf("%.1f%s", weather.Main.TempMin, agent.getTempUnit()),
-		"temp_max":              fmt.Sprintf("%.1f%s", weather.Main.TempMax, agent.getTempUnit()),
+		"date":                  formatLocalDate(locale, localTime),
+		"temperature":           fmt.Sprintf("%.1f%s", weather.Main.Temp, system.TemperatureSymbol()),
+		"feels_like":            fmt.Sprintf("%.1f%s", weather.Main.FeelsLike, system.TemperatureSymbol()),
 		"condition":             condition,
 		"description":           description,
 		"weather_id":            weatherId,
 		"humidity":              weather.Main.Humidity,
 		"pressure":              fmt.Sprintf("%d hPa", weather.Main.Pressure),
-		"wind_speed":            fmt.Sprintf("%.1f %s", weather.Wind.Speed, agent.getWindUnit()),
+		"wind_speed":            fmt.Sprintf("%.1f %s", weather.Wind.Speed, system.SpeedUnit()),
 		"wind_direction":        weather.Wind.Deg,
 		"wind_direction_text":   windDirection,
-		"wind_gust":             fmt.Sprintf("%.1f %s", weather.Wind.Gust, agent.getWindUnit()),
+		"wind_gust":             fmt.Sprintf("%.1f %s", weather.Wind.Gust, system.SpeedUnit()),
 		"visibility":            visibilityStr,
 		"cloud_cover":           fmt.Sprintf("%d%%", weather.Clouds.All),
 		"sunrise":               sunrise,
 		"sunset":                sunset,
-		"day_length":            fmt.Sprintf("%.1f hours", dayLength),
+		"day_length":            fmt.Sprintf("%.1f %s", dayLength, translate(locale, msgHours)),
 		"moon_phase":            moonPhase,
-		"units":                 agent.config.Units,
+		"units":                 string(system),
 		"is_daytime":            isDaytime,
 		"timezone_offset_hours": weather.Timezone / 3600,
 		"timezone_name":         fmt.Sprintf("UTC%+d", weather.Timezone/3600),
 	}
 	
+	// Beaufort force and direction arrow, or calm
+	agent.addWindData(weather, data)
+
+	// Today's forecast range, left out when unknown so the LLM isn't handed a 0° range
+	if weather.HasHighLow {
+		data["today_high"] = fmt.Sprintf("%.1f%s", weather.Main.TempMax, system.TemperatureSymbol())
+		data["today_low"] = fmt.Sprintf("%.1f%s", weather.Main.TempMin, system.TemperatureSymbol())
+	}
+
+	if weather.Source != "" {
+		data["data_source"] = weather.Source
+	}
+
 	// Log raw visibility value from API for debugging
 	agent.logger.Printf("Raw visibility value from API response: %d meters", weather.Visibility)
 	
@@ -1355,7 +1729,7 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 		agent.logger.Printf("DEBUG: Using IQAir AQI data")
 		
 		data["aqi"] = weather.IQAirData.AQI
-		data["aqi_description"] = weather.IQAirData.Category
+		data["aqi_description"] = usAQICategory(locale, weather.IQAirData.AQI)
 		data["aqi_source"] = "IQAir"
 		
 		// Add individual pollutant data
@@ -1369,7 +1743,7 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 		// Fallback to OpenWeatherMap AQI data
 		agent.logger.Printf("DEBUG: Using OpenWeatherMap AQI data. AQI list length: %d", len(weather.AQI.List))
 		aqiValue := weather.AQI.List[0].Main.AQI
-		aqiDesc := getAQIDescription(aqiValue)
+		aqiDesc := getAQIDescription(locale, aqiValue)
 		
 		data["aqi"] = aqiValue
 		data["aqi_description"] = aqiDesc
@@ -1388,6 +1762,7 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 	} else {
 		agent.logger.Printf("No AQI data available from any source")
 	}
+	agent.addAirQualityGuidance(weather, data)
 	
 	// DEBUG: Print all data being sent to the frontend
 	agent.logger.Printf("DEBUG: Full weather data map being sent to frontend:")
@@ -1397,7 +1772,130 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 	
 	// Add heat index if calculated
 	if heatIndex > 0 {
-		data["heat_index"] = fmt.Sprintf("%.1f%s", heatIndex, agent.getTempUnit())
+		data["heat_index"] = fmt.Sprintf("%.1f%s", heatIndex, system.TemperatureSymbol())
+	}
+	data["dew_point"] = dewPoint.Format(system)
+	if hasWindChill {
+		data["wind_chill"] = windChill.Format(system)
+	}
+	if hasHumidex {
+		// Humidex is a unitless index on the Celsius scale
+		data["humidex"] = fmt.Sprintf("%.0f", humidex.Celsius())
+	}
+
+	// Heat or cold advisory by the country's thresholds
+	agent.addTemperatureAdvisory(weather, data)
+
+	// Add UV index and sun exposure guidance
+	data["uv_index"] = fmt.Sprintf("%.1f (%s)", weather.UVIndex, uvIndexCategory(weather.UVIndex))
+	if isDaytime && weather.UVIndex > 0 {
+		exposure := estimateSunExposure(agent.config.SkinType, weather.UVIndex, weather.HourlyUV, locationTimezone)
+		data["skin_type"] = exposure.SkinType
+		data["sun_burn_minutes"] = exposure.BurnMinutes
+		data["vitamin_d_minutes"] = exposure.VitaminDMinutes
+		if len(exposure.VitaminDWindows) > 0 {
+			data["vitamin_d_windows"] = formatSunWindows(exposure.VitaminDWindows)
+		}
+		if len(exposure.HighUVWindows) > 0 {
+			data["high_uv_windows"] = formatSunWindows(exposure.HighUVWindows)
+		}
+	}
+
+	// Add moon illumination, rise/set times and the next principal phases
+	data["moon_illumination"] = fmt.Sprintf("%.0f%%", moon.Illumination*100)
+	if weather.Coord.Lat != 0 || weather.Coord.Lon != 0 {
+		moonrise, moonset := moonRiseSet(localTime, weather.Coord.Lat, weather.Coord.Lon)
+		if !moonrise.IsZero() {
+			data["moonrise"] = moonrise.Format("3:04 PM")
+		}
+		if !moonset.IsZero() {
+			data["moonset"] = moonset.Format("3:04 PM")
+		}
+	}
+	if next := nextMoonPhase(localTime, 180); !next.IsZero() {
+		data["next_full_moon"] = formatLocalDate(locale, next)
+	}
+	if next := nextMoonPhase(localTime, 0); !next.IsZero() {
+		data["next_new_moon"] = formatLocalDate(locale, next)
+	}
+
+	// Define unusual weather terms that apply, so the message can explain them
+	if terms := matchGlossary(weather, system); len(terms) > 0 {
+		data["glossary"] = terms
+	}
+
+	// Deterministic clothing and activity advice, so the message can't invent it
+	data["recommendations"] = agent.recommendations(weather)
+
+	// Add the short-term precipitation outlook
+	if weather.Nowcast != nil {
+		data["nowcast"] = weather.Nowcast.Summary
+	}
+	if outlook := precipitationOutlook(weather.HourlyPrecipProb, localTime); outlook != "" {
+		data["precipitation_chance"] = outlook
+	}
+
+	// Add official warnings in effect
+	addWarningData(weather, data)
+
+	// Add pollen, fire danger and road risk from Tomorrow.io
+	addTomorrowData(weather, data)
+
+	// Add active fires and the smoke risk they pose
+	agent.addWildfireData(weather, data)
+
+	// Add nearby tropical cyclones with their track
+	agent.addCycloneData(weather, data)
+
+	// Add nearby earthquakes from the last few hours
+	addEarthquakeData(weather, data, time.Now())
+
+	// Add the climate normals and how today compares
+	agent.addClimateNormalsData(weather, data)
+
+	// Add the same date last year
+	agent.addLastYearData(weather, data)
+
+	// Add how far the ensemble's members agree on today
+	agent.addForecastConfidenceData(weather, data)
+
+	// Add indoor sensor readings to contrast with outside
+	agent.addIndoorData(weather, data, time.Now())
+
+	// Add the NWS forecast and forecasters' reasoning for US locations
+	if weather.NWS != nil {
+		periods := make([]string, 0, len(weather.NWS.Periods))
+		for _, period := range weather.NWS.Periods {
+			periods = append(periods, period.Name+": "+period.DetailedForecast)
+		}
+		data["nws_forecast"] = strings.Join(periods, " ")
+		if weather.NWS.Discussion != "" {
+			data["forecast_discussion"] = weather.NWS.Discussion
+		}
+	}
+
+	// Add upper-air summary for aviation/paragliding locations
+	if weather.Sounding != nil {
+		data["sounding"] = weather.Sounding.summary()
+		data["lapse_rate"] = fmt.Sprintf("%.1f°C/km", weather.Sounding.LapseRate)
+		data["thermal_quality"] = weather.Sounding.ThermalQuality
+		if weather.Sounding.WindWarning != "" {
+			data["winds_aloft_warning"] = weather.Sounding.WindWarning
+		}
+	}
+
+	// Add decoded METAR/TAF fields for the flight-conditions briefing
+	if weather.Aviation != nil {
+		addAviationData(weather.Aviation, data)
+	}
+
+	// Add meteor shower/eclipse viewing suggestions when skies are clear
+	if events := viewableAstroEvents(localTime, weather.Clouds.All, isDaytime); len(events) > 0 {
+		suggestions := make([]string, 0, len(events))
+		for _, event := range events {
+			suggestions = append(suggestions, event.Suggestion)
+		}
+		data["astronomy_events"] = suggestions
 	}
 
 	// Add rain data if available
@@ -1416,6 +1914,9 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 		data["snow_3h"] = fmt.Sprintf("%.1f mm", weather.Snow.ThreeHours)
 	}
 
+	// Overall severity from the conditions and official warnings
+	agent.addSeverityData(weather, data)
+
 	// Time display for UI - ensure we have a time field specifically for the UI
 	data["time"] = time12h // This is what displays in the UI
 
@@ -1432,7 +1933,7 @@ func (agent *WeatherAgent) prepareWeatherData(weather WeatherResponse) map[strin
 // Generate message using LLM API
 // Modify the generateLLMMessage function to explicitly address the time issue
 // Add this to the beginning of the generateLLMMessage function
-func (agent *WeatherAgent) generateLLMMessage(currentWeather WeatherResponse, historyContext string) (string, error) {
+func (agent *WeatherAgent) generateLLMMessage(currentWeather WeatherResponse, historyContext, persona string, params llmParams) (string, error) {
 	// Debug the timestamp and timezone before any processing
 	agent.logger.Printf("======= LLM MESSAGE TIME DEBUG =======")
 	agent.logger.Printf("Unix timestamp: %d", currentWeather.Dt)
@@ -1469,9 +1970,14 @@ You MUST use this exact time in your weather message.
 	weatherInfo.WriteString(timeInstructions)
 	weatherInfo.WriteString("\n")
 
-	// Add all the weather data
-	for key, value := range weatherData {
-		weatherInfo.WriteString(fmt.Sprintf("%s: %v\n", key, value))
+	// Add all the weather data, or just the basics when the LLM can fetch the rest with tools
+	if agent.useLLMTools() {
+		weatherInfo.WriteString(fmt.Sprintf("Location: %s, %s\nCondition: %v\nTemperature: %v\n\n", currentWeather.Name, currentWeather.Sys.Country, weatherData["condition"], weatherData["temperature"]))
+		weatherInfo.WriteString("Use the tools to fetch the data you need before writing. The data keys mentioned below come from get_conditions and get_air_quality.\n")
+	} else {
+		for key, value := range weatherData {
+			weatherInfo.WriteString(fmt.Sprintf("%s: %v\n", key, value))
+		}
 	}
 
 	// Create the user message with current weather data and history context
@@ -1489,165 +1995,356 @@ Consider all the weather details provided, such as temperature, humidity, wind,
 
 You can mention interesting weather facts or patterns if they're relevant to the current conditions. For example, if it's a full moon on a clear night, or if it's an unusually warm/cold day for the season.
 
-If air quality information is provided, include health recommendations based on the AQI level.
+If air quality information is provided, base any health recommendations on air_quality_guidance rather than your own reading of the AQI.
+
+When describing how it feels outside, use the dew_point (mugginess) and any heat_index, humidex, or wind_chill provided rather than the air temperature alone.
 
 CRITICAL: The current local time in %s is %s. DO NOT modify or reinterpret this time. Reference this EXACT time in your response.`, currentWeather.Name, time12h)
 
-	// Call the appropriate LLM API based on configuration
-	switch strings.ToLower(agent.config.LLMProvider) {
-	case "anthropic":
-		return agent.callAnthropicAPI(userMessage)
-	case "openai":
-		return agent.callOpenAIAPI(userMessage)
-	default:
-		return "", fmt.Errorf("unsupported LLM provider: %s", agent.config.LLMProvider)
+	// Keep the day's range to the forecast rather than a guess
+	if _, ok := weatherData["today_high"]; ok {
+		userMessage += `
+
+If you mention the day's temperature range, use today_high and today_low exactly.`
+	} else {
+		userMessage += `
+
+No forecast high or low is available, so don't state one.`
 	}
-}
 
-// Call the Anthropic API (Claude) - updated to current API format
-func (agent *WeatherAgent) callAnthropicAPI(userMessage string) (string, error) {
-	url := "https://api.anthropic.com/v1/messages"
+	// Heat and cold severity comes from local thresholds, not the model's judgement
+	if advisory, ok := weatherData["temperature_advisory"].(TemperatureAdvisory); ok {
+		userMessage += fmt.Sprintf(`
 
-	// Create request with updated format
-	reqBody := struct {
-		Model       string             `json:"model"`
-		System      string             `json:"system"`
-		Messages    []AnthropicMessage `json:"messages"`
-		Temperature float64            `json:"temperature"`
-		MaxTokens   int                `json:"max_tokens"`
-	}{
-		Model:  agent.config.LLMModel,
-		System: agent.config.SystemPrompt,
-		Messages: []AnthropicMessage{
+A %s %s applies under local thresholds (see temperature_advisory). Call it a %s %s, without making it sound more or less severe, and give practical precautions.`,
+			advisory.Type, advisory.Severity, advisory.Type, advisory.Severity)
+	} else {
+		userMessage += `
+
+No heat or cold advisory applies under local thresholds, so don't call the temperature dangerous unless an official warning says so.`
+	}
+
+	// Rain later in the day comes from the forecast, not from current conditions
+	if _, ok := weatherData["precipitation_chance"]; ok {
+		userMessage += `
+
+For rain or snow in the coming hours, quote precipitation_chance rather than inferring it from current precipitation.`
+	}
+
+	// On sunny days, ask for sun exposure guidance based on the computed windows
+	condition, _ := weatherData["condition"].(string)
+	isDaytime, _ := weatherData["is_daytime"].(bool)
+	if _, ok := weatherData["sun_burn_minutes"]; ok && isSunnyCondition(condition, isDaytime) {
+		userMessage += `
+
+It is sunny. Briefly mention safe sun exposure using sun_burn_minutes, vitamin_d_minutes, and the vitamin_d_windows/high_uv_windows provided (for the configured skin type).`
+	}
+
+	// In the evening, suggest viewing any meteor shower or eclipse under clear skies
+	if _, ok := weatherData["astronomy_events"]; ok {
+		userMessage += `
+
+There is a notable astronomical event (see astronomy_events) and the sky is clear. Include a brief viewing suggestion.`
+	}
+
+	// Optionally let the message nod to the dashboard's playlist mood
+	if agent.config.PlaylistSuggestions && agent.config.PlaylistInPrompt {
+		userMessage += fmt.Sprintf(`
+
+The dashboard is playing a "%s" playlist to match the weather. You may mention the mood in passing.`, agent.playlistSuggestion(currentWeather).Mood)
+	}
+
+	// Keep clothing and activity advice consistent with the computed recommendations
+	userMessage += `
+
+If you give clothing or activity advice, base it on recommendations (layers, umbrella, sunscreen, and run/bike scores out of 10) rather than your own judgement.`
+
+	// Let the message teach any unusual weather term that applies
+	if _, ok := weatherData["glossary"]; ok {
+		userMessage += `
+
+An unusual weather term applies (see glossary). Use the term and explain it in a few plain words using its definition.`
+	}
+
+	// Call out precipitation arriving or clearing within the next two hours
+	if currentWeather.Nowcast != nil && (currentWeather.Nowcast.Trend == NowcastStarting || currentWeather.Nowcast.Trend == NowcastStopping) {
+		userMessage += `
+
+Precipitation is about to change (see nowcast). Lead with it in plain words, e.g. "rain starting in ~20 minutes".`
+	}
+
+	// Warn about high pollen, fire danger or road risk
+	userMessage += tomorrowPrompt(currentWeather)
+
+	// Official warnings come first and aren't paraphrased away
+	if len(currentWeather.Warnings) > 0 {
+		userMessage += `
+
+Official weather warnings are in effect (see official_warnings). Lead with them, name the issuing service, say when they expire, and tell people to follow official advice.`
+	}
+
+	// Lead with any tropical cyclone in range
+	if len(currentWeather.Storms) > 0 {
+		userMessage += `
+
+A tropical cyclone is within range (see tropical_storms). Lead with its name, category, distance and track, say clearly if it is heading this way, and tell people to follow official advisories. Don't speculate beyond the data.`
+	}
+
+	// Mention recent nearby earthquakes, since users treat this as their conditions dashboard
+	if _, ok := weatherData["recent_earthquakes"]; ok {
+		userMessage += `
+
+A noticeable earthquake happened nearby in the last few hours (see recent_earthquakes). Mention it in one factual sentence after the weather, without speculating about aftershocks or damage.`
+	}
+
+	// Ground "unusually warm" style remarks in the normals rather than the model's guesses
+	if n := currentWeather.Normals; n != nil && n.Description != "near normal" {
+		userMessage += `
+
+Today is ` + n.Description + ` for the time of year (see climate_normal and vs_normal). Say so in one sentence using the figures, e.g. how far above or below the normal high it is. Don't call it a record.`
+	}
+
+	// Offer a year-over-year comparison when last year was noticeably different
+	if ly := currentWeather.LastYear; ly != nil && ly.notable(agent.weatherUnits(currentWeather)) {
+		userMessage += `
+
+This time last year was noticeably different (see on_this_day_last_year). You may add one short year-over-year comparison, e.g. "a lot milder than this day last year".`
+	}
+
+	// Hedge the outlook when the ensemble's members disagree
+	if c := currentWeather.Confidence; c != nil && c.Level != ConfidenceHigh {
+		userMessage += `
+
+Forecast confidence for today is ` + c.Level + ` (see forecast_confidence): the ensemble's members disagree on the high or on whether it will rain. Hedge what you say about later today, e.g. "likely" or "could", give the range rather than one figure, and don't promise rain or dry weather.`
+	}
+
+	// Contrast indoor sensor readings with outside, e.g. whether to open a window
+	if _, ok := weatherData["indoor"]; ok {
+		userMessage += `
+
+Indoor sensor readings are available (see indoor and indoor_vs_outdoor). Add one short sentence contrasting inside with outside, e.g. whether opening a window would freshen stuffy air or let in warmer, colder or dirtier air.`
+	}
+
+	// Warn about wildfire smoke before air quality stations pick it up
+	if w := currentWeather.Wildfire; w != nil && (w.SmokeRisk == SmokeModerate || w.SmokeRisk == SmokeHigh) {
+		userMessage += `
+
+Active wildfires are upwind (see active_fires and smoke_risk). Warn that smoke may affect air quality even if the AQI doesn't show it yet, and suggest limiting time outdoors and keeping windows closed when smoke_risk is high.`
+	}
+
+	// Let US messages draw on the National Weather Service's forecast and reasoning
+	if currentWeather.NWS != nil {
+		userMessage += `
+
+National Weather Service data is available (nws_forecast, and forecast_discussion when present). Weave in what the NWS expects next and, where it adds insight, the forecasters' reasoning from the discussion in plain words without jargon or abbreviations.`
+	}
+
+	// For aviation/paragliding locations, ask for a short flying conditions note
+	if currentWeather.Sounding != nil {
+		userMessage += `
+
+This location is used for paragliding/aviation. Add one sentence on flying conditions using the sounding, thermal_quality, and any winds_aloft_warning provided.`
+	}
+
+	// In aviation mode, ask for a VFR/IFR flight-conditions briefing
+	if currentWeather.Aviation != nil {
+		userMessage += `
+
+Aviation mode: add a short flight-conditions briefing for the station in aviation_station. State the flight_category (VFR, MVFR, IFR or LIFR) and what drives it (ceiling, visibility), the wind including gusts, and how the TAF expects conditions to change over the next few hours. Use standard aviation units (knots, statute miles, feet) and end with a reminder that this is not an official preflight briefing.`
+	}
+
+	// Steer away from what users have disliked
+	userMessage += agent.feedbackPrompt()
+
+	// Write in the reader's own language, over the configured one
+	if currentWeather.Locale != "" {
+		userMessage += fmt.Sprintf(`
+
+Write the message in %s, whatever language the instructions above ask for.`, languageName(currentWeather.Locale))
+	}
+
+	// Call the appropriate LLM API based on configuration
+	var message string
+	var err error
+	if agent.useLLMTools() {
+		message, err = agent.callLLMWithTools(persona, userMessage, agent.weatherTools(currentWeather), params)
+	} else {
+		message, err = agent.callLLMWith(persona, userMessage, params)
+	}
+	if errors.Is(err, errNoLLMKey) {
+		return agent.renderTemplateMessage(currentWeather), nil
+	}
+	return message, err
+}
+
+// Call the Anthropic API (Claude) - updated to current API format
+func (agent *WeatherAgent) callAnthropicAPI(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	url := "https://api.anthropic.com/v1/messages"
+
+	// Create request with updated format
+	reqBody := struct {
+		Model       string             `json:"model"`
+		System      string             `json:"system"`
+		Messages    []AnthropicMessage `json:"messages"`
+		Temperature float64            `json:"temperature"`
+		MaxTokens   int                `json:"max_tokens"`
+		StopSequences []string         `json:"stop_sequences,omitempty"`
+		TopP        float64            `json:"top_p,omitempty"`
+	}{
+		Model:  params.Model,
+		System: systemPrompt,
+		Messages: []AnthropicMessage{
 			{
 				Role:    "user",
 				Content: userMessage,
 			},
 		},
 		Temperature: agent.config.LLMTemperature,
-		MaxTokens:   500,
+		MaxTokens:   params.MaxTokens,
+		StopSequences: params.Stop,
+		TopP:        params.TopP,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 
 	// Create request
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", agent.config.LLMAPIKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
+	agent.setLLMExtraHeaders(req.Header)
 
 	// Send request
-	client := &http.Client{}
+	client := agent.httpClient(llmHTTPTimeout)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 	defer resp.Body.Close()
 
 	// Log the raw response for debugging
 	bodyBytes, _ := io.ReadAll(resp.Body)
+	agent.archiveResponse("anthropic", url, resp.StatusCode, bodyBytes)
 
 	// Check response status
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return "", llmUsage{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	// Parse response
 	var result AnthropicResponse
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return "", fmt.Errorf("Error parsing response: %v\nResponse: %s", err, string(bodyBytes))
+		return "", llmUsage{}, fmt.Errorf("Error parsing response: %v\nResponse: %s", err, string(bodyBytes))
 	}
 
-	// Extract message content
+	// Extract message content and token usage
+	usage := llmUsage{InputTokens: result.Usage.InputTokens, OutputTokens: result.Usage.OutputTokens}
 	if len(result.Content) > 0 {
-		return result.Content[0].Text, nil
+		return result.Content[0].Text, usage, nil
 	}
 
-	return "", fmt.Errorf("no content in response: %s", string(bodyBytes))
+	return "", usage, fmt.Errorf("no content in response: %s", string(bodyBytes))
 }
 
 // Call the OpenAI API (GPT models)
-func (agent *WeatherAgent) callOpenAIAPI(userMessage string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
+func (agent *WeatherAgent) callOpenAIAPI(systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
+	return agent.callChatCompletions("openai", agent.openAIChatURL(), systemPrompt, userMessage, params)
+}
 
+// Call an API speaking OpenAI's chat completions format (OpenAI, Mistral and
+// OpenAI-compatible gateways)
+func (agent *WeatherAgent) callChatCompletions(provider, url, systemPrompt, userMessage string, params llmParams) (string, llmUsage, error) {
 	// Create request
 	reqBody := OpenAIRequest{
-		Model: agent.config.LLMModel,
+		Model: params.Model,
 		Messages: []OpenAIMessage{
 			{
 				Role:    "system",
-				Content: agent.config.SystemPrompt,
+				Content: systemPrompt,
 			},
 			{
 				Role:    "user",
 				Content: userMessage,
 			},
 		},
-		Temperature: agent.config.LLMTemperature,
-		MaxTokens:   500,
+		Temperature:      agent.config.LLMTemperature,
+		MaxTokens:        params.MaxTokens,
+		Stop:             params.Stop,
+		TopP:             params.TopP,
+		FrequencyPenalty: params.FrequencyPenalty,
+		PresencePenalty:  params.PresencePenalty,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 
 	// Create request
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+agent.config.LLMAPIKey)
+	if agent.config.LLMAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+agent.config.LLMAPIKey)
+	}
+	agent.setLLMExtraHeaders(req.Header)
 
 	// Send request
-	client := &http.Client{}
+	client := agent.httpClient(llmHTTPTimeout)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", llmUsage{}, err
 	}
 	defer resp.Body.Close()
 
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", llmUsage{}, err
+	}
+	agent.archiveResponse(provider, url, resp.StatusCode, bodyBytes)
+
 	// Check response status
 	if resp.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return "", llmUsage{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	// Parse response
 	var result OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		return "", llmUsage{}, err
 	}
 
-	// Extract message content
+	// Extract message content and token usage
+	usage := llmUsage{InputTokens: result.Usage.PromptTokens, OutputTokens: result.Usage.CompletionTokens}
 	if len(result.Choices) > 0 {
-		return result.Choices[0].Message.Content, nil
+		return result.Choices[0].Message.Content, usage, nil
 	}
 
-	return "", fmt.Errorf("no content in response")
+	return "", usage, fmt.Errorf("no content in response")
 }
 
-// Generate weather history context
-func (agent *WeatherAgent) generateHistoryContext() string {
-	if len(agent.weatherHistory) <= 1 {
+// Generate weather history context from the previous reading for the same location
+func (agent *WeatherAgent) generateHistoryContext(weather WeatherResponse) string {
+	prevWeather, ok := agent.weatherHistory.previous(weatherLocationKey(weather))
+	if !ok {
 		return "" // Not enough history yet
 	}
 
 	var context strings.Builder
 
 	// Add the previous weather entry
-	prevWeather := agent.weatherHistory[len(agent.weatherHistory)-2]
 	prevLocationTimezone := time.FixedZone("Local", prevWeather.Timezone)
 	prevTime := time.Unix(prevWeather.Dt, 0).In(prevLocationTimezone)
 
@@ -1658,12 +2355,15 @@ func (agent *WeatherAgent) generateHistoryContext() string {
 		context.WriteString(fmt.Sprintf("- Condition: %s (%s)\n",
 			prevWeather.Weather[0].Main, prevWeather.Weather[0].Description))
 	}
+	// History is kept in the configured units; show it in the current reading's
+	system := agent.weatherUnits(weather)
+	prevWeather = convertWeatherUnits(prevWeather, agent.units(), system)
 	context.WriteString(fmt.Sprintf("- Temperature: %.1f%s (feels like %.1f%s)\n",
-		prevWeather.Main.Temp, agent.getTempUnit(),
-		prevWeather.Main.FeelsLike, agent.getTempUnit()))
+		prevWeather.Main.Temp, system.TemperatureSymbol(),
+		prevWeather.Main.FeelsLike, system.TemperatureSymbol()))
 	context.WriteString(fmt.Sprintf("- Humidity: %d%%\n", prevWeather.Main.Humidity))
 	context.WriteString(fmt.Sprintf("- Wind: %.1f %s\n",
-		prevWeather.Wind.Speed, agent.getWindUnit()))
+		prevWeather.Wind.Speed, system.SpeedUnit()))
 
 	return context.String()
 }
@@ -1676,52 +2376,31 @@ func (agent *WeatherAgent) update() {
 	weather, err := agent.fetchWeather()
 	if err != nil {
 		agent.logger.Printf("Error fetching weather: %v", err)
-		fmt.Printf("Error fetching weather: %v\n", err)
 		return
 	}
 
 	// Add to history
-	agent.weatherHistory = append(agent.weatherHistory, weather)
-
-	// Keep history to a reasonable size
-	if len(agent.weatherHistory) > 24 {
-		agent.weatherHistory = agent.weatherHistory[1:]
-	}
+	agent.recordWeather(weather)
 
 	// Generate history context
-	historyContext := agent.generateHistoryContext()
+	historyContext := agent.generateHistoryContext(weather)
 
 	// Generate message using LLM
-	message, err := agent.generateLLMMessage(weather, historyContext)
+	message, err := agent.generateLLMMessage(weather, historyContext, agent.config.Persona, agent.llmParams())
 	if err != nil {
 		agent.logger.Printf("Error generating LLM message: %v", err)
 		return
 	}
 
-	// Check if the message is too similar to the last one
-	if strings.TrimSpace(message) == strings.TrimSpace(agent.lastMessage) {
-		agent.logger.Printf("LLM generated identical message, adding variation request and retrying")
-
-		// Add a request for variation
-		variedMessage, err := agent.generateLLMMessage(weather,
-			historyContext+"\nIMPORTANT: Please generate a completely different message than before.")
-
-		if err == nil && strings.TrimSpace(variedMessage) != strings.TrimSpace(agent.lastMessage) {
-			message = variedMessage
-		} else {
-			// If failed to get variation, add a timestamp to make it different
-			currentTime := time.Unix(weather.Dt, 0).UTC().Add(time.Second * time.Duration(weather.Timezone))
-			message = fmt.Sprintf("[%s] %s", currentTime.Format("15:04"), message)
-		}
-	}
+	// Check if the message is too similar to the recent ones
+	message = agent.varyMessage(weather, historyContext, message)
 
 	// Log the message
 	timeStr := time.Now().Format("15:04:05")
 	agent.logger.Printf("[%s] %s\n", timeStr, message)
 
 	// Update last message
-	agent.lastMessage = message
-	agent.lastMessageTime = time.Now()
+	agent.setLastMessage(weatherLocationKey(weather), message)
 }
 
 // Modify the loadConfig function to remove hardcoded secrets
@@ -1735,29 +2414,218 @@ func loadConfig() Config {
 		WeatherAPIKey:  getEnv("WEATHER_API_KEY", "not-needed"), // Open-Meteo doesn't need an API key
 		LLMAPIKey:      getEnv("LLM_API_KEY", ""),               // Never hardcode API keys
 		IQAirAPIKey:    getEnv("IQAIR_API_KEY", ""),             // IQAir API key for air quality data
+		TomorrowAPIKey: getEnv("TOMORROW_API_KEY", ""),
+		FIRMSMapKey:    getEnv("FIRMS_MAP_KEY", ""),
+		MetOfficeAPIKey: getEnv("METOFFICE_API_KEY", ""),
 		City:           getEnv("WEATHER_CITY", "London"),
 		CountryCode:    getEnv("WEATHER_COUNTRY", "uk"),
 		CheckInterval:  getEnvInt("WEATHER_CHECK_INTERVAL", 1),
 		Units:          getEnv("WEATHER_UNITS", "metric"), // metric or imperial
+		Locale:         getEnv("LOCALE", getEnv("LLM_LANGUAGE", defaultLocale)),
+		LLMLanguage:    getEnv("LLM_LANGUAGE", ""),
 		LogToFile:      getEnvBool("WEATHER_LOG_TO_FILE", false),
 		LogFile:        getEnv("WEATHER_LOG_FILE", "weather.log"),
+		LogRotation: LogRotationConfig{
+			MaxSizeMB:   getEnvInt("WEATHER_LOG_MAX_SIZE_MB", 10),
+			RotateHours: getEnvInt("WEATHER_LOG_ROTATE_HOURS", 24),
+			MaxBackups:  getEnvInt("WEATHER_LOG_MAX_BACKUPS", 7),
+			MaxAgeDays:  getEnvInt("WEATHER_LOG_MAX_AGE_DAYS", 30),
+		},
+		IQAirLogFile:   getEnv("IQAIR_LOG_FILE", "iqair_api_calls.log"),
 		LLMProvider:    getEnv("LLM_PROVIDER", "anthropic"),
 		LLMModel:       getEnv("LLM_MODEL", "claude-3-haiku-20240307"),
+		LLMModelB:      getEnv("LLM_MODEL_B", ""),
 		LLMTemperature: getEnvFloat("LLM_TEMPERATURE", 0.7),
+		LLMTools:       getEnvBool("LLM_TOOLS", false),
+		LLMBaseURL:     getEnv("LLM_BASE_URL", ""),
+		LLMExtraHeaders: splitRuleList(getEnv("LLM_EXTRA_HEADERS", "")),
+		LLMMaxTokens:   getEnvInt("LLM_MAX_TOKENS", 500),
+		LLMStop:        parseStopSequences(getEnv("LLM_STOP", "")),
+		LLMTopP:        getEnvFloat("LLM_TOP_P", 0),
+		LLMFrequencyPenalty: getEnvFloat("LLM_FREQUENCY_PENALTY", 0),
+		LLMPresencePenalty:  getEnvFloat("LLM_PRESENCE_PENALTY", 0),
 		SystemPrompt:   getEnv("LLM_SYSTEM_PROMPT", ""),
+		Persona:        getEnv("PERSONA", ""),
+
+		RateLimitPerMinute: getEnvInt("RATE_LIMIT_PER_MINUTE", 10),
+		RateLimitBurst:     getEnvInt("RATE_LIMIT_BURST", 3),
+		TrustProxyHeaders:  getEnvBool("TRUST_PROXY_HEADERS", false),
+		TrustedProxyHops:   getEnvInt("TRUSTED_PROXY_HOPS", 1),
+
+		SkinType: getEnvInt("SKIN_TYPE", 3),
+
+		HealthSensitivities: getEnvList("HEALTH_SENSITIVITIES"),
+
+		AdvisoryThresholds: getEnvList("ADVISORY_THRESHOLDS"),
+
+		APIKeys: getEnvList("API_KEYS"),
+
+		CORS: CORSConfig{
+			AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+			AllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS"),
+			AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getEnvInt("CORS_MAX_AGE", 600),
+		},
+
+		UIAuth: UIAuthConfig{
+			Mode:              strings.ToLower(getEnv("UI_AUTH", UIAuthOff)),
+			BasicUsers:        getEnvList("UI_BASIC_USERS"),
+			OIDCIssuer:        getEnv("OIDC_ISSUER", ""),
+			OIDCClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			OIDCClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+			OIDCAllowedEmails: getEnvList("OIDC_ALLOWED_EMAILS"),
+			AdminUsers:        getEnvList("UI_ADMIN_USERS"),
+			SessionSecret:     getEnv("UI_SESSION_SECRET", ""),
+			SessionHours:      getEnvInt("UI_SESSION_HOURS", 24),
+		},
+
+		LocationTags:    getEnvList("LOCATION_TAGS"),
+		AviationStation: strings.ToUpper(getEnv("AVIATION_STATION", "")),
+
+		SMTP: SMTPConfig{
+			Host:       getEnv("SMTP_HOST", ""),
+			Port:       getEnvInt("SMTP_PORT", 587),
+			Username:   getEnv("SMTP_USERNAME", ""),
+			Password:   getEnv("SMTP_PASSWORD", ""),
+			From:       getEnv("SMTP_FROM", ""),
+			Recipients: getEnvList("EMAIL_RECIPIENTS"),
+		},
+		DigestTime: getEnv("DIGEST_TIME", "07:00"),
+
+		Comfort: ComfortConfig{
+			Enabled:     getEnvBool("PRECONDITION_ENABLED", false),
+			MinTemp:     getEnvFloat("COMFORT_MIN_TEMP", 18),
+			MaxTemp:     getEnvFloat("COMFORT_MAX_TEMP", 25),
+			LeadMinutes: getEnvInt("PRECONDITION_LEAD_MINUTES", 60),
+		},
+
+		AlertRules:           splitRuleList(getEnv("ALERT_RULES", "")),
+		AlertCooldownMinutes: getEnvInt("ALERT_COOLDOWN_MINUTES", 180),
+		WindGustAlert:        getEnvFloat("WIND_GUST_ALERT", 0),
+
+		RedisURL:        getEnv("REDIS_URL", ""),
+		CacheTTLSeconds: getEnvInt("CACHE_TTL_SECONDS", 300),
+
+		HistoryFile:           getEnv("HISTORY_FILE", ""),
+		HistoryRetentionHours: getEnvInt("HISTORY_RETENTION_HOURS", 168),
+		HistoryAggregateDays:  getEnvInt("HISTORY_AGGREGATE_DAYS", 0),
+		DatabaseURL:           getEnv("DATABASE_URL", ""),
+
+		TelegramBotToken:  getEnv("TELEGRAM_BOT_TOKEN", ""),
+		PushoverAppToken:  getEnv("PUSHOVER_APP_TOKEN", ""),
+		PushoverUserKey:   getEnv("PUSHOVER_USER_KEY", ""),
+		MatrixHomeserver:  getEnv("MATRIX_HOMESERVER_URL", ""),
+		MatrixAccessToken: getEnv("MATRIX_ACCESS_TOKEN", ""),
+		MatrixRoomID:      getEnv("MATRIX_ROOM_ID", ""),
+		GoogleChatWebhook: getEnv("GOOGLE_CHAT_WEBHOOK_URL", ""),
+		TeamsWebhook:      getEnv("TEAMS_WEBHOOK_URL", ""),
+		NotifierRoutes:    splitRuleList(getEnv("NOTIFIER_ROUTES", "")),
+		QuietHours:        splitRuleList(getEnv("NOTIFIER_QUIET_HOURS", "")),
+		BatchTimes:        splitRuleList(getEnv("NOTIFIER_BATCH_TIMES", "")),
+		SubscriptionsFile: getEnv("SUBSCRIPTIONS_FILE", "subscriptions.json"),
+		SubscriptionMaxLocations: getEnvInt("SUBSCRIPTION_MAX_LOCATIONS", 25),
+		ProfilesFile:      getEnv("PROFILES_FILE", "profiles.json"),
+		WebhooksFile:      getEnv("WEBHOOKS_FILE", ""),
+		RuntimeConfigFile: getEnv("RUNTIME_CONFIG_FILE", ""),
+
+		CalendarLocations: splitRuleList(getEnv("CALENDAR_LOCATIONS", "")),
+
+		LLMCacheMinutes: getEnvInt("LLM_CACHE_MINUTES", 30),
+
+		MessageSimilarity: getEnvFloat("MESSAGE_SIMILARITY", 0.7),
+		RecentMessages:    getEnvInt("RECENT_MESSAGES", 5),
+		FeedbackGuidance:  getEnvBool("FEEDBACK_GUIDANCE", false),
+
+		LLMDailyTokenBudget:   getEnvInt("LLM_DAILY_TOKEN_BUDGET", 0),
+		LLMDailyCostBudget:    getEnvFloat("LLM_DAILY_COST_BUDGET", 0),
+		LLMInputPricePerMTok:  getEnvFloat("LLM_INPUT_PRICE_PER_MTOK", 0),
+		LLMOutputPricePerMTok: getEnvFloat("LLM_OUTPUT_PRICE_PER_MTOK", 0),
+
+		ArchiveSize:     getEnvInt("ARCHIVE_SIZE", 0),
+		ArchiveMaxBytes: getEnvInt("ARCHIVE_MAX_BYTES", 64*1024),
+
+		PromptLogSize: getEnvInt("PROMPT_LOG_SIZE", 200),
+		PromptLogFile: getEnv("PROMPT_LOG_FILE", ""),
+
+		NWSEnabled: getEnvBool("NWS_ENABLED", false),
+
+		DWDEnabled: getEnvBool("DWD_ENABLED", false),
+		DWDStation: strings.ToUpper(strings.TrimSpace(getEnv("DWD_STATION", ""))),
+
+		WildfireRadiusKm: getEnvInt("WILDFIRE_RADIUS_KM", 150),
+		CycloneRadiusKm:  getEnvInt("CYCLONE_RADIUS_KM", 1000),
+
+		EarthquakeRadiusKm:     getEnvInt("EARTHQUAKE_RADIUS_KM", 300),
+		EarthquakeMinMagnitude: getEnvFloat("EARTHQUAKE_MIN_MAGNITUDE", 4.0),
+
+		GardenGDDBase: getEnvFloat("GARDEN_GDD_BASE", 10),
+
+		CommuteHome:    getEnv("COMMUTE_HOME", ""),
+		CommuteWork:    getEnv("COMMUTE_WORK", ""),
+		CommuteTimes:   getEnvList("COMMUTE_TIMES"),
+		CommuteMinutes: getEnvInt("COMMUTE_MINUTES", defaultCommuteMinutes),
+
+		RadarProvider:     strings.ToLower(getEnv("RADAR_PROVIDER", RadarRainViewer)),
+		RadarCacheSeconds: getEnvInt("RADAR_CACHE_SECONDS", 300),
+
+		BreakerThreshold:       getEnvInt("CIRCUIT_BREAKER_THRESHOLD", 5),
+		BreakerCooldownSeconds: getEnvInt("CIRCUIT_BREAKER_COOLDOWN_SECONDS", 60),
+
+		FetchConcurrency: getEnvInt("FETCH_CONCURRENCY", 4),
+
+		HTTPTimeoutSeconds:      getEnvInt("HTTP_TIMEOUT_SECONDS", 30),
+		HTTPMaxIdleConns:        getEnvInt("HTTP_MAX_IDLE_CONNS", 100),
+		HTTPMaxIdleConnsPerHost: getEnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 10),
+
+		UpdateIntervalMinutes:    getEnvInt("UPDATE_INTERVAL_MINUTES", 0),
+		UpdateMaxIntervalMinutes: getEnvInt("UPDATE_MAX_INTERVAL_MINUTES", 24*60),
+		EngagementBaseURL:        getEnv("ENGAGEMENT_BASE_URL", ""),
+		EngagementSecret:         getEnv("ENGAGEMENT_SECRET", ""),
+
+		PlaylistSuggestions:  getEnvBool("PLAYLIST_SUGGESTIONS", false),
+		PlaylistRules:        splitRuleList(getEnv("PLAYLIST_RULES", "")),
+		PlaylistLinkTemplate: getEnv("PLAYLIST_LINK_TEMPLATE", ""),
+		PlaylistInPrompt:     getEnvBool("PLAYLIST_IN_PROMPT", false),
+
+		ReportPeriods: getEnvList("REPORT_PERIODS"),
+		ReportsDir:    getEnv("REPORTS_DIR", "reports"),
+
+		MedicalGuardrail: parseGuardrailLevel(getEnv("MEDICAL_GUARDRAIL", GuardrailOff)),
+
+		SlackStatusTokens: getEnvList("SLACK_STATUS_TOKENS"),
+
+		MQTTURL:             getEnv("MQTT_URL", ""),
+		MQTTDiscoveryPrefix: getEnv("MQTT_DISCOVERY_PREFIX", "homeassistant"),
+
+		FeatureFlags: getEnvList("FEATURE_FLAGS"),
+		AdminAPIKeys: getEnvList("ADMIN_API_KEYS"),
 	}
 
 	// Validate LLM model based on provider
 	if config.LLMProvider == "anthropic" && !strings.Contains(config.LLMModel, "claude") {
 		// Default to Claude if not specified properly
 		config.LLMModel = "claude-3-haiku-20240307"
-	} else if config.LLMProvider == "openai" && !strings.Contains(config.LLMModel, "gpt") {
-		// Default to GPT if not specified properly
+	} else if config.LLMProvider == "openai" && config.LLMBaseURL == "" && !strings.Contains(config.LLMModel, "gpt") {
+		// Default to GPT if not specified properly; gateways name their models their own way
 		config.LLMModel = "gpt-3.5-turbo"
+	} else if d, ok := defaultLLMModels[config.LLMProvider]; ok && !strings.Contains(config.LLMModel, d.Prefix) {
+		config.LLMModel = d.Model
+	}
+
+	// Use the canonical persona name; unknown ones are reported by validateConfig
+	if p, ok := findPersona(config.Persona); ok {
+		config.Persona = p.Name
+	}
+	if groups, err := parseSensitivities(config.HealthSensitivities); err == nil {
+		config.HealthSensitivities = groups
 	}
 
 	// Override with command line arguments if provided
 	args := os.Args[1:]
+	if len(args) >= 1 && args[0] == "replay" {
+		args = nil // A command, not a location
+	}
 	if len(args) >= 1 && args[0] != "" {
 		config.City = args[0]
 	}
@@ -1851,6 +2719,34 @@ func getEnvFloat(key string, defaultValue float64) float64 {
 	return floatValue
 }
 
+// Helper function to get a comma-separated list environment variable
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Split alert rules separated by semicolons or newlines
+func splitRuleList(value string) []string {
+	var rules []string
+	for _, rule := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
 // Helper function to get boolean environment variable
 func getEnvBool(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
@@ -1880,13 +2776,13 @@ func (agent *WeatherAgent) debugTimeInfo(weather WeatherResponse) {
 }
 
 // Modify the main function to load secrets before config
-func testIQAirAPI(apiKey string) {
+func testIQAirAPI(apiKey string, out io.Writer) {
 	if apiKey == "" {
-		fmt.Println("ERROR: IQAir API key is empty")
+		fmt.Fprintln(out, "ERROR: IQAir API key is empty")
 		return
 	}
 	
-	fmt.Printf("Testing IQAir API with key: %s (length: %d)\n", apiKey[:4] + "...", len(apiKey))
+	fmt.Fprintf(out, "Testing IQAir API with a key of length %d\n", len(apiKey))
 	
 	// Test with New York coordinates
 	lat, lon := 40.7128, -74.0060
@@ -1894,7 +2790,7 @@ func testIQAirAPI(apiKey string) {
 	iqairURL := fmt.Sprintf("https://api.airvisual.com/v2/nearest_city?lat=%.6f&lon=%.6f&key=%s",
 		lat, lon, apiKey)
 	
-	fmt.Printf("DEBUG: IQAir API URL: %s\n", strings.Replace(iqairURL, apiKey, "[REDACTED]", 1))
+	fmt.Fprintf(out, "DEBUG: IQAir API URL: %s\n", redactSecrets(iqairURL, []string{apiKey}))
 	
 	client := &http.Client{
 		Timeout: time.Second * 10,
@@ -1903,131 +2799,411 @@ func testIQAirAPI(apiKey string) {
 	req, _ := http.NewRequest("GET", iqairURL, nil)
 	req.Header.Add("User-Agent", "WeatherAgent/1.0")
 	
-	fmt.Println("DEBUG: Sending request to IQAir API...")
+	fmt.Fprintln(out, "DEBUG: Sending request to IQAir API...")
 	
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to call IQAir API: %v\n", err)
+		fmt.Fprintf(out, "ERROR: Failed to call IQAir API: %s\n", redactSecrets(err.Error(), []string{apiKey}))
 		return
 	}
 	defer resp.Body.Close()
 	
-	fmt.Printf("DEBUG: IQAir API response status: %d\n", resp.StatusCode)
+	fmt.Fprintf(out, "DEBUG: IQAir API response status: %d\n", resp.StatusCode)
 	
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to read response body: %v\n", err)
+		fmt.Fprintf(out, "ERROR: Failed to read response body: %v\n", err)
 		return
 	}
 	
-	fmt.Printf("DEBUG: IQAir API response body: %s\n", string(bodyBytes))
+	fmt.Fprintf(out, "DEBUG: IQAir API response body: %s\n", string(bodyBytes))
 	
 	var result map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		fmt.Printf("ERROR: Failed to parse JSON response: %v\n", err)
+		fmt.Fprintf(out, "ERROR: Failed to parse JSON response: %v\n", err)
 		return
 	}
 	
-	fmt.Printf("DEBUG: Parsed response: %+v\n", result)
+	fmt.Fprintf(out, "DEBUG: Parsed response: %+v\n", result)
 }
 
 func main() {
 	// Load secrets and config as before
 	loadSecretsFromFile(".env")
 	config := loadConfig()
+	// Scrub secrets from the standard logger too, used where the agent's isn't
+	log.SetOutput(redactingWriter{w: os.Stderr, secrets: config.secrets()})
+
+	// A location chosen in the UI overrides WEATHER_CITY and WEATHER_COUNTRY
+	settings, err := loadRuntimeSettings(config.RuntimeConfigFile)
+	if err != nil {
+		fmt.Printf("Invalid RUNTIME_CONFIG_FILE: %v\n", err)
+		os.Exit(1)
+	}
+	if settings.City != "" {
+		config.City, config.CountryCode = settings.City, settings.Country
+	}
+
+	// Report every configuration problem at once and refuse to start on errors
+	issues := validateConfig(config)
+	printConfigDiagnostics(os.Stdout, issues)
+	if hasConfigErrors(issues) {
+		fmt.Println("Fix the errors above and restart.")
+		os.Exit(1)
+	}
 
 	// Test IQAir API directly
 	fmt.Println("=====================")
 	fmt.Println("TESTING IQAIR API")
 	fmt.Println("=====================")
-	testIQAirAPI(config.IQAirAPIKey)
+	testIQAirAPI(config.IQAirAPIKey, redactingWriter{w: os.Stdout, secrets: config.secrets()})
 	fmt.Println("=====================")
 
-	// Check for required API key
-	if config.LLMAPIKey == "" {
-		fmt.Println("LLM API key not set. Please set LLM_API_KEY environment variable or add it to a .env file.")
-		fmt.Println("You can create a .env file with your API key like this:")
-		fmt.Println("LLM_API_KEY=your_api_key_here")
+	// Create our AI agent
+	agent := NewWeatherAgent(config)
+
+	// Share the upstream cache and last-message state through Redis if configured
+	if config.RedisURL != "" {
+		cache, err := newCacheStore(config.RedisURL)
+		if err != nil {
+			agent.logger.Printf("Invalid REDIS_URL: %v", err)
+			os.Exit(1)
+		}
+		agent.cache = cache
+		fmt.Println("Using Redis for the shared cache")
+	}
+
+	// Keep history, subscriptions and LLM usage in Postgres if configured
+	if config.DatabaseURL != "" {
+		db, err := newStorage(config.DatabaseURL)
+		if err != nil {
+			agent.logger.Printf("Error opening database: %v", err)
+			os.Exit(1)
+		}
+		agent.db = db
+		agent.sensors = newDatabaseSensorStore(db)
+		agent.prompts = newDatabasePromptLog(db, config.PromptLogSize)
+		fmt.Println("Using Postgres for history, subscriptions, usage, sensor readings and prompts")
+	}
+
+	// Persist observations for /api/history in the database or a history file if configured
+	if agent.db != nil {
+		agent.observations = newDatabaseObservationStore(agent.db, time.Duration(config.HistoryRetentionHours)*time.Hour, config.historyAggregateRetention())
+	} else if config.HistoryFile != "" {
+		store, err := newObservationStore(config.HistoryFile, time.Duration(config.HistoryRetentionHours)*time.Hour, config.historyAggregateRetention())
+		if err != nil {
+			agent.logger.Printf("Error loading weather history: %v", err)
+			os.Exit(1)
+		}
+		agent.observations = store
+	}
+
+	// Keep the prompt log across restarts in the database or a file if configured
+	if agent.db == nil && config.PromptLogFile != "" && config.PromptLogSize > 0 {
+		prompts, err := newPromptLog(config.PromptLogFile, config.PromptLogSize)
+		if err != nil {
+			agent.logger.Printf("Error loading prompt log: %v", err)
+			os.Exit(1)
+		}
+		agent.prompts = prompts
+	}
+
+	// weather-agent replay <prompt-id> [model] re-runs a logged prompt and exits
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplayCommand(agent, os.Args[2:], os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Feature flags, adjustable at runtime through the admin API
+	features, err := newFeatureFlags(config.FeatureFlags)
+	if err != nil {
+		fmt.Printf("Invalid FEATURE_FLAGS: %v\n", err)
 		os.Exit(1)
 	}
+	agent.features = features
 
-	// Create our AI agent
-	agent := NewWeatherAgent(config)
+	routes, err := parseNotifierRoutes(config.NotifierRoutes)
+	if err != nil {
+		fmt.Printf("Invalid NOTIFIER_ROUTES: %v\n", err)
+		os.Exit(1)
+	}
+	agent.notifierRoutes = routes
 
-	// Helper function to generate fresh weather data and message
-	generateWeatherUpdate := func() (string, string, string, string, map[string]interface{}, error) {
-		// Get current city/country from environment (might have been updated)
-		currentCity := getEnv("WEATHER_CITY", config.City)
-		currentCountry := getEnv("WEATHER_COUNTRY", config.CountryCode)
+	schedules, err := parseDeliverySchedules(config.QuietHours, config.BatchTimes)
+	if err != nil {
+		fmt.Printf("Invalid notifier schedule: %v\n", err)
+		os.Exit(1)
+	}
+	if len(schedules) > 0 {
+		agent.outbox = newNotificationOutbox(schedules)
+		go agent.runOutbox()
+	}
+
+	// Set up the email notifier and daily digest if SMTP is configured
+	if config.SMTP.Host != "" {
+		emailNotifier, err := newEmailNotifier(config.SMTP)
+		if err != nil {
+			agent.logger.Printf("Email notifications disabled: %v", err)
+		} else {
+			agent.notifiers = append(agent.notifiers, emailNotifier)
+		}
+	}
 
-		// Update agent config
-		agent.config.City = currentCity
-		agent.config.CountryCode = currentCountry
+	// Pushover receives the digest and alerts
+	if config.PushoverAppToken != "" || config.PushoverUserKey != "" {
+		pushover, err := newPushoverNotifier(config.PushoverAppToken, config.PushoverUserKey)
+		if err != nil {
+			agent.logger.Printf("Pushover notifications disabled: %v", err)
+		} else {
+			pushover.client = agent.httpClient(notifierHTTPTimeout)
+			agent.notifiers = append(agent.notifiers, pushover)
+		}
+	}
 
-		// Get weather update
-		weather, err := agent.fetchWeather()
+	// A Matrix room receives the digest, updates and alerts
+	if config.MatrixRoomID != "" {
+		matrix, err := newMatrixNotifier(config.MatrixHomeserver, config.MatrixAccessToken, config.MatrixRoomID)
+		if err != nil {
+			agent.logger.Printf("Matrix notifications disabled: %v", err)
+		} else {
+			matrix.client = agent.httpClient(notifierHTTPTimeout)
+			agent.notifiers = append(agent.notifiers, matrix)
+		}
+	}
+
+	// Workplace chats get the morning briefing as a card
+	if config.GoogleChatWebhook != "" {
+		googleChat, err := newGoogleChatNotifier(config.GoogleChatWebhook)
+		if err != nil {
+			agent.logger.Printf("Google Chat notifications disabled: %v", err)
+		} else {
+			googleChat.client = agent.httpClient(notifierHTTPTimeout)
+			agent.notifiers = append(agent.notifiers, googleChat)
+		}
+	}
+	if config.TeamsWebhook != "" {
+		teams, err := newTeamsNotifier(config.TeamsWebhook)
+		if err != nil {
+			agent.logger.Printf("Teams notifications disabled: %v", err)
+		} else {
+			teams.client = agent.httpClient(notifierHTTPTimeout)
+			agent.notifiers = append(agent.notifiers, teams)
+		}
+	}
+
+	// Outbound webhooks receiving the weather data and message
+	if config.WebhooksFile != "" {
+		webhooks, err := loadWebhooks(config.WebhooksFile)
+		if err != nil {
+			fmt.Printf("Invalid WEBHOOKS_FILE: %v\n", err)
+			os.Exit(1)
+		}
+		for _, webhook := range webhooks {
+			webhook.client = agent.httpClient(notifierHTTPTimeout)
+			agent.notifiers = append(agent.notifiers, webhook)
+		}
+	}
+
+	// User-managed notification endpoints from the settings page
+	var subscriptions *subscriptionStore
+	if agent.db != nil {
+		subscriptions, err = newDatabaseSubscriptionStore(agent.db)
+	} else {
+		subscriptions, err = newSubscriptionStore(config.SubscriptionsFile)
+	}
+	if err != nil {
+		fmt.Printf("Error loading subscriptions: %v\n", err)
+		os.Exit(1)
+	}
+	subscriptions.maxLocations = config.SubscriptionMaxLocations
+	agent.subscriptions = subscriptions
+
+	// Saved user preferences (location, units, language, persona)
+	profiles, err := newProfileStore(config.ProfilesFile)
+	if err != nil {
+		fmt.Printf("Error loading profiles: %v\n", err)
+		os.Exit(1)
+	}
+	agent.profiles = profiles
+
+	// The digest is skipped on days nobody is subscribed to it
+	go agent.runDigestScheduler(config.DigestTime)
+
+	// Start the alert monitor. It fetches the weather only while rules are
+	// configured, DWD warnings are to be passed on, or cyclone or earthquake
+	// alerts have someone to go to, so those flags take effect without a restart.
+	rules, err := parseAlertRules(alertRuleExprs(config))
+	if err != nil {
+		fmt.Printf("Invalid alert rules: %v (supported fields: %s)\n", err, strings.Join(ruleFieldNames(), ", "))
+		os.Exit(1)
+	}
+	agent.alertRules = rules
+	if len(rules) > 0 && !agent.hasRecipients(NotificationAlert) {
+		agent.logger.Printf("Warning: %d alert rule(s) configured but no notifiers or subscriptions are set up", len(rules))
+	}
+	go agent.runAlertMonitor()
+
+	// Downsample observations past their retention to hourly averages if configured
+	if config.HistoryAggregateDays > 0 {
+		go agent.runHistoryCompaction()
+	}
+
+	// Generate weekly/monthly climate summaries from the stored observations
+	if len(config.ReportPeriods) > 0 {
+		go agent.runReportScheduler(config.ReportPeriods)
+	}
+
+	// Start the appliance pre-conditioning advisor if enabled
+	if config.Comfort.Enabled {
+		go agent.runPreconditionScheduler()
+	}
+
+	// Keep users' Slack status in sync with the weather if tokens are configured
+	if len(config.SlackStatusTokens) > 0 {
+		updater := newSlackStatusUpdater(config.SlackStatusTokens)
+		updater.client = agent.httpClient(notifierHTTPTimeout)
+		go agent.runStatusUpdater(updater)
+	}
+
+	// Publish the conditions to Home Assistant over MQTT if a broker is configured
+	if config.MQTTURL != "" {
+		client, err := newMQTTClient(config.MQTTURL)
 		if err != nil {
-			return "", "", "", "", nil, fmt.Errorf("error fetching weather: %v", err)
+			fmt.Printf("Invalid MQTT_URL: %v\n", err)
+			os.Exit(1)
 		}
+		go agent.runHomeAssistantPublisher(client)
+	}
 
-		// Add to history for context
-		agent.weatherHistory = append(agent.weatherHistory, weather)
-		if len(agent.weatherHistory) > 24 {
-			agent.weatherHistory = agent.weatherHistory[1:]
+	// Parse heat and cold advisory threshold overrides
+	if len(config.AdvisoryThresholds) > 0 {
+		thresholds, err := parseAdvisoryThresholds(config.AdvisoryThresholds, agent.units())
+		if err != nil {
+			fmt.Printf("Invalid ADVISORY_THRESHOLDS: %v\n", err)
+			os.Exit(1)
 		}
+		agent.advisoryThresholds = thresholds
+	}
+
+	// Parse custom playlist mappings
+	if len(config.PlaylistRules) > 0 {
+		rules, err := parsePlaylistRules(config.PlaylistRules)
+		if err != nil {
+			fmt.Printf("Invalid PLAYLIST_RULES: %v\n", err)
+			os.Exit(1)
+		}
+		agent.playlistRules = rules
+	}
+
+	// Send scheduled updates, backing off for recipients who ignore them
+	if config.UpdateIntervalMinutes > 0 {
+		go agent.runUpdateScheduler()
+	}
+
+	// Helper function to generate fresh weather data and message
+	generateWeatherUpdate := func(persona string, params llmParams, profile Profile) (string, string, string, string, map[string]interface{}, string, error) {
+		// Get weather update
+		fetched, err := agent.fetchWeather()
+		if err != nil {
+			return "", "", "", "", nil, "", fmt.Errorf("error fetching weather: %v", err)
+		}
+
+		// Add to history for context, then switch to the caller's units and language
+		agent.recordWeather(fetched)
+		weather := agent.applyProfile(fetched, profile)
 
 		// Generate weather message
-		historyContext := agent.generateHistoryContext()
-		message, err := agent.generateLLMMessage(weather, historyContext)
+		historyContext := agent.generateHistoryContext(weather)
+		message, err := agent.cachedLLMMessage(weather, historyContext, persona, params)
 		if err != nil {
-			return "", "", "", "", nil, fmt.Errorf("error generating LLM message: %v", err)
+			return "", "", "", "", nil, "", fmt.Errorf("error generating LLM message: %v", err)
 		}
+		agent.shareMessage(weather, historyContext, persona, params, message)
 
 		// Prepare weather data
 		weatherData := agent.prepareWeatherData(weather)
+		agent.markDegraded(weather, weatherData)
+		agent.addPlaylist(weather, weatherData)
 		timeStr := time.Now().Format(time.RFC1123)
 
+		// Alert notifiers about meteor showers/eclipses visible tonight, in
+		// the configured units and language as they go to everyone
+		if !weather.personalized() {
+			agent.checkAstronomyAlerts(weather, weatherData)
+		} else if agent.hasRecipients(NotificationAlert) {
+			agent.checkAstronomyAlerts(fetched, agent.prepareWeatherData(fetched))
+		}
+
 		// Log the message
 		agent.logger.Printf("[%s] Generated fresh weather message for %s: %s",
-			time.Now().Format("15:04:05"), currentCity, message)
+			time.Now().Format("15:04:05"), weather.Name, message)
 
-		return message, currentCity, currentCountry, timeStr, weatherData, nil
+		return message, weather.Name, weather.Sys.Country, timeStr, weatherData, agent.messageFingerprint(weather), nil
 	}
 
 	// Helper function to generate weather data using coordinates instead of city name
-	generateWeatherUpdateByCoordinates := func(lat, lon float64) (string, string, string, string, map[string]interface{}, error) {
+	generateWeatherUpdateByCoordinates := func(lat, lon float64, persona string, params llmParams, profile Profile) (string, string, string, string, map[string]interface{}, string, error) {
 		// Create a custom weather fetching function for coordinates
 		weather, err := agent.fetchWeatherByCoordinates(lat, lon)
 		if err != nil {
-			return "", "", "", "", nil, fmt.Errorf("error fetching weather by coordinates: %v", err)
+			return "", "", "", "", nil, "", fmt.Errorf("error fetching weather by coordinates: %v", err)
 		}
 
-		// Add to history for context
-		agent.weatherHistory = append(agent.weatherHistory, weather)
-		if len(agent.weatherHistory) > 24 {
-			agent.weatherHistory = agent.weatherHistory[1:]
-		}
+		// Add to history for context, then switch to the caller's units and language
+		agent.recordWeather(weather)
+		weather = agent.applyProfile(weather, profile)
 
 		// Generate weather message
-		historyContext := agent.generateHistoryContext()
-		message, err := agent.generateLLMMessage(weather, historyContext)
+		historyContext := agent.generateHistoryContext(weather)
+		message, err := agent.cachedLLMMessage(weather, historyContext, persona, params)
 		if err != nil {
-			return "", "", "", "", nil, fmt.Errorf("error generating LLM message: %v", err)
+			return "", "", "", "", nil, "", fmt.Errorf("error generating LLM message: %v", err)
 		}
+		agent.shareMessage(weather, historyContext, persona, params, message)
 
 		// Prepare weather data
 		weatherData := agent.prepareWeatherData(weather)
+		agent.markDegraded(weather, weatherData)
+		agent.addPlaylist(weather, weatherData)
 		timeStr := time.Now().Format(time.RFC1123)
 
 		// Log the message
 		agent.logger.Printf("[%s] Generated fresh weather message for coordinates (%.4f, %.4f): %s",
 			time.Now().Format("15:04:05"), lat, lon, message)
 
-		return message, weather.Name, weather.Sys.Country, timeStr, weatherData, nil
+		return message, weather.Name, weather.Sys.Country, timeStr, weatherData, agent.messageFingerprint(weather), nil
+	}
+
+	// Optional API key authentication for the API endpoints
+	auth := newAPIKeyAuth(config.APIKeys)
+	if auth.enabled() {
+		fmt.Printf("API key authentication enabled (%d key(s) configured)\n", len(auth.keys))
+	}
+
+	// Optional login for the HTML pages; logged-in users can also call the API
+	ui, err := newUIAuth(config.UIAuth, agent.httpClient(10*time.Second))
+	if err != nil {
+		log.Fatalf("Error setting up UI login: %v", err)
+	}
+	if ui != nil {
+		fmt.Printf("UI login enabled (%s)\n", config.UIAuth.Mode)
+		auth.sessions = ui
+		http.HandleFunc("/auth/login", ui.handleLogin)
+		http.HandleFunc("/auth/callback", ui.handleCallback)
+		http.HandleFunc("/auth/logout", ui.handleLogout)
 	}
 
 	// Set up HTTP handlers
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/", ui.middleware(func(w http.ResponseWriter, r *http.Request) {
+		// Let the browser UI log in by visiting /?api_key=...
+		if !auth.loginFromQuery(w, r) {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
 		// Serve the main HTML page with loading state
 		tmpl, err := template.ParseFiles("templates/index.html")
 		if err != nil {
@@ -2035,9 +3211,8 @@ func main() {
 			return
 		}
 
-		// Get current city/country from environment
-		currentCity := getEnv("WEATHER_CITY", config.City)
-		currentCountry := getEnv("WEATHER_COUNTRY", config.CountryCode)
+		// Current city/country, which may have been changed through /api/update-city
+		currentCity, currentCountry := agent.location()
 
 		data := struct {
 			City      string
@@ -2052,17 +3227,21 @@ func main() {
 		}
 
 		tmpl.Execute(w, data)
-	})
+	}))
 
-	http.HandleFunc("/api/update-city", func(w http.ResponseWriter, r *http.Request) {
+	// JSON API routes, served under /api/v1 and the older unversioned /api
+	api := apiRouter{mux: http.DefaultServeMux, cors: config.CORS}
+	api.handleNotFound()
+
+	api.HandleFunc("/update-city", auth.middleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		err := r.ParseForm()
 		if err != nil {
-			http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+			apiError(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -2070,22 +3249,26 @@ func main() {
 		country := r.FormValue("country")
 
 		if city == "" {
-			http.Error(w, "City is required", http.StatusBadRequest)
+			apiError(w, "City is required", http.StatusBadRequest)
 			return
 		}
 
-		// Update environment variables
-		os.Setenv("WEATHER_CITY", city)
-		if country != "" {
-			os.Setenv("WEATHER_COUNTRY", country)
+		// Switch locations for every request from now on
+		if err := agent.setLocation(city, country); err != nil {
+			agent.logger.Printf("Error saving location: %v", err)
+			apiError(w, "Location changed but could not be saved", http.StatusInternalServerError)
+			return
 		}
 
 		// Redirect back to home page
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-	})
+	}))
+
+	// Rate limit the weather endpoint since every hit triggers a paid LLM call
+	weatherLimiter := newRateLimiter(config.RateLimitPerMinute, config.RateLimitBurst, config.proxyHops())
 
 	// API endpoint to get fresh weather data
-	http.HandleFunc("/api/weather", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/weather", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("\n==== RECEIVED REQUEST TO /api/weather ENDPOINT ====\n")
 		fmt.Printf("Time: %s\n", time.Now().Format(time.RFC3339))
 		fmt.Printf("Remote address: %s\n", r.RemoteAddr)
@@ -2095,54 +3278,624 @@ func main() {
 		latParam := r.URL.Query().Get("lat")
 		lonParam := r.URL.Query().Get("lon")
 
-		var message, city, country, timestamp string
-		var weatherData map[string]interface{}
-		var err error
+		persona, err := agent.requestPersona(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params, err := agent.requestLLMParams(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sensitivities, err := agent.requestSensitivities(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		if latParam != "" && lonParam != "" {
+		variantParam := r.URL.Query().Get("variant")
+		if _, err := abVariant(variantParam, "", ""); err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wait := false
+		if waitParam := r.URL.Query().Get("wait"); waitParam != "" {
+			wait, err = strconv.ParseBool(waitParam)
+			if err != nil {
+				apiError(w, "Invalid wait parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		client := clientIP(r, config.proxyHops())
+
+		// Fall back to the location saved in the caller's profile, and
+		// answer in its units and language
+		profile, _ := agent.requestProfile(r)
+		if profile.Location != nil && (latParam == "" || lonParam == "") {
+			latParam = strconv.FormatFloat(profile.Location.Lat, 'f', -1, 64)
+			lonParam = strconv.FormatFloat(profile.Location.Lon, 'f', -1, 64)
+		}
+
+		var lat, lon float64
+		byCoordinates := latParam != "" && lonParam != ""
+		if byCoordinates {
 			// Parse coordinates
+			var err1, err2 error
+			lat, err1 = strconv.ParseFloat(latParam, 64)
+			lon, err2 = strconv.ParseFloat(lonParam, 64)
+
+			if err1 != nil || err2 != nil {
+				apiError(w, "Invalid coordinates", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Generate the weather update (or reuse a cached message) for this
+		// caller, with its fingerprint
+		generate := func() (WeatherUpdateResponse, string, error) {
+			var message, city, country, timestamp, fingerprint string
+			var weatherData map[string]interface{}
+			var err error
+			if byCoordinates {
+				// Generate weather update using coordinates
+				message, city, country, timestamp, weatherData, fingerprint, err = generateWeatherUpdateByCoordinates(lat, lon, persona, params, profile)
+			} else {
+				// Generate weather update using configured city
+				message, city, country, timestamp, weatherData, fingerprint, err = generateWeatherUpdate(persona, params, profile)
+			}
+			if err != nil {
+				return WeatherUpdateResponse{}, "", err
+			}
+
+			// Debug the time data being sent to the browser
+			log.Printf("TIME DATA SENT TO BROWSER: %v", weatherData["time"])
+
+			// Check if AQI data is present
+			if aqi, ok := weatherData["aqi"]; ok {
+				log.Printf("AQI DATA SENT TO BROWSER: %v", aqi)
+			} else {
+				log.Printf("WARNING: No AQI data found in weatherData map")
+			}
+
+			// Air quality advice for the caller rather than the deployment
+			personalizeAirQualityGuidance(weatherData, sensitivities)
+
+			update := WeatherUpdateResponse{
+				City:          city,
+				Country:       country,
+				Message:       message,
+				Persona:       persona,
+				Timestamp:     timestamp,
+				Data:          weatherData,
+				Severity:      dataSeverity(weatherData),
+				SeverityColor: severityColor(dataSeverity(weatherData)),
+			}
+
+			// In A/B mode, serve one model's message, the same one each time for
+			// a client. Comparisons are only made in the configured language.
+			if comparison, ok := agent.comparisons.find(fingerprint, persona); ok && agent.abTesting() && params.equal(agent.llmParams()) && profile.Language == "" && profile.Units == "" {
+				update.Variant, _ = abVariant(variantParam, client, comparison.ID)
+				update.ComparisonID = comparison.ID
+				update.Message, update.Model = comparison.variant(update.Variant)
+			}
+			return update, fingerprint, nil
+		}
+
+		// Record that the message was delivered to (and fetched by) the web UI
+		deliver := func(update *WeatherUpdateResponse) {
+			update.MessageID = newMessageID()
+			agent.deliveries.record(Delivery{
+				MessageID: update.MessageID,
+				Type:      NotificationUpdate,
+				Channel:   ChannelUI,
+				Target:    client,
+				Status:    DeliveryDelivered,
+				City:      update.City,
+				Message:   update.Message,
+			})
+		}
+
+		// Unless the caller waits, a message that isn't cached generates in
+		// the background: answer now with the conditions, the location's last
+		// message and a job to poll for the new one
+		if !wait && agent.jobs != nil {
+			var weather WeatherResponse
+			if byCoordinates {
+				weather, err = agent.fetchWeatherByCoordinates(lat, lon)
+			} else {
+				weather, err = agent.fetchWeather()
+			}
+			if err == nil {
+				weather = agent.applyProfile(weather, profile)
+				key := fmt.Sprintf("%s|%s|%s|%v", agent.llmCacheKey(weather, persona, params), client, variantParam, sensitivities)
+				accepted := agent.acceptWeatherJob(w, r, weather, persona, params, sensitivities, key, func() (WeatherUpdateResponse, error) {
+					update, _, err := generate()
+					if err != nil {
+						agent.logger.Printf("Error generating weather update: %v", err)
+						return update, fmt.Errorf("unable to generate the weather update")
+					}
+					deliver(&update)
+					return update, nil
+				})
+				if accepted {
+					return
+				}
+			}
+		}
+
+		update, fingerprint, err := generate()
+		if err != nil {
+			agent.logger.Printf("Error generating weather update: %v", err)
+			apiError(w, "Unable to fetch weather data", http.StatusInternalServerError)
+			return
+		}
+
+		// Polling clients that already have this weather get a 304; the
+		// persona, language and A/B variant change the message, so they're
+		// part of the tag (units already are, through the fingerprint)
+		etag := `W/"` + fingerprint + `"`
+		if persona != "" {
+			etag = `W/"` + fingerprint + "-" + persona + `"`
+		}
+		if _, language := agent.profileDisplay(profile); language != "" {
+			etag = strings.TrimSuffix(etag, `"`) + "-" + language + `"`
+		}
+		if update.Variant != "" {
+			etag = strings.TrimSuffix(etag, `"`) + "-" + update.Variant + `"`
+		}
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		agent.recordUIEngagement(r)
+		deliver(&update)
+		writeJSON(w, http.StatusOK, update)
+	}))))
+
+	// Messages generating in the background for /api/weather
+	api.HandleFunc("/jobs/{id}", auth.middleware(agent.handleJob))
+
+	// Weather data alone, cheap enough for the UI to poll
+	api.HandleFunc("/conditions", auth.middleware(gzipETagMiddleware(agent.handleConditions)))
+
+	// API endpoint listing the available personas
+	api.HandleFunc("/personas", auth.middleware(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, PersonasResponse{Default: config.Persona, Personas: personas})
+	}))
+
+	// Resolve the coordinates for a request: explicit lat/lon, the caller's profile or the configured city
+	requestCoordinates := func(r *http.Request) (float64, float64, bool, error) {
+		latParam := r.URL.Query().Get("lat")
+		lonParam := r.URL.Query().Get("lon")
+		if latParam != "" && lonParam != "" {
 			lat, err1 := strconv.ParseFloat(latParam, 64)
 			lon, err2 := strconv.ParseFloat(lonParam, 64)
-
 			if err1 != nil || err2 != nil {
-				http.Error(w, "Invalid coordinates", http.StatusBadRequest)
+				return 0, 0, true, fmt.Errorf("invalid coordinates")
+			}
+			return lat, lon, true, nil
+		}
+
+		if profile, ok := agent.requestProfile(r); ok && profile.Location != nil {
+			return profile.Location.Lat, profile.Location.Lon, true, nil
+		}
+
+		lat, lon, err := agent.getCoordinates(agent.location())
+		return lat, lon, false, err
+	}
+
+	// API endpoint running a fetch and message generation immediately (?force=true bypasses caches)
+	api.HandleFunc("/refresh", auth.middleware(weatherLimiter.middleware(agent.handleRefresh)))
+
+	// API endpoint reporting daily LLM token usage and cost
+	api.HandleFunc("/usage", auth.middleware(gzipETagMiddleware(agent.handleUsage)))
+
+	// Email open pixel and webhook acknowledgements (signed links, no API key)
+	api.HandleFunc("/engagement", agent.handleEngagement)
+
+	// API endpoint for the daily forecast
+	api.HandleFunc("/forecast", auth.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		lat, lon, explicit, err := requestCoordinates(r)
+		if err != nil {
+			if explicit {
+				apiError(w, "Invalid coordinates", http.StatusBadRequest)
+			} else {
+				apiError(w, "Unable to resolve location", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		days := 7
+		if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+			days, err = strconv.Atoi(daysParam)
+			if err != nil || days < 1 {
+				apiError(w, "Invalid days parameter", http.StatusBadRequest)
 				return
 			}
+		}
+
+		forecast, err := agent.fetchForecast(lat, lon, days)
+		if err != nil {
+			agent.logger.Printf("Error fetching forecast: %v", err)
+			apiError(w, "Unable to fetch forecast", http.StatusInternalServerError)
+			return
+		}
 
-			// Generate weather update using coordinates
-			message, city, country, timestamp, weatherData, err = generateWeatherUpdateByCoordinates(lat, lon)
+		if explicit {
+			forecast.City, forecast.Country = agent.reverseGeocode(lat, lon)
 		} else {
-			// Generate weather update using configured city
-			message, city, country, timestamp, weatherData, err = generateWeatherUpdate()
+			forecast.City, forecast.Country = agent.location()
 		}
 
+		writeJSON(w, http.StatusOK, forecast)
+	})))
+
+	// Radar tiles proxied from the configured provider, keeping its API key server-side
+	api.HandleFunc("/radar/frames", auth.middleware(gzipETagMiddleware(agent.handleRadarFrames)))
+	api.HandleFunc("/radar/{z}/{x}/{y}", auth.middleware(agent.handleRadarTile))
+
+	// API endpoint for decoded METAR/TAF in aviation mode
+	api.HandleFunc("/aviation", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(agent.handleAviation))))
+	api.HandleFunc("/commute", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(agent.handleCommute))))
+
+	// API endpoint for growing degree days, frost risk, soil conditions and gardening advice
+	api.HandleFunc("/garden", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		lat, lon, explicit, err := requestCoordinates(r)
 		if err != nil {
-			agent.logger.Printf("Error generating weather update: %v", err)
-			http.Error(w, "Unable to fetch weather data", http.StatusInternalServerError)
+			if explicit {
+				apiError(w, "Invalid coordinates", http.StatusBadRequest)
+			} else {
+				apiError(w, "Unable to resolve location", http.StatusInternalServerError)
+			}
 			return
 		}
 
-		// Debug the time data being sent to the browser
-		if weatherData != nil {
-			log.Printf("TIME DATA SENT TO BROWSER: %v", weatherData["time"])
-			
-			// Check if AQI data is present
-			if aqi, ok := weatherData["aqi"]; ok {
-				log.Printf("AQI DATA SENT TO BROWSER: %v", aqi)
+		report, err := agent.gardenReport(lat, lon, time.Now())
+		if err != nil {
+			agent.logger.Printf("Error fetching garden conditions: %v", err)
+			apiError(w, "Unable to fetch garden conditions", http.StatusInternalServerError)
+			return
+		}
+
+		if explicit {
+			report.City, report.Country = agent.reverseGeocode(lat, lon)
+		} else {
+			report.City, report.Country = agent.location()
+		}
+
+		writeJSON(w, http.StatusOK, report)
+	}))))
+
+	// API endpoint for the 15-minutely precipitation nowcast
+	api.HandleFunc("/nowcast", auth.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if !agent.featureEnabled(FeatureNowcasting) {
+			apiError(w, "Nowcasting is disabled", http.StatusNotFound)
+			return
+		}
+
+		lat, lon, explicit, err := requestCoordinates(r)
+		if err != nil {
+			if explicit {
+				apiError(w, "Invalid coordinates", http.StatusBadRequest)
 			} else {
-				log.Printf("WARNING: No AQI data found in weatherData map")
+				apiError(w, "Unable to resolve location", http.StatusInternalServerError)
 			}
+			return
+		}
+
+		nowcast, err := agent.fetchNowcast(lat, lon, time.Now())
+		if err != nil {
+			agent.logger.Printf("Error fetching nowcast: %v", err)
+			apiError(w, "Unable to fetch nowcast", http.StatusInternalServerError)
+			return
+		}
+
+		if explicit {
+			nowcast.City, nowcast.Country = agent.reverseGeocode(lat, lon)
+		} else {
+			nowcast.City, nowcast.Country = agent.location()
+		}
+
+		writeJSON(w, http.StatusOK, nowcast)
+	})))
+
+	// API endpoint comparing forecasts for trip destinations, with a packing summary
+	api.HandleFunc("/trip", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(agent.handleTrip))))
+
+	// Daily forecasts as a subscribable calendar feed
+	http.HandleFunc("/calendar.ics", auth.feedMiddleware(gzipETagMiddleware(agent.handleCalendar)))
+
+	// API endpoint for free-form questions about the weather
+	api.HandleFunc("/chat", auth.middleware(weatherLimiter.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if !agent.featureEnabled(FeatureChat) {
+			apiError(w, "Chat is disabled", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodPost {
+			apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var chatReq ChatRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&chatReq); err != nil {
+			apiError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		lat, lon, explicit, err := requestCoordinates(r)
+		if err != nil && explicit {
+			apiError(w, "Invalid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		var weather WeatherResponse
+		if explicit {
+			weather, err = agent.fetchWeatherByCoordinates(lat, lon)
+		} else {
+			weather, err = agent.fetchWeather()
+		}
+		if err != nil {
+			agent.logger.Printf("Error fetching weather for chat: %v", err)
+			apiError(w, "Unable to fetch weather data", http.StatusInternalServerError)
+			return
+		}
+
+		params, err := agent.llmParamsWith(chatReq.llmParamOverrides)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var language string
+		if profile, ok := agent.requestProfile(r); ok {
+			language = profile.Language
+		}
+		reply, err := agent.chat(weather, chatReq.Message, language, params)
+		if errors.Is(err, errLLMBudgetExceeded) {
+			apiError(w, "The daily LLM budget has been spent, try again tomorrow", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			agent.logger.Printf("Error generating chat reply: %v", err)
+			apiError(w, "Unable to answer: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ChatResponse{Reply: reply})
+	}))))
+
+	// API endpoint streaming weather updates as server-sent events
+	api.HandleFunc("/stream", auth.middleware(weatherLimiter.middleware(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			apiError(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		lat, lon, explicit, err := requestCoordinates(r)
+		if err != nil && explicit {
+			apiError(w, "Invalid coordinates", http.StatusBadRequest)
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"city":      city,
-			"country":   country,
-			"message":   message,
-			"timestamp": timestamp,
-			"data":      weatherData,
-		})
-	})
+		persona, err := agent.requestPersona(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params, err := agent.requestLLMParams(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile, _ := agent.requestProfile(r)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		interval := time.Duration(config.CheckInterval) * time.Minute
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			var message, city, country, timestamp string
+			var weatherData map[string]interface{}
+			if explicit {
+				message, city, country, timestamp, weatherData, _, err = generateWeatherUpdateByCoordinates(lat, lon, persona, params, profile)
+			} else {
+				message, city, country, timestamp, weatherData, _, err = generateWeatherUpdate(persona, params, profile)
+			}
+
+			if err != nil {
+				agent.logger.Printf("Error generating streamed weather update: %v", err)
+			} else {
+				messageID := newMessageID()
+				payload, _ := json.Marshal(WeatherUpdateResponse{
+					MessageID: messageID,
+					City:      city,
+					Country:   country,
+					Message:   message,
+					Persona:   persona,
+					Timestamp: timestamp,
+					Data:      weatherData,
+					Severity:      dataSeverity(weatherData),
+					SeverityColor: severityColor(dataSeverity(weatherData)),
+				})
+				delivery := Delivery{
+					MessageID: messageID,
+					Type:      NotificationUpdate,
+					Channel:   ChannelStream,
+					Target:    clientIP(r, config.proxyHops()),
+					Status:    DeliveryDelivered,
+					City:      city,
+					Message:   message,
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+					delivery.Status = DeliveryFailed
+					delivery.Error = err.Error()
+				}
+				flusher.Flush()
+				agent.deliveries.record(delivery)
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})))
+
+	// API endpoint listing message delivery receipts, with targets masked
+	api.HandleFunc("/deliveries", auth.middleware(gzipETagMiddleware(agent.handleDeliveries)))
+
+	// API endpoint with stored observations for charts (?hours=24&format=csv&interpolate=15m&smooth=5)
+	api.HandleFunc("/history", auth.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		hours := 24
+		if hoursParam := r.URL.Query().Get("hours"); hoursParam != "" {
+			parsed, err := strconv.Atoi(hoursParam)
+			if err != nil || parsed < 1 || parsed > maxHistoryHours {
+				apiError(w, fmt.Sprintf("Invalid hours parameter (1-%d)", maxHistoryHours), http.StatusBadRequest)
+				return
+			}
+			hours = parsed
+		}
+
+		seriesOpts, err := parseSeriesOptions(r.URL.Query())
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		since := time.Now().Add(-time.Duration(hours) * time.Hour)
+		observations, err := agent.observations.since(since, r.URL.Query().Get("city"))
+		if err != nil {
+			agent.logger.Printf("Error reading observations: %v", err)
+			apiError(w, "Unable to read observations", http.StatusInternalServerError)
+			return
+		}
+		observations = applySeriesOptions(observations, seriesOpts)
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			writeJSON(w, http.StatusOK, HistoryResponse{
+				Hours:        hours,
+				Units:        agent.config.Units,
+				Observations: observations,
+			})
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", "attachment; filename=weather-history.csv")
+			writeObservationsCSV(w, observations)
+		default:
+			apiError(w, "Invalid format parameter (json or csv)", http.StatusBadRequest)
+		}
+	})))
+
+	// API endpoint downloading observations or messages as CSV or Parquet (?data=messages&format=parquet&range=7d)
+	api.HandleFunc("/export", auth.middleware(gzipETagMiddleware(agent.handleExport)))
+
+	// Settings page where users manage their own notification endpoints
+	http.HandleFunc("/settings", ui.middleware(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.loginFromQuery(w, r) {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if auth.enabled() && !auth.authorized(r) && r.URL.Query().Get("api_key") == "" {
+			http.Error(w, "Unauthorized - open /settings?api_key=... to log in", http.StatusUnauthorized)
+			return
+		}
+		http.ServeFile(w, r, "templates/settings.html")
+	}))
+
+	// User preference profile (cookie or X-Profile-Token)
+	api.HandleFunc("/profile", auth.middleware(agent.handleProfile))
+
+	// API endpoints for managing notification subscriptions, each caller's own
+	api.HandleFunc("/subscriptions", auth.userMiddleware(gzipETagMiddleware(agent.handleSubscriptions)))
+	api.HandleFunc("/subscriptions/{id}", auth.userMiddleware(agent.handleSubscription))
+	api.HandleFunc("/subscriptions/{id}/verify", auth.userMiddleware(weatherLimiter.middleware(agent.handleVerifySubscription)))
+
+	// Flat conditions for Home Assistant REST sensors
+	api.HandleFunc("/ha/state", auth.middleware(agent.handleHAState))
+	api.HandleFunc("/ha/temperature", auth.middleware(agent.handleHATemperature))
+
+	// Grafana SimpleJSON datasource over the observation history
+	api.HandleFunc("/grafana", auth.middleware(agent.handleGrafana))
+	api.HandleFunc("/grafana/search", auth.middleware(agent.handleGrafanaSearch))
+	api.HandleFunc("/grafana/query", auth.middleware(agent.handleGrafanaQuery))
+	api.HandleFunc("/grafana/annotations", auth.middleware(agent.handleGrafanaAnnotations))
+
+	// Readings posted by indoor sensors
+	api.HandleFunc("/ingest", auth.middleware(agent.handleIngest))
+
+	// Users' ratings of generated messages
+	api.HandleFunc("/feedback", auth.middleware(agent.handleFeedback))
+
+	// A/B model comparisons and users' preferences between them
+	api.HandleFunc("/comparisons", auth.middleware(gzipETagMiddleware(agent.handleComparisons)))
+	api.HandleFunc("/comparisons/{id}", auth.middleware(agent.handleComparison))
+	api.HandleFunc("/comparisons/{id}/preference", auth.middleware(agent.handleComparisonPreference))
+
+	// API endpoints listing and serving stored climate reports
+	api.HandleFunc("/reports", auth.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		reports, err := listStoredReports(config.ReportsDir)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, ReportsResponse{Reports: reports})
+	})))
+	api.HandleFunc("/reports/{name}", auth.middleware(func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		ext := filepath.Ext(name)
+		if name != filepath.Base(name) || (ext != ".html" && ext != ".pdf") {
+			apiError(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(config.ReportsDir, name))
+	}))
+
+	// API endpoint with pre-heating/cooling recommendations for home automation
+	api.HandleFunc("/precondition", auth.middleware(gzipETagMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if !config.Comfort.Enabled {
+			apiError(w, "Pre-conditioning advisor is disabled", http.StatusNotFound)
+			return
+		}
+
+		schedule := agent.precondition.get()
+		if schedule == nil {
+			apiError(w, "Schedule not available yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, schedule)
+	})))
+
+	// Admin endpoints, available only with ADMIN_API_KEYS or to UI_ADMIN_USERS
+	adminAuth := newAPIKeyAuth(config.AdminAPIKeys)
+	adminAuth.sessions = ui
+	api.HandleFunc("/admin/features", adminAuth.adminMiddleware(agent.handleFeatures))
+	api.HandleFunc("/admin/archive", adminAuth.adminMiddleware(gzipETagMiddleware(agent.handleArchive)))
+	api.HandleFunc("/admin/deliveries", adminAuth.adminMiddleware(gzipETagMiddleware(agent.handleAdminDeliveries)))
+
+	// Logged LLM prompts include the system prompt, so they're admin only
+	api.HandleFunc("/prompts", adminAuth.adminMiddleware(gzipETagMiddleware(agent.handlePrompts)))
+	api.HandleFunc("/prompts/{id}", adminAuth.adminMiddleware(agent.handlePrompt))
+	api.HandleFunc("/prompts/{id}/replay", adminAuth.adminMiddleware(agent.handleReplayPrompt))
+
+	// Current conditions per location as Prometheus gauges
+	http.HandleFunc("/metrics", auth.middleware(agent.handleMetrics))
+
+	// OpenAPI description of the endpoints above
+	http.HandleFunc("/openapi.json", config.CORS.middleware(gzipETagMiddleware(handleOpenAPI)))
 
 	// Serve static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Notifier that posts messages into a Matrix room through the client-server API
+type matrixNotifier struct {
+	homeserver string
+	token      string
+	roomID     string
+	client     *http.Client
+}
+
+func newMatrixNotifier(homeserver, token, roomID string) (*matrixNotifier, error) {
+	if homeserver == "" || token == "" {
+		return nil, fmt.Errorf("Matrix homeserver URL and access token are required")
+	}
+	if u, err := url.Parse(homeserver); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Matrix homeserver %q is not an absolute http(s) URL", homeserver)
+	}
+	// Room IDs look like !opaque:server.example
+	if !strings.HasPrefix(roomID, "!") || !strings.Contains(roomID, ":") {
+		return nil, fmt.Errorf("Matrix room ID %q should look like !room:server", roomID)
+	}
+	return &matrixNotifier{
+		homeserver: strings.TrimRight(homeserver, "/"),
+		token:      token,
+		roomID:     roomID,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (m *matrixNotifier) Channel() string {
+	return ChannelMatrix
+}
+
+func (m *matrixNotifier) Target() string {
+	return m.roomID
+}
+
+// The room gets the digest, updates and alerts, but not reports
+func (m *matrixNotifier) wants(notificationType string) bool {
+	return notificationType != NotificationReport
+}
+
+// Markdown body and the equivalent HTML for a notification
+func matrixMessage(n Notification) (string, string) {
+	var text, formatted strings.Builder
+	title := n.Title
+	if n.Type == NotificationAlert && title != "" {
+		title = "⚠️ " + title
+	}
+	if title != "" {
+		fmt.Fprintf(&text, "**%s**\n\n", title)
+		fmt.Fprintf(&formatted, "<p><strong>%s</strong></p>", html.EscapeString(title))
+	}
+
+	text.WriteString(n.Message)
+	for _, paragraph := range strings.Split(strings.TrimSpace(n.Message), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			fmt.Fprintf(&formatted, "<p>%s</p>", strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		}
+	}
+
+	if len(n.Forecast) > 0 {
+		unit := unitSymbol(n.Units)
+		text.WriteString("\n\n**Forecast**\n")
+		formatted.WriteString("<p><strong>Forecast</strong></p><ul>")
+		for _, day := range n.Forecast {
+			line := fmt.Sprintf("%s, high %.0f%s, low %.0f%s, %d%% chance of precipitation",
+				day.Description, day.TempMax, unit, day.TempMin, unit, day.PrecipitationProbability)
+			fmt.Fprintf(&text, "- %s: %s\n", day.Date, line)
+			fmt.Fprintf(&formatted, "<li><strong>%s</strong>: %s</li>", html.EscapeString(day.Date), html.EscapeString(line))
+		}
+		formatted.WriteString("</ul>")
+	}
+	return strings.TrimRight(text.String(), "\n"), formatted.String()
+}
+
+// Send the notification as an m.text message with an HTML rendering
+func (m *matrixNotifier) Notify(n Notification) error {
+	body, formatted := matrixMessage(n)
+	msgtype := "m.text"
+	if n.Type != NotificationAlert {
+		// Routine messages don't ping the room
+		msgtype = "m.notice"
+	}
+	payload, err := json.Marshal(map[string]string{
+		"msgtype":        msgtype,
+		"body":           body,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The message ID doubles as the transaction ID, so a retried send isn't posted twice
+	txnID := n.MessageID
+	if txnID == "" {
+		txnID = newMessageID()
+	}
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.homeserver, url.PathEscape(m.roomID), url.PathEscape(txnID))
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Matrix request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Matrix API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewMatrixNotifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		homeserver string
+		token      string
+		roomID     string
+		wantErr    bool
+	}{
+		{"valid", "https://matrix.example.org/", "syt_token", "!abc123:example.org", false},
+		{"missing token", "https://matrix.example.org", "", "!abc123:example.org", true},
+		{"relative homeserver", "matrix.example.org", "syt_token", "!abc123:example.org", true},
+		{"room alias", "https://matrix.example.org", "syt_token", "#weather:example.org", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newMatrixNotifier(tt.homeserver, tt.token, tt.roomID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newMatrixNotifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatrixMessage(t *testing.T) {
+	body, formatted := matrixMessage(Notification{
+		Type:     NotificationDigest,
+		Title:    "Oslo today",
+		Message:  "Sunny <and> warm.\n\nTake sunscreen.",
+		Units:    "metric",
+		Forecast: []ForecastDay{{Date: "2024-06-15", Description: "clear sky", TempMax: 21.4, TempMin: 11.6, PrecipitationProbability: 10}},
+	})
+
+	wantBody := "**Oslo today**\n\nSunny <and> warm.\n\nTake sunscreen.\n\n**Forecast**\n- 2024-06-15: clear sky, high 21°C, low 12°C, 10% chance of precipitation"
+	if body != wantBody {
+		t.Errorf("body = %q, want %q", body, wantBody)
+	}
+	for _, want := range []string{"<p><strong>Oslo today</strong></p>", "<p>Sunny &lt;and&gt; warm.</p><p>Take sunscreen.</p>", "<li><strong>2024-06-15</strong>: clear sky"} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("formatted body missing %q: %s", want, formatted)
+		}
+	}
+
+	if body, _ := matrixMessage(Notification{Type: NotificationAlert, Title: "Storm", Message: "Gusts to 90 km/h."}); !strings.HasPrefix(body, "**⚠️ Storm**") {
+		t.Errorf("alert body = %q", body)
+	}
+}
+
+func TestMatrixNotify(t *testing.T) {
+	type request struct {
+		method, path, auth string
+		payload            map[string]string
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		requests = append(requests, request{r.Method, r.URL.EscapedPath(), r.Header.Get("Authorization"), payload})
+		if r.Header.Get("Authorization") != "Bearer syt_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token passed."}`)
+			return
+		}
+		io.WriteString(w, `{"event_id":"$YUwRidLecu:example.com"}`)
+	}))
+	defer server.Close()
+
+	matrix, err := newMatrixNotifier(server.URL, "syt_token", "!abc123:example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		notifiers:  []Notifier{matrix},
+	}
+	agent.notify(Notification{MessageID: "msg-1", Type: NotificationUpdate, Message: "Clouds rolling in."})
+	agent.notify(Notification{MessageID: "msg-2", Type: NotificationAlert, Title: "Storm", Message: "Gusts to 90 km/h."})
+	agent.notify(Notification{MessageID: "msg-3", Type: NotificationReport, Message: "Weekly report."})
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2 (reports are skipped)", len(requests))
+	}
+	if r := requests[0]; r.method != http.MethodPut || r.path != "/_matrix/client/v3/rooms/%21abc123:example.org/send/m.room.message/msg-1" || r.auth != "Bearer syt_token" {
+		t.Errorf("request = %s %s (auth %q)", r.method, r.path, r.auth)
+	}
+	if p := requests[0].payload; p["msgtype"] != "m.notice" || p["format"] != "org.matrix.custom.html" || p["body"] != "Clouds rolling in." {
+		t.Errorf("update payload = %v", p)
+	}
+	if p := requests[1].payload; p["msgtype"] != "m.text" {
+		t.Errorf("alert msgtype = %q, want m.text", p["msgtype"])
+	}
+
+	matrix.token = "expired"
+	err = matrix.Notify(Notification{MessageID: "msg-4", Type: NotificationAlert, Message: "Test"})
+	if err == nil || !strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Errorf("Notify() error = %v, want the API's error", err)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Met Office DataHub settings
+const (
+	metOfficeHourlyURL = "https://data.hub.api.metoffice.gov.uk/sitespecific/v0/point/hourly"
+	metOfficeCacheTTL  = 15 * time.Minute // The free plan allows 360 calls a day
+	metOfficeSource    = "Met Office"
+)
+
+// Descriptions of the Met Office significant weather codes 0-30
+var metOfficeWeatherDescriptions = []string{
+	"clear night", "sunny day", "partly cloudy", "partly cloudy", "",
+	"mist", "fog", "cloudy", "overcast",
+	"light rain shower", "light rain shower", "drizzle", "light rain",
+	"heavy rain shower", "heavy rain shower", "heavy rain",
+	"sleet shower", "sleet shower", "sleet",
+	"hail shower", "hail shower", "hail",
+	"light snow shower", "light snow shower", "light snow",
+	"heavy snow shower", "heavy snow shower", "heavy snow",
+	"thunder shower", "thunder shower", "thunder",
+}
+
+// WMO codes closest to the Met Office significant weather codes 0-30, so the
+// rest of the agent can keep working with Open-Meteo's codes
+var metOfficeWMOCodes = []int{
+	0, 0, 2, 2, 3,
+	45, 45, 3, 3,
+	80, 80, 53, 61,
+	82, 82, 65,
+	68, 68, 69,
+	79, 79, 79,
+	85, 85, 71,
+	86, 86, 75,
+	95, 95, 95,
+}
+
+// Whether a country code is covered by the Met Office site-specific forecast
+func metOfficeCovers(country string) bool {
+	switch strings.ToUpper(strings.TrimSpace(country)) {
+	case "GB", "UK":
+		return true
+	}
+	return false
+}
+
+// One hour of the Met Office site-specific forecast, in its SI units
+type metOfficeHour struct {
+	Time          time.Time
+	Temperature   float64 // °C
+	FeelsLike     float64 // °C
+	Humidity      float64 // %
+	WindSpeed     float64 // m/s
+	WindDirection float64 // Degrees the wind blows from
+	WindGust      float64 // m/s
+	Visibility    float64 // Meters
+	Pressure      float64 // Mean sea level, Pa
+	UVIndex       float64
+	WeatherCode   int
+	PrecipChance  float64 // %
+}
+
+// Parse a Met Office hourly point forecast into its hours
+func parseMetOffice(body []byte) ([]metOfficeHour, error) {
+	var resp struct {
+		Features []struct {
+			Properties struct {
+				TimeSeries []struct {
+					Time                   string  `json:"time"`
+					ScreenTemperature      float64 `json:"screenTemperature"`
+					FeelsLikeTemperature   float64 `json:"feelsLikeTemperature"`
+					ScreenRelativeHumidity float64 `json:"screenRelativeHumidity"`
+					WindSpeed10m           float64 `json:"windSpeed10m"`
+					WindDirectionFrom10m   float64 `json:"windDirectionFrom10m"`
+					WindGustSpeed10m       float64 `json:"windGustSpeed10m"`
+					Visibility             float64 `json:"visibility"`
+					MSLP                   float64 `json:"mslp"`
+					UVIndex                float64 `json:"uvIndex"`
+					SignificantWeatherCode int     `json:"significantWeatherCode"`
+					ProbOfPrecipitation    float64 `json:"probOfPrecipitation"`
+				} `json:"timeSeries"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse Met Office response: %v", err)
+	}
+	if len(resp.Features) == 0 || len(resp.Features[0].Properties.TimeSeries) == 0 {
+		return nil, fmt.Errorf("no forecast in Met Office response")
+	}
+
+	var hours []metOfficeHour
+	for _, ts := range resp.Features[0].Properties.TimeSeries {
+		t, err := time.Parse("2006-01-02T15:04Z07:00", ts.Time)
+		if err != nil {
+			continue
+		}
+		hours = append(hours, metOfficeHour{
+			Time:          t,
+			Temperature:   ts.ScreenTemperature,
+			FeelsLike:     ts.FeelsLikeTemperature,
+			Humidity:      ts.ScreenRelativeHumidity,
+			WindSpeed:     ts.WindSpeed10m,
+			WindDirection: ts.WindDirectionFrom10m,
+			WindGust:      ts.WindGustSpeed10m,
+			Visibility:    ts.Visibility,
+			Pressure:      ts.MSLP,
+			UVIndex:       ts.UVIndex,
+			WeatherCode:   ts.SignificantWeatherCode,
+			PrecipChance:  ts.ProbOfPrecipitation,
+		})
+	}
+	if len(hours) == 0 {
+		return nil, fmt.Errorf("no readable times in Met Office response")
+	}
+	return hours, nil
+}
+
+// The hour containing now, false when the forecast doesn't cover it
+func currentMetOfficeHour(hours []metOfficeHour, now time.Time) (metOfficeHour, bool) {
+	for _, h := range hours {
+		if !now.Before(h.Time) && now.Before(h.Time.Add(time.Hour)) {
+			return h, true
+		}
+	}
+	return metOfficeHour{}, false
+}
+
+// Description and closest WMO code for a significant weather code
+func metOfficeWeather(code int) (string, int) {
+	if code == -1 {
+		return "trace rain", 51
+	}
+	if code < 0 || code >= len(metOfficeWeatherDescriptions) || metOfficeWeatherDescriptions[code] == "" {
+		return "", -1
+	}
+	return metOfficeWeatherDescriptions[code], metOfficeWMOCodes[code]
+}
+
+// Fetch the hourly site-specific forecast for coordinates
+func (agent *WeatherAgent) fetchMetOffice(lat, lon float64) ([]metOfficeHour, error) {
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprintf("%.4f", lat))
+	query.Set("longitude", fmt.Sprintf("%.4f", lon))
+	query.Set("excludeParameterMetadata", "true")
+
+	header := http.Header{}
+	header.Set("apikey", agent.config.MetOfficeAPIKey)
+	body, _, err := agent.cachedGetWithHeader(metOfficeHourlyURL+"?"+query.Encode(), header, metOfficeCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("Met Office request failed: %v", err)
+	}
+	return parseMetOffice(body)
+}
+
+// Replace Open-Meteo's current conditions with the Met Office's for GB
+// locations when a key is configured. Open-Meteo's data stands if the Met
+// Office is unavailable.
+func (agent *WeatherAgent) applyMetOffice(weather *WeatherResponse, lat, lon float64, now time.Time) {
+	if agent.config.MetOfficeAPIKey == "" || !metOfficeCovers(weather.Sys.Country) {
+		return
+	}
+
+	hours, err := agent.fetchMetOffice(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch Met Office forecast, keeping Open-Meteo data: %v", err)
+		return
+	}
+	current, ok := currentMetOfficeHour(hours, now)
+	if !ok {
+		agent.logger.Printf("Warning: Met Office forecast doesn't cover %s, keeping Open-Meteo data", now.UTC().Format(time.RFC3339))
+		return
+	}
+
+	system := agent.units()
+	weather.Main.Temp = units.Celsius(current.Temperature).In(system)
+	weather.Main.FeelsLike = units.Celsius(current.FeelsLike).In(system)
+	weather.Main.Humidity = int(current.Humidity + 0.5)
+	weather.Main.Pressure = int(current.Pressure/100 + 0.5)
+	weather.Wind.Speed = units.MetersPerSecond(current.WindSpeed).In(system)
+	weather.Wind.Deg = int(current.WindDirection + 0.5)
+	weather.Wind.Gust = units.MetersPerSecond(current.WindGust).In(system)
+	weather.Visibility = int(current.Visibility + 0.5)
+	weather.UVIndex = current.UVIndex
+	if description, code := metOfficeWeather(current.WeatherCode); description != "" && len(weather.Weather) > 0 {
+		weather.Weather[0].ID = code
+		weather.Weather[0].Main = agent.weatherCodeToCondition(code)
+		weather.Weather[0].Description = description
+	}
+
+	// The rest of today's chance of precipitation
+	loc := time.FixedZone("Local", weather.Timezone)
+	today := now.In(loc).Format("2006-01-02")
+	var precip []HourlyValue
+	for _, h := range hours {
+		if h.Time.In(loc).Format("2006-01-02") == today {
+			precip = append(precip, HourlyValue{Time: h.Time.Unix(), Value: h.PrecipChance})
+		}
+	}
+	if len(precip) > 0 {
+		weather.HourlyPrecipProb = precip
+	}
+	weather.Source = metOfficeSource
+}
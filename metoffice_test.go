@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const fixtureMetOffice = `{"type":"FeatureCollection","features":[{"type":"Feature",
+	"geometry":{"type":"Point","coordinates":[-0.1278,51.5074,20]},
+	"properties":{"location":{"name":"London"},"requestPointDistance":120.5,"modelRunDate":"2024-06-15T11:00Z","timeSeries":[
+		{"time":"2024-06-15T12:00Z","screenTemperature":16.9,"feelsLikeTemperature":15.8,"screenRelativeHumidity":71.2,"windSpeed10m":4.3,
+			"windDirectionFrom10m":238,"windGustSpeed10m":9.8,"visibility":14500,"mslp":101210,"uvIndex":3,"significantWeatherCode":12,"probOfPrecipitation":65},
+		{"time":"2024-06-15T13:00Z","screenTemperature":17.4,"feelsLikeTemperature":16.1,"screenRelativeHumidity":68,"windSpeed10m":5,
+			"windDirectionFrom10m":241,"windGustSpeed10m":10,"visibility":18000,"mslp":101190,"uvIndex":4,"significantWeatherCode":7,"probOfPrecipitation":30},
+		{"time":"2024-06-15T23:00Z","screenTemperature":12.1,"feelsLikeTemperature":11.0,"screenRelativeHumidity":88,"windSpeed10m":2,
+			"windDirectionFrom10m":250,"windGustSpeed10m":4,"visibility":9000,"mslp":101300,"uvIndex":0,"significantWeatherCode":0,"probOfPrecipitation":5}
+	]}}]}`
+
+func TestParseMetOffice(t *testing.T) {
+	hours, err := parseMetOffice([]byte(fixtureMetOffice))
+	if err != nil {
+		t.Fatalf("parseMetOffice() error: %v", err)
+	}
+	if len(hours) != 3 || !hours[1].Time.Equal(time.Date(2024, 6, 15, 13, 0, 0, 0, time.UTC)) {
+		t.Fatalf("hours = %+v", hours)
+	}
+	if h := hours[0]; h.Temperature != 16.9 || h.WindGust != 9.8 || h.Pressure != 101210 || h.WeatherCode != 12 || h.PrecipChance != 65 {
+		t.Errorf("first hour = %+v", h)
+	}
+
+	if _, err := parseMetOffice([]byte(`{"type":"FeatureCollection","features":[]}`)); err == nil {
+		t.Error("parseMetOffice() with no features: expected error")
+	}
+}
+
+func TestCurrentMetOfficeHour(t *testing.T) {
+	hours, _ := parseMetOffice([]byte(fixtureMetOffice))
+	tests := []struct {
+		now  time.Time
+		want float64
+		ok   bool
+	}{
+		{time.Date(2024, 6, 15, 13, 0, 0, 0, time.UTC), 17.4, true},
+		{time.Date(2024, 6, 15, 13, 59, 0, 0, time.UTC), 17.4, true},
+		{time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC), 0, false}, // Gap in the series
+		{time.Date(2024, 6, 15, 11, 30, 0, 0, time.UTC), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := currentMetOfficeHour(hours, tt.now)
+		if ok != tt.ok || got.Temperature != tt.want {
+			t.Errorf("currentMetOfficeHour(%s) = %v, %v, want %v, %v", tt.now.Format("15:04"), got.Temperature, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMetOfficeWeather(t *testing.T) {
+	tests := []struct {
+		code     int
+		wantDesc string
+		wantWMO  int
+	}{
+		{-1, "trace rain", 51},
+		{1, "sunny day", 0},
+		{6, "fog", 45},
+		{15, "heavy rain", 65},
+		{27, "heavy snow", 75},
+		{30, "thunder", 95},
+		{4, "", -1}, // Not used
+		{31, "", -1},
+	}
+	for _, tt := range tests {
+		if desc, code := metOfficeWeather(tt.code); desc != tt.wantDesc || code != tt.wantWMO {
+			t.Errorf("metOfficeWeather(%d) = %q, %d, want %q, %d", tt.code, desc, code, tt.wantDesc, tt.wantWMO)
+		}
+	}
+	if len(metOfficeWeatherDescriptions) != len(metOfficeWMOCodes) {
+		t.Error("description and WMO code tables differ in length")
+	}
+}
+
+func TestApplyMetOffice(t *testing.T) {
+	var apikey string
+	handlers := defaultFixtures()
+	handlers["data.hub.api.metoffice.gov.uk"] = func(w http.ResponseWriter, r *http.Request) {
+		apikey = r.Header.Get("apikey")
+		serveJSON(fixtureMetOffice)(w, r)
+	}
+	useFixtures(t, handlers)
+	now := time.Date(2024, 6, 15, 13, 20, 0, 0, time.UTC)
+
+	agent := newFixtureAgent(t, Config{City: "London", CountryCode: "GB", MetOfficeAPIKey: "mo-key"})
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(`{"weather":[{"id":2,"main":"Clouds"}],"main":{"temp":99},"sys":{"country":"GB"},"timezone":3600}`), &weather); err != nil {
+		t.Fatal(err)
+	}
+	agent.applyMetOffice(&weather, 51.5074, -0.1278, now)
+
+	if apikey != "mo-key" {
+		t.Errorf("apikey header = %q", apikey)
+	}
+	if weather.Source != "Met Office" || weather.Main.Temp != 17.4 || weather.Main.Pressure != 1012 || weather.Visibility != 18000 {
+		t.Errorf("conditions = %+v, visibility %d, source %q", weather.Main, weather.Visibility, weather.Source)
+	}
+	if weather.Wind.Speed != 18 || math.Abs(weather.Wind.Gust-36) > 1e-9 || weather.Wind.Deg != 241 {
+		t.Errorf("wind = %+v, want km/h", weather.Wind)
+	}
+	if w := weather.Weather[0]; w.ID != 3 || w.Main != "Clouds" || w.Description != "cloudy" {
+		t.Errorf("weather = %+v", w)
+	}
+	// 23:00Z is already tomorrow in UTC+1
+	if len(weather.HourlyPrecipProb) != 2 || weather.HourlyPrecipProb[0].Value != 65 {
+		t.Errorf("precipitation chance = %v", weather.HourlyPrecipProb)
+	}
+
+	// Other countries keep Open-Meteo's data
+	other := WeatherResponse{}
+	other.Sys.Country = "IE"
+	other.Main.Temp = 14
+	agent.applyMetOffice(&other, 53.35, -6.26, now)
+	if other.Source != "" || other.Main.Temp != 14 {
+		t.Errorf("IE location changed: %+v, source %q", other.Main, other.Source)
+	}
+}
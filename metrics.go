@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// When the process started, for process_start_time_seconds
+var processStart = time.Now()
+
+// A gauge with one sample per label set, in the Prometheus text format
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels [][2]string // Name and value pairs, in order
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...[2]string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+// Write the family in the Prometheus text exposition format. Families
+// without samples are left out.
+func (f *metricFamily) writeTo(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name)
+	for _, sample := range f.samples {
+		var labels []string
+		for _, label := range sample.labels {
+			labels = append(labels, label[0]+`="`+labelEscaper.Replace(label[1])+`"`)
+		}
+		name := f.name
+		if len(labels) > 0 {
+			name += "{" + strings.Join(labels, ",") + "}"
+		}
+		fmt.Fprintf(w, "%s %g\n", name, sample.value)
+	}
+}
+
+// Escapes for label values in the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Gauges for the latest conditions at each location, in base units
+// (Celsius, metres per second) whatever UNITS is set to
+func (agent *WeatherAgent) weatherMetrics() []*metricFamily {
+	family := func(name, help string) *metricFamily {
+		return &metricFamily{name: name, help: help}
+	}
+	var (
+		temperature = family("weather_temperature_celsius", "Air temperature.")
+		feelsLike   = family("weather_feels_like_celsius", "Apparent temperature.")
+		humidity    = family("weather_relative_humidity_percent", "Relative humidity.")
+		pressure    = family("weather_pressure_hpa", "Air pressure.")
+		windSpeed   = family("weather_wind_speed_meters_per_second", "Sustained wind speed.")
+		windGust    = family("weather_wind_gust_meters_per_second", "Wind gust speed.")
+		windDir     = family("weather_wind_direction_degrees", "Direction the wind blows from.")
+		cloudCover  = family("weather_cloud_cover_percent", "Cloud cover.")
+		uvIndex     = family("weather_uv_index", "UV index.")
+		precip      = family("weather_precipitation_mm", "Rain and snow in the last hour.")
+		aqi         = family("weather_air_quality_index", "Air quality index; scale is us (0-500, IQAir) or owm (1-5, OpenWeatherMap).")
+		pollutants  = family("weather_pollutant_micrograms_per_cubic_meter", "Pollutant concentration.")
+		updated     = family("weather_observation_timestamp_seconds", "When the conditions were observed, as a Unix time.")
+	)
+	system := agent.units()
+	for _, weather := range agent.weatherHistory.latest() {
+		location := [][2]string{{"city", weather.Name}, {"country", weather.Sys.Country}}
+		temperature.add(units.TemperatureIn(weather.Main.Temp, system).Celsius(), location...)
+		feelsLike.add(units.TemperatureIn(weather.Main.FeelsLike, system).Celsius(), location...)
+		humidity.add(float64(weather.Main.Humidity), location...)
+		pressure.add(float64(weather.Main.Pressure), location...)
+		windSpeed.add(units.SpeedIn(weather.Wind.Speed, system).MetersPerSecond(), location...)
+		windGust.add(units.SpeedIn(weather.Wind.Gust, system).MetersPerSecond(), location...)
+		windDir.add(float64(weather.Wind.Deg), location...)
+		cloudCover.add(float64(weather.Clouds.All), location...)
+		uvIndex.add(weather.UVIndex, location...)
+		precip.add(weather.Rain.OneHour+weather.Snow.OneHour, location...)
+		updated.add(float64(weather.Dt), location...)
+
+		pollutant := func(name string, value float64) {
+			pollutants.add(value, append(location, [2]string{"pollutant", name})...)
+		}
+		if weather.IQAirData.AQI > 0 {
+			aqi.add(float64(weather.IQAirData.AQI), append(location, [2]string{"scale", "us"})...)
+			pollutant("pm2_5", weather.IQAirData.PM25)
+			pollutant("pm10", weather.IQAirData.PM10)
+		} else if len(weather.AQI.List) > 0 {
+			aqi.add(float64(weather.AQI.List[0].Main.AQI), append(location, [2]string{"scale", "owm"})...)
+			c := weather.AQI.List[0].Components
+			pollutant("pm2_5", c.PM2_5)
+			pollutant("pm10", c.PM10)
+			pollutant("o3", c.O3)
+			pollutant("no2", c.NO2)
+			pollutant("so2", c.SO2)
+			pollutant("co", c.CO)
+		}
+	}
+	return []*metricFamily{temperature, feelsLike, humidity, pressure, windSpeed, windGust, windDir,
+		cloudCover, uvIndex, precip, aqi, pollutants, updated}
+}
+
+// Go runtime and process gauges
+func processMetrics() []*metricFamily {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := &metricFamily{name: "go_goroutines", help: "Number of goroutines that currently exist."}
+	goroutines.add(float64(runtime.NumGoroutine()))
+	heap := &metricFamily{name: "go_memstats_heap_alloc_bytes", help: "Heap bytes allocated and still in use."}
+	heap.add(float64(mem.HeapAlloc))
+	start := &metricFamily{name: "process_start_time_seconds", help: "Start time of the process since the Unix epoch in seconds."}
+	start.add(float64(processStart.Unix()))
+	return []*metricFamily{goroutines, heap, start}
+}
+
+// GET /metrics: the latest conditions at every fetched location, plus
+// process metrics, for Prometheus to scrape. Values come from readings the
+// agent already has, so scrapes never call upstream providers.
+func (agent *WeatherAgent) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, family := range append(agent.weatherMetrics(), processMetrics()...) {
+		family.writeTo(w)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	agent := newFixtureAgent(t, Config{Units: "imperial"})
+
+	oslo := WeatherResponse{Name: "Oslo", Dt: 1718460000}
+	oslo.Sys.Country = "NO"
+	oslo.Main.Temp = 50 // °F
+	oslo.Main.Humidity = 62
+	oslo.Wind.Speed = 10 // mph
+	oslo.IQAirData.AQI = 42
+	oslo.IQAirData.PM25 = 10.1
+	agent.weatherHistory.add(oslo)
+
+	quoted := WeatherResponse{Name: `St. "Quoted"`}
+	quoted.Main.Temp = 32
+	agent.weatherHistory.add(quoted)
+
+	rec := httptest.NewRecorder()
+	agent.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# TYPE weather_temperature_celsius gauge\n",
+		`weather_temperature_celsius{city="Oslo",country="NO"} 10` + "\n",
+		`weather_temperature_celsius{city="St. \"Quoted\"",country=""} 0` + "\n",
+		`weather_relative_humidity_percent{city="Oslo",country="NO"} 62` + "\n",
+		`weather_wind_speed_meters_per_second{city="Oslo",country="NO"} 4.4704` + "\n",
+		`weather_air_quality_index{city="Oslo",country="NO",scale="us"} 42` + "\n",
+		`weather_pollutant_micrograms_per_cubic_meter{city="Oslo",country="NO",pollutant="pm2_5"} 10.1` + "\n",
+		`weather_observation_timestamp_seconds{city="Oslo",country="NO"} 1.71846e+09` + "\n",
+		"# TYPE go_goroutines gauge\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "weather_air_quality_index{") != 1 {
+		t.Errorf("AQI reported for a location without air quality data:\n%s", body)
+	}
+}
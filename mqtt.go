@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client that connects, publishes QoS 0 messages and
+// disconnects, enough to feed Home Assistant without a broker library
+type mqttClient struct {
+	addr       string
+	serverName string // For TLS with mqtts://
+	useTLS     bool
+	username   string
+	password   string
+	clientID   string
+	timeout    time.Duration
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// Parse an mqtt://[user[:password]@]host[:port] or mqtts:// URL
+func newMQTTClient(rawURL string) (*mqttClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT URL: %v", errors.Unwrap(err))
+	}
+	c := &mqttClient{addr: u.Host, serverName: u.Hostname(), clientID: "weather-agent", timeout: 10 * time.Second}
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl":
+		c.useTLS = true
+		port = "8883"
+	default:
+		return nil, fmt.Errorf("unsupported MQTT URL scheme %q (use mqtt or mqtts)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("MQTT URL has no host")
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	return c, nil
+}
+
+// Connect, publish the messages in order and disconnect
+func (c *mqttClient) publish(messages ...mqttMessage) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: c.timeout}
+	if c.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: c.serverName})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt connect failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	// CONNECT with a clean session and a keep-alive longer than the session
+	var flags byte = 0x02
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4) // Protocol level 3.1.1
+	if c.username != "" {
+		flags |= 0x80
+	}
+	if c.password != "" {
+		flags |= 0x40
+	}
+	body = append(body, flags, 0, 60)
+	body = appendMQTTString(body, c.clientID)
+	if c.username != "" {
+		body = appendMQTTString(body, c.username)
+	}
+	if c.password != "" {
+		body = appendMQTTString(body, c.password)
+	}
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		return fmt.Errorf("mqtt connect failed: %v", err)
+	}
+
+	// CONNACK: fixed header, session present flag, return code
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(bufio.NewReader(conn), ack); err != nil {
+		return fmt.Errorf("mqtt connect failed: %v", err)
+	}
+	if ack[0] != 0x20 {
+		return fmt.Errorf("mqtt connect failed: unexpected packet 0x%02x", ack[0])
+	}
+	if code := ack[3]; code != 0 {
+		return fmt.Errorf("mqtt connect refused: %s", mqttConnectError(code))
+	}
+
+	for _, msg := range messages {
+		var header byte = 0x30 // PUBLISH, QoS 0
+		if msg.retain {
+			header |= 0x01
+		}
+		if _, err := conn.Write(mqttPacket(header, append(appendMQTTString(nil, msg.topic), msg.payload...))); err != nil {
+			return fmt.Errorf("mqtt publish to %s failed: %v", msg.topic, err)
+		}
+	}
+	_, err = conn.Write([]byte{0xE0, 0}) // DISCONNECT
+	return err
+}
+
+// A packet with its fixed header and variable-length remaining length
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func mqttConnectError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"time"
+)
+
+// Kinds of notification the agent sends
+const (
+	NotificationDigest = "digest"
+	NotificationUpdate = "update"
+	NotificationAlert  = "alert"
+	NotificationReport = "report"
+)
+
+// Content sent to notification channels. Notifiers render it in their own format.
+type Notification struct {
+	MessageID string
+	Type      string
+	AlertType string // For alerts, what triggered it (e.g. "astronomy")
+	Severity  string // For alerts: minor, moderate, severe or extreme (empty when unknown)
+	Title     string
+	Message   string // LLM-generated text
+	City      string
+	Country   string
+	Location  string // Key of the subscriber location it's for ("" for the configured location)
+	Units     string
+	Data      map[string]interface{} // Prepared weather data
+	Forecast  []ForecastDay
+	Time      time.Time
+
+	Attachments []Attachment // Files for channels that support them (email)
+
+	EngagementURL string // Open-tracking pixel / acknowledgement URL for this recipient, if enabled
+}
+
+// A file sent along with a notification
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// A channel that can deliver notifications (email, chat, webhook, ...)
+type Notifier interface {
+	// Delivery channel name, e.g. ChannelEmail
+	Channel() string
+	// Human-readable recipient description for delivery receipts
+	Target() string
+	// Deliver the notification
+	Notify(n Notification) error
+}
+
+// Send a notification through every configured notifier and every verified
+// subscription that wants it, recording a delivery receipt for each
+func (agent *WeatherAgent) notify(n Notification) {
+	if n.MessageID == "" {
+		n.MessageID = newMessageID()
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	if !agent.featureEnabled(FeatureNotifiers) {
+		agent.logger.Printf("Notifiers are disabled; dropping %s notification %s", n.Type, n.MessageID)
+		return
+	}
+
+	for _, notifier := range agent.recipientNotifiers(n) {
+		agent.deliverOrHold(notifier, n)
+	}
+}
+
+// Notifiers for every configured channel routed the notification and every
+// verified subscription at its location that wants its type. Configured
+// channels only get notifications for the configured location.
+func (agent *WeatherAgent) recipientNotifiers(n Notification) []Notifier {
+	var notifiers []Notifier
+	for _, notifier := range agent.notifiers {
+		if n.Location == "" && agent.routeAllows(notifier, n) {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	if agent.subscriptions == nil {
+		return notifiers
+	}
+	for _, sub := range agent.subscriptions.recipients(n.Type, n.Location) {
+		notifier, err := agent.subscriptionNotifier(sub)
+		if err != nil {
+			agent.logger.Printf("Skipping %s subscription %s: %v", sub.Channel, sub.ID, err)
+			continue
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers
+}
+
+// Deliver a notification now, or hold it for later if the notifier is in its
+// quiet hours or batches updates
+func (agent *WeatherAgent) deliverOrHold(notifier Notifier, n Notification) {
+	if !agent.outbox.hold(notifier, n, time.Now()) {
+		agent.deliver(notifier, n)
+		return
+	}
+	agent.logger.Printf("Holding %s notification %s for %s", n.Type, n.MessageID, notifier.Channel())
+	agent.deliveries.record(Delivery{
+		MessageID: n.MessageID,
+		Type:      n.Type,
+		Channel:   notifier.Channel(),
+		Target:    notifier.Target(),
+		Status:    DeliveryHeld,
+		City:      n.City,
+		Message:   n.Message,
+	})
+}
+
+// Deliver a notification through one notifier and record the receipt
+func (agent *WeatherAgent) deliver(notifier Notifier, n Notification) error {
+	delivery := Delivery{
+		MessageID: n.MessageID,
+		Type:      n.Type,
+		Channel:   notifier.Channel(),
+		Target:    notifier.Target(),
+		Status:    DeliveryDelivered,
+		City:      n.City,
+		Message:   n.Message,
+	}
+
+	// Let the recipient report that they opened or acted on the message
+	n.EngagementURL = agent.engagement.url(n.MessageID, notifier.Channel(), notifier.Target())
+
+	err := notifier.Notify(n)
+	if err != nil {
+		agent.logger.Printf("Error sending %s notification via %s: %v", n.Type, notifier.Channel(), err)
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+	} else {
+		agent.logger.Printf("Sent %s notification via %s to %s", n.Type, notifier.Channel(), notifier.Target())
+		agent.engagement.sent(notifier.Channel(), notifier.Target(), time.Now())
+	}
+
+	agent.deliveries.record(delivery)
+	return err
+}
+
+// Whether any notifier or verified subscription would receive the notification
+// type for the configured location
+func (agent *WeatherAgent) hasRecipients(notificationType string) bool {
+	// Severity isn't known yet, so alerts are checked at the highest one
+	probe := Notification{Type: notificationType, Severity: alertSeverities[len(alertSeverities)-1]}
+	for _, notifier := range agent.notifiers {
+		if agent.routeAllows(notifier, probe) {
+			return true
+		}
+	}
+	return agent.subscriptions != nil && len(agent.subscriptions.recipients(notificationType, "")) > 0
+}
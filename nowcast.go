@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Nowcast settings
+const (
+	nowcastSteps       = 8                // 15-minute steps requested (2 hours)
+	nowcastStep        = 15 * time.Minute // Open-Meteo minutely_15 resolution
+	nowcastCacheTTL    = 5 * time.Minute  // Nowcasts go stale quickly
+	nowcastThresholdMM = 0.1              // Precipitation per step that counts as wet
+)
+
+// Nowcast trends
+const (
+	NowcastDry        = "dry"        // No precipitation now or within the window
+	NowcastStarting   = "starting"   // Dry now, precipitation arriving
+	NowcastStopping   = "stopping"   // Precipitating now, clearing within the window
+	NowcastContinuing = "continuing" // Precipitating for the whole window
+)
+
+// Precipitation over one 15-minute step, ending at Time
+type NowcastPoint struct {
+	Time          int64   `json:"time"`             // Unix time the step ends
+	Precipitation float64 `json:"precipitation_mm"` // Always mm
+	Snowfall      float64 `json:"snowfall_cm"`      // Always cm
+}
+
+// Short-term precipitation outlook for a location
+type Nowcast struct {
+	City    string         `json:"city,omitempty"`
+	Country string         `json:"country,omitempty"`
+	Trend   string         `json:"trend"`
+	Kind    string         `json:"kind,omitempty"`    // "rain" or "snow"
+	Minutes int            `json:"minutes,omitempty"` // Until the trend's change, rounded to 5 minutes
+	Summary string         `json:"summary"`
+	Points  []NowcastPoint `json:"points"`
+}
+
+// Fetch the next two hours of 15-minutely precipitation from Open-Meteo
+func (agent *WeatherAgent) fetchNowcast(lat, lon float64, now time.Time) (*Nowcast, error) {
+	// Always request metric values so the threshold is unit-independent
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&minutely_15=precipitation,snowfall&forecast_minutely_15=%d&past_minutely_15=1&timezone=auto",
+		lat, lon, nowcastSteps)
+
+	body, _, err := agent.cachedGet(url, nowcastCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("nowcast request failed: %v", err)
+	}
+
+	var nowcastResp struct {
+		Minutely15 struct {
+			Time          []string  `json:"time"`
+			Precipitation []float64 `json:"precipitation"`
+			Snowfall      []float64 `json:"snowfall"`
+		} `json:"minutely_15"`
+		TimezoneOffset int `json:"utc_offset_seconds"`
+	}
+	if err := json.Unmarshal(body, &nowcastResp); err != nil {
+		return nil, fmt.Errorf("failed to parse nowcast response: %v", err)
+	}
+
+	// Open-Meteo returns times in the location's local timezone
+	loc := time.FixedZone("Local", nowcastResp.TimezoneOffset)
+	m := nowcastResp.Minutely15
+	points := make([]NowcastPoint, 0, len(m.Time))
+	for i, ts := range m.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", ts, loc)
+		if err != nil || i >= len(m.Precipitation) {
+			continue
+		}
+		point := NowcastPoint{Time: t.Unix(), Precipitation: m.Precipitation[i]}
+		if i < len(m.Snowfall) {
+			point.Snowfall = m.Snowfall[i]
+		}
+		points = append(points, point)
+	}
+
+	return analyzeNowcast(points, now), nil
+}
+
+// Work out the trend for the steps that haven't ended yet and describe it,
+// e.g. "rain starting in ~20 minutes"
+func analyzeNowcast(points []NowcastPoint, now time.Time) *Nowcast {
+	var upcoming []NowcastPoint
+	for _, point := range points {
+		if point.Time > now.Unix() {
+			upcoming = append(upcoming, point)
+		}
+	}
+
+	nowcast := &Nowcast{Trend: NowcastDry, Points: upcoming}
+	window := time.Duration(len(upcoming)) * nowcastStep
+	if len(upcoming) == 0 {
+		nowcast.Summary = "no nowcast available"
+		return nowcast
+	}
+
+	wet := func(p NowcastPoint) bool { return p.Precipitation >= nowcastThresholdMM }
+	kind := func(p NowcastPoint) string {
+		if p.Snowfall > 0 {
+			return "snow"
+		}
+		return "rain"
+	}
+	// A step's total covers the 15 minutes before its time, so a change is
+	// estimated to happen at the start of the first step that shows it
+	minutesUntil := func(p NowcastPoint) int {
+		start := time.Unix(p.Time, 0).Add(-nowcastStep)
+		minutes := max(0, start.Sub(now).Minutes())
+		return int(math.Round(minutes/5) * 5)
+	}
+
+	if wet(upcoming[0]) {
+		nowcast.Kind = kind(upcoming[0])
+		for _, point := range upcoming[1:] {
+			if !wet(point) {
+				nowcast.Trend = NowcastStopping
+				nowcast.Minutes = minutesUntil(point)
+				nowcast.Summary = fmt.Sprintf("%s stopping in ~%d minutes", nowcast.Kind, nowcast.Minutes)
+				return nowcast
+			}
+		}
+		nowcast.Trend = NowcastContinuing
+		nowcast.Summary = fmt.Sprintf("%s continuing for at least the next %s", nowcast.Kind, formatWindow(window))
+		return nowcast
+	}
+
+	for _, point := range upcoming[1:] {
+		if wet(point) {
+			nowcast.Trend = NowcastStarting
+			nowcast.Kind = kind(point)
+			nowcast.Minutes = minutesUntil(point)
+			nowcast.Summary = fmt.Sprintf("%s starting in ~%d minutes", nowcast.Kind, nowcast.Minutes)
+			return nowcast
+		}
+	}
+	nowcast.Summary = fmt.Sprintf("no precipitation expected in the next %s", formatWindow(window))
+	return nowcast
+}
+
+// Format a nowcast window, e.g. "2 hours" or "45 minutes"
+func formatWindow(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if d == time.Hour {
+			return "hour"
+		}
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+// Attach a precipitation nowcast to the weather response when the feature is on
+func (agent *WeatherAgent) addNowcast(weather *WeatherResponse, lat, lon float64) {
+	if !agent.featureEnabled(FeatureNowcasting) {
+		return
+	}
+
+	nowcast, err := agent.fetchNowcast(lat, lon, time.Now())
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch nowcast: %v", err)
+		return
+	}
+	weather.Nowcast = nowcast
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzeNowcast(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Steps ending 15, 30, ... minutes from now, with the given precipitation in mm
+	steps := func(precip ...float64) []NowcastPoint {
+		points := []NowcastPoint{{Time: now.Unix(), Precipitation: 9}} // Already ended, ignored
+		for i, p := range precip {
+			points = append(points, NowcastPoint{Time: now.Add(time.Duration(i+1) * nowcastStep).Unix(), Precipitation: p})
+		}
+		return points
+	}
+
+	tests := []struct {
+		name        string
+		points      []NowcastPoint
+		wantTrend   string
+		wantMinutes int
+		wantSummary string
+	}{
+		{"dry", steps(0, 0, 0, 0, 0, 0, 0, 0), NowcastDry, 0, "no precipitation expected in the next 2 hours"},
+		{"starting", steps(0, 0, 0.5, 1), NowcastStarting, 30, "rain starting in ~30 minutes"},
+		{"stopping", steps(1, 0.4, 0.05, 0), NowcastStopping, 30, "rain stopping in ~30 minutes"},
+		{"continuing", steps(1, 1, 1, 1), NowcastContinuing, 0, "rain continuing for at least the next hour"},
+		{"trace amounts", steps(0.05, 0, 0.02), NowcastDry, 0, "no precipitation expected in the next 45 minutes"},
+		{"no data", nil, NowcastDry, 0, "no nowcast available"},
+	}
+
+	for _, tt := range tests {
+		nowcast := analyzeNowcast(tt.points, now)
+		if nowcast.Trend != tt.wantTrend || nowcast.Minutes != tt.wantMinutes || nowcast.Summary != tt.wantSummary {
+			t.Errorf("%s: got %s/%d %q, want %s/%d %q", tt.name,
+				nowcast.Trend, nowcast.Minutes, nowcast.Summary, tt.wantTrend, tt.wantMinutes, tt.wantSummary)
+		}
+	}
+
+	// Snow is reported as snow, and minutes round to the nearest 5
+	points := []NowcastPoint{
+		{Time: now.Add(8 * time.Minute).Unix()},
+		{Time: now.Add(23 * time.Minute).Unix(), Precipitation: 0.3, Snowfall: 0.2},
+	}
+	if nowcast := analyzeNowcast(points, now); nowcast.Summary != "snow starting in ~10 minutes" {
+		t.Errorf("snow: got %q", nowcast.Summary)
+	}
+}
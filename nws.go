@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// National Weather Service settings
+const (
+	nwsBaseURL          = "https://api.weather.gov"
+	nwsPointsCacheTTL   = 24 * time.Hour   // Grid assignments practically never change
+	nwsDiscussionTTL    = 30 * time.Minute // Discussions are issued a few times a day
+	nwsForecastPeriods  = 4                // Periods kept (day/night halves, so two days)
+	maxNWSDiscussionLen = 1500
+)
+
+// Discussion sections worth passing to the LLM, in order of preference
+var nwsDiscussionSections = []string{"KEY MESSAGES", "SYNOPSIS", "SHORT TERM", "NEAR TERM"}
+
+// Matches an Area Forecast Discussion section header like ".SHORT TERM /Tonight through Tuesday/..."
+var nwsSectionHeader = regexp.MustCompile(`(?m)^\.([A-Z][A-Z /]+?)(?:\s*/[^/\n]*/)?\.\.\.`)
+
+// One period of an NWS gridpoint forecast, e.g. "Tonight"
+type NWSPeriod struct {
+	Name                string  `json:"name"`
+	Start               string  `json:"start"`
+	Temperature         float64 `json:"temperature"`
+	TemperatureUnit     string  `json:"temperature_unit"`
+	Wind                string  `json:"wind"`
+	ShortForecast       string  `json:"short_forecast"`
+	DetailedForecast    string  `json:"detailed_forecast"`
+	PrecipitationChance int     `json:"precipitation_chance"`
+}
+
+// National Weather Service forecast and forecasters' discussion for a US location
+type NWSForecast struct {
+	Office           string      `json:"office"` // Forecast office, e.g. "TOP" (Topeka)
+	Periods          []NWSPeriod `json:"periods"`
+	Discussion       string      `json:"discussion,omitempty"` // Key sections of the Area Forecast Discussion
+	DiscussionIssued time.Time   `json:"discussion_issued,omitempty"`
+}
+
+// Whether a country code is covered by the NWS
+func nwsCovers(country string) bool {
+	switch strings.ToUpper(strings.TrimSpace(country)) {
+	case "US", "USA":
+		return true
+	}
+	return false
+}
+
+// Fetch the gridpoint forecast and latest forecast discussion for coordinates
+func (agent *WeatherAgent) fetchNWS(lat, lon float64) (*NWSForecast, error) {
+	body, _, err := agent.cachedGet(fmt.Sprintf("%s/points/%.4f,%.4f", nwsBaseURL, lat, lon), nwsPointsCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("NWS points request failed: %v", err)
+	}
+	var points struct {
+		Properties struct {
+			GridID   string `json:"gridId"`
+			Forecast string `json:"forecast"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &points); err != nil || points.Properties.Forecast == "" {
+		return nil, fmt.Errorf("failed to parse NWS points response: %v", err)
+	}
+
+	unitsParam := "us"
+	if agent.units() == units.Metric {
+		unitsParam = "si"
+	}
+	forecastURL := points.Properties.Forecast + "?units=" + unitsParam
+	body, _, err = agent.cachedGet(forecastURL, time.Duration(agent.config.CacheTTLSeconds)*time.Second, false)
+	if err != nil {
+		return nil, fmt.Errorf("NWS forecast request failed: %v", err)
+	}
+	var forecastResp struct {
+		Properties struct {
+			Periods []struct {
+				Name                       string  `json:"name"`
+				StartTime                  string  `json:"startTime"`
+				Temperature                float64 `json:"temperature"`
+				TemperatureUnit            string  `json:"temperatureUnit"`
+				WindSpeed                  string  `json:"windSpeed"`
+				WindDirection              string  `json:"windDirection"`
+				ShortForecast              string  `json:"shortForecast"`
+				DetailedForecast           string  `json:"detailedForecast"`
+				ProbabilityOfPrecipitation struct {
+					Value *float64 `json:"value"`
+				} `json:"probabilityOfPrecipitation"`
+			} `json:"periods"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &forecastResp); err != nil {
+		return nil, fmt.Errorf("failed to parse NWS forecast: %v", err)
+	}
+
+	nws := &NWSForecast{Office: points.Properties.GridID}
+	for i, p := range forecastResp.Properties.Periods {
+		if i >= nwsForecastPeriods {
+			break
+		}
+		period := NWSPeriod{
+			Name:             p.Name,
+			Start:            p.StartTime,
+			Temperature:      p.Temperature,
+			TemperatureUnit:  p.TemperatureUnit,
+			Wind:             strings.TrimSpace(p.WindDirection + " " + p.WindSpeed),
+			ShortForecast:    p.ShortForecast,
+			DetailedForecast: p.DetailedForecast,
+		}
+		if p.ProbabilityOfPrecipitation.Value != nil {
+			period.PrecipitationChance = int(*p.ProbabilityOfPrecipitation.Value)
+		}
+		nws.Periods = append(nws.Periods, period)
+	}
+
+	// The discussion is a bonus; a forecast without it is still useful
+	body, _, err = agent.cachedGet(fmt.Sprintf("%s/products/types/AFD/locations/%s/latest", nwsBaseURL, nws.Office), nwsDiscussionTTL, false)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch NWS forecast discussion: %v", err)
+		return nws, nil
+	}
+	var product struct {
+		IssuanceTime time.Time `json:"issuanceTime"`
+		ProductText  string    `json:"productText"`
+	}
+	if err := json.Unmarshal(body, &product); err != nil {
+		agent.logger.Printf("Warning: Failed to parse NWS forecast discussion: %v", err)
+		return nws, nil
+	}
+	nws.Discussion = summarizeDiscussion(product.ProductText, maxNWSDiscussionLen)
+	nws.DiscussionIssued = product.IssuanceTime
+	return nws, nil
+}
+
+// Pull the most useful sections out of an Area Forecast Discussion and
+// unwrap its hard-wrapped lines, cutting the result at maxLen on a word boundary
+func summarizeDiscussion(text string, maxLen int) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	headers := nwsSectionHeader.FindAllStringSubmatchIndex(text, -1)
+
+	sections := make(map[string]string)
+	for i, h := range headers {
+		name := strings.TrimSpace(text[h[2]:h[3]])
+		end := len(text)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		body := text[h[1]:end]
+		if cut := strings.Index(body, "&&"); cut >= 0 {
+			body = body[:cut]
+		}
+		if _, seen := sections[name]; !seen {
+			sections[name] = strings.Join(strings.Fields(body), " ")
+		}
+	}
+
+	var parts []string
+	for _, want := range nwsDiscussionSections {
+		if body := sections[want]; body != "" {
+			parts = append(parts, body)
+		}
+	}
+	if len(parts) == 0 {
+		if body := sections["DISCUSSION"]; body != "" {
+			parts = append(parts, body)
+		}
+	}
+
+	summary := strings.Join(parts, " ")
+	if len(summary) > maxLen {
+		summary = summary[:maxLen]
+		if i := strings.LastIndex(summary, " "); i > 0 {
+			summary = summary[:i]
+		}
+		summary += "..."
+	}
+	return summary
+}
+
+// Attach NWS data to the weather response for US locations when enabled
+func (agent *WeatherAgent) addNWS(weather *WeatherResponse, lat, lon float64) {
+	if !agent.config.NWSEnabled || !nwsCovers(weather.Sys.Country) {
+		return
+	}
+
+	nws, err := agent.fetchNWS(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch NWS forecast: %v", err)
+		return
+	}
+	weather.NWS = nws
+}
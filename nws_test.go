@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+const sampleAFD = `000
+FXUS63 KTOP 141130
+AFDTOP
+
+Area Forecast Discussion
+National Weather Service Topeka KS
+630 AM CDT Mon Oct 14 2026
+
+.KEY MESSAGES...
+
+- Strong storms possible late this afternoon into
+  this evening.
+
+&&
+
+.DISCUSSION...
+Issued at 316 AM CDT Mon Oct 14 2026
+
+A cold front sweeps through
+the area tonight.
+
+&&
+
+.AVIATION /12Z TAFS THROUGH 12Z TUESDAY/...
+VFR conditions.
+`
+
+func TestSummarizeDiscussion(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{
+			name:   "preferred section unwrapped",
+			text:   sampleAFD,
+			maxLen: 1500,
+			want:   "- Strong storms possible late this afternoon into this evening.",
+		},
+		{
+			name:   "falls back to discussion",
+			text:   ".DISCUSSION...\nQuiet weather\ncontinues.\n&&\n",
+			maxLen: 1500,
+			want:   "Quiet weather continues.",
+		},
+		{
+			name:   "section with time range header",
+			text:   ".SHORT TERM /Tonight through Tuesday/...\nRain ends by dawn.\n",
+			maxLen: 1500,
+			want:   "Rain ends by dawn.",
+		},
+		{
+			name:   "truncated on word boundary",
+			text:   ".SYNOPSIS...\nHigh pressure builds in\n",
+			maxLen: 12,
+			want:   "High...",
+		},
+		{
+			name:   "no sections",
+			text:   "Nothing useful here",
+			maxLen: 1500,
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeDiscussion(tt.text, tt.maxLen); got != tt.want {
+				t.Errorf("summarizeDiscussion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNWSCovers(t *testing.T) {
+	for country, want := range map[string]bool{"US": true, "us": true, "USA": true, "CA": false, "": false} {
+		if got := nwsCovers(country); got != want {
+			t.Errorf("nwsCovers(%q) = %v, want %v", country, got, want)
+		}
+	}
+}
+
+func TestAddNWSDisabled(t *testing.T) {
+	agent := &WeatherAgent{config: Config{NWSEnabled: false}}
+	weather := WeatherResponse{}
+	weather.Sys.Country = "US"
+	agent.addNWS(&weather, 39.05, -95.68)
+	if weather.NWS != nil {
+		t.Error("addNWS attached data while disabled")
+	}
+}
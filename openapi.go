@@ -0,0 +1,23 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI 3 description of the HTTP API. The request and response schemas
+// mirror the types in apitypes.go; openapi_test.go keeps the two in step.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GET /openapi.json serves the API description. It's public so tools can
+// discover the API before they have a key.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadOpenAPISpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return spec
+}
+
+// Follow a "#/components/..." reference
+func resolveRef(spec map[string]interface{}, ref string) (map[string]interface{}, bool) {
+	var node interface{} = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		node = m[part]
+	}
+	m, ok := node.(map[string]interface{})
+	return m, ok
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	if version, _ := spec["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("openapi = %q, want 3.x", version)
+	}
+
+	// Every reference points somewhere
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := n["$ref"].(string); ok {
+				if _, found := resolveRef(spec, ref); !found {
+					t.Errorf("unresolved $ref %q", ref)
+				}
+			}
+			for _, child := range n {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range n {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+
+	// Every API route registered in main.go is documented
+	paths, _ := spec["paths"].(map[string]interface{})
+	for _, pattern := range registeredRoutes(t) {
+		if !strings.HasPrefix(pattern, "/api/") && !strings.Contains(pattern, ".") {
+			continue // HTML pages
+		}
+		if _, ok := paths[pattern]; !ok {
+			t.Errorf("route %s is missing from openapi.json", pattern)
+		}
+	}
+}
+
+// Routes registered in main.go, with the API prefix on API routes
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	source, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	for _, match := range regexp.MustCompile(`(http|api)\.HandleFunc\("([^"]+)"`).FindAllStringSubmatch(string(source), -1) {
+		if match[1] == "api" {
+			match[2] = apiPrefix + match[2]
+		}
+		routes = append(routes, match[2])
+	}
+	return routes
+}
+
+// JSON field names of a struct, including embedded structs' fields
+func jsonFields(typ reflect.Type) []string {
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFields(field.Type)...)
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	types := map[string]interface{}{
+		"ErrorResponse":             ErrorResponse{},
+		"ErrorDetail":               ErrorDetail{},
+		"WeatherUpdate":             WeatherUpdateResponse{},
+		"Conditions":                ConditionsResponse{},
+		"Persona":                   Persona{},
+		"PersonasResponse":          PersonasResponse{},
+		"ChatRequest":               ChatRequest{},
+		"ChatResponse":              ChatResponse{},
+		"Delivery":                  Delivery{},
+		"DeliveriesResponse":        DeliveriesResponse{},
+		"Observation":               Observation{},
+		"HistoryResponse":           HistoryResponse{},
+		"ReportsResponse":           ReportsResponse{},
+		"UsageTotals":               UsageTotals{},
+		"UsageBudget":               UsageBudget{},
+		"UsageResponse":             UsageResponse{},
+		"RadarFrame":                RadarFrame{},
+		"RadarFramesResponse":       RadarFramesResponse{},
+		"RefreshJob":                RefreshJob{},
+		"MessageJob":                MessageJob{},
+		"ProfileLocation":           ProfileLocation{},
+		"Profile":                   Profile{},
+		"ProfileResponse":           ProfileResponse{},
+		"SubscriptionPreferences":   SubscriptionPreferences{},
+		"Subscription":              Subscription{},
+		"SubscriptionsResponse":     SubscriptionsResponse{},
+		"SubscriptionRequest":       SubscriptionRequest{},
+		"SubscriptionUpdateRequest": SubscriptionUpdateRequest{},
+		"Feedback":                  Feedback{},
+		"FeedbackRequest":           FeedbackRequest{},
+		"FeedbackSummary":           FeedbackSummary{},
+		"HAState":                   HAStateResponse{},
+		"GrafanaSearchRequest":      GrafanaSearchRequest{},
+		"GrafanaRange":              GrafanaRange{},
+		"GrafanaTarget":             GrafanaTarget{},
+		"GrafanaQueryRequest":       GrafanaQueryRequest{},
+		"GrafanaSeries":             GrafanaSeries{},
+		"GrafanaColumn":             GrafanaColumn{},
+		"GrafanaTable":              GrafanaTable{},
+		"GrafanaAnnotationRequest":  GrafanaAnnotationRequest{},
+		"GrafanaAnnotation":         GrafanaAnnotation{},
+		"IngestRequest":             IngestRequest{},
+		"SensorReading":             SensorReading{},
+		"SensorsResponse":           SensorsResponse{},
+		"ModelComparison":           ModelComparison{},
+		"ModelTally":                ModelTally{},
+		"ComparisonsResponse":       ComparisonsResponse{},
+		"PreferenceRequest":         PreferenceRequest{},
+		"FeaturesResponse":          FeaturesResponse{},
+		"ArchivedResponse":          ArchivedResponse{},
+		"ArchiveResponse":           ArchiveResponse{},
+		"PromptRecord":              PromptRecord{},
+		"PromptsResponse":           PromptsResponse{},
+		"ReplayRequest":             ReplayRequest{},
+		"ReplayResponse":            ReplayResponse{},
+	}
+
+	schemas, _ := resolveRef(spec, "#/components/schemas")
+	for name, value := range schemas {
+		properties, _ := value.(map[string]interface{})["properties"].(map[string]interface{})
+		if properties == nil {
+			continue // Free-form objects
+		}
+		typ, ok := types[name]
+		if !ok {
+			t.Errorf("schema %s has no Go type to check against", name)
+			continue
+		}
+
+		var documented []string
+		for property := range properties {
+			documented = append(documented, property)
+		}
+		fields := jsonFields(reflect.TypeOf(typ))
+		sort.Strings(documented)
+		sort.Strings(fields)
+		if !reflect.DeepEqual(documented, fields) {
+			t.Errorf("schema %s has properties %v, but %T encodes %v", name, documented, typ, fields)
+		}
+	}
+}
+
+// Check a decoded JSON value against a schema, returning the mismatches
+func schemaErrors(spec, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema, _ = resolveRef(spec, ref)
+	}
+	if options, ok := schema["oneOf"].([]interface{}); ok {
+		for _, option := range options {
+			if len(schemaErrors(spec, option.(map[string]interface{}), value, at)) == 0 {
+				return nil
+			}
+		}
+		return []string{at + ": matches none of the oneOf schemas"}
+	}
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{at + ": null"}
+	}
+
+	var errs []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want an object", at, value)}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing %s", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				errs = append(errs, schemaErrors(spec, property, field, at+"."+name)...)
+			} else if additional != nil {
+				errs = append(errs, schemaErrors(spec, additional, field, at+"."+name)...)
+			} else if properties != nil {
+				errs = append(errs, fmt.Sprintf("%s: undocumented property %s", at, name))
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want an array", at, value)}
+		}
+		for i, item := range items {
+			errs = append(errs, schemaErrors(spec, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want a string", at, value)}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a date-time", at, s))
+			}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok && s != "" {
+			found := false
+			for _, allowed := range enum {
+				found = found || allowed == s
+			}
+			if !found {
+				errs = append(errs, fmt.Sprintf("%s: %q is not one of %v", at, s, enum))
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			errs = append(errs, fmt.Sprintf("%s: %v, want an integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %T, want a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %T, want a boolean", at, value))
+		}
+	}
+	return errs
+}
+
+func TestHandlersMatchOpenAPI(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	agent := newFixtureAgent(t, Config{LLMModel: "model-a", LLMModelB: "model-b", LLMAPIKey: "key"})
+	agent.deliveries = newDeliveryLog()
+	agent.feedback = newFeedbackLog()
+	agent.comparisons = newComparisonStore()
+	agent.prompts, _ = newPromptLog("", 10)
+	agent.subscriptions, _ = newSubscriptionStore("")
+	agent.deliveries.record(Delivery{MessageID: "m1", Channel: ChannelUI, Status: DeliveryDelivered, Message: "Sunny."})
+	agent.feedback.record(Feedback{MessageID: "m1", Rating: RatingUp, Length: 6})
+	comparison := agent.comparisons.add(ModelComparison{ModelA: "model-a", ModelB: "model-b", MessageA: "Sunny.", MessageB: "Sun!"})
+	agent.comparisons.vote(comparison.ID, VariantB, "client")
+	agent.prompts.record(PromptRecord{Model: "model-a", UserMessage: "Weather?", Response: "Sunny."})
+	agent.subscriptions.add(subscriptionOwner(""), ChannelWebhook, "https://example.com/hook", SubscriptionPreferences{Digest: true},
+		&ProfileLocation{City: "Leeds", Country: "GB", Lat: 53.7965, Lon: -1.5478})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		schema  string
+	}{
+		{"usage", agent.handleUsage, http.MethodGet, "/api/usage?days=2", "", "UsageResponse"},
+		{"feedback summary", agent.handleFeedback, http.MethodGet, "/api/feedback", "", "FeedbackSummary"},
+		{"rate message", agent.handleFeedback, http.MethodPost, "/api/feedback", `{"message_id":"m1","rating":"down","comment":"Too long"}`, "Feedback"},
+		{"comparisons", agent.handleComparisons, http.MethodGet, "/api/comparisons", "", "ComparisonsResponse"},
+		{"prompts", agent.handlePrompts, http.MethodGet, "/api/prompts", "", "PromptsResponse"},
+		{"features", agent.handleFeatures, http.MethodGet, "/api/admin/features", "", "FeaturesResponse"},
+		{"archive", agent.handleArchive, http.MethodGet, "/api/admin/archive", "", "ArchiveResponse"},
+		{"subscriptions", agent.handleSubscriptions, http.MethodGet, "/api/subscriptions", "", "SubscriptionsResponse"},
+		{"subscribe", agent.handleSubscriptions, http.MethodPost, "/api/subscriptions", `{"channel":"webhook","target":"https://example.com/other"}`, "Subscription"},
+		{"profile", agent.handleProfile, http.MethodPut, "/api/profile", `{"units":"imperial","language":"de"}`, "ProfileResponse"},
+	}
+	agent.profiles, _ = newProfileStore("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code >= 300 {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			schema, _ := resolveRef(spec, "#/components/schemas/"+tt.schema)
+			for _, err := range schemaErrors(spec, schema, body, tt.schema) {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Errors have the documented shape too
+	rec := httptest.NewRecorder()
+	agent.handleComparison(rec, httptest.NewRequest(http.MethodGet, "/api/v1/comparisons/missing", nil))
+	var body interface{}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	schema, _ := resolveRef(spec, "#/components/schemas/ErrorResponse")
+	if errs := schemaErrors(spec, schema, body, "ErrorResponse"); rec.Code != http.StatusNotFound || len(errs) > 0 {
+		t.Errorf("unknown comparison: status %d, %v", rec.Code, errs)
+	}
+
+	rec = httptest.NewRecorder()
+	handleOpenAPI(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" || !json.Valid(rec.Body.Bytes()) {
+		t.Errorf("/openapi.json: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When a configured channel accepts non-urgent notifications. Times are
+// minutes after midnight, server local time like the digest.
+type deliverySchedule struct {
+	QuietStart int
+	QuietEnd   int
+	HasQuiet   bool
+	BatchTimes []int // Non-urgent updates and alerts are combined and sent at these times
+}
+
+// Whether t falls in the quiet hours, which may span midnight
+func (s deliverySchedule) quiet(t time.Time) bool {
+	if !s.HasQuiet {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if s.QuietStart <= s.QuietEnd {
+		return minute >= s.QuietStart && minute < s.QuietEnd
+	}
+	return minute >= s.QuietStart || minute < s.QuietEnd
+}
+
+// Whether a batch time falls in (since, now]
+func (s deliverySchedule) batchDue(since, now time.Time) bool {
+	for _, batch := range s.BatchTimes {
+		hour, minute := batch/60, batch%60
+		if next := nextDailyRun(since, hour, minute); !next.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Severe and extreme alerts go out immediately, whatever the schedule
+func urgentNotification(n Notification) bool {
+	return n.Type == NotificationAlert && alertSeverityLevel(n.Severity) >= alertSeverityLevel("severe")
+}
+
+// Whether a notification can wait for the next batch. Digests and reports are
+// already scheduled, so they are only delayed by quiet hours.
+func batchable(n Notification) bool {
+	return (n.Type == NotificationUpdate || n.Type == NotificationAlert) && !urgentNotification(n)
+}
+
+// Parse NOTIFIER_QUIET_HOURS entries like "pushover=22:00-07:00" and
+// NOTIFIER_BATCH_TIMES entries like "matrix=07:00,18:00", keyed by channel
+func parseDeliverySchedules(quietHours, batchTimes []string) (map[string]deliverySchedule, error) {
+	schedules := make(map[string]deliverySchedule)
+	entry := func(value string) (string, string, error) {
+		channel, spec, ok := strings.Cut(value, "=")
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if !ok || channel == "" || strings.TrimSpace(spec) == "" {
+			return "", "", fmt.Errorf("%q should look like channel=times", value)
+		}
+		if !containsString(routableChannels, channel) {
+			return "", "", fmt.Errorf("unknown channel %q (use %s)", channel, strings.Join(routableChannels, ", "))
+		}
+		return channel, spec, nil
+	}
+	minutes := func(value string) (int, error) {
+		hour, minute, err := parseTimeOfDay(value)
+		return hour*60 + minute, err
+	}
+
+	for _, value := range quietHours {
+		channel, spec, err := entry(value)
+		if err != nil {
+			return nil, err
+		}
+		schedule := schedules[channel]
+		if schedule.HasQuiet {
+			return nil, fmt.Errorf("quiet hours for %s are set twice", channel)
+		}
+		start, end, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("quiet hours for %s should look like 22:00-07:00", channel)
+		}
+		if schedule.QuietStart, err = minutes(start); err != nil {
+			return nil, err
+		}
+		if schedule.QuietEnd, err = minutes(end); err != nil {
+			return nil, err
+		}
+		if schedule.QuietStart == schedule.QuietEnd {
+			return nil, fmt.Errorf("quiet hours for %s start and end at the same time", channel)
+		}
+		schedule.HasQuiet = true
+		schedules[channel] = schedule
+	}
+
+	for _, value := range batchTimes {
+		channel, spec, err := entry(value)
+		if err != nil {
+			return nil, err
+		}
+		schedule := schedules[channel]
+		if len(schedule.BatchTimes) > 0 {
+			return nil, fmt.Errorf("batch times for %s are set twice", channel)
+		}
+		for _, t := range strings.Split(spec, ",") {
+			batch, err := minutes(t)
+			if err != nil {
+				return nil, err
+			}
+			schedule.BatchTimes = append(schedule.BatchTimes, batch)
+		}
+		schedules[channel] = schedule
+	}
+	return schedules, nil
+}
+
+// Notifications held back for one notifier
+type heldQueue struct {
+	notifier Notifier
+	items    []Notification
+}
+
+// Holds notifications for configured channels during their quiet hours or
+// until their next batch time
+type notificationOutbox struct {
+	schedules map[string]deliverySchedule
+
+	mu     sync.Mutex
+	queues map[string]*heldQueue // Keyed by channel and target
+}
+
+func newNotificationOutbox(schedules map[string]deliverySchedule) *notificationOutbox {
+	return &notificationOutbox{schedules: schedules, queues: make(map[string]*heldQueue)}
+}
+
+// Queue the notification if the notifier's schedule says it should wait,
+// reporting whether it did
+func (o *notificationOutbox) hold(notifier Notifier, n Notification, now time.Time) bool {
+	if o == nil || urgentNotification(n) {
+		return false
+	}
+	schedule, ok := o.schedules[notifier.Channel()]
+	if !ok {
+		return false
+	}
+	if !schedule.quiet(now) && !(len(schedule.BatchTimes) > 0 && batchable(n)) {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := notifier.Channel() + "|" + notifier.Target()
+	queue, ok := o.queues[key]
+	if !ok {
+		queue = &heldQueue{notifier: notifier}
+		o.queues[key] = queue
+	}
+	queue.items = append(queue.items, n)
+	return true
+}
+
+// A held notification ready to go out
+type releasedNotification struct {
+	notifier     Notifier
+	notification Notification
+}
+
+// Take the notifications whose wait is over at now, given the previous check
+// at since. Batchable ones for the same notifier are combined into one.
+func (o *notificationOutbox) release(since, now time.Time) []releasedNotification {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var released []releasedNotification
+	for key, queue := range o.queues {
+		schedule := o.schedules[queue.notifier.Channel()]
+		if schedule.quiet(now) {
+			continue
+		}
+		batchNow := len(schedule.BatchTimes) == 0 || schedule.batchDue(since, now)
+
+		var waiting, batch []Notification
+		for _, n := range queue.items {
+			switch {
+			case !batchable(n):
+				released = append(released, releasedNotification{queue.notifier, n})
+			case batchNow:
+				batch = append(batch, n)
+			default:
+				waiting = append(waiting, n)
+			}
+		}
+		if len(batch) > 0 {
+			released = append(released, releasedNotification{queue.notifier, combineNotifications(batch)})
+		}
+		if len(waiting) == 0 {
+			delete(o.queues, key)
+		} else {
+			queue.items = waiting
+		}
+	}
+	return released
+}
+
+// One notification covering several held ones, oldest first, with the latest
+// weather data
+func combineNotifications(items []Notification) Notification {
+	if len(items) == 1 {
+		return items[0]
+	}
+	latest := items[len(items)-1]
+	combined := Notification{
+		Type:     NotificationUpdate,
+		Title:    fmt.Sprintf("%d weather updates for %s", len(items), latest.City),
+		City:     latest.City,
+		Country:  latest.Country,
+		Units:    latest.Units,
+		Data:     latest.Data,
+		Forecast: latest.Forecast,
+	}
+	var message strings.Builder
+	for i, n := range items {
+		if i > 0 {
+			message.WriteString("\n\n")
+		}
+		message.WriteString(n.Time.Format("3:04 PM") + ": ")
+		if n.Type == NotificationAlert && n.Title != "" {
+			message.WriteString(n.Title + ". ")
+		}
+		message.WriteString(n.Message)
+	}
+	combined.Message = message.String()
+	return combined
+}
+
+// Deliver held notifications once a minute as quiet hours end and batch
+// times come round
+func (agent *WeatherAgent) runOutbox() {
+	since := time.Now()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		agent.flushOutbox(since, now)
+		since = now
+	}
+}
+
+func (agent *WeatherAgent) flushOutbox(since, now time.Time) {
+	for _, r := range agent.outbox.release(since, now) {
+		n := r.notification
+		if n.MessageID == "" {
+			n.MessageID = newMessageID()
+			n.Time = now
+		}
+		agent.deliver(r.notifier, n)
+	}
+}
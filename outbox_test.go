@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// Notifier that records what it's sent
+type recordingNotifier struct {
+	channel string
+	sent    []Notification
+}
+
+func (r *recordingNotifier) Channel() string { return r.channel }
+func (r *recordingNotifier) Target() string  { return "test" }
+func (r *recordingNotifier) Notify(n Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 6, 15, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseDeliverySchedules(t *testing.T) {
+	schedules, err := parseDeliverySchedules([]string{"pushover=22:00-07:00", "matrix=12:30-13:30"}, []string{"matrix=07:00, 18:00"})
+	if err != nil {
+		t.Fatalf("parseDeliverySchedules() error: %v", err)
+	}
+	if s := schedules["pushover"]; !s.HasQuiet || s.QuietStart != 22*60 || s.QuietEnd != 7*60 || len(s.BatchTimes) != 0 {
+		t.Errorf("pushover schedule = %+v", s)
+	}
+	if s := schedules["matrix"]; !s.HasQuiet || len(s.BatchTimes) != 2 || s.BatchTimes[1] != 18*60 {
+		t.Errorf("matrix schedule = %+v", s)
+	}
+
+	invalid := []struct {
+		quiet, batch []string
+	}{
+		{[]string{"pushover=22:00"}, nil},
+		{[]string{"pushover=22:00-22:00"}, nil},
+		{[]string{"pager=22:00-07:00"}, nil},
+		{[]string{"pushover=10pm-7am"}, nil},
+		{nil, []string{"matrix="}},
+		{nil, []string{"matrix=07:00", "matrix=18:00"}},
+	}
+	for _, tt := range invalid {
+		if _, err := parseDeliverySchedules(tt.quiet, tt.batch); err == nil {
+			t.Errorf("parseDeliverySchedules(%q, %q): expected error", tt.quiet, tt.batch)
+		}
+	}
+}
+
+func TestDeliveryScheduleQuiet(t *testing.T) {
+	overnight := deliverySchedule{QuietStart: 22 * 60, QuietEnd: 7 * 60, HasQuiet: true}
+	lunch := deliverySchedule{QuietStart: 12*60 + 30, QuietEnd: 13*60 + 30, HasQuiet: true}
+	tests := []struct {
+		schedule deliverySchedule
+		t        time.Time
+		want     bool
+	}{
+		{overnight, at(23, 15), true},
+		{overnight, at(3, 0), true},
+		{overnight, at(7, 0), false},
+		{overnight, at(21, 59), false},
+		{lunch, at(12, 45), true},
+		{lunch, at(13, 30), false},
+		{deliverySchedule{}, at(3, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.quiet(tt.t); got != tt.want {
+			t.Errorf("quiet(%s) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestOutboxQuietHours(t *testing.T) {
+	pushover := &recordingNotifier{channel: ChannelPushover}
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		outbox:     newNotificationOutbox(map[string]deliverySchedule{"pushover": {QuietStart: 22 * 60, QuietEnd: 7 * 60, HasQuiet: true}}),
+	}
+
+	outbox := agent.outbox
+	if !outbox.hold(pushover, Notification{Type: NotificationAlert, Severity: "moderate", Message: "Frost", Time: at(23, 0)}, at(23, 0)) {
+		t.Error("moderate alert not held during quiet hours")
+	}
+	if outbox.hold(pushover, Notification{Type: NotificationAlert, Severity: "severe", Message: "Storm"}, at(23, 5)) {
+		t.Error("severe alert held during quiet hours")
+	}
+	if !outbox.hold(pushover, Notification{Type: NotificationDigest, Message: "Digest"}, at(6, 30)) {
+		t.Error("digest not held during quiet hours")
+	}
+	if outbox.hold(pushover, Notification{Type: NotificationUpdate, Message: "Update"}, at(9, 0)) {
+		t.Error("update held outside quiet hours")
+	}
+
+	agent.flushOutbox(at(6, 58), at(6, 59))
+	if len(pushover.sent) != 0 {
+		t.Fatalf("sent %d during quiet hours", len(pushover.sent))
+	}
+	agent.flushOutbox(at(6, 59), at(7, 0))
+	if len(pushover.sent) != 2 || pushover.sent[0].Message == pushover.sent[1].Message {
+		t.Fatalf("sent = %+v, want the alert and the digest separately", pushover.sent)
+	}
+	agent.flushOutbox(at(7, 0), at(7, 1))
+	if len(pushover.sent) != 2 {
+		t.Errorf("held notifications sent twice")
+	}
+}
+
+func TestOutboxBatching(t *testing.T) {
+	matrix := &recordingNotifier{channel: ChannelMatrix}
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		notifiers:  []Notifier{matrix},
+		outbox:     newNotificationOutbox(map[string]deliverySchedule{"matrix": {BatchTimes: []int{7 * 60, 18 * 60}}}),
+	}
+
+	agent.notify(Notification{Type: NotificationUpdate, City: "Oslo", Message: "Cloudy.", Time: at(14, 0)})
+	agent.notify(Notification{Type: NotificationAlert, Severity: "minor", Title: "Aurora tonight", City: "Oslo", Message: "Look north.", Time: at(15, 0)})
+	agent.notify(Notification{Type: NotificationDigest, City: "Oslo", Message: "Digest."})
+	agent.notify(Notification{Type: NotificationAlert, Severity: "extreme", City: "Oslo", Message: "Evacuate."})
+	if len(matrix.sent) != 2 || matrix.sent[0].Message != "Digest." || matrix.sent[1].Message != "Evacuate." {
+		t.Fatalf("sent immediately = %+v, want the digest and the extreme alert", matrix.sent)
+	}
+	if held := agent.deliveries.list(ChannelMatrix, "", 0); held[len(held)-1].Status != DeliveryHeld {
+		t.Errorf("first receipt = %+v, want held", held[len(held)-1])
+	}
+
+	agent.flushOutbox(at(17, 58), at(17, 59))
+	if len(matrix.sent) != 2 {
+		t.Fatal("batch sent before its time")
+	}
+	agent.flushOutbox(at(17, 59), at(18, 0))
+	if len(matrix.sent) != 3 {
+		t.Fatalf("sent %d, want the combined batch", len(matrix.sent))
+	}
+	batch := matrix.sent[2]
+	if batch.Type != NotificationUpdate || batch.Title != "2 weather updates for Oslo" || batch.MessageID == "" {
+		t.Errorf("batch = %+v", batch)
+	}
+	if want := "2:00 PM: Cloudy.\n\n3:00 PM: Aurora tonight. Look north."; batch.Message != want {
+		t.Errorf("batch message = %q, want %q", batch.Message, want)
+	}
+}
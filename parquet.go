@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Column types the Parquet writer supports
+const (
+	parquetString    = iota // UTF-8 byte array
+	parquetTimestamp        // Milliseconds since the epoch, UTC
+	parquetDouble
+	parquetInt32
+	parquetBoolean
+)
+
+// A column in a Parquet schema
+type parquetField struct {
+	Name string
+	Type int
+}
+
+// Rows buffered before they're written out as a row group
+const parquetRowGroupRows = 10000
+
+// Minimal Parquet writer: required, PLAIN-encoded, uncompressed columns,
+// written out a row group at a time so only one group is held in memory.
+// Enough for spreadsheets and dataframe libraries to read the exports
+// without a third-party dependency.
+type parquetWriter struct {
+	w         io.Writer
+	fields    []parquetField
+	groupRows int             // Rows per row group
+	values    [][]interface{} // Per column, for the row group being filled
+	rows      int             // Rows in the row group being filled
+	offset    int64           // Bytes written so far
+	groups    []parquetRowGroup
+}
+
+// A row group already written, for the footer
+type parquetRowGroup struct {
+	rows   int
+	chunks []parquetChunk // Per column
+}
+
+type parquetChunk struct {
+	offset, size int64
+}
+
+func newParquetWriter(w io.Writer, fields []parquetField) *parquetWriter {
+	return &parquetWriter{w: w, fields: fields, groupRows: parquetRowGroupRows, values: make([][]interface{}, len(fields))}
+}
+
+// Add a row with one value per field: string, time.Time, float64, int or
+// bool. Writes out the row group once it's full.
+func (p *parquetWriter) appendRow(values ...interface{}) error {
+	for i := range p.fields {
+		p.values[i] = append(p.values[i], values[i])
+	}
+	p.rows++
+	if p.rows >= p.groupRows {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// Physical type and converted (legacy logical) type of a field; -1 for none
+func (f parquetField) types() (physical, converted int32) {
+	switch f.Type {
+	case parquetString:
+		return 6, 0 // BYTE_ARRAY, UTF8
+	case parquetTimestamp:
+		return 2, 9 // INT64, TIMESTAMP_MILLIS
+	case parquetDouble:
+		return 5, -1
+	case parquetInt32:
+		return 1, -1
+	}
+	return 0, -1 // BOOLEAN
+}
+
+// PLAIN-encode a column's values
+func (p *parquetWriter) encode(column int) ([]byte, error) {
+	field := p.fields[column]
+	var data []byte
+	for row, value := range p.values[column] {
+		var ok bool
+		switch field.Type {
+		case parquetString:
+			var v string
+			if v, ok = value.(string); ok {
+				data = binary.LittleEndian.AppendUint32(data, uint32(len(v)))
+				data = append(data, v...)
+			}
+		case parquetTimestamp:
+			var v time.Time
+			if v, ok = value.(time.Time); ok {
+				data = binary.LittleEndian.AppendUint64(data, uint64(v.UnixMilli()))
+			}
+		case parquetDouble:
+			var v float64
+			if v, ok = value.(float64); ok {
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+			}
+		case parquetInt32:
+			var v int
+			if v, ok = value.(int); ok {
+				data = binary.LittleEndian.AppendUint32(data, uint32(int32(v)))
+			}
+		case parquetBoolean:
+			var v bool
+			if v, ok = value.(bool); ok {
+				// Bit-packed, least significant bit first
+				if row%8 == 0 {
+					data = append(data, 0)
+				}
+				if v {
+					data[len(data)-1] |= 1 << (row % 8)
+				}
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("parquet: %T value in %s column", value, field.Name)
+		}
+	}
+	return data, nil
+}
+
+// Write the buffered rows as a row group with one data page per column,
+// preceded by the magic if this is the first
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+
+	group := parquetRowGroup{rows: p.rows, chunks: make([]parquetChunk, len(p.fields))}
+	for i := range p.fields {
+		data, err := p.encode(i)
+		if err != nil {
+			return err
+		}
+		header := &thriftCompact{}
+		header.begin()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.structField(5) // DataPageHeader
+		header.i32(1, int32(p.rows))
+		header.i32(2, 0) // PLAIN
+		header.i32(3, 3) // RLE definition levels (none for required columns)
+		header.i32(4, 3) // RLE repetition levels
+		header.end()
+		header.end()
+
+		group.chunks[i] = parquetChunk{offset: p.offset, size: int64(len(header.buf) + len(data))}
+		if err := p.write(header.buf); err != nil {
+			return err
+		}
+		if err := p.write(data); err != nil {
+			return err
+		}
+		p.values[i] = p.values[i][:0]
+	}
+	p.groups = append(p.groups, group)
+	p.rows = 0
+	return nil
+}
+
+// Write any buffered rows and the footer, completing the file
+func (p *parquetWriter) close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.offset == 0 {
+		if err := p.write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+
+	var totalRows int64
+	for _, group := range p.groups {
+		totalRows += int64(group.rows)
+	}
+
+	meta := &thriftCompact{}
+	meta.begin()
+	meta.i32(1, 1) // Format version
+	meta.list(2, thriftStruct, len(p.fields)+1)
+	meta.begin()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(p.fields)))
+	meta.end()
+	for _, field := range p.fields {
+		physical, converted := field.types()
+		meta.begin()
+		meta.i32(1, physical)
+		meta.i32(3, 0) // REQUIRED
+		meta.str(4, field.Name)
+		if converted >= 0 {
+			meta.i32(6, converted)
+		}
+		meta.end()
+	}
+	meta.i64(3, totalRows)
+
+	// An empty file has no row groups, which readers expect rather than an empty one
+	meta.list(4, thriftStruct, len(p.groups))
+	for _, group := range p.groups {
+		var total int64
+		meta.begin()
+		meta.list(1, thriftStruct, len(p.fields))
+		for i, field := range p.fields {
+			physical, _ := field.types()
+			chunk := group.chunks[i]
+			meta.begin()
+			meta.i64(2, chunk.offset)
+			meta.structField(3) // ColumnMetaData
+			meta.i32(1, physical)
+			meta.list(2, thriftI32, 2)
+			meta.varint(0) // PLAIN
+			meta.varint(3) // RLE, nominally, for the levels
+			meta.list(3, thriftBinary, 1)
+			meta.bytes(field.Name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, int64(group.rows))
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+			total += chunk.size
+		}
+		meta.i64(2, total)
+		meta.i64(3, int64(group.rows))
+		meta.end()
+	}
+	meta.str(6, "weather-agent")
+	meta.end()
+
+	if err := p.write(meta.buf); err != nil {
+		return err
+	}
+	if err := p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf)))); err != nil {
+		return err
+	}
+	return p.write([]byte("PAR1"))
+}
+
+// Thrift compact protocol type IDs
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Writer for the Thrift compact protocol, which Parquet uses for its page
+// headers and footer
+type thriftCompact struct {
+	buf  []byte
+	last []int16 // ID of the previous field in each open struct
+}
+
+// Open a struct: at the top level, as a list element, or after structField
+func (t *thriftCompact) begin() {
+	t.last = append(t.last, 0)
+}
+
+// Close the innermost struct
+func (t *thriftCompact) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// Zigzag varint, as used for all compact protocol integers
+func (t *thriftCompact) varint(n int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(n<<1^n>>63))
+}
+
+func (t *thriftCompact) bytes(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftCompact) i32(id int16, n int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(n))
+}
+
+func (t *thriftCompact) i64(id int16, n int64) {
+	t.field(id, thriftI64)
+	t.varint(n)
+}
+
+func (t *thriftCompact) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.bytes(s)
+}
+
+// Start a struct-valued field; close it with end
+func (t *thriftCompact) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// Start a list field of n elements, which the caller then writes
+func (t *thriftCompact) list(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xF0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Reader for the Thrift compact protocol, decoding structs into maps keyed
+// by field ID
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.data[r.pos:])
+	r.pos += max(size, 1)
+	return n
+}
+
+func (r *thriftReader) int() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(r.byte())
+	case 4, 5, 6:
+		return r.int()
+	case 7:
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos-8:]))
+	case 8:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.data[r.pos-n : r.pos])
+	case 9, 10:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	return nil
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for r.pos < len(r.data) {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.int())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+	return fields
+}
+
+// Decode a file written by parquetWriter into its column names and rows
+func readTestParquet(t *testing.T, data []byte) ([]string, [][]interface{}) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{data: data[len(data)-8-footer : len(data)-8]}).readStruct()
+
+	schema := meta[2].([]interface{})
+	if root := schema[0].(map[int16]interface{}); root[5] != int64(len(schema)-1) {
+		t.Fatalf("root schema element = %v", root)
+	}
+	var names []string
+	for _, element := range schema[1:] {
+		names = append(names, element.(map[int16]interface{})[4].(string))
+	}
+	numRows := int(meta[3].(int64))
+	rows := make([][]interface{}, numRows)
+	rowGroups := meta[4].([]interface{})
+	if numRows == 0 {
+		if len(rowGroups) != 0 {
+			t.Errorf("empty file has %d row groups", len(rowGroups))
+		}
+		return names, rows
+	}
+
+	var row int
+	for _, g := range rowGroups {
+		group := g.(map[int16]interface{})
+		groupRows := int(group[3].(int64))
+		for _, chunk := range group[1].([]interface{}) {
+			column := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			r := &thriftReader{data: data, pos: int(column[9].(int64))}
+			page := r.readStruct()
+			if page[1] != int64(0) || page[5].(map[int16]interface{})[1] != int64(groupRows) {
+				t.Fatalf("unexpected page header %v", page)
+			}
+			values := data[r.pos : r.pos+int(page[3].(int64))]
+			for i := 0; i < groupRows; i++ {
+				switch column[1] {
+				case int64(0): // BOOLEAN
+					rows[row+i] = append(rows[row+i], values[i/8]&(1<<(i%8)) != 0)
+				case int64(1): // INT32
+					rows[row+i] = append(rows[row+i], int(int32(binary.LittleEndian.Uint32(values))))
+					values = values[4:]
+				case int64(2): // INT64 timestamp
+					rows[row+i] = append(rows[row+i], time.UnixMilli(int64(binary.LittleEndian.Uint64(values))).UTC())
+					values = values[8:]
+				case int64(5): // DOUBLE
+					rows[row+i] = append(rows[row+i], math.Float64frombits(binary.LittleEndian.Uint64(values)))
+					values = values[8:]
+				case int64(6): // BYTE_ARRAY
+					n := int(binary.LittleEndian.Uint32(values))
+					rows[row+i] = append(rows[row+i], string(values[4:4+n]))
+					values = values[4+n:]
+				default:
+					t.Fatalf("unexpected column type %v", column[1])
+				}
+			}
+		}
+		row += groupRows
+	}
+	if row != numRows {
+		t.Errorf("row groups hold %d rows, footer says %d", row, numRows)
+	}
+	return names, rows
+}
+
+// Rows of the checked-in sample file
+func parquetSampleRows() ([]parquetField, [][]interface{}) {
+	fields := []parquetField{{"time", parquetTimestamp}, {"name", parquetString}, {"value", parquetDouble},
+		{"count", parquetInt32}, {"flag", parquetBoolean}}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var rows [][]interface{}
+	for i := 0; i < 20; i++ {
+		rows = append(rows, []interface{}{start.Add(time.Duration(i) * time.Hour), string(rune('a' + i)), float64(i) / 4, -i, i%3 == 0})
+	}
+	return fields, rows
+}
+
+// Write rows in row groups of groupRows
+func writeTestParquet(t *testing.T, fields []parquetField, rows [][]interface{}, groupRows int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	pw := newParquetWriter(&buf, fields)
+	pw.groupRows = groupRows
+	for _, row := range rows {
+		if err := pw.appendRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetWriter(t *testing.T) {
+	fields, want := parquetSampleRows()
+	for _, groupRows := range []int{parquetRowGroupRows, 8, 1} {
+		names, rows := readTestParquet(t, writeTestParquet(t, fields, want, groupRows))
+		if !reflect.DeepEqual(names, []string{"time", "name", "value", "count", "flag"}) {
+			t.Errorf("columns = %q", names)
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("%d rows per group: rows = %v\nwant %v", groupRows, rows, want)
+		}
+	}
+
+	if _, rows := readTestParquet(t, writeTestParquet(t, fields, nil, parquetRowGroupRows)); len(rows) != 0 {
+		t.Errorf("empty file has %d rows", len(rows))
+	}
+
+	var buf bytes.Buffer
+	mismatched := newParquetWriter(&buf, fields[:1])
+	mismatched.appendRow("yesterday")
+	if err := mismatched.close(); err == nil {
+		t.Error("expected an error for a string in a timestamp column")
+	}
+}
+
+// testdata/sample.parquet holds the sample rows in row groups of 8, as
+// written by parquetWriter and checked with parquet-go
+// (github.com/parquet-go/parquet-go v0.32.0), which reads back the same
+// schema and rows. The writer must keep producing it byte for byte.
+func TestParquetWriterMatchesVerifiedFile(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "sample.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, rows := parquetSampleRows()
+	if got := writeTestParquet(t, fields, rows, 8); !bytes.Equal(got, want) {
+		t.Errorf("writer output differs from testdata/sample.parquet (%d bytes, want %d)", len(got), len(want))
+	}
+}
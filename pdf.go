@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+// Minimal single-page PDF builder supporting Helvetica text and lines,
+// enough for the climate reports without a third-party dependency
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+// Encode text for a PDF string literal using WinAnsiEncoding, escaping
+// delimiters. Characters outside Latin-1 are replaced with "?".
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// Draw text with its baseline at (x, y)
+func (p *pdfPage) text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(text))
+}
+
+// Set the stroke colour (components 0-1)
+func (p *pdfPage) strokeColor(r, g, b float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f RG\n", r, g, b)
+}
+
+// Stroke a connected line through the points
+func (p *pdfPage) polyline(xs, ys []float64) {
+	if len(xs) == 0 {
+		return
+	}
+	fmt.Fprintf(&p.content, "%.2f %.2f m\n", xs[0], ys[0])
+	for i := 1; i < len(xs); i++ {
+		fmt.Fprintf(&p.content, "%.2f %.2f l\n", xs[i], ys[i])
+	}
+	p.content.WriteString("S\n")
+}
+
+// Assemble the page into a complete PDF document
+func (p *pdfPage) bytes() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pdfPageWidth, pdfPageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// Split text into lines of at most width characters on word boundaries
+func wrapText(text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Render the report as a one-page PDF with summary figures and a daily temperature chart
+func renderReportPDF(report ClimateReport) []byte {
+	var page pdfPage
+	unit := unitSymbol(report.Units)
+	y := pdfPageHeight - pdfMargin
+
+	page.text(pdfMargin, y, 18, true, fmt.Sprintf("%s, %s", report.City, report.Country))
+	y -= 22
+	page.text(pdfMargin, y, 13, false, fmt.Sprintf("%s climate summary - %s", strings.ToUpper(report.Period[:1])+report.Period[1:], report.Title()))
+	y -= 30
+
+	lines := []string{
+		fmt.Sprintf("Mean temperature: %.1f%s", report.MeanTemp, unit),
+		fmt.Sprintf("Highest: %.1f%s on %s", report.MaxTemp.Value, unit, report.MaxTemp.Time.Format("Mon 2 Jan 15:04")),
+		fmt.Sprintf("Lowest: %.1f%s on %s", report.MinTemp.Value, unit, report.MinTemp.Time.Format("Mon 2 Jan 15:04")),
+		fmt.Sprintf("Strongest wind: %.1f on %s", report.MaxWind.Value, report.MaxWind.Time.Format("Mon 2 Jan 15:04")),
+		fmt.Sprintf("Total precipitation: %.1f mm", report.PrecipTotal),
+		fmt.Sprintf("Mean humidity: %.0f%%", report.MeanHumidity),
+	}
+	if report.Anomaly != nil {
+		lines = append(lines, fmt.Sprintf("Anomaly vs %d-year normal (%.1f%s): %+.1f%s", normalYears, *report.NormalMeanTemp, unit, *report.Anomaly, unit))
+	}
+	for _, line := range lines {
+		page.text(pdfMargin, y, 11, false, line)
+		y -= 16
+	}
+
+	// Daily high/low chart
+	if len(report.Days) > 1 {
+		y -= 20
+		page.text(pdfMargin, y, 12, true, "Daily high and low")
+		y -= 10
+
+		chartWidth := pdfPageWidth - 2*pdfMargin
+		chartHeight := 160.0
+		bottom := y - chartHeight
+		lo, hi := report.MinTemp.Value, report.MaxTemp.Value
+		if hi == lo {
+			hi = lo + 1
+		}
+
+		page.strokeColor(0.6, 0.6, 0.6)
+		page.polyline([]float64{pdfMargin, pdfMargin, pdfMargin + chartWidth}, []float64{y, bottom, bottom})
+
+		xs := make([]float64, len(report.Days))
+		highs := make([]float64, len(report.Days))
+		lows := make([]float64, len(report.Days))
+		for i, day := range report.Days {
+			xs[i] = pdfMargin + float64(i)*chartWidth/float64(len(report.Days)-1)
+			highs[i] = bottom + (day.Max-lo)/(hi-lo)*chartHeight
+			lows[i] = bottom + (day.Min-lo)/(hi-lo)*chartHeight
+		}
+		page.strokeColor(0.91, 0.30, 0.24)
+		page.polyline(xs, highs)
+		page.strokeColor(0.20, 0.60, 0.86)
+		page.polyline(xs, lows)
+
+		page.text(pdfMargin, bottom-14, 9, false, fmt.Sprintf("%s to %s, %.0f%s to %.0f%s",
+			report.Days[0].Date, report.Days[len(report.Days)-1].Date, lo, unit, hi, unit))
+		y = bottom - 40
+	}
+
+	if len(report.NotableMessages) > 0 {
+		page.text(pdfMargin, y, 12, true, "Notable messages")
+		y -= 18
+		for _, message := range report.NotableMessages {
+			for _, line := range wrapText(message, 95) {
+				if y < pdfMargin {
+					break
+				}
+				page.text(pdfMargin, y, 10, false, line)
+				y -= 13
+			}
+			y -= 6
+		}
+	}
+
+	return page.bytes()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A named system-prompt preset that changes the assistant's voice
+type Persona struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Prompt      string `json:"-"` // Style instructions appended to the system prompt
+}
+
+// Personas selectable with PERSONA or ?persona=
+var personas = []Persona{
+	{
+		Name:        "meteorologist",
+		Description: "Measured broadcast meteorologist",
+		Prompt:      "Speak as a professional broadcast meteorologist: precise and measured, using correct meteorological terms (fronts, dew point, pressure, wind direction) and briefly explaining why conditions are as they are.",
+	},
+	{
+		Name:        "pirate",
+		Description: "Cheerful pirate captain",
+		Prompt:      "Speak as a cheerful pirate captain, with nautical slang (\"Ahoy\", \"me hearties\", \"batten down the hatches\"). Keep every number, time, and safety recommendation accurate.",
+	},
+	{
+		Name:        "haiku-poet",
+		Description: "Haiku poet",
+		Prompt:      "Respond with a single haiku (three lines of 5, 7, and 5 syllables) capturing the current conditions, including the temperature. If there is a safety concern such as severe weather or poor air quality, add one plain sentence after the haiku.",
+	},
+	{
+		Name:        "news-anchor",
+		Description: "Evening news anchor",
+		Prompt:      "Deliver the weather as a TV news anchor's bulletin: a punchy headline sentence followed by the key facts, authoritative and upbeat.",
+	},
+}
+
+// Normalize a persona name, e.g. "Haiku Poet" or "news_anchor"
+func normalizePersonaName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(name)
+}
+
+// Look up a persona by name
+func findPersona(name string) (Persona, bool) {
+	name = normalizePersonaName(name)
+	for _, p := range personas {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Persona{}, false
+}
+
+// Names of all personas, for error messages
+func personaNames() string {
+	names := make([]string, len(personas))
+	for i, p := range personas {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Resolve the persona for a request: the requested one if given, otherwise
+// the deployment default. An empty result means the plain assistant.
+func (agent *WeatherAgent) resolvePersona(requested string) (string, error) {
+	if requested == "" {
+		return agent.config.Persona, nil
+	}
+	p, ok := findPersona(requested)
+	if !ok {
+		return "", fmt.Errorf("unknown persona %q (available: %s)", requested, personaNames())
+	}
+	return p.Name, nil
+}
+
+// System prompt for a persona (empty for the plain assistant)
+func (agent *WeatherAgent) systemPrompt(persona string) string {
+	p, ok := findPersona(persona)
+	if !ok {
+		return agent.config.SystemPrompt
+	}
+	return agent.config.SystemPrompt + "\n\nPersona: " + p.Prompt
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolvePersona(t *testing.T) {
+	agent := &WeatherAgent{config: Config{Persona: "meteorologist"}}
+
+	tests := []struct {
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"", "meteorologist", false},
+		{"pirate", "pirate", false},
+		{"Haiku Poet", "haiku-poet", false},
+		{"news_anchor", "news-anchor", false},
+		{"clown", "", true},
+	}
+	for _, tt := range tests {
+		got, err := agent.resolvePersona(tt.requested)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolvePersona(%q) = %q, %v; want %q (error %t)", tt.requested, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSystemPromptPersona(t *testing.T) {
+	agent := &WeatherAgent{config: Config{SystemPrompt: "Base prompt."}}
+
+	if got := agent.systemPrompt(""); got != "Base prompt." {
+		t.Errorf("plain assistant prompt = %q", got)
+	}
+	pirate := agent.systemPrompt("pirate")
+	if !strings.HasPrefix(pirate, "Base prompt.") || !strings.Contains(pirate, "pirate captain") {
+		t.Errorf("pirate prompt = %q", pirate)
+	}
+}
+
+func TestLLMCacheKeyPersona(t *testing.T) {
+	agent := &WeatherAgent{config: Config{Units: "metric"}}
+	weather := statusWeather("Clear", 1, 20)
+
+	plain := agent.llmCacheKey(weather, "", agent.llmParams())
+	pirate := agent.llmCacheKey(weather, "pirate", agent.llmParams())
+	haiku := agent.llmCacheKey(weather, "haiku-poet", agent.llmParams())
+	if plain == pirate || pirate == haiku {
+		t.Errorf("personas share an LLM cache key: %q %q %q", plain, pirate, haiku)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchWeatherOffline(t *testing.T) {
+	fixtures := useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key"})
+
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatalf("fetchWeather() error: %v", err)
+	}
+	if weather.Main.Temp != 18.4 || weather.Main.Humidity != 62 || weather.Wind.Deg != 225 {
+		t.Errorf("conditions = %+v, wind %+v", weather.Main, weather.Wind)
+	}
+	if weather.Wind.Gust != 24.5 {
+		t.Errorf("wind gust = %v, want 24.5", weather.Wind.Gust)
+	}
+	if weather.Coord.Lat != 59.9127 || weather.Coord.Lon != 10.7461 {
+		t.Errorf("coordinates = %+v, want Oslo, NO", weather.Coord)
+	}
+	if !weather.HasHighLow || weather.Main.TempMax != 21.3 || weather.Main.TempMin != 11.8 {
+		t.Errorf("today's high/low = %v, %v (known %v), want 21.3, 11.8", weather.Main.TempMax, weather.Main.TempMin, weather.HasHighLow)
+	}
+	if weather.Visibility != 18320 {
+		t.Errorf("visibility = %d, want the 14:00 value 18320", weather.Visibility)
+	}
+	if weather.Timezone != 7200 || len(weather.HourlyUV) != 3 {
+		t.Errorf("timezone = %d, hourly UV = %v", weather.Timezone, weather.HourlyUV)
+	}
+	if n := len(weather.HourlyPrecipProb); n != 3 || weather.HourlyPrecipProb[2].Value != 60 {
+		t.Errorf("hourly precipitation probability = %v", weather.HourlyPrecipProb)
+	}
+	if weather.IQAirData.AQI != 42 {
+		t.Errorf("IQAir AQI = %d, want 42", weather.IQAirData.AQI)
+	}
+	if fixtures.count("api.openweathermap.org") != 0 {
+		t.Error("OpenWeatherMap AQI requested despite an IQAir key")
+	}
+
+	// The forecast is served from the cache on the next run
+	if _, err := agent.fetchWeather(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fixtures.count("api.open-meteo.com"); n != 1 {
+		t.Errorf("forecast requested %d times, want 1", n)
+	}
+}
+
+func TestFetchWeatherOpenWeatherMapAQI(t *testing.T) {
+	fixtures := useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{WeatherAPIKey: "test-key"})
+
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatalf("fetchWeather() error: %v", err)
+	}
+	if len(weather.AQI.List) != 1 || weather.AQI.List[0].Main.AQI != 2 || weather.AQI.List[0].Components.PM2_5 != 6.1 {
+		t.Errorf("AQI = %+v", weather.AQI.List)
+	}
+	if fixtures.count("api.airvisual.com") != 0 {
+		t.Error("IQAir requested without a key")
+	}
+}
+
+func TestFetchWeatherUpstreamDown(t *testing.T) {
+	handlers := defaultFixtures()
+	handlers["api.open-meteo.com"] = serveStatus(http.StatusServiceUnavailable)
+	useFixtures(t, handlers)
+	agent := newFixtureAgent(t, Config{})
+
+	if _, err := agent.fetchWeather(); err == nil {
+		t.Error("fetchWeather() with the forecast API down and nothing cached: expected error")
+	}
+}
+
+func TestGeocodingFailoverOffline(t *testing.T) {
+	handlers := defaultFixtures()
+	handlers["geocoding-api.open-meteo.com"] = serveStatus(http.StatusBadGateway)
+	fixtures := useFixtures(t, handlers)
+	agent := newFixtureAgent(t, Config{})
+
+	lat, lon, err := agent.getCoordinates("Oslo", "NO")
+	if err != nil {
+		t.Fatalf("getCoordinates() error: %v", err)
+	}
+	if lat != 59.9133 || lon != 10.7389 {
+		t.Errorf("coordinates = %.4f, %.4f, want Nominatim's", lat, lon)
+	}
+	if fixtures.count("nominatim.openstreetmap.org") != 1 {
+		t.Error("expected a Nominatim request after Open-Meteo failed")
+	}
+
+	// With every provider down the last resolved coordinates are reused
+	handlers["nominatim.openstreetmap.org"] = serveStatus(http.StatusBadGateway)
+	lat, lon, err = agent.getCoordinates("Oslo", "NO")
+	if err != nil || lat != 59.9133 || lon != 10.7389 {
+		t.Errorf("getCoordinates() with providers down = %.4f, %.4f, %v", lat, lon, err)
+	}
+}
+
+func TestGenerateLLMMessageOffline(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key"})
+	llm := &fakeLLM{reply: "Mild with some cloud."}
+	agent.llm = llm
+
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := agent.generateLLMMessage(weather, "", "", agent.llmParams())
+	if err != nil {
+		t.Fatalf("generateLLMMessage() error: %v", err)
+	}
+	if message != "Mild with some cloud." {
+		t.Errorf("message = %q", message)
+	}
+	if len(llm.prompts) != 1 {
+		t.Fatalf("LLM called %d times, want 1", len(llm.prompts))
+	}
+	for _, want := range []string{"Oslo", "18.4", "2:00 PM", "today_high: 21.3°C", "today_low: 11.8°C"} {
+		if !strings.Contains(llm.prompts[0], want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+	if totals := agent.usageTotals(usageDate(time.Now())); totals.Requests != 1 {
+		t.Errorf("usage = %+v, want 1 request", totals)
+	}
+}
+
+func TestLLMProvidersOffline(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+
+	for _, provider := range []string{"anthropic", "openai"} {
+		agent := newFixtureAgent(t, Config{LLMProvider: provider, LLMAPIKey: "test-key"})
+		message, err := agent.callLLM("How is the weather?")
+		if err != nil {
+			t.Errorf("%s: callLLM() error: %v", provider, err)
+			continue
+		}
+		if message != "Partly cloudy and mild in Oslo." {
+			t.Errorf("%s: message = %q", provider, message)
+		}
+		if totals := agent.usageTotals(usageDate(time.Now())); totals.TotalTokens != 132 {
+			t.Errorf("%s: usage = %+v, want 132 tokens", provider, totals)
+		}
+	}
+
+	agent := newFixtureAgent(t, Config{LLMProvider: "carrier-pigeon"})
+	if _, err := agent.callLLM("How is the weather?"); err == nil {
+		t.Error("unsupported provider: expected error")
+	}
+}
+
+// Concurrent /api/weather requests share the history, last messages and
+// location; run with -race
+func TestConcurrentWeatherUpdates(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{IQAirAPIKey: "test-key"})
+	agent.llm = &fakeLLM{reply: "Mild with some cloud."}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fetch := agent.fetchWeather
+			if i%2 == 1 {
+				fetch = func() (WeatherResponse, error) { return agent.fetchWeatherByCoordinates(59.91, 10.75) }
+			}
+			weather, err := fetch()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			agent.recordWeather(weather)
+			message, err := agent.cachedLLMMessage(weather, agent.generateHistoryContext(weather), "", agent.llmParams())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			agent.setLastMessage(weatherLocationKey(weather), message)
+			if i == 3 {
+				agent.setLocation("Oslo", "NO")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, ok := agent.weatherHistory.previous(locationKey("Oslo", "NO")); !ok {
+		t.Error("expected several readings recorded for Oslo, NO")
+	}
+	if last := agent.lastMessage(locationKey("Oslo", "NO")); last.Message != "Mild with some cloud." {
+		t.Errorf("last message = %q", last.Message)
+	}
+}
+
+func TestPrepareWeatherDataHighLow(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+
+	var weather WeatherResponse
+	weather.Name = "Oslo"
+	weather.Main.TempMax, weather.Main.TempMin = 0, -4.5
+	if data := agent.prepareWeatherData(weather); data["today_high"] != nil {
+		t.Errorf("today_high = %v without a forecast range", data["today_high"])
+	}
+
+	weather.HasHighLow = true
+	data := agent.prepareWeatherData(weather)
+	if data["today_high"] != "0.0°C" || data["today_low"] != "-4.5°C" {
+		t.Errorf("today_high, today_low = %v, %v, want 0.0°C, -4.5°C", data["today_high"], data["today_low"])
+	}
+}
+
+func TestCurrentHourValue(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	times := []string{"2024-06-15T13:00", "2024-06-15T14:00", "2024-06-15T15:00"}
+	values := []*float64{value(24140), value(820), nil}
+
+	tests := []struct {
+		current string
+		want    float64
+		ok      bool
+	}{
+		{"2024-06-15T14:00", 820, true},
+		{"2024-06-15T14:45", 820, true},
+		{"2024-06-15T15:15", 0, false}, // Null
+		{"2024-06-15T16:00", 0, false}, // Outside the series
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := currentHourValue(times, values, tt.current)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("currentHourValue(%q) = %v, %v, want %v, %v", tt.current, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPrepareWeatherDataVisibility(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+
+	var weather WeatherResponse
+	weather.Visibility = 800
+	if got := agent.prepareWeatherData(weather)["visibility"].(string); strings.Contains(got, "+") {
+		t.Errorf("reported visibility = %q, should be shown as measured", got)
+	}
+
+	weather.Visibility = 0
+	if got := agent.prepareWeatherData(weather)["visibility"].(string); !strings.Contains(got, "+") {
+		t.Errorf("unreported visibility = %q, want the assumed default", got)
+	}
+}
+
+func TestPrecipitationOutlook(t *testing.T) {
+	loc := time.FixedZone("CEST", 7200)
+	now := time.Date(2024, 6, 15, 14, 20, 0, 0, loc)
+	hourly := func(values ...float64) []HourlyValue {
+		series := make([]HourlyValue, len(values))
+		for i, v := range values {
+			series[i] = HourlyValue{Time: time.Date(2024, 6, 15, 13+i, 0, 0, 0, loc).Unix(), Value: v}
+		}
+		return series
+	}
+
+	tests := []struct {
+		name   string
+		series []HourlyValue
+		want   string
+	}{
+		{"rain later", hourly(90, 10, 30, 60, 60, 20), "60% chance of precipitation by 4 PM"},
+		{"dry", hourly(0, 5, 0, 0, 0, 0, 0, 0, 0, 0), "under 10% chance of precipitation through 7 PM"},
+		{"window past the series", hourly(0, 20), "20% chance of precipitation by 2 PM"},
+		{"no hours left", hourly(50), ""},
+		{"no series", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := precipitationOutlook(tt.series, now); got != tt.want {
+			t.Errorf("%s: precipitationOutlook() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareWeatherDataPrecipitationChance(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+
+	var weather WeatherResponse
+	weather.Timezone = 7200
+	weather.Dt = time.Date(2024, 6, 15, 12, 5, 0, 0, time.UTC).Unix()
+	if _, ok := agent.prepareWeatherData(weather)["precipitation_chance"]; ok {
+		t.Error("precipitation_chance set without an hourly forecast")
+	}
+
+	weather.HourlyPrecipProb = []HourlyValue{{Time: weather.Dt + 3300, Value: 40}}
+	if got := agent.prepareWeatherData(weather)["precipitation_chance"]; got != "40% chance of precipitation by 3 PM" {
+		t.Errorf("precipitation_chance = %v", got)
+	}
+}
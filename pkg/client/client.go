@@ -0,0 +1,393 @@
+// Package client is a typed Go client for the weather agent HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotSupported is returned when the server does not expose an endpoint
+var ErrNotSupported = errors.New("endpoint not supported by this weather agent")
+
+// APIError is returned for non-2xx responses from the agent
+type APIError struct {
+	StatusCode int
+	Code       string // Machine-readable code, e.g. "rate_limited"
+	Message    string
+	RetryAfter time.Duration // Set for 429 responses
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("weather agent API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Client talks to a weather agent instance
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey sets the key sent as a bearer token on every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient overrides the underlying HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New creates a client for the agent at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second}, // LLM generation can be slow
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Location selects weather by coordinates instead of the agent's configured city
+type Location struct {
+	Lat float64
+	Lon float64
+}
+
+// WeatherUpdate is a generated message together with the underlying weather data
+type WeatherUpdate struct {
+	MessageID string                 `json:"message_id"`
+	City      string                 `json:"city"`
+	Country   string                 `json:"country"`
+	Message   string                 `json:"message"`
+	Timestamp string                 `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+	JobID     string                 `json:"job_id,omitempty"` // Set while the message generates in the background
+}
+
+// Message job statuses
+const (
+	JobPending   = "pending"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// How often GetWeather polls a message generating in the background
+var jobPollInterval = time.Second
+
+// Job is a weather message the agent generates in the background
+type Job struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at"`
+	Result     *WeatherUpdate `json:"result"` // Once completed
+	Error      string         `json:"error"`  // Once failed
+}
+
+// ForecastDay is a single day of the daily forecast
+type ForecastDay struct {
+	Date                     string  `json:"date"`
+	TempMax                  float64 `json:"temp_max"`
+	TempMin                  float64 `json:"temp_min"`
+	WeatherCode              int     `json:"weather_code"`
+	Condition                string  `json:"condition"`
+	Description              string  `json:"description"`
+	PrecipitationProbability int     `json:"precipitation_probability"`
+	Sunrise                  string  `json:"sunrise"`
+	Sunset                   string  `json:"sunset"`
+}
+
+// Forecast is the daily forecast for a location
+type Forecast struct {
+	City     string        `json:"city"`
+	Country  string        `json:"country"`
+	Units    string        `json:"units"`
+	Timezone int           `json:"timezone"` // Timezone offset in seconds
+	Days     []ForecastDay `json:"days"`
+}
+
+// ChatResponse is the agent's reply to a free-form question
+type ChatResponse struct {
+	Reply string `json:"reply"`
+}
+
+// GetWeather fetches the current weather and a freshly generated message.
+// A nil location uses the agent's configured city. A message the agent
+// generates in the background is polled for until it's ready or ctx is done.
+func (c *Client) GetWeather(ctx context.Context, loc *Location) (*WeatherUpdate, error) {
+	query := url.Values{}
+	addLocation(query, loc)
+
+	var update WeatherUpdate
+	if err := c.do(ctx, http.MethodGet, "/api/v1/weather", query, nil, &update); err != nil {
+		return nil, err
+	}
+	if update.JobID == "" {
+		return &update, nil
+	}
+	return c.waitForJob(ctx, update.JobID)
+}
+
+// GetJob fetches the status of a message generating in the background, with
+// the weather update once it completes
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(id), nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Poll a message job until it finishes
+func (c *Client) waitForJob(ctx context.Context, id string) (*WeatherUpdate, error) {
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case JobCompleted:
+			if job.Result == nil {
+				return nil, fmt.Errorf("job %s completed without a weather update", id)
+			}
+			return job.Result, nil
+		case JobFailed:
+			return nil, fmt.Errorf("job %s failed: %s", id, job.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// GetForecast fetches the daily forecast for the given number of days
+func (c *Client) GetForecast(ctx context.Context, loc *Location, days int) (*Forecast, error) {
+	query := url.Values{}
+	addLocation(query, loc)
+	if days > 0 {
+		query.Set("days", strconv.Itoa(days))
+	}
+
+	var forecast Forecast
+	if err := c.do(ctx, http.MethodGet, "/api/v1/forecast", query, nil, &forecast); err != nil {
+		return nil, err
+	}
+	return &forecast, nil
+}
+
+// Chat asks the agent a free-form question about the weather
+func (c *Client) Chat(ctx context.Context, loc *Location, message string) (*ChatResponse, error) {
+	query := url.Values{}
+	addLocation(query, loc)
+
+	body := map[string]string{"message": message}
+	var reply ChatResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/chat", query, body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Delivery is a receipt recording when and where a message was delivered
+type Delivery struct {
+	MessageID string    `json:"message_id"`
+	Channel   string    `json:"channel"`
+	Target    string    `json:"target"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error"`
+	City      string    `json:"city"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// GetDeliveries lists recent delivery receipts, newest first.
+// An empty channel returns receipts for all channels.
+func (c *Client) GetDeliveries(ctx context.Context, channel string, limit int) ([]Delivery, error) {
+	query := url.Values{}
+	if channel != "" {
+		query.Set("channel", channel)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		Deliveries []Delivery `json:"deliveries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/deliveries", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Deliveries, nil
+}
+
+// StreamUpdates subscribes to server-sent weather updates and calls fn for each one.
+// It blocks until the context is cancelled, the stream ends, or fn returns an error.
+func (c *Client) StreamUpdates(ctx context.Context, loc *Location, fn func(WeatherUpdate) error) error {
+	query := url.Values{}
+	addLocation(query, loc)
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/v1/stream", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Streams are long-lived, so don't apply the client's overall timeout
+	streamClient := *c.httpClient
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	// Parse the SSE stream, dispatching each event's data payload
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var update WeatherUpdate
+			if err := json.Unmarshal(data.Bytes(), &update); err != nil {
+				return fmt.Errorf("failed to decode stream event: %v", err)
+			}
+			data.Reset()
+			if err := fn(update); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Add coordinates to the query string if a location was given
+func addLocation(query url.Values, loc *Location) {
+	if loc == nil {
+		return
+	}
+	query.Set("lat", strconv.FormatFloat(loc.Lat, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(loc.Lon, 'f', -1, 64))
+}
+
+// Build a request with authentication and an optional JSON body
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return req, nil
+}
+
+// Perform a request and decode the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// Convert error responses into ErrNotSupported or an *APIError
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotSupported
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+	}
+	var structured struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error.Message != "" {
+		apiErr.Code, apiErr.Message = structured.Error.Code, structured.Error.Message
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
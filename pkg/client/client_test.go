@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetWeather(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/weather" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		if r.URL.Query().Get("lat") != "51.5" || r.URL.Query().Get("lon") != "-0.12" {
+			t.Errorf("unexpected coordinates %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"city":    "London",
+			"country": "GB",
+			"message": "Drizzly but mild.",
+			"data":    map[string]interface{}{"temperature": "12.0°C"},
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", WithAPIKey("secret"))
+	update, err := c.GetWeather(context.Background(), &Location{Lat: 51.5, Lon: -0.12})
+	if err != nil {
+		t.Fatalf("GetWeather failed: %v", err)
+	}
+	if update.City != "London" || update.Message != "Drizzly but mild." {
+		t.Errorf("unexpected update: %+v", update)
+	}
+	if update.Data["temperature"] != "12.0°C" {
+		t.Errorf("unexpected data: %v", update.Data)
+	}
+}
+
+func TestChatAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/chat":
+			var req struct {
+				Message string `json:"message"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string]string{"reply": "You asked: " + req.Message})
+		case "/api/v1/forecast":
+			w.Header().Set("Retry-After", "30")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":"rate_limited","message":"Rate limit exceeded"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+
+	reply, err := c.Chat(context.Background(), nil, "umbrella?")
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if reply.Reply != "You asked: umbrella?" {
+		t.Errorf("unexpected reply %q", reply.Reply)
+	}
+
+	_, err = c.GetForecast(context.Background(), nil, 3)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 30*time.Second ||
+		apiErr.Code != "rate_limited" || apiErr.Message != "Rate limit exceeded" {
+		t.Errorf("unexpected API error: %+v", apiErr)
+	}
+
+	err = c.StreamUpdates(context.Background(), nil, func(WeatherUpdate) error { return nil })
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestStreamUpdates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "data: {\"city\":\"Paris\",\"message\":\"update %d\"}\n\n", i)
+		}
+	}))
+	defer server.Close()
+
+	var messages []string
+	stop := errors.New("stop")
+	err := New(server.URL).StreamUpdates(context.Background(), nil, func(u WeatherUpdate) error {
+		messages = append(messages, u.Message)
+		if len(messages) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	if len(messages) != 2 || messages[1] != "update 2" {
+		t.Errorf("unexpected messages %v", messages)
+	}
+}
+
+func TestGetWeatherPollsJob(t *testing.T) {
+	original := jobPollInterval
+	jobPollInterval = time.Millisecond
+	defer func() { jobPollInterval = original }()
+
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/weather":
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{"city": "London", "message": "Yesterday's message.", "job_id": "j1"})
+		case "/api/v1/jobs/j1":
+			polls++
+			if polls < 3 {
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": "j1", "status": JobPending})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "j1", "status": JobCompleted,
+				"result": map[string]interface{}{"city": "London", "message": "Drizzly but mild."}})
+		case "/api/v1/jobs/j2":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "j2", "status": JobFailed, "error": "unable to generate the weather update"})
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	update, err := c.GetWeather(context.Background(), nil)
+	if err != nil || update.Message != "Drizzly but mild." || polls != 3 {
+		t.Fatalf("GetWeather = %+v, %v after %d polls", update, err, polls)
+	}
+	if _, err := c.waitForJob(context.Background(), "j2"); err == nil {
+		t.Error("expected an error for a failed job")
+	}
+}
@@ -0,0 +1,229 @@
+// Package units provides typed temperature, speed and distance values with
+// conversions between the metric and imperial systems used by the weather agent.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// System is a unit system, as configured with WEATHER_UNITS
+type System string
+
+const (
+	Metric   System = "metric"
+	Imperial System = "imperial"
+)
+
+// ParseSystem maps a configuration value to a System, defaulting to metric
+func ParseSystem(value string) System {
+	if strings.EqualFold(strings.TrimSpace(value), string(Imperial)) {
+		return Imperial
+	}
+	return Metric
+}
+
+// TemperatureSymbol is the temperature unit label for the system ("°C" or "°F")
+func (s System) TemperatureSymbol() string {
+	if s == Imperial {
+		return "°F"
+	}
+	return "°C"
+}
+
+// SpeedUnit is the wind speed unit label for the system ("km/h" or "mph")
+func (s System) SpeedUnit() string {
+	if s == Imperial {
+		return "mph"
+	}
+	return "km/h"
+}
+
+// OpenMeteoTemperatureUnit is the temperature_unit request parameter for the system
+func (s System) OpenMeteoTemperatureUnit() string {
+	if s == Imperial {
+		return "fahrenheit"
+	}
+	return "celsius"
+}
+
+// OpenMeteoWindSpeedUnit is the wind_speed_unit request parameter for the system
+func (s System) OpenMeteoWindSpeedUnit() string {
+	if s == Imperial {
+		return "mph"
+	}
+	return "kmh"
+}
+
+// Temperature is a temperature, stored in degrees Celsius
+type Temperature float64
+
+// Celsius creates a Temperature from degrees Celsius
+func Celsius(c float64) Temperature { return Temperature(c) }
+
+// Fahrenheit creates a Temperature from degrees Fahrenheit
+func Fahrenheit(f float64) Temperature { return Temperature((f - 32) * 5 / 9) }
+
+// TemperatureIn creates a Temperature from a value in the system's unit
+func TemperatureIn(value float64, s System) Temperature {
+	if s == Imperial {
+		return Fahrenheit(value)
+	}
+	return Celsius(value)
+}
+
+// Celsius returns the temperature in degrees Celsius
+func (t Temperature) Celsius() float64 { return float64(t) }
+
+// Fahrenheit returns the temperature in degrees Fahrenheit
+func (t Temperature) Fahrenheit() float64 { return float64(t)*9/5 + 32 }
+
+// In returns the temperature in the system's unit
+func (t Temperature) In(s System) float64 {
+	if s == Imperial {
+		return t.Fahrenheit()
+	}
+	return t.Celsius()
+}
+
+// Format renders the temperature with one decimal and the unit symbol, e.g. "21.5°C"
+func (t Temperature) Format(s System) string {
+	return fmt.Sprintf("%.1f%s", t.In(s), s.TemperatureSymbol())
+}
+
+// Speed is a speed, stored in metres per second
+type Speed float64
+
+// MetersPerSecond creates a Speed from m/s
+func MetersPerSecond(v float64) Speed { return Speed(v) }
+
+// KilometersPerHour creates a Speed from km/h
+func KilometersPerHour(v float64) Speed { return Speed(v / 3.6) }
+
+// MilesPerHour creates a Speed from mph
+func MilesPerHour(v float64) Speed { return Speed(v * 0.44704) }
+
+// SpeedIn creates a Speed from a value in the system's unit (km/h or mph)
+func SpeedIn(value float64, s System) Speed {
+	if s == Imperial {
+		return MilesPerHour(value)
+	}
+	return KilometersPerHour(value)
+}
+
+// MetersPerSecond returns the speed in m/s
+func (v Speed) MetersPerSecond() float64 { return float64(v) }
+
+// KilometersPerHour returns the speed in km/h
+func (v Speed) KilometersPerHour() float64 { return float64(v) * 3.6 }
+
+// MilesPerHour returns the speed in mph
+func (v Speed) MilesPerHour() float64 { return float64(v) / 0.44704 }
+
+// In returns the speed in the system's unit
+func (v Speed) In(s System) float64 {
+	if s == Imperial {
+		return v.MilesPerHour()
+	}
+	return v.KilometersPerHour()
+}
+
+// Format renders the speed with one decimal and the unit, e.g. "12.0 km/h"
+func (v Speed) Format(s System) string {
+	return fmt.Sprintf("%.1f %s", v.In(s), s.SpeedUnit())
+}
+
+// Lower bounds of Beaufort forces 1-12 in m/s
+var beaufortScale = []float64{0.5, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+// Beaufort returns the Beaufort force, 0 (calm) to 12 (hurricane force)
+func (v Speed) Beaufort() int {
+	force := 0
+	for force < len(beaufortScale) && float64(v) >= beaufortScale[force] {
+		force++
+	}
+	return force
+}
+
+// Distance is a distance, stored in metres
+type Distance float64
+
+// Meters creates a Distance from metres
+func Meters(m float64) Distance { return Distance(m) }
+
+// Miles creates a Distance from statute miles
+func Miles(mi float64) Distance { return Distance(mi * 1609.344) }
+
+// Kilometers returns the distance in kilometres
+func (d Distance) Kilometers() float64 { return float64(d) / 1000 }
+
+// Miles returns the distance in statute miles
+func (d Distance) Miles() float64 { return float64(d) / 1609.344 }
+
+// In returns the distance in the system's unit (km or miles)
+func (d Distance) In(s System) float64 {
+	if s == Imperial {
+		return d.Miles()
+	}
+	return d.Kilometers()
+}
+
+// Format renders the distance with one decimal, e.g. "10.0 km" or "6.2 miles"
+func (d Distance) Format(s System) string {
+	if s == Imperial {
+		return fmt.Sprintf("%.1f miles", d.Miles())
+	}
+	return fmt.Sprintf("%.1f km", d.Kilometers())
+}
+
+// HeatIndex computes the NWS heat index (Rothfusz regression) for the
+// temperature and relative humidity (%). ok is false outside the range the
+// regression applies to (80°F and 40% humidity or below).
+func HeatIndex(t Temperature, humidity float64) (Temperature, bool) {
+	f := t.Fahrenheit()
+	if f <= 80 || humidity <= 40 {
+		return t, false
+	}
+	rh := humidity
+	hi := -42.379 + 2.04901523*f + 10.14333127*rh -
+		0.22475541*f*rh - 0.00683783*f*f -
+		0.05481717*rh*rh +
+		0.00122874*f*f*rh +
+		0.00085282*f*rh*rh -
+		0.00000199*f*f*rh*rh
+	return Fahrenheit(hi), true
+}
+
+// DewPoint computes the dew point for the temperature and relative humidity (%)
+// using the Magnus formula
+func DewPoint(t Temperature, humidity float64) Temperature {
+	const a, b = 17.62, 243.12
+	if humidity <= 0 {
+		humidity = 0.01
+	}
+	gamma := math.Log(humidity/100) + a*t.Celsius()/(b+t.Celsius())
+	return Celsius(b * gamma / (a - gamma))
+}
+
+// WindChill computes the NWS wind chill for the temperature and wind speed.
+// ok is false outside the range the formula applies to (above 50°F or wind
+// of 3 mph or less).
+func WindChill(t Temperature, wind Speed) (Temperature, bool) {
+	f, mph := t.Fahrenheit(), wind.MilesPerHour()
+	if f > 50 || mph <= 3 {
+		return t, false
+	}
+	v := math.Pow(mph, 0.16)
+	return Fahrenheit(35.74 + 0.6215*f - 35.75*v + 0.4275*f*v), true
+}
+
+// Humidex computes the Canadian humidex for the temperature and dew point.
+// ok is false below 20°C, where humidex is not reported.
+func Humidex(t, dewPoint Temperature) (Temperature, bool) {
+	if t.Celsius() < 20 {
+		return t, false
+	}
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/(273.15+dewPoint.Celsius())))
+	return Celsius(t.Celsius() + 0.5555*(e-10)), true
+}
@@ -0,0 +1,151 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestTemperatureConversions(t *testing.T) {
+	tests := []struct {
+		temp       Temperature
+		celsius    float64
+		fahrenheit float64
+	}{
+		{Celsius(0), 0, 32},
+		{Celsius(100), 100, 212},
+		{Fahrenheit(-40), -40, -40},
+		{TemperatureIn(98.6, Imperial), 37, 98.6},
+		{TemperatureIn(21.5, Metric), 21.5, 70.7},
+	}
+	for _, tt := range tests {
+		if !approx(tt.temp.Celsius(), tt.celsius) || !approx(tt.temp.Fahrenheit(), tt.fahrenheit) {
+			t.Errorf("got %.2f°C / %.2f°F, want %.2f°C / %.2f°F", tt.temp.Celsius(), tt.temp.Fahrenheit(), tt.celsius, tt.fahrenheit)
+		}
+	}
+
+	if got := Celsius(21.46).Format(Metric); got != "21.5°C" {
+		t.Errorf("Format(Metric) = %q", got)
+	}
+	if got := Celsius(0).Format(Imperial); got != "32.0°F" {
+		t.Errorf("Format(Imperial) = %q", got)
+	}
+}
+
+func TestSpeedConversions(t *testing.T) {
+	v := KilometersPerHour(36)
+	if !approx(v.MetersPerSecond(), 10) || !approx(v.MilesPerHour(), 22.37) {
+		t.Errorf("36 km/h = %.2f m/s, %.2f mph", v.MetersPerSecond(), v.MilesPerHour())
+	}
+	if got := SpeedIn(10, Metric).Format(Metric); got != "10.0 km/h" {
+		t.Errorf("metric wind should be labelled km/h, got %q", got)
+	}
+	if got := SpeedIn(10, Imperial).Format(Imperial); got != "10.0 mph" {
+		t.Errorf("imperial wind should be labelled mph, got %q", got)
+	}
+	if !approx(MilesPerHour(60).KilometersPerHour(), 96.56) {
+		t.Errorf("60 mph = %.2f km/h", MilesPerHour(60).KilometersPerHour())
+	}
+}
+
+func TestBeaufort(t *testing.T) {
+	tests := []struct {
+		speed Speed
+		want  int
+	}{
+		{MetersPerSecond(0), 0},
+		{MetersPerSecond(0.49), 0},
+		{MetersPerSecond(0.5), 1},
+		{MetersPerSecond(3.39), 2},
+		{MetersPerSecond(3.4), 3},
+		{MetersPerSecond(10.8), 6},
+		{KilometersPerHour(61), 7},
+		{MilesPerHour(73), 11},
+		{MilesPerHour(74), 12},
+		{MetersPerSecond(-1), 0},
+	}
+	for _, tt := range tests {
+		if got := tt.speed.Beaufort(); got != tt.want {
+			t.Errorf("%.2f m/s: Beaufort %d, want %d", float64(tt.speed), got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	d := Meters(10000)
+	if d.Format(Metric) != "10.0 km" || d.Format(Imperial) != "6.2 miles" {
+		t.Errorf("got %q / %q", d.Format(Metric), d.Format(Imperial))
+	}
+	if !approx(Miles(1).Kilometers(), 1.609) {
+		t.Errorf("1 mile = %.3f km", Miles(1).Kilometers())
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	// NWS table: 90°F at 60% humidity has a heat index of about 100°F
+	hi, ok := HeatIndex(Fahrenheit(90), 60)
+	if !ok || math.Abs(hi.Fahrenheit()-100) > 1 {
+		t.Errorf("HeatIndex(90°F, 60%%) = %.1f°F, %v", hi.Fahrenheit(), ok)
+	}
+
+	// Same result whichever unit the input came from
+	hiMetric, _ := HeatIndex(TemperatureIn(32.22, Metric), 60)
+	if math.Abs(hiMetric.Celsius()-hi.Celsius()) > 0.1 {
+		t.Errorf("metric input gave %.2f°C, imperial %.2f°C", hiMetric.Celsius(), hi.Celsius())
+	}
+
+	if _, ok := HeatIndex(Celsius(20), 80); ok {
+		t.Error("heat index should not apply at 20°C")
+	}
+	if _, ok := HeatIndex(Fahrenheit(95), 30); ok {
+		t.Error("heat index should not apply at 30% humidity")
+	}
+}
+
+func TestDewPoint(t *testing.T) {
+	// 25°C at 60% humidity has a dew point of about 16.7°C
+	if dp := DewPoint(Celsius(25), 60); math.Abs(dp.Celsius()-16.7) > 0.2 {
+		t.Errorf("DewPoint(25°C, 60%%) = %.2f°C", dp.Celsius())
+	}
+	// Saturated air is at its dew point
+	if dp := DewPoint(Celsius(10), 100); math.Abs(dp.Celsius()-10) > 0.01 {
+		t.Errorf("DewPoint(10°C, 100%%) = %.2f°C", dp.Celsius())
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	// NWS table: 0°F with a 15 mph wind feels like -19°F
+	wc, ok := WindChill(Fahrenheit(0), MilesPerHour(15))
+	if !ok || math.Abs(wc.Fahrenheit()+19) > 0.5 {
+		t.Errorf("WindChill(0°F, 15 mph) = %.1f°F, %v", wc.Fahrenheit(), ok)
+	}
+	if _, ok := WindChill(Celsius(15), KilometersPerHour(30)); ok {
+		t.Error("wind chill should not apply at 15°C")
+	}
+	if _, ok := WindChill(Celsius(-5), KilometersPerHour(3)); ok {
+		t.Error("wind chill should not apply in near-calm air")
+	}
+}
+
+func TestHumidex(t *testing.T) {
+	// Environment Canada table: 30°C with a 20°C dew point gives a humidex of about 37
+	hx, ok := Humidex(Celsius(30), Celsius(20))
+	if !ok || math.Abs(hx.Celsius()-37.2) > 0.5 {
+		t.Errorf("Humidex(30°C, 20°C) = %.1f, %v", hx.Celsius(), ok)
+	}
+	if _, ok := Humidex(Celsius(15), Celsius(10)); ok {
+		t.Error("humidex should not apply at 15°C")
+	}
+}
+
+func TestParseSystem(t *testing.T) {
+	if ParseSystem("Imperial") != Imperial || ParseSystem("metric") != Metric || ParseSystem("") != Metric {
+		t.Error("unexpected ParseSystem result")
+	}
+	if Imperial.OpenMeteoWindSpeedUnit() != "mph" || Metric.OpenMeteoWindSpeedUnit() != "kmh" {
+		t.Error("unexpected Open-Meteo wind unit")
+	}
+}
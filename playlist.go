@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Mood tag and optional link suggested for the current weather
+type PlaylistSuggestion struct {
+	Mood string `json:"mood"`
+	Link string `json:"link,omitempty"`
+}
+
+// Maps a condition and/or part of the day to a mood tag. "*" matches anything.
+type playlistRule struct {
+	Condition string // e.g. "rain", "clear"
+	PartOfDay string // "morning", "afternoon", "evening", "night"
+	Mood      string
+}
+
+// Built-in mapping, consulted after any configured rules
+var defaultPlaylistRules = []playlistRule{
+	{"clear", "morning", "sunny-morning-acoustic"},
+	{"clear", "afternoon", "summer-pop"},
+	{"clear", "evening", "golden-hour"},
+	{"clear", "night", "starry-night-ambient"},
+	{"clouds", "*", "mellow-indie"},
+	{"fog", "*", "dreamy-ambient"},
+	{"drizzle", "*", "rainy-day-jazz"},
+	{"rain", "night", "late-night-lofi"},
+	{"rain", "*", "rainy-day-jazz"},
+	{"snow", "*", "cozy-winter-folk"},
+	{"thunderstorm", "*", "stormy-rock"},
+	{"*", "night", "late-night-lofi"},
+	{"*", "*", "easy-listening"},
+}
+
+// Normalize a weather condition for playlist matching, e.g. "Mainly Clear" -> "clear"
+func playlistCondition(condition string) string {
+	condition = strings.ToLower(strings.TrimSpace(condition))
+	if condition == "mainly clear" {
+		return "clear"
+	}
+	return condition
+}
+
+// Parse rules like "rain=rainy-day-jazz" or "clear/evening=golden-hour"
+func parsePlaylistRules(exprs []string) ([]playlistRule, error) {
+	var rules []playlistRule
+	var errs []string
+	for _, expr := range exprs {
+		match, mood, ok := strings.Cut(expr, "=")
+		mood = strings.TrimSpace(mood)
+		if !ok || mood == "" {
+			errs = append(errs, fmt.Sprintf("%q: expected condition[/part_of_day]=mood", expr))
+			continue
+		}
+
+		condition, part, hasPart := strings.Cut(match, "/")
+		rule := playlistRule{Condition: playlistCondition(condition), PartOfDay: "*", Mood: mood}
+		if hasPart {
+			rule.PartOfDay = strings.ToLower(strings.TrimSpace(part))
+		}
+		switch rule.PartOfDay {
+		case "morning", "afternoon", "evening", "night", "*":
+		default:
+			errs = append(errs, fmt.Sprintf("%q: unknown part of day %q", expr, part))
+			continue
+		}
+		if rule.Condition == "" {
+			rule.Condition = "*"
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return rules, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return rules, nil
+}
+
+// First rule matching the condition and part of day, configured rules first
+func playlistMood(rules []playlistRule, condition, part string) string {
+	for _, set := range [][]playlistRule{rules, defaultPlaylistRules} {
+		for _, rule := range set {
+			if (rule.Condition == "*" || rule.Condition == condition) && (rule.PartOfDay == "*" || rule.PartOfDay == part) {
+				return rule.Mood
+			}
+		}
+	}
+	return ""
+}
+
+// Playlist suggestion for a reading, linking through the template if one is
+// configured ("{mood}" and "{condition}" are substituted)
+func (agent *WeatherAgent) playlistSuggestion(weather WeatherResponse) PlaylistSuggestion {
+	condition := "*"
+	if len(weather.Weather) > 0 {
+		condition = playlistCondition(weather.Weather[0].Main)
+	}
+	localTime := time.Unix(weather.Dt, 0).In(time.FixedZone("Local", weather.Timezone))
+
+	suggestion := PlaylistSuggestion{Mood: playlistMood(agent.playlistRules, condition, partOfDay(localTime.Hour()))}
+	if template := agent.config.PlaylistLinkTemplate; template != "" {
+		suggestion.Link = strings.NewReplacer(
+			"{mood}", url.PathEscape(suggestion.Mood),
+			"{condition}", url.PathEscape(condition),
+		).Replace(template)
+	}
+	return suggestion
+}
+
+// Add the playlist suggestion to a response's weather data when enabled
+func (agent *WeatherAgent) addPlaylist(weather WeatherResponse, data map[string]interface{}) {
+	if agent.config.PlaylistSuggestions {
+		data["playlist"] = agent.playlistSuggestion(weather)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePlaylistRules(t *testing.T) {
+	rules, err := parsePlaylistRules([]string{"rain=rainy-day-jazz", "Clear/Evening=golden-hour", "*/night=lofi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []playlistRule{
+		{"rain", "*", "rainy-day-jazz"},
+		{"clear", "evening", "golden-hour"},
+		{"*", "night", "lofi"},
+	}
+	for i, rule := range rules {
+		if rule != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rule, want[i])
+		}
+	}
+
+	for _, bad := range []string{"rain", "rain=", "clear/brunch=jazz"} {
+		if _, err := parsePlaylistRules([]string{bad}); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestPlaylistMood(t *testing.T) {
+	custom := []playlistRule{{"rain", "*", "my-rain-mix"}}
+
+	tests := []struct {
+		rules     []playlistRule
+		condition string
+		part      string
+		want      string
+	}{
+		{nil, "clear", "evening", "golden-hour"},
+		{nil, "rain", "night", "late-night-lofi"},
+		{nil, "rain", "morning", "rainy-day-jazz"},
+		{nil, "hail", "night", "late-night-lofi"},
+		{nil, "hail", "morning", "easy-listening"},
+		{custom, "rain", "night", "my-rain-mix"},
+		{custom, "snow", "morning", "cozy-winter-folk"},
+	}
+	for _, tt := range tests {
+		if got := playlistMood(tt.rules, tt.condition, tt.part); got != tt.want {
+			t.Errorf("playlistMood(%s, %s) = %q, want %q", tt.condition, tt.part, got, tt.want)
+		}
+	}
+}
+
+func TestAddPlaylist(t *testing.T) {
+	weather := statusWeather("Mainly Clear", 1, 20)
+	weather.Dt = time.Date(2024, 6, 1, 19, 30, 0, 0, time.UTC).Unix()
+
+	agent := &WeatherAgent{}
+	data := map[string]interface{}{}
+	agent.addPlaylist(weather, data)
+	if _, ok := data["playlist"]; ok {
+		t.Error("playlist added while suggestions are disabled")
+	}
+
+	agent.config = Config{PlaylistSuggestions: true, PlaylistLinkTemplate: "https://open.spotify.com/search/{mood}"}
+	agent.addPlaylist(weather, data)
+	got, _ := data["playlist"].(PlaylistSuggestion)
+	if got.Mood != "golden-hour" || got.Link != "https://open.spotify.com/search/golden-hour" {
+		t.Errorf("playlist = %+v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "sync"
+
+// Largest FETCH_CONCURRENCY accepted
+const maxFetchConcurrency = 32
+
+// Upstream calls in progress keyed by URL, so concurrent requests for the
+// same coordinates share one call instead of each hitting the provider
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// A call in progress and, once done is closed, its result
+type flightCall struct {
+	done   chan struct{}
+	body   []byte
+	status int
+	err    error
+}
+
+// Run fn for key unless a call for key is already in progress, in which case
+// wait for that call and return its result. The body is shared between
+// callers and must not be modified.
+func (g *flightGroup) do(key string, fn func() ([]byte, int, error)) ([]byte, int, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.body, call.status, call.err
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.body, call.status, call.err = fn()
+	return call.body, call.status, call.err
+}
+
+// Call fn for each index below n with at most limit calls running at once,
+// returning when all have finished. A limit below 1 runs them one at a time.
+func forEachLimit(n, limit int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		slots <- struct{}{} // Blocks while limit calls are running
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupSharesCalls(t *testing.T) {
+	var g flightGroup
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _, _ := g.do("key", func() ([]byte, int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return []byte("result"), 200, nil
+			})
+			results[i] = string(body)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond) // Let every caller join the call
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	for i, result := range results {
+		if result != "result" {
+			t.Errorf("caller %d got %q", i, result)
+		}
+	}
+
+	// Finished calls aren't reused
+	g.do("key", func() ([]byte, int, error) { atomic.AddInt32(&calls, 1); return nil, 0, nil })
+	if calls != 2 {
+		t.Errorf("fn called %d times after the first call finished, want 2", calls)
+	}
+}
+
+func TestForEachLimit(t *testing.T) {
+	tests := []struct {
+		n, limit, wantMax int
+	}{
+		{10, 3, 3},
+		{2, 8, 2},
+		{5, 0, 1},
+		{0, 4, 0},
+	}
+	for _, tt := range tests {
+		var running, peak int32
+		visited := make([]bool, tt.n)
+		forEachLimit(tt.n, tt.limit, func(i int) {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			visited[i] = true
+			atomic.AddInt32(&running, -1)
+		})
+		if int(peak) > tt.wantMax {
+			t.Errorf("n=%d limit=%d: %d calls ran at once, want at most %d", tt.n, tt.limit, peak, tt.wantMax)
+		}
+		for i, ok := range visited {
+			if !ok {
+				t.Errorf("n=%d limit=%d: index %d not visited", tt.n, tt.limit, i)
+			}
+		}
+	}
+}
+
+func TestCachedGetDeduplicatesConcurrentRequests(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), cache: newMemoryCache()}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body, _, err := agent.cachedGet(server.URL+"/forecast?latitude=1&longitude=2", time.Minute, false); err != nil || string(body) != `{"ok":true}` {
+				t.Errorf("cachedGet() = %s, %v", body, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if hits != 1 {
+		t.Errorf("upstream hit %d times, want 1", hits)
+	}
+}
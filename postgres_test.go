@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePostgresURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		sslMode string
+		wantErr bool
+	}{
+		{"postgres://localhost", "prefer", false},
+		{"postgresql://agent:s3cret@db:5433/weather?sslmode=require", "require", false},
+		{"postgres://agent@db/weather?sslmode=verify-full", "verify-full", false},
+		{"redis://localhost", "", true},
+		{"postgres:///weather", "", true},
+		{"postgres://localhost/weather?sslmode=allow", "", true},
+	}
+	for _, tt := range tests {
+		sslMode, err := parsePostgresURL(tt.url)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.url)
+			}
+			continue
+		}
+		if err != nil || sslMode != tt.sslMode {
+			t.Errorf("%s: got %q, %v", tt.url, sslMode, err)
+		}
+	}
+}
+
+// Invalid URLs must not echo the password into startup errors
+func TestOpenPostgresErrorHidesPassword(t *testing.T) {
+	for _, rawURL := range []string{
+		"postgres://agent:s3cret@db:port/weather",
+		"postgres://agent:s3cret@db/weather?connect_timeout=soon",
+	} {
+		if _, err := openPostgres(rawURL); err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("%s: got %v", rawURL, err)
+		}
+	}
+}
+
+// A statement received by the fake database, with its parameters in text form
+type fakePGStatement struct {
+	sql  string
+	args []string
+}
+
+// database/sql connector standing in for a Postgres server: it answers each
+// statement with handle, which returns rows or an error
+type fakePGConnector struct {
+	mu     sync.Mutex
+	handle func(stmt fakePGStatement) ([][]string, error)
+}
+
+func (c *fakePGConnector) Connect(context.Context) (driver.Conn, error) { return fakePGConn{c}, nil }
+func (c *fakePGConnector) Driver() driver.Driver                        { return fakePGDriver{c} }
+
+func (c *fakePGConnector) run(query string, args []driver.NamedValue) ([][]string, error) {
+	stmt := fakePGStatement{sql: query}
+	for _, arg := range args {
+		switch v := arg.Value.(type) {
+		case []byte:
+			stmt.args = append(stmt.args, string(v))
+		case time.Time:
+			stmt.args = append(stmt.args, v.UTC().Format(time.RFC3339Nano))
+		default:
+			stmt.args = append(stmt.args, fmt.Sprint(v))
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handle(stmt)
+}
+
+type fakePGDriver struct{ c *fakePGConnector }
+
+func (d fakePGDriver) Open(string) (driver.Conn, error) { return d.c.Connect(context.Background()) }
+
+type fakePGConn struct{ c *fakePGConnector }
+
+func (fakePGConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (fakePGConn) Close() error              { return nil }
+func (fakePGConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+func (conn fakePGConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := conn.c.run(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (conn fakePGConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := conn.c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakePGRows{rows: rows}, nil
+}
+
+// Rows with every value in text form
+type fakePGRows struct {
+	rows [][]string
+}
+
+func (r *fakePGRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"?column?"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakePGRows) Close() error { return nil }
+
+func (r *fakePGRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, value := range r.rows[0] {
+		dest[i] = []byte(value)
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Statements are sent once: a failed write isn't repeated, which could
+// count usage twice
+func TestPostgresStorageDoesntRetry(t *testing.T) {
+	calls := 0
+	s := &postgresStorage{db: sql.OpenDB(&fakePGConnector{handle: func(stmt fakePGStatement) ([][]string, error) {
+		calls++
+		return nil, errors.New("connection reset by peer")
+	}})}
+	if err := s.addUsage("2024-06-15", llmUsage{InputTokens: 10}, 0.1); err == nil || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+}
+
+// Emulates the storage tables for the statements postgresStorage sends
+type fakePGTables struct {
+	observations  []fakePGObservation
+	subscriptions map[string]string
+	usage         map[string][4]float64 // Requests, input tokens, output tokens, cost
+	compactedTo   []time.Time           // Cutoffs of hourly averaging runs
+	sensors       []fakePGObservation   // Sensor readings, with the sensor name as city
+	prompts       []fakePGObservation   // Prompts, with the model as city, oldest first
+}
+
+type fakePGObservation struct {
+	time time.Time
+	city string
+	data string
+}
+
+func newFakePGTables() *fakePGTables {
+	return &fakePGTables{subscriptions: make(map[string]string), usage: make(map[string][4]float64)}
+}
+
+func (f *fakePGTables) handle(stmt fakePGStatement) ([][]string, error) {
+	arg := func(i int) string { return stmt.args[i] }
+	parseTime := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, s)
+		return t
+	}
+	var rows [][]string
+	switch {
+	case strings.HasPrefix(stmt.sql, "CREATE "):
+	case strings.Contains(stmt.sql, "SELECT date_trunc('hour', time)"):
+		f.compactedTo = append(f.compactedTo, parseTime(arg(0)))
+	case strings.HasPrefix(stmt.sql, "INSERT INTO weather_observations"):
+		for _, obs := range f.observations {
+			if obs.city == arg(1) && obs.time.Equal(parseTime(arg(0))) {
+				return nil, nil
+			}
+		}
+		f.observations = append(f.observations, fakePGObservation{parseTime(arg(0)), arg(1), arg(2)})
+	case strings.HasPrefix(stmt.sql, "SELECT data FROM weather_observations"):
+		sort.Slice(f.observations, func(i, j int) bool { return f.observations[i].time.Before(f.observations[j].time) })
+		for _, obs := range f.observations {
+			if !obs.time.Before(parseTime(arg(0))) && (arg(1) == "" || obs.city == arg(1)) {
+				rows = append(rows, []string{obs.data})
+			}
+		}
+	case strings.HasPrefix(stmt.sql, "DELETE FROM weather_observations"):
+		kept := f.observations[:0]
+		for _, obs := range f.observations {
+			aggregate := strings.Contains(obs.data, `"samples"`)
+			if !obs.time.Before(parseTime(arg(0))) || (aggregate && strings.Contains(stmt.sql, "samples")) {
+				kept = append(kept, obs)
+			}
+		}
+		f.observations = kept
+	case strings.HasPrefix(stmt.sql, "INSERT INTO weather_subscriptions"):
+		f.subscriptions[arg(0)] = arg(1)
+	case strings.HasPrefix(stmt.sql, "SELECT data FROM weather_subscriptions"):
+		for _, data := range f.subscriptions {
+			rows = append(rows, []string{data})
+		}
+	case strings.HasPrefix(stmt.sql, "DELETE FROM weather_subscriptions"):
+		delete(f.subscriptions, arg(0))
+	case strings.HasPrefix(stmt.sql, "INSERT INTO weather_llm_usage"):
+		totals := f.usage[arg(0)]
+		for i, value := range []string{"1", arg(1), arg(2), arg(3)} {
+			var n float64
+			json.Unmarshal([]byte(value), &n)
+			totals[i] += n
+		}
+		f.usage[arg(0)] = totals
+	case strings.HasPrefix(stmt.sql, "SELECT requests"):
+		if totals, ok := f.usage[arg(0)]; ok {
+			row := make([]string, 4)
+			for i, value := range totals {
+				data, _ := json.Marshal(value)
+				row[i] = string(data)
+			}
+			rows = append(rows, row)
+		}
+	case strings.HasPrefix(stmt.sql, "DELETE FROM weather_llm_usage"):
+	case strings.HasPrefix(stmt.sql, "INSERT INTO weather_sensor_readings"):
+		f.sensors = slices.DeleteFunc(f.sensors, func(r fakePGObservation) bool {
+			return r.city == arg(0) && r.time.Equal(parseTime(arg(1)))
+		})
+		f.sensors = append(f.sensors, fakePGObservation{parseTime(arg(1)), arg(0), arg(2)})
+		sort.Slice(f.sensors, func(i, j int) bool { return f.sensors[i].time.Before(f.sensors[j].time) })
+	case strings.HasPrefix(stmt.sql, "DELETE FROM weather_sensor_readings"):
+		keep, _ := strconv.Atoi(arg(1))
+		seen := 0
+		for i := len(f.sensors) - 1; i >= 0; i-- {
+			if f.sensors[i].city != arg(0) {
+				continue
+			}
+			if seen++; seen > keep {
+				f.sensors = slices.Delete(f.sensors, i, i+1)
+			}
+		}
+	case strings.HasPrefix(stmt.sql, "SELECT data FROM weather_sensor_readings"):
+		for _, r := range f.sensors {
+			if !r.time.Before(parseTime(arg(0))) && (arg(1) == "" || r.city == arg(1)) {
+				rows = append(rows, []string{r.data})
+			}
+		}
+	case strings.HasPrefix(stmt.sql, "SELECT DISTINCT sensor"):
+		names := map[string]bool{}
+		for _, r := range f.sensors {
+			if !names[r.city] {
+				names[r.city] = true
+				rows = append(rows, []string{r.city})
+			}
+		}
+	case strings.HasPrefix(stmt.sql, "INSERT INTO weather_prompts"):
+		f.prompts = append(f.prompts, fakePGObservation{parseTime(arg(1)), arg(2), arg(3)})
+	case strings.HasPrefix(stmt.sql, "DELETE FROM weather_prompts"):
+		if keep, _ := strconv.Atoi(arg(0)); len(f.prompts) > keep {
+			f.prompts = f.prompts[len(f.prompts)-keep:]
+		}
+	case strings.HasPrefix(stmt.sql, "SELECT data FROM weather_prompts WHERE id"):
+		for _, p := range f.prompts {
+			if strings.Contains(p.data, `"id":"`+arg(0)+`"`) {
+				rows = append(rows, []string{p.data})
+			}
+		}
+	case strings.HasPrefix(stmt.sql, "SELECT data FROM weather_prompts"):
+		limit, _ := strconv.Atoi(arg(1))
+		for i := len(f.prompts) - 1; i >= 0 && len(rows) < limit; i-- {
+			if arg(0) == "" || f.prompts[i].city == arg(0) {
+				rows = append(rows, []string{f.prompts[i].data})
+			}
+		}
+	default:
+		return nil, errors.New("unexpected statement: " + stmt.sql)
+	}
+	return rows, nil
+}
+
+func TestPostgresStorage(t *testing.T) {
+	tables := newFakePGTables()
+	db, err := initPostgresStorage(sql.OpenDB(&fakePGConnector{handle: tables.handle}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("observations", func(t *testing.T) {
+		store := newDatabaseObservationStore(db, 48*time.Hour, 0)
+		now := time.Now().UTC().Truncate(time.Second)
+		readings := []Observation{
+			{Time: now.Add(-100 * time.Hour), City: "Oslo", Temp: 1}, // Pruned
+			{Time: now.Add(-2 * time.Hour), City: "Oslo", Temp: 2},
+			{Time: now.Add(-2 * time.Hour), City: "Oslo", Temp: 2}, // Duplicate reading
+			{Time: now.Add(-time.Hour), City: "Bergen", Temp: 3},
+		}
+		for _, obs := range readings {
+			if err := store.record(obs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store.lastPrune = time.Time{}
+		store.record(readings[3])
+
+		all, err := store.since(now.Add(-200*time.Hour), "")
+		if err != nil || len(all) != 2 || all[0].City != "Oslo" || !all[1].Time.Equal(readings[3].Time) {
+			t.Errorf("got %+v, err %v", all, err)
+		}
+		if oslo, _ := store.since(now.Add(-24*time.Hour), "Oslo"); len(oslo) != 1 || oslo[0].Temp != 2 {
+			t.Errorf("city filter: got %+v", oslo)
+		}
+	})
+
+	t.Run("compaction", func(t *testing.T) {
+		tables.observations = nil
+		store := newDatabaseObservationStore(db, 48*time.Hour, 30*24*time.Hour)
+		now := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+		for _, obs := range []Observation{
+			{Time: now.AddDate(0, 0, -40), City: "Oslo", Samples: 4},      // Expired hourly point
+			{Time: now.AddDate(0, 0, -10), City: "Oslo", Samples: 4},      // Kept hourly point
+			{Time: now.Add(-49 * time.Hour), City: "Oslo", Temp: 1},       // Averaged
+			{Time: now.Add(-47*time.Hour - 45*time.Minute), City: "Oslo"}, // In the hour still being filled
+		} {
+			if err := store.record(obs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.compact(now); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := time.Date(2024, 6, 13, 12, 0, 0, 0, time.UTC); len(tables.compactedTo) != 1 || !tables.compactedTo[0].Equal(want) {
+			t.Errorf("averaged readings before %v, want %v", tables.compactedTo, want)
+		}
+		left, _ := store.since(time.Time{}, "")
+		if len(left) != 2 || left[0].Samples != 4 || !left[1].Time.Equal(now.Add(-47*time.Hour-45*time.Minute)) {
+			t.Errorf("left %+v", left)
+		}
+	})
+
+	// Two replicas share subscriptions through the database
+	t.Run("subscriptions", func(t *testing.T) {
+		first, err := newDatabaseSubscriptionStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := newDatabaseSubscriptionStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sub, err := first.add("owner", ChannelEmail, "me@example.com", SubscriptionPreferences{Updates: true}, &ProfileLocation{City: "Leeds", Lat: 53.8, Lon: -1.55})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := second.update("owner", sub.ID, func(s *Subscription) { s.Verified = true }); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := first.get("owner", sub.ID)
+		if !ok || !got.Verified || got.Owner != "owner" || got.Location == nil || got.Location.City != "Leeds" {
+			t.Fatalf("first replica sees %+v", got)
+		}
+		if locations := first.locations(NotificationUpdate); len(locations) != 1 {
+			t.Errorf("locations = %+v", locations)
+		}
+
+		if removed, err := second.remove("owner", sub.ID); !removed || err != nil {
+			t.Fatalf("remove: %v %v", removed, err)
+		}
+		if list := first.list("owner"); len(list) != 0 {
+			t.Errorf("removed subscription still listed: %+v", list)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		agent := &WeatherAgent{
+			config: Config{LLMInputPricePerMTok: 3, LLMOutputPricePerMTok: 15},
+			logger: log.New(io.Discard, "", 0),
+			cache:  newMemoryCache(),
+			db:     db,
+		}
+		agent.recordLLMUsage(llmUsage{InputTokens: 1000, OutputTokens: 200})
+		agent.recordLLMUsage(llmUsage{InputTokens: 500, OutputTokens: 100})
+
+		today := agent.usageTotals(usageDate(time.Now()))
+		if today.Requests != 2 || today.InputTokens != 1500 || today.TotalTokens != 1800 || math.Abs(today.CostUSD-0.009) > 1e-9 {
+			t.Errorf("unexpected totals %+v", today)
+		}
+		if _, ok, _ := agent.cache.Get(usageKey(today.Date)); ok {
+			t.Error("usage also written to the cache")
+		}
+	})
+
+	t.Run("sensors", func(t *testing.T) {
+		store := newDatabaseSensorStore(db)
+		now := time.Now().UTC().Truncate(time.Second)
+		co2 := 600.0
+		for i := maxSensorReadings; i >= 0; i-- { // Newest first, so each one is backdated
+			if _, err := store.record(SensorReading{Sensor: "office", Time: now.Add(-time.Duration(i) * time.Minute), CO2: &co2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store.record(SensorReading{Sensor: "office", Time: now.Add(-time.Hour), CO2: &co2})
+		store.record(SensorReading{Sensor: "attic", Time: now.Add(-time.Hour), CO2: &co2})
+
+		latest, err := store.latest(now.Add(-2 * time.Hour))
+		if err != nil || len(latest) != 2 || latest[0].Sensor != "attic" || !latest[1].Time.Equal(now) {
+			t.Errorf("latest = %+v, %v", latest, err)
+		}
+		if office, _ := store.since("office", time.Time{}); len(office) != maxSensorReadings {
+			t.Errorf("kept %d readings, want %d", len(office), maxSensorReadings)
+		}
+	})
+	t.Run("prompts", func(t *testing.T) {
+		prompts := newDatabasePromptLog(db, 2)
+		var last PromptRecord
+		for _, model := range []string{"model-a", "model-b", "model-a"} {
+			record, err := prompts.record(PromptRecord{Model: model, UserMessage: "Weather?"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			last = record
+		}
+
+		all, err := prompts.list("", 10)
+		if err != nil || len(all) != 2 || all[0].ID != last.ID || all[1].Model != "model-b" {
+			t.Errorf("list = %+v, %v; want the newest two, newest first", all, err)
+		}
+		if got, _ := prompts.list("model-a", 10); len(got) != 1 {
+			t.Errorf("list(model-a) = %d prompts, want 1", len(got))
+		}
+		if got, ok, err := prompts.get(last.ID); !ok || err != nil || got.UserMessage != "Weather?" {
+			t.Errorf("get = %+v, %v, %v", got, ok, err)
+		}
+		if _, ok, _ := prompts.get("missing"); ok {
+			t.Error("get found a missing prompt")
+		}
+		if newDatabasePromptLog(db, 0) != nil {
+			t.Error("newDatabasePromptLog(limit 0) should be nil")
+		}
+	})
+}
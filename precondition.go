@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Pre-conditioning event types
+const (
+	PreconditionHeat = "preheat"
+	PreconditionCool = "precool"
+)
+
+// Hours of hourly forecast considered when planning
+const preconditionHorizonHours = 24
+
+// Comfort targets for the pre-conditioning advisor (in the configured units)
+type ComfortConfig struct {
+	Enabled     bool
+	MinTemp     float64 // Heat when the outdoor temperature drops below this
+	MaxTemp     float64 // Cool when the outdoor temperature rises above this
+	LeadMinutes int     // Base lead time before a period starts
+}
+
+// A recommended window to run heating or cooling ahead of outdoor conditions
+type PreconditionEvent struct {
+	Type            string    `json:"type"`
+	Start           time.Time `json:"start"`        // When to start the appliance
+	PeriodStart     time.Time `json:"period_start"` // When outdoor temperature leaves the comfort band
+	PeriodEnd       time.Time `json:"period_end"`
+	PeakOutdoorTemp float64   `json:"peak_outdoor_temp"` // Coldest or hottest forecast temperature
+	TargetTemp      float64   `json:"target_temp"`
+	Reason          string    `json:"reason"`
+}
+
+// Latest pre-conditioning plan for the configured location
+type PreconditionSchedule struct {
+	City        string              `json:"city"`
+	Units       string              `json:"units"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Events      []PreconditionEvent `json:"events"`
+}
+
+// Thread-safe holder for the latest schedule
+type preconditionAdvisor struct {
+	mu       sync.RWMutex
+	schedule *PreconditionSchedule
+}
+
+func (p *preconditionAdvisor) set(schedule *PreconditionSchedule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.schedule = schedule
+}
+
+func (p *preconditionAdvisor) get() *PreconditionSchedule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.schedule
+}
+
+// Fetch the hourly temperature forecast for the next day
+func (agent *WeatherAgent) fetchHourlyTemperatures(lat, lon float64) ([]HourlyValue, error) {
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&hourly=temperature_2m&forecast_days=2&temperature_unit=%s&timezone=auto",
+		lat, lon, tempUnit)
+
+	client := agent.httpClient(10 * time.Second)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("hourly forecast request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("hourly forecast API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var hourlyResp struct {
+		Hourly struct {
+			Time        []string  `json:"time"`
+			Temperature []float64 `json:"temperature_2m"`
+		} `json:"hourly"`
+		TimezoneOffset int `json:"utc_offset_seconds"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&hourlyResp); err != nil {
+		return nil, fmt.Errorf("failed to parse hourly forecast: %v", err)
+	}
+
+	loc := time.FixedZone("Local", hourlyResp.TimezoneOffset)
+	return parseHourlySeries(hourlyResp.Hourly.Time, hourlyResp.Hourly.Temperature, loc), nil
+}
+
+// Plan pre-heating/cooling windows from an hourly temperature curve.
+// Only hours from now through the planning horizon are considered.
+func planPreconditioning(hourly []HourlyValue, comfort ComfortConfig, now time.Time) []PreconditionEvent {
+	events := make([]PreconditionEvent, 0)
+	horizon := now.Add(preconditionHorizonHours * time.Hour)
+
+	var current *PreconditionEvent
+	closeCurrent := func() {
+		if current == nil {
+			return
+		}
+		// Longer lead for larger deviations from the comfort band, capped at 3x
+		deviation := math.Abs(current.PeakOutdoorTemp - current.TargetTemp)
+		lead := float64(comfort.LeadMinutes) * math.Min(3, 1+deviation/10)
+		current.Start = current.PeriodStart.Add(-time.Duration(lead) * time.Minute)
+		if current.Start.Before(now) {
+			current.Start = now
+		}
+
+		if current.Type == PreconditionHeat {
+			current.Reason = fmt.Sprintf("Outdoor temperature drops to %.1f, below the %.1f comfort minimum", current.PeakOutdoorTemp, current.TargetTemp)
+		} else {
+			current.Reason = fmt.Sprintf("Outdoor temperature rises to %.1f, above the %.1f comfort maximum", current.PeakOutdoorTemp, current.TargetTemp)
+		}
+		events = append(events, *current)
+		current = nil
+	}
+
+	for _, h := range hourly {
+		t := time.Unix(h.Time, 0).In(now.Location())
+		// Skip hours that have already finished or are beyond the horizon
+		if t.Add(time.Hour).Before(now) || t.After(horizon) {
+			continue
+		}
+
+		eventType := ""
+		target := 0.0
+		switch {
+		case h.Value < comfort.MinTemp:
+			eventType, target = PreconditionHeat, comfort.MinTemp
+		case h.Value > comfort.MaxTemp:
+			eventType, target = PreconditionCool, comfort.MaxTemp
+		}
+
+		if current != nil && current.Type != eventType {
+			closeCurrent()
+		}
+		if eventType == "" {
+			continue
+		}
+
+		if current == nil {
+			current = &PreconditionEvent{
+				Type:            eventType,
+				PeriodStart:     t,
+				PeakOutdoorTemp: h.Value,
+				TargetTemp:      target,
+			}
+		}
+		current.PeriodEnd = t.Add(time.Hour)
+		if (eventType == PreconditionHeat && h.Value < current.PeakOutdoorTemp) ||
+			(eventType == PreconditionCool && h.Value > current.PeakOutdoorTemp) {
+			current.PeakOutdoorTemp = h.Value
+		}
+	}
+	closeCurrent()
+
+	return events
+}
+
+// Recompute the pre-conditioning schedule for the configured location
+func (agent *WeatherAgent) updatePreconditionSchedule() error {
+	city, country := agent.location()
+	lat, lon, err := agent.getCoordinates(city, country)
+	if err != nil {
+		return fmt.Errorf("error resolving location: %v", err)
+	}
+
+	hourly, err := agent.fetchHourlyTemperatures(lat, lon)
+	if err != nil {
+		return err
+	}
+
+	schedule := &PreconditionSchedule{
+		City:        city,
+		Units:       agent.config.Units,
+		GeneratedAt: time.Now(),
+		Events:      planPreconditioning(hourly, agent.config.Comfort, time.Now()),
+	}
+	agent.precondition.set(schedule)
+
+	for _, event := range schedule.Events {
+		agent.logger.Printf("Pre-conditioning advisory: %s from %s (%s)",
+			event.Type, event.Start.Format(time.RFC3339), event.Reason)
+	}
+	return nil
+}
+
+// Refresh the pre-conditioning schedule every hour
+func (agent *WeatherAgent) runPreconditionScheduler() {
+	for {
+		if err := agent.updatePreconditionSchedule(); err != nil {
+			agent.logger.Printf("Error updating pre-conditioning schedule: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
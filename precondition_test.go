@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanPreconditioning(t *testing.T) {
+	loc := time.FixedZone("Local", 0)
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, loc)
+	temps := []float64{20, 19, 16, 12, 14, 19, 21, 27, 29, 24}
+
+	hourly := make([]HourlyValue, len(temps))
+	for i, v := range temps {
+		hourly[i] = HourlyValue{Time: now.Add(time.Duration(i) * time.Hour).Unix(), Value: v}
+	}
+
+	comfort := ComfortConfig{MinTemp: 18, MaxTemp: 25, LeadMinutes: 60}
+	events := planPreconditioning(hourly, comfort, now)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(events), events)
+	}
+
+	heat := events[0]
+	if heat.Type != PreconditionHeat || heat.PeakOutdoorTemp != 12 {
+		t.Errorf("unexpected heat event: %+v", heat)
+	}
+	if !heat.PeriodStart.Equal(now.Add(2*time.Hour)) || !heat.PeriodEnd.Equal(now.Add(5*time.Hour)) {
+		t.Errorf("unexpected heat period %v - %v", heat.PeriodStart, heat.PeriodEnd)
+	}
+	// 6 degrees below target gives a 1.6x lead of 96 minutes
+	if want := heat.PeriodStart.Add(-96 * time.Minute); !heat.Start.Equal(want) {
+		t.Errorf("heat start %v, want %v", heat.Start, want)
+	}
+
+	cool := events[1]
+	if cool.Type != PreconditionCool || cool.PeakOutdoorTemp != 29 {
+		t.Errorf("unexpected cool event: %+v", cool)
+	}
+}
+
+func TestPlanPreconditioningClampsStartToNow(t *testing.T) {
+	loc := time.FixedZone("Local", 0)
+	now := time.Date(2024, 1, 10, 12, 30, 0, 0, loc)
+	hourly := []HourlyValue{
+		{Time: now.Add(-30 * time.Minute).Unix(), Value: 5},
+		{Time: now.Add(30 * time.Minute).Unix(), Value: 20},
+	}
+
+	events := planPreconditioning(hourly, ComfortConfig{MinTemp: 18, MaxTemp: 25, LeadMinutes: 60}, now)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if !events[0].Start.Equal(now) {
+		t.Errorf("start should be clamped to now, got %v", events[0].Start)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Profile settings
+const (
+	profileCookieName = "weather_agent_profile"
+	profileHeader     = "X-Profile-Token"
+	profileCookieAge  = 365 * 24 * time.Hour
+	maxProfiles       = 10000 // Least recently updated profiles are dropped beyond this
+)
+
+// Saved location for a profile
+type ProfileLocation struct {
+	City    string  `json:"city,omitempty"`
+	Country string  `json:"country,omitempty"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// A user's saved preferences, applied to requests that don't override them
+type Profile struct {
+	Location      *ProfileLocation `json:"location,omitempty"`
+	Units         string           `json:"units,omitempty"`    // "metric" or "imperial", for the data and messages
+	Language      string           `json:"language,omitempty"` // Language the data, messages and chat answers are in, e.g. "de"
+	Persona       string           `json:"persona,omitempty"`
+	Sensitivities []string         `json:"sensitivities,omitempty"` // Groups air quality guidance is written for
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// On-disk form of a profile, keyed by a hash of its token
+type storedProfile struct {
+	Profile
+	ID string `json:"id"`
+}
+
+// Store profiles under a hash of the token, so tokens are never saved
+func profileID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Profile token sent with a request: the header for API clients, otherwise the UI cookie
+func requestProfileToken(r *http.Request) string {
+	if token := strings.TrimSpace(r.Header.Get(profileHeader)); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(profileCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Check and normalize the preferences. Location is checked but not resolved.
+func validateProfile(p Profile) (Profile, error) {
+	p.Units = strings.ToLower(strings.TrimSpace(p.Units))
+	if p.Units != "" && p.Units != "metric" && p.Units != "imperial" {
+		return p, fmt.Errorf("units must be metric or imperial")
+	}
+
+	p.Language = strings.ToLower(strings.TrimSpace(p.Language))
+	if p.Language != "" {
+		if _, ok := catalog[p.Language]; !ok {
+			return p, fmt.Errorf("unsupported language %q", p.Language)
+		}
+	}
+
+	if p.Persona != "" {
+		persona, ok := findPersona(p.Persona)
+		if !ok {
+			return p, fmt.Errorf("unknown persona %q (available: %s)", p.Persona, personaNames())
+		}
+		p.Persona = persona.Name
+	}
+
+	sensitivities, err := parseSensitivities(p.Sensitivities)
+	if err != nil {
+		return p, err
+	}
+	p.Sensitivities = sensitivities
+
+	if p.Location != nil {
+		if err := validateProfileLocation(p.Location); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Check and normalize a location given by city or coordinates
+func validateProfileLocation(loc *ProfileLocation) error {
+	loc.City, loc.Country = strings.TrimSpace(loc.City), strings.ToUpper(strings.TrimSpace(loc.Country))
+	if loc.City == "" && (loc.Lat < -90 || loc.Lat > 90 || loc.Lon < -180 || loc.Lon > 180) {
+		return fmt.Errorf("invalid coordinates")
+	}
+	return nil
+}
+
+// Resolve a location given by city to coordinates
+func (agent *WeatherAgent) resolveProfileLocation(loc *ProfileLocation) error {
+	if loc.City == "" {
+		return nil
+	}
+	lat, lon, err := agent.getCoordinates(loc.City, loc.Country)
+	if err != nil {
+		return err
+	}
+	loc.Lat, loc.Lon = lat, lon
+	return nil
+}
+
+// Identifies a location to the nearest ~10m, for grouping recipients
+func (loc ProfileLocation) key() string {
+	return fmt.Sprintf("%.4f,%.4f", loc.Lat, loc.Lon)
+}
+
+// Name of a location for logs: the city if known, else the coordinates
+func (loc ProfileLocation) label() string {
+	if loc.City != "" {
+		return strings.TrimSuffix(loc.City+", "+loc.Country, ", ")
+	}
+	return loc.key()
+}
+
+// Concurrency-safe profile registry, optionally saved to a JSON file
+type profileStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*Profile
+}
+
+// Create a store, loading existing profiles from path if given
+func newProfileStore(path string) (*profileStore, error) {
+	s := &profileStore{path: path, items: make(map[string]*Profile)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles file: %v", err)
+	}
+
+	var stored []storedProfile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error parsing profiles file: %v", err)
+	}
+	for _, st := range stored {
+		profile := st.Profile
+		s.items[st.ID] = &profile
+	}
+	return s, nil
+}
+
+// Write all profiles to disk. Callers must hold s.mu.
+func (s *profileStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]storedProfile, 0, len(s.items))
+	for id, profile := range s.items {
+		stored = append(stored, storedProfile{Profile: *profile, ID: id})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error saving profiles: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Profile for a token
+func (s *profileStore) get(token string) (Profile, bool) {
+	if token == "" {
+		return Profile{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.items[profileID(token)]
+	if !ok {
+		return Profile{}, false
+	}
+	return *profile, true
+}
+
+// Save a profile, dropping the least recently updated one when full
+func (s *profileStore) put(token string, profile Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := profileID(token)
+	if _, exists := s.items[id]; !exists && len(s.items) >= maxProfiles {
+		var oldestID string
+		var oldest time.Time
+		for otherID, other := range s.items {
+			if oldestID == "" || other.UpdatedAt.Before(oldest) {
+				oldestID, oldest = otherID, other.UpdatedAt
+			}
+		}
+		delete(s.items, oldestID)
+	}
+	profile.UpdatedAt = time.Now()
+	s.items[id] = &profile
+	return s.save()
+}
+
+// Remove a token's profile. Returns false if there was none.
+func (s *profileStore) remove(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := profileID(token)
+	if _, ok := s.items[id]; !ok {
+		return false, nil
+	}
+	delete(s.items, id)
+	return true, s.save()
+}
+
+// Saved profile for the request, if any
+func (agent *WeatherAgent) requestProfile(r *http.Request) (Profile, bool) {
+	if agent.profiles == nil {
+		return Profile{}, false
+	}
+	return agent.profiles.get(requestProfileToken(r))
+}
+
+// Convert the weather's values from one unit system to another. Nested
+// readings are copied rather than changed, as the weather may be cached.
+func convertWeatherUnits(weather WeatherResponse, from, to units.System) WeatherResponse {
+	if from == to {
+		return weather
+	}
+	temp := func(v float64) float64 { return units.TemperatureIn(v, from).In(to) }
+	change := func(v float64) float64 { return temp(v) - temp(0) } // Differences scale but don't shift
+	speed := func(v float64) float64 { return units.SpeedIn(v, from).In(to) }
+
+	weather.Main.Temp, weather.Main.FeelsLike = temp(weather.Main.Temp), temp(weather.Main.FeelsLike)
+	weather.Main.TempMin, weather.Main.TempMax = temp(weather.Main.TempMin), temp(weather.Main.TempMax)
+	weather.Wind.Speed, weather.Wind.Gust = speed(weather.Wind.Speed), speed(weather.Wind.Gust)
+	if n := weather.Normals; n != nil {
+		normals := *n
+		normals.NormalHigh, normals.NormalLow = temp(n.NormalHigh), temp(n.NormalLow)
+		normals.TodayHigh, normals.TodayLow = temp(n.TodayHigh), temp(n.TodayLow)
+		normals.HighAnomaly, normals.LowAnomaly = change(n.HighAnomaly), change(n.LowAnomaly)
+		weather.Normals = &normals
+	}
+	if ly := weather.LastYear; ly != nil {
+		lastYear := *ly
+		lastYear.High, lastYear.Low, lastYear.HighChange = temp(ly.High), temp(ly.Low), change(ly.HighChange)
+		weather.LastYear = &lastYear
+	}
+	if c := weather.Confidence; c != nil {
+		confidence := *c
+		confidence.HighMedian, confidence.HighP10, confidence.HighP90 = temp(c.HighMedian), temp(c.HighP10), temp(c.HighP90)
+		confidence.HighSpread = change(c.HighSpread)
+		confidence.Unit = to.TemperatureSymbol()
+		weather.Confidence = &confidence
+	}
+	weather.Units = string(to)
+	return weather
+}
+
+// The weather in the profile's units and language, so the data and message
+// generated from it come out in them. Preferences matching the configuration
+// are left out, so those callers share the configured messages.
+func (agent *WeatherAgent) applyProfile(weather WeatherResponse, profile Profile) WeatherResponse {
+	system, language := agent.profileDisplay(profile)
+	if system != "" {
+		weather = convertWeatherUnits(weather, agent.units(), units.ParseSystem(system))
+	}
+	weather.Locale = language
+	return weather
+}
+
+// Units and language the profile asks for, each empty when it's the configured one
+func (agent *WeatherAgent) profileDisplay(profile Profile) (string, string) {
+	var system, language string
+	if profile.Units != "" && units.ParseSystem(profile.Units) != agent.units() {
+		system = string(units.ParseSystem(profile.Units))
+	}
+	if profile.Language != "" && !strings.EqualFold(profile.Language, agent.config.Locale) {
+		language = profile.Language
+	}
+	return system, language
+}
+
+// Whether the weather was switched to a caller's units or language
+func (w WeatherResponse) personalized() bool {
+	return w.Units != "" || w.Locale != ""
+}
+
+// Keep a message as the location's last one and compare it with model B's,
+// unless it's in a caller's own units or language, which others shouldn't be
+// served
+func (agent *WeatherAgent) shareMessage(weather WeatherResponse, historyContext, persona string, params llmParams, message string) {
+	if weather.personalized() {
+		return
+	}
+	agent.compareModels(weather, historyContext, persona, params, message)
+	agent.setLastMessage(weatherLocationKey(weather), message)
+}
+
+// Persona for a request: ?persona= if given, then the profile's, then the deployment default
+func (agent *WeatherAgent) requestPersona(r *http.Request) (string, error) {
+	requested := r.URL.Query().Get("persona")
+	if requested == "" {
+		if profile, ok := agent.requestProfile(r); ok {
+			requested = profile.Persona
+		}
+	}
+	return agent.resolvePersona(requested)
+}
+
+// Set or clear the profile cookie
+func setProfileCookie(w http.ResponseWriter, r *http.Request, token string) {
+	cookie := &http.Cookie{
+		Name:     profileCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+		MaxAge:   int(profileCookieAge.Seconds()),
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// GET returns the caller's profile; PUT saves it (issuing a token and cookie
+// on first save); DELETE removes it
+func (agent *WeatherAgent) handleProfile(w http.ResponseWriter, r *http.Request) {
+	token := requestProfileToken(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, ok := agent.profiles.get(token)
+		if !ok {
+			apiError(w, "No profile", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+
+	case http.MethodPut:
+		var req Profile
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+			apiError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		profile, err := validateProfile(req)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Resolve a city once here so requests don't geocode on every call
+		if profile.Location != nil {
+			if err := agent.resolveProfileLocation(profile.Location); err != nil {
+				apiError(w, "Unable to resolve location", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if token == "" {
+			token = newMessageID() + newMessageID()
+		}
+		if err := agent.profiles.put(token, profile); err != nil {
+			agent.logger.Printf("Error saving profile: %v", err)
+			apiError(w, "Unable to save profile", http.StatusInternalServerError)
+			return
+		}
+		profile, _ = agent.profiles.get(token)
+
+		setProfileCookie(w, r, token)
+		writeJSON(w, http.StatusOK, ProfileResponse{Token: token, Profile: profile})
+
+	case http.MethodDelete:
+		removed, err := agent.profiles.remove(token)
+		if err != nil {
+			agent.logger.Printf("Error removing profile: %v", err)
+			apiError(w, "Unable to remove profile", http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			apiError(w, "No profile", http.StatusNotFound)
+			return
+		}
+		setProfileCookie(w, r, "")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		wantErr bool
+	}{
+		{"empty", Profile{}, false},
+		{"full", Profile{Units: "Imperial", Language: "DE", Persona: "Haiku Poet", Location: &ProfileLocation{Lat: 51.5, Lon: -0.1}}, false},
+		{"city", Profile{Location: &ProfileLocation{City: "Leeds", Country: "gb"}}, false},
+		{"bad units", Profile{Units: "kelvin"}, true},
+		{"bad language", Profile{Language: "xx"}, true},
+		{"bad persona", Profile{Persona: "wizard"}, true},
+		{"bad sensitivity", Profile{Sensitivities: []string{"asthma", "hay fever"}}, true},
+		{"bad coordinates", Profile{Location: &ProfileLocation{Lat: 95, Lon: 0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name == "full" && (got.Units != "imperial" || got.Language != "de" || got.Persona != "haiku-poet") {
+				t.Errorf("validateProfile() = %+v, want normalized values", got)
+			}
+			if tt.name == "city" && got.Location.Country != "GB" {
+				t.Errorf("country = %q, want GB", got.Location.Country)
+			}
+		})
+	}
+}
+
+func TestProfileStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	store, err := newProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.put("token-1", Profile{Units: "imperial", Persona: "pirate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := newProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, ok := reloaded.get("token-1")
+	if !ok || profile.Units != "imperial" || profile.Persona != "pirate" || profile.UpdatedAt.IsZero() {
+		t.Errorf("reloaded profile = %+v, %v", profile, ok)
+	}
+	if _, ok := reloaded.get("token-2"); ok {
+		t.Error("unknown token should have no profile")
+	}
+	if removed, _ := reloaded.remove("token-1"); !removed {
+		t.Error("remove() = false, want true")
+	}
+}
+
+func TestHandleProfile(t *testing.T) {
+	store, _ := newProfileStore("")
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), profiles: store, config: Config{Persona: "meteorologist"}}
+
+	put := httptest.NewRequest(http.MethodPut, "/api/profile", strings.NewReader(`{"location":{"lat":40.7,"lon":-74},"persona":"pirate","language":"fr"}`))
+	rec := httptest.NewRecorder()
+	agent.handleProfile(rec, put)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status %d: %s", rec.Code, rec.Body.String())
+	}
+	var saved struct {
+		Token   string  `json:"token"`
+		Profile Profile `json:"profile"`
+	}
+	json.NewDecoder(rec.Body).Decode(&saved)
+	cookies := rec.Result().Cookies()
+	if saved.Token == "" || len(cookies) != 1 || cookies[0].Value != saved.Token {
+		t.Fatalf("token %q, cookies %v", saved.Token, cookies)
+	}
+
+	// The cookie carries the profile into later requests
+	req := httptest.NewRequest(http.MethodGet, "/api/weather", nil)
+	req.AddCookie(cookies[0])
+	if persona, _ := agent.requestPersona(req); persona != "pirate" {
+		t.Errorf("requestPersona() = %q, want pirate", persona)
+	}
+	query := httptest.NewRequest(http.MethodGet, "/api/weather?persona=news-anchor", nil)
+	query.AddCookie(cookies[0])
+	if persona, _ := agent.requestPersona(query); persona != "news-anchor" {
+		t.Errorf("requestPersona() with ?persona= = %q, want news-anchor", persona)
+	}
+	if persona, _ := agent.requestPersona(httptest.NewRequest(http.MethodGet, "/api/weather", nil)); persona != "meteorologist" {
+		t.Errorf("requestPersona() without a profile = %q, want the default", persona)
+	}
+
+	// API clients send the token in a header
+	get := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	get.Header.Set(profileHeader, saved.Token)
+	rec = httptest.NewRecorder()
+	agent.handleProfile(rec, get)
+	var profile Profile
+	json.NewDecoder(rec.Body).Decode(&profile)
+	if rec.Code != http.StatusOK || profile.Location == nil || profile.Location.Lat != 40.7 || profile.Language != "fr" {
+		t.Errorf("GET status %d, profile %+v", rec.Code, profile)
+	}
+
+	bad := httptest.NewRequest(http.MethodPut, "/api/profile", strings.NewReader(`{"units":"kelvin"}`))
+	rec = httptest.NewRecorder()
+	agent.handleProfile(rec, bad)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid PUT status %d, want 400", rec.Code)
+	}
+
+	del := httptest.NewRequest(http.MethodDelete, "/api/profile", nil)
+	del.Header.Set(profileHeader, saved.Token)
+	rec = httptest.NewRecorder()
+	agent.handleProfile(rec, del)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status %d, want 204", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	agent.handleProfile(rec, get)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET after DELETE status %d, want 404", rec.Code)
+	}
+}
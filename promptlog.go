@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Most prompts returned by one /api/prompts request
+const maxPromptListLimit = 500
+
+var errPromptNotFound = errors.New("prompt not found")
+
+// An LLM call kept for auditing and replay
+type PromptRecord struct {
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	SystemPrompt string    `json:"system_prompt"`
+	UserMessage  string    `json:"user_message"`
+	Response     string    `json:"response,omitempty"` // Before the guardrail, as the model wrote it
+	Error        string    `json:"error,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	LatencyMs    int64     `json:"latency_ms"`
+	Tools        bool      `json:"tools,omitempty"`     // The model fetched data through tools
+	ReplayOf     string    `json:"replay_of,omitempty"` // ID of the prompt this re-ran
+}
+
+// The most recent prompts, optionally persisted to a JSON-lines file so the
+// log survives restarts, or kept in a database shared with other replicas.
+// A nil log records nothing.
+type promptLog struct {
+	mu      sync.Mutex
+	limit   int
+	records []PromptRecord
+	path    string
+	file    *os.File
+	lines   int     // Records in the file; it's rewritten once it holds twice the limit
+	db      storage // Used instead of records and file when set
+}
+
+// Create a log keeping the newest limit prompts in a database. Returns nil
+// when limit is 0.
+func newDatabasePromptLog(db storage, limit int) *promptLog {
+	if limit <= 0 {
+		return nil
+	}
+	return &promptLog{limit: limit, db: db}
+}
+
+// Create a log keeping limit prompts, loading earlier ones from path if
+// given. Returns nil when limit is 0.
+func newPromptLog(path string, limit int) (*promptLog, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	l := &promptLog{limit: limit, path: path}
+	if path == "" {
+		return l, nil
+	}
+
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024) // Prompts with all the weather data run long
+		for scanner.Scan() {
+			var record PromptRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+				l.records = append(l.records, record)
+			}
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading prompt log: %v", err)
+		}
+		l.trim()
+	}
+
+	// Rewrite the file with only the kept records so it doesn't grow forever
+	if err := l.rewrite(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Replace the prompt log file with the kept records and reopen it for
+// appending. The records go to a temporary file renamed over the log, so a
+// crash mid-write leaves the old file intact. Callers must hold l.mu (or
+// own l).
+func (l *promptLog) rewrite() error {
+	tmp := l.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error opening prompt log: %v", err)
+	}
+	for _, record := range l.records {
+		if err := writePromptRecord(file, record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("error saving prompt log: %v", err)
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file, err = os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening prompt log: %v", err)
+	}
+	l.lines = len(l.records)
+	return nil
+}
+
+func writePromptRecord(w io.Writer, record PromptRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Drop the oldest records over the limit. Callers must hold l.mu.
+func (l *promptLog) trim() {
+	if len(l.records) > l.limit {
+		l.records = l.records[len(l.records)-l.limit:]
+	}
+}
+
+// Add a record, giving it an ID and time if it has none
+func (l *promptLog) record(record PromptRecord) (PromptRecord, error) {
+	if l == nil {
+		return record, nil
+	}
+	if record.ID == "" {
+		record.ID = newMessageID()
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.db != nil {
+		return record, l.db.putPrompt(record, l.limit)
+	}
+	l.records = append(l.records, record)
+	l.trim()
+	if l.file == nil {
+		return record, nil
+	}
+	if err := writePromptRecord(l.file, record); err != nil {
+		return record, err
+	}
+	// Appending is cheap, so the dropped records are only cleared from the
+	// file once they make up half of it
+	if l.lines++; l.lines >= 2*l.limit {
+		return record, l.rewrite()
+	}
+	return record, nil
+}
+
+// Records newest first, optionally for one model, at most limit of them
+func (l *promptLog) list(model string, limit int) ([]PromptRecord, error) {
+	result := []PromptRecord{}
+	if l == nil {
+		return result, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.db != nil {
+		return l.db.prompts(model, limit)
+	}
+	for i := len(l.records) - 1; i >= 0 && len(result) < limit; i-- {
+		if model == "" || l.records[i].Model == model {
+			result = append(result, l.records[i])
+		}
+	}
+	return result, nil
+}
+
+// Look up a record by ID
+func (l *promptLog) get(id string) (PromptRecord, bool, error) {
+	if l == nil {
+		return PromptRecord{}, false, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.db != nil {
+		return l.db.prompt(id)
+	}
+	for _, record := range l.records {
+		if record.ID == id {
+			return record, true, nil
+		}
+	}
+	return PromptRecord{}, false, nil
+}
+
+// Log an LLM call
+func (agent *WeatherAgent) logPrompt(record PromptRecord, started time.Time, err error) PromptRecord {
+	record.Provider = agent.config.LLMProvider
+	record.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record, logErr := agent.prompts.record(record)
+	if logErr != nil {
+		agent.logger.Printf("Error saving prompt: %v", logErr)
+	}
+	return record
+}
+
+// Run a logged prompt again against another model of the configured
+// provider, with the configured sampling settings, and log the result
+func (agent *WeatherAgent) replayPrompt(id, model string) (PromptRecord, PromptRecord, error) {
+	original, ok, err := agent.prompts.get(id)
+	if err != nil {
+		return PromptRecord{}, PromptRecord{}, err
+	}
+	if !ok {
+		return PromptRecord{}, PromptRecord{}, fmt.Errorf("%w: %s", errPromptNotFound, id)
+	}
+	if original.Tools {
+		// The logged message leaves the data to the tools, which would now return different readings
+		return original, PromptRecord{}, fmt.Errorf("prompts answered with tools can't be replayed")
+	}
+	if !agent.llmConfigured() {
+		return original, PromptRecord{}, errNoLLMKey
+	}
+	if agent.overBudget() {
+		return original, PromptRecord{}, errLLMBudgetExceeded
+	}
+	provider, err := agent.llmClient()
+	if err != nil {
+		return original, PromptRecord{}, err
+	}
+
+	params := agent.llmParams()
+	if model != "" {
+		params.Model = model
+	}
+	started := time.Now()
+	response, usage, err := provider.complete(original.SystemPrompt, original.UserMessage, params)
+	if usage.InputTokens > 0 || usage.OutputTokens > 0 {
+		agent.recordLLMUsage(usage)
+	}
+	replay := agent.logPrompt(PromptRecord{
+		Model:        params.Model,
+		SystemPrompt: original.SystemPrompt,
+		UserMessage:  original.UserMessage,
+		Response:     response,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		ReplayOf:     original.ID,
+	}, started, err)
+	return original, replay, err
+}
+
+// GET /api/prompts[?model=&limit=50] lists logged prompts, newest first
+func (agent *WeatherAgent) handlePrompts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPromptListLimit {
+			apiError(w, fmt.Sprintf("limit must be 1-%d", maxPromptListLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	prompts, err := agent.prompts.list(r.URL.Query().Get("model"), limit)
+	if err != nil {
+		agent.logger.Printf("Error reading prompts: %v", err)
+		apiError(w, "Error reading prompts", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, PromptsResponse{
+		Enabled: agent.prompts != nil,
+		Prompts: prompts,
+	})
+}
+
+// GET /api/prompts/{id} returns one logged prompt
+func (agent *WeatherAgent) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	record, ok, err := agent.prompts.get(r.PathValue("id"))
+	if err != nil {
+		agent.logger.Printf("Error reading prompt: %v", err)
+		apiError(w, "Error reading prompt", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		apiError(w, "Prompt not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// POST /api/prompts/{id}/replay with {"model": "..."} re-runs a logged
+// prompt and returns the original next to the replay
+func (agent *WeatherAgent) handleReplayPrompt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ReplayRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil && err != io.EOF {
+		apiError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	original, replay, err := agent.replayPrompt(r.PathValue("id"), req.Model)
+	switch {
+	case errors.Is(err, errPromptNotFound):
+		apiError(w, "Prompt not found", http.StatusNotFound)
+		return
+	case original.ID == "":
+		agent.logger.Printf("Error reading prompt: %v", err)
+		apiError(w, "Error reading prompt", http.StatusInternalServerError)
+		return
+	case errors.Is(err, errLLMBudgetExceeded), errors.Is(err, errNoLLMKey):
+		apiError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case replay.ID == "":
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A failed call is still logged, so it's returned with its error
+	writeJSON(w, http.StatusOK, ReplayResponse{Original: original, Replay: replay})
+}
+
+// Replay a logged prompt from the command line:
+// weather-agent replay <prompt-id> [model]
+func runReplayCommand(agent *WeatherAgent, args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: weather-agent replay <prompt-id> [model]")
+	}
+	model := ""
+	if len(args) == 2 {
+		model = args[1]
+	}
+	original, replay, err := agent.replayPrompt(args[0], model)
+	if replay.ID == "" {
+		return err
+	}
+	fmt.Fprintf(out, "Original (%s, %d+%d tokens, %d ms):\n%s\n\n", original.Model, original.InputTokens, original.OutputTokens, original.LatencyMs, original.Response)
+	fmt.Fprintf(out, "Replay %s (%s, %d+%d tokens, %d ms):\n", replay.ID, replay.Model, replay.InputTokens, replay.OutputTokens, replay.LatencyMs)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return err
+	}
+	fmt.Fprintln(out, replay.Response)
+	return nil
+}
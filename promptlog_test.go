@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromptLogPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.jsonl")
+	log, err := newPromptLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, model := range []string{"model-a", "model-b", "model-a"} {
+		if _, err := log.record(PromptRecord{Model: model, UserMessage: "Weather?"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.file.Close()
+
+	reloaded, err := newPromptLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.file.Close()
+	all, _ := reloaded.list("", 10)
+	if len(all) != 2 || all[0].Model != "model-a" || all[1].Model != "model-b" {
+		t.Errorf("reloaded prompts = %+v, want the newest two, newest first", all)
+	}
+	if got, _ := reloaded.list("model-b", 10); len(got) != 1 {
+		t.Errorf("list(model-b) = %d prompts, want 1", len(got))
+	}
+	if _, ok, _ := reloaded.get(all[0].ID); !ok {
+		t.Errorf("get(%q) found nothing", all[0].ID)
+	}
+
+	if disabled, err := newPromptLog(path, 0); disabled != nil || err != nil {
+		t.Errorf("newPromptLog(limit 0) = %v, %v; want nil", disabled, err)
+	}
+}
+
+func TestPromptLogRewritesWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.jsonl")
+	log, err := newPromptLog(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { log.file.Close() }()
+
+	lines := func() int {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := log.record(PromptRecord{Model: "model-a", UserMessage: "Weather?"}); err != nil {
+			t.Fatal(err)
+		}
+		if n := lines(); n >= 6 {
+			t.Fatalf("after %d prompts the file holds %d, want under twice the limit", i+1, n)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// Records appended after a rewrite are kept across a restart
+	latest, _ := log.record(PromptRecord{Model: "model-b"})
+	reloaded, err := newPromptLog(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.file.Close()
+	if all, _ := reloaded.list("", 10); len(all) != 3 || all[0].ID != latest.ID {
+		t.Errorf("reloaded prompts = %+v, want the newest three", all)
+	}
+}
+
+func TestPromptReplay(t *testing.T) {
+	llm := &fakeLLM{reply: "Clear and cold."}
+	agent := newFixtureAgent(t, Config{LLMModel: "model-a"})
+	agent.llm = llm
+	agent.prompts, _ = newPromptLog("", 10)
+
+	if _, err := agent.callLLM("How cold is it?"); err != nil {
+		t.Fatal(err)
+	}
+	logged, _ := agent.prompts.list("", 1)
+	if len(logged) != 1 || logged[0].Model != "model-a" || logged[0].UserMessage != "How cold is it?" ||
+		logged[0].Response != "Clear and cold." || logged[0].OutputTokens == 0 {
+		t.Fatalf("logged prompt = %+v", logged)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/prompts/"+logged[0].ID+"/replay", strings.NewReader(`{"model":"model-b"}`))
+	req.SetPathValue("id", logged[0].ID)
+	rec := httptest.NewRecorder()
+	agent.handleReplayPrompt(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("replay status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		Original, Replay PromptRecord
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Original.ID != logged[0].ID || result.Replay.Model != "model-b" || result.Replay.ReplayOf != logged[0].ID {
+		t.Errorf("replay = %+v", result)
+	}
+	if llm.params.Model != "model-b" || llm.prompts[1] != "How cold is it?" {
+		t.Errorf("provider got model %q and prompt %q", llm.params.Model, llm.prompts[1])
+	}
+	if all, _ := agent.prompts.list("", 10); len(all) != 2 {
+		t.Errorf("%d prompts logged, want the replay logged too", len(all))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/prompts/missing/replay", strings.NewReader(`{}`))
+	req.SetPathValue("id", "missing")
+	rec = httptest.NewRecorder()
+	agent.handleReplayPrompt(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("replaying an unknown prompt: status %d, want 404", rec.Code)
+	}
+
+	tools, _ := agent.prompts.record(PromptRecord{Model: "model-a", Tools: true})
+	if _, _, err := agent.replayPrompt(tools.ID, ""); err == nil {
+		t.Error("replayPrompt() accepted a prompt answered with tools")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pushover message API settings
+const (
+	pushoverAPIURL     = "https://api.pushover.net/1/messages.json"
+	pushoverMaxTitle   = 250
+	pushoverMaxMessage = 1024
+	pushoverRetry      = 5 * time.Minute // How often emergency alerts repeat until acknowledged
+	pushoverExpire     = 2 * time.Hour   // How long emergency alerts keep repeating
+)
+
+// Pushover priorities
+const (
+	pushoverQuiet     = -1 // No sound or vibration
+	pushoverNormal    = 0
+	pushoverHigh      = 1 // Bypasses the user's quiet hours
+	pushoverEmergency = 2 // Repeats until acknowledged
+)
+
+// Application tokens and user/group keys are 30 letters and digits
+var pushoverKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]{30}$`)
+
+// Notifier that pushes the digest and alerts to a Pushover user or group
+type pushoverNotifier struct {
+	appToken string
+	userKey  string
+	apiURL   string
+	client   *http.Client
+}
+
+func newPushoverNotifier(appToken, userKey string) (*pushoverNotifier, error) {
+	if appToken == "" {
+		return nil, fmt.Errorf("Pushover application token is not configured")
+	}
+	if userKey == "" {
+		return nil, fmt.Errorf("Pushover user key is required")
+	}
+	if !pushoverKeyPattern.MatchString(appToken) {
+		return nil, fmt.Errorf("Pushover application token should be 30 letters and digits")
+	}
+	if !pushoverKeyPattern.MatchString(userKey) {
+		return nil, fmt.Errorf("Pushover user key should be 30 letters and digits")
+	}
+	return &pushoverNotifier{
+		appToken: appToken,
+		userKey:  userKey,
+		apiURL:   pushoverAPIURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *pushoverNotifier) Channel() string {
+	return ChannelPushover
+}
+
+func (p *pushoverNotifier) Target() string {
+	// A fingerprint rather than part of the key, which is a credential
+	sum := sha256.Sum256([]byte(p.userKey))
+	return "user " + hex.EncodeToString(sum[:4])
+}
+
+// Pushover only gets the scheduled digest and alerts
+func (p *pushoverNotifier) wants(notificationType string) bool {
+	return notificationType == NotificationDigest || notificationType == NotificationAlert
+}
+
+// Priority and sound for a notification. Alerts are louder the more severe
+// they are; alerts without a severity (threshold rules) count as moderate.
+func pushoverPriority(n Notification) (int, string) {
+	if n.Type != NotificationAlert {
+		return pushoverQuiet, ""
+	}
+	switch n.Severity {
+	case "extreme":
+		return pushoverEmergency, "persistent"
+	case "severe":
+		return pushoverHigh, "siren"
+	case "minor":
+		return pushoverNormal, "pushover"
+	default:
+		return pushoverNormal, "tugboat"
+	}
+}
+
+func (p *pushoverNotifier) Notify(n Notification) error {
+	priority, sound := pushoverPriority(n)
+
+	form := url.Values{}
+	form.Set("token", p.appToken)
+	form.Set("user", p.userKey)
+	form.Set("message", truncateRunes(n.Message, pushoverMaxMessage))
+	if n.Title != "" {
+		form.Set("title", truncateRunes(n.Title, pushoverMaxTitle))
+	}
+	form.Set("priority", strconv.Itoa(priority))
+	if sound != "" {
+		form.Set("sound", sound)
+	}
+	if priority == pushoverEmergency {
+		form.Set("retry", strconv.Itoa(int(pushoverRetry.Seconds())))
+		form.Set("expire", strconv.Itoa(int(pushoverExpire.Seconds())))
+	}
+	if !n.Time.IsZero() {
+		form.Set("timestamp", strconv.FormatInt(n.Time.Unix(), 10))
+	}
+	if n.EngagementURL != "" {
+		form.Set("url", n.EngagementURL)
+	}
+
+	resp, err := p.client.Post(p.apiURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("Pushover request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var result struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	json.Unmarshal(body, &result)
+	if resp.StatusCode != 200 || result.Status != 1 {
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("Pushover API error (status %d): %s", resp.StatusCode, strings.Join(result.Errors, "; "))
+		}
+		return fmt.Errorf("Pushover API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Shorten s to at most max characters, marking the cut with an ellipsis
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
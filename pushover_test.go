@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testPushoverToken = "azGDORePK8gMaC0QOYAMyEEuzJnyUi"
+	testPushoverUser  = "uQiRzpo4DXghDmr9QzzfQu27cmVRsG"
+)
+
+func TestNewPushoverNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		user    string
+		wantErr bool
+	}{
+		{"valid", testPushoverToken, testPushoverUser, false},
+		{"missing token", "", testPushoverUser, true},
+		{"missing user", testPushoverToken, "", true},
+		{"short token", "abc123", testPushoverUser, true},
+		{"bad user characters", testPushoverToken, "uQiRzpo4DXghDmr9QzzfQu27cmV-sG", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPushoverNotifier(tt.token, tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newPushoverNotifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPushoverPriority(t *testing.T) {
+	tests := []struct {
+		notification Notification
+		wantPriority int
+		wantSound    string
+	}{
+		{Notification{Type: NotificationDigest}, pushoverQuiet, ""},
+		{Notification{Type: NotificationAlert, Severity: "minor"}, pushoverNormal, "pushover"},
+		{Notification{Type: NotificationAlert, Severity: "moderate"}, pushoverNormal, "tugboat"},
+		{Notification{Type: NotificationAlert, AlertType: "rule"}, pushoverNormal, "tugboat"},
+		{Notification{Type: NotificationAlert, Severity: "severe"}, pushoverHigh, "siren"},
+		{Notification{Type: NotificationAlert, Severity: "extreme"}, pushoverEmergency, "persistent"},
+	}
+	for _, tt := range tests {
+		priority, sound := pushoverPriority(tt.notification)
+		if priority != tt.wantPriority || sound != tt.wantSound {
+			t.Errorf("pushoverPriority(%s/%q) = %d, %q, want %d, %q", tt.notification.Type, tt.notification.Severity,
+				priority, sound, tt.wantPriority, tt.wantSound)
+		}
+	}
+}
+
+func TestPushoverNotify(t *testing.T) {
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		forms = append(forms, r.PostForm)
+		if r.PostForm.Get("message") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"cannot be blank","errors":["message cannot be blank"],"status":0}`)
+			return
+		}
+		io.WriteString(w, `{"status":1,"request":"647d2300-702c-4b38-8b2f-d56326ae460b"}`)
+	}))
+	defer server.Close()
+
+	pushover, err := newPushoverNotifier(testPushoverToken, testPushoverUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushover.apiURL = server.URL
+	agent := &WeatherAgent{
+		logger:     log.New(io.Discard, "", 0),
+		deliveries: newDeliveryLog(),
+		notifiers:  []Notifier{pushover},
+	}
+
+	agent.notify(Notification{Type: NotificationDigest, Title: "Oslo today", Message: "Sunny, 18°C."})
+	agent.notify(Notification{Type: NotificationUpdate, Message: "Clouds rolling in."})
+	agent.notify(Notification{Type: NotificationAlert, Severity: "extreme", Title: "Oslo: Hurricane-force gusts", Message: strings.Repeat("x", 2000)})
+
+	if len(forms) != 2 {
+		t.Fatalf("got %d requests, want 2 (updates are skipped)", len(forms))
+	}
+	if f := forms[0]; f.Get("token") != testPushoverToken || f.Get("user") != testPushoverUser ||
+		f.Get("title") != "Oslo today" || f.Get("priority") != "-1" || f.Get("sound") != "" {
+		t.Errorf("digest form = %v", f)
+	}
+	if f := forms[1]; f.Get("priority") != "2" || f.Get("sound") != "persistent" || f.Get("retry") != "300" || f.Get("expire") != "7200" {
+		t.Errorf("alert form = %v", f)
+	}
+	if n := len([]rune(forms[1].Get("message"))); n != pushoverMaxMessage {
+		t.Errorf("message length = %d, want %d", n, pushoverMaxMessage)
+	}
+
+	err = pushover.Notify(Notification{Type: NotificationAlert})
+	if err == nil || !strings.Contains(err.Error(), "message cannot be blank") {
+		t.Errorf("Notify() error = %v, want the API's error", err)
+	}
+	if strings.Contains(err.Error(), testPushoverToken) {
+		t.Error("error leaks the application token")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Radar tile providers
+const (
+	RadarRainViewer     = "rainviewer"     // Free, no key, past and nowcast frames
+	RadarOpenWeatherMap = "openweathermap" // Current precipitation only, needs WEATHER_API_KEY
+	RadarOff            = "off"
+)
+
+// Radar settings
+const (
+	maxRadarZoom         = 12
+	radarFramesCacheTTL  = time.Minute // RainViewer publishes a new frame every 10 minutes
+	radarRainViewerIndex = "https://api.rainviewer.com/public/weather-maps.json"
+)
+
+// Returned for a tile request with no matching radar frame
+var errRadarFrameNotFound = errors.New("radar frame not found")
+
+// A radar image time the UI can animate through
+type RadarFrame struct {
+	Time    int64  `json:"time"`    // Unix time of the frame (0 for OpenWeatherMap's current layer)
+	Nowcast bool   `json:"nowcast"` // Extrapolated rather than observed
+	path    string // Provider tile path prefix
+}
+
+// Frames currently available from the configured provider, oldest first
+func (agent *WeatherAgent) radarFrames() ([]RadarFrame, error) {
+	if agent.config.RadarProvider == RadarOpenWeatherMap {
+		return []RadarFrame{{Time: 0}}, nil
+	}
+
+	body, _, err := agent.cachedGet(radarRainViewerIndex, radarFramesCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("radar frames request failed: %v", err)
+	}
+
+	var index struct {
+		Host  string `json:"host"`
+		Radar struct {
+			Past []struct {
+				Time int64  `json:"time"`
+				Path string `json:"path"`
+			} `json:"past"`
+			Nowcast []struct {
+				Time int64  `json:"time"`
+				Path string `json:"path"`
+			} `json:"nowcast"`
+		} `json:"radar"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse radar frames: %v", err)
+	}
+
+	frames := make([]RadarFrame, 0, len(index.Radar.Past)+len(index.Radar.Nowcast))
+	for _, f := range index.Radar.Past {
+		frames = append(frames, RadarFrame{Time: f.Time, path: index.Host + f.Path})
+	}
+	for _, f := range index.Radar.Nowcast {
+		frames = append(frames, RadarFrame{Time: f.Time, Nowcast: true, path: index.Host + f.Path})
+	}
+	return frames, nil
+}
+
+// Upstream URL for a tile. A zero frame time picks the latest observed frame.
+func (agent *WeatherAgent) radarTileURL(z, x, y int, frameTime int64) (string, error) {
+	if agent.config.RadarProvider == RadarOpenWeatherMap {
+		return fmt.Sprintf("https://tile.openweathermap.org/map/precipitation_new/%d/%d/%d.png?appid=%s",
+			z, x, y, agent.config.WeatherAPIKey), nil
+	}
+
+	frames, err := agent.radarFrames()
+	if err != nil {
+		return "", err
+	}
+	var frame *RadarFrame
+	for i := range frames {
+		if (frameTime == 0 && !frames[i].Nowcast) || frames[i].Time == frameTime {
+			frame = &frames[i]
+		}
+	}
+	if frame == nil {
+		return "", errRadarFrameNotFound
+	}
+	// 256px tiles, universal blue color scheme, smoothed, with snow shown separately
+	return fmt.Sprintf("%s/256/%d/%d/%d/2/1_1.png", frame.path, z, x, y), nil
+}
+
+// Parse and range-check tile coordinates from the request path
+func parseTileCoordinates(zs, xs, ys string) (int, int, int, error) {
+	z, errZ := strconv.Atoi(zs)
+	x, errX := strconv.Atoi(xs)
+	y, errY := strconv.Atoi(strings.TrimSuffix(ys, ".png"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > maxRadarZoom {
+		return 0, 0, 0, fmt.Errorf("invalid tile coordinates")
+	}
+	if n := 1 << z; x < 0 || x >= n || y < 0 || y >= n {
+		return 0, 0, 0, fmt.Errorf("tile out of range for zoom %d", z)
+	}
+	return z, x, y, nil
+}
+
+// Fetch a tile through the cache. Tiles skip the response archive and
+// aren't kept as stale fallbacks, since an outdated radar image misleads.
+func (agent *WeatherAgent) radarTile(tileURL string) ([]byte, error) {
+	key := cacheKeyPrefix + "radar:" + redactURL(tileURL, []string{agent.config.WeatherAPIKey})
+	if body, ok, err := agent.cache.Get(key); err != nil {
+		agent.logger.Printf("Cache read failed, fetching radar tile: %v", err)
+	} else if ok {
+		return body, nil
+	}
+
+	breaker := agent.breakers.get(providerForURL(tileURL))
+	if !breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	client := agent.httpClient(10 * time.Second)
+	resp, err := client.Get(tileURL)
+	if err != nil {
+		breaker.failure()
+		return nil, fmt.Errorf("radar tile request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			breaker.failure()
+		}
+		return nil, fmt.Errorf("radar tile API error (status %d)", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read radar tile: %v", err)
+	}
+	breaker.success()
+
+	ttl := time.Duration(agent.config.RadarCacheSeconds) * time.Second
+	if ttl > 0 {
+		if err := agent.cache.Set(key, body, ttl); err != nil {
+			agent.logger.Printf("Cache write failed: %v", err)
+		}
+	}
+	return body, nil
+}
+
+// GET /api/radar/frames lists the frames the UI can animate through
+func (agent *WeatherAgent) handleRadarFrames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if agent.config.RadarProvider == RadarOff {
+		apiError(w, "Radar is disabled", http.StatusNotFound)
+		return
+	}
+
+	frames, err := agent.radarFrames()
+	if err != nil {
+		agent.logger.Printf("Error fetching radar frames: %v", err)
+		apiError(w, "Unable to fetch radar frames", http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RadarFramesResponse{Provider: agent.config.RadarProvider, Frames: frames})
+}
+
+// GET /api/radar/{z}/{x}/{y}[?time=<frame time>] proxies a radar tile, so
+// provider keys never reach the browser
+func (agent *WeatherAgent) handleRadarTile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if agent.config.RadarProvider == RadarOff {
+		apiError(w, "Radar is disabled", http.StatusNotFound)
+		return
+	}
+
+	z, x, y, err := parseTileCoordinates(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"))
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var frameTime int64
+	if value := r.URL.Query().Get("time"); value != "" {
+		if frameTime, err = strconv.ParseInt(value, 10, 64); err != nil {
+			apiError(w, "Invalid time parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tileURL, err := agent.radarTileURL(z, x, y, frameTime)
+	if errors.Is(err, errRadarFrameNotFound) {
+		apiError(w, "Radar frame not found", http.StatusNotFound)
+		return
+	}
+	var tile []byte
+	if err == nil {
+		tile, err = agent.radarTile(tileURL)
+	}
+	if err != nil {
+		agent.logger.Printf("Error fetching radar tile %d/%d/%d: %v", z, x, y, err)
+		apiError(w, "Unable to fetch radar tile", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	// A past frame never changes once published, but the latest frame moves on
+	maxAge := agent.config.RadarCacheSeconds
+	if frameTime != 0 {
+		maxAge = 3600
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	w.Write(tile)
+}
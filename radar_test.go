@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestParseTileCoordinates(t *testing.T) {
+	tests := []struct {
+		z, x, y string
+		wantErr bool
+	}{
+		{"0", "0", "0", false},
+		{"3", "7", "5.png", false},
+		{"3", "8", "0", true},
+		{"-1", "0", "0", true},
+		{"13", "0", "0", true},
+		{"2", "a", "1", true},
+	}
+	for _, tt := range tests {
+		if _, _, _, err := parseTileCoordinates(tt.z, tt.x, tt.y); (err != nil) != tt.wantErr {
+			t.Errorf("parseTileCoordinates(%s, %s, %s) error = %v, wantErr %t", tt.z, tt.x, tt.y, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRadarTileURL(t *testing.T) {
+	cache := newMemoryCache()
+	cache.Set(cacheKeyPrefix+"upstream:"+radarRainViewerIndex, []byte(`{
+		"host": "https://tilecache.rainviewer.com",
+		"radar": {
+			"past": [{"time": 100, "path": "/v2/radar/100"}, {"time": 200, "path": "/v2/radar/200"}],
+			"nowcast": [{"time": 300, "path": "/v2/radar/nowcast_300"}]
+		}
+	}`), time.Hour)
+	agent := &WeatherAgent{
+		config: Config{RadarProvider: RadarRainViewer},
+		cache:  cache,
+		logger: log.New(io.Discard, "", 0),
+	}
+
+	tests := []struct {
+		frameTime int64
+		want      string
+	}{
+		{0, "https://tilecache.rainviewer.com/v2/radar/200/256/3/1/2/2/1_1.png"}, // Latest observed frame
+		{100, "https://tilecache.rainviewer.com/v2/radar/100/256/3/1/2/2/1_1.png"},
+		{300, "https://tilecache.rainviewer.com/v2/radar/nowcast_300/256/3/1/2/2/1_1.png"},
+	}
+	for _, tt := range tests {
+		got, err := agent.radarTileURL(3, 1, 2, tt.frameTime)
+		if err != nil || got != tt.want {
+			t.Errorf("radarTileURL(time=%d) = %q, %v, want %q", tt.frameTime, got, err, tt.want)
+		}
+	}
+	if _, err := agent.radarTileURL(3, 1, 2, 150); !errors.Is(err, errRadarFrameNotFound) {
+		t.Errorf("expected errRadarFrameNotFound for an unknown frame, got %v", err)
+	}
+
+	// OpenWeatherMap tiles carry the key, which must not end up in the cache key
+	agent.config = Config{RadarProvider: RadarOpenWeatherMap, WeatherAPIKey: "owm-secret", RadarCacheSeconds: 60}
+	tileURL, _ := agent.radarTileURL(3, 1, 2, 0)
+	cache.Set(cacheKeyPrefix+"radar:"+redactURL(tileURL, []string{"owm-secret"}), []byte("png"), time.Hour)
+	if tile, err := agent.radarTile(tileURL); err != nil || string(tile) != "png" {
+		t.Errorf("expected the cached tile, got %q, %v", tile, err)
+	}
+}
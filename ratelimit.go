@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token bucket state for a single client
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Per-IP token-bucket rate limiter for expensive endpoints
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens refilled per second
+	burst     float64 // maximum bucket size
+	proxyHops int     // trusted reverse proxies, whose X-Forwarded-For entries are honoured
+	buckets   map[string]*tokenBucket
+}
+
+// Create a rate limiter allowing perMinute requests with the given burst.
+// A perMinute value of 0 or less disables limiting.
+func newRateLimiter(perMinute, burst, proxyHops int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:      float64(perMinute) / 60.0,
+		burst:     float64(burst),
+		proxyHops: proxyHops,
+		buckets:   make(map[string]*tokenBucket),
+	}
+}
+
+// Check whether the client identified by key may make a request at time now.
+// Returns the time to wait before retrying when the request is refused.
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if rl.rate <= 0 {
+		return true, 0
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = bucket
+	}
+
+	// Refill tokens for the time elapsed since the last request
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed*rl.rate)
+	}
+	bucket.lastSeen = now
+
+	// Drop buckets that have been idle long enough to be full again
+	if len(rl.buckets) > 1024 {
+		rl.prune(now)
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+	return false, wait
+}
+
+// Remove idle buckets so the map doesn't grow without bound
+func (rl *rateLimiter) prune(now time.Time) {
+	fullAfter := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.lastSeen) > fullAfter {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Wrap a handler so that clients exceeding the limit receive 429 Too Many Requests
+func (rl *rateLimiter) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, rl.proxyHops)
+		ok, wait := rl.allow(ip, time.Now())
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+			apiError(w, "Rate limit exceeded, please try again later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Number of trusted reverse proxies, or 0 when proxy headers aren't trusted
+func (c Config) proxyHops() int {
+	if !c.TrustProxyHeaders {
+		return 0
+	}
+	return max(c.TrustedProxyHops, 1)
+}
+
+// Determine the client IP address for a request, behind proxyHops trusted
+// reverse proxies. Each proxy appends the address it saw to X-Forwarded-For,
+// so the client is the entry that many from the right; anything further left
+// came from the client and can't be trusted.
+func clientIP(r *http.Request, proxyHops int) string {
+	if proxyHops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(header, ",")...)
+		}
+		if len(entries) > 0 {
+			return strings.TrimSpace(entries[max(len(entries)-proxyHops, 0)])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
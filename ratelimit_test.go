@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := newRateLimiter(60, 2, 0) // one token per second, burst of two
+	now := time.Now()
+
+	// Burst is available immediately
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow("1.2.3.4", now); !ok {
+			t.Fatalf("request %d should be allowed within burst", i+1)
+		}
+	}
+
+	// Bucket is now empty
+	ok, wait := rl.allow("1.2.3.4", now)
+	if ok {
+		t.Fatal("request beyond burst should be refused")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("unexpected retry wait: %v", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := rl.allow("5.6.7.8", now); !ok {
+		t.Fatal("different client should not be limited")
+	}
+
+	// Tokens refill over time
+	if ok, _ := rl.allow("1.2.3.4", now.Add(1100*time.Millisecond)); !ok {
+		t.Fatal("request should be allowed after refill")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := newRateLimiter(0, 1, 0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if ok, _ := rl.allow("1.2.3.4", now); !ok {
+			t.Fatal("disabled limiter should allow all requests")
+		}
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rl := newRateLimiter(1, 1, 0)
+	handler := rl.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	codes := []int{http.StatusOK, http.StatusTooManyRequests}
+	for i, want := range codes {
+		req := httptest.NewRequest("GET", "/api/weather", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != want {
+			t.Fatalf("request %d: got status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+
+	if got := clientIP(req, 0); got != "10.0.0.1" {
+		t.Errorf("untrusted proxy: got %s, want 10.0.0.1", got)
+	}
+	if got := clientIP(req, 1); got != "10.0.0.2" {
+		t.Errorf("one trusted proxy: got %s, want 10.0.0.2", got)
+	}
+	if got := clientIP(req, 2); got != "203.0.113.7" {
+		t.Errorf("two trusted proxies: got %s, want 203.0.113.7", got)
+	}
+	if got := clientIP(req, 5); got != "203.0.113.7" {
+		t.Errorf("fewer entries than proxies: got %s, want 203.0.113.7", got)
+	}
+
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Real-IP", "203.0.113.8")
+	if got := clientIP(req, 1); got != "203.0.113.8" {
+		t.Errorf("X-Real-IP: got %s, want 203.0.113.8", got)
+	}
+}
+
+func TestRateLimiterIgnoresSpoofedForwardedFor(t *testing.T) {
+	rl := newRateLimiter(1, 1, 1)
+	handler := rl.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// The client prepends a new address each time; the proxy appends the real one
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/weather", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d, 203.0.113.7", i+1))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != want {
+			t.Fatalf("request %d: got status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Thresholds for recommendations, in metric units
+const (
+	umbrellaMaxWindKmh = 40 // Above this an umbrella turns inside out
+	sunscreenMinUV     = 3
+	windproofMinKmh    = 30
+	bikeGustLimitKmh   = 50
+)
+
+// Clothing and activity advice derived from the current conditions. The
+// scores run from 0 (stay in) to 10 (ideal).
+type Recommendations struct {
+	Layers    []string `json:"layers"`
+	Umbrella  bool     `json:"umbrella"`
+	Sunscreen bool     `json:"sunscreen"`
+	RunScore  int      `json:"run_score"`
+	BikeScore int      `json:"bike_score"`
+	Notes     []string `json:"notes,omitempty"`
+}
+
+// Conditions recommendations are computed from, in metric units
+type recommendConditions struct {
+	FeelsLikeC float64
+	WindKmh    float64
+	GustKmh    float64
+	Wet        bool // Rain, drizzle or showers now or within the nowcast window
+	Snow       bool
+	Thunder    bool
+	Fog        bool
+	UV         float64
+	Dark       bool
+}
+
+// Gather the conditions for a reading
+func recommendConditionsFor(weather WeatherResponse, system units.System) recommendConditions {
+	c := recommendConditions{
+		FeelsLikeC: units.TemperatureIn(weather.Main.FeelsLike, system).Celsius(),
+		WindKmh:    units.SpeedIn(weather.Wind.Speed, system).KilometersPerHour(),
+		GustKmh:    units.SpeedIn(weather.Wind.Gust, system).KilometersPerHour(),
+		UV:         weather.UVIndex,
+		Dark:       weather.IsDay == 0,
+		Wet:        weather.Rain.OneHour > 0,
+		Snow:       weather.Snow.OneHour > 0,
+	}
+	if len(weather.Weather) > 0 {
+		switch weather.Weather[0].Main {
+		case "Rain", "Drizzle":
+			c.Wet = true
+		case "Snow":
+			c.Snow = true
+		case "Thunderstorm":
+			c.Wet, c.Thunder = true, true
+		case "Fog":
+			c.Fog = true
+		}
+	}
+	if nc := weather.Nowcast; nc != nil && (nc.Trend == NowcastStarting || nc.Trend == NowcastContinuing) {
+		if nc.Kind == "snow" {
+			c.Snow = true
+		} else {
+			c.Wet = true
+		}
+	}
+	return c
+}
+
+// Points lost for a temperature outside [lo, hi], one per step degrees
+func comfortPenalty(temp, lo, hi, coldStep, heatStep float64) float64 {
+	switch {
+	case temp < lo:
+		return (lo - temp) / coldStep
+	case temp > hi:
+		return (temp - hi) / heatStep
+	}
+	return 0
+}
+
+// Clamp a score to 0-10 and round it
+func activityScore(penalty float64) int {
+	return int(math.Round(math.Max(0, math.Min(10, 10-penalty))))
+}
+
+// Compute recommendations from the conditions
+func recommend(c recommendConditions) Recommendations {
+	var rec Recommendations
+
+	switch {
+	case c.FeelsLikeC < -10:
+		rec.Layers = []string{"thermal base layer", "insulated parka", "hat and gloves"}
+	case c.FeelsLikeC < 0:
+		rec.Layers = []string{"warm base layer", "winter coat", "hat and gloves"}
+	case c.FeelsLikeC < 10:
+		rec.Layers = []string{"sweater", "warm jacket"}
+	case c.FeelsLikeC < 16:
+		rec.Layers = []string{"long sleeves", "light jacket"}
+	case c.FeelsLikeC < 22:
+		rec.Layers = []string{"long sleeves"}
+	default:
+		rec.Layers = []string{"t-shirt"}
+	}
+	if c.WindKmh >= windproofMinKmh && c.FeelsLikeC < 18 {
+		rec.Layers = append(rec.Layers, "windproof outer layer")
+	}
+	if c.Wet {
+		rec.Layers = append(rec.Layers, "waterproof jacket")
+	}
+	if c.Snow {
+		rec.Layers = append(rec.Layers, "waterproof boots")
+	}
+
+	if c.Wet {
+		if c.WindKmh < umbrellaMaxWindKmh && c.GustKmh < umbrellaMaxWindKmh*1.5 {
+			rec.Umbrella = true
+		} else {
+			rec.Notes = append(rec.Notes, "too windy for an umbrella, wear a hooded waterproof")
+		}
+	}
+	rec.Sunscreen = c.UV >= sunscreenMinUV && !c.Dark
+
+	// Running tolerates cold better than heat and shrugs off moderate wind
+	run := comfortPenalty(c.FeelsLikeC, 5, 18, 3, 2)
+	run += math.Max(0, c.WindKmh-25) / 10
+	if c.Wet {
+		run += 2
+	}
+	if c.Snow {
+		run += 4
+	}
+	if c.UV >= 8 && !c.Dark {
+		run += 2
+	}
+
+	// Cycling is more exposed to wind, wet roads, ice and poor visibility
+	bike := comfortPenalty(c.FeelsLikeC, 12, 24, 3, 3)
+	bike += math.Max(0, c.WindKmh-15) / 5
+	if c.GustKmh >= bikeGustLimitKmh {
+		bike += 3
+	}
+	if c.Wet {
+		bike += 4
+	}
+	if c.Snow {
+		bike += 6
+	}
+	if c.Fog {
+		bike += 2
+	}
+	if c.Dark {
+		bike++
+		rec.Notes = append(rec.Notes, "use lights if cycling")
+	}
+
+	rec.RunScore, rec.BikeScore = activityScore(run), activityScore(bike)
+	if c.Thunder {
+		rec.RunScore, rec.BikeScore = 0, 0
+		rec.Notes = append(rec.Notes, "thunderstorms: avoid outdoor exercise")
+	}
+	return rec
+}
+
+// Recommendations for a reading in the weather's units
+func (agent *WeatherAgent) recommendations(weather WeatherResponse) Recommendations {
+	return recommend(recommendConditionsFor(weather, agent.weatherUnits(weather)))
+}
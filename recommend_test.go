@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions recommendConditions
+		layers     []string
+		umbrella   bool
+		sunscreen  bool
+		run, bike  int
+	}{
+		{"mild and sunny", recommendConditions{FeelsLikeC: 18, WindKmh: 10, UV: 5},
+			[]string{"long sleeves"}, false, true, 10, 10},
+		{"cold and windy", recommendConditions{FeelsLikeC: -5, WindKmh: 35, GustKmh: 55},
+			[]string{"warm base layer", "winter coat", "hat and gloves", "windproof outer layer"}, false, false, 6, 0},
+		{"light rain", recommendConditions{FeelsLikeC: 12, WindKmh: 10, Wet: true},
+			[]string{"long sleeves", "light jacket", "waterproof jacket"}, true, false, 8, 6},
+		{"hot midday", recommendConditions{FeelsLikeC: 32, WindKmh: 5, UV: 9},
+			[]string{"t-shirt"}, false, true, 1, 7},
+		{"thunderstorm", recommendConditions{FeelsLikeC: 25, Wet: true, Thunder: true},
+			[]string{"t-shirt", "waterproof jacket"}, true, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		rec := recommend(tt.conditions)
+		if !reflect.DeepEqual(rec.Layers, tt.layers) {
+			t.Errorf("%s: layers %v, want %v", tt.name, rec.Layers, tt.layers)
+		}
+		if rec.Umbrella != tt.umbrella || rec.Sunscreen != tt.sunscreen {
+			t.Errorf("%s: umbrella %t sunscreen %t, want %t %t", tt.name, rec.Umbrella, rec.Sunscreen, tt.umbrella, tt.sunscreen)
+		}
+		if rec.RunScore != tt.run || rec.BikeScore != tt.bike {
+			t.Errorf("%s: run %d bike %d, want %d %d", tt.name, rec.RunScore, rec.BikeScore, tt.run, tt.bike)
+		}
+	}
+
+	// Rain in a gale gets a note instead of an umbrella
+	if rec := recommend(recommendConditions{FeelsLikeC: 10, WindKmh: 50, Wet: true}); rec.Umbrella || len(rec.Notes) == 0 {
+		t.Errorf("expected no umbrella in strong wind, got %+v", rec)
+	}
+}
+
+func TestRecommendConditionsFor(t *testing.T) {
+	weather := statusWeather("Drizzle", 1, 50)
+	weather.Main.FeelsLike = 50
+	weather.Wind.Speed = 10
+	c := recommendConditionsFor(weather, units.Imperial)
+	if !c.Wet || c.Dark || c.FeelsLikeC < 9.9 || c.FeelsLikeC > 10.1 || c.WindKmh < 16 || c.WindKmh > 16.2 {
+		t.Errorf("unexpected conditions %+v", c)
+	}
+
+	weather = statusWeather("Clouds", 0, 5)
+	weather.Nowcast = &Nowcast{Trend: NowcastStarting, Kind: "snow"}
+	if c := recommendConditionsFor(weather, units.Metric); !c.Snow || c.Wet || !c.Dark {
+		t.Errorf("expected snow from the nowcast at night, got %+v", c)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Shortest value treated as a secret; scrubbing shorter ones would mangle
+// ordinary log text
+const minSecretLength = 4
+
+// Name suffixes of Config fields holding credentials. Fields ending in URL
+// are checked for passwords in their user info instead.
+var secretFieldSuffixes = []string{"Key", "Keys", "Token", "Tokens", "Secret", "Password", "Webhook"}
+
+// Credentials in the config, longest first, including the forms they take
+// when escaped into URLs
+func (c Config) secrets() []string {
+	var found []string
+	add := func(secret string) {
+		if len(secret) < minSecretLength {
+			return
+		}
+		found = append(found, secret, url.QueryEscape(secret), url.PathEscape(secret))
+	}
+	collectSecrets(reflect.ValueOf(c), add)
+	// Basic auth users are "name:password"
+	for _, entry := range c.UIAuth.BasicUsers {
+		if _, password, ok := strings.Cut(entry, ":"); ok {
+			add(password)
+		}
+	}
+	// LLM gateway headers are "Name: value", often carrying the gateway's
+	// key, with any scheme such as "Bearer" before it
+	for _, entry := range c.LLMExtraHeaders {
+		if _, value, ok := strings.Cut(entry, ":"); ok {
+			value = os.ExpandEnv(strings.TrimSpace(value))
+			add(value)
+			if _, credential, ok := strings.Cut(value, " "); ok {
+				add(strings.TrimSpace(credential))
+			}
+		}
+	}
+
+	// Longest first, so a secret containing another is scrubbed whole
+	sort.Slice(found, func(i, j int) bool {
+		if len(found[i]) != len(found[j]) {
+			return len(found[i]) > len(found[j])
+		}
+		return found[i] < found[j]
+	})
+	secrets := found[:0]
+	for i, secret := range found {
+		if i == 0 || secret != found[i-1] {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// Walk a config struct, passing credential fields to add
+func collectSecrets(v reflect.Value, add func(string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field, name := v.Field(i), v.Type().Field(i).Name
+		switch {
+		case field.Kind() == reflect.Struct:
+			collectSecrets(field, add)
+		case strings.HasSuffix(name, "URL") && field.Kind() == reflect.String:
+			if u, err := url.Parse(field.String()); err == nil && u.User != nil {
+				password, _ := u.User.Password()
+				add(password)
+			}
+		case !hasSecretSuffix(name):
+		case field.Kind() == reflect.String:
+			add(field.String())
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			for j := 0; j < field.Len(); j++ {
+				add(field.Index(j).String())
+			}
+		}
+	}
+}
+
+func hasSecretSuffix(name string) bool {
+	for _, suffix := range secretFieldSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer scrubbing secrets from everything written through it. log.Logger
+// writes each entry in one call, so secrets are never split across writes.
+type redactingWriter struct {
+	w       io.Writer
+	secrets []string
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p), r.secrets)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Scrub the configured secrets from text, e.g. an error holding a request URL
+func (agent *WeatherAgent) redact(text string) string {
+	return redactSecrets(text, agent.secrets)
+}
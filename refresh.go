@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Refresh job statuses
+const (
+	RefreshCompleted = "completed"
+	RefreshFailed    = "failed"
+)
+
+// Result of a manual refresh run through /api/refresh
+type RefreshJob struct {
+	ID         string                 `json:"id"`
+	Status     string                 `json:"status"`
+	Forced     bool                   `json:"forced"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	DurationMS int64                  `json:"duration_ms"`
+	City       string                 `json:"city,omitempty"`
+	Country    string                 `json:"country,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	Severity      string `json:"severity,omitempty"` // Set once completed
+	SeverityColor string `json:"severity_color,omitempty"`
+}
+
+// Run a full fetch and message generation for the configured city now.
+// With force set, cached upstream responses and the LLM fingerprint cache
+// are bypassed, and their entries replaced with the fresh results.
+func (agent *WeatherAgent) refresh(force bool) RefreshJob {
+	job := RefreshJob{ID: newMessageID(), Forced: force, StartedAt: time.Now()}
+	finish := func(err error) RefreshJob {
+		job.FinishedAt = time.Now()
+		job.DurationMS = job.FinishedAt.Sub(job.StartedAt).Milliseconds()
+		job.Status = RefreshCompleted
+		if err != nil {
+			job.Status = RefreshFailed
+			job.Error = err.Error()
+		}
+		agent.logger.Printf("Manual refresh %s (force=%t) %s in %dms", job.ID, force, job.Status, job.DurationMS)
+		return job
+	}
+
+	weather, err := agent.fetchWeatherFresh(force)
+	if err != nil {
+		return finish(fmt.Errorf("error fetching weather: %v", err))
+	}
+	agent.recordWeather(weather)
+
+	historyContext := agent.generateHistoryContext(weather)
+	var message string
+	if force {
+		message, err = agent.refreshLLMMessage(weather, historyContext, agent.config.Persona, agent.llmParams())
+	} else {
+		message, err = agent.cachedLLMMessage(weather, historyContext, agent.config.Persona, agent.llmParams())
+	}
+	if err != nil {
+		return finish(fmt.Errorf("error generating LLM message: %v", err))
+	}
+	agent.setLastMessage(weatherLocationKey(weather), message)
+
+	job.City, job.Country = agent.location()
+	job.Message = message
+	job.Data = agent.prepareWeatherData(weather)
+	agent.markDegraded(weather, job.Data)
+	agent.addPlaylist(weather, job.Data)
+	job.Severity = dataSeverity(job.Data)
+	job.SeverityColor = severityColor(job.Severity)
+	return finish(nil)
+}
+
+// POST /api/refresh?force=true runs a refresh immediately and returns the job
+func (agent *WeatherAgent) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	force := false
+	if forceParam := r.URL.Query().Get("force"); forceParam != "" {
+		parsed, err := strconv.ParseBool(forceParam)
+		if err != nil {
+			apiError(w, "Invalid force parameter", http.StatusBadRequest)
+			return
+		}
+		force = parsed
+	}
+
+	// One refresh at a time; a second caller would only duplicate the work
+	if !agent.refreshing.TryLock() {
+		apiError(w, "A refresh is already in progress", http.StatusConflict)
+		return
+	}
+	job := agent.refresh(force)
+	agent.refreshing.Unlock()
+
+	status := http.StatusOK
+	if job.Status == RefreshFailed {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, job)
+}
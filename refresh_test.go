@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCachedGetRefreshBypassesCache(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprintf(w, "response %d", hits)
+	}))
+	defer server.Close()
+
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), cache: newMemoryCache()}
+
+	for i := 0; i < 2; i++ {
+		body, _, err := agent.cachedGet(server.URL, time.Minute, false)
+		if err != nil || string(body) != "response 1" {
+			t.Fatalf("cached fetch %d = %q, %v", i, body, err)
+		}
+	}
+
+	body, _, err := agent.cachedGet(server.URL, time.Minute, true)
+	if err != nil || string(body) != "response 2" || hits != 2 {
+		t.Fatalf("refresh = %q (%d upstream hits), %v", body, hits, err)
+	}
+
+	// The refreshed response replaces the cached one
+	body, _, _ = agent.cachedGet(server.URL, time.Minute, false)
+	if string(body) != "response 2" || hits != 2 {
+		t.Errorf("after refresh got %q (%d upstream hits)", body, hits)
+	}
+}
+
+func TestHandleRefreshValidation(t *testing.T) {
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0)}
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/api/refresh", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/refresh?force=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		agent.handleRefresh(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+
+	// A refresh that is already running isn't started twice
+	agent.refreshing.Lock()
+	rec := httptest.NewRecorder()
+	agent.handleRefresh(rec, httptest.NewRequest(http.MethodPost, "/api/refresh?force=true", nil))
+	agent.refreshing.Unlock()
+	if rec.Code != http.StatusConflict {
+		t.Errorf("concurrent refresh: got status %d, want 409", rec.Code)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report periods
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// Number of past years averaged for the climate normal
+const normalYears = 10
+
+// Maximum number of LLM messages quoted in a report
+const maxReportMessages = 5
+
+// Temperature extreme with when it occurred
+type ReportExtreme struct {
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Daily temperature summary for report charts
+type ReportDay struct {
+	Date string  `json:"date"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// Summary of observed weather over a week or month
+type ClimateReport struct {
+	Period          string        `json:"period"`
+	City            string        `json:"city"`
+	Country         string        `json:"country"`
+	Units           string        `json:"units"`
+	Start           time.Time     `json:"start"`
+	End             time.Time     `json:"end"`
+	Observations    int           `json:"observations"`
+	MaxTemp         ReportExtreme `json:"max_temp"`
+	MinTemp         ReportExtreme `json:"min_temp"`
+	MeanTemp        float64       `json:"mean_temp"`
+	MeanHumidity    float64       `json:"mean_humidity"`
+	MaxWind         ReportExtreme `json:"max_wind"`
+	PrecipTotal     float64       `json:"precipitation_total"`
+	Days            []ReportDay   `json:"days"`
+	NormalMeanTemp  *float64      `json:"normal_mean_temp,omitempty"` // Average of the same dates over previous years
+	Anomaly         *float64      `json:"anomaly,omitempty"`          // MeanTemp minus the normal
+	NotableMessages []string      `json:"notable_messages,omitempty"`
+	GeneratedAt     time.Time     `json:"generated_at"`
+}
+
+// The most recently completed report period before now
+func previousReportPeriod(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if period == ReportWeekly {
+		// Weeks run Monday to Sunday
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		end := today.AddDate(0, 0, -daysSinceMonday)
+		return end.AddDate(0, 0, -7), end
+	}
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return end.AddDate(0, -1, 0), end
+}
+
+// Summarize observations within [start, end)
+func buildClimateReport(period string, observations []Observation, start, end time.Time, loc *time.Location) (ClimateReport, error) {
+	report := ClimateReport{Period: period, Start: start, End: end, GeneratedAt: time.Now()}
+
+	var inPeriod []Observation
+	for _, obs := range observations {
+		if !obs.Time.Before(start) && obs.Time.Before(end) {
+			inPeriod = append(inPeriod, obs)
+		}
+	}
+	if len(inPeriod) == 0 {
+		return report, fmt.Errorf("no observations between %s and %s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+	sort.Slice(inPeriod, func(i, j int) bool { return inPeriod[i].Time.Before(inPeriod[j].Time) })
+
+	report.Observations = len(inPeriod)
+	report.City = inPeriod[len(inPeriod)-1].City
+	report.Country = inPeriod[len(inPeriod)-1].Country
+	report.MaxTemp = ReportExtreme{Value: inPeriod[0].Temp, Time: inPeriod[0].Time}
+	report.MinTemp = report.MaxTemp
+	report.MaxWind = ReportExtreme{Value: inPeriod[0].WindSpeed, Time: inPeriod[0].Time}
+
+	var tempSum, humiditySum float64
+	type dayAcc struct {
+		min, max, sum float64
+		n             int
+	}
+	days := make(map[string]*dayAcc)
+	var dayOrder []string
+
+	for i, obs := range inPeriod {
+		tempSum += obs.Temp
+		humiditySum += float64(obs.Humidity)
+		if obs.Temp > report.MaxTemp.Value {
+			report.MaxTemp = ReportExtreme{Value: obs.Temp, Time: obs.Time}
+		}
+		if obs.Temp < report.MinTemp.Value {
+			report.MinTemp = ReportExtreme{Value: obs.Temp, Time: obs.Time}
+		}
+		if obs.WindSpeed > report.MaxWind.Value {
+			report.MaxWind = ReportExtreme{Value: obs.WindSpeed, Time: obs.Time}
+		}
+
+		// Precipitation is reported as an hourly amount; weight it by the
+		// time until the next observation, capped at an hour
+		if i+1 < len(inPeriod) && obs.Precip > 0 {
+			gap := inPeriod[i+1].Time.Sub(obs.Time).Hours()
+			report.PrecipTotal += obs.Precip * math.Min(gap, 1)
+		}
+
+		date := obs.Time.In(loc).Format("2006-01-02")
+		acc, ok := days[date]
+		if !ok {
+			acc = &dayAcc{min: obs.Temp, max: obs.Temp}
+			days[date] = acc
+			dayOrder = append(dayOrder, date)
+		}
+		acc.min = math.Min(acc.min, obs.Temp)
+		acc.max = math.Max(acc.max, obs.Temp)
+		acc.sum += obs.Temp
+		acc.n++
+	}
+
+	report.MeanTemp = tempSum / float64(len(inPeriod))
+	report.MeanHumidity = humiditySum / float64(len(inPeriod))
+	for _, date := range dayOrder {
+		acc := days[date]
+		report.Days = append(report.Days, ReportDay{Date: date, Min: acc.min, Max: acc.max, Mean: acc.sum / float64(acc.n)})
+	}
+	return report, nil
+}
+
+// Set the climate normal and the period's anomaly against it
+func (r *ClimateReport) setNormal(normal float64) {
+	anomaly := r.MeanTemp - normal
+	r.NormalMeanTemp = &normal
+	r.Anomaly = &anomaly
+}
+
+// Average daily mean temperature for the same calendar dates over the
+// previous normalYears years, from the Open-Meteo historical archive
+func (agent *WeatherAgent) fetchTemperatureNormal(lat, lon float64, start, end time.Time) (float64, error) {
+	tempUnit := agent.units().OpenMeteoTemperatureUnit()
+
+	url := fmt.Sprintf("https://archive-api.open-meteo.com/v1/archive?latitude=%.4f&longitude=%.4f&start_date=%d-01-01&end_date=%d-12-31&daily=temperature_2m_mean&temperature_unit=%s&timezone=auto",
+		lat, lon, start.Year()-normalYears, start.Year()-1, tempUnit)
+
+	client := agent.httpClient(30 * time.Second)
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("archive request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("archive API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var archiveResp struct {
+		Daily struct {
+			Time []string   `json:"time"`
+			Mean []*float64 `json:"temperature_2m_mean"`
+		} `json:"daily"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&archiveResp); err != nil {
+		return 0, fmt.Errorf("failed to parse archive response: %v", err)
+	}
+
+	// Calendar days ("01-02") covered by the report period
+	wanted := make(map[string]bool)
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		wanted[d.Format("01-02")] = true
+	}
+
+	var sum float64
+	var n int
+	for i, date := range archiveResp.Daily.Time {
+		if i >= len(archiveResp.Daily.Mean) || archiveResp.Daily.Mean[i] == nil || len(date) < 10 {
+			continue
+		}
+		if wanted[date[5:]] {
+			sum += *archiveResp.Daily.Mean[i]
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("no historical data for the period")
+	}
+	return sum / float64(n), nil
+}
+
+// Alert and digest messages sent during the period, newest first
+func (agent *WeatherAgent) notableMessages(start, end time.Time) []string {
+	seen := make(map[string]bool)
+	var messages []string
+	for _, d := range agent.deliveries.list("", "", 0) {
+		if d.Time.Before(start) || !d.Time.Before(end) || d.Message == "" || seen[d.MessageID] {
+			continue
+		}
+		if d.Type != NotificationAlert && d.Type != NotificationDigest {
+			continue
+		}
+		seen[d.MessageID] = true
+		messages = append(messages, d.Message)
+		if len(messages) >= maxReportMessages {
+			break
+		}
+	}
+	return messages
+}
+
+// Points for an SVG polyline plotting values across a width x height box
+func chartPoints(values []float64, lo, hi, width, height float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := width / 2
+		if len(values) > 1 {
+			x = float64(i) * width / float64(len(values)-1)
+		}
+		y := height - (v-lo)/(hi-lo)*height
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// Render the report as a standalone HTML page with an inline SVG chart
+func renderReportHTML(report ClimateReport) ([]byte, error) {
+	tmpl, err := htmltemplate.New("report.html").Funcs(map[string]interface{}{
+		"tempUnit": unitSymbol,
+		"signed":   func(v float64) string { return fmt.Sprintf("%+.1f", v) },
+		"num":      func(v float64) string { return fmt.Sprintf("%.1f", v) },
+	}).ParseFiles("templates/report.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report template: %v", err)
+	}
+
+	var maxes, mins []float64
+	for _, d := range report.Days {
+		maxes = append(maxes, d.Max)
+		mins = append(mins, d.Min)
+	}
+	const chartWidth, chartHeight = 560.0, 160.0
+	data := struct {
+		ClimateReport
+		ChartWidth  float64
+		ChartHeight float64
+		MaxPoints   string
+		MinPoints   string
+	}{
+		ClimateReport: report,
+		ChartWidth:    chartWidth,
+		ChartHeight:   chartHeight,
+		MaxPoints:     chartPoints(maxes, report.MinTemp.Value, report.MaxTemp.Value, chartWidth, chartHeight),
+		MinPoints:     chartPoints(mins, report.MinTemp.Value, report.MaxTemp.Value, chartWidth, chartHeight),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render report: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Human-readable period title, e.g. "March 2024" or "Week of 4 March 2024"
+func (r ClimateReport) Title() string {
+	if r.Period == ReportWeekly {
+		return fmt.Sprintf("Week of %s", r.Start.Format("2 January 2006"))
+	}
+	return r.Start.Format("January 2006")
+}
+
+// Base file name for a stored report
+func reportBaseName(period string, start time.Time) string {
+	return fmt.Sprintf("%s-%s", period, start.Format("2006-01-02"))
+}
+
+// Build, store and send the report for the most recently completed period.
+// Returns the stored HTML path.
+func (agent *WeatherAgent) generateClimateReport(period string, now time.Time) (string, error) {
+	start, end := previousReportPeriod(period, now)
+	observations, err := agent.observations.since(start, "")
+	if err != nil {
+		return "", err
+	}
+	report, err := buildClimateReport(period, observations, start, end, now.Location())
+	if err != nil {
+		return "", err
+	}
+	report.Units = agent.config.Units
+
+	if lat, lon, err := agent.getCoordinates(agent.location()); err == nil {
+		if normal, err := agent.fetchTemperatureNormal(lat, lon, start, end); err != nil {
+			agent.logger.Printf("Climate normal unavailable: %v", err)
+		} else {
+			report.setNormal(normal)
+		}
+	}
+	report.NotableMessages = agent.notableMessages(start, end)
+
+	htmlReport, err := renderReportHTML(report)
+	if err != nil {
+		return "", err
+	}
+	pdfReport := renderReportPDF(report)
+
+	if err := os.MkdirAll(agent.config.ReportsDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating reports directory: %v", err)
+	}
+	base := filepath.Join(agent.config.ReportsDir, reportBaseName(period, start))
+	if err := os.WriteFile(base+".html", htmlReport, 0644); err != nil {
+		return "", fmt.Errorf("error saving report: %v", err)
+	}
+	if err := os.WriteFile(base+".pdf", pdfReport, 0644); err != nil {
+		return "", fmt.Errorf("error saving report: %v", err)
+	}
+
+	summary := fmt.Sprintf("%s: mean %.1f%s, high %.1f%s, low %.1f%s, %.1f mm precipitation.",
+		report.Title(), report.MeanTemp, unitSymbol(report.Units), report.MaxTemp.Value, unitSymbol(report.Units),
+		report.MinTemp.Value, unitSymbol(report.Units), report.PrecipTotal)
+	if report.Anomaly != nil {
+		summary += fmt.Sprintf(" That's %+.1f%s against the %d-year normal.", *report.Anomaly, unitSymbol(report.Units), normalYears)
+	}
+
+	agent.notify(Notification{
+		Type:    NotificationReport,
+		Title:   fmt.Sprintf("%s climate summary for %s - %s", strings.ToUpper(period[:1])+period[1:], report.City, report.Title()),
+		Message: summary,
+		City:    report.City,
+		Country: report.Country,
+		Units:   report.Units,
+		Attachments: []Attachment{
+			{Name: filepath.Base(base) + ".pdf", ContentType: "application/pdf", Data: pdfReport},
+			{Name: filepath.Base(base) + ".html", ContentType: "text/html; charset=UTF-8", Data: htmlReport},
+		},
+	})
+
+	return base + ".html", nil
+}
+
+// Generate any configured report whose latest period hasn't been stored yet, checking hourly
+func (agent *WeatherAgent) runReportScheduler(periods []string) {
+	for {
+		now := time.Now()
+		for _, period := range periods {
+			start, _ := previousReportPeriod(period, now)
+			path := filepath.Join(agent.config.ReportsDir, reportBaseName(period, start)+".html")
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+
+			if stored, err := agent.generateClimateReport(period, now); err != nil {
+				agent.logger.Printf("Error generating %s report: %v", period, err)
+			} else {
+				agent.logger.Printf("Generated %s report %s", period, stored)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// Stored report files, newest first
+func listStoredReports(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing reports: %v", err)
+	}
+
+	reports := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".html" || ext == ".pdf") {
+			reports = append(reports, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(reports)))
+	return reports, nil
+}
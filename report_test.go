@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviousReportPeriod(t *testing.T) {
+	// Wednesday 13 March 2024
+	now := time.Date(2024, 3, 13, 9, 30, 0, 0, time.UTC)
+
+	start, end := previousReportPeriod(ReportWeekly, now)
+	if start.Format("2006-01-02") != "2024-03-04" || end.Format("2006-01-02") != "2024-03-11" {
+		t.Errorf("weekly period = %s to %s", start, end)
+	}
+
+	start, end = previousReportPeriod(ReportMonthly, now)
+	if start.Format("2006-01-02") != "2024-02-01" || end.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("monthly period = %s to %s", start, end)
+	}
+}
+
+func TestBuildClimateReport(t *testing.T) {
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	observations := []Observation{
+		{Time: start.Add(-time.Hour), City: "Oslo", Temp: 50}, // Before the period
+		{Time: start.Add(6 * time.Hour), City: "Oslo", Temp: -4, Humidity: 80, WindSpeed: 12},
+		{Time: start.Add(7 * time.Hour), City: "Oslo", Temp: -2, Humidity: 70, Precip: 1.2},
+		{Time: start.Add(7*time.Hour + 30*time.Minute), City: "Oslo", Temp: 0, Humidity: 60, WindSpeed: 30},
+		{Time: start.Add(30 * time.Hour), City: "Oslo", Country: "NO", Temp: 3, Humidity: 50},
+	}
+
+	report, err := buildClimateReport(ReportMonthly, observations, start, end, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Observations != 4 || report.City != "Oslo" || report.Country != "NO" {
+		t.Errorf("unexpected report header %+v", report)
+	}
+	if report.MaxTemp.Value != 3 || report.MinTemp.Value != -4 {
+		t.Errorf("extremes = %v / %v", report.MaxTemp.Value, report.MinTemp.Value)
+	}
+	if report.MaxWind.Value != 30 {
+		t.Errorf("max wind = %v", report.MaxWind.Value)
+	}
+	if math.Abs(report.MeanTemp-(-0.75)) > 1e-9 || math.Abs(report.MeanHumidity-65) > 1e-9 {
+		t.Errorf("means = %v / %v", report.MeanTemp, report.MeanHumidity)
+	}
+	// 1.2 mm/h for the half hour until the next observation
+	if math.Abs(report.PrecipTotal-0.6) > 1e-9 {
+		t.Errorf("precipitation total = %v, want 0.6", report.PrecipTotal)
+	}
+	if len(report.Days) != 2 || report.Days[0].Max != 0 || report.Days[1].Min != 3 {
+		t.Errorf("daily summaries = %+v", report.Days)
+	}
+
+	if _, err := buildClimateReport(ReportMonthly, nil, start, end, time.UTC); err == nil {
+		t.Error("expected error for a period without observations")
+	}
+}
+
+func testReport() ClimateReport {
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	report := ClimateReport{
+		Period:          ReportMonthly,
+		City:            "Oslo",
+		Country:         "NO",
+		Units:           "metric",
+		Start:           start,
+		End:             start.AddDate(0, 1, 0),
+		Observations:    2,
+		MaxTemp:         ReportExtreme{Value: 3, Time: start.Add(30 * time.Hour)},
+		MinTemp:         ReportExtreme{Value: -4, Time: start.Add(6 * time.Hour)},
+		MeanTemp:        -0.5,
+		Days:            []ReportDay{{Date: "2024-02-01", Min: -4, Max: 0}, {Date: "2024-02-02", Min: 1, Max: 3}},
+		NotableMessages: []string{"Icy pavements (watch out)."},
+	}
+	report.setNormal(-2.25)
+	return report
+}
+
+func TestRenderReportHTML(t *testing.T) {
+	html, err := renderReportHTML(testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"February 2024", "&#43;1.8°C", "normal -2.2", "<polyline", "Icy pavements"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("report HTML missing %q", want)
+		}
+	}
+}
+
+func TestRenderReportPDF(t *testing.T) {
+	pdf := renderReportPDF(testReport())
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("output is not a complete PDF")
+	}
+
+	// The xref offset must point at the xref table
+	idx := bytes.LastIndex(pdf, []byte("startxref\n"))
+	var offset int
+	for _, c := range pdf[idx+len("startxref\n"):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		offset = offset*10 + int(c-'0')
+	}
+	if !bytes.HasPrefix(pdf[offset:], []byte("xref")) {
+		t.Errorf("startxref offset %d does not point at the xref table", offset)
+	}
+
+	// Parentheses are escaped and the degree sign uses WinAnsi octal
+	if !bytes.Contains(pdf, []byte(`\(watch out\)`)) {
+		t.Error("parentheses in text should be escaped")
+	}
+	if !bytes.Contains(pdf, []byte(`\260C`)) {
+		t.Error("degree sign should be encoded as \\260")
+	}
+}
+
+func TestEmailNotifierAttachments(t *testing.T) {
+	notifier, err := newEmailNotifier(SMTPConfig{Host: "smtp.example.com", Port: 25, From: "agent@example.com", Recipients: []string{"a@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []byte
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = msg
+		return nil
+	}
+
+	pdf := renderReportPDF(testReport())
+	err = notifier.Notify(Notification{
+		Type:        NotificationReport,
+		Title:       "Monthly climate summary",
+		Message:     "Mild month.",
+		Attachments: []Attachment{{Name: "monthly-2024-02-01.pdf", ContentType: "application/pdf", Data: pdf}},
+		Time:        time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(sent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("expected multipart/mixed, got %q", mediaType)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		types = append(types, partType)
+		if partType == "application/pdf" {
+			if part.FileName() != "monthly-2024-02-01.pdf" {
+				t.Errorf("attachment filename = %q", part.FileName())
+			}
+			body, _ := io.ReadAll(part)
+			decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+			if err != nil || !bytes.Equal(decoded, pdf) {
+				t.Error("attachment does not round-trip")
+			}
+		}
+	}
+	if strings.Join(types, ",") != "multipart/alternative,application/pdf" {
+		t.Errorf("unexpected parts %v", types)
+	}
+}
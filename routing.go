@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Alert severities from least to most severe, matching the CAP levels used by
+// official warnings
+var alertSeverities = []string{"minor", "moderate", "severe", "extreme"}
+
+// Alerts without a severity, such as threshold rules, count as moderate
+const defaultAlertSeverity = "moderate"
+
+// Channels NOTIFIER_ROUTES can name
+var routableChannels = []string{ChannelEmail, ChannelWebhook, ChannelPushover, ChannelMatrix, ChannelGoogleChat, ChannelTeams}
+
+// Which notifications a configured channel receives, replacing the channel's
+// defaults
+type notifierRoute struct {
+	Types       []string // Notification types delivered
+	MinSeverity string   // Least severe alert delivered (empty for all)
+}
+
+// Whether the route lets a notification through
+func (r notifierRoute) allows(n Notification) bool {
+	for _, t := range r.Types {
+		if t != n.Type {
+			continue
+		}
+		if n.Type != NotificationAlert || r.MinSeverity == "" {
+			return true
+		}
+		return alertSeverityLevel(n.Severity) >= alertSeverityLevel(r.MinSeverity)
+	}
+	return false
+}
+
+// Position of a severity in alertSeverities, unknown severities counting as
+// the default
+func alertSeverityLevel(severity string) int {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	for i, s := range alertSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return alertSeverityLevel(defaultAlertSeverity)
+}
+
+// Parse NOTIFIER_ROUTES entries like "pushover=alert>=severe" or
+// "matrix=update,alert", keyed by channel
+func parseNotifierRoutes(entries []string) (map[string]notifierRoute, error) {
+	routes := make(map[string]notifierRoute, len(entries))
+	for _, entry := range entries {
+		channel, types, ok := strings.Cut(entry, "=")
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if !ok || channel == "" {
+			return nil, fmt.Errorf("route %q should look like channel=type,type", entry)
+		}
+		if !containsString(routableChannels, channel) {
+			return nil, fmt.Errorf("unknown channel %q in route (use %s)", channel, strings.Join(routableChannels, ", "))
+		}
+		if _, dup := routes[channel]; dup {
+			return nil, fmt.Errorf("channel %q is routed twice", channel)
+		}
+
+		var route notifierRoute
+		for _, item := range strings.Split(types, ",") {
+			item = strings.ToLower(strings.TrimSpace(item))
+			if item == "" {
+				continue
+			}
+			notificationType, severity, hasSeverity := strings.Cut(item, ">=")
+			notificationType = strings.TrimSpace(notificationType)
+			switch notificationType {
+			case NotificationDigest, NotificationUpdate, NotificationAlert, NotificationReport:
+			default:
+				return nil, fmt.Errorf("unknown notification type %q for %s (use digest, update, alert or report)", notificationType, channel)
+			}
+			if hasSeverity {
+				severity = strings.TrimSpace(severity)
+				if notificationType != NotificationAlert {
+					return nil, fmt.Errorf("only alerts have a severity, got %q for %s", item, channel)
+				}
+				if !containsString(alertSeverities, severity) {
+					return nil, fmt.Errorf("unknown severity %q for %s (use %s)", severity, channel, strings.Join(alertSeverities, ", "))
+				}
+				route.MinSeverity = severity
+			}
+			route.Types = append(route.Types, notificationType)
+		}
+		if len(route.Types) == 0 {
+			return nil, fmt.Errorf("route for %s lists no notification types", channel)
+		}
+		routes[channel] = route
+	}
+	return routes, nil
+}
+
+// Whether a configured notifier receives a notification, by its route if it
+// has one and its own defaults otherwise
+func (agent *WeatherAgent) routeAllows(notifier Notifier, n Notification) bool {
+	if route, ok := agent.notifierRoutes[notifier.Channel()]; ok {
+		return route.allows(n)
+	}
+	if filter, ok := notifier.(interface{ wants(string) bool }); ok {
+		return filter.wants(n.Type)
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestParseNotifierRoutes(t *testing.T) {
+	routes, err := parseNotifierRoutes([]string{"pushover=alert>=severe", " Matrix = update, alert ", "teams=digest"})
+	if err != nil {
+		t.Fatalf("parseNotifierRoutes() error: %v", err)
+	}
+	if r := routes["pushover"]; len(r.Types) != 1 || r.Types[0] != NotificationAlert || r.MinSeverity != "severe" {
+		t.Errorf("pushover route = %+v", r)
+	}
+	if r := routes["matrix"]; strings.Join(r.Types, ",") != "update,alert" || r.MinSeverity != "" {
+		t.Errorf("matrix route = %+v", r)
+	}
+
+	invalid := []string{
+		"pushover",
+		"sms=alert",
+		"matrix=weekly",
+		"matrix=update>=severe",
+		"matrix=alert>=critical",
+		"matrix=",
+	}
+	for _, entry := range invalid {
+		if _, err := parseNotifierRoutes([]string{entry}); err == nil {
+			t.Errorf("parseNotifierRoutes(%q): expected error", entry)
+		}
+	}
+	if _, err := parseNotifierRoutes([]string{"teams=digest", "teams=alert"}); err == nil {
+		t.Error("parseNotifierRoutes() with a channel routed twice: expected error")
+	}
+}
+
+func TestNotifierRouteAllows(t *testing.T) {
+	route := notifierRoute{Types: []string{NotificationDigest, NotificationAlert}, MinSeverity: "severe"}
+	tests := []struct {
+		n    Notification
+		want bool
+	}{
+		{Notification{Type: NotificationDigest}, true},
+		{Notification{Type: NotificationUpdate}, false},
+		{Notification{Type: NotificationAlert, Severity: "extreme"}, true},
+		{Notification{Type: NotificationAlert, Severity: "severe"}, true},
+		{Notification{Type: NotificationAlert, Severity: "minor"}, false},
+		{Notification{Type: NotificationAlert}, false}, // Counts as moderate
+	}
+	for _, tt := range tests {
+		if got := route.allows(tt.n); got != tt.want {
+			t.Errorf("allows(%s/%q) = %v, want %v", tt.n.Type, tt.n.Severity, got, tt.want)
+		}
+	}
+}
+
+func TestRecipientNotifiersRouting(t *testing.T) {
+	pushover, _ := newPushoverNotifier(testPushoverToken, testPushoverUser)
+	matrix, _ := newMatrixNotifier("https://matrix.example.org", "syt_token", "!abc123:example.org")
+	teams, _ := newTeamsNotifier("https://example.webhook.office.com/webhookb2/abc")
+	routes, err := parseNotifierRoutes([]string{"pushover=alert>=severe", "matrix=update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &WeatherAgent{
+		logger:         log.New(io.Discard, "", 0),
+		notifiers:      []Notifier{pushover, matrix, teams},
+		notifierRoutes: routes,
+	}
+
+	channels := func(n Notification) string {
+		var names []string
+		for _, notifier := range agent.recipientNotifiers(n) {
+			names = append(names, notifier.Channel())
+		}
+		return strings.Join(names, ",")
+	}
+	tests := []struct {
+		n    Notification
+		want string
+	}{
+		{Notification{Type: NotificationDigest}, "teams"}, // Pushover's default would include it
+		{Notification{Type: NotificationUpdate}, "matrix"},
+		{Notification{Type: NotificationAlert, Severity: "moderate"}, ""},
+		{Notification{Type: NotificationAlert, Severity: "extreme"}, "pushover"},
+	}
+	for _, tt := range tests {
+		if got := channels(tt.n); got != tt.want {
+			t.Errorf("recipients of %s/%q = %q, want %q", tt.n.Type, tt.n.Severity, got, tt.want)
+		}
+	}
+
+	if !agent.hasRecipients(NotificationAlert) {
+		t.Error("hasRecipients(alert) = false, want true for severe alerts")
+	}
+	if agent.hasRecipients(NotificationReport) {
+		t.Error("hasRecipients(report) = true, but no channel is routed reports")
+	}
+}
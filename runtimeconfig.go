@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Settings changed at runtime through the UI, saved to RUNTIME_CONFIG_FILE
+// so they survive restarts. They override the environment.
+type runtimeSettings struct {
+	City      string    `json:"city,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Load saved runtime settings. A missing file means nothing was changed.
+func loadRuntimeSettings(path string) (runtimeSettings, error) {
+	var settings runtimeSettings
+	if path == "" {
+		return settings, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("error reading runtime config file: %v", err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing runtime config file: %v", err)
+	}
+	return settings, nil
+}
+
+// Write runtime settings to path via a temporary file
+func saveRuntimeSettings(path string, settings runtimeSettings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error saving runtime config: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// The configured city and country code, which /api/update-city can change
+// while requests are being served
+func (agent *WeatherAgent) location() (string, string) {
+	agent.locationMu.RLock()
+	defer agent.locationMu.RUnlock()
+	return agent.config.City, agent.config.CountryCode
+}
+
+// Switch the configured location. An empty country keeps the current one.
+// The change applies immediately and, with RUNTIME_CONFIG_FILE set, is saved;
+// an error means it could not be saved.
+func (agent *WeatherAgent) setLocation(city, country string) error {
+	agent.locationMu.Lock()
+	defer agent.locationMu.Unlock()
+
+	agent.config.City = strings.TrimSpace(city)
+	if country = strings.TrimSpace(country); country != "" {
+		agent.config.CountryCode = strings.ToUpper(country)
+	}
+	agent.logger.Printf("Location changed to %s, %s", agent.config.City, agent.config.CountryCode)
+
+	if agent.config.RuntimeConfigFile == "" {
+		return nil
+	}
+	return saveRuntimeSettings(agent.config.RuntimeConfigFile, runtimeSettings{
+		City:      agent.config.City,
+		Country:   agent.config.CountryCode,
+		UpdatedAt: time.Now(),
+	})
+}
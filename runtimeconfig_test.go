@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSetLocationPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runtime.json")
+	agent := &WeatherAgent{
+		config: Config{City: "London", CountryCode: "GB", RuntimeConfigFile: path},
+		logger: log.New(io.Discard, "", 0),
+	}
+
+	if err := agent.setLocation(" Lyon ", "fr"); err != nil {
+		t.Fatal(err)
+	}
+	if city, country := agent.location(); city != "Lyon" || country != "FR" {
+		t.Errorf("location() = %s, %s, want Lyon, FR", city, country)
+	}
+
+	// An empty country keeps the current one
+	if err := agent.setLocation("Paris", ""); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := loadRuntimeSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.City != "Paris" || settings.Country != "FR" || settings.UpdatedAt.IsZero() {
+		t.Errorf("saved settings = %+v", settings)
+	}
+}
+
+func TestLoadRuntimeSettings(t *testing.T) {
+	dir := t.TempDir()
+	if settings, err := loadRuntimeSettings(filepath.Join(dir, "missing.json")); err != nil || settings.City != "" {
+		t.Errorf("missing file: got %+v, %v", settings, err)
+	}
+	if settings, err := loadRuntimeSettings(""); err != nil || settings.City != "" {
+		t.Errorf("no file configured: got %+v, %v", settings, err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte("{not json"), 0600)
+	if _, err := loadRuntimeSettings(bad); err == nil {
+		t.Error("malformed file: expected error")
+	}
+}
+
+func TestLocationConcurrentAccess(t *testing.T) {
+	agent := &WeatherAgent{config: Config{City: "London", CountryCode: "GB"}, logger: log.New(io.Discard, "", 0)}
+
+	// Run with -race: readers and a writer share the location
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			agent.setLocation("Oslo", "NO")
+		}()
+		go func() {
+			defer wg.Done()
+			if city, _ := agent.location(); city != "London" && city != "Oslo" {
+				t.Errorf("location() = %q", city)
+			}
+		}()
+	}
+	wg.Wait()
+}
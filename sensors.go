@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+const (
+	maxSensorReadings  = 288              // Per sensor: a day of 5-minute readings
+	maxSensors         = 64               // Distinct sensor names accepted
+	maxSensorClockSkew = 5 * time.Minute  // How far ahead of ours a sensor's clock may run
+	sensorFreshness    = 30 * time.Minute // Older readings aren't given to the LLM
+	maxSensorName      = 64
+	stuffyCO2          = 1000 // ppm above which a room feels stuffy
+)
+
+var errTooManySensors = fmt.Errorf("too many sensors (max %d)", maxSensors)
+
+// A reading from an indoor sensor. Values the sensor doesn't measure are nil.
+type SensorReading struct {
+	Sensor      string    `json:"sensor"`
+	Time        time.Time `json:"time"`
+	Temperature *float64  `json:"temperature,omitempty"` // °C
+	Humidity    *float64  `json:"humidity,omitempty"`    // %
+	CO2         *float64  `json:"co2,omitempty"`         // ppm
+	PM25        *float64  `json:"pm2_5,omitempty"`       // μg/m³
+}
+
+// Readings per sensor, oldest first, kept in memory or in a database
+// shared with other replicas
+type sensorStore struct {
+	mu       sync.Mutex
+	readings map[string][]SensorReading
+	db       storage // Used instead of readings when set
+}
+
+func newSensorStore() *sensorStore {
+	return &sensorStore{readings: make(map[string][]SensorReading)}
+}
+
+// Create a store keeping readings in a database
+func newDatabaseSensorStore(db storage) *sensorStore {
+	return &sensorStore{db: db}
+}
+
+// Store a reading, stamping it with the current time if it has none.
+// Backdated readings are slotted in by time, so they never become a
+// sensor's latest.
+func (s *sensorStore) record(reading SensorReading) (SensorReading, error) {
+	if reading.Time.IsZero() {
+		reading.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db != nil {
+		names, err := s.db.sensorNames()
+		if err != nil {
+			return reading, err
+		}
+		if len(names) >= maxSensors && !slices.Contains(names, reading.Sensor) {
+			return reading, errTooManySensors
+		}
+		return reading, s.db.putSensorReading(reading, maxSensorReadings)
+	}
+
+	readings, known := s.readings[reading.Sensor]
+	if !known && len(s.readings) >= maxSensors {
+		return reading, errTooManySensors
+	}
+	i := sort.Search(len(readings), func(i int) bool { return readings[i].Time.After(reading.Time) })
+	readings = slices.Insert(readings, i, reading)
+	if len(readings) > maxSensorReadings {
+		readings = readings[len(readings)-maxSensorReadings:]
+	}
+	s.readings[reading.Sensor] = readings
+	return reading, nil
+}
+
+// The latest reading of each sensor since t, by sensor name
+func (s *sensorStore) latest(t time.Time) ([]SensorReading, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []SensorReading
+	if s.db != nil {
+		readings, err := s.db.sensorReadingsSince(t, "")
+		if err != nil {
+			return nil, err
+		}
+		last := make(map[string]SensorReading)
+		for _, reading := range readings {
+			last[reading.Sensor] = reading
+		}
+		for _, reading := range last {
+			result = append(result, reading)
+		}
+	} else {
+		for _, readings := range s.readings {
+			if last := readings[len(readings)-1]; !last.Time.Before(t) {
+				result = append(result, last)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Sensor < result[j].Sensor })
+	return result, nil
+}
+
+// A sensor's readings since t, oldest first
+func (s *sensorStore) since(sensor string, t time.Time) ([]SensorReading, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db != nil {
+		return s.db.sensorReadingsSince(t, sensor)
+	}
+	var result []SensorReading
+	for _, reading := range s.readings[sensor] {
+		if !reading.Time.Before(t) {
+			result = append(result, reading)
+		}
+	}
+	return result, nil
+}
+
+// Turn a request into a reading, accepting AirGradient's local API field
+// names (atmp, rhum, rco2, pm02) alongside the documented ones so its
+// JSON can be posted as is
+func (req IngestRequest) reading() (SensorReading, error) {
+	reading := SensorReading{
+		Sensor:      strings.TrimSpace(req.Sensor),
+		Temperature: firstValue(req.Temperature, req.ATmp),
+		Humidity:    firstValue(req.Humidity, req.RHum),
+		CO2:         firstValue(req.CO2, req.RCO2),
+		PM25:        firstValue(req.PM25, req.PM02),
+	}
+	if reading.Sensor == "" {
+		reading.Sensor = strings.TrimSpace(req.SerialNo)
+	}
+	if req.Time != nil {
+		reading.Time = *req.Time
+	}
+
+	switch {
+	case reading.Time.After(time.Now().Add(maxSensorClockSkew)):
+		return reading, fmt.Errorf("time is in the future")
+	case reading.Sensor == "":
+		return reading, fmt.Errorf("sensor is required")
+	case len(reading.Sensor) > maxSensorName:
+		return reading, fmt.Errorf("sensor name is too long (max %d characters)", maxSensorName)
+	case reading.Temperature == nil && reading.Humidity == nil && reading.CO2 == nil && reading.PM25 == nil:
+		return reading, fmt.Errorf("no readings given (temperature, humidity, co2 or pm2_5)")
+	}
+	ranges := []struct {
+		name     string
+		value    *float64
+		min, max float64
+	}{
+		{"temperature", reading.Temperature, -50, 70},
+		{"humidity", reading.Humidity, 0, 100},
+		{"co2", reading.CO2, 0, 40000},
+		{"pm2_5", reading.PM25, 0, 2000},
+	}
+	for _, r := range ranges {
+		if r.value != nil && (math.IsNaN(*r.value) || *r.value < r.min || *r.value > r.max) {
+			return reading, fmt.Errorf("%s must be between %g and %g, got %g", r.name, r.min, r.max, *r.value)
+		}
+	}
+	return reading, nil
+}
+
+func firstValue(values ...*float64) *float64 {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// Format a reading for the LLM, e.g. "living room: 21.5°C, 45% humidity, CO2 650 ppm"
+func describeSensorReading(reading SensorReading, system units.System) string {
+	var parts []string
+	if reading.Temperature != nil {
+		parts = append(parts, units.Celsius(*reading.Temperature).Format(system))
+	}
+	if reading.Humidity != nil {
+		parts = append(parts, fmt.Sprintf("%.0f%% humidity", *reading.Humidity))
+	}
+	if reading.CO2 != nil {
+		parts = append(parts, fmt.Sprintf("CO2 %.0f ppm", *reading.CO2))
+	}
+	if reading.PM25 != nil {
+		parts = append(parts, fmt.Sprintf("PM2.5 %.1f μg/m³", *reading.PM25))
+	}
+	return reading.Sensor + ": " + strings.Join(parts, ", ")
+}
+
+// Outdoor PM2.5 from IQAir or OpenWeatherMap, if reported
+func outdoorPM25(weather WeatherResponse) (float64, bool) {
+	if weather.IQAirData.AQI > 0 {
+		return weather.IQAirData.PM25, true
+	}
+	if len(weather.AQI.List) > 0 {
+		return weather.AQI.List[0].Components.PM2_5, true
+	}
+	return 0, false
+}
+
+// Fresh readings of the indoor sensors, for the configured location only
+func (agent *WeatherAgent) indoorReadings(weather WeatherResponse, now time.Time) []SensorReading {
+	if agent.sensors == nil {
+		return nil
+	}
+	if city, _ := agent.location(); !strings.EqualFold(city, weather.Name) {
+		return nil
+	}
+	readings, err := agent.sensors.latest(now.Add(-sensorFreshness))
+	if err != nil {
+		agent.logger.Printf("Error reading indoor sensors: %v", err)
+		return nil
+	}
+	return readings
+}
+
+// A reading bucketed like the outdoor values in weatherFingerprint
+func sensorFingerprint(reading SensorReading) string {
+	bucket := func(value *float64, step float64) string {
+		if value == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f", roundTo(*value, step))
+	}
+	return strings.Join([]string{
+		bucket(reading.Temperature, 1),
+		bucket(reading.Humidity, 10),
+		bucket(reading.PM25, 5),
+		fmt.Sprintf("%t", reading.CO2 != nil && *reading.CO2 >= stuffyCO2),
+	}, "/")
+}
+
+// Add recent indoor sensor readings and how they compare with outside.
+// Sensors are in the home, so only the configured location gets them.
+func (agent *WeatherAgent) addIndoorData(weather WeatherResponse, data map[string]interface{}, now time.Time) {
+	readings := agent.indoorReadings(weather, now)
+	if len(readings) == 0 {
+		return
+	}
+
+	system := agent.weatherUnits(weather)
+	indoor := make([]string, 0, len(readings))
+	var temps, humidities, pm []float64
+	maxCO2 := 0.0
+	for _, reading := range readings {
+		indoor = append(indoor, describeSensorReading(reading, system))
+		if reading.Temperature != nil {
+			temps = append(temps, units.Celsius(*reading.Temperature).In(system))
+		}
+		if reading.Humidity != nil {
+			humidities = append(humidities, *reading.Humidity)
+		}
+		if reading.PM25 != nil {
+			pm = append(pm, *reading.PM25)
+		}
+		if reading.CO2 != nil {
+			maxCO2 = math.Max(maxCO2, *reading.CO2)
+		}
+	}
+	data["indoor"] = indoor
+
+	var contrast []string
+	if len(temps) > 0 {
+		diff := mean(temps) - weather.Main.Temp
+		contrast = append(contrast, fmt.Sprintf("%.1f%s %s inside", math.Abs(diff), system.TemperatureSymbol(), warmerOrCooler(diff)))
+	}
+	if len(humidities) > 0 {
+		contrast = append(contrast, fmt.Sprintf("%.0f%% humidity inside vs %d%% outside", mean(humidities), weather.Main.Humidity))
+	}
+	if outdoor, ok := outdoorPM25(weather); ok && len(pm) > 0 {
+		contrast = append(contrast, fmt.Sprintf("PM2.5 %.1f μg/m³ inside vs %.1f outside", mean(pm), outdoor))
+	}
+	if maxCO2 >= stuffyCO2 {
+		contrast = append(contrast, fmt.Sprintf("CO2 is %.0f ppm, so the air inside is stuffy", maxCO2))
+	}
+	if len(contrast) > 0 {
+		data["indoor_vs_outdoor"] = strings.Join(contrast, "; ")
+	}
+}
+
+func warmerOrCooler(diff float64) string {
+	if diff < 0 {
+		return "cooler"
+	}
+	return "warmer"
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// POST /api/ingest with {"sensor": "living room", "temperature": 21.5, ...}
+// records a reading from a local sensor; GET lists each sensor's latest
+// reading, or ?sensor='s readings for the last day
+func (agent *WeatherAgent) handleIngest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		since := time.Now().Add(-24 * time.Hour)
+		var readings []SensorReading
+		var err error
+		if sensor := r.URL.Query().Get("sensor"); sensor != "" {
+			readings, err = agent.sensors.since(sensor, since)
+		} else {
+			readings, err = agent.sensors.latest(since)
+		}
+		if err != nil {
+			agent.logger.Printf("Error reading indoor sensors: %v", err)
+			apiError(w, "Unable to read sensors", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, SensorsResponse{Readings: nonNil(readings)})
+		return
+	case http.MethodPost:
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req IngestRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+		apiError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	reading, err := req.reading()
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reading, err = agent.sensors.record(reading)
+	if errors.Is(err, errTooManySensors) {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		agent.logger.Printf("Error saving sensor reading: %v", err)
+		apiError(w, "Unable to save reading", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, reading)
+}
+
+func nonNil(readings []SensorReading) []SensorReading {
+	if readings == nil {
+		return []SensorReading{}
+	}
+	return readings
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleIngest(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+	agent.sensors = newSensorStore()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"reading", `{"sensor":"living room","temperature":21.5,"humidity":45,"co2":650}`, http.StatusCreated},
+		{"airgradient", `{"serialno":"ecda3b1eaaaf","rco2":1180,"pm02":7,"atmp":24.2,"rhum":52,"wifi":-46}`, http.StatusCreated},
+		{"no sensor", `{"temperature":21.5}`, http.StatusBadRequest},
+		{"no values", `{"sensor":"attic"}`, http.StatusBadRequest},
+		{"humidity out of range", `{"sensor":"attic","humidity":140}`, http.StatusBadRequest},
+		{"name too long", `{"sensor":"` + strings.Repeat("x", maxSensorName+1) + `","co2":500}`, http.StatusBadRequest},
+		{"in the future", `{"sensor":"attic","co2":500,"time":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`, http.StatusBadRequest},
+		{"not JSON", `temperature=21`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		agent.handleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	agent.handleIngest(rec, httptest.NewRequest(http.MethodGet, "/api/ingest", nil))
+	var resp SensorsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Readings) != 2 || resp.Readings[0].Sensor != "ecda3b1eaaaf" || *resp.Readings[0].CO2 != 1180 || resp.Readings[1].PM25 != nil {
+		t.Errorf("readings = %+v", resp.Readings)
+	}
+}
+
+func TestAddIndoorData(t *testing.T) {
+	now := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	value := func(v float64) *float64 { return &v }
+	agent := newFixtureAgent(t, Config{})
+	agent.sensors = newSensorStore()
+	agent.sensors.record(SensorReading{Sensor: "bedroom", Time: now.Add(-5 * time.Minute), Temperature: value(19), CO2: value(1250)})
+	agent.sensors.record(SensorReading{Sensor: "office", Time: now.Add(-10 * time.Minute), Temperature: value(21), Humidity: value(40), PM25: value(3)})
+	agent.sensors.record(SensorReading{Sensor: "garage", Time: now.Add(-2 * time.Hour), Temperature: value(4)}) // Stale
+
+	weather := WeatherResponse{Name: "Oslo"}
+	weather.Main.Temp = -4
+	weather.Main.Humidity = 85
+	weather.IQAirData.AQI = 30
+	weather.IQAirData.PM25 = 8
+
+	data := map[string]interface{}{}
+	agent.addIndoorData(weather, data, now)
+	indoor, _ := data["indoor"].([]string)
+	if len(indoor) != 2 || indoor[0] != "bedroom: 19.0°C, CO2 1250 ppm" || indoor[1] != "office: 21.0°C, 40% humidity, PM2.5 3.0 μg/m³" {
+		t.Errorf("indoor = %q", indoor)
+	}
+	want := "24.0°C warmer inside; 40% humidity inside vs 85% outside; PM2.5 3.0 μg/m³ inside vs 8.0 outside; CO2 is 1250 ppm, so the air inside is stuffy"
+	if data["indoor_vs_outdoor"] != want {
+		t.Errorf("indoor_vs_outdoor = %q, want %q", data["indoor_vs_outdoor"], want)
+	}
+
+	// Sensors are in the home, not wherever else the weather is for
+	data = map[string]interface{}{}
+	agent.addIndoorData(WeatherResponse{Name: "Bergen"}, data, now)
+	if _, ok := data["indoor"]; ok {
+		t.Error("indoor readings added for another city")
+	}
+}
+
+func TestSensorStoreRecord(t *testing.T) {
+	now := time.Now()
+	co2 := func(v float64) SensorReading {
+		return SensorReading{Sensor: "office", CO2: &v}
+	}
+	store := newSensorStore()
+	reading := co2(600)
+	reading.Time = now
+	store.record(reading)
+
+	// A backdated reading goes into the history without replacing the latest
+	backdated := co2(900)
+	backdated.Time = now.Add(-time.Hour)
+	store.record(backdated)
+	latest, _ := store.latest(now.Add(-2 * time.Hour))
+	if len(latest) != 1 || *latest[0].CO2 != 600 {
+		t.Errorf("latest = %+v", latest)
+	}
+	if history, _ := store.since("office", time.Time{}); len(history) != 2 || *history[0].CO2 != 900 {
+		t.Errorf("history = %+v", history)
+	}
+
+	for i := len(store.readings); i < maxSensors; i++ {
+		if _, err := store.record(SensorReading{Sensor: fmt.Sprintf("sensor %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.record(SensorReading{Sensor: "one too many"}); !errors.Is(err, errTooManySensors) {
+		t.Errorf("sensor past the limit: got %v", err)
+	}
+	if _, err := store.record(co2(700)); err != nil {
+		t.Errorf("known sensor past the limit: %v", err)
+	}
+}
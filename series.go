@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Limits and defaults for /api/history series options
+const (
+	defaultSeriesMaxGap = 2 * time.Hour
+	minSeriesStep       = time.Minute
+	maxSeriesStep       = 24 * time.Hour
+	maxSmoothingWindow  = 25
+)
+
+// How a charted observation series is post-processed
+type seriesOptions struct {
+	Step   time.Duration // Resample to this interval with linear interpolation (0 disables)
+	Window int           // Centered moving-average window in points (0 or 1 disables)
+	MaxGap time.Duration // Readings further apart than this are a gap and never bridged
+}
+
+// Parse ?interpolate=15m&smooth=5&max_gap=2h
+func parseSeriesOptions(query url.Values) (seriesOptions, error) {
+	opts := seriesOptions{MaxGap: defaultSeriesMaxGap}
+
+	if value := query.Get("interpolate"); value != "" {
+		step, err := time.ParseDuration(value)
+		if err != nil || step < minSeriesStep || step > maxSeriesStep {
+			return opts, fmt.Errorf("invalid interpolate parameter (a duration from %s to %s)", minSeriesStep, maxSeriesStep)
+		}
+		opts.Step = step
+	}
+	if value := query.Get("smooth"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil || window < 1 || window > maxSmoothingWindow {
+			return opts, fmt.Errorf("invalid smooth parameter (1-%d points)", maxSmoothingWindow)
+		}
+		opts.Window = window
+	}
+	if value := query.Get("max_gap"); value != "" {
+		gap, err := time.ParseDuration(value)
+		if err != nil || gap <= 0 {
+			return opts, fmt.Errorf("invalid max_gap parameter (a positive duration)")
+		}
+		opts.MaxGap = gap
+	}
+	return opts, nil
+}
+
+// Apply the options to observations (oldest first), handling each city's
+// series separately and merging the results back in time order
+func applySeriesOptions(observations []Observation, opts seriesOptions) []Observation {
+	if opts.Step == 0 && opts.Window <= 1 {
+		return observations
+	}
+
+	var cities []string
+	byCity := make(map[string][]Observation)
+	for _, obs := range observations {
+		if _, ok := byCity[obs.City]; !ok {
+			cities = append(cities, obs.City)
+		}
+		byCity[obs.City] = append(byCity[obs.City], obs)
+	}
+
+	result := make([]Observation, 0, len(observations))
+	for _, city := range cities {
+		series := byCity[city]
+		if opts.Step > 0 {
+			series = resampleObservations(series, opts.Step, opts.MaxGap)
+		}
+		if opts.Window > 1 {
+			series = smoothObservations(series, opts.Window, opts.MaxGap)
+		}
+		result = append(result, series...)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
+
+// Linear interpolation between a and b at fraction f
+func lerp(a, b, f float64) float64 {
+	return a + (b-a)*f
+}
+
+// Resample a single city's observations onto a fixed grid of step-aligned
+// times. Grid points inside a gap longer than maxGap are left out rather than
+// drawn as a straight line across missing data. A series spanning less
+// than a step is returned as is, as the grid could miss it entirely.
+func resampleObservations(observations []Observation, step, maxGap time.Duration) []Observation {
+	if len(observations) < 2 {
+		return observations
+	}
+	first, last := observations[0].Time, observations[len(observations)-1].Time
+	if last.Sub(first) < step {
+		return observations
+	}
+
+	result := make([]Observation, 0)
+	i := 0
+	for t := first.Truncate(step); !t.After(last); t = t.Add(step) {
+		if t.Before(first) {
+			continue
+		}
+		// Advance to the pair of observations bracketing t
+		for i < len(observations)-2 && observations[i+1].Time.Before(t) {
+			i++
+		}
+		a, b := observations[i], observations[i+1]
+		if t.Equal(b.Time) {
+			a = b
+		}
+		if !t.Equal(a.Time) && b.Time.Sub(a.Time) > maxGap {
+			continue
+		}
+
+		f := 0.0
+		if span := b.Time.Sub(a.Time); span > 0 {
+			f = float64(t.Sub(a.Time)) / float64(span)
+		}
+		point := a
+		point.Time = t
+		point.Temp = lerp(a.Temp, b.Temp, f)
+		point.FeelsLike = lerp(a.FeelsLike, b.FeelsLike, f)
+		point.Humidity = int(math.Round(lerp(float64(a.Humidity), float64(b.Humidity), f)))
+		point.Pressure = int(math.Round(lerp(float64(a.Pressure), float64(b.Pressure), f)))
+		point.WindSpeed = lerp(a.WindSpeed, b.WindSpeed, f)
+		point.CloudCover = int(math.Round(lerp(float64(a.CloudCover), float64(b.CloudCover), f)))
+		point.UVIndex = lerp(a.UVIndex, b.UVIndex, f)
+		point.Precip = lerp(a.Precip, b.Precip, f)
+		if f > 0.5 {
+			point.Description = b.Description
+		}
+		point.Interpolated = !t.Equal(a.Time)
+		result = append(result, point)
+	}
+	return result
+}
+
+// Centered moving average over a single city's observations. Averages never
+// reach across a gap longer than maxGap. Precipitation is left as measured.
+func smoothObservations(observations []Observation, window int, maxGap time.Duration) []Observation {
+	result := make([]Observation, len(observations))
+	copy(result, observations)
+
+	// Split into runs without gaps and smooth each independently
+	start := 0
+	for end := 1; end <= len(observations); end++ {
+		if end < len(observations) && observations[end].Time.Sub(observations[end-1].Time) <= maxGap {
+			continue
+		}
+		segment := observations[start:end]
+		half := window / 2
+		for i := range segment {
+			lo, hi := max(0, i-half), min(len(segment), i+half+1)
+			var temp, feels, humidity, pressure, wind, clouds, uv float64
+			for _, obs := range segment[lo:hi] {
+				temp += obs.Temp
+				feels += obs.FeelsLike
+				humidity += float64(obs.Humidity)
+				pressure += float64(obs.Pressure)
+				wind += obs.WindSpeed
+				clouds += float64(obs.CloudCover)
+				uv += obs.UVIndex
+			}
+			n := float64(hi - lo)
+			point := &result[start+i]
+			point.Temp = temp / n
+			point.FeelsLike = feels / n
+			point.Humidity = int(math.Round(humidity / n))
+			point.Pressure = int(math.Round(pressure / n))
+			point.WindSpeed = wind / n
+			point.CloudCover = int(math.Round(clouds / n))
+			point.UVIndex = uv / n
+		}
+		start = end
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func seriesObservation(city string, minutes int, temp float64) Observation {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	return Observation{City: city, Time: base.Add(time.Duration(minutes) * time.Minute), Temp: temp, Humidity: int(temp * 2)}
+}
+
+func TestResampleObservations(t *testing.T) {
+	obs := []Observation{
+		seriesObservation("Oslo", 0, 10),
+		seriesObservation("Oslo", 60, 16),
+		// Four hour gap: nothing should be drawn across it
+		seriesObservation("Oslo", 300, 20),
+		seriesObservation("Oslo", 330, 23),
+	}
+
+	got := resampleObservations(obs, 15*time.Minute, 2*time.Hour)
+
+	var minutes []int
+	for _, p := range got {
+		minutes = append(minutes, int(p.Time.Sub(obs[0].Time).Minutes()))
+	}
+	want := []int{0, 15, 30, 45, 60, 300, 315, 330}
+	if len(minutes) != len(want) {
+		t.Fatalf("resampled times %v, want %v", minutes, want)
+	}
+	for i := range want {
+		if minutes[i] != want[i] {
+			t.Fatalf("resampled times %v, want %v", minutes, want)
+		}
+	}
+
+	if got[1].Temp != 11.5 || got[1].Humidity != 23 || !got[1].Interpolated {
+		t.Errorf("15 minute point = %+v", got[1])
+	}
+	if got[4].Temp != 16 || got[4].Interpolated {
+		t.Errorf("60 minute point should be the reading itself, got %+v", got[4])
+	}
+	if got[6].Temp != 21.5 {
+		t.Errorf("315 minute point temp = %.2f, want 21.5", got[6].Temp)
+	}
+}
+
+func TestSmoothObservations(t *testing.T) {
+	obs := []Observation{
+		seriesObservation("Oslo", 0, 10),
+		seriesObservation("Oslo", 10, 13),
+		seriesObservation("Oslo", 20, 10),
+		// After the gap the average must not include earlier readings
+		seriesObservation("Oslo", 300, 30),
+		seriesObservation("Oslo", 310, 30),
+	}
+
+	got := smoothObservations(obs, 3, time.Hour)
+	wantTemps := []float64{11.5, 11, 11.5, 30, 30}
+	for i, want := range wantTemps {
+		if math.Abs(got[i].Temp-want) > 1e-9 {
+			t.Errorf("point %d temp = %.2f, want %.2f", i, got[i].Temp, want)
+		}
+	}
+	if obs[1].Temp != 13 {
+		t.Error("smoothing modified the input")
+	}
+}
+
+func TestApplySeriesOptionsPerCity(t *testing.T) {
+	obs := []Observation{
+		seriesObservation("Oslo", 0, 10),
+		seriesObservation("Bergen", 0, 5),
+		seriesObservation("Oslo", 30, 12),
+		seriesObservation("Bergen", 30, 9),
+	}
+	got := applySeriesOptions(obs, seriesOptions{Step: 15 * time.Minute, MaxGap: time.Hour})
+	if len(got) != 6 {
+		t.Fatalf("got %d points, want 6", len(got))
+	}
+	for _, p := range got {
+		if p.City == "Bergen" && p.Interpolated && p.Temp != 7 {
+			t.Errorf("Bergen midpoint temp = %.1f, want 7 (cities mixed?)", p.Temp)
+		}
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Time.Before(got[i-1].Time) {
+			t.Fatal("merged series is not in time order")
+		}
+	}
+}
+
+func TestParseSeriesOptions(t *testing.T) {
+	opts, err := parseSeriesOptions(url.Values{"interpolate": {"15m"}, "smooth": {"5"}})
+	if err != nil || opts.Step != 15*time.Minute || opts.Window != 5 || opts.MaxGap != defaultSeriesMaxGap {
+		t.Errorf("got %+v, %v", opts, err)
+	}
+
+	for _, bad := range []url.Values{
+		{"interpolate": {"10s"}},
+		{"interpolate": {"soon"}},
+		{"smooth": {"0"}},
+		{"smooth": {"100"}},
+		{"max_gap": {"-1h"}},
+	} {
+		if _, err := parseSeriesOptions(bad); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Normalized severity levels, from least to most severe. Every response
+// carrying conditions reports one, so UIs and notifiers color-code alike.
+const (
+	SeverityNone      = "none"
+	SeverityAdvisory  = "advisory"
+	SeverityWatch     = "watch"
+	SeverityWarning   = "warning"
+	SeverityEmergency = "emergency"
+)
+
+var severityLevels = []string{SeverityNone, SeverityAdvisory, SeverityWatch, SeverityWarning, SeverityEmergency}
+
+// Display colors for the levels: green, then the yellow, orange, red and
+// purple official warning services use
+var severityColors = map[string]string{
+	SeverityNone:      "#4caf50",
+	SeverityAdvisory:  "#fbc02d",
+	SeverityWatch:     "#fb8c00",
+	SeverityWarning:   "#e53935",
+	SeverityEmergency: "#8e24aa",
+}
+
+// Levels for CAP severities (alertSeverities), by the color warning
+// services show them in
+var capSeverityLevels = map[string]string{
+	"minor":    SeverityAdvisory,
+	"moderate": SeverityWatch,
+	"severe":   SeverityWarning,
+	"extreme":  SeverityEmergency,
+}
+
+// Position of a level in severityLevels, 0 for unknown levels
+func severityIndex(level string) int {
+	for i, l := range severityLevels {
+		if l == level {
+			return i
+		}
+	}
+	return 0
+}
+
+// Color for a level, that of none for unknown levels
+func severityColor(level string) string {
+	if color, ok := severityColors[level]; ok {
+		return color
+	}
+	return severityColors[SeverityNone]
+}
+
+// Level for a CAP severity; alerts without one count as the default
+func severityFromCAP(severity string) string {
+	if level, ok := capSeverityLevels[strings.ToLower(strings.TrimSpace(severity))]; ok {
+		return level
+	}
+	return capSeverityLevels[defaultAlertSeverity]
+}
+
+// Overall level of the conditions and any official warnings, with what
+// raised it
+func (agent *WeatherAgent) weatherSeverity(weather WeatherResponse) (string, []string) {
+	level := SeverityNone
+	var reasons []string
+	raise := func(to, reason string) {
+		if severityIndex(to) > severityIndex(level) {
+			level = to
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", to, reason))
+	}
+
+	for _, w := range weather.Warnings {
+		raise(severityFromCAP(w.Severity), w.Headline)
+	}
+	if advisory, ok := agent.temperatureAdvisory(weather); ok {
+		raise(advisory.Severity, fmt.Sprintf("%s %s (%s)", advisory.Type, advisory.Severity, advisory.Measure))
+	}
+
+	aqi := 0
+	scale := "us"
+	if weather.IQAirData.AQI > 0 {
+		aqi = weather.IQAirData.AQI
+	} else if len(weather.AQI.List) > 0 {
+		aqi, scale = weather.AQI.List[0].Main.AQI, "owm"
+	}
+	if aqi > 0 {
+		switch aqLevel := airQualityLevel(aqi, scale); {
+		case aqLevel >= 5:
+			raise(SeverityEmergency, "hazardous air quality")
+		case aqLevel == 4:
+			raise(SeverityWarning, "very unhealthy air quality")
+		case aqLevel >= 2:
+			raise(SeverityAdvisory, strings.ReplaceAll(airQualityLevels[aqLevel], "_", " ")+" air quality")
+		}
+	}
+
+	// Sustained wind: the NWS issues wind advisories from 31 mph (Beaufort 7)
+	// and high wind warnings from 40 mph, within Beaufort 8 (39-46 mph)
+	switch force := units.SpeedIn(weather.Wind.Speed, agent.weatherUnits(weather)).Beaufort(); {
+	case force >= 12:
+		raise(SeverityEmergency, "hurricane-force wind")
+	case force >= 8:
+		raise(SeverityWarning, fmt.Sprintf("wind force %d", force))
+	case force >= 7:
+		raise(SeverityAdvisory, fmt.Sprintf("wind force %d", force))
+	}
+
+	if len(weather.Weather) > 0 {
+		switch weather.Weather[0].ID {
+		case 96, 99:
+			raise(SeverityWarning, "thunderstorm with hail")
+		case 95:
+			raise(SeverityWatch, "thunderstorm")
+		}
+	}
+	return level, reasons
+}
+
+// Add the overall severity to the weather data
+func (agent *WeatherAgent) addSeverityData(weather WeatherResponse, data map[string]interface{}) {
+	level, reasons := agent.weatherSeverity(weather)
+	data["severity"] = level
+	if len(reasons) > 0 {
+		data["severity_reasons"] = reasons
+	}
+}
+
+// The weather data's severity, none when it has none
+func dataSeverity(data map[string]interface{}) string {
+	if level, ok := data["severity"].(string); ok {
+		return level
+	}
+	return SeverityNone
+}
+
+// Level for a notification: an alert's own severity, otherwise that of the
+// weather it carries
+func notificationSeverity(n Notification) string {
+	if n.Type == NotificationAlert {
+		return severityFromCAP(n.Severity)
+	}
+	return dataSeverity(n.Data)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWeatherSeverity(t *testing.T) {
+	reading := func(code int, temp, wind float64, aqi int, warning string) WeatherResponse {
+		w := statusWeather("", 1, temp)
+		w.Weather[0].ID = code
+		w.Main.FeelsLike, w.Main.Humidity = temp, 50
+		w.Wind.Speed = wind
+		w.IQAirData.AQI = aqi
+		if warning != "" {
+			w.Warnings = []WeatherWarning{{Severity: warning, Headline: "Official warning"}}
+		}
+		return w
+	}
+
+	tests := []struct {
+		name    string
+		weather WeatherResponse
+		want    string
+		reasons int
+	}{
+		{"calm and clear", reading(800, 18, 3, 30, ""), SeverityNone, 0},
+		{"moderate air", reading(800, 18, 3, 80, ""), SeverityNone, 0},
+		{"unhealthy for sensitive groups", reading(800, 18, 3, 120, ""), SeverityAdvisory, 1},
+		{"very unhealthy air", reading(800, 18, 3, 250, ""), SeverityWarning, 1},
+		{"hazardous air", reading(800, 18, 3, 350, ""), SeverityEmergency, 1},
+		{"gale", reading(800, 18, 55, 0, ""), SeverityAdvisory, 1},
+		{"fresh gale from 17.2 m/s", reading(800, 18, 62, 0, ""), SeverityWarning, 1},
+		{"fresh gale to 20.7 m/s", reading(800, 18, 74.5, 0, ""), SeverityWarning, 1},
+		{"storm", reading(800, 18, 80, 0, ""), SeverityWarning, 1},
+		{"hurricane force", reading(800, 18, 120, 0, ""), SeverityEmergency, 1},
+		{"thunderstorm", reading(95, 18, 3, 0, ""), SeverityWatch, 1},
+		{"thunderstorm with hail", reading(99, 18, 3, 0, ""), SeverityWarning, 1},
+		{"heat", reading(800, 40, 3, 0, ""), SeverityWarning, 1},
+		{"minor official warning", reading(800, 18, 3, 0, "Minor"), SeverityAdvisory, 1},
+		{"extreme official warning", reading(800, 18, 3, 0, "Extreme"), SeverityEmergency, 1},
+		{"highest wins", reading(95, 18, 55, 250, "Minor"), SeverityWarning, 4},
+	}
+	agent := newFixtureAgent(t, Config{})
+	for _, tt := range tests {
+		got, reasons := agent.weatherSeverity(tt.weather)
+		if got != tt.want || len(reasons) != tt.reasons {
+			t.Errorf("%s: got %s %v, want %s with %d reasons", tt.name, got, reasons, tt.want, tt.reasons)
+		}
+	}
+}
+
+func TestSeverityFromCAP(t *testing.T) {
+	tests := []struct {
+		severity, want string
+	}{
+		{"Minor", SeverityAdvisory},
+		{"moderate", SeverityWatch},
+		{" SEVERE ", SeverityWarning},
+		{"Extreme", SeverityEmergency},
+		{"", SeverityWatch},
+		{"unknown", SeverityWatch},
+	}
+	for _, tt := range tests {
+		if got := severityFromCAP(tt.severity); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationSeverity(t *testing.T) {
+	tests := []struct {
+		name string
+		n    Notification
+		want string
+	}{
+		{"alert", Notification{Type: NotificationAlert, Severity: "severe", Data: map[string]interface{}{"severity": SeverityNone}}, SeverityWarning},
+		{"threshold alert", Notification{Type: NotificationAlert}, SeverityWatch},
+		{"update", Notification{Type: NotificationUpdate, Data: map[string]interface{}{"severity": SeverityAdvisory}}, SeverityAdvisory},
+		{"digest without data", Notification{Type: NotificationDigest}, SeverityNone},
+	}
+	for _, tt := range tests {
+		if got := notificationSeverity(tt.n); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if severityColor(SeverityWarning) != "#e53935" || severityColor("unknown") != severityColor(SeverityNone) {
+		t.Errorf("unexpected colors")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Base URL of the Slack Web API
+const slackAPIBase = "https://slack.com/api"
+
+// Slack limits status text to 100 characters
+const maxSlackStatusLength = 100
+
+// Sets Slack users' status to the current conditions, e.g. ":thunder_cloud_and_rain:
+// Stormy in Austin, 18°C", using their stored user OAuth tokens (users.profile:write).
+// Discord has no API for setting a user's custom status, so only Slack is supported.
+type slackStatusUpdater struct {
+	tokens  []string
+	apiBase string
+	client  *http.Client
+	last    string // Last status set, so unchanged conditions don't call the API
+}
+
+func newSlackStatusUpdater(tokens []string) *slackStatusUpdater {
+	return &slackStatusUpdater{
+		tokens:  tokens,
+		apiBase: slackAPIBase,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Status emoji and text for the current weather
+func chatStatus(weather WeatherResponse, tempUnit string) (emoji, text string) {
+	condition := ""
+	if len(weather.Weather) > 0 {
+		condition = weather.Weather[0].Main
+	}
+	night := weather.IsDay == 0
+
+	var adjective string
+	switch condition {
+	case "Clear":
+		emoji, adjective = ":sunny:", "sunny"
+		if night {
+			emoji, adjective = ":crescent_moon:", "clear"
+		}
+	case "Mainly Clear":
+		emoji, adjective = ":mostly_sunny:", "mostly sunny"
+		if night {
+			emoji, adjective = ":crescent_moon:", "mostly clear"
+		}
+	case "Clouds":
+		emoji, adjective = ":cloud:", "cloudy"
+	case "Fog":
+		emoji, adjective = ":fog:", "foggy"
+	case "Drizzle":
+		emoji, adjective = ":rain_cloud:", "drizzly"
+	case "Rain":
+		emoji, adjective = ":rain_cloud:", "rainy"
+	case "Snow":
+		emoji, adjective = ":snowflake:", "snowy"
+	case "Thunderstorm":
+		emoji, adjective = ":thunder_cloud_and_rain:", "stormy"
+	default:
+		emoji, adjective = ":thermometer:", strings.ToLower(condition)
+	}
+	if adjective == "" {
+		adjective = "weather"
+	}
+
+	text = fmt.Sprintf("%s in %s, %.0f%s", strings.ToUpper(adjective[:1])+adjective[1:], weather.Name, weather.Main.Temp, tempUnit)
+	if len(text) > maxSlackStatusLength {
+		text = text[:maxSlackStatusLength]
+	}
+	return emoji, text
+}
+
+// Set the status for every configured user. The status expires on its own
+// so a stopped agent doesn't leave stale weather behind.
+func (s *slackStatusUpdater) set(emoji, text string, expiration time.Time) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"profile": map[string]interface{}{
+			"status_text":       text,
+			"status_emoji":      emoji,
+			"status_expiration": expiration.Unix(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for i, token := range s.tokens {
+		if err := s.setForToken(token, payload); err != nil {
+			// Identify the user by position so tokens never reach the logs
+			failures = append(failures, fmt.Sprintf("token %d: %v", i+1, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Slack status update failed for %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (s *slackStatusUpdater) setForToken(token string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.apiBase+"/users.profile.set", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	// Slack reports errors in the body with a 200 status
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("%s", result.Error)
+	}
+	return nil
+}
+
+// Update the chat status from the configured city every check interval
+func (agent *WeatherAgent) runStatusUpdater(updater *slackStatusUpdater) {
+	interval := time.Duration(agent.config.CheckInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		weather, err := agent.fetchWeather()
+		if err != nil {
+			agent.logger.Printf("Status updater: error fetching weather: %v", err)
+		} else {
+			emoji, text := chatStatus(weather, agent.getTempUnit())
+			if status := emoji + " " + text; status != updater.last {
+				// Expire well after the next update is due in case it fails
+				if err := updater.set(emoji, text, time.Now().Add(3*interval+time.Hour)); err != nil {
+					agent.logger.Printf("Status updater: %v", err)
+				} else {
+					updater.last = status
+					agent.logger.Printf("Updated Slack status: %s", status)
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
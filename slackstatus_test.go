@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func statusWeather(condition string, isDay int, temp float64) WeatherResponse {
+	var w WeatherResponse
+	w.Name = "Austin"
+	w.IsDay = isDay
+	w.Main.Temp = temp
+	w.Weather = append(w.Weather, struct {
+		ID          int    `json:"id"`
+		Main        string `json:"main"`
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+	}{Main: condition})
+	return w
+}
+
+func TestChatStatus(t *testing.T) {
+	tests := []struct {
+		weather WeatherResponse
+		emoji   string
+		text    string
+	}{
+		{statusWeather("Thunderstorm", 1, 18.4), ":thunder_cloud_and_rain:", "Stormy in Austin, 18°C"},
+		{statusWeather("Clear", 1, 30), ":sunny:", "Sunny in Austin, 30°C"},
+		{statusWeather("Clear", 0, 12), ":crescent_moon:", "Clear in Austin, 12°C"},
+		{statusWeather("Snow", 1, -2), ":snowflake:", "Snowy in Austin, -2°C"},
+	}
+	for _, tt := range tests {
+		emoji, text := chatStatus(tt.weather, "°C")
+		if emoji != tt.emoji || text != tt.text {
+			t.Errorf("chatStatus = %q %q, want %q %q", emoji, text, tt.emoji, tt.text)
+		}
+	}
+}
+
+func TestSlackStatusUpdaterSet(t *testing.T) {
+	var auths []string
+	var profile map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users.profile.set" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		auths = append(auths, r.Header.Get("Authorization"))
+		var body struct {
+			Profile map[string]interface{} `json:"profile"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		profile = body.Profile
+
+		if r.Header.Get("Authorization") == "Bearer xoxp-revoked" {
+			io.WriteString(w, `{"ok":false,"error":"token_revoked"}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	updater := newSlackStatusUpdater([]string{"xoxp-one", "xoxp-revoked"})
+	updater.apiBase = server.URL
+
+	expiry := time.Unix(1700000000, 0)
+	err := updater.set(":sunny:", "Sunny in Austin, 30°C", expiry)
+	if err == nil || !strings.Contains(err.Error(), "token 2: token_revoked") {
+		t.Errorf("expected the revoked token to fail, got %v", err)
+	}
+	if strings.Contains(err.Error(), "xoxp") {
+		t.Errorf("error leaks a token: %v", err)
+	}
+	if len(auths) != 2 || auths[0] != "Bearer xoxp-one" {
+		t.Errorf("unexpected Authorization headers %v", auths)
+	}
+	if profile["status_emoji"] != ":sunny:" || profile["status_text"] != "Sunny in Austin, 30°C" || profile["status_expiration"] != float64(1700000000) {
+		t.Errorf("unexpected profile %v", profile)
+	}
+}
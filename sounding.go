@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Location tags that enable upper-air data
+var soundingTags = []string{"aviation", "paragliding"}
+
+// Wind and temperature at a single pressure level
+type PressureLevel struct {
+	PressureHPa   int     `json:"pressure_hpa"`
+	HeightM       float64 `json:"height_m"`       // Geopotential height above sea level
+	Temperature   float64 `json:"temperature_c"`  // Always Celsius
+	WindSpeed     float64 `json:"wind_speed_kmh"` // Always km/h
+	WindDirection int     `json:"wind_direction"`
+}
+
+// Simplified sounding for free-flight and aviation users
+type Sounding struct {
+	ElevationM     float64         `json:"elevation_m"`
+	SurfaceTemp    float64         `json:"surface_temp_c"`
+	Levels         []PressureLevel `json:"levels"`
+	LapseRate      float64         `json:"lapse_rate_c_per_km"` // Surface to 700 hPa
+	ThermalQuality string          `json:"thermal_quality"`
+	WindWarning    string          `json:"wind_warning,omitempty"`
+}
+
+// Whether the configured location tags request upper-air data
+func wantsSounding(tags []string) bool {
+	for _, tag := range tags {
+		for _, want := range soundingTags {
+			if strings.EqualFold(strings.TrimSpace(tag), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fetch 850 and 700 hPa winds and temperatures from Open-Meteo
+func (agent *WeatherAgent) fetchSounding(lat, lon float64) (*Sounding, error) {
+	// Always request metric values so the lapse rate maths is unit-independent
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,temperature_850hPa,temperature_700hPa,wind_speed_850hPa,wind_speed_700hPa,wind_direction_850hPa,wind_direction_700hPa,geopotential_height_850hPa,geopotential_height_700hPa&windspeed_unit=kmh&timezone=auto",
+		lat, lon)
+
+	client := agent.httpClient(10 * time.Second)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("sounding request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("sounding API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var soundingResp struct {
+		Elevation float64 `json:"elevation"`
+		Current   struct {
+			Temperature2m float64 `json:"temperature_2m"`
+			Temp850       float64 `json:"temperature_850hPa"`
+			Temp700       float64 `json:"temperature_700hPa"`
+			Wind850       float64 `json:"wind_speed_850hPa"`
+			Wind700       float64 `json:"wind_speed_700hPa"`
+			WindDir850    int     `json:"wind_direction_850hPa"`
+			WindDir700    int     `json:"wind_direction_700hPa"`
+			Height850     float64 `json:"geopotential_height_850hPa"`
+			Height700     float64 `json:"geopotential_height_700hPa"`
+		} `json:"current"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&soundingResp); err != nil {
+		return nil, fmt.Errorf("failed to parse sounding response: %v", err)
+	}
+
+	c := soundingResp.Current
+	sounding := &Sounding{
+		ElevationM:  soundingResp.Elevation,
+		SurfaceTemp: c.Temperature2m,
+		Levels: []PressureLevel{
+			{PressureHPa: 850, HeightM: c.Height850, Temperature: c.Temp850, WindSpeed: c.Wind850, WindDirection: c.WindDir850},
+			{PressureHPa: 700, HeightM: c.Height700, Temperature: c.Temp700, WindSpeed: c.Wind700, WindDirection: c.WindDir700},
+		},
+	}
+	analyzeSounding(sounding)
+
+	agent.logger.Printf("Sounding: lapse rate %.1f°C/km, thermals %s", sounding.LapseRate, sounding.ThermalQuality)
+
+	return sounding, nil
+}
+
+// Derive the lapse rate, thermal quality, and wind warnings for a sounding
+func analyzeSounding(s *Sounding) {
+	var top *PressureLevel
+	for i := range s.Levels {
+		if s.Levels[i].PressureHPa == 700 {
+			top = &s.Levels[i]
+		}
+	}
+
+	if top != nil && top.HeightM > s.ElevationM {
+		depthKm := (top.HeightM - s.ElevationM) / 1000
+		s.LapseRate = (s.SurfaceTemp - top.Temperature) / depthKm
+	}
+
+	// Compare against the dry adiabatic lapse rate (9.8°C/km)
+	switch {
+	case s.LapseRate >= 8.5:
+		s.ThermalQuality = "strong"
+	case s.LapseRate >= 7:
+		s.ThermalQuality = "good"
+	case s.LapseRate >= 5.5:
+		s.ThermalQuality = "weak"
+	default:
+		s.ThermalQuality = "stable (little or no thermal activity)"
+	}
+
+	for _, level := range s.Levels {
+		// Levels below the ground don't affect flying
+		if level.HeightM <= s.ElevationM {
+			continue
+		}
+		if level.PressureHPa == 850 && level.WindSpeed > 30 {
+			s.WindWarning = fmt.Sprintf("strong winds aloft at 850 hPa (%.0f km/h)", level.WindSpeed)
+			break
+		}
+		if level.PressureHPa == 700 && level.WindSpeed > 40 {
+			s.WindWarning = fmt.Sprintf("strong winds aloft at 700 hPa (%.0f km/h)", level.WindSpeed)
+			break
+		}
+	}
+}
+
+// One-line summary of the sounding for the data map and LLM prompt
+func (s *Sounding) summary() string {
+	var parts []string
+	for _, level := range s.Levels {
+		parts = append(parts, fmt.Sprintf("%d hPa (~%.0f m): %.1f°C, wind %.0f km/h from %d°",
+			level.PressureHPa, level.HeightM, level.Temperature, level.WindSpeed, level.WindDirection))
+	}
+	return strings.Join(parts, "; ")
+}
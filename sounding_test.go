@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeSounding(t *testing.T) {
+	tests := []struct {
+		name        string
+		surfaceTemp float64
+		temp700     float64
+		wind850     float64
+		wantQuality string
+		wantWarning bool
+	}{
+		{"strong thermals", 25, -3, 10, "strong", false},
+		{"good thermals", 20, -2, 10, "good", false},
+		{"stable", 10, 0, 10, "stable (little or no thermal activity)", false},
+		{"windy aloft", 20, -2, 45, "good", true},
+	}
+
+	for _, tt := range tests {
+		s := &Sounding{
+			ElevationM:  100,
+			SurfaceTemp: tt.surfaceTemp,
+			Levels: []PressureLevel{
+				{PressureHPa: 850, HeightM: 1500, WindSpeed: tt.wind850},
+				{PressureHPa: 700, HeightM: 3100, Temperature: tt.temp700},
+			},
+		}
+		analyzeSounding(s)
+
+		wantLapse := (tt.surfaceTemp - tt.temp700) / 3.0
+		if math.Abs(s.LapseRate-wantLapse) > 0.01 {
+			t.Errorf("%s: lapse rate %.2f, want %.2f", tt.name, s.LapseRate, wantLapse)
+		}
+		if s.ThermalQuality != tt.wantQuality {
+			t.Errorf("%s: thermal quality %q, want %q", tt.name, s.ThermalQuality, tt.wantQuality)
+		}
+		if (s.WindWarning != "") != tt.wantWarning {
+			t.Errorf("%s: wind warning %q, want warning=%v", tt.name, s.WindWarning, tt.wantWarning)
+		}
+	}
+}
+
+func TestWantsSounding(t *testing.T) {
+	if wantsSounding(nil) {
+		t.Error("no tags should not request a sounding")
+	}
+	if !wantsSounding([]string{"coastal", " Paragliding "}) {
+		t.Error("paragliding tag should request a sounding")
+	}
+}
@@ -20,6 +20,9 @@ document.addEventListener("DOMContentLoaded", function () {
   // Track last update timestamp to detect changes
   let lastUpdateTimestamp = "";
 
+  // Detected coordinates, once known, so the minute refresh uses them too
+  let currentCoordinates = null;
+
   // Try to get user's location first, then fetch weather data
   detectLocation();
 
@@ -56,7 +59,7 @@ document.addEventListener("DOMContentLoaded", function () {
         showLoadingState();
       }
 
-      return fetch("/api/weather")
+      return fetch("/api/v1/weather")
         .then((response) => {
           if (!response.ok) {
             throw new Error("Network response was not ok");
@@ -72,7 +75,7 @@ document.addEventListener("DOMContentLoaded", function () {
         if (data.timestamp !== lastUpdateTimestamp) {
           console.log("New weather data available! Updating UI...");
           updateWeatherDetails(data);
-          updateWeatherMessage(data.message);
+          showMessage(data);
           updatePageTitle(data.city, data.country);
           updateTimestamp(data.timestamp);
 
@@ -101,6 +104,75 @@ document.addEventListener("DOMContentLoaded", function () {
   // Add this to the global scope so our interval can use it
   window.fetchWeatherData = fetchWeatherData;
 
+  // Show the response's message. While a new one generates (job_id set),
+  // the last message stays up and the new one replaces it when ready.
+  function showMessage(data) {
+    if (data.message) {
+      updateWeatherMessage(data.message);
+    }
+    if (!data.job_id) {
+      return;
+    }
+    waitForJob(data.job_id)
+      .then((update) => {
+        updateWeatherMessage(update.message);
+        updateTimestamp(update.timestamp);
+        lastUpdateTimestamp = update.timestamp;
+      })
+      .catch((error) => {
+        console.error("Error generating weather message:", error);
+        if (!data.message) {
+          updateWeatherMessage("The weather message could not be generated. Please try again.");
+        }
+      });
+  }
+
+  // Poll a message job until it finishes, resolving with the weather update
+  function waitForJob(id) {
+    return fetch(`/api/v1/jobs/${id}`)
+      .then((response) => {
+        if (!response.ok) {
+          throw new Error("Network response was not ok");
+        }
+        return response.json();
+      })
+      .then((job) => {
+        if (job.status === "completed") {
+          return job.result;
+        }
+        if (job.status === "failed") {
+          throw new Error(job.error);
+        }
+        return new Promise((resolve) => setTimeout(resolve, 1000)).then(() =>
+          waitForJob(id),
+        );
+      });
+  }
+
+  // Refresh the numbers from /api/conditions, which doesn't generate a
+  // message, leaving the current message in place
+  function refreshConditions() {
+    const query = currentCoordinates
+      ? `?lat=${currentCoordinates.lat}&lon=${currentCoordinates.lon}`
+      : "";
+    return fetch(`/api/v1/conditions${query}`)
+      .then((response) => {
+        if (!response.ok) {
+          throw new Error("Network response was not ok");
+        }
+        return response.json();
+      })
+      .then((data) => {
+        updateWeatherDetails(data);
+      })
+      .catch((error) => {
+        console.error("Error refreshing conditions:", error);
+      });
+  }
+
+  // Cheap data refresh every minute
+  setInterval(refreshConditions, 60 * 1000);
+
   // Show loading state while fetching weather data
   function showLoadingState() {
     const weatherMessage = document.getElementById("weatherMessage");
@@ -223,7 +295,7 @@ document.addEventListener("DOMContentLoaded", function () {
   function fetchWeatherDataByCoordinates(lat, lon) {
     showLoadingState();
 
-    return fetch(`/api/weather?lat=${lat}&lon=${lon}`)
+    return fetch(`/api/v1/weather?lat=${lat}&lon=${lon}`)
       .then((response) => {
         if (!response.ok) {
           throw new Error("Network response was not ok");
@@ -232,8 +304,9 @@ document.addEventListener("DOMContentLoaded", function () {
       })
       .then((data) => {
         console.log("Weather data received for detected location");
+        currentCoordinates = { lat, lon };
         updateWeatherDetails(data);
-        updateWeatherMessage(data.message);
+        showMessage(data);
         updatePageTitle(data.city, data.country);
         updateTimestamp(data.timestamp);
         lastUpdateTimestamp = data.timestamp;
@@ -360,6 +433,24 @@ function updateWeatherDetails(data) {
       icon: "fa-temperature-high",
       optional: true 
     },
+    {
+      key: "humidex",
+      label: "Humidex",
+      icon: "fa-temperature-high",
+      optional: true
+    },
+    {
+      key: "wind_chill",
+      label: "Wind Chill",
+      icon: "fa-temperature-low",
+      optional: true
+    },
+    {
+      key: "dew_point",
+      label: "Dew Point",
+      icon: "fa-tint",
+      optional: true
+    },
     { key: "condition", label: "Condition", icon: "fa-cloud" },
     { key: "humidity", label: "Humidity", icon: "fa-tint", suffix: "%" },
     { key: "pressure", label: "Pressure", icon: "fa-compress" },
@@ -368,6 +459,33 @@ function updateWeatherDetails(data) {
     { key: "visibility", label: "Visibility", icon: "fa-eye" },
     // Removing AQI from the main list since we add it separately at the end
     { key: "time", label: "Local Time", icon: "fa-clock" },
+    {
+      key: "recommendations",
+      label: "What to Wear",
+      icon: "fa-tshirt",
+      optional: true,
+      formatter: (rec) =>
+        rec.layers.join(", ") +
+        (rec.umbrella ? ", umbrella" : "") +
+        (rec.sunscreen ? ", sunscreen" : "") +
+        ` (run ${rec.run_score}/10, bike ${rec.bike_score}/10)`,
+    },
+    {
+      key: "nowcast",
+      label: "Next 2 Hours",
+      icon: "fa-umbrella",
+      optional: true,
+    },
+    {
+      key: "playlist",
+      label: "Soundtrack",
+      icon: "fa-music",
+      optional: true,
+      formatter: (playlist) =>
+        playlist.link
+          ? `<a href="${encodeURI(playlist.link)}" target="_blank" rel="noopener">${playlist.mood}</a>`
+          : playlist.mood,
+    },
   ];
 
   // Debug full data object
@@ -0,0 +1,265 @@
+document.addEventListener("DOMContentLoaded", function () {
+  const form = document.getElementById("subscriptionForm");
+  const channelSelect = document.getElementById("channelSelect");
+  const targetInput = document.getElementById("targetInput");
+  const cityInput = document.getElementById("subscriptionCity");
+  const countryInput = document.getElementById("subscriptionCountry");
+  const formStatus = document.getElementById("formStatus");
+  const listElement = document.getElementById("subscriptionList");
+
+  const placeholders = {
+    email: "you@example.com",
+    telegram: "Telegram chat ID, e.g. 123456789",
+    webhook: "https://example.com/hooks/weather",
+  };
+
+  channelSelect.addEventListener("change", function () {
+    targetInput.placeholder = placeholders[channelSelect.value] || "";
+  });
+
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    formStatus.textContent = "";
+
+    const body = { channel: channelSelect.value, target: targetInput.value };
+    if (cityInput.value.trim() !== "") {
+      body.location = { city: cityInput.value, country: countryInput.value };
+    }
+
+    request("POST", "/api/v1/subscriptions", body)
+      .then(() => {
+        targetInput.value = "";
+        cityInput.value = "";
+        countryInput.value = "";
+        formStatus.textContent =
+          "Added. Send a test message to start receiving notifications.";
+        return loadSubscriptions();
+      })
+      .catch((error) => {
+        formStatus.textContent = error.message;
+      });
+  });
+
+  // Call the API and reject with the server's error message on failure
+  function request(method, url, body) {
+    const options = { method: method, headers: {} };
+    if (body !== undefined) {
+      options.headers["Content-Type"] = "application/json";
+      options.body = JSON.stringify(body);
+    }
+    return fetch(url, options).then((response) => {
+      if (!response.ok) {
+        return response
+          .json()
+          .catch(() => ({}))
+          .then((body) => {
+            const message = body.error && body.error.message;
+            throw new Error(message || "Request failed: " + response.status);
+          });
+      }
+      return response.status === 204 ? null : response.json();
+    });
+  }
+
+  function loadSubscriptions() {
+    return request("GET", "/api/v1/subscriptions")
+      .then((data) => {
+        renderChannels(data.channels || []);
+        renderSubscriptions(data.subscriptions || []);
+      })
+      .catch((error) => {
+        listElement.innerHTML = "";
+        const message = document.createElement("div");
+        message.className = "loading";
+        message.textContent = error.message;
+        listElement.appendChild(message);
+      });
+  }
+
+  function renderChannels(channels) {
+    const selected = channelSelect.value;
+    channelSelect.innerHTML = "";
+    channels.forEach((channel) => {
+      const option = document.createElement("option");
+      option.value = channel;
+      option.textContent = channel.charAt(0).toUpperCase() + channel.slice(1);
+      channelSelect.appendChild(option);
+    });
+    if (channels.includes(selected)) {
+      channelSelect.value = selected;
+    }
+    targetInput.placeholder = placeholders[channelSelect.value] || "";
+  }
+
+  function renderSubscriptions(subscriptions) {
+    listElement.innerHTML = "";
+    if (subscriptions.length === 0) {
+      const empty = document.createElement("div");
+      empty.className = "loading";
+      empty.textContent = "No notification endpoints yet.";
+      listElement.appendChild(empty);
+      return;
+    }
+
+    subscriptions.forEach((sub) => {
+      listElement.appendChild(renderSubscription(sub));
+    });
+  }
+
+  function renderSubscription(sub) {
+    const item = document.createElement("div");
+    item.className = "weather-item subscription-item";
+
+    const title = document.createElement("h3");
+    title.textContent = sub.channel;
+    item.appendChild(title);
+
+    const target = document.createElement("p");
+    target.textContent = sub.target;
+    item.appendChild(target);
+
+    const location = document.createElement("p");
+    if (sub.location) {
+      const place = [sub.location.city, sub.location.country]
+        .filter(Boolean)
+        .join(", ");
+      location.textContent =
+        "Weather for " +
+        (place ||
+          sub.location.lat.toFixed(2) + ", " + sub.location.lon.toFixed(2));
+    } else {
+      location.textContent = "Weather for this server's location";
+    }
+    item.appendChild(location);
+
+    const status = document.createElement("small");
+    status.textContent = sub.verified ? "Verified" : "Not verified yet";
+    item.appendChild(status);
+
+    const prefs = document.createElement("div");
+    prefs.className = "subscription-prefs";
+    [
+      ["digest", "Daily digest"],
+      ["alerts", "Alerts"],
+      ["updates", "Updates"],
+    ].forEach(([key, label]) => {
+      const wrapper = document.createElement("label");
+      const checkbox = document.createElement("input");
+      checkbox.type = "checkbox";
+      checkbox.checked = sub.preferences[key];
+      checkbox.addEventListener("change", function () {
+        const preferences = Object.assign({}, sub.preferences);
+        preferences[key] = checkbox.checked;
+        request("PATCH", "/api/v1/subscriptions/" + sub.id, {
+          preferences: preferences,
+        })
+          .then((updated) => {
+            sub.preferences = updated.preferences;
+          })
+          .catch((error) => {
+            checkbox.checked = !checkbox.checked;
+            status.textContent = error.message;
+          });
+      });
+      wrapper.appendChild(checkbox);
+      wrapper.appendChild(document.createTextNode(" " + label));
+      prefs.appendChild(wrapper);
+    });
+    item.appendChild(prefs);
+
+    const actions = document.createElement("div");
+    actions.className = "subscription-actions";
+
+    const testButton = document.createElement("button");
+    testButton.className = "refresh-button";
+    testButton.innerHTML = '<i class="fas fa-paper-plane"></i> Send test';
+    testButton.addEventListener("click", function () {
+      testButton.disabled = true;
+      status.textContent = "Sending test message...";
+      request("POST", "/api/v1/subscriptions/" + sub.id + "/verify")
+        .then(() => loadSubscriptions())
+        .catch((error) => {
+          status.textContent = error.message;
+          testButton.disabled = false;
+        });
+    });
+    actions.appendChild(testButton);
+
+    const removeButton = document.createElement("button");
+    removeButton.className = "refresh-button";
+    removeButton.innerHTML = '<i class="fas fa-trash"></i> Remove';
+    removeButton.addEventListener("click", function () {
+      request("DELETE", "/api/v1/subscriptions/" + sub.id)
+        .then(() => loadSubscriptions())
+        .catch((error) => {
+          status.textContent = error.message;
+        });
+    });
+    actions.appendChild(removeButton);
+
+    item.appendChild(actions);
+    return item;
+  }
+
+  // Saved preferences applied to the weather and chat endpoints
+  const profileForm = document.getElementById("profileForm");
+  const profileStatus = document.getElementById("profileStatus");
+  const profileFields = {
+    city: document.getElementById("profileCity"),
+    country: document.getElementById("profileCountry"),
+    units: document.getElementById("profileUnits"),
+    language: document.getElementById("profileLanguage"),
+    persona: document.getElementById("profilePersona"),
+  };
+
+  profileForm.addEventListener("submit", function (event) {
+    event.preventDefault();
+    profileStatus.textContent = "";
+
+    const profile = {
+      units: profileFields.units.value,
+      language: profileFields.language.value,
+      persona: profileFields.persona.value,
+    };
+    if (profileFields.city.value.trim() !== "") {
+      profile.location = {
+        city: profileFields.city.value,
+        country: profileFields.country.value,
+      };
+    }
+    request("PUT", "/api/v1/profile", profile)
+      .then(() => {
+        profileStatus.textContent = "Saved.";
+      })
+      .catch((error) => {
+        profileStatus.textContent = error.message;
+      });
+  });
+
+  function loadProfile() {
+    return request("GET", "/api/v1/personas")
+      .then((data) => {
+        (data.personas || []).forEach((persona) => {
+          const option = document.createElement("option");
+          option.value = persona.name;
+          option.textContent = persona.description;
+          profileFields.persona.appendChild(option);
+        });
+        return request("GET", "/api/v1/profile");
+      })
+      .then((profile) => {
+        const location = profile.location || {};
+        profileFields.city.value = location.city || "";
+        profileFields.country.value = location.country || "";
+        profileFields.units.value = profile.units || "";
+        profileFields.language.value = profile.language || "";
+        profileFields.persona.value = profile.persona || "";
+      })
+      .catch(() => {
+        // No profile saved yet
+      });
+  }
+
+  loadProfile();
+  loadSubscriptions();
+});
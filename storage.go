@@ -0,0 +1,375 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Database holding observation history, subscriptions, LLM usage and
+// indoor sensor readings so that several replicas can write them
+// concurrently. Without one, observations and subscriptions are kept in
+// files, usage in the cache backend and sensor readings in memory.
+type storage interface {
+	appendObservation(obs Observation) error
+	// Observations since t, oldest first, optionally for one city
+	observationsSince(t time.Time, city string) ([]Observation, error)
+	pruneObservations(before time.Time) error
+	// Average readings before rawBefore into hourly points and delete
+	// points before aggregateBefore
+	compactObservations(rawBefore, aggregateBefore time.Time) error
+
+	loadSubscriptions() ([]storedSubscription, error)
+	// Insert or replace a subscription by ID
+	putSubscription(sub storedSubscription) error
+	deleteSubscription(id string) error
+
+	// Add one LLM call to a day's totals
+	addUsage(date string, usage llmUsage, cost float64) error
+	// A day's usage totals and whether any were recorded
+	usage(date string) (UsageTotals, bool, error)
+
+	// Insert or replace a sensor's reading at its time, keeping the
+	// sensor's newest keep readings
+	putSensorReading(reading SensorReading, keep int) error
+	// Sensor readings since t, oldest first, optionally for one sensor
+	sensorReadingsSince(t time.Time, sensor string) ([]SensorReading, error)
+	sensorNames() ([]string, error)
+
+	// Insert a logged LLM call, keeping the newest keep
+	putPrompt(record PromptRecord, keep int) error
+	// Logged LLM calls newest first, optionally for one model
+	prompts(model string, limit int) ([]PromptRecord, error)
+	prompt(id string) (PromptRecord, bool, error)
+}
+
+// Connect to the database at a postgres:// URL and create its tables
+func newStorage(databaseURL string) (storage, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %v", errors.Unwrap(err))
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return newPostgresStorage(databaseURL)
+	}
+	return nil, fmt.Errorf("unsupported database URL scheme %q (use postgres)", u.Scheme)
+}
+
+// Tables used by the Postgres storage. Observations and subscriptions are
+// kept as JSON so new fields don't need migrations.
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS weather_observations (
+		time timestamptz NOT NULL,
+		city text NOT NULL,
+		data jsonb NOT NULL,
+		PRIMARY KEY (city, time)
+	)`,
+	`CREATE INDEX IF NOT EXISTS weather_observations_time ON weather_observations (time)`,
+	`CREATE TABLE IF NOT EXISTS weather_subscriptions (
+		id text PRIMARY KEY,
+		data jsonb NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS weather_llm_usage (
+		date date PRIMARY KEY,
+		requests bigint NOT NULL,
+		input_tokens bigint NOT NULL,
+		output_tokens bigint NOT NULL,
+		cost_usd double precision NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS weather_sensor_readings (
+		sensor text NOT NULL,
+		time timestamptz NOT NULL,
+		data jsonb NOT NULL,
+		PRIMARY KEY (sensor, time)
+	)`,
+	`CREATE INDEX IF NOT EXISTS weather_sensor_readings_time ON weather_sensor_readings (time)`,
+	`CREATE TABLE IF NOT EXISTS weather_prompts (
+		id text PRIMARY KEY,
+		time timestamptz NOT NULL,
+		model text NOT NULL,
+		data jsonb NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS weather_prompts_time ON weather_prompts (time)`,
+}
+
+// Storage in Postgres through a connection pool. Statements aren't retried
+// on errors: database/sql only retries a statement on a fresh connection
+// when the driver reports it was never sent.
+type postgresStorage struct {
+	db *sql.DB
+}
+
+func newPostgresStorage(databaseURL string) (*postgresStorage, error) {
+	db, err := openPostgres(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return initPostgresStorage(db)
+}
+
+// Create the tables in db if they don't exist
+func initPostgresStorage(db *sql.DB) (*postgresStorage, error) {
+	s := &postgresStorage{db: db}
+	for _, statement := range postgresSchema {
+		if err := s.exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating tables: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// Run a statement that returns no rows
+func (s *postgresStorage) exec(query string, args ...interface{}) error {
+	ctx, cancel := postgresContext()
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Run a query returning one JSON column and decode each row with decode
+func (s *postgresStorage) queryJSON(decode func(data []byte) error, query string, args ...interface{}) error {
+	ctx, cancel := postgresContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := decode(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *postgresStorage) appendObservation(obs Observation) error {
+	data, err := json.Marshal(obs)
+	if err != nil {
+		return err
+	}
+	// Repeated readings of the same upstream update are stored once
+	return s.exec(`INSERT INTO weather_observations (time, city, data) VALUES ($1, $2, $3)
+		ON CONFLICT (city, time) DO NOTHING`, obs.Time, obs.City, data)
+}
+
+func (s *postgresStorage) observationsSince(t time.Time, city string) ([]Observation, error) {
+	observations := make([]Observation, 0)
+	err := s.queryJSON(func(data []byte) error {
+		var obs Observation
+		if err := json.Unmarshal(data, &obs); err != nil {
+			return fmt.Errorf("invalid stored observation: %v", err)
+		}
+		observations = append(observations, obs)
+		return nil
+	}, `SELECT data FROM weather_observations
+		WHERE time >= $1 AND ($2::text = '' OR city = $2::text) ORDER BY time`, t, city)
+	if err != nil {
+		return nil, err
+	}
+	return observations, nil
+}
+
+func (s *postgresStorage) pruneObservations(before time.Time) error {
+	return s.exec(`DELETE FROM weather_observations WHERE time < $1`, before)
+}
+
+// Hourly points are written over any reading stamped on the hour before
+// the hour's readings are deleted, so an interrupted run loses nothing.
+// Replicas compacting at the same time compute the same points.
+func (s *postgresStorage) compactObservations(rawBefore, aggregateBefore time.Time) error {
+	err := s.exec(`INSERT INTO weather_observations (time, city, data)
+		SELECT date_trunc('hour', time) AS hour, city, jsonb_build_object(
+			'time', date_trunc('hour', time),
+			'city', city,
+			'country', max(data->>'country'),
+			'temp', avg((data->>'temp')::float8),
+			'feels_like', avg((data->>'feels_like')::float8),
+			'humidity', round(avg((data->>'humidity')::float8))::int,
+			'pressure', round(avg((data->>'pressure')::float8))::int,
+			'wind_speed', avg((data->>'wind_speed')::float8),
+			'cloud_cover', round(avg((data->>'cloud_cover')::float8))::int,
+			'uv_index', avg((data->>'uv_index')::float8),
+			'precipitation', avg((data->>'precipitation')::float8),
+			'description', mode() WITHIN GROUP (ORDER BY data->>'description'),
+			'samples', count(*))
+		FROM weather_observations
+		WHERE time < $1 AND NOT (data ? 'samples')
+		GROUP BY hour, city
+		ON CONFLICT (city, time) DO UPDATE SET data = EXCLUDED.data`, rawBefore)
+	if err != nil {
+		return err
+	}
+	if err := s.exec(`DELETE FROM weather_observations WHERE time < $1 AND NOT (data ? 'samples')`, rawBefore); err != nil {
+		return err
+	}
+	return s.exec(`DELETE FROM weather_observations WHERE time < $1`, aggregateBefore)
+}
+
+func (s *postgresStorage) loadSubscriptions() ([]storedSubscription, error) {
+	stored := make([]storedSubscription, 0)
+	err := s.queryJSON(func(data []byte) error {
+		var st storedSubscription
+		if err := json.Unmarshal(data, &st); err != nil {
+			return fmt.Errorf("invalid stored subscription: %v", err)
+		}
+		stored = append(stored, st)
+		return nil
+	}, `SELECT data FROM weather_subscriptions`)
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (s *postgresStorage) putSubscription(sub storedSubscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return s.exec(`INSERT INTO weather_subscriptions (id, data) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data`, sub.ID, data)
+}
+
+func (s *postgresStorage) deleteSubscription(id string) error {
+	return s.exec(`DELETE FROM weather_subscriptions WHERE id = $1`, id)
+}
+
+// Increment the day's row in one statement, so concurrent calls from
+// several replicas are all counted
+func (s *postgresStorage) addUsage(date string, usage llmUsage, cost float64) error {
+	err := s.exec(`INSERT INTO weather_llm_usage (date, requests, input_tokens, output_tokens, cost_usd)
+		VALUES ($1, 1, $2, $3, $4)
+		ON CONFLICT (date) DO UPDATE SET
+			requests = weather_llm_usage.requests + 1,
+			input_tokens = weather_llm_usage.input_tokens + EXCLUDED.input_tokens,
+			output_tokens = weather_llm_usage.output_tokens + EXCLUDED.output_tokens,
+			cost_usd = weather_llm_usage.cost_usd + EXCLUDED.cost_usd`,
+		date, usage.InputTokens, usage.OutputTokens, cost)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-usageRetention).UTC().Format("2006-01-02")
+	return s.exec(`DELETE FROM weather_llm_usage WHERE date < $1`, cutoff)
+}
+
+func (s *postgresStorage) usage(date string) (UsageTotals, bool, error) {
+	totals := UsageTotals{Date: date}
+	ctx, cancel := postgresContext()
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, `SELECT requests, input_tokens, output_tokens, cost_usd
+		FROM weather_llm_usage WHERE date = $1`, date).Scan(&totals.Requests, &totals.InputTokens, &totals.OutputTokens, &totals.CostUSD)
+	if errors.Is(err, sql.ErrNoRows) {
+		return totals, false, nil
+	}
+	if err != nil {
+		return totals, false, err
+	}
+	totals.TotalTokens = totals.InputTokens + totals.OutputTokens
+	return totals, true, nil
+}
+
+func (s *postgresStorage) putSensorReading(reading SensorReading, keep int) error {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		return err
+	}
+	err = s.exec(`INSERT INTO weather_sensor_readings (sensor, time, data) VALUES ($1, $2, $3)
+		ON CONFLICT (sensor, time) DO UPDATE SET data = EXCLUDED.data`, reading.Sensor, reading.Time, data)
+	if err != nil {
+		return err
+	}
+	// Everything at or before the first reading past the newest keep
+	return s.exec(`DELETE FROM weather_sensor_readings WHERE sensor = $1 AND time <= (
+		SELECT time FROM weather_sensor_readings WHERE sensor = $1 ORDER BY time DESC OFFSET $2 LIMIT 1)`, reading.Sensor, keep)
+}
+
+func (s *postgresStorage) sensorReadingsSince(t time.Time, sensor string) ([]SensorReading, error) {
+	readings := make([]SensorReading, 0)
+	err := s.queryJSON(func(data []byte) error {
+		var reading SensorReading
+		if err := json.Unmarshal(data, &reading); err != nil {
+			return fmt.Errorf("invalid stored sensor reading: %v", err)
+		}
+		readings = append(readings, reading)
+		return nil
+	}, `SELECT data FROM weather_sensor_readings
+		WHERE time >= $1 AND ($2::text = '' OR sensor = $2::text) ORDER BY time`, t, sensor)
+	if err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+func (s *postgresStorage) sensorNames() ([]string, error) {
+	ctx, cancel := postgresContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT sensor FROM weather_sensor_readings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *postgresStorage) putPrompt(record PromptRecord, keep int) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = s.exec(`INSERT INTO weather_prompts (id, time, model, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data`, record.ID, record.Time, record.Model, data)
+	if err != nil {
+		return err
+	}
+	// Everything at or before the first prompt past the newest keep
+	return s.exec(`DELETE FROM weather_prompts WHERE time <= (
+		SELECT time FROM weather_prompts ORDER BY time DESC OFFSET $1 LIMIT 1)`, keep)
+}
+
+// Decode stored prompts
+func (s *postgresStorage) queryPrompts(query string, args ...interface{}) ([]PromptRecord, error) {
+	records := make([]PromptRecord, 0)
+	err := s.queryJSON(func(data []byte) error {
+		var record PromptRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid stored prompt: %v", err)
+		}
+		records = append(records, record)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *postgresStorage) prompts(model string, limit int) ([]PromptRecord, error) {
+	return s.queryPrompts(`SELECT data FROM weather_prompts
+		WHERE ($1::text = '' OR model = $1::text) ORDER BY time DESC LIMIT $2`, model, limit)
+}
+
+func (s *postgresStorage) prompt(id string) (PromptRecord, bool, error) {
+	records, err := s.queryPrompts(`SELECT data FROM weather_prompts WHERE id = $1`, id)
+	if err != nil || len(records) == 0 {
+		return PromptRecord{}, false, err
+	}
+	return records[0], true, nil
+}
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of notification endpoints a single user can register
+const maxSubscriptionsPerOwner = 20
+
+// Which kinds of notification a subscription receives
+type SubscriptionPreferences struct {
+	Digest  bool `json:"digest"`
+	Updates bool `json:"updates"`
+	Alerts  bool `json:"alerts"`
+}
+
+// Whether the preferences include the given notification type
+func (p SubscriptionPreferences) wants(notificationType string) bool {
+	switch notificationType {
+	case NotificationDigest, NotificationReport:
+		return p.Digest
+	case NotificationUpdate:
+		return p.Updates
+	case NotificationAlert:
+		return p.Alerts
+	}
+	return false
+}
+
+// A user-managed notification endpoint
+type Subscription struct {
+	ID          string                  `json:"id"`
+	Owner       string                  `json:"-"`
+	Channel     string                  `json:"channel"`
+	Target      string                  `json:"target"` // Email address, Telegram chat ID, or webhook URL
+	Verified    bool                    `json:"verified"`
+	Preferences SubscriptionPreferences `json:"preferences"`
+	Location    *ProfileLocation        `json:"location,omitempty"` // Where its weather is for (the configured location if empty)
+	CreatedAt   time.Time               `json:"created_at"`
+}
+
+// Key of the subscription's location, or "" for the configured location
+func (s Subscription) locationKey() string {
+	return subscriberLocationKey(s.Location)
+}
+
+// On-disk form of a subscription, which keeps the owner
+type storedSubscription struct {
+	Subscription
+	Owner string `json:"owner"`
+}
+
+// Identify the owner of a request by a hash of their API key, so keys are
+// never stored
+func subscriptionOwner(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Identify a user logged into the UI. The prefix keeps them apart from API
+// key owners, which are plain hex.
+func sessionOwner(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return "user:" + hex.EncodeToString(sum[:8])
+}
+
+// Check that the target is well-formed for the channel and normalize it
+func validateSubscriptionTarget(channel, target string) (string, error) {
+	target = strings.TrimSpace(target)
+	switch channel {
+	case ChannelEmail:
+		addr, err := mail.ParseAddress(target)
+		if err != nil {
+			return "", fmt.Errorf("invalid email address")
+		}
+		return addr.Address, nil
+	case ChannelTelegram:
+		if target == "" || strings.TrimLeft(target, "-0123456789") != "" {
+			return "", fmt.Errorf("Telegram chat ID must be numeric")
+		}
+		return target, nil
+	case ChannelWebhook:
+		if _, err := newWebhookNotifier(target); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("unsupported channel %q (use email, telegram, or webhook)", channel)
+}
+
+// Concurrency-safe subscription registry, optionally saved to a JSON file
+// or kept in a database shared with other replicas
+type subscriptionStore struct {
+	mu           sync.Mutex
+	path         string
+	db           storage // Used instead of the file when set
+	items        map[string]*Subscription
+	maxLocations int // Distinct subscriber locations allowed, each costing a fetch and message per run (0 for no limit)
+}
+
+// Create a store, loading existing subscriptions from path if given
+func newSubscriptionStore(path string) (*subscriptionStore, error) {
+	s := &subscriptionStore{path: path, items: make(map[string]*Subscription)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading subscriptions file: %v", err)
+	}
+
+	var stored []storedSubscription
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error parsing subscriptions file: %v", err)
+	}
+	s.load(stored)
+	return s, nil
+}
+
+// Create a store keeping subscriptions in a database
+func newDatabaseSubscriptionStore(db storage) (*subscriptionStore, error) {
+	s := &subscriptionStore{db: db}
+	if err := s.refresh(); err != nil {
+		return nil, fmt.Errorf("error loading subscriptions: %v", err)
+	}
+	return s, nil
+}
+
+// Replace the registry with stored subscriptions
+func (s *subscriptionStore) load(stored []storedSubscription) {
+	s.items = make(map[string]*Subscription, len(stored))
+	for _, st := range stored {
+		sub := st.Subscription
+		sub.Owner = st.Owner
+		s.items[sub.ID] = &sub
+	}
+}
+
+// Pick up changes other replicas made to the database. Readers ignore
+// errors and carry on with the last copy. Callers must hold s.mu.
+func (s *subscriptionStore) refresh() error {
+	if s.db == nil {
+		return nil
+	}
+	stored, err := s.db.loadSubscriptions()
+	if err != nil {
+		return err
+	}
+	s.load(stored)
+	return nil
+}
+
+// Save a new or changed subscription. Callers must hold s.mu.
+func (s *subscriptionStore) put(sub *Subscription) error {
+	if s.db != nil {
+		return s.db.putSubscription(storedSubscription{Subscription: *sub, Owner: sub.Owner})
+	}
+	return s.save()
+}
+
+// Write all subscriptions to disk. Callers must hold s.mu.
+func (s *subscriptionStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]storedSubscription, 0, len(s.items))
+	for _, sub := range s.sorted("") {
+		stored = append(stored, storedSubscription{Subscription: sub, Owner: sub.Owner})
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error saving subscriptions: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Subscriptions ordered by creation time, optionally for one owner. Callers must hold s.mu.
+func (s *subscriptionStore) sorted(owner string) []Subscription {
+	result := make([]Subscription, 0)
+	for _, sub := range s.items {
+		if owner != "" && sub.Owner != owner {
+			continue
+		}
+		result = append(result, *sub)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Subscriptions belonging to owner
+func (s *subscriptionStore) list(owner string) []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	return s.sorted(owner)
+}
+
+// Check another subscription can be at loc without exceeding maxLocations.
+// Callers must hold s.mu.
+func (s *subscriptionStore) checkLocationLimit(loc *ProfileLocation) error {
+	if loc == nil || s.maxLocations <= 0 {
+		return nil
+	}
+	locations := map[string]bool{loc.key(): true}
+	for _, sub := range s.items {
+		if sub.Location != nil {
+			locations[sub.Location.key()] = true
+		}
+	}
+	if len(locations) > s.maxLocations {
+		return fmt.Errorf("this server serves at most %d subscriber locations; pick an existing one or use the default", s.maxLocations)
+	}
+	return nil
+}
+
+// Register a new, unverified subscription, at loc if given
+func (s *subscriptionStore) add(owner, channel, target string, prefs SubscriptionPreferences, loc *ProfileLocation) (Subscription, error) {
+	target, err := validateSubscriptionTarget(channel, target)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Subscription{}, err
+	}
+
+	existing := s.sorted(owner)
+	if len(existing) >= maxSubscriptionsPerOwner {
+		return Subscription{}, fmt.Errorf("subscription limit of %d reached", maxSubscriptionsPerOwner)
+	}
+	for _, sub := range existing {
+		if sub.Channel == channel && sub.Target == target && sub.locationKey() == subscriberLocationKey(loc) {
+			return Subscription{}, fmt.Errorf("%s subscription for %s already exists", channel, target)
+		}
+	}
+	if err := s.checkLocationLimit(loc); err != nil {
+		return Subscription{}, err
+	}
+
+	sub := &Subscription{
+		ID:          newMessageID(),
+		Owner:       owner,
+		Channel:     channel,
+		Target:      target,
+		Preferences: prefs,
+		Location:    loc,
+		CreatedAt:   time.Now(),
+	}
+	s.items[sub.ID] = sub
+	return *sub, s.put(sub)
+}
+
+// Look up a subscription belonging to owner
+func (s *subscriptionStore) get(owner, id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	sub, ok := s.items[id]
+	if !ok || sub.Owner != owner {
+		return Subscription{}, false
+	}
+	return *sub, true
+}
+
+// Apply a change to a subscription belonging to owner and save
+func (s *subscriptionStore) update(owner, id string, change func(sub *Subscription)) (Subscription, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Subscription{}, false, err
+	}
+	sub, ok := s.items[id]
+	if !ok || sub.Owner != owner {
+		return Subscription{}, false, nil
+	}
+	change(sub)
+	return *sub, true, s.put(sub)
+}
+
+// Move a subscription belonging to owner to loc, or back to the configured
+// location if nil
+func (s *subscriptionStore) move(owner, id string, loc *ProfileLocation) (Subscription, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Subscription{}, false, err
+	}
+	sub, ok := s.items[id]
+	if !ok || sub.Owner != owner {
+		return Subscription{}, false, nil
+	}
+	if subscriberLocationKey(loc) != sub.locationKey() {
+		if err := s.checkLocationLimit(loc); err != nil {
+			return *sub, true, err
+		}
+	}
+	sub.Location = loc
+	return *sub, true, s.put(sub)
+}
+
+// Delete a subscription belonging to owner
+func (s *subscriptionStore) remove(owner, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return false, err
+	}
+	sub, ok := s.items[id]
+	if !ok || sub.Owner != owner {
+		return false, nil
+	}
+	delete(s.items, id)
+	if s.db != nil {
+		return true, s.db.deleteSubscription(id)
+	}
+	return true, s.save()
+}
+
+// Verified subscriptions, across all owners, at the location with the given
+// key ("" for the configured location) that want the notification type
+func (s *subscriptionStore) recipients(notificationType, location string) []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	var result []Subscription
+	for _, sub := range s.sorted("") {
+		if sub.Verified && sub.Preferences.wants(notificationType) && sub.locationKey() == location {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// Distinct locations of verified subscriptions that want the notification
+// type, other than the configured location. Each needs its own fetch and message.
+func (s *subscriptionStore) locations(notificationType string) []ProfileLocation {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	seen := make(map[string]bool)
+	var result []ProfileLocation
+	for _, sub := range s.sorted("") {
+		if sub.Location == nil || !sub.Verified || !sub.Preferences.wants(notificationType) || seen[sub.locationKey()] {
+			continue
+		}
+		seen[sub.locationKey()] = true
+		result = append(result, *sub.Location)
+	}
+	return result
+}
+
+// Key of a subscriber location, or "" for the configured location
+func subscriberLocationKey(loc *ProfileLocation) string {
+	if loc == nil {
+		return ""
+	}
+	return loc.key()
+}
+
+// Run send for the configured location (loc nil) and each subscriber
+// location wanting the notification type, FETCH_CONCURRENCY at a time,
+// carrying on past failures
+func (agent *WeatherAgent) forEachLocation(notificationType string, send func(loc *ProfileLocation) error) error {
+	locations := []*ProfileLocation{nil}
+	for _, loc := range agent.subscriptions.locations(notificationType) {
+		loc := loc
+		locations = append(locations, &loc)
+	}
+
+	// Errors are kept in location order, so the joined error reads the same every run
+	errs := make([]error, len(locations))
+	forEachLimit(len(locations), agent.config.FetchConcurrency, func(i int) {
+		err := send(locations[i])
+		if err != nil && locations[i] != nil {
+			err = fmt.Errorf("%s: %v", locations[i].label(), err)
+		}
+		errs[i] = err
+	})
+	return errors.Join(errs...)
+}
+
+// Current weather at a subscriber location, or the configured one if nil
+func (agent *WeatherAgent) weatherAt(loc *ProfileLocation) (WeatherResponse, error) {
+	if loc == nil {
+		return agent.fetchWeather()
+	}
+	return agent.fetchWeatherByCoordinates(loc.Lat, loc.Lon)
+}
+
+// Coordinates of a subscriber location, or the configured one if nil
+func (agent *WeatherAgent) coordinatesAt(loc *ProfileLocation) (float64, float64, error) {
+	if loc == nil {
+		return agent.getCoordinates(agent.location())
+	}
+	return loc.Lat, loc.Lon, nil
+}
+
+// Build the notifier that delivers to a subscription's endpoint
+func (agent *WeatherAgent) subscriptionNotifier(sub Subscription) (Notifier, error) {
+	switch sub.Channel {
+	case ChannelEmail:
+		smtpConfig := agent.config.SMTP
+		smtpConfig.Recipients = []string{sub.Target}
+		return newEmailNotifier(smtpConfig)
+	case ChannelTelegram:
+		notifier, err := newTelegramNotifier(agent.config.TelegramBotToken, sub.Target)
+		if err != nil {
+			return nil, err
+		}
+		notifier.client = agent.httpClient(notifierHTTPTimeout)
+		return notifier, nil
+	case ChannelWebhook:
+		notifier, err := newWebhookNotifier(sub.Target)
+		if err != nil {
+			return nil, err
+		}
+		notifier.client = agent.publicHTTPClient(notifierHTTPTimeout)
+		return notifier, nil
+	}
+	return nil, fmt.Errorf("unsupported channel %q", sub.Channel)
+}
+
+// Send a test message to a subscription and mark it verified if it arrives
+func (agent *WeatherAgent) verifySubscription(sub Subscription) error {
+	notifier, err := agent.subscriptionNotifier(sub)
+	if err != nil {
+		return err
+	}
+
+	city, country := agent.location()
+	n := Notification{
+		MessageID: newMessageID(),
+		Type:      NotificationUpdate,
+		Title:     "Weather Agent test message",
+		Message:   "This endpoint is now set up to receive weather notifications.",
+		City:      city,
+		Country:   country,
+		Units:     agent.config.Units,
+		Time:      time.Now(),
+	}
+	if err := agent.deliver(notifier, n); err != nil {
+		return err
+	}
+
+	_, _, err = agent.subscriptions.update(sub.Owner, sub.ID, func(s *Subscription) {
+		s.Verified = true
+	})
+	return err
+}
+
+// Channels users can subscribe through with the current configuration
+func (agent *WeatherAgent) availableSubscriptionChannels() []string {
+	var channels []string
+	if agent.config.SMTP.Host != "" && agent.config.SMTP.From != "" {
+		channels = append(channels, ChannelEmail)
+	}
+	if agent.config.TelegramBotToken != "" {
+		channels = append(channels, ChannelTelegram)
+	}
+	return append(channels, ChannelWebhook)
+}
+
+// Validate and geocode a subscription's location, answering the request
+// with an error and returning false if it can't be used
+func (agent *WeatherAgent) resolveSubscriptionLocation(w http.ResponseWriter, loc *ProfileLocation) bool {
+	if err := validateProfileLocation(loc); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := agent.resolveProfileLocation(loc); err != nil {
+		apiError(w, "Unable to resolve location", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// GET lists the caller's subscriptions; POST adds one
+func (agent *WeatherAgent) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	owner := requestOwner(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, SubscriptionsResponse{
+			Channels:      agent.availableSubscriptionChannels(),
+			Subscriptions: agent.subscriptions.list(owner),
+		})
+
+	case http.MethodPost:
+		var req SubscriptionRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+			apiError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		available := false
+		for _, channel := range agent.availableSubscriptionChannels() {
+			if channel == req.Channel {
+				available = true
+			}
+		}
+		if !available {
+			apiError(w, fmt.Sprintf("Channel %q is not available", req.Channel), http.StatusBadRequest)
+			return
+		}
+
+		// Default to everything except per-refresh updates
+		prefs := SubscriptionPreferences{Digest: true, Alerts: true}
+		if req.Preferences != nil {
+			prefs = *req.Preferences
+		}
+		if req.Location != nil && !agent.resolveSubscriptionLocation(w, req.Location) {
+			return
+		}
+
+		sub, err := agent.subscriptions.add(owner, req.Channel, req.Target, prefs, req.Location)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, sub)
+
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PATCH updates preferences; DELETE removes the subscription
+func (agent *WeatherAgent) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	owner := requestOwner(r)
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPatch:
+		var req SubscriptionUpdateRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16*1024)).Decode(&req); err != nil {
+			apiError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Preferences == nil && req.Location == nil && !req.DefaultLocation {
+			apiError(w, "Nothing to update (set preferences, location or default_location)", http.StatusBadRequest)
+			return
+		}
+		sub, found := agent.subscriptions.get(owner, id)
+		if !found {
+			apiError(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+
+		if req.Location != nil || req.DefaultLocation {
+			if req.Location != nil && !agent.resolveSubscriptionLocation(w, req.Location) {
+				return
+			}
+			var err error
+			if sub, _, err = agent.subscriptions.move(owner, id, req.Location); err != nil {
+				apiError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Preferences != nil {
+			var err error
+			if sub, _, err = agent.subscriptions.update(owner, id, func(s *Subscription) {
+				s.Preferences = *req.Preferences
+			}); err != nil {
+				apiError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, sub)
+
+	case http.MethodDelete:
+		found, err := agent.subscriptions.remove(owner, id)
+		if !found {
+			apiError(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST sends a test message and marks the subscription verified on success
+func (agent *WeatherAgent) handleVerifySubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	owner := requestOwner(r)
+	sub, ok := agent.subscriptions.get(owner, r.PathValue("id"))
+	if !ok {
+		apiError(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	// The error isn't echoed, as it would tell callers which internal hosts answer
+	if err := agent.verifySubscription(sub); err != nil {
+		agent.logger.Printf("Test message to subscription %s failed: %v", sub.ID, err)
+		apiError(w, "Test message failed", http.StatusBadGateway)
+		return
+	}
+
+	sub, _ = agent.subscriptions.get(owner, sub.ID)
+	writeJSON(w, http.StatusOK, sub)
+}
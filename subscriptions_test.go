@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateSubscriptionTarget(t *testing.T) {
+	tests := []struct {
+		channel string
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{ChannelEmail, " Jo <jo@example.com> ", "jo@example.com", false},
+		{ChannelEmail, "not-an-email", "", true},
+		{ChannelTelegram, "-100123456", "-100123456", false},
+		{ChannelTelegram, "@channel", "", true},
+		{ChannelWebhook, "https://example.com/hook", "https://example.com/hook", false},
+		{ChannelWebhook, "ftp://example.com/hook", "", true},
+		{"sms", "+15550100", "", true},
+	}
+	for _, tt := range tests {
+		got, err := validateSubscriptionTarget(tt.channel, tt.target)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("validateSubscriptionTarget(%q, %q) = %q, %v", tt.channel, tt.target, got, err)
+		}
+	}
+}
+
+func TestSubscriptionStoreOwnershipAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	store, err := newSubscriptionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob := subscriptionOwner("alice-key"), subscriptionOwner("bob-key")
+	sub, err := store.add(alice, ChannelWebhook, "https://example.com/a", SubscriptionPreferences{Alerts: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.add(alice, ChannelWebhook, "https://example.com/a", SubscriptionPreferences{}, nil); err == nil {
+		t.Error("duplicate subscription should be rejected")
+	}
+
+	if len(store.list(bob)) != 0 {
+		t.Error("bob should not see alice's subscriptions")
+	}
+	if _, ok := store.get(bob, sub.ID); ok {
+		t.Error("bob should not be able to read alice's subscription")
+	}
+	if found, _ := store.remove(bob, sub.ID); found {
+		t.Error("bob should not be able to delete alice's subscription")
+	}
+
+	reloaded, err := newSubscriptionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs := reloaded.list(alice)
+	if len(subs) != 1 || subs[0].ID != sub.ID || !subs[0].Preferences.Alerts {
+		t.Fatalf("subscription not persisted with owner: %+v", subs)
+	}
+}
+
+func TestVerifiedSubscriptionsReceiveNotifications(t *testing.T) {
+	var received []webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	store, _ := newSubscriptionStore("")
+	agent := &WeatherAgent{
+		logger:        log.New(io.Discard, "", 0),
+		deliveries:    newDeliveryLog(),
+		subscriptions: store,
+	}
+
+	owner := subscriptionOwner("key")
+	sub, err := store.add(owner, ChannelWebhook, server.URL, SubscriptionPreferences{Alerts: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unverified subscriptions get nothing
+	agent.notify(Notification{Type: NotificationAlert, Message: "storm"})
+	if len(received) != 0 {
+		t.Fatalf("unverified subscription received %d notifications", len(received))
+	}
+
+	if err := agent.verifySubscription(sub); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.get(owner, sub.ID); !got.Verified {
+		t.Fatal("subscription should be verified after a successful test message")
+	}
+
+	agent.notify(Notification{Type: NotificationAlert, Message: "storm"})
+	agent.notify(Notification{Type: NotificationDigest, Message: "morning"})
+
+	if len(received) != 2 {
+		t.Fatalf("expected test message and one alert, got %d", len(received))
+	}
+	if received[1].Message != "storm" {
+		t.Errorf("unexpected alert payload %+v", received[1])
+	}
+	if deliveries := agent.deliveries.list(ChannelWebhook, "", 0); len(deliveries) != 2 {
+		t.Errorf("expected 2 webhook delivery receipts, got %d", len(deliveries))
+	}
+}
+
+func TestSubscriptionLocations(t *testing.T) {
+	store, _ := newSubscriptionStore("")
+	store.maxLocations = 2
+	alice, bob := subscriptionOwner("alice-key"), subscriptionOwner("bob-key")
+	leeds := &ProfileLocation{City: "Leeds", Country: "GB", Lat: 53.7965, Lon: -1.5478}
+	paris := &ProfileLocation{City: "Paris", Country: "FR", Lat: 48.8534, Lon: 2.3488}
+
+	home, _ := store.add(alice, ChannelWebhook, "https://example.com/a", SubscriptionPreferences{Alerts: true}, nil)
+	away, err := store.add(alice, ChannelWebhook, "https://example.com/a", SubscriptionPreferences{Alerts: true}, leeds)
+	if err != nil {
+		t.Fatalf("same target at another location: %v", err)
+	}
+	if _, err := store.add(bob, ChannelWebhook, "https://example.com/b", SubscriptionPreferences{Alerts: true}, leeds); err != nil {
+		t.Fatalf("existing location should not count against the limit: %v", err)
+	}
+	if _, err := store.add(bob, ChannelWebhook, "https://example.com/b", SubscriptionPreferences{}, paris); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.add(bob, ChannelWebhook, "https://example.com/c", SubscriptionPreferences{}, &ProfileLocation{Lat: 1, Lon: 2}); err == nil {
+		t.Error("a third location should be over the limit")
+	}
+	for _, sub := range store.list("") {
+		store.update(sub.Owner, sub.ID, func(s *Subscription) { s.Verified = true })
+	}
+
+	if locations := store.locations(NotificationAlert); len(locations) != 1 || locations[0].City != "Leeds" {
+		t.Errorf("alert locations = %+v, want Leeds once", locations)
+	}
+	if subs := store.recipients(NotificationAlert, ""); len(subs) != 1 || subs[0].ID != home.ID {
+		t.Errorf("recipients at the configured location = %+v", subs)
+	}
+	if subs := store.recipients(NotificationAlert, leeds.key()); len(subs) != 2 {
+		t.Errorf("got %d recipients in Leeds, want 2", len(subs))
+	}
+
+	if moved, _, err := store.move(alice, away.ID, nil); err != nil || moved.Location != nil {
+		t.Errorf("move to the configured location = %+v, %v", moved, err)
+	}
+	if _, _, err := store.move(alice, away.ID, &ProfileLocation{Lat: 1, Lon: 2}); err == nil {
+		t.Error("moving to a new location over the limit should fail")
+	}
+	if _, found, _ := store.move(bob, home.ID, leeds); found {
+		t.Error("bob should not be able to move alice's subscription")
+	}
+}
+
+func TestHandleSubscriptionLocation(t *testing.T) {
+	store, _ := newSubscriptionStore("")
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), subscriptions: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/subscriptions", agent.handleSubscriptions)
+	mux.HandleFunc("/api/v1/subscriptions/{id}", agent.handleSubscription)
+	send := func(method, path, body string) (int, Subscription) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var sub Subscription
+		json.Unmarshal(rec.Body.Bytes(), &sub)
+		return rec.Code, sub
+	}
+
+	status, sub := send(http.MethodPost, "/api/v1/subscriptions",
+		`{"channel":"webhook","target":"https://example.com/hook","location":{"lat":53.7965,"lon":-1.5478}}`)
+	if status != http.StatusCreated || sub.Location == nil || sub.Location.Lat != 53.7965 {
+		t.Fatalf("create: got %d, %+v", status, sub)
+	}
+	if status, _ := send(http.MethodPost, "/api/v1/subscriptions",
+		`{"channel":"webhook","target":"https://example.com/other","location":{"lat":123,"lon":0}}`); status != http.StatusBadRequest {
+		t.Errorf("create with invalid coordinates: got %d", status)
+	}
+
+	path := "/api/v1/subscriptions/" + sub.ID
+	if status, _ := send(http.MethodPatch, path, `{}`); status != http.StatusBadRequest {
+		t.Errorf("empty update: got %d", status)
+	}
+	status, sub = send(http.MethodPatch, path, `{"preferences":{"updates":true}}`)
+	if status != http.StatusOK || !sub.Preferences.Updates || sub.Location == nil {
+		t.Errorf("preferences update: got %d, %+v", status, sub)
+	}
+	status, sub = send(http.MethodPatch, path, `{"default_location":true}`)
+	if status != http.StatusOK || sub.Location != nil || !sub.Preferences.Updates {
+		t.Errorf("move to the configured location: got %d, %+v", status, sub)
+	}
+}
+
+func TestScheduledUpdateFansOutToSubscriberLocations(t *testing.T) {
+	fixtures := useFixtures(t, defaultFixtures())
+	received := make(map[string]webhookPayload)
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received[r.URL.Path] = payload
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	agent := newFixtureAgent(t, Config{UpdateIntervalMinutes: 60, UpdateMaxIntervalMinutes: 240})
+	agent.llm = &fakeLLM{reply: "Mild with some cloud."}
+	agent.deliveries = newDeliveryLog()
+	agent.engagement = newEngagementTracker("", "secret")
+	agent.subscriptions, _ = newSubscriptionStore("")
+	leeds := &ProfileLocation{City: "Leeds", Country: "GB", Lat: 53.7965, Lon: -1.5478}
+	for path, loc := range map[string]*ProfileLocation{"/home": nil, "/leeds": leeds, "/leeds-too": leeds} {
+		sub, err := agent.subscriptions.add("", ChannelWebhook, server.URL+path, SubscriptionPreferences{Updates: true}, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent.subscriptions.update("", sub.ID, func(s *Subscription) { s.Verified = true })
+	}
+
+	if err := agent.sendScheduledUpdate(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 3 {
+		t.Fatalf("got updates at %v, want three", received)
+	}
+	if received["/leeds"].MessageID != received["/leeds-too"].MessageID || received["/leeds"].MessageID == received["/home"].MessageID {
+		t.Error("subscribers at one location should share a message, separate from the configured location's")
+	}
+	// One forecast for Oslo and one for Leeds
+	if n := fixtures.count("api.open-meteo.com"); n != 2 {
+		t.Errorf("forecast requested %d times, want 2", n)
+	}
+}
+
+func TestHandleVerifySubscriptionRefusesInternalTargets(t *testing.T) {
+	var logged strings.Builder
+	agent := &WeatherAgent{
+		logger:     log.New(&logged, "", 0),
+		publicHTTP: newPublicHTTPClient(Config{}),
+		deliveries: newDeliveryLog(),
+	}
+	agent.subscriptions, _ = newSubscriptionStore("")
+	sub, err := agent.subscriptions.add("", ChannelWebhook, "http://169.254.169.254/latest/meta-data/", SubscriptionPreferences{Alerts: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/subscriptions/{id}/verify", agent.handleVerifySubscription)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/"+sub.ID+"/verify", nil))
+	if rec.Code != http.StatusBadGateway || strings.Contains(rec.Body.String(), "169.254") {
+		t.Errorf("got %d %s, want a 502 without the error's detail", rec.Code, rec.Body)
+	}
+	if !strings.Contains(logged.String(), "non-public address") {
+		t.Errorf("the error should be logged, got %q", logged.String())
+	}
+	if sub, _ := agent.subscriptions.get("", sub.ID); sub.Verified {
+		t.Error("subscription should stay unverified")
+	}
+}
+
+func TestForEachLocationConcurrency(t *testing.T) {
+	agent := &WeatherAgent{config: Config{FetchConcurrency: 2}, logger: log.New(io.Discard, "", 0)}
+	agent.subscriptions, _ = newSubscriptionStore("")
+	for _, loc := range []*ProfileLocation{
+		{City: "Leeds", Country: "GB", Lat: 53.7965, Lon: -1.5478},
+		{City: "Paris", Country: "FR", Lat: 48.8534, Lon: 2.3488},
+		{City: "Oslo", Country: "NO", Lat: 59.9127, Lon: 10.7461},
+	} {
+		sub, err := agent.subscriptions.add("", ChannelWebhook, "https://example.com/"+loc.City, SubscriptionPreferences{Digest: true}, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent.subscriptions.update("", sub.ID, func(s *Subscription) { s.Verified = true })
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var visited []string
+	err := agent.forEachLocation(NotificationDigest, func(loc *ProfileLocation) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		name := "home"
+		if loc != nil {
+			name = loc.City
+		}
+		visited = append(visited, name)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if name == "Paris" {
+			return errors.New("no forecast")
+		}
+		return nil
+	})
+
+	if len(visited) != 4 {
+		t.Errorf("visited %v, want the configured location and three subscriber locations", visited)
+	}
+	if peak != 2 {
+		t.Errorf("%d locations ran at once, want FETCH_CONCURRENCY (2)", peak)
+	}
+	if err == nil || err.Error() != "Paris, FR: no forecast" {
+		t.Errorf("err = %v, want Paris's failure labelled", err)
+	}
+}
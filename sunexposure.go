@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Minimal erythemal dose (J/m²) for each Fitzpatrick skin type (I-VI)
+var skinTypeMED = map[int]float64{
+	1: 200,
+	2: 250,
+	3: 350,
+	4: 450,
+	5: 600,
+	6: 1000,
+}
+
+// One UV index unit corresponds to 25 mW/m² of erythemally weighted irradiance
+const uvIndexIrradiance = 0.025
+
+// UV index at which vitamin D synthesis becomes effective
+const vitaminDMinUV = 3.0
+
+// UV index above which exposure should be limited regardless of skin type
+const highUVThreshold = 6.0
+
+// A contiguous period of the day with similar UV conditions
+type SunWindow struct {
+	Start time.Time
+	End   time.Time
+	MaxUV float64
+}
+
+// Sun exposure recommendation for the current conditions
+type SunExposure struct {
+	SkinType        int
+	UVIndex         float64
+	BurnMinutes     int         // Unprotected minutes until sunburn at the current UV index
+	VitaminDMinutes int         // Suggested minutes for vitamin D synthesis (face, arms and hands exposed)
+	VitaminDWindows []SunWindow // Periods where UV is high enough for vitamin D but not extreme
+	HighUVWindows   []SunWindow // Periods where sun protection is strongly recommended
+}
+
+// Minutes of unprotected exposure before burning for a skin type at a UV index
+func burnMinutes(skinType int, uvIndex float64) int {
+	med, ok := skinTypeMED[skinType]
+	if !ok {
+		med = skinTypeMED[3]
+	}
+	if uvIndex <= 0 {
+		return 0
+	}
+	seconds := med / (uvIndex * uvIndexIrradiance)
+	return int(math.Round(seconds / 60))
+}
+
+// Estimate safe sun exposure for the given skin type from current and hourly UV data
+func estimateSunExposure(skinType int, uvIndex float64, hourly []HourlyValue, loc *time.Location) SunExposure {
+	if _, ok := skinTypeMED[skinType]; !ok {
+		skinType = 3
+	}
+
+	exposure := SunExposure{
+		SkinType: skinType,
+		UVIndex:  uvIndex,
+	}
+
+	if uvIndex > 0 {
+		exposure.BurnMinutes = burnMinutes(skinType, uvIndex)
+		// Roughly a quarter of a burning dose on ~25% of the body is enough
+		// for a daily vitamin D dose
+		exposure.VitaminDMinutes = int(math.Round(float64(exposure.BurnMinutes) / 4))
+	}
+
+	exposure.VitaminDWindows = uvWindows(hourly, loc, func(uv float64) bool {
+		return uv >= vitaminDMinUV && uv < highUVThreshold
+	})
+	exposure.HighUVWindows = uvWindows(hourly, loc, func(uv float64) bool {
+		return uv >= highUVThreshold
+	})
+
+	return exposure
+}
+
+// Group consecutive hours matching a predicate into windows
+func uvWindows(hourly []HourlyValue, loc *time.Location, match func(float64) bool) []SunWindow {
+	var windows []SunWindow
+	var current *SunWindow
+
+	for _, h := range hourly {
+		t := time.Unix(h.Time, 0).In(loc)
+		if match(h.Value) {
+			if current == nil {
+				windows = append(windows, SunWindow{Start: t, End: t.Add(time.Hour), MaxUV: h.Value})
+				current = &windows[len(windows)-1]
+			} else {
+				current.End = t.Add(time.Hour)
+				current.MaxUV = math.Max(current.MaxUV, h.Value)
+			}
+		} else {
+			current = nil
+		}
+	}
+
+	return windows
+}
+
+// Format windows as a human readable list like "10:00 AM-12:00 PM"
+func formatSunWindows(windows []SunWindow) []string {
+	formatted := make([]string, 0, len(windows))
+	for _, w := range windows {
+		formatted = append(formatted, fmt.Sprintf("%s-%s (max UV %.1f)",
+			w.Start.Format("3:04 PM"), w.End.Format("3:04 PM"), w.MaxUV))
+	}
+	return formatted
+}
+
+// Describe the UV index according to the WHO exposure categories
+func uvIndexCategory(uv float64) string {
+	switch {
+	case uv < 3:
+		return "Low"
+	case uv < 6:
+		return "Moderate"
+	case uv < 8:
+		return "High"
+	case uv < 11:
+		return "Very High"
+	default:
+		return "Extreme"
+	}
+}
+
+// Whether the current conditions count as a sunny day
+func isSunnyCondition(condition string, isDaytime bool) bool {
+	return isDaytime && (condition == "Clear" || condition == "Mainly Clear")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBurnMinutes(t *testing.T) {
+	tests := []struct {
+		skinType int
+		uv       float64
+		want     int
+	}{
+		{1, 10, 13}, // 200 / (10*0.025) = 800s
+		{3, 5, 47},  // 350 / (5*0.025) = 2800s
+		{6, 8, 83},  // 1000 / (8*0.025) = 5000s
+		{9, 5, 47},  // unknown skin type falls back to type III
+		{2, 0, 0},   // no UV, no burn
+	}
+
+	for _, tt := range tests {
+		if got := burnMinutes(tt.skinType, tt.uv); got != tt.want {
+			t.Errorf("burnMinutes(%d, %.1f) = %d, want %d", tt.skinType, tt.uv, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateSunExposureWindows(t *testing.T) {
+	loc := time.FixedZone("Local", 0)
+	start := time.Date(2024, 6, 21, 8, 0, 0, 0, loc)
+	values := []float64{1, 3, 4, 6, 7, 5, 2}
+
+	hourly := make([]HourlyValue, len(values))
+	for i, v := range values {
+		hourly[i] = HourlyValue{Time: start.Add(time.Duration(i) * time.Hour).Unix(), Value: v}
+	}
+
+	exposure := estimateSunExposure(2, 7, hourly, loc)
+
+	if len(exposure.VitaminDWindows) != 2 {
+		t.Fatalf("expected 2 vitamin D windows, got %d", len(exposure.VitaminDWindows))
+	}
+	if got := exposure.VitaminDWindows[0].Start.Hour(); got != 9 {
+		t.Errorf("first vitamin D window starts at %d, want 9", got)
+	}
+	if got := exposure.VitaminDWindows[0].End.Hour(); got != 11 {
+		t.Errorf("first vitamin D window ends at %d, want 11", got)
+	}
+
+	if len(exposure.HighUVWindows) != 1 {
+		t.Fatalf("expected 1 high UV window, got %d", len(exposure.HighUVWindows))
+	}
+	if got := exposure.HighUVWindows[0].MaxUV; got != 7 {
+		t.Errorf("high UV window max = %.1f, want 7", got)
+	}
+	if exposure.VitaminDMinutes*4-exposure.BurnMinutes > 2 {
+		t.Errorf("vitamin D minutes %d should be about a quarter of burn minutes %d",
+			exposure.VitaminDMinutes, exposure.BurnMinutes)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Base URL of the Telegram Bot API
+const telegramAPIBase = "https://api.telegram.org"
+
+// Notifier that sends messages to a Telegram chat through a bot
+type telegramNotifier struct {
+	token   string
+	chatID  string
+	apiBase string
+	client  *http.Client
+}
+
+func newTelegramNotifier(token, chatID string) (*telegramNotifier, error) {
+	if token == "" {
+		return nil, fmt.Errorf("Telegram bot token is not configured")
+	}
+	if chatID == "" {
+		return nil, fmt.Errorf("Telegram chat ID is required")
+	}
+	return &telegramNotifier{
+		token:   token,
+		chatID:  chatID,
+		apiBase: telegramAPIBase,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (t *telegramNotifier) Channel() string {
+	return ChannelTelegram
+}
+
+func (t *telegramNotifier) Target() string {
+	return t.chatID
+}
+
+// Send the notification title and message as a plain-text chat message
+func (t *telegramNotifier) Notify(n Notification) error {
+	text := n.Message
+	if n.Title != "" {
+		text = n.Title + "\n\n" + n.Message
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"chat_id": t.chatID,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", t.apiBase, t.token)
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// Don't leak the bot token through the request URL in the error
+		return fmt.Errorf("Telegram request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Telegram API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
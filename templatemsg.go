@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Returned instead of calling out when no LLM API key is configured
+var errNoLLMKey = errors.New("no LLM API key configured")
+
+// Openings, by partOfDay
+var templateOpenings = map[string][]string{
+	"morning":   {"Good morning from %s.", "Morning in %s.", "Here's the morning in %s."},
+	"afternoon": {"Good afternoon from %s.", "This afternoon in %s.", "Checking in on %s this afternoon."},
+	"evening":   {"Good evening from %s.", "This evening in %s.", "Evening update for %s."},
+	"night":     {"Late night in %s.", "Overnight in %s.", "Tonight in %s."},
+}
+
+// Advice for each condition from weatherCodeToCondition
+var templateConditionPhrases = map[string][]string{
+	"Clear":        {"Clear skies overhead, a good time to get outside.", "Not a cloud in sight.", "Bright and clear all around."},
+	"Mainly Clear": {"Mostly clear, with just the odd cloud.", "Plenty of sky showing between a few clouds.", "Largely clear and pleasant."},
+	"Clouds":       {"Clouds are keeping things grey.", "A cloudy spell, but nothing falling for now.", "Overcast skies, dry for the moment."},
+	"Fog":          {"Fog is cutting visibility, so take care on the roads.", "A foggy one; allow extra time if you're driving.", "Visibility is poor in the fog."},
+	"Drizzle":      {"A light drizzle is falling; a hood will do.", "Drizzly out there, so keep a jacket handy.", "Fine drizzle on and off."},
+	"Rain":         {"Rain is falling, so take an umbrella.", "A wet one; waterproofs recommended.", "Expect rain if you head out."},
+	"Snow":         {"Snow is falling; watch for slippery paths.", "Snowy conditions, so wrap up and tread carefully.", "It's snowing, so allow extra travel time."},
+	"Thunderstorm": {"Thunderstorms around; stay indoors if you can.", "Stormy, with thunder about; avoid open ground.", "Thunder and lightning nearby, so keep sheltered."},
+	"Unknown":      {"Conditions are mixed right now.", "A changeable picture out there.", "Keep an eye on the sky."},
+}
+
+// Clothing suggestions by feels-like temperature band
+var templateTemperaturePhrases = map[string][]string{
+	"freezing": {"Bundle up: hat, gloves and a heavy coat.", "Bitterly cold, so layer up properly.", "Freezing out, so cover up well."},
+	"cold":     {"A warm coat is a good idea.", "Chilly enough for a coat and scarf.", "Cold, so dress in layers."},
+	"cool":     {"A light jacket should do.", "Cool, so bring a sweater.", "Jacket weather."},
+	"mild":     {"Comfortable for most things outdoors.", "Pleasant enough in light layers.", "Mild and easygoing."},
+	"warm":     {"Warm, so dress light and carry water.", "T-shirt weather.", "Nice and warm; sunscreen wouldn't hurt."},
+	"hot":      {"Hot, so stay hydrated and seek shade.", "Very warm; avoid exertion in the midday sun.", "Heat is up, so keep cool and drink plenty."},
+}
+
+// The message layout; phrases come from the banks above
+var templateMessage = template.Must(template.New("message").Parse(
+	`{{.Opening}} It's {{.Temperature}} with {{.Description}}` +
+		`{{if .FeelsLike}}, feeling like {{.FeelsLike}}{{end}}. {{.Condition}} {{.Clothing}}` +
+		`{{if .Wind}} {{.Wind}}{{end}}{{if .Precipitation}} There's a {{.Precipitation}}.{{end}}`))
+
+// Values filled into templateMessage
+type templateMessageData struct {
+	Opening       string
+	Temperature   string
+	Description   string
+	FeelsLike     string // Empty unless it differs noticeably from the temperature
+	Condition     string
+	Clothing      string
+	Wind          string
+	Precipitation string // e.g. "40% chance of precipitation by 3 PM"
+}
+
+// Whether messages can come from an LLM. Local OpenAI-compatible servers
+// don't need a key.
+func (agent *WeatherAgent) llmConfigured() bool {
+	return agent.llm != nil || agent.config.LLMAPIKey != "" || agent.config.LLMBaseURL != ""
+}
+
+// Pick a phrase from a bank. The choice depends only on the seed, so the same
+// place and hour always read the same while different hours vary.
+func pickPhrase(bank []string, seed string) string {
+	if len(bank) == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return bank[h.Sum32()%uint32(len(bank))]
+}
+
+// Temperature band for a feels-like temperature in °C
+func temperatureBand(celsius float64) string {
+	switch {
+	case celsius < 0:
+		return "freezing"
+	case celsius < 8:
+		return "cold"
+	case celsius < 15:
+		return "cool"
+	case celsius < 22:
+		return "mild"
+	case celsius < 29:
+		return "warm"
+	}
+	return "hot"
+}
+
+// Render a weather message without an LLM, from phrase banks chosen by the
+// conditions, time of day and temperature
+func (agent *WeatherAgent) renderTemplateMessage(weather WeatherResponse) string {
+	system := agent.weatherUnits(weather)
+	localTime := time.Unix(weather.Dt, 0).In(time.FixedZone("Local", weather.Timezone))
+	seed := weather.Name + localTime.Format("2006-01-02T15")
+
+	code := 0
+	description := "mixed conditions"
+	if len(weather.Weather) > 0 {
+		code = weather.Weather[0].ID
+		if weather.Weather[0].Description != "" {
+			description = weather.Weather[0].Description
+		} else if weather.Weather[0].Main != "" {
+			description = strings.ToLower(weather.Weather[0].Main)
+		}
+	}
+	condition := agent.weatherCodeToCondition(code)
+
+	data := templateMessageData{
+		Opening:     fmt.Sprintf(pickPhrase(templateOpenings[partOfDay(localTime.Hour())], seed), weather.Name),
+		Temperature: fmt.Sprintf("%.0f%s", weather.Main.Temp, system.TemperatureSymbol()),
+		Description: description,
+		Condition:   pickPhrase(templateConditionPhrases[condition], seed+condition),
+	}
+	if math.Abs(weather.Main.FeelsLike-weather.Main.Temp) >= 3 {
+		data.FeelsLike = fmt.Sprintf("%.0f%s", weather.Main.FeelsLike, system.TemperatureSymbol())
+	}
+	band := temperatureBand(units.TemperatureIn(weather.Main.FeelsLike, system).Celsius())
+	data.Clothing = pickPhrase(templateTemperaturePhrases[band], seed+band)
+
+	// Strong wind is worth a mention: Beaufort 6, a strong breeze, or more
+	wind := weather.Wind.Speed
+	if weather.Wind.Gust > wind {
+		wind = weather.Wind.Gust
+	}
+	if units.SpeedIn(wind, system).Beaufort() >= 6 {
+		data.Wind = fmt.Sprintf("It's windy, with gusts to %.0f %s.", wind, system.SpeedUnit())
+	}
+	if outlook := precipitationOutlook(weather.HourlyPrecipProb, localTime); outlook != "" && !strings.HasPrefix(outlook, "under") {
+		data.Precipitation = outlook
+	}
+
+	var message strings.Builder
+	if err := templateMessage.Execute(&message, data); err != nil {
+		// The template is fixed, so this is a programming error
+		agent.logger.Printf("Error rendering template message: %v", err)
+		return fmt.Sprintf("%s: %s, %s.", weather.Name, data.Temperature, description)
+	}
+	return message.String()
+}
+
+// The template message followed by a line per forecast day, for the digest
+func (agent *WeatherAgent) renderTemplateDigest(weather WeatherResponse, forecast Forecast) string {
+	var digest strings.Builder
+	digest.WriteString(agent.renderTemplateMessage(weather))
+	unit := agent.getTempUnit()
+	for i, day := range forecast.Days {
+		if i == 0 {
+			digest.WriteString("\n\nComing up:")
+		}
+		fmt.Fprintf(&digest, "\n%s: %s, %.0f-%.0f%s, %d%% chance of precipitation.",
+			day.Date, day.Description, day.TempMin, day.TempMax, unit, day.PrecipitationProbability)
+	}
+	return digest.String()
+}
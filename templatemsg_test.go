@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func templateTestWeather(t *testing.T, raw string) WeatherResponse {
+	t.Helper()
+	var weather WeatherResponse
+	if err := json.Unmarshal([]byte(raw), &weather); err != nil {
+		t.Fatal(err)
+	}
+	return weather
+}
+
+func TestRenderTemplateMessage(t *testing.T) {
+	agent := newFixtureAgent(t, Config{})
+	morning := time.Date(2024, 6, 15, 8, 0, 0, 0, time.UTC).Unix()
+
+	rainy := templateTestWeather(t, `{"name":"Oslo","timezone":0,"weather":[{"id":63,"description":"moderate rain"}],
+		"main":{"temp":9.6,"feels_like":5.9},"wind":{"speed":22,"gust":43}}`)
+	rainy.Dt = morning
+	rainy.HourlyPrecipProb = []HourlyValue{{Time: morning, Value: 80}, {Time: morning + 3600, Value: 90}}
+
+	message := agent.renderTemplateMessage(rainy)
+	for _, want := range []string{"It's 10°C with moderate rain, feeling like 6°C.", "gusts to 43 km/h", "There's a 90% chance of precipitation by 9 AM."} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message %q missing %q", message, want)
+		}
+	}
+	if !containsAny(message, templateOpenings["morning"], "Oslo") || !containsAny(message, templateConditionPhrases["Rain"], "") ||
+		!containsAny(message, templateTemperaturePhrases["cold"], "") {
+		t.Errorf("message %q doesn't use the morning, rain and cold phrase banks", message)
+	}
+	if again := agent.renderTemplateMessage(rainy); again != message {
+		t.Errorf("same hour rendered differently:\n%q\n%q", message, again)
+	}
+
+	calm := templateTestWeather(t, `{"name":"Oslo","timezone":0,"weather":[{"id":0,"description":"clear sky"}],
+		"main":{"temp":24.2,"feels_like":25},"wind":{"speed":8}}`)
+	calm.Dt = morning
+	if message := agent.renderTemplateMessage(calm); strings.Contains(message, "feeling like") || strings.Contains(message, "windy") || strings.Contains(message, "chance") {
+		t.Errorf("calm message %q mentions feels-like, wind or precipitation", message)
+	}
+}
+
+// Whether s contains one of the phrases, formatted with arg if they take one
+func containsAny(s string, phrases []string, arg string) bool {
+	for _, phrase := range phrases {
+		if arg != "" {
+			phrase = strings.Replace(phrase, "%s", arg, 1)
+		}
+		if strings.Contains(s, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTemperatureBand(t *testing.T) {
+	tests := []struct {
+		celsius float64
+		want    string
+	}{
+		{-5, "freezing"}, {0, "cold"}, {10, "cool"}, {18, "mild"}, {25, "warm"}, {35, "hot"},
+	}
+	for _, tt := range tests {
+		if got := temperatureBand(tt.celsius); got != tt.want {
+			t.Errorf("temperatureBand(%g) = %q, want %q", tt.celsius, got, tt.want)
+		}
+	}
+	if len(templateTemperaturePhrases) != len(tests) {
+		t.Error("every band needs a phrase bank")
+	}
+}
+
+func TestTemplateFallbackWithoutKey(t *testing.T) {
+	useFixtures(t, defaultFixtures())
+	agent := newFixtureAgent(t, Config{})
+	weather, err := agent.fetchWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := agent.generateLLMMessage(weather, "", "", agent.llmParams())
+	if err != nil || message != agent.renderTemplateMessage(weather) {
+		t.Errorf("generateLLMMessage() without a key = %q, %v; want the template message", message, err)
+	}
+
+	forecast := Forecast{Days: []ForecastDay{{Date: "2024-06-16", Description: "light rain", TempMin: 11.2, TempMax: 17.8, PrecipitationProbability: 70}}}
+	digest, err := agent.generateDigestMessage(weather, forecast)
+	if err != nil || !strings.HasSuffix(digest, "Coming up:\n2024-06-16: light rain, 11-18°C, 70% chance of precipitation.") {
+		t.Errorf("generateDigestMessage() without a key = %q, %v", digest, err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Tomorrow.io settings
+const (
+	tomorrowTimelinesURL = "https://api.tomorrow.io/v4/timelines"
+	tomorrowCacheTTL     = 30 * time.Minute // Keeps well inside the free plan's daily quota
+	tomorrowFields       = "treeIndex,grassIndex,weedIndex,fireIndex,roadRiskScore"
+)
+
+// Pollen index names for Tomorrow.io's 0-5 scale
+var pollenLevels = []string{"none", "very low", "low", "medium", "high", "very high"}
+
+// Road risk names for Tomorrow.io's 1-5 score (0 means no data)
+var roadRiskLevels = []string{"", "low", "moderate", "elevated", "high", "extreme"}
+
+// Pollen indices from 0 (none) to 5 (very high)
+type Pollen struct {
+	Tree  int `json:"tree"`
+	Grass int `json:"grass"`
+	Weed  int `json:"weed"`
+}
+
+// Highest of the three indices
+func (p Pollen) max() int {
+	return max(p.Tree, p.Grass, p.Weed)
+}
+
+// Summary like "tree high, grass low, weed none"
+func (p Pollen) summary() string {
+	return fmt.Sprintf("tree %s, grass %s, weed %s", pollenLevel(p.Tree), pollenLevel(p.Grass), pollenLevel(p.Weed))
+}
+
+// Name for a pollen index
+func pollenLevel(index int) string {
+	if index < 0 || index >= len(pollenLevels) {
+		return "unknown"
+	}
+	return pollenLevels[index]
+}
+
+// Name for a road risk score, empty when there's no data
+func roadRiskLevel(score int) string {
+	if score < 0 || score >= len(roadRiskLevels) {
+		return ""
+	}
+	return roadRiskLevels[score]
+}
+
+// Danger class for a Fire Weather Index value
+func fireDangerLevel(fwi float64) string {
+	switch {
+	case fwi < 5:
+		return "low"
+	case fwi < 10:
+		return "moderate"
+	case fwi < 20:
+		return "high"
+	case fwi < 30:
+		return "very high"
+	}
+	return "extreme"
+}
+
+// Fields Tomorrow.io adds on top of Open-Meteo, in the common model
+type tomorrowConditions struct {
+	Pollen    *Pollen
+	FireIndex *float64
+	RoadRisk  string
+}
+
+// Parse a Tomorrow.io timelines response for the current interval
+func parseTomorrow(body []byte) (tomorrowConditions, error) {
+	var resp struct {
+		Data struct {
+			Timelines []struct {
+				Intervals []struct {
+					Values struct {
+						TreeIndex     *int     `json:"treeIndex"`
+						GrassIndex    *int     `json:"grassIndex"`
+						WeedIndex     *int     `json:"weedIndex"`
+						FireIndex     *float64 `json:"fireIndex"`
+						RoadRiskScore *int     `json:"roadRiskScore"`
+					} `json:"values"`
+				} `json:"intervals"`
+			} `json:"timelines"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return tomorrowConditions{}, fmt.Errorf("failed to parse Tomorrow.io response: %v", err)
+	}
+	if len(resp.Data.Timelines) == 0 || len(resp.Data.Timelines[0].Intervals) == 0 {
+		return tomorrowConditions{}, fmt.Errorf("no current interval in Tomorrow.io response")
+	}
+
+	// Fields outside the plan or the data's coverage come back missing
+	values := resp.Data.Timelines[0].Intervals[0].Values
+	var conditions tomorrowConditions
+	if values.TreeIndex != nil || values.GrassIndex != nil || values.WeedIndex != nil {
+		conditions.Pollen = &Pollen{Tree: intOrZero(values.TreeIndex), Grass: intOrZero(values.GrassIndex), Weed: intOrZero(values.WeedIndex)}
+	}
+	conditions.FireIndex = values.FireIndex
+	if values.RoadRiskScore != nil {
+		conditions.RoadRisk = roadRiskLevel(*values.RoadRiskScore)
+	}
+	return conditions, nil
+}
+
+// Value of an optional field, zero when missing
+func intOrZero(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// Fetch current pollen, fire and road conditions for coordinates
+func (agent *WeatherAgent) fetchTomorrow(lat, lon float64) (tomorrowConditions, error) {
+	query := url.Values{}
+	query.Set("location", fmt.Sprintf("%.4f,%.4f", lat, lon))
+	query.Set("fields", tomorrowFields)
+	query.Set("timesteps", "current")
+	query.Set("apikey", agent.config.TomorrowAPIKey)
+
+	body, _, err := agent.cachedGet(tomorrowTimelinesURL+"?"+query.Encode(), tomorrowCacheTTL, false)
+	if err != nil {
+		return tomorrowConditions{}, fmt.Errorf("Tomorrow.io request failed: %v", err)
+	}
+	return parseTomorrow(body)
+}
+
+// Attach Tomorrow.io fields to the weather response when a key is configured
+func (agent *WeatherAgent) addTomorrow(weather *WeatherResponse, lat, lon float64) {
+	if agent.config.TomorrowAPIKey == "" {
+		return
+	}
+
+	conditions, err := agent.fetchTomorrow(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch Tomorrow.io data: %v", err)
+		return
+	}
+	weather.Pollen = conditions.Pollen
+	weather.FireIndex = conditions.FireIndex
+	weather.RoadRisk = conditions.RoadRisk
+}
+
+// Add the Tomorrow.io fields to the LLM data map
+func addTomorrowData(weather WeatherResponse, data map[string]interface{}) {
+	if weather.Pollen != nil {
+		data["pollen"] = weather.Pollen.summary()
+	}
+	if weather.FireIndex != nil {
+		data["fire_danger"] = fmt.Sprintf("%s (fire weather index %.0f)", fireDangerLevel(*weather.FireIndex), *weather.FireIndex)
+	}
+	if weather.RoadRisk != "" {
+		data["road_risk"] = weather.RoadRisk
+	}
+}
+
+// Tomorrow.io conditions notable enough to mention in the message
+func tomorrowHighlights(weather WeatherResponse) []string {
+	var highlights []string
+	if weather.Pollen != nil && weather.Pollen.max() >= 4 {
+		highlights = append(highlights, "pollen")
+	}
+	if weather.FireIndex != nil && *weather.FireIndex >= 20 {
+		highlights = append(highlights, "fire_danger")
+	}
+	if weather.RoadRisk == "high" || weather.RoadRisk == "extreme" {
+		highlights = append(highlights, "road_risk")
+	}
+	return highlights
+}
+
+// Prompt line for notable Tomorrow.io conditions, empty when there are none
+func tomorrowPrompt(weather WeatherResponse) string {
+	highlights := tomorrowHighlights(weather)
+	if len(highlights) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nConditions worth a warning (see %s). Mention them briefly with practical advice, e.g. for allergy sufferers, fire restrictions or driving.",
+		strings.Join(highlights, ", "))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTomorrow(t *testing.T) {
+	body := []byte(`{"data":{"timelines":[{"timestep":"current","intervals":[{"startTime":"2026-10-17T12:00:00Z",
+		"values":{"treeIndex":4,"grassIndex":1,"weedIndex":0,"fireIndex":23.6,"roadRiskScore":2}}]}]}}`)
+
+	conditions, err := parseTomorrow(body)
+	if err != nil {
+		t.Fatalf("parseTomorrow() error = %v", err)
+	}
+	if conditions.Pollen == nil || *conditions.Pollen != (Pollen{Tree: 4, Grass: 1, Weed: 0}) {
+		t.Errorf("Pollen = %+v, want tree 4, grass 1, weed 0", conditions.Pollen)
+	}
+	if conditions.FireIndex == nil || *conditions.FireIndex != 23.6 {
+		t.Errorf("FireIndex = %v, want 23.6", conditions.FireIndex)
+	}
+	if conditions.RoadRisk != "moderate" {
+		t.Errorf("RoadRisk = %q, want moderate", conditions.RoadRisk)
+	}
+}
+
+func TestParseTomorrowMissingFields(t *testing.T) {
+	// Fields outside the plan or the data's coverage are left unset
+	conditions, err := parseTomorrow([]byte(`{"data":{"timelines":[{"intervals":[{"values":{"roadRiskScore":0}}]}]}}`))
+	if err != nil {
+		t.Fatalf("parseTomorrow() error = %v", err)
+	}
+	if conditions.Pollen != nil || conditions.FireIndex != nil || conditions.RoadRisk != "" {
+		t.Errorf("parseTomorrow() = %+v, want no conditions", conditions)
+	}
+
+	if _, err := parseTomorrow([]byte(`{"data":{"timelines":[]}}`)); err == nil {
+		t.Error("parseTomorrow() with no timelines: expected error")
+	}
+}
+
+func TestFireDangerLevel(t *testing.T) {
+	tests := []struct {
+		fwi  float64
+		want string
+	}{
+		{0, "low"},
+		{4.9, "low"},
+		{5, "moderate"},
+		{12, "high"},
+		{25, "very high"},
+		{30, "extreme"},
+	}
+
+	for _, tt := range tests {
+		if got := fireDangerLevel(tt.fwi); got != tt.want {
+			t.Errorf("fireDangerLevel(%v) = %q, want %q", tt.fwi, got, tt.want)
+		}
+	}
+}
+
+func TestTomorrowPrompt(t *testing.T) {
+	fwi := 31.0
+	tests := []struct {
+		name    string
+		weather WeatherResponse
+		want    []string
+	}{
+		{
+			name:    "nothing notable",
+			weather: WeatherResponse{Pollen: &Pollen{Tree: 3}, RoadRisk: "elevated"},
+		},
+		{
+			name:    "high pollen and fire danger",
+			weather: WeatherResponse{Pollen: &Pollen{Grass: 5}, FireIndex: &fwi},
+			want:    []string{"pollen", "fire_danger"},
+		},
+		{
+			name:    "extreme road risk",
+			weather: WeatherResponse{RoadRisk: "extreme"},
+			want:    []string{"road_risk"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tomorrowPrompt(tt.weather)
+			if len(tt.want) == 0 && got != "" {
+				t.Errorf("tomorrowPrompt() = %q, want empty", got)
+			}
+			for _, field := range tt.want {
+				if !strings.Contains(got, field) {
+					t.Errorf("tomorrowPrompt() = %q, want mention of %s", got, field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Maximum number of destinations compared in one trip
+const maxTripDestinations = 5
+
+// Forecast for one place on the trip's dates
+type TripLocation struct {
+	City    string        `json:"city"`
+	Country string        `json:"country,omitempty"`
+	Role    string        `json:"role"` // "origin" or "destination"
+	Days    []ForecastDay `json:"days"`
+	Error   string        `json:"error,omitempty"` // Set when the place couldn't be forecast
+}
+
+// Forecasts for a trip and the LLM's packing and planning summary
+type TripPlan struct {
+	Dates     []string       `json:"dates"`
+	Units     string         `json:"units"`
+	Locations []TripLocation `json:"locations"`
+	Summary   string         `json:"summary,omitempty"` // Empty when the LLM is unavailable
+}
+
+// Split a place like "Paris,FR" into city and country code
+func parsePlace(place string) (string, string) {
+	city, country, _ := strings.Cut(place, ",")
+	return strings.TrimSpace(city), strings.TrimSpace(country)
+}
+
+// Destinations from ?to=, repeated or separated by "|"
+func parseTripDestinations(values []string) ([]string, error) {
+	var places []string
+	for _, value := range values {
+		for _, place := range strings.Split(value, "|") {
+			if city, _ := parsePlace(place); city != "" {
+				places = append(places, strings.TrimSpace(place))
+			}
+		}
+	}
+	if len(places) == 0 {
+		return nil, fmt.Errorf("at least one destination is required (to=City,CC)")
+	}
+	if len(places) > maxTripDestinations {
+		return nil, fmt.Errorf("too many destinations (max %d)", maxTripDestinations)
+	}
+	return places, nil
+}
+
+// Parse ?dates= as "2006-01-02", a range "2006-01-02..2006-01-05", or a
+// comma-separated list. Dates must fall within the forecast horizon from
+// today. Without a value the next three days are used.
+func parseTripDates(value string, today time.Time) ([]string, error) {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	last := today.AddDate(0, 0, maxForecastDays-1)
+
+	var dates []time.Time
+	switch {
+	case value == "":
+		for i := 0; i < 3; i++ {
+			dates = append(dates, today.AddDate(0, 0, i))
+		}
+	case strings.Contains(value, ".."):
+		startValue, endValue, _ := strings.Cut(value, "..")
+		start, err1 := time.Parse("2006-01-02", strings.TrimSpace(startValue))
+		end, err2 := time.Parse("2006-01-02", strings.TrimSpace(endValue))
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return nil, fmt.Errorf("invalid date range %q (use YYYY-MM-DD..YYYY-MM-DD)", value)
+		}
+		for d := start; !d.After(end) && len(dates) <= maxForecastDays; d = d.AddDate(0, 0, 1) {
+			dates = append(dates, d)
+		}
+	default:
+		for _, part := range strings.Split(value, ",") {
+			d, err := time.Parse("2006-01-02", strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", part)
+			}
+			dates = append(dates, d)
+		}
+	}
+
+	result := make([]string, 0, len(dates))
+	for _, d := range dates {
+		if d.Before(today) || d.After(last) {
+			return nil, fmt.Errorf("%s is outside the %d-day forecast range", d.Format("2006-01-02"), maxForecastDays)
+		}
+		result = append(result, d.Format("2006-01-02"))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Forecast a place for the trip's dates. Errors are recorded on the location
+// so one unknown city doesn't sink the whole plan.
+func (agent *WeatherAgent) tripLocation(place, role string, dates []string, today time.Time) TripLocation {
+	city, country := parsePlace(place)
+	location := TripLocation{City: city, Country: country, Role: role}
+
+	lat, lon, err := agent.getCoordinates(city, country)
+	if err != nil {
+		location.Error = "location not found"
+		return location
+	}
+	lastDate, _ := time.Parse("2006-01-02", dates[len(dates)-1])
+	todayDate := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(lastDate.Sub(todayDate).Hours()/24) + 2 // A day extra for locations ahead of us
+
+	forecast, err := agent.fetchForecast(lat, lon, days)
+	if err != nil {
+		agent.logger.Printf("Error fetching trip forecast for %s: %v", city, err)
+		location.Error = "forecast unavailable"
+		return location
+	}
+
+	wanted := make(map[string]bool, len(dates))
+	for _, date := range dates {
+		wanted[date] = true
+	}
+	for _, day := range forecast.Days {
+		if wanted[day.Date] {
+			location.Days = append(location.Days, day)
+		}
+	}
+	return location
+}
+
+// Build the LLM prompt comparing the trip's locations
+func (agent *WeatherAgent) tripPrompt(plan TripPlan) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Trip forecast (temperatures in %s):\n", agent.getTempUnit())
+	for _, location := range plan.Locations {
+		name := location.City
+		if location.Country != "" {
+			name += ", " + location.Country
+		}
+		fmt.Fprintf(&prompt, "\n%s (%s):\n", name, location.Role)
+		if location.Error != "" {
+			fmt.Fprintf(&prompt, "- no forecast (%s)\n", location.Error)
+			continue
+		}
+		for _, day := range location.Days {
+			fmt.Fprintf(&prompt, "- %s: %s, high %.0f, low %.0f, %d%% chance of precipitation\n",
+				day.Date, day.Description, day.TempMax, day.TempMin, day.PrecipitationProbability)
+		}
+	}
+	prompt.WriteString(`
+Write a short trip planning summary for someone travelling to the destinations above on these dates:
+1. One packing list that covers every destination (mention which items are for which place only when it matters).
+2. For each destination, the best day(s) for outdoor plans and any day to keep indoor backups for.
+3. One or two sentences comparing the destinations' weather.
+If an origin is listed, compare against it where useful (e.g. "10 degrees warmer than home"). Keep it under 200 words.`)
+	return prompt.String()
+}
+
+// Forecast every place on the trip and ask the LLM for a summary
+func (agent *WeatherAgent) planTrip(origin string, destinations, dates []string, today time.Time) TripPlan {
+	plan := TripPlan{Dates: dates, Units: agent.config.Units}
+	places, roles := destinations, make([]string, len(destinations))
+	for i := range roles {
+		roles[i] = "destination"
+	}
+	if origin != "" {
+		places, roles = append([]string{origin}, places...), append([]string{"origin"}, roles...)
+	}
+
+	// Forecast the places concurrently, keeping the origin first
+	plan.Locations = make([]TripLocation, len(places))
+	forEachLimit(len(places), agent.config.FetchConcurrency, func(i int) {
+		plan.Locations[i] = agent.tripLocation(places[i], roles[i], dates, today)
+	})
+
+	summary, err := agent.callLLM(agent.tripPrompt(plan))
+	if err != nil {
+		agent.logger.Printf("Error generating trip summary: %v", err)
+		return plan
+	}
+	plan.Summary = summary
+	return plan
+}
+
+// GET /api/trip?from=Home,CC&to=City,CC|City,CC&dates=2006-01-02..2006-01-05
+func (agent *WeatherAgent) handleTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	destinations, err := parseTripDestinations(query["to"])
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	today := time.Now()
+	dates, err := parseTripDates(query.Get("dates"), today)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan := agent.planTrip(strings.TrimSpace(query.Get("from")), destinations, dates, today)
+
+	writeJSON(w, http.StatusOK, plan)
+}
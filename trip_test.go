@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTripDates(t *testing.T) {
+	today := time.Date(2024, 6, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"2024-06-10", "2024-06-11", "2024-06-12"}, false},
+		{"2024-06-12", []string{"2024-06-12"}, false},
+		{"2024-06-14..2024-06-16", []string{"2024-06-14", "2024-06-15", "2024-06-16"}, false},
+		{"2024-06-20,2024-06-12", []string{"2024-06-12", "2024-06-20"}, false},
+		{"2024-06-09", nil, true},             // In the past
+		{"2024-06-26", nil, true},             // Beyond the forecast range
+		{"2024-06-16..2024-06-14", nil, true}, // Reversed range
+		{"next tuesday", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTripDates(tt.value, today)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTripDates(%q) = %v, %v, want %v (error %t)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseTripDestinations(t *testing.T) {
+	got, err := parseTripDestinations([]string{"Paris,FR|Rome, IT", "Lisbon"})
+	if err != nil || !reflect.DeepEqual(got, []string{"Paris,FR", "Rome, IT", "Lisbon"}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if city, country := parsePlace(got[1]); city != "Rome" || country != "IT" {
+		t.Errorf("parsePlace(%q) = %q, %q", got[1], city, country)
+	}
+
+	if _, err := parseTripDestinations([]string{" | "}); err == nil {
+		t.Error("expected an error without destinations")
+	}
+	if _, err := parseTripDestinations([]string{"A|B|C|D|E|F"}); err == nil {
+		t.Error("expected an error for too many destinations")
+	}
+}
+
+func TestTripPrompt(t *testing.T) {
+	agent := &WeatherAgent{config: Config{Units: "metric"}}
+	prompt := agent.tripPrompt(TripPlan{
+		Dates: []string{"2024-06-12"},
+		Locations: []TripLocation{
+			{City: "Oslo", Country: "NO", Role: "origin", Days: []ForecastDay{
+				{Date: "2024-06-12", Description: "light rain", TempMax: 14.2, TempMin: 8, PrecipitationProbability: 70},
+			}},
+			{City: "Atlantis", Role: "destination", Error: "location not found"},
+		},
+	})
+
+	for _, want := range []string{
+		"temperatures in °C",
+		"Oslo, NO (origin)",
+		"- 2024-06-12: light rain, high 14, low 8, 70% chance of precipitation",
+		"Atlantis (destination):\n- no forecast (location not found)",
+		"packing list",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Login methods for the web UI (UI_AUTH)
+const (
+	UIAuthOff   = "off"
+	UIAuthBasic = "basic" // HTTP basic auth against UI_BASIC_USERS
+	UIAuthOIDC  = "oidc"  // OpenID Connect authorization code flow
+)
+
+const (
+	sessionCookieName   = "weather_agent_session"
+	oidcStateCookieName = "weather_agent_oidc"
+	oidcStateTTL        = 10 * time.Minute // Time allowed to finish logging in at the provider
+)
+
+// Login for the web UI and admin endpoints
+type UIAuthConfig struct {
+	Mode              string   // UIAuthOff, UIAuthBasic or UIAuthOIDC
+	BasicUsers        []string // "user:password" or "user:sha256:<hex of password>"
+	OIDCIssuer        string   // e.g. "https://accounts.google.com"
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string   // This server's /auth/callback URL, as registered with the provider
+	OIDCAllowedEmails []string // Accounts allowed in (required, as providers such as Google let anyone sign up)
+	AdminUsers        []string // Users or emails also allowed the admin endpoints
+	SessionSecret     string   // Key signing session cookies (random per run if empty)
+	SessionHours      int      // How long a login lasts
+}
+
+// Endpoints from the provider's discovery document
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"` // Keys the provider signs ID tokens with
+}
+
+// A public key from the provider's JWKS. Only RSA and P-256 keys, which
+// sign RS256 and ES256 tokens, are used.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// How often the JWKS may be fetched again for a key it didn't have
+const jwksRefetchInterval = time.Minute
+
+// ID token claims checked at login
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"`
+}
+
+// The aud claim, a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Logs users into the web UI with basic auth or OIDC and keeps them logged
+// in with a signed session cookie. A nil uiAuth lets everyone in.
+type uiAuth struct {
+	config UIAuthConfig
+	users  map[string]string // Password, or "sha256:<hex>", by user name
+	secret []byte
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery              // Fetched on the first login
+	signingKeys map[string]crypto.PublicKey // From the JWKS, by key ID
+	keysFetched time.Time
+}
+
+// Parse UI_BASIC_USERS entries
+func parseBasicUsers(entries []string) (map[string]string, error) {
+	users := make(map[string]string)
+	for i, entry := range entries {
+		name, password, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || password == "" {
+			// The entry isn't echoed, as it may hold a password
+			return nil, fmt.Errorf("entry %d is not user:password or user:sha256:<hex>", i+1)
+		}
+		if hash, hashed := strings.CutPrefix(password, "sha256:"); hashed {
+			if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid sha256 password hash for user %q", name)
+			}
+		}
+		users[name] = password
+	}
+	return users, nil
+}
+
+// Create the UI login from the config, or nil if UI_AUTH is off
+func newUIAuth(config UIAuthConfig, client *http.Client) (*uiAuth, error) {
+	switch config.Mode {
+	case "", UIAuthOff:
+		return nil, nil
+	case UIAuthBasic, UIAuthOIDC:
+	default:
+		return nil, fmt.Errorf("unknown UI_AUTH %q (use %s, %s or %s)", config.Mode, UIAuthOff, UIAuthBasic, UIAuthOIDC)
+	}
+
+	users, err := parseBasicUsers(config.BasicUsers)
+	if err != nil {
+		return nil, err
+	}
+	if config.Mode == UIAuthBasic && len(users) == 0 {
+		return nil, fmt.Errorf("basic auth needs at least one user in UI_BASIC_USERS")
+	}
+	if config.Mode == UIAuthOIDC && (config.OIDCIssuer == "" || config.OIDCClientID == "" || config.OIDCRedirectURL == "") {
+		return nil, fmt.Errorf("OIDC needs OIDC_ISSUER, OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+	}
+	if config.Mode == UIAuthOIDC && len(config.OIDCAllowedEmails) == 0 {
+		return nil, fmt.Errorf("OIDC needs OIDC_ALLOWED_EMAILS, or anyone with an account at the provider could log in")
+	}
+	if config.SessionHours < 1 {
+		config.SessionHours = 24
+	}
+
+	secret := []byte(config.SessionSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &uiAuth{config: config, users: users, secret: secret, client: client}, nil
+}
+
+func (u *uiAuth) sign(value string) string {
+	mac := hmac.New(sha256.New, u.secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign a value into a cookie value that expires at the given time
+func (u *uiAuth) seal(value string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + u.sign(payload)
+}
+
+// Verify a sealed value, returning it if the signature matches and it hasn't expired
+func (u *uiAuth) open(sealed string, now time.Time) (string, bool) {
+	i := strings.LastIndex(sealed, ".")
+	if i < 0 || !hmac.Equal([]byte(sealed[i+1:]), []byte(u.sign(sealed[:i]))) {
+		return "", false
+	}
+	encoded, expiry, _ := strings.Cut(sealed[:i], ".")
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	return string(value), err == nil
+}
+
+func (u *uiAuth) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		// Lax, so the cookie comes along when the provider redirects back
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	})
+}
+
+// Log a user in for UI_SESSION_HOURS
+func (u *uiAuth) startSession(w http.ResponseWriter, r *http.Request, user string) {
+	ttl := time.Duration(u.config.SessionHours) * time.Hour
+	u.setCookie(w, r, sessionCookieName, u.seal(user, time.Now().Add(ttl)), ttl)
+}
+
+// Check basic auth credentials in constant time
+func (u *uiAuth) checkBasic(r *http.Request) (string, bool) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	want, known := u.users[name]
+	if hash, hashed := strings.CutPrefix(want, "sha256:"); hashed {
+		sum := sha256.Sum256([]byte(password))
+		password, want = hex.EncodeToString(sum[:]), hash
+	}
+	match := subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+	return name, known && match
+}
+
+// The logged-in user, from the session cookie or basic auth credentials
+func (u *uiAuth) user(r *http.Request) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if user, ok := u.open(cookie.Value, time.Now()); ok {
+			return user, true
+		}
+	}
+	if u.config.Mode == UIAuthBasic {
+		return u.checkBasic(r)
+	}
+	return "", false
+}
+
+// Whether the request comes from a logged-in user
+func (u *uiAuth) authenticated(r *http.Request) bool {
+	_, ok := u.user(r)
+	return ok
+}
+
+// Whether any users are allowed the admin endpoints
+func (u *uiAuth) hasAdmins() bool {
+	return u != nil && len(u.config.AdminUsers) > 0
+}
+
+// Whether the request comes from a logged-in user listed in UI_ADMIN_USERS
+func (u *uiAuth) admin(r *http.Request) bool {
+	if !u.hasAdmins() {
+		return false
+	}
+	user, ok := u.user(r)
+	if !ok {
+		return false
+	}
+	for _, admin := range u.config.AdminUsers {
+		if strings.EqualFold(strings.TrimSpace(admin), user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap an HTML page so only logged-in users see it. Basic auth asks the
+// browser for credentials; OIDC sends the user to the provider.
+func (u *uiAuth) middleware(next http.HandlerFunc) http.HandlerFunc {
+	if u == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := u.user(r); ok {
+			// A session lets the page's API calls in without the browser resending credentials
+			if _, err := r.Cookie(sessionCookieName); err != nil {
+				u.startSession(w, r, user)
+			}
+			next(w, r)
+			return
+		}
+		if u.config.Mode == UIAuthBasic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="weather-agent", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	}
+}
+
+// A local path to return to after logging in, never another site
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// Fetch and cache the provider's discovery document
+func (u *uiAuth) oidcEndpoints() (*oidcDiscovery, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.discovery != nil {
+		return u.discovery, nil
+	}
+
+	resp, err := u.client.Get(strings.TrimRight(u.config.OIDCIssuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OIDC discovery document: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery returned status %d", resp.StatusCode)
+	}
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("error decoding OIDC discovery document: %v", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+	// The document must be the configured issuer's own (OIDC Discovery 4.3)
+	if strings.TrimRight(discovery.Issuer, "/") != strings.TrimRight(u.config.OIDCIssuer, "/") {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q, not %q", discovery.Issuer, u.config.OIDCIssuer)
+	}
+	u.discovery = &discovery
+	return u.discovery, nil
+}
+
+// The provider's key with ID kid, fetching the JWKS when it's not known yet
+// (providers rotate keys), at most once a jwksRefetchInterval
+func (u *uiAuth) signingKey(jwksURI, kid string) (crypto.PublicKey, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if key, ok := u.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(u.keysFetched) < jwksRefetchInterval {
+		return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+	}
+	u.keysFetched = time.Now()
+
+	resp, err := u.client.Get(jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OIDC signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC signing keys returned status %d", resp.StatusCode)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("error decoding OIDC signing keys: %v", err)
+	}
+	u.signingKeys = make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			u.signingKeys[jwk.Kid] = key
+		}
+	}
+	if key, ok := u.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+}
+
+// A known signing key by ID; a token without one may use the only key.
+// Callers must hold u.mu.
+func (u *uiAuth) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := u.signingKeys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(u.signingKeys) == 1 {
+		for _, key := range u.signingKeys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	number := func(value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := number(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := number(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := number(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC key is not on its curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// Check an ID token's RS256 or ES256 signature against the provider's keys
+func (u *uiAuth) verifySignature(discovery *oidcDiscovery, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed ID token")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed ID token header: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("malformed ID token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed ID token signature: %v", err)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+
+	key, err := u.signingKey(discovery.JWKSURI, header.Kid)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg == "ES256" && len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid ID token signature")
+}
+
+// GET /auth/login[?next=/path] sends the user to the OIDC provider
+func (u *uiAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if u.config.Mode != UIAuthOIDC {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	discovery, err := u.oidcEndpoints()
+	if err != nil {
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	// The state ties the callback to this browser; the nonce ties the ID token to this login
+	state, nonce := newMessageID()+newMessageID(), newMessageID()+newMessageID()
+	next := safeNext(r.URL.Query().Get("next"))
+	u.setCookie(w, r, oidcStateCookieName, u.seal(state+" "+nonce+" "+next, time.Now().Add(oidcStateTTL)), oidcStateTTL)
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {u.config.OIDCClientID},
+		"redirect_uri":  {u.config.OIDCRedirectURL},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, discovery.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// Exchange an authorization code for the ID token's claims
+func (u *uiAuth) exchangeCode(discovery *oidcDiscovery, code string) (idTokenClaims, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {u.config.OIDCRedirectURL},
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(u.config.OIDCClientID), url.QueryEscape(u.config.OIDCClientSecret))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return idTokenClaims{}, fmt.Errorf("error calling token endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return idTokenClaims{}, fmt.Errorf("error decoding token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return idTokenClaims{}, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, token.Error)
+	}
+
+	if err := u.verifySignature(discovery, token.IDToken); err != nil {
+		return idTokenClaims{}, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token.IDToken, ".")[1])
+	if err != nil {
+		return idTokenClaims{}, fmt.Errorf("malformed ID token: %v", err)
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return idTokenClaims{}, fmt.Errorf("malformed ID token claims: %v", err)
+	}
+	return claims, nil
+}
+
+// Check the ID token was issued to this client for this login, and the
+// account is allowed in. Returns the name to log the user in as.
+func (u *uiAuth) verifyClaims(claims idTokenClaims, issuer, nonce string, now time.Time) (string, error) {
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != strings.TrimRight(issuer, "/"):
+		return "", fmt.Errorf("ID token from unexpected issuer %q", claims.Issuer)
+	case !containsString(claims.Audience, u.config.OIDCClientID):
+		return "", fmt.Errorf("ID token not issued to this client")
+	case now.Unix() > claims.Expiry:
+		return "", fmt.Errorf("ID token expired")
+	case claims.Nonce != nonce:
+		return "", fmt.Errorf("ID token nonce doesn't match the login")
+	}
+
+	// An email the provider doesn't vouch for could be anyone's
+	verified := claims.EmailVerified != nil && *claims.EmailVerified
+	for _, allowed := range u.config.OIDCAllowedEmails {
+		if verified && claims.Email != "" && strings.EqualFold(allowed, claims.Email) {
+			return claims.Email, nil
+		}
+	}
+	return "", fmt.Errorf("account %q is not allowed (OIDC_ALLOWED_EMAILS)", claims.Email)
+}
+
+// GET /auth/callback?code=...&state=... finishes an OIDC login
+func (u *uiAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if u.config.Mode != UIAuthOIDC {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "Login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	var login string
+	if err == nil {
+		login, _ = u.open(cookie.Value, time.Now())
+	}
+	fields := strings.SplitN(login, " ", 3)
+	if len(fields) != 3 || !hmac.Equal([]byte(fields[0]), []byte(query.Get("state"))) {
+		http.Error(w, "Login expired or started elsewhere, please try again", http.StatusBadRequest)
+		return
+	}
+	nonce, next := fields[1], fields[2]
+	u.setCookie(w, r, oidcStateCookieName, "", -time.Second)
+
+	discovery, err := u.oidcEndpoints()
+	if err != nil {
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+	claims, err := u.exchangeCode(discovery, query.Get("code"))
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusBadGateway)
+		return
+	}
+	user, err := u.verifyClaims(claims, u.config.OIDCIssuer, nonce, time.Now())
+	if err != nil {
+		http.Error(w, "Login refused: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	u.startSession(w, r, user)
+	http.Redirect(w, r, safeNext(next), http.StatusFound)
+}
+
+// /auth/logout ends the session
+func (u *uiAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	u.setCookie(w, r, sessionCookieName, "", -time.Second)
+	if u.config.Mode == UIAuthBasic {
+		// Browsers keep resending basic credentials, so only a 401 makes them forget
+		w.Header().Set("WWW-Authenticate", `Basic realm="weather-agent", charset="UTF-8"`)
+		http.Error(w, "Logged out", http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestUIAuth(t *testing.T, config UIAuthConfig) *uiAuth {
+	t.Helper()
+	config.SessionSecret = "test-secret"
+	ui, err := newUIAuth(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ui
+}
+
+// The cookie a response sets, or nil
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestNewUIAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  UIAuthConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{"off", UIAuthConfig{Mode: UIAuthOff}, true, false},
+		{"unset", UIAuthConfig{}, true, false},
+		{"unknown mode", UIAuthConfig{Mode: "ldap"}, true, true},
+		{"basic", UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:hunter2"}}, false, false},
+		{"basic without users", UIAuthConfig{Mode: UIAuthBasic}, true, true},
+		{"user without password", UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me"}}, true, true},
+		{"bad hash", UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:sha256:xyz"}}, true, true},
+		{"oidc without client", UIAuthConfig{Mode: UIAuthOIDC, OIDCIssuer: "https://id.example.com"}, true, true},
+		{"oidc without allowed emails", UIAuthConfig{Mode: UIAuthOIDC, OIDCIssuer: "https://id.example.com", OIDCClientID: "weather",
+			OIDCRedirectURL: "https://weather.example.com/auth/callback"}, true, true},
+	}
+	for _, tt := range tests {
+		ui, err := newUIAuth(tt.config, nil)
+		if (err != nil) != tt.wantErr || (ui == nil) != tt.wantNil {
+			t.Errorf("%s: got %v, %v", tt.name, ui, err)
+		}
+	}
+}
+
+func TestUIAuthBasic(t *testing.T) {
+	sum := sha256.Sum256([]byte("correct horse"))
+	ui := newTestUIAuth(t, UIAuthConfig{
+		Mode:       UIAuthBasic,
+		BasicUsers: []string{"me:hunter2", "you:sha256:" + hex.EncodeToString(sum[:])},
+	})
+	handler := ui.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     int
+	}{
+		{"plain password", "me", "hunter2", http.StatusOK},
+		{"hashed password", "you", "correct horse", http.StatusOK},
+		{"wrong password", "me", "hunter3", http.StatusUnauthorized},
+		{"hash as password", "you", hex.EncodeToString(sum[:]), http.StatusUnauthorized},
+		{"unknown user", "them", "hunter2", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		session := responseCookie(rec, sessionCookieName)
+		if (session != nil) != (tt.want == http.StatusOK) {
+			t.Errorf("%s: session cookie = %v", tt.name, session)
+		}
+		if tt.want == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+			t.Errorf("%s: missing basic auth challenge", tt.name)
+		}
+	}
+}
+
+func TestUIAuthSession(t *testing.T) {
+	ui := newTestUIAuth(t, UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:hunter2"}})
+	now := time.Now()
+	valid := ui.seal("me", now.Add(time.Hour))
+	other := &uiAuth{secret: []byte("other-secret")}
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"valid", valid, true},
+		{"expired", ui.seal("me", now.Add(-time.Minute)), false},
+		{"other user", base64.RawURLEncoding.EncodeToString([]byte("admin")) + valid[strings.Index(valid, "."):], false},
+		{"signed with another secret", other.seal("me", now.Add(time.Hour)), false},
+		{"garbage", "not-a-session", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.value})
+		if got := ui.authenticated(req); got != tt.want {
+			t.Errorf("%s: authenticated = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var none *uiAuth
+	if none.authenticated(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("nil uiAuth should authenticate no one")
+	}
+}
+
+// RSA keys for test providers, generated once as it's slow
+var (
+	testOIDCKeysOnce sync.Once
+	testOIDCKey      *rsa.PrivateKey // Published by the test provider
+	foreignOIDCKey   *rsa.PrivateKey // Not published anywhere
+)
+
+// Sign an ID token with RS256, or leave it unsigned (alg "none") if key is nil
+func testIDToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	payload, _ := json.Marshal(claims)
+	if key == nil {
+		return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	}
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"test-key"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// A minimal OIDC provider issuing ID tokens signed with signer (unsigned if nil)
+func newTestOIDCProvider(t *testing.T, claims func(nonce string) map[string]interface{}, signer *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	var nonce string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kty: "RSA",
+			Kid: "test-key",
+			N:   base64.RawURLEncoding.EncodeToString(testOIDCKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testOIDCKey.E)).Bytes()),
+		}}})
+	})
+	// The test plays the browser, so /authorize just remembers the nonce
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		nonce = r.URL.Query().Get("nonce")
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "weather" || secret != "client-secret" || r.FormValue("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": testIDToken(t, signer, claims(nonce))})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUIAuthOIDC(t *testing.T) {
+	testOIDCKeysOnce.Do(func() {
+		testOIDCKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+		foreignOIDCKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	var provider *httptest.Server
+	tests := []struct {
+		name   string
+		claims func(nonce string) map[string]interface{}
+		code   string
+		want   int
+		signer string // "none" for an unsigned token, "foreign" for a key the provider didn't publish
+	}{
+		{"allowed account", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "Me@Example.com", "email_verified": true}
+		}, "good-code", http.StatusFound, ""},
+		{"audience list", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": []string{"other", "weather"}, "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com", "email_verified": true}
+		}, "good-code", http.StatusFound, ""},
+		{"other account", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "you@example.com"}
+		}, "good-code", http.StatusForbidden, ""},
+		{"email without verification", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com"}
+		}, "good-code", http.StatusForbidden, ""},
+		{"unverified email", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com", "email_verified": false}
+		}, "good-code", http.StatusForbidden, ""},
+		{"replayed token", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "old-nonce", "email": "me@example.com"}
+		}, "good-code", http.StatusForbidden, ""},
+		{"other client", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "other", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com"}
+		}, "good-code", http.StatusForbidden, ""},
+		{"expired token", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(-time.Hour).Unix(), "nonce": nonce, "email": "me@example.com"}
+		}, "good-code", http.StatusForbidden, ""},
+		{"other issuer", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": "https://id.example.com", "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com", "email_verified": true}
+		}, "good-code", http.StatusForbidden, ""},
+		{"unsigned token", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com", "email_verified": true}
+		}, "good-code", http.StatusBadGateway, "none"},
+		{"token signed with another key", func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"iss": provider.URL, "aud": "weather", "exp": time.Now().Add(time.Hour).Unix(), "nonce": nonce, "email": "me@example.com", "email_verified": true}
+		}, "good-code", http.StatusBadGateway, "foreign"},
+		{"bad code", nil, "bad-code", http.StatusBadGateway, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := map[string]*rsa.PrivateKey{"": testOIDCKey, "none": nil, "foreign": foreignOIDCKey}[tt.signer]
+			provider = newTestOIDCProvider(t, tt.claims, signer)
+			ui := newTestUIAuth(t, UIAuthConfig{
+				Mode:              UIAuthOIDC,
+				OIDCIssuer:        provider.URL,
+				OIDCClientID:      "weather",
+				OIDCClientSecret:  "client-secret",
+				OIDCRedirectURL:   "https://weather.example.com/auth/callback",
+				OIDCAllowedEmails: []string{"me@example.com"},
+			})
+
+			// Pages redirect to the login, which redirects to the provider
+			rec := httptest.NewRecorder()
+			ui.middleware(func(w http.ResponseWriter, r *http.Request) {})(rec, httptest.NewRequest(http.MethodGet, "/settings", nil))
+			if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/auth/login?next=%2Fsettings" {
+				t.Fatalf("page: got %d to %q", rec.Code, rec.Header().Get("Location"))
+			}
+			rec = httptest.NewRecorder()
+			ui.handleLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/login?next=%2Fsettings", nil))
+			authorize, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil || !strings.HasPrefix(authorize.String(), provider.URL+"/authorize?") {
+				t.Fatalf("login: redirected to %q", rec.Header().Get("Location"))
+			}
+			state := responseCookie(rec, oidcStateCookieName)
+			if state == nil {
+				t.Fatal("login: no state cookie")
+			}
+			if _, err := http.Get(authorize.String()); err != nil {
+				t.Fatal(err)
+			}
+
+			callback := httptest.NewRequest(http.MethodGet, "/auth/callback?"+url.Values{
+				"code":  {tt.code},
+				"state": {authorize.Query().Get("state")},
+			}.Encode(), nil)
+			callback.AddCookie(state)
+			rec = httptest.NewRecorder()
+			ui.handleCallback(rec, callback)
+			if rec.Code != tt.want {
+				t.Fatalf("callback: got status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			session := responseCookie(rec, sessionCookieName)
+			if (session != nil) != (tt.want == http.StatusFound) {
+				t.Fatalf("callback: session cookie = %v", session)
+			}
+			if session == nil {
+				return
+			}
+			if rec.Header().Get("Location") != "/settings" {
+				t.Errorf("callback: redirected to %q, want /settings", rec.Header().Get("Location"))
+			}
+			page := httptest.NewRequest(http.MethodGet, "/settings", nil)
+			page.AddCookie(session)
+			if user, ok := ui.user(page); !ok || !strings.EqualFold(user, "me@example.com") {
+				t.Errorf("session user = %q, %v", user, ok)
+			}
+		})
+	}
+}
+
+// A discovery document naming another issuer could point logins anywhere
+func TestUIAuthOIDCRejectsForeignDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                "https://attacker.example.com",
+			AuthorizationEndpoint: "https://attacker.example.com/authorize",
+			TokenEndpoint:         "https://attacker.example.com/token",
+			JWKSURI:               "https://attacker.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+	ui := newTestUIAuth(t, UIAuthConfig{
+		Mode:              UIAuthOIDC,
+		OIDCIssuer:        server.URL,
+		OIDCClientID:      "weather",
+		OIDCRedirectURL:   "https://weather.example.com/auth/callback",
+		OIDCAllowedEmails: []string{"me@example.com"},
+	})
+	ui.client = server.Client()
+
+	rec := httptest.NewRecorder()
+	ui.handleLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("login: got %d to %q, want 502", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestUIAuthOIDCRejectsForeignState(t *testing.T) {
+	ui := newTestUIAuth(t, UIAuthConfig{
+		Mode:              UIAuthOIDC,
+		OIDCIssuer:        "https://id.example.com",
+		OIDCClientID:      "weather",
+		OIDCRedirectURL:   "https://weather.example.com/auth/callback",
+		OIDCAllowedEmails: []string{"me@example.com"},
+	})
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"no state cookie", ""},
+		{"other login", ui.seal("other-state nonce /", time.Now().Add(time.Minute))},
+		{"expired login", ui.seal("state nonce /", time.Now().Add(-time.Minute))},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=good-code&state=state", nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: tt.cookie})
+		}
+		rec := httptest.NewRecorder()
+		ui.handleCallback(rec, req)
+		if rec.Code != http.StatusBadRequest || responseCookie(rec, sessionCookieName) != nil {
+			t.Errorf("%s: got status %d", tt.name, rec.Code)
+		}
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/settings", "/settings"},
+		{"/?location=Leeds", "/?location=Leeds"},
+		{"", "/"},
+		{"https://evil.example.com", "/"},
+		{"//evil.example.com", "/"},
+		{"/\\evil.example.com", "/"},
+	}
+	for _, tt := range tests {
+		if got := safeNext(tt.next); got != tt.want {
+			t.Errorf("safeNext(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAuthWithUISession(t *testing.T) {
+	ui := newTestUIAuth(t, UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:hunter2", "you:swordfish"}, AdminUsers: []string{"me"}})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	api := newAPIKeyAuth([]string{"secret-key"})
+	api.sessions = ui
+	admin := newAPIKeyAuth(nil)
+	admin.sessions = ui
+	// UI login without API keys still closes the API
+	uiOnly := newAPIKeyAuth(nil)
+	uiOnly.sessions = ui
+
+	nonAdmins := newAPIKeyAuth(nil)
+	nonAdmins.sessions = newTestUIAuth(t, UIAuthConfig{Mode: UIAuthBasic, BasicUsers: []string{"me:hunter2"}})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		user    string // Logged in as, if set
+		want    int
+	}{
+		{"API with a session", api.middleware(ok), "you", http.StatusOK},
+		{"API without a session", api.middleware(ok), "", http.StatusUnauthorized},
+		{"UI auth without keys, with a session", uiOnly.middleware(ok), "you", http.StatusOK},
+		{"UI auth without keys, without a session", uiOnly.middleware(ok), "", http.StatusUnauthorized},
+		{"feed with UI auth without keys, with a session", uiOnly.feedMiddleware(ok), "you", http.StatusOK},
+		{"feed with UI auth without keys, without a session", uiOnly.feedMiddleware(ok), "", http.StatusUnauthorized},
+		{"no keys or UI auth", newAPIKeyAuth(nil).middleware(ok), "", http.StatusOK},
+		{"admin with an admin's session", admin.adminMiddleware(ok), "me", http.StatusOK},
+		{"admin with another user's session", admin.adminMiddleware(ok), "you", http.StatusUnauthorized},
+		{"admin without a session", admin.adminMiddleware(ok), "", http.StatusUnauthorized},
+		{"admin without UI_ADMIN_USERS", nonAdmins.adminMiddleware(ok), "me", http.StatusForbidden},
+		{"admin without UI auth or keys", newAPIKeyAuth(nil).adminMiddleware(ok), "me", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache", nil)
+		if tt.user != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: ui.seal(tt.user, time.Now().Add(time.Hour))})
+		}
+		rec := httptest.NewRecorder()
+		tt.handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
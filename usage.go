@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How long daily usage totals are kept in the cache backend
+const usageRetention = 32 * 24 * time.Hour
+
+// Returned instead of calling the LLM once the daily budget is spent
+var errLLMBudgetExceeded = errors.New("daily LLM budget exceeded")
+
+// Tokens consumed by a single LLM call, as reported by the provider
+type llmUsage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Token and cost totals for one UTC day
+type UsageTotals struct {
+	Date         string  `json:"date"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	TotalTokens  int     `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// Cache key of the usage totals for a day
+func usageKey(date string) string {
+	return cacheKeyPrefix + "usage:" + date
+}
+
+// Date the usage of a moment is counted under
+func usageDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// Cost of a call at the configured per-million-token prices
+func (agent *WeatherAgent) usageCost(usage llmUsage) float64 {
+	return (float64(usage.InputTokens)*agent.config.LLMInputPricePerMTok +
+		float64(usage.OutputTokens)*agent.config.LLMOutputPricePerMTok) / 1e6
+}
+
+// Usage totals for a day (zero totals if nothing was recorded)
+func (agent *WeatherAgent) usageTotals(date string) UsageTotals {
+	if agent.db != nil {
+		totals, _, err := agent.db.usage(date)
+		if err != nil {
+			agent.logger.Printf("Error reading LLM usage: %v", err)
+		}
+		return totals
+	}
+
+	totals := UsageTotals{Date: date}
+	data, ok, err := agent.cache.Get(usageKey(date))
+	if err != nil {
+		agent.logger.Printf("Error reading LLM usage: %v", err)
+		return totals
+	}
+	if ok {
+		json.Unmarshal(data, &totals)
+	}
+	return totals
+}
+
+// Add an LLM call to today's totals. The read-modify-write is serialized
+// within this instance; replicas sharing Redis may rarely lose an update,
+// but a database counts every call.
+func (agent *WeatherAgent) recordLLMUsage(usage llmUsage) {
+	if agent.db != nil {
+		if err := agent.db.addUsage(usageDate(time.Now()), usage, agent.usageCost(usage)); err != nil {
+			agent.logger.Printf("Error saving LLM usage: %v", err)
+		}
+		return
+	}
+
+	agent.usageMu.Lock()
+	defer agent.usageMu.Unlock()
+
+	totals := agent.usageTotals(usageDate(time.Now()))
+	totals.Requests++
+	totals.InputTokens += usage.InputTokens
+	totals.OutputTokens += usage.OutputTokens
+	totals.TotalTokens = totals.InputTokens + totals.OutputTokens
+	totals.CostUSD += agent.usageCost(usage)
+
+	data, _ := json.Marshal(totals)
+	if err := agent.cache.Set(usageKey(totals.Date), data, usageRetention); err != nil {
+		agent.logger.Printf("Error saving LLM usage: %v", err)
+	}
+}
+
+// Whether today's usage has reached either configured daily budget
+func (agent *WeatherAgent) overBudget() bool {
+	if agent.config.LLMDailyTokenBudget <= 0 && agent.config.LLMDailyCostBudget <= 0 {
+		return false
+	}
+	totals := agent.usageTotals(usageDate(time.Now()))
+	if agent.config.LLMDailyTokenBudget > 0 && totals.TotalTokens >= agent.config.LLMDailyTokenBudget {
+		return true
+	}
+	return agent.config.LLMDailyCostBudget > 0 && totals.CostUSD >= agent.config.LLMDailyCostBudget
+}
+
+// GET /api/usage?days=7 returns daily LLM usage (most recent first) and the budget
+func (agent *WeatherAgent) handleUsage(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		parsed, err := strconv.Atoi(daysParam)
+		if err != nil || parsed < 1 || parsed > 31 {
+			apiError(w, "Invalid days parameter (1-31)", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	now := time.Now()
+	history := make([]UsageTotals, days)
+	for i := range history {
+		history[i] = agent.usageTotals(usageDate(now.AddDate(0, 0, -i)))
+	}
+
+	writeJSON(w, http.StatusOK, UsageResponse{
+		Today: history[0],
+		Days:  history,
+		Budget: UsageBudget{
+			DailyTokens:  agent.config.LLMDailyTokenBudget,
+			DailyCostUSD: agent.config.LLMDailyCostBudget,
+			Exceeded:     agent.overBudget(),
+		},
+	})
+}
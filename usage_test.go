@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordLLMUsage(t *testing.T) {
+	agent := &WeatherAgent{
+		config: Config{LLMInputPricePerMTok: 3, LLMOutputPricePerMTok: 15},
+		logger: log.New(io.Discard, "", 0),
+		cache:  newMemoryCache(),
+	}
+
+	agent.recordLLMUsage(llmUsage{InputTokens: 1000, OutputTokens: 200})
+	agent.recordLLMUsage(llmUsage{InputTokens: 500, OutputTokens: 100})
+
+	rec := httptest.NewRecorder()
+	agent.handleUsage(rec, httptest.NewRequest("GET", "/api/usage?days=3", nil))
+	var resp struct {
+		Today UsageTotals   `json:"today"`
+		Days  []UsageTotals `json:"days"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding /api/usage: %v", err)
+	}
+
+	today := resp.Today
+	if today.Requests != 2 || today.InputTokens != 1500 || today.OutputTokens != 300 || today.TotalTokens != 1800 {
+		t.Errorf("unexpected totals %+v", today)
+	}
+	// 1500 * $3/M + 300 * $15/M
+	if math.Abs(today.CostUSD-0.009) > 1e-9 {
+		t.Errorf("cost = %f, want 0.009", today.CostUSD)
+	}
+	if len(resp.Days) != 3 || resp.Days[1].Requests != 0 {
+		t.Errorf("unexpected daily history %+v", resp.Days)
+	}
+
+	rec = httptest.NewRecorder()
+	agent.handleUsage(rec, httptest.NewRequest("GET", "/api/usage?days=90", nil))
+	if rec.Code != 400 {
+		t.Errorf("days=90: got status %d, want 400", rec.Code)
+	}
+}
+
+func TestOverBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   bool
+	}{
+		{"no budget", Config{}, false},
+		{"under token budget", Config{LLMDailyTokenBudget: 5000}, false},
+		{"token budget spent", Config{LLMDailyTokenBudget: 1200}, true},
+		{"cost budget spent", Config{LLMDailyCostBudget: 0.001, LLMInputPricePerMTok: 1}, true},
+	}
+	for _, tt := range tests {
+		agent := &WeatherAgent{config: tt.config, logger: log.New(io.Discard, "", 0), cache: newMemoryCache()}
+		agent.recordLLMUsage(llmUsage{InputTokens: 1000, OutputTokens: 200})
+		if got := agent.overBudget(); got != tt.want {
+			t.Errorf("%s: overBudget() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCachedLLMMessageOverBudget(t *testing.T) {
+	agent := &WeatherAgent{
+		config: Config{LLMAPIKey: "test-key", LLMDailyTokenBudget: 100, LLMCacheMinutes: 30, Units: "metric"},
+		logger: log.New(io.Discard, "", 0),
+		cache:  newMemoryCache(),
+	}
+	agent.recordLLMUsage(llmUsage{InputTokens: 100})
+	weather := statusWeather("Clear", 1, 20)
+
+	if message, err := agent.cachedLLMMessage(weather, "", "", agent.llmParams()); err != nil || message != agent.renderTemplateMessage(weather) {
+		t.Fatalf("over budget without a last message got %q, %v; want the template message", message, err)
+	}
+
+	agent.setLastMessage(weatherLocationKey(weather), "Sunny and 20°C.")
+	message, err := agent.cachedLLMMessage(weather, "", "", agent.llmParams())
+	if err != nil || message != "Sunny and 20°C." {
+		t.Errorf("over budget got %q, %v; want the last message", message, err)
+	}
+}
+
+func TestProviderUsageParsing(t *testing.T) {
+	var anthropic AnthropicResponse
+	json.Unmarshal([]byte(`{"content":[{"text":"hi"}],"usage":{"input_tokens":12,"output_tokens":34}}`), &anthropic)
+	if anthropic.Usage.InputTokens != 12 || anthropic.Usage.OutputTokens != 34 {
+		t.Errorf("anthropic usage = %+v", anthropic.Usage)
+	}
+
+	var openai OpenAIResponse
+	json.Unmarshal([]byte(`{"choices":[],"usage":{"prompt_tokens":56,"completion_tokens":78}}`), &openai)
+	if openai.Usage.PromptTokens != 56 || openai.Usage.CompletionTokens != 78 {
+		t.Errorf("openai usage = %+v", openai.Usage)
+	}
+}
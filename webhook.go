@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notifier that POSTs notifications as JSON to a URL
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+
+	// Set for operator-configured webhooks
+	headers     map[string]string
+	body        *template.Template // Renders the body from a webhookPayload instead of plain JSON
+	contentType string
+	events      []string // Notification types delivered (empty for all)
+}
+
+// An outbound webhook in the WEBHOOKS_FILE JSON list
+type WebhookConfig struct {
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`      // Values may reference ${ENV_VARS}
+	Template    string            `json:"template,omitempty"`     // Go text/template for the body
+	ContentType string            `json:"content_type,omitempty"` // Defaults to application/json
+	Events      []string          `json:"events,omitempty"`       // e.g. ["update", "alert"]; empty for all
+}
+
+// JSON body sent to webhooks
+type webhookPayload struct {
+	MessageID string    `json:"message_id"`
+	Type      string    `json:"type"`
+	AlertType string    `json:"alert_type,omitempty"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	City      string    `json:"city"`
+	Country   string    `json:"country"`
+	Units     string    `json:"units"`
+	Time      time.Time `json:"time"`
+	AckURL    string    `json:"ack_url,omitempty"` // POST here to acknowledge the message
+
+	Severity      string `json:"severity"` // none, advisory, watch, warning or emergency
+	SeverityColor string `json:"severity_color"`
+
+	Data map[string]interface{} `json:"data,omitempty"` // Prepared weather data
+}
+
+// Functions available to webhook body templates
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Create an operator-configured webhook
+func newConfiguredWebhook(config WebhookConfig) (*webhookNotifier, error) {
+	h, err := newWebhookNotifier(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	h.headers = make(map[string]string, len(config.Headers))
+	for name, value := range config.Headers {
+		h.headers[name] = os.ExpandEnv(value)
+	}
+	if config.Template != "" {
+		if h.body, err = template.New("webhook").Funcs(webhookTemplateFuncs).Parse(config.Template); err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %v", err)
+		}
+	}
+	h.contentType = config.ContentType
+	for _, event := range config.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		switch event {
+		case NotificationDigest, NotificationUpdate, NotificationAlert, NotificationReport:
+			h.events = append(h.events, event)
+		default:
+			return nil, fmt.Errorf("unknown webhook event %q (use digest, update, alert or report)", event)
+		}
+	}
+	return h, nil
+}
+
+// Load the webhooks listed in a JSON file
+func loadWebhooks(path string) ([]*webhookNotifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []WebhookConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	webhooks := make([]*webhookNotifier, 0, len(configs))
+	for i, config := range configs {
+		h, err := newConfiguredWebhook(config)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d (%s): %v", i+1, config.URL, err)
+		}
+		webhooks = append(webhooks, h)
+	}
+	return webhooks, nil
+}
+
+func newWebhookNotifier(rawURL string) (*webhookNotifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be an absolute http(s) URL")
+	}
+	return &webhookNotifier{
+		url:    rawURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (h *webhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+func (h *webhookNotifier) Target() string {
+	return h.url
+}
+
+// Whether the webhook receives a notification type
+func (h *webhookNotifier) wants(notificationType string) bool {
+	if len(h.events) == 0 {
+		return true
+	}
+	for _, event := range h.events {
+		if event == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *webhookNotifier) Notify(n Notification) error {
+	payload := webhookPayload{
+		MessageID: n.MessageID,
+		Type:      n.Type,
+		AlertType: n.AlertType,
+		Title:     n.Title,
+		Message:   n.Message,
+		City:      n.City,
+		Country:   n.Country,
+		Units:     n.Units,
+		Time:      n.Time,
+		AckURL:    n.EngagementURL,
+		Data:      n.Data,
+	}
+	payload.Severity = notificationSeverity(n)
+	payload.SeverityColor = severityColor(payload.Severity)
+
+	var body bytes.Buffer
+	if h.body != nil {
+		if err := h.body.Execute(&body, payload); err != nil {
+			return fmt.Errorf("webhook template failed: %v", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, &body)
+	if err != nil {
+		return err
+	}
+	contentType := h.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfiguredWebhook(t *testing.T) {
+	type request struct {
+		auth, contentType, body string
+	}
+	var received []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, request{r.Header.Get("Authorization"), r.Header.Get("Content-Type"), string(body)})
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_WEBHOOK_TOKEN", "s3cret")
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	configs := []WebhookConfig{
+		{
+			URL:         server.URL,
+			Headers:     map[string]string{"Authorization": "Bearer ${TEST_WEBHOOK_TOKEN}"},
+			Template:    `{{.City}}: {{.Message}} {{json .Data}}`,
+			ContentType: "text/plain",
+			Events:      []string{"alert"},
+		},
+		{URL: server.URL},
+	}
+	data, _ := json.Marshal(configs)
+	os.WriteFile(path, data, 0644)
+
+	webhooks, err := loadWebhooks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &WeatherAgent{logger: log.New(io.Discard, "", 0), deliveries: newDeliveryLog()}
+	for _, webhook := range webhooks {
+		agent.notifiers = append(agent.notifiers, webhook)
+	}
+
+	agent.notify(Notification{Type: NotificationAlert, City: "Oslo", Message: "storm", Data: map[string]interface{}{"wind_speed": "90 km/h"}})
+	if len(received) != 2 {
+		t.Fatalf("expected both webhooks to get the alert, got %d requests", len(received))
+	}
+	templated := received[0]
+	if templated.auth != "Bearer s3cret" || templated.contentType != "text/plain" ||
+		templated.body != `Oslo: storm {"wind_speed":"90 km/h"}` {
+		t.Errorf("unexpected templated request %+v", templated)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal([]byte(received[1].body), &payload); err != nil || payload.Message != "storm" || payload.Data["wind_speed"] != "90 km/h" {
+		t.Errorf("unexpected JSON payload %q (%v)", received[1].body, err)
+	}
+
+	// The alert-only webhook skips updates
+	received = nil
+	agent.notify(Notification{Type: NotificationUpdate, Message: "sunny"})
+	if len(received) != 1 || received[0].contentType != "application/json" {
+		t.Errorf("expected only the unfiltered webhook to get the update, got %+v", received)
+	}
+}
+
+func TestNewConfiguredWebhookErrors(t *testing.T) {
+	tests := []WebhookConfig{
+		{URL: "not a url"},
+		{URL: "https://example.com/hook", Template: "{{.Missing"},
+		{URL: "https://example.com/hook", Events: []string{"sometimes"}},
+	}
+	for _, config := range tests {
+		if _, err := newConfiguredWebhook(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// NASA FIRMS settings
+const (
+	firmsAreaURL     = "https://firms.modaps.eosdis.nasa.gov/api/area/csv"
+	firmsSource      = "VIIRS_SNPP_NRT" // 375 m active fire detections, near real time
+	firmsCacheTTL    = 30 * time.Minute // Satellite passes are hours apart
+	firmsDayRange    = 1
+	upwindHalfAngle  = 45  // Degrees either side of the wind direction counted as upwind
+	calmWindKmh      = 5   // Below this smoke lingers in every direction
+	heavySmokeFRP    = 500 // Total upwind fire radiative power (MW) that signals heavy smoke
+	nearbyFireRadius = 25  // Upwind fires within this many km mean smoke is likely whatever their size
+)
+
+// Smoke risk levels
+const (
+	SmokeNone     = "none"
+	SmokeLow      = "low"
+	SmokeModerate = "moderate"
+	SmokeHigh     = "high"
+)
+
+// A satellite active fire detection
+type FireDetection struct {
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	FRP        float64 `json:"frp_mw"` // Fire radiative power
+	DistanceKm float64 `json:"distance_km"`
+	Bearing    float64 `json:"bearing"` // Degrees from the location to the fire
+}
+
+// Active fires around a location and the smoke risk they pose
+type Wildfire struct {
+	Fires          int     `json:"fires"`
+	UpwindFires    int     `json:"upwind_fires"`
+	NearestKm      float64 `json:"nearest_km,omitempty"`
+	NearestBearing float64 `json:"nearest_bearing,omitempty"`
+	UpwindFRP      float64 `json:"upwind_frp_mw"`
+	SmokeRisk      string  `json:"smoke_risk"`
+	RadiusKm       int     `json:"radius_km"`
+}
+
+// Initial great-circle bearing from one point to another, 0-360 degrees
+func bearingDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+	return normalizeDegrees(math.Atan2(y, x) * 180 / math.Pi)
+}
+
+// Smallest difference between two angles in degrees
+func angleDifference(a, b float64) float64 {
+	diff := math.Abs(normalizeDegrees(a) - normalizeDegrees(b))
+	return math.Min(diff, 360-diff)
+}
+
+// Parse a FIRMS area CSV into detections within radiusKm of the location,
+// skipping low-confidence ones
+func parseFIRMS(body []byte, lat, lon float64, radiusKm int) ([]FireDetection, error) {
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FIRMS response: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"latitude", "longitude", "frp"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("unexpected FIRMS response (no %s column): %.100s", name, body)
+		}
+	}
+
+	var fires []FireDetection
+	for _, record := range records[1:] {
+		if i, ok := columns["confidence"]; ok && i < len(record) && (record[i] == "l" || record[i] == "low") {
+			continue
+		}
+		fireLat, errLat := strconv.ParseFloat(record[columns["latitude"]], 64)
+		fireLon, errLon := strconv.ParseFloat(record[columns["longitude"]], 64)
+		if errLat != nil || errLon != nil {
+			continue
+		}
+		frp, _ := strconv.ParseFloat(record[columns["frp"]], 64)
+
+		distance := distanceKm(lat, lon, fireLat, fireLon)
+		if distance > float64(radiusKm) {
+			continue
+		}
+		fires = append(fires, FireDetection{
+			Lat:        fireLat,
+			Lon:        fireLon,
+			FRP:        frp,
+			DistanceKm: distance,
+			Bearing:    bearingDegrees(lat, lon, fireLat, fireLon),
+		})
+	}
+	return fires, nil
+}
+
+// Assess the smoke risk from fires given the wind (direction it blows from)
+func assessWildfire(fires []FireDetection, windFrom, windKmh float64, radiusKm int) Wildfire {
+	w := Wildfire{Fires: len(fires), SmokeRisk: SmokeNone, RadiusKm: radiusKm}
+	if len(fires) == 0 {
+		return w
+	}
+
+	nearest, nearestUpwind := fires[0], math.Inf(1)
+	for _, fire := range fires {
+		if fire.DistanceKm < nearest.DistanceKm {
+			nearest = fire
+		}
+		// Without a steady wind, smoke from close fires drifts in any direction
+		upwind := angleDifference(fire.Bearing, windFrom) <= upwindHalfAngle
+		if windKmh < calmWindKmh {
+			upwind = fire.DistanceKm <= nearbyFireRadius
+		}
+		if upwind {
+			w.UpwindFires++
+			w.UpwindFRP += fire.FRP
+			nearestUpwind = math.Min(nearestUpwind, fire.DistanceKm)
+		}
+	}
+	w.NearestKm, w.NearestBearing = math.Round(nearest.DistanceKm), math.Round(nearest.Bearing)
+	w.UpwindFRP = math.Round(w.UpwindFRP)
+
+	switch {
+	case w.UpwindFires == 0:
+		w.SmokeRisk = SmokeLow
+	case w.UpwindFRP >= heavySmokeFRP || nearestUpwind <= nearbyFireRadius:
+		w.SmokeRisk = SmokeHigh
+	default:
+		w.SmokeRisk = SmokeModerate
+	}
+	return w
+}
+
+// Fetch active fires around coordinates from NASA FIRMS
+func (agent *WeatherAgent) fetchFires(lat, lon float64) ([]FireDetection, error) {
+	radius := agent.config.WildfireRadiusKm
+	dLat := float64(radius) / 111
+	dLon := float64(radius) / (111 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	area := fmt.Sprintf("%.3f,%.3f,%.3f,%.3f", lon-dLon, lat-dLat, lon+dLon, lat+dLat)
+
+	requestURL := fmt.Sprintf("%s/%s/%s/%s/%d", firmsAreaURL, agent.config.FIRMSMapKey, firmsSource, area, firmsDayRange)
+	body, _, err := agent.cachedGet(requestURL, firmsCacheTTL, false)
+	if err != nil {
+		return nil, fmt.Errorf("FIRMS request failed: %v", redactSecrets(err.Error(), []string{agent.config.FIRMSMapKey}))
+	}
+	return parseFIRMS(body, lat, lon, radius)
+}
+
+// Attach active fire and smoke risk data when a FIRMS key is configured
+func (agent *WeatherAgent) addWildfire(weather *WeatherResponse, lat, lon float64) {
+	if agent.config.FIRMSMapKey == "" {
+		return
+	}
+
+	fires, err := agent.fetchFires(lat, lon)
+	if err != nil {
+		agent.logger.Printf("Warning: Failed to fetch active fires: %v", err)
+		return
+	}
+	windKmh := units.SpeedIn(weather.Wind.Speed, agent.units()).KilometersPerHour()
+	wildfire := assessWildfire(fires, float64(weather.Wind.Deg), windKmh, agent.config.WildfireRadiusKm)
+	weather.Wildfire = &wildfire
+}
+
+// Add active fires and smoke risk to the LLM data map
+func (agent *WeatherAgent) addWildfireData(weather WeatherResponse, data map[string]interface{}) {
+	w := weather.Wildfire
+	if w == nil || w.Fires == 0 {
+		return
+	}
+	data["active_fires"] = fmt.Sprintf("%d within %d km, nearest %.0f km to the %s (%d upwind)",
+		w.Fires, w.RadiusKm, w.NearestKm, compassDirection(agent.weatherLocale(weather), w.NearestBearing), w.UpwindFires)
+	data["smoke_risk"] = w.SmokeRisk
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBearingDegrees(t *testing.T) {
+	tests := []struct {
+		name       string
+		lat2, lon2 float64
+		want       float64
+	}{
+		{"north", 1, 0, 0},
+		{"east", 0, 1, 90},
+		{"south", -1, 0, 180},
+		{"west", 0, -1, 270},
+	}
+
+	for _, tt := range tests {
+		if got := bearingDegrees(0, 0, tt.lat2, tt.lon2); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%s: bearingDegrees() = %.2f, want %.0f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFIRMS(t *testing.T) {
+	body := []byte(`latitude,longitude,bright_ti4,scan,track,acq_date,acq_time,satellite,instrument,confidence,version,bright_ti5,frp,daynight
+34.20,-118.20,330.1,0.4,0.4,2026-10-17,0912,N,VIIRS,n,2.0NRT,290.2,12.5,N
+34.25,-118.25,340.3,0.4,0.4,2026-10-17,0912,N,VIIRS,h,2.0NRT,295.0,48.0,N
+34.30,-118.30,300.0,0.4,0.4,2026-10-17,0912,N,VIIRS,l,2.0NRT,280.0,3.0,N
+36.00,-118.00,335.0,0.4,0.4,2026-10-17,0912,N,VIIRS,n,2.0NRT,291.0,20.0,N
+`)
+
+	// Los Angeles; the third fire is low confidence and the fourth is ~200 km away
+	fires, err := parseFIRMS(body, 34.05, -118.24, 100)
+	if err != nil {
+		t.Fatalf("parseFIRMS() error = %v", err)
+	}
+	if len(fires) != 2 {
+		t.Fatalf("got %d fires, want 2: %+v", len(fires), fires)
+	}
+	if fires[1].FRP != 48 || fires[1].DistanceKm > 25 || angleDifference(fires[1].Bearing, 0) > 45 {
+		t.Errorf("second fire = %+v, want 48 MW within 25 km to the north", fires[1])
+	}
+
+	if _, err := parseFIRMS([]byte("Invalid MAP_KEY.\n"), 34.05, -118.24, 100); err == nil {
+		t.Error("parseFIRMS() with an error body: expected error")
+	}
+}
+
+func TestAssessWildfire(t *testing.T) {
+	north := FireDetection{DistanceKm: 60, Bearing: 10, FRP: 100}
+	bigNorth := FireDetection{DistanceKm: 80, Bearing: 350, FRP: 600}
+	close := FireDetection{DistanceKm: 15, Bearing: 180, FRP: 20}
+
+	tests := []struct {
+		name     string
+		fires    []FireDetection
+		windFrom float64
+		windKmh  float64
+		want     string
+		upwind   int
+	}{
+		{"no fires", nil, 0, 20, SmokeNone, 0},
+		{"fires downwind", []FireDetection{north}, 180, 20, SmokeLow, 0},
+		{"small fire upwind", []FireDetection{north}, 0, 20, SmokeModerate, 1},
+		{"large fire upwind", []FireDetection{north, bigNorth}, 0, 20, SmokeHigh, 2},
+		{"calm with a close fire", []FireDetection{north, close}, 0, 2, SmokeHigh, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assessWildfire(tt.fires, tt.windFrom, tt.windKmh, 100)
+			if got.SmokeRisk != tt.want || got.UpwindFires != tt.upwind {
+				t.Errorf("assessWildfire() = %s with %d upwind, want %s with %d", got.SmokeRisk, got.UpwindFires, tt.want, tt.upwind)
+			}
+		})
+	}
+}
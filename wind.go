@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+
+	"github.com/joshkenney/weather-agent/pkg/units"
+)
+
+// Arrows pointing where the wind blows to, for winds from N, NE, E, ...
+var windArrows = []string{"↓", "↙", "←", "↖", "↑", "↗", "→", "↘"}
+
+// Arrow showing which way a wind from the given direction blows
+func windArrow(degrees float64) string {
+	degrees = math.Mod(math.Mod(degrees, 360)+360, 360)
+	return windArrows[int(math.Floor((degrees+22.5)/45))%len(windArrows)]
+}
+
+// Add the Beaufort force and a direction arrow. Calm air has no direction,
+// so providers' leftover bearing is replaced rather than passed on.
+func (agent *WeatherAgent) addWindData(weather WeatherResponse, data map[string]interface{}) {
+	force := units.SpeedIn(weather.Wind.Speed, agent.weatherUnits(weather)).Beaufort()
+	data["wind_beaufort"] = force
+	data["wind_beaufort_description"] = beaufortDescription(agent.weatherLocale(weather), force)
+	if force == 0 {
+		data["wind_calm"] = true
+		data["wind_direction_text"] = translate(agent.weatherLocale(weather), msgCalm)
+		delete(data, "wind_direction")
+		return
+	}
+	data["wind_direction_arrow"] = windArrow(float64(weather.Wind.Deg))
+}
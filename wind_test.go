@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestWindArrow(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		want    string
+	}{
+		{0, "↓"},
+		{22.4, "↓"},
+		{22.5, "↙"},
+		{90, "←"},
+		{225, "↗"},
+		{337.5, "↓"},
+		{-90, "→"},
+	}
+	for _, tt := range tests {
+		if got := windArrow(tt.degrees); got != tt.want {
+			t.Errorf("windArrow(%v) = %q, want %q", tt.degrees, got, tt.want)
+		}
+	}
+}
+
+func TestAddWindData(t *testing.T) {
+	tests := []struct {
+		name        string
+		units       string
+		speed       float64
+		deg         int
+		force       int
+		description string
+		direction   string
+		arrow       string
+	}{
+		{"calm", "metric", 1.7, 200, 0, "Calm", "calm", ""},
+		{"light air", "metric", 1.8, 200, 1, "Light air", "SSW", "↑"},
+		{"fresh breeze", "metric", 30, 240, 5, "Fresh breeze", "WSW", "↗"},
+		{"gale in mph", "imperial", 40, 350, 8, "Gale", "N", "↓"},
+	}
+	for _, tt := range tests {
+		agent := newFixtureAgent(t, Config{Units: tt.units})
+		weather := WeatherResponse{}
+		weather.Wind.Speed, weather.Wind.Deg = tt.speed, tt.deg
+		data := map[string]interface{}{
+			"wind_direction":      tt.deg,
+			"wind_direction_text": compassDirection("en", float64(tt.deg)),
+		}
+		agent.addWindData(weather, data)
+
+		if data["wind_beaufort"] != tt.force || data["wind_beaufort_description"] != tt.description || data["wind_direction_text"] != tt.direction {
+			t.Errorf("%s: got %v", tt.name, data)
+		}
+		arrow, _ := data["wind_direction_arrow"].(string)
+		_, hasDegrees := data["wind_direction"]
+		if arrow != tt.arrow || hasDegrees != (tt.force > 0) || (data["wind_calm"] == true) != (tt.force == 0) {
+			t.Errorf("%s: got %v", tt.name, data)
+		}
+	}
+}